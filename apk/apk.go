@@ -38,6 +38,8 @@ import (
 	"io"
 	"net/mail"
 	"os"
+	"path"
+	"regexp"
 	"strings"
 	"sync/atomic"
 	"text/template"
@@ -46,12 +48,18 @@ import (
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/files"
 	"github.com/goreleaser/nfpm/v2/internal/maps"
+	"github.com/goreleaser/nfpm/v2/internal/modtime"
 	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 	gzip "github.com/klauspost/pgzip"
 )
 
 const packagerName = "apk"
 
+// paxChecksumRecord holds the SHA1 checksum of the content of each file, which
+// apk-tools checks when installing the package.
+const paxChecksumRecord = "APK-TOOLS.checksum.SHA1"
+
 // nolint: gochecknoinits
 func init() {
 	nfpm.RegisterPackager(packagerName, Default)
@@ -69,7 +77,15 @@ var archToAlpine = map[string]string{
 	"s390":    "s390x",
 }
 
+// ensureValidArch returns a copy of info with the arch translated to the
+// one the packager uses, and the name of the apk package set. The given info
+// is not modified.
 func ensureValidArch(info *nfpm.Info) *nfpm.Info {
+	cp := *info
+	info = &cp
+	if info.APK.PackageName != "" {
+		info.Name = info.APK.PackageName
+	}
 	if info.APK.Arch != "" {
 		info.Arch = info.APK.Arch
 	} else if arch, ok := archToAlpine[info.Arch]; ok {
@@ -79,6 +95,33 @@ func ensureValidArch(info *nfpm.Info) *nfpm.Info {
 	return info
 }
 
+// validateArch checks that alpine has a port for the arch, which it does not
+// for armv5, whether it is set as arm5 or as arm with goarm 5, unless the apk
+// arch is set.
+func validateArch(info *nfpm.Info) error {
+	arch := info.Arch
+	if arch == "arm" && info.Goarm == "5" {
+		arch = "arm5"
+	}
+	if info.APK.Arch == "" && arch == "arm5" {
+		return nfpm.NewValidationError("unsupported_arch", "arch", "unsupported arch: %s: not supported by apk packages, set apk.arch instead", arch)
+	}
+	return nil
+}
+
+// prepareInfo returns a copy of info prepared for the packager, so that the
+// given info is left as is and can be reused.
+func prepareInfo(info *nfpm.Info) (*nfpm.Info, error) {
+	if err := validateArch(info); err != nil {
+		return nil, err
+	}
+	info = ensureValidArch(info.Copy())
+	if err := nfpm.PrepareForPackager(info, packagerName); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
 // Default apk packager.
 // nolint: gochecknoglobals
 var Default = &Apk{}
@@ -87,7 +130,7 @@ var Default = &Apk{}
 type Apk struct{}
 
 func (a *Apk) ConventionalFileName(info *nfpm.Info) string {
-	info = ensureValidArch(info)
+	info = ensureValidArch(nfpm.WithSnapshot(info, packagerName))
 	version := pkgver(info)
 	return fmt.Sprintf("%s_%s_%s.apk", info.Name, version, info.Arch)
 }
@@ -97,16 +140,35 @@ func (*Apk) ConventionalExtension() string {
 	return ".apk"
 }
 
+// Capabilities returns the features of apk packages, see nfpm.Formats.
+func (*Apk) Capabilities() nfpm.Capabilities {
+	return nfpm.Capabilities{
+		Compressions: []string{"gzip"},
+		Signing:      true,
+		Triggers:     true,
+	}
+}
+
 // Package writes a new apk package to the given writer using the given info.
 func (*Apk) Package(info *nfpm.Info, apk io.Writer) (err error) {
 	if info.Platform != "linux" {
 		return fmt.Errorf("invalid platform: %s", info.Platform)
 	}
-	info = ensureValidArch(info)
+	info, err = prepareInfo(info)
+	if err != nil {
+		return err
+	}
 
-	if err := nfpm.PrepareForPackager(info, packagerName); err != nil {
+	if err := validateTriggers(info.APK.Triggers); err != nil {
 		return err
 	}
+	if err := validatePkginfo(info); err != nil {
+		return err
+	}
+	if len(info.Alternatives) > 0 {
+		warning.Println("alternatives are not supported by apk packages, ignoring them")
+	}
+	warnWeakDependencies(info)
 
 	var bufData bytes.Buffer
 
@@ -124,7 +186,7 @@ func (*Apk) Package(info *nfpm.Info, apk io.Writer) (err error) {
 		return err
 	}
 
-	if info.APK.Signature.KeyFile == "" && info.APK.Signature.SignFn == nil {
+	if !info.APK.Signature.HasKey() && info.APK.Signature.SignFn == nil {
 		return combineToApk(apk, &bufControl, &bufData)
 	}
 
@@ -180,9 +242,18 @@ const (
 	tarCut
 )
 
+// newGzipWriter returns a gzip writer whose header does not depend on when or
+// where the package is built: its mtime is zeroed and its OS is unknown.
+func newGzipWriter(w io.Writer) *gzip.Writer {
+	gw := gzip.NewWriter(w)
+	gw.ModTime = time.Unix(0, 0)
+	gw.OS = 255
+	return gw
+}
+
 func writeTgz(w io.Writer, kind tarKind, builder func(tw *tar.Writer) error, digest hash.Hash) ([]byte, error) {
 	mw := io.MultiWriter(digest, w)
-	gw := gzip.NewWriter(mw)
+	gw := newGzipWriter(mw)
 	cw := newWriterCounter(gw)
 	bw := bufio.NewWriterSize(cw, 4096)
 	tw := tar.NewWriter(bw)
@@ -265,7 +336,7 @@ func createSignatureBuilder(digest []byte, info *nfpm.Info) func(*tar.Writer) er
 			signature, err = signFn(bytes.NewReader(digest))
 		} else {
 			signature, err = sign.RSASignSHA1Digest(digest,
-				info.APK.Signature.KeyFile, info.APK.Signature.KeyPassphrase)
+				sign.SignatureKey(info.APK.Signature.PackageSignature), info.APK.Signature.KeyPassphrase)
 		}
 		if err != nil {
 			return err
@@ -317,6 +388,8 @@ func createBuilderControl(info *nfpm.Info, size int64, dataDigest []byte) func(t
 			Info:          info,
 			InstalledSize: size,
 			Datahash:      hex.EncodeToString(dataDigest),
+			BuildDate:     modtime.Get(info.MTime, modtime.FromEnv()).Unix(),
+			InstallIf:     installIf(info),
 		}); err != nil {
 			return err
 		}
@@ -332,26 +405,19 @@ func createBuilderControl(info *nfpm.Info, size int64, dataDigest []byte) func(t
 			return err
 		}
 
-		// NOTE: Apk scripts tend to follow the pattern:
-		// #!/bin/sh
-		//
-		// bin/echo 'running preinstall.sh' // do stuff here
-		//
-		// exit 0
-		scripts := map[string]string{
-			".pre-install":    info.Scripts.PreInstall,
-			".pre-upgrade":    info.APK.Scripts.PreUpgrade,
-			".post-install":   info.Scripts.PostInstall,
-			".post-upgrade":   info.APK.Scripts.PostUpgrade,
-			".pre-deinstall":  info.Scripts.PreRemove,
-			".post-deinstall": info.Scripts.PostRemove,
+		scripts, err := maintainerScripts(info)
+		if err != nil {
+			return err
 		}
 		for _, name := range maps.Keys(scripts) {
-			path := scripts[name]
-			if path == "" {
-				continue
-			}
-			if err := newScriptInsideTarGz(tw, path, name); err != nil {
+			content := []byte(scripts[name])
+			if err := newItemInsideTarGz(tw, content, &tar.Header{
+				Name:     files.ToNixPath(name),
+				Size:     int64(len(content)),
+				Mode:     0o755,
+				ModTime:  modtime.Get(info.MTime),
+				Typeflag: tar.TypeReg,
+			}); err != nil {
 				return err
 			}
 		}
@@ -360,22 +426,157 @@ func createBuilderControl(info *nfpm.Info, size int64, dataDigest []byte) func(t
 	}
 }
 
-func newScriptInsideTarGz(out *tar.Writer, path, dest string) error {
-	file, err := os.Stat(path) //nolint:gosec
-	if err != nil {
-		return err
+// ErrInvalidTrigger happens when the trigger configuration is incomplete or
+// contains invalid monitored paths.
+var ErrInvalidTrigger = errors.New("invalid apk trigger")
+
+func validateTriggers(triggers nfpm.APKTriggers) error {
+	if len(triggers.Paths) == 0 && triggers.Script == "" {
+		return nil
+	}
+	if len(triggers.Paths) == 0 {
+		return fmt.Errorf("%w: script %s has no monitored paths", ErrInvalidTrigger, triggers.Script)
+	}
+	if triggers.Script == "" {
+		return fmt.Errorf("%w: monitored paths require a script", ErrInvalidTrigger)
+	}
+	for _, p := range triggers.Paths {
+		if !path.IsAbs(p) || strings.ContainsAny(p, " \t\n") {
+			return fmt.Errorf("%w: monitored path %q must be absolute and must not contain whitespace", ErrInvalidTrigger, p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%w: monitored path %q: %w", ErrInvalidTrigger, p, err)
+		}
+	}
+	return nil
+}
+
+// ErrInvalidPkginfo happens when the origin, commit, priorities, provides or
+// maintainer cannot be written to the .PKGINFO.
+var ErrInvalidPkginfo = errors.New("invalid apk package info")
+
+// nolint: gochecknoglobals
+var (
+	originRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+	commitRegexp = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+	// provides are made of an optional namespace, such as so, cmd or pc, a
+	// name and an optional version.
+	providesRegexp = regexp.MustCompile(`^([a-z][a-z0-9]*:)?[A-Za-z0-9_][A-Za-z0-9._+@-]*(=[0-9][A-Za-z0-9._+~-]*)?$`)
+)
+
+func validatePkginfo(info *nfpm.Info) error {
+	if origin := info.APK.Origin; origin != "" && !originRegexp.MatchString(origin) {
+		return fmt.Errorf("%w: origin %q is not a valid package name", ErrInvalidPkginfo, origin)
+	}
+	if commit := info.APK.Commit; commit != "" && !commitRegexp.MatchString(commit) {
+		return fmt.Errorf("%w: commit %q is not a lowercase hexadecimal commit hash", ErrInvalidPkginfo, commit)
+	}
+	if priority := info.APK.ProviderPriority; priority < 0 {
+		return fmt.Errorf("%w: provider_priority must not be negative, got %d", ErrInvalidPkginfo, priority)
 	}
-	content, err := os.ReadFile(path)
+	if priority := info.APK.ReplacesPriority; priority < 0 {
+		return fmt.Errorf("%w: replaces_priority must not be negative, got %d", ErrInvalidPkginfo, priority)
+	}
+	for _, provides := range info.APK.Provides {
+		if !providesRegexp.MatchString(provides) {
+			return fmt.Errorf("%w: provides %q is not of the form [namespace:]name[=version]", ErrInvalidPkginfo, provides)
+		}
+	}
+	if strings.ContainsAny(info.Maintainer, "\r\n") {
+		return fmt.Errorf("%w: maintainer must be a single line", ErrInvalidPkginfo)
+	}
+	switch info.APK.WeakDependencies {
+	case "", nfpm.APKWeakDependenciesWarn, nfpm.APKWeakDependenciesIgnore, nfpm.APKWeakDependenciesInstallIf:
+	default:
+		return fmt.Errorf("%w: weak_dependencies must be one of %s, %s or %s, got %q", ErrInvalidPkginfo,
+			nfpm.APKWeakDependenciesWarn, nfpm.APKWeakDependenciesIgnore, nfpm.APKWeakDependenciesInstallIf,
+			info.APK.WeakDependencies)
+	}
+	return nil
+}
+
+// warnWeakDependencies warns, once per package, about the recommends and
+// suggests that are left out of it, see nfpm.APK.WeakDependencies.
+func warnWeakDependencies(info *nfpm.Info) {
+	switch info.APK.WeakDependencies {
+	case nfpm.APKWeakDependenciesIgnore:
+	case nfpm.APKWeakDependenciesInstallIf:
+		if len(info.Suggests) > 0 {
+			warning.Println("suggests are not supported by apk packages, ignoring them")
+		}
+	default:
+		if len(info.Recommends) > 0 || len(info.Suggests) > 0 {
+			warning.Println("recommends and suggests are not supported by apk packages, ignoring them")
+		}
+	}
+}
+
+// installIf returns the install_if of the package, the recommends of the
+// info if they are mapped to it, see nfpm.APKWeakDependenciesInstallIf.
+func installIf(info *nfpm.Info) []string {
+	if info.APK.WeakDependencies != nfpm.APKWeakDependenciesInstallIf {
+		return nil
+	}
+	return info.Recommends
+}
+
+// Scriptlets returns the scripts of the apk package created with the given
+// info, e.g. .pre-install or .trigger, with the snippets nfpm generates
+// appended, see nfpm.Scriptlets.
+func (*Apk) Scriptlets(info *nfpm.Info) (map[string]string, error) {
+	info, err := prepareInfo(info)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return newItemInsideTarGz(out, content, &tar.Header{
-		Name:     files.ToNixPath(dest),
-		Size:     int64(len(content)),
-		Mode:     0o755,
-		ModTime:  file.ModTime(),
-		Typeflag: tar.TypeReg,
-	})
+	return maintainerScripts(info)
+}
+
+// maintainerScripts returns the scripts of the prepared info, by name, each
+// being the script of the info, or a new script of the shell, with the
+// snippets nfpm generates appended.
+func maintainerScripts(info *nfpm.Info) (map[string]string, error) {
+	// NOTE: Apk scripts tend to follow the pattern:
+	// #!/bin/sh
+	//
+	// bin/echo 'running preinstall.sh' // do stuff here
+	//
+	// exit 0
+	paths := map[string]string{
+		".trigger":        info.APK.Triggers.Script,
+		".pre-install":    info.Scripts.PreInstall,
+		".pre-upgrade":    info.APK.Scripts.PreUpgrade,
+		".post-install":   info.Scripts.PostInstall,
+		".post-upgrade":   info.APK.Scripts.PostUpgrade,
+		".pre-deinstall":  info.Scripts.PreRemove,
+		".post-deinstall": info.Scripts.PostRemove,
+	}
+	setAttrs, clearAttrs := files.AttrScriptlets(info.Contents)
+	createDirs, _ := files.RemoveOnScriptlets(info.Contents)
+	createDirs = files.AppendScriptlet(createDirs, files.GhostScriptlet(info.Contents))
+	snippets := map[string]string{
+		".post-install":  files.AppendScriptlet(createDirs, setAttrs),
+		".post-upgrade":  files.AppendScriptlet(createDirs, setAttrs),
+		".pre-upgrade":   clearAttrs,
+		".pre-deinstall": clearAttrs,
+	}
+
+	scripts := map[string]string{}
+	for name, path := range paths {
+		snippet := snippets[name]
+		if path == "" && snippet == "" {
+			continue
+		}
+		script := "#!" + info.ScriptInterpreter() + "\n"
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			script = string(data)
+		}
+		scripts[name] = files.AppendScriptlet(script, snippet)
+	}
+	return scripts, nil
 }
 
 func newItemInsideTarGz(out *tar.Writer, content []byte, header *tar.Header) error {
@@ -387,7 +588,7 @@ func newItemInsideTarGz(out *tar.Writer, content []byte, header *tar.Header) err
 	if err != nil {
 		return fmt.Errorf("failed to hash content of file %s: %w", header.Name, err)
 	}
-	header.PAXRecords["APK-TOOLS.checksum.SHA1"] = fmt.Sprintf("%x", hasher.Sum(nil))
+	header.PAXRecords[paxChecksumRecord] = fmt.Sprintf("%x", hasher.Sum(nil))
 	if err := out.WriteHeader(header); err != nil {
 		return fmt.Errorf("cannot write header of %s file to apk: %w", header.Name, err)
 	}
@@ -408,15 +609,23 @@ func createFilesInsideTarGz(info *nfpm.Info, tw *tar.Writer, sizep *int64) (err
 		file.Destination = files.AsRelativePath(file.Destination)
 
 		switch file.Type {
+		case files.TypeRPMGhost:
+			// skip ghost files in apk
+			continue
 		case files.TypeDir, files.TypeImplicitDir:
-			err = tw.WriteHeader(&tar.Header{
+			if file.IsUnowned() {
+				// created by .post-install instead
+				continue
+			}
+			header := &tar.Header{
 				Name:     file.Destination,
 				Mode:     int64(file.FileInfo.Mode),
 				Typeflag: tar.TypeDir,
-				Uname:    file.FileInfo.Owner,
-				Gname:    file.FileInfo.Group,
 				ModTime:  file.FileInfo.MTime,
-			})
+			}
+			header.Uname, header.Uid = file.FileInfo.TarOwner()
+			header.Gname, header.Gid = file.FileInfo.TarGroup()
+			err = tw.WriteHeader(header)
 		case files.TypeSymlink:
 			err = newItemInsideTarGz(tw, []byte{}, &tar.Header{
 				Name:     file.Destination,
@@ -424,6 +633,19 @@ func createFilesInsideTarGz(info *nfpm.Info, tw *tar.Writer, sizep *int64) (err
 				Typeflag: tar.TypeSymlink,
 				ModTime:  file.FileInfo.MTime,
 			})
+		case files.TypeHardlink:
+			// apk-tools takes the checksum of hard links from their target.
+			header := &tar.Header{
+				Name:     file.Destination,
+				Linkname: files.AsRelativePath(file.Source),
+				Mode:     int64(file.FileInfo.Mode),
+				Typeflag: tar.TypeLink,
+				ModTime:  file.FileInfo.MTime,
+				Format:   tar.FormatPAX,
+			}
+			header.Uname, header.Uid = file.FileInfo.TarOwner()
+			header.Gname, header.Gid = file.FileInfo.TarGroup()
+			err = tw.WriteHeader(header)
 		default:
 			err = copyToTarAndDigest(file, tw, sizep)
 		}
@@ -436,7 +658,9 @@ func createFilesInsideTarGz(info *nfpm.Info, tw *tar.Writer, sizep *int64) (err
 }
 
 func copyToTarAndDigest(file *files.Content, tw *tar.Writer, sizep *int64) error {
-	contents, err := os.ReadFile(file.Source)
+	// the checksum goes into the header, which is written before the content,
+	// so the file is read twice instead of loading it into memory at once.
+	checksum, err := digestContent(file)
 	if err != nil {
 		return err
 	}
@@ -449,16 +673,47 @@ func copyToTarAndDigest(file *files.Content, tw *tar.Writer, sizep *int64) error
 	// 0o777 which we don't want because we want to be able to set the suid bit.
 	header.Mode = int64(file.Mode())
 	header.Name = files.AsRelativePath(file.Destination)
-	header.Uname = file.FileInfo.Owner
-	header.Gname = file.FileInfo.Group
-	if err = newItemInsideTarGz(tw, contents, header); err != nil {
+	header.Uname, header.Uid = file.FileInfo.TarOwner()
+	header.Gname, header.Gid = file.FileInfo.TarGroup()
+	header.Format = tar.FormatPAX
+	header.PAXRecords = map[string]string{paxChecksumRecord: checksum}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("cannot write header of %s file to apk: %w", header.Name, err)
+	}
+
+	f, err := file.Open()
+	if err != nil {
 		return err
 	}
+	defer f.Close() // nolint: errcheck
+	n, err := io.Copy(tw, f)
+	if err != nil {
+		return fmt.Errorf("cannot write %s file to apk: %w", header.Name, err)
+	}
+	if n != header.Size {
+		return fmt.Errorf("cannot write %s file to apk: %w", header.Name, io.ErrShortWrite)
+	}
 
 	*sizep += file.Size()
 	return nil
 }
 
+// digestContent returns the hex encoded SHA1 checksum of the content of a
+// file, as apk-tools expects it in the APK-TOOLS.checksum.SHA1 PAX record.
+func digestContent(file *files.Content) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() // nolint: errcheck
+
+	hasher := sha1.New() // nolint:gosec
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", fmt.Errorf("failed to hash content of file %s: %w", file.Source, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
 // reference: https://wiki.adelielinux.org/wiki/APK_internals#.PKGINFO
 const controlTemplate = `
 {{- /* Mandatory fields */ -}}
@@ -470,28 +725,61 @@ pkgdesc = {{multiline .Info.Description}}
 {{- if .Info.Homepage}}
 url = {{.Info.Homepage}}
 {{- end }}
+{{- if .BuildDate }}
+builddate = {{.BuildDate}}
+{{- end }}
+origin = {{ origin .Info }}
+{{- with .Info.APK.Commit }}
+commit = {{ . }}
+{{- end }}
 {{- if .Info.Maintainer}}
 maintainer = {{.Info.Maintainer}}
 {{- end }}
 {{- range $repl := .Info.Replaces}}
 replaces = {{ $repl }}
 {{- end }}
+{{- with .Info.APK.ReplacesPriority }}
+replaces_priority = {{ . }}
+{{- end }}
 {{- range $prov := .Info.Provides}}
 provides = {{ $prov }}
 {{- end }}
+{{- range $prov := .Info.APK.Provides}}
+provides = {{ $prov }}
+{{- end }}
+{{- with .Info.APK.ProviderPriority }}
+provider_priority = {{ . }}
+{{- end }}
 {{- range $dep := .Info.Depends}}
 depend = {{ $dep }}
 {{- end }}
+{{- with .InstallIf }}
+install_if = {{ join . }}
+{{- end }}
+{{- with .Info.APK.Triggers.Paths }}
+triggers = {{ join . }}
+{{- end }}
 {{- if .Info.License}}
 license = {{.Info.License}}
 {{- end }}
+{{- range $key, $value := .Info.Metadata }}
+# metadata: {{ $key }} = {{ $value }}
+{{- end }}
 datahash = {{.Datahash}}
 `
 
 type controlData struct {
-	Info          *nfpm.Info
+	Info *nfpm.Info
+	// InstalledSize is the sum of the sizes of the regular files in bytes.
+	// Directories, symlinks and hard links do not add to it, just like
+	// abuild does not count them.
 	InstalledSize int64
 	Datahash      string
+	// BuildDate is the unix time of the build, left out when zero.
+	BuildDate int64
+	// InstallIf are the packages whose installation triggers the one of the
+	// package, see installIf.
+	InstallIf []string
 }
 
 func writeControl(w io.Writer, data controlData) error {
@@ -502,6 +790,15 @@ func writeControl(w io.Writer, data controlData) error {
 			return strings.Trim(ret, " \n")
 		},
 		"pkgver": pkgver,
+		"origin": func(info *nfpm.Info) string {
+			if info.APK.Origin != "" {
+				return info.APK.Origin
+			}
+			return info.Name
+		},
+		"join": func(strs []string) string {
+			return strings.Join(strs, " ")
+		},
 	})
 	return template.Must(tmpl.Parse(controlTemplate)).Execute(w, data)
 }
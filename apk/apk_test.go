@@ -14,10 +14,12 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/files"
 	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 	"github.com/stretchr/testify/require"
 )
 
@@ -40,7 +42,7 @@ func exampleInfo() *nfpm.Info {
 		Overridables: nfpm.Overridables{
 			Depends: []string{
 				"bash",
-				"foo",
+				"libfoo",
 			},
 			Recommends: []string{
 				"git",
@@ -169,6 +171,39 @@ func TestApkPlatform(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestReproducibleGzipHeaders(t *testing.T) {
+	build := func() []byte {
+		info := exampleInfo()
+		info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa.priv"
+		info.APK.Signature.KeyPassphrase = "hunter2"
+		var apk bytes.Buffer
+		require.NoError(t, Default.Package(info, &apk))
+		return apk.Bytes()
+	}
+	first, second := build(), build()
+	require.Equal(t, first, second)
+
+	// the package is a concatenation of the gzip streams of the signature,
+	// the control and the data, whose headers must neither hold an mtime nor
+	// the OS the package was built on.
+	r := bytes.NewReader(first)
+	var streams int
+	for r.Len() > 0 {
+		header := first[len(first)-r.Len():][:10]
+		require.Equal(t, []byte{0x1f, 0x8b}, header[0:2])
+		require.Equal(t, []byte{0, 0, 0, 0}, header[4:8], "mtime")
+		require.Equal(t, byte(255), header[9], "OS")
+
+		zr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		zr.Multistream(false)
+		_, err = io.Copy(io.Discard, zr)
+		require.NoError(t, err)
+		streams++
+	}
+	require.Equal(t, 3, streams)
+}
+
 func TestNoInfo(t *testing.T) {
 	err := Default.Package(nfpm.WithDefaults(&nfpm.Info{}), io.Discard)
 	require.Error(t, err)
@@ -235,6 +270,7 @@ func TestNoFiles(t *testing.T) {
 
 func TestCreateBuilderControl(t *testing.T) {
 	info := exampleInfo()
+	info.MTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
 	size := int64(12345)
 	err := nfpm.PrepareForPackager(info, "apk")
 	require.NoError(t, err)
@@ -256,6 +292,7 @@ func TestCreateBuilderControl(t *testing.T) {
 
 func TestCreateBuilderControlScripts(t *testing.T) {
 	info := exampleInfo()
+	info.MTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
 	info.Scripts = nfpm.Scripts{
 		PreInstall:  "../testdata/scripts/preinstall.sh",
 		PostInstall: "../testdata/scripts/postinstall.sh",
@@ -300,6 +337,55 @@ func TestCreateBuilderControlScripts(t *testing.T) {
 	require.Contains(t, script, `echo "Postremove" > /dev/null`)
 }
 
+func TestCreateBuilderControlTriggers(t *testing.T) {
+	info := exampleInfo()
+	info.APK.Triggers = nfpm.APKTriggers{
+		Paths:  []string{"/usr/share/icons/*", "/usr/lib/fonts"},
+		Script: "../testdata/scripts/trigger.sh",
+	}
+	err := nfpm.PrepareForPackager(info, "apk")
+	require.NoError(t, err)
+
+	builderControl := createBuilderControl(info, 12345, sha256.New().Sum(nil))
+
+	var w bytes.Buffer
+	tw := tar.NewWriter(&w)
+	require.NoError(t, builderControl(tw))
+
+	control := string(extractFromTar(t, w.Bytes(), ".PKGINFO"))
+	require.Contains(t, control, "\ntriggers = /usr/share/icons/* /usr/lib/fonts\n")
+
+	script := string(extractFromTar(t, w.Bytes(), ".trigger"))
+	require.Contains(t, script, `echo "Trigger" > /dev/null`)
+}
+
+func TestInvalidTriggers(t *testing.T) {
+	for name, triggers := range map[string]nfpm.APKTriggers{
+		"relative path": {
+			Paths:  []string{"usr/share/icons"},
+			Script: "../testdata/scripts/trigger.sh",
+		},
+		"bad pattern": {
+			Paths:  []string{"/usr/share/[icons"},
+			Script: "../testdata/scripts/trigger.sh",
+		},
+		"no paths": {
+			Script: "../testdata/scripts/trigger.sh",
+		},
+		"no script": {
+			Paths: []string{"/usr/share/icons"},
+		},
+	} {
+		triggers := triggers
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.APK.Triggers = triggers
+			err := Default.Package(info, io.Discard)
+			require.ErrorIs(t, err, ErrInvalidTrigger)
+		})
+	}
+}
+
 func TestControl(t *testing.T) {
 	var w bytes.Buffer
 	require.NoError(t, writeControl(&w, controlData{
@@ -315,6 +401,136 @@ func TestControl(t *testing.T) {
 	require.Equal(t, string(bts), w.String())
 }
 
+func TestPkginfoFields(t *testing.T) {
+	info := exampleInfo()
+	info.MTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	info.APK.Commit = "8a1d4e2c0b5a3f6e9d7c1b2a4f6e8d0c2b4a6f8e"
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	streams, err := splitGzipStreams(buf.Bytes())
+	require.NoError(t, err)
+	pkginfo := string(extractFromTar(t, inflate(t, streams[0]), ".PKGINFO"))
+	require.Contains(t, pkginfo, "\norigin = foo\n")
+	require.Contains(t, pkginfo, "\ncommit = 8a1d4e2c0b5a3f6e9d7c1b2a4f6e8d0c2b4a6f8e\n")
+	require.Contains(t, pkginfo, "\nmaintainer = Carlos A Becker <pkg@carlosbecker.com>\n")
+	require.Contains(t, pkginfo, "\nbuilddate = 1672628645\n")
+
+	t.Run("origin", func(t *testing.T) {
+		info := exampleInfo()
+		info.APK.Origin = "foo-src"
+		t.Setenv("SOURCE_DATE_EPOCH", "1600000000")
+
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		streams, err := splitGzipStreams(buf.Bytes())
+		require.NoError(t, err)
+		pkginfo := string(extractFromTar(t, inflate(t, streams[0]), ".PKGINFO"))
+		require.Contains(t, pkginfo, "\norigin = foo-src\n")
+		require.Contains(t, pkginfo, "\nbuilddate = 1600000000\n")
+		require.NotContains(t, pkginfo, "\ncommit = ")
+		require.NotContains(t, pkginfo, "_priority = ")
+	})
+
+	t.Run("priorities", func(t *testing.T) {
+		info := exampleInfo()
+		info.Provides = []string{"editor"}
+		info.Replaces = []string{"vim"}
+		info.APK.ProviderPriority = 100
+		info.APK.ReplacesPriority = 10
+
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		streams, err := splitGzipStreams(buf.Bytes())
+		require.NoError(t, err)
+		pkginfo := string(extractFromTar(t, inflate(t, streams[0]), ".PKGINFO"))
+		require.Contains(t, pkginfo, "\nreplaces = vim\nreplaces_priority = 10\n")
+		require.Contains(t, pkginfo, "\nprovides = editor\nprovider_priority = 100\n")
+	})
+
+	t.Run("provides", func(t *testing.T) {
+		info := exampleInfo()
+		info.Provides = []string{"foo-libs"}
+		info.APK.Provides = []string{"so:libfoo.so.1=1.2.3", "cmd:foo=1.2.3-r0", "pc:foo", "libfoo"}
+
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		streams, err := splitGzipStreams(buf.Bytes())
+		require.NoError(t, err)
+		pkginfo := string(extractFromTar(t, inflate(t, streams[0]), ".PKGINFO"))
+		require.Contains(t, pkginfo, "\nprovides = foo-libs\nprovides = so:libfoo.so.1=1.2.3\nprovides = cmd:foo=1.2.3-r0\nprovides = pc:foo\nprovides = libfoo\n")
+	})
+
+	for name, set := range map[string]func(info *nfpm.Info){
+		"origin":            func(info *nfpm.Info) { info.APK.Origin = "foo src" },
+		"commit":            func(info *nfpm.Info) { info.APK.Commit = "main" },
+		"provider priority": func(info *nfpm.Info) { info.APK.ProviderPriority = -1 },
+		"replaces priority": func(info *nfpm.Info) { info.APK.ReplacesPriority = -1 },
+		"maintainer":        func(info *nfpm.Info) { info.Maintainer = "foo\nbar" },
+		"provides":          func(info *nfpm.Info) { info.APK.Provides = []string{"so:libfoo.so.1>=1"} },
+		"provides version":  func(info *nfpm.Info) { info.APK.Provides = []string{"cmd:foo=v1"} },
+		"provides space":    func(info *nfpm.Info) { info.APK.Provides = []string{"so:libfoo.so.1 = 1"} },
+		"weak dependencies": func(info *nfpm.Info) { info.APK.WeakDependencies = "depends" },
+	} {
+		t.Run("invalid "+name, func(t *testing.T) {
+			info := exampleInfo()
+			set(info)
+			require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidPkginfo)
+		})
+	}
+}
+
+func TestWeakDependencies(t *testing.T) {
+	for mode, expected := range map[string]struct {
+		installIf, warning string
+	}{
+		"":                                {"", "recommends and suggests are not supported by apk packages, ignoring them\n"},
+		nfpm.APKWeakDependenciesWarn:      {"", "recommends and suggests are not supported by apk packages, ignoring them\n"},
+		nfpm.APKWeakDependenciesIgnore:    {"", ""},
+		nfpm.APKWeakDependenciesInstallIf: {"\ninstall_if = git bar\n", "suggests are not supported by apk packages, ignoring them\n"},
+	} {
+		t.Run(mode, func(t *testing.T) {
+			var w bytes.Buffer
+			prevNoticer := warning.Noticer
+			t.Cleanup(func() { warning.Noticer = prevNoticer })
+			warning.Noticer = &w
+
+			info := exampleInfo()
+			info.APK.WeakDependencies = mode
+			// testdata/fake is a script without a shebang
+			info.SuppressLints = []string{"script-shebang"}
+			var buf bytes.Buffer
+			require.NoError(t, Default.Package(info, &buf))
+			streams, err := splitGzipStreams(buf.Bytes())
+			require.NoError(t, err)
+			pkginfo := string(extractFromTar(t, inflate(t, streams[0]), ".PKGINFO"))
+			if expected.installIf == "" {
+				require.NotContains(t, pkginfo, "install_if")
+			} else {
+				require.Contains(t, pkginfo, expected.installIf)
+			}
+			// the weak dependencies never become hard ones
+			require.NotContains(t, pkginfo, "depend = git")
+			require.NotContains(t, pkginfo, "depend = lala")
+			require.Equal(t, expected.warning, w.String())
+		})
+	}
+
+	t.Run("none", func(t *testing.T) {
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		info := exampleInfo()
+		info.Recommends = nil
+		info.Suggests = nil
+		info.SuppressLints = []string{"script-shebang"}
+		require.NoError(t, Default.Package(info, io.Discard))
+		require.Empty(t, w.String())
+	})
+}
+
 func TestSignatureName(t *testing.T) {
 	info := exampleInfo()
 	info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa.priv"
@@ -392,7 +608,7 @@ func TestSignatureCallback(t *testing.T) {
 		if err != nil {
 			return nil, err
 		}
-		return sign.RSASignSHA1Digest(digest, "../internal/sign/testdata/rsa.priv", "hunter2")
+		return sign.RSASignSHA1Digest(digest, sign.Key{File: "../internal/sign/testdata/rsa.priv"}, "hunter2")
 	}
 	info.APK.Signature.KeyName = "testkey.rsa.pub"
 	err := nfpm.PrepareForPackager(info, "apk")
@@ -768,12 +984,49 @@ func TestArches(t *testing.T) {
 		})
 	}
 
+	for goarm, expected := range map[string]string{
+		"6": "armhf",
+		"7": "armv7",
+	} {
+		goarm, expected := goarm, expected
+		t.Run("goarm"+goarm, func(t *testing.T) {
+			info := exampleInfo()
+			info.Arch = "arm"
+			info.Goarm = goarm
+			info = ensureValidArch(nfpm.WithDefaults(info))
+			require.Equal(t, expected, info.Arch)
+		})
+	}
+
 	t.Run("override", func(t *testing.T) {
 		info := exampleInfo()
 		info.APK.Arch = "foo64"
 		info = ensureValidArch(info)
 		require.Equal(t, "foo64", info.Arch)
 	})
+
+	t.Run("arm5", func(t *testing.T) {
+		for _, goarm := range []string{"", "5"} {
+			info := exampleInfo()
+			info.Arch = "arm"
+			info.Goarm = goarm
+			if goarm == "" {
+				info.Arch = "arm5"
+			}
+			for _, info := range []*nfpm.Info{info, nfpm.WithDefaults(info)} {
+				err := Default.Package(info, io.Discard)
+				require.EqualError(t, err, "unsupported arch: arm5: not supported by apk packages, set apk.arch instead")
+				var target nfpm.ValidationError
+				require.ErrorAs(t, err, &target)
+				require.Equal(t, "unsupported_arch", target.Code)
+			}
+		}
+
+		info := exampleInfo()
+		info.Arch = "arm5"
+		info.APK.Arch = "armel"
+		require.NoError(t, Default.Package(info, io.Discard))
+	})
 }
 
 func TestGlob(t *testing.T) {
@@ -792,3 +1045,267 @@ func TestGlob(t *testing.T) {
 		},
 	}), io.Discard))
 }
+
+func TestVerify(t *testing.T) {
+	for name, setup := range map[string]func(info *nfpm.Info){
+		"default": func(*nfpm.Info) {},
+		"signed":  func(info *nfpm.Info) { info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa.priv" },
+		"pkcs8":   func(info *nfpm.Info) { info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa_pkcs8.priv" },
+	} {
+		setup := setup
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.APK.Signature.KeyPassphrase = "hunter2"
+			setup(info)
+
+			var apk bytes.Buffer
+			require.NoError(t, Default.Package(info, &apk))
+			require.NoError(t, Default.Verify(info, bytes.NewReader(apk.Bytes())))
+		})
+	}
+}
+
+func TestDedup(t *testing.T) {
+	info := exampleInfo()
+	info.Dedup = true
+	info.Contents = files.Contents{
+		{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/a.conf"},
+		{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/b.conf"},
+		{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/c.conf"},
+	}
+
+	var apk bytes.Buffer
+	require.NoError(t, Default.Package(info, &apk))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(apk.Bytes())))
+
+	streams, err := splitGzipStreams(apk.Bytes())
+	require.NoError(t, err)
+	dataTar := inflate(t, streams[len(streams)-1])
+	require.Equal(t, byte(tar.TypeReg), extractFileHeaderFromTar(t, dataTar, "usr/share/foo/a.conf").Typeflag)
+	for _, name := range []string{"usr/share/foo/b.conf", "usr/share/foo/c.conf"} {
+		header := extractFileHeaderFromTar(t, dataTar, name)
+		require.Equal(t, byte(tar.TypeLink), header.Typeflag, name)
+		require.Equal(t, "usr/share/foo/a.conf", header.Linkname, name)
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	info := exampleInfo()
+	info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa.priv"
+	info.APK.Signature.KeyPassphrase = "hunter2"
+
+	var apk bytes.Buffer
+	require.NoError(t, Default.Package(info, &apk))
+
+	corrupted := bytes.Clone(apk.Bytes())
+	corrupted[len(corrupted)-100] ^= 0xff
+	require.Error(t, Default.Verify(info, bytes.NewReader(corrupted)))
+
+	t.Run("unsigned", func(t *testing.T) {
+		streams, err := splitGzipStreams(apk.Bytes())
+		require.NoError(t, err)
+		require.Len(t, streams, 3)
+		unsigned := bytes.Join(streams[1:], nil)
+		require.EqualError(t, Default.Verify(info, bytes.NewReader(unsigned)), "expected 3 gzip streams, got 2")
+	})
+
+	t.Run("missing content", func(t *testing.T) {
+		info := exampleInfo()
+		var apk bytes.Buffer
+		require.NoError(t, Default.Package(info, &apk))
+		info.Contents = append(info.Contents, &files.Content{Source: "../testdata/fake", Destination: "/usr/bin/missing"})
+		require.EqualError(t, Default.Verify(info, bytes.NewReader(apk.Bytes())), "/usr/bin/missing: missing from package")
+	})
+}
+
+func TestResign(t *testing.T) {
+	info := exampleInfo()
+	var unsigned bytes.Buffer
+	require.NoError(t, Default.Package(info, &unsigned))
+
+	info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa.priv"
+	info.APK.Signature.KeyPassphrase = "hunter2"
+	var resigned bytes.Buffer
+	require.NoError(t, Default.Resign(info, bytes.NewReader(unsigned.Bytes()), &resigned))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(resigned.Bytes())))
+
+	t.Run("replace", func(t *testing.T) {
+		info := exampleInfo()
+		info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa_unprotected.priv"
+		var signed bytes.Buffer
+		require.NoError(t, Default.Package(info, &signed))
+
+		info.APK.Signature.KeyFile = "../internal/sign/testdata/rsa.priv"
+		info.APK.Signature.KeyPassphrase = "hunter2"
+		var resigned bytes.Buffer
+		require.NoError(t, Default.Resign(info, bytes.NewReader(signed.Bytes()), &resigned))
+		require.NoError(t, Default.Verify(info, bytes.NewReader(resigned.Bytes())))
+		streams, err := splitGzipStreams(resigned.Bytes())
+		require.NoError(t, err)
+		require.Len(t, streams, 3)
+	})
+}
+
+func TestChecksums(t *testing.T) {
+	large := filepath.Join(t.TempDir(), "large")
+	content := make([]byte, 8<<20)
+	for i := range content {
+		content[i] = byte(i * 31 % 251)
+	}
+	require.NoError(t, os.WriteFile(large, content, 0o644))
+
+	info := exampleInfo()
+	info.Contents = append(info.Contents, &files.Content{
+		Source:      large,
+		Destination: "/usr/share/foo/large",
+	})
+
+	var apk bytes.Buffer
+	require.NoError(t, Default.Package(info, &apk))
+
+	streams, err := splitGzipStreams(apk.Bytes())
+	require.NoError(t, err)
+	require.Len(t, streams, 2)
+
+	pkginfo := string(extractFromTar(t, inflate(t, streams[0]), ".PKGINFO"))
+	require.Contains(t, pkginfo, fmt.Sprintf("\ndatahash = %x\n", sha256.Sum256(streams[1])))
+
+	checked := 0
+	tr := tar.NewReader(bytes.NewReader(inflate(t, streams[1])))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		hasher := sha1.New() // nolint:gosec
+		n, err := io.Copy(hasher, tr)
+		require.NoError(t, err)
+		require.Equal(t, hdr.Size, n)
+		require.Equal(t, fmt.Sprintf("%x", hasher.Sum(nil)), hdr.PAXRecords["APK-TOOLS.checksum.SHA1"], hdr.Name)
+		checked++
+
+		if hdr.Name == "usr/share/foo/large" {
+			require.Equal(t, fmt.Sprintf("%x", sha1.Sum(content)), hdr.PAXRecords["APK-TOOLS.checksum.SHA1"]) // nolint:gosec
+		}
+	}
+	require.Equal(t, 5, checked)
+}
+
+func inflate(tb testing.TB, tgz []byte) []byte {
+	tb.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(tgz))
+	require.NoError(tb, err)
+	bts, err := io.ReadAll(gz)
+	require.NoError(tb, err)
+	return bts
+}
+
+func TestAttrScripts(t *testing.T) {
+	info := exampleInfo()
+	info.Scripts = nfpm.Scripts{PostInstall: "../testdata/scripts/postinstall.sh"}
+	info.APK.Scripts = nfpm.APKScripts{}
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/fake/fake.conf",
+			Type:        files.TypeConfig,
+			FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable"}},
+		},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(info, "apk"))
+
+	var w bytes.Buffer
+	tw := tar.NewWriter(&w)
+	require.NoError(t, createBuilderControl(info, 0, sha256.New().Sum(nil))(tw))
+
+	postInstall, err := os.ReadFile(info.Scripts.PostInstall)
+	require.NoError(t, err)
+	require.Equal(t, files.AppendScriptlet(string(postInstall), "chattr +i '/etc/fake/fake.conf' || :\n"), string(extractFromTar(t, w.Bytes(), ".post-install")))
+	require.Equal(t, "#!/bin/sh\n\nchattr +i '/etc/fake/fake.conf' || :\n", string(extractFromTar(t, w.Bytes(), ".post-upgrade")))
+	for _, name := range []string{".pre-upgrade", ".pre-deinstall"} {
+		require.Equal(t, "#!/bin/sh\n\nchattr -i '/etc/fake/fake.conf' >/dev/null 2>&1 || :\n", string(extractFromTar(t, w.Bytes(), name)), name)
+	}
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	info := exampleInfo()
+	info.MTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	info.Snapshot = &nfpm.Snapshot{Commit: "abcdef"}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+	// _pre sorts below the version, and the commit is left out as apk
+	// versions only allow digits after a suffix.
+	require.Equal(t, "1.0.0_pre20240101-r0", pkgver(info))
+}
+
+func TestEntryPaths(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{Source: "../testdata/fake", Destination: "usr/bin//fake"},
+		{Source: "../testdata/whatever.conf", Destination: "./etc/./foo//foo.conf", Type: files.TypeConfig},
+		{Source: "/usr/bin/fake", Destination: "/usr/sbin/fake/", Type: files.TypeSymlink},
+	}
+
+	var apk bytes.Buffer
+	require.NoError(t, Default.Package(info, &apk))
+	streams, err := splitGzipStreams(apk.Bytes())
+	require.NoError(t, err)
+
+	// like abuild, the entries of the data are relative, without ./
+	require.Equal(t, []string{
+		"etc/",
+		"etc/foo/",
+		"etc/foo/foo.conf",
+		"usr/",
+		"usr/bin/",
+		"usr/bin/fake",
+		"usr/sbin/",
+		"usr/sbin/fake",
+	}, getTree(t, inflate(t, streams[len(streams)-1])))
+}
+
+func TestMetaPackage(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = nil
+
+	var apk bytes.Buffer
+	require.NoError(t, Default.Package(info, &apk))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(apk.Bytes())))
+
+	streams, err := splitGzipStreams(apk.Bytes())
+	require.NoError(t, err)
+	require.Empty(t, getTree(t, inflate(t, streams[len(streams)-1])))
+
+	pkginfo := string(extractFromTar(t, inflate(t, streams[len(streams)-2]), ".PKGINFO"))
+	require.Contains(t, pkginfo, "size = 0\n")
+	require.Contains(t, pkginfo, "depend = bash\n")
+}
+
+func TestInstalledSize(t *testing.T) {
+	info := exampleInfo()
+	info.Dedup = true
+	info.Contents = []*files.Content{
+		{Destination: "/usr/share/foo/a", Data: bytes.Repeat([]byte("a"), 1000)},
+		{Destination: "/usr/share/foo/copy", Data: bytes.Repeat([]byte("a"), 1000)},
+		{Destination: "/etc/foo.conf", Data: []byte("key = value\n"), Type: files.TypeConfig},
+		{Destination: "/usr/share/foo/empty", Data: []byte{}},
+		{Destination: "/var/lib/foo", Type: files.TypeDir},
+		{Source: "/usr/share/foo/a", Destination: "/usr/bin/foo", Type: files.TypeSymlink},
+	}
+
+	var apk bytes.Buffer
+	require.NoError(t, Default.Package(info, &apk))
+	streams, err := splitGzipStreams(apk.Bytes())
+	require.NoError(t, err)
+
+	dataTar := inflate(t, streams[len(streams)-1])
+	require.Equal(t, byte(tar.TypeLink), extractFileHeaderFromTar(t, dataTar, "usr/share/foo/copy").Typeflag)
+
+	pkginfo := string(extractFromTar(t, inflate(t, streams[len(streams)-2]), ".PKGINFO"))
+	require.Contains(t, pkginfo, "\nsize = 1012\n")
+}
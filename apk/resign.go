@@ -0,0 +1,46 @@
+package apk
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint:gosec
+	"fmt"
+	"io"
+
+	"github.com/goreleaser/nfpm/v2"
+)
+
+// Resign writes the apk package read from r to w with a new signature stream,
+// made with the signature of the given info, in place of the former one. The
+// control and data streams are copied as is. Without a key name, the key is
+// named after the maintainer recorded in the .PKGINFO.
+func (*Apk) Resign(info *nfpm.Info, r io.Reader, w io.Writer) error {
+	info = info.Copy()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	streams, err := splitGzipStreams(data)
+	if err != nil {
+		return err
+	}
+	if len(streams) != 2 && len(streams) != 3 {
+		return fmt.Errorf("expected 2 or 3 gzip streams, got %d", len(streams))
+	}
+	control, dataTgz := streams[len(streams)-2], streams[len(streams)-1]
+
+	if info.APK.Signature.KeyName == "" && info.Maintainer == "" {
+		pkginfo, err := readPkgInfo(control)
+		if err != nil {
+			return fmt.Errorf("control: %w", err)
+		}
+		info.Maintainer = pkginfo["maintainer"]
+	}
+
+	digest := sha1.Sum(control) // nolint:gosec
+	var signature bytes.Buffer
+	if err := createSignature(&signature, info, digest[:]); err != nil {
+		return err
+	}
+	return combineToApk(w, &signature, bytes.NewReader(control), bytes.NewReader(dataTgz))
+}
@@ -0,0 +1,306 @@
+package apk
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/sign"
+)
+
+// Verify reads back an apk package created with the given info and checks that
+// its archives extract cleanly, that the datahash and the checksum of each
+// file match, that it holds all of the contents and that its signature, if
+// any, is valid. The contents are prepared for the packager like Package
+// does.
+func (*Apk) Verify(info *nfpm.Info, apk io.Reader) error {
+	info, err := prepareInfo(info)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(apk)
+	if err != nil {
+		return err
+	}
+
+	streams, err := splitGzipStreams(data)
+	if err != nil {
+		return err
+	}
+
+	signed := info.APK.Signature.HasKey() || info.APK.Signature.SignFn != nil
+	expected := 2
+	if signed {
+		expected = 3
+	}
+	if len(streams) != expected {
+		return fmt.Errorf("expected %d gzip streams, got %d", expected, len(streams))
+	}
+	control, dataTgz := streams[len(streams)-2], streams[len(streams)-1]
+
+	pkginfo, err := readPkgInfo(control)
+	if err != nil {
+		return fmt.Errorf("control: %w", err)
+	}
+	datahash := fmt.Sprintf("%x", sha256.Sum256(dataTgz))
+	if pkginfo["datahash"] != datahash {
+		return fmt.Errorf("datahash mismatch: expected %s, got %s", pkginfo["datahash"], datahash)
+	}
+
+	entries, err := readDataEntries(dataTgz)
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if err := verifyContents(info.Contents, entries); err != nil {
+		return err
+	}
+
+	if !info.APK.Signature.HasKey() || info.APK.Signature.SignFn != nil {
+		// without a key there is nothing to verify the signature with.
+		return nil
+	}
+	return verifySignature(info, streams[0], control)
+}
+
+// splitGzipStreams splits the concatenated gzip streams of an apk, and makes
+// sure each of them decompresses cleanly.
+func splitGzipStreams(data []byte) ([][]byte, error) {
+	var streams [][]byte
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		start := len(data) - r.Len()
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading gzip stream %d: %w", len(streams), err)
+		}
+		gz.Multistream(false)
+		if _, err := io.Copy(io.Discard, gz); err != nil {
+			return nil, fmt.Errorf("reading gzip stream %d: %w", len(streams), err)
+		}
+		streams = append(streams, data[start:len(data)-r.Len()])
+	}
+	return streams, nil
+}
+
+// readTgz calls fn for each of the entries of the given tar.gz, which might
+// lack the end of archive marker as control and signature tars do.
+func readTgz(tgz []byte, fn func(header *tar.Header, content []byte) error) error {
+	gz, err := gzip.NewReader(bytes.NewReader(tgz))
+	if err != nil {
+		return err
+	}
+	defer gz.Close() // nolint: errcheck
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+		if err := fn(header, content); err != nil {
+			return err
+		}
+	}
+}
+
+func readPkgInfo(control []byte) (map[string]string, error) {
+	var pkginfo map[string]string
+	err := readTgz(control, func(header *tar.Header, content []byte) error {
+		if header.Name != ".PKGINFO" {
+			return nil
+		}
+		pkginfo = map[string]string{}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), " = ")
+			if ok {
+				pkginfo[key] = value
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pkginfo == nil {
+		return nil, errors.New("missing .PKGINFO")
+	}
+	return pkginfo, nil
+}
+
+// metadataCommentPrefix prefixes the .PKGINFO comments Info.Metadata is
+// recorded in.
+const metadataCommentPrefix = "# metadata: "
+
+// ReadMetadata returns the Info.Metadata recorded in the .PKGINFO of the apk
+// package read from r.
+func (*Apk) ReadMetadata(apk io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(apk)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := splitGzipStreams(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) < 2 {
+		return nil, fmt.Errorf("expected at least 2 gzip streams, got %d", len(streams))
+	}
+
+	var metadata map[string]string
+	err = readTgz(streams[len(streams)-2], func(header *tar.Header, content []byte) error {
+		if header.Name != ".PKGINFO" {
+			return nil
+		}
+		metadata = map[string]string{}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line, ok := strings.CutPrefix(scanner.Text(), metadataCommentPrefix)
+			if !ok {
+				continue
+			}
+			if key, value, ok := strings.Cut(line, " = "); ok {
+				metadata[key] = value
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	if metadata == nil {
+		return nil, errors.New("control: missing .PKGINFO")
+	}
+	return metadata, nil
+}
+
+// ReadIdentity returns the pkgname, pkgver and arch recorded in the .PKGINFO
+// of the apk package read from r.
+func (*Apk) ReadIdentity(apk io.Reader) (nfpm.Identity, error) {
+	data, err := io.ReadAll(apk)
+	if err != nil {
+		return nfpm.Identity{}, err
+	}
+	streams, err := splitGzipStreams(data)
+	if err != nil {
+		return nfpm.Identity{}, err
+	}
+	if len(streams) < 2 {
+		return nfpm.Identity{}, fmt.Errorf("expected at least 2 gzip streams, got %d", len(streams))
+	}
+
+	pkginfo, err := readPkgInfo(streams[len(streams)-2])
+	if err != nil {
+		return nfpm.Identity{}, fmt.Errorf("control: %w", err)
+	}
+	for _, key := range []string{"pkgname", "pkgver", "arch"} {
+		if pkginfo[key] == "" {
+			return nfpm.Identity{}, fmt.Errorf("control: missing %s", key)
+		}
+	}
+	return nfpm.Identity{Name: pkginfo["pkgname"], Version: pkginfo["pkgver"], Arch: pkginfo["arch"]}, nil
+}
+
+func readDataEntries(dataTgz []byte) (map[string]*tar.Header, error) {
+	entries := map[string]*tar.Header{}
+	err := readTgz(dataTgz, func(header *tar.Header, content []byte) error {
+		name := files.NormalizeAbsoluteFilePath(header.Name)
+		entries[name] = header
+		if header.Typeflag == tar.TypeLink {
+			if target, ok := entries[files.NormalizeAbsoluteFilePath(header.Linkname)]; !ok || target.Typeflag != tar.TypeReg {
+				return fmt.Errorf("%s: hard link to missing file %s", name, header.Linkname)
+			}
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeSymlink {
+			return nil
+		}
+		checksum := fmt.Sprintf("%x", sha1.Sum(content)) // nolint:gosec
+		if header.PAXRecords[paxChecksumRecord] != checksum {
+			return fmt.Errorf("%s: checksum mismatch: expected %s, got %s", name, header.PAXRecords[paxChecksumRecord], checksum)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func verifyContents(contents files.Contents, entries map[string]*tar.Header) error {
+	for _, content := range contents {
+		if content.IsUnowned() {
+			continue
+		}
+		var typeflag byte
+		switch content.Type {
+		case files.TypeRPMGhost:
+			continue
+		case files.TypeDir, files.TypeImplicitDir:
+			typeflag = tar.TypeDir
+		case files.TypeSymlink:
+			typeflag = tar.TypeSymlink
+		case files.TypeHardlink:
+			typeflag = tar.TypeLink
+		default:
+			typeflag = tar.TypeReg
+		}
+
+		name := files.NormalizeAbsoluteFilePath(content.Destination)
+		header, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("%s: missing from package", name)
+		}
+		if header.Typeflag != typeflag {
+			return fmt.Errorf("%s: expected tar type %q, got %q", name, typeflag, header.Typeflag)
+		}
+		if typeflag == tar.TypeSymlink && header.Linkname != content.Source {
+			return fmt.Errorf("%s: expected symlink to %s, got %s", name, content.Source, header.Linkname)
+		}
+		if typeflag == tar.TypeLink && files.NormalizeAbsoluteFilePath(header.Linkname) != content.Source {
+			return fmt.Errorf("%s: expected hard link to %s, got %s", name, content.Source, header.Linkname)
+		}
+	}
+	return nil
+}
+
+func verifySignature(info *nfpm.Info, signature, control []byte) error {
+	var sig []byte
+	err := readTgz(signature, func(header *tar.Header, content []byte) error {
+		if strings.HasPrefix(header.Name, ".SIGN.RSA.") {
+			sig = content
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	if sig == nil {
+		return errors.New("missing .SIGN.RSA signature")
+	}
+
+	digest := sha1.Sum(control) // nolint:gosec
+	if err := sign.RSAVerifySHA1DigestWithPrivateKey(
+		digest[:],
+		sig,
+		sign.SignatureKey(info.APK.Signature.PackageSignature),
+		info.APK.Signature.KeyPassphrase,
+	); err != nil {
+		return fmt.Errorf("verifying signature: %w", err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,12 +19,22 @@ import (
 	"github.com/goreleaser/nfpm/v2/files"
 	"github.com/goreleaser/nfpm/v2/internal/maps"
 	"github.com/goreleaser/nfpm/v2/internal/modtime"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+	"github.com/goreleaser/nfpm/v2/internal/xzpin"
 	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 )
 
 var ErrInvalidPkgName = errors.New("archlinux: package names may only contain alphanumeric characters or one of ., _, +, or -, and may not start with hyphen or dot")
 
+var ErrInvalidPkgVer = errors.New("archlinux: package versions may not contain hyphens, colons, slashes or whitespace")
+
+var ErrInvalidPkgRel = errors.New("archlinux: package releases must be a number, optionally followed by dot separated letters and digits")
+
+var ErrInvalidEpoch = errors.New("archlinux: package epochs must be a number")
+
+var ErrInvalidScript = errors.New("archlinux: invalid install script")
+
 const packagerName = "archlinux"
 
 // nolint: gochecknoinits
@@ -50,7 +61,11 @@ var archToArchLinux = map[string]string{
 	"arm5":  "arm",
 }
 
+// ensureValidArch returns a copy of info with the arch translated to the
+// one the packager uses. The given info is not modified.
 func ensureValidArch(info *nfpm.Info) *nfpm.Info {
+	cp := *info
+	info = &cp
 	if info.ArchLinux.Arch != "" {
 		info.Arch = info.ArchLinux.Arch
 	} else if arch, ok := archToArchLinux[info.Arch]; ok {
@@ -64,24 +79,60 @@ func ensureValidArch(info *nfpm.Info) *nfpm.Info {
 // to Arch Linux package naming guidelines. See:
 // https://wiki.archlinux.org/title/Arch_package_guidelines#Package_naming
 func (ArchLinux) ConventionalFileName(info *nfpm.Info) string {
-	info = ensureValidArch(info)
-
-	pkgrel, err := strconv.Atoi(info.Release)
-	if err != nil {
-		pkgrel = 1
-	}
+	info = ensureValidArch(nfpm.WithSnapshot(info, packagerName))
 
 	name := fmt.Sprintf(
-		"%s-%s-%d-%s.pkg.tar.zst",
+		"%s-%s-%s-%s%s",
 		info.Name,
-		info.Version+strings.ReplaceAll(info.Prerelease, "-", "_"),
-		pkgrel,
+		pkgver(info),
+		defaultStr(info.Release, "1"),
 		info.Arch,
+		ArchLinux{}.ConventionalExtensionFor(info),
 	)
 
 	return validPkgName(name)
 }
 
+// fullVersion returns the version of the package as stored in the pkgver
+// field of .PKGINFO, which is made of the optional epoch, the version with its
+// prerelease and the release (pkgrel, defaults to 1): [epoch:]pkgver-pkgrel.
+func fullVersion(info *nfpm.Info) (string, error) {
+	version := pkgver(info)
+	if !pkgverIsValid(version) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPkgVer, version)
+	}
+	pkgrel := defaultStr(info.Release, "1")
+	if !pkgrelRegexp.MatchString(pkgrel) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPkgRel, pkgrel)
+	}
+	version += "-" + pkgrel
+
+	if info.Epoch != "" {
+		if _, err := strconv.ParseUint(info.Epoch, 10, 64); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidEpoch, info.Epoch)
+		}
+		version = info.Epoch + ":" + version
+	}
+	return version, nil
+}
+
+// pkgver returns the version of the package followed by its prerelease, whose
+// hyphens are replaced, as pkgver may not contain any.
+func pkgver(info *nfpm.Info) string {
+	return info.Version + strings.ReplaceAll(info.Prerelease, "-", "_")
+}
+
+// pkgrelRegexp matches the releases of the packages, such as 1, 1.1 or the
+// 0.20240101.abcdef of a snapshot build.
+// nolint: gochecknoglobals
+var pkgrelRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9A-Za-z]+)*$`)
+
+// pkgverIsValid checks whether a version may be used as pkgver, which must not
+// contain hyphens, colons, slashes or whitespace.
+func pkgverIsValid(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "-:/ \t\n")
+}
+
 // validPkgName removes any invalid characters from a string
 func validPkgName(s string) string {
 	s = strings.Map(mapValidChar, s)
@@ -120,7 +171,8 @@ func (ArchLinux) Package(info *nfpm.Info, w io.Writer) error {
 	if info.Platform != "linux" {
 		return fmt.Errorf("invalid platform: %s", info.Platform)
 	}
-	info = ensureValidArch(info)
+	// work on a copy, so that the given info is left as is and can be reused.
+	info = ensureValidArch(info.Copy())
 
 	err := nfpm.PrepareForPackager(info, packagerName)
 	if err != nil {
@@ -130,8 +182,31 @@ func (ArchLinux) Package(info *nfpm.Info, w io.Writer) error {
 	if !nameIsValid(info.Name) {
 		return ErrInvalidPkgName
 	}
+	if _, err := fullVersion(info); err != nil {
+		return err
+	}
 
-	zw, err := zstd.NewWriter(w)
+	// the .INSTALL functions may be defined by the user's scripts, so the
+	// chattr snippets cannot be added to them.
+	for _, content := range info.Contents {
+		if content.FileInfo != nil && len(content.FileInfo.Attrs) > 0 {
+			warning.Warn(content.Destination+": file attributes are not supported by archlinux packages, ignoring them", "path", content.Destination)
+		}
+		if content.IsUnowned() {
+			warning.Warn(content.Destination+": remove_on is not supported by archlinux packages, ignoring it", "path", content.Destination)
+		}
+		if content.Touch {
+			warning.Warn(content.Destination+": touch is not supported by archlinux packages, ignoring it", "path", content.Destination)
+		}
+	}
+	if len(info.Metadata) > 0 {
+		warning.Println("build metadata is not supported by archlinux packages, ignoring it")
+	}
+	if len(info.Alternatives) > 0 {
+		warning.Println("alternatives are not supported by archlinux packages, ignoring them")
+	}
+
+	zw, err := newCompressor(w, info.ArchLinux.Compression, info.CompressionOptions)
 	if err != nil {
 		return err
 	}
@@ -162,19 +237,75 @@ func (ArchLinux) Package(info *nfpm.Info, w io.Writer) error {
 }
 
 // ConventionalExtension returns the file name conventionally used for Arch Linux packages
+// compressed with the default compression algorithm.
 func (ArchLinux) ConventionalExtension() string {
 	return ".pkg.tar.zst"
 }
 
+// Capabilities returns the features of Arch Linux packages, see
+// nfpm.Formats.
+func (ArchLinux) Capabilities() nfpm.Capabilities {
+	return nfpm.Capabilities{
+		Compressions: []string{"zst", "xz", "gz", "none"},
+	}
+}
+
+// ConventionalExtensionFor returns the file extension conventionally used for
+// Arch Linux packages compressed with the algorithm configured in the given info.
+func (a ArchLinux) ConventionalExtensionFor(info *nfpm.Info) string {
+	switch info.ArchLinux.Compression {
+	case "xz":
+		return ".pkg.tar.xz"
+	case "gz":
+		return ".pkg.tar.gz"
+	case "none":
+		return ".pkg.tar"
+	default:
+		return a.ConventionalExtension()
+	}
+}
+
+// newCompressor returns a writer compressing the package with the given
+// algorithm and options.
+func newCompressor(w io.Writer, compression string, options nfpm.CompressionOptions) (io.WriteCloser, error) {
+	switch compression {
+	case "", "zst":
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(options.ZstdConcurrency()))
+	case "xz":
+		return xzpin.NewWriter(w, options.BlockSize)
+	case "gz":
+		// keep the gzip header reproducible
+		gw := pgzip.NewWriter(w)
+		gw.ModTime = time.Unix(0, 0)
+		gw.OS = 255
+		return gw, nil
+	case "none":
+		return nopCloser{Writer: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", compression)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
 // createFilesInTar adds the files described in the given info to the given tar writer
 func createFilesInTar(info *nfpm.Info, tw *tar.Writer) ([]MtreeEntry, int64, error) {
 	entries := make([]MtreeEntry, 0, len(info.Contents))
+	// the entries of the files, for the hard links to them
+	regular := map[string]MtreeEntry{}
 	var totalSize int64
 
 	for _, content := range info.Contents {
 		content.Destination = files.AsRelativePath(content.Destination)
 
 		switch content.Type {
+		case files.TypeRPMGhost:
+			// skip ghost files in archlinux packages
+			continue
 		case files.TypeDir, files.TypeImplicitDir:
 			entries = append(entries, MtreeEntry{
 				Destination: content.Destination,
@@ -183,14 +314,15 @@ func createFilesInTar(info *nfpm.Info, tw *tar.Writer) ([]MtreeEntry, int64, err
 				Type:        files.TypeDir,
 			})
 
-			if err := tw.WriteHeader(&tar.Header{
+			header := &tar.Header{
 				Name:     content.Destination,
 				Mode:     int64(content.Mode()),
 				Typeflag: tar.TypeDir,
 				ModTime:  content.ModTime(),
-				Uname:    content.FileInfo.Owner,
-				Gname:    content.FileInfo.Group,
-			}); err != nil {
+			}
+			header.Uname, header.Uid = content.FileInfo.TarOwner()
+			header.Gname, header.Gid = content.FileInfo.TarGroup()
+			if err := tw.WriteHeader(header); err != nil {
 				return nil, 0, err
 			}
 		case files.TypeSymlink:
@@ -210,8 +342,27 @@ func createFilesInTar(info *nfpm.Info, tw *tar.Writer) ([]MtreeEntry, int64, err
 				Mode:        0o777,
 				Type:        content.Type,
 			})
+		case files.TypeHardlink:
+			target, ok := regular[files.AsRelativePath(content.Source)]
+			if !ok {
+				return nil, 0, fmt.Errorf("%s: hard link to %s, which is not a file of the package", content.Destination, content.Source)
+			}
+			if err := tw.WriteHeader(&tar.Header{
+				Name:     content.Destination,
+				Linkname: target.Destination,
+				Mode:     int64(content.Mode()),
+				ModTime:  content.ModTime(),
+				Typeflag: tar.TypeLink,
+			}); err != nil {
+				return nil, 0, err
+			}
+
+			// the mtree describes the installed file, which is the target.
+			entry := target
+			entry.Destination = content.Destination
+			entries = append(entries, entry)
 		default:
-			src, err := os.Open(content.Source)
+			src, err := content.Open()
 			if err != nil {
 				return nil, 0, err
 			}
@@ -260,6 +411,7 @@ func createFilesInTar(info *nfpm.Info, tw *tar.Writer) ([]MtreeEntry, int64, err
 				MD5:         md5Hash.Sum(nil),
 				SHA256:      sha256Hash.Sum(nil),
 			})
+			regular[content.Destination] = entries[len(entries)-1]
 
 			totalSize += content.Size()
 		}
@@ -284,23 +436,9 @@ func createPkginfo(info *nfpm.Info, tw *tar.Writer, totalSize int64) (*MtreeEntr
 
 	info = ensureValidArch(info)
 
-	pkgrel, err := strconv.Atoi(info.Release)
+	pkgver, err := fullVersion(info)
 	if err != nil {
-		pkgrel = 1
-	}
-
-	pkgver := fmt.Sprintf("%s-%d", info.Version, pkgrel)
-	if info.Epoch != "" {
-		epoch, err := strconv.ParseUint(info.Epoch, 10, 64)
-		if err == nil {
-			pkgver = fmt.Sprintf(
-				"%d:%s%s-%d",
-				epoch,
-				info.Version,
-				strings.ReplaceAll(info.Prerelease, "-", "_"),
-				pkgrel,
-			)
-		}
+		return nil, err
 	}
 
 	// Description cannot contain newlines
@@ -517,8 +655,44 @@ func createMtree(tw *tar.Writer, entries []MtreeEntry, mtime time.Time) error {
 }
 
 func createScripts(info *nfpm.Info, tw *tar.Writer) error {
-	scripts := map[string]string{}
+	script, err := installScript(info)
+	if err != nil || script == "" {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Name:     ".INSTALL",
+		Size:     int64(len(script)),
+		ModTime:  modtime.Get(info.MTime),
+	})
+	if err != nil {
+		return err
+	}
 
+	_, err = io.WriteString(tw, script)
+	return err
+}
+
+// Scriptlets returns the .INSTALL script of the archlinux package created
+// with the given info, if it has scripts, see nfpm.Scriptlets.
+func (ArchLinux) Scriptlets(info *nfpm.Info) (map[string]string, error) {
+	info = ensureValidArch(info.Copy())
+	if err := nfpm.PrepareForPackager(info, packagerName); err != nil {
+		return nil, err
+	}
+	script, err := installScript(info)
+	if err != nil || script == "" {
+		return nil, err
+	}
+	return map[string]string{".INSTALL": script}, nil
+}
+
+// installScript returns the .INSTALL script of the scripts of the info, or
+// an empty string if it has none.
+func installScript(info *nfpm.Info) (string, error) {
+	scripts := map[string]string{}
 	if info.Scripts.PreInstall != "" {
 		scripts["pre_install"] = info.Scripts.PreInstall
 	}
@@ -544,50 +718,75 @@ func createScripts(info *nfpm.Info, tw *tar.Writer) error {
 	}
 
 	if len(scripts) == 0 {
-		return nil
+		return "", nil
 	}
 
-	buf := &bytes.Buffer{}
-
-	err := writeScripts(buf, scripts)
-	if err != nil {
-		return err
+	var buf bytes.Buffer
+	if err := writeScripts(&buf, scripts); err != nil {
+		return "", err
 	}
+	return buf.String(), nil
+}
 
-	err = tw.WriteHeader(&tar.Header{
-		Typeflag: tar.TypeReg,
-		Mode:     0o644,
-		Name:     ".INSTALL",
-		Size:     int64(buf.Len()),
-		ModTime:  modtime.Get(info.MTime),
-	})
-	if err != nil {
-		return err
-	}
+// installFunctions are the functions pacman calls from the .INSTALL script.
+// nolint: gochecknoglobals
+var installFunctions = []string{
+	"pre_install",
+	"post_install",
+	"pre_upgrade",
+	"post_upgrade",
+	"pre_remove",
+	"post_remove",
+}
 
-	_, err = io.Copy(tw, buf)
-	return err
+// definedFunction returns the name of the first .INSTALL function defined by
+// the given script, or an empty string if it is a plain script.
+func definedFunction(script []byte) string {
+	for _, line := range strings.Split(string(script), "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "function ")
+		for _, name := range installFunctions {
+			rest, ok := strings.CutPrefix(line, name)
+			if ok && strings.HasPrefix(strings.TrimSpace(rest), "()") {
+				return name
+			}
+		}
+	}
+	return ""
 }
 
+// writeScripts writes the .INSTALL script. Plain scripts are wrapped into the
+// function pacman calls for their phase, while scripts that already define
+// that function are included as they are.
 func writeScripts(w io.Writer, scripts map[string]string) error {
 	for _, script := range maps.Keys(scripts) {
-		fmt.Fprintf(w, "function %s() {\n", script)
-
-		fl, err := os.Open(scripts[script])
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(w, fl)
+		data, err := os.ReadFile(scripts[script])
 		if err != nil {
 			return err
 		}
 
-		_ = fl.Close()
-
-		_, err = io.WriteString(w, "\n}\n\n")
-		if err != nil {
-			return err
+		switch defined := definedFunction(data); defined {
+		case script:
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(data, []byte("\n")) {
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					return err
+				}
+			}
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		case "":
+			fmt.Fprintf(w, "function %s() {\n", script)
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, "\n}\n\n"); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: %s defines %s() but is used as %s", ErrInvalidScript, scripts[script], defined, script)
 		}
 	}
 
@@ -12,9 +12,11 @@ import (
 
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
 	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
 )
 
 var mtime = time.Date(2023, 11, 5, 23, 15, 17, 0, time.UTC)
@@ -93,6 +95,79 @@ func TestConventionalExtension(t *testing.T) {
 	require.Equal(t, ".pkg.tar.zst", Default.ConventionalExtension())
 }
 
+func TestConventionalExtensionFor(t *testing.T) {
+	for compression, ext := range map[string]string{
+		"":     ".pkg.tar.zst",
+		"zst":  ".pkg.tar.zst",
+		"xz":   ".pkg.tar.xz",
+		"gz":   ".pkg.tar.gz",
+		"none": ".pkg.tar",
+	} {
+		info := exampleInfo()
+		info.ArchLinux.Compression = compression
+		require.Equal(t, ext, Default.ConventionalExtensionFor(info), compression)
+		require.True(t, strings.HasSuffix(Default.ConventionalFileName(info), ext), compression)
+	}
+}
+
+func TestArchCompression(t *testing.T) {
+	for compression, decompress := range map[string]func(io.Reader) (io.Reader, error){
+		"zst": func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+		"xz": func(r io.Reader) (io.Reader, error) {
+			return xz.NewReader(r)
+		},
+		"gz": func(r io.Reader) (io.Reader, error) {
+			return pgzip.NewReader(r)
+		},
+		"none": func(r io.Reader) (io.Reader, error) {
+			return r, nil
+		},
+	} {
+		compression, decompress := compression, decompress
+		t.Run(compression, func(t *testing.T) {
+			info := exampleInfo()
+			info.ArchLinux.Compression = compression
+
+			var pkg bytes.Buffer
+			require.NoError(t, Default.Package(info, &pkg))
+
+			r, err := decompress(&pkg)
+			require.NoError(t, err)
+			var names []string
+			tr := tar.NewReader(r)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				names = append(names, hdr.Name)
+			}
+			require.Contains(t, names, ".PKGINFO")
+		})
+	}
+}
+
+func TestArchGzipHeader(t *testing.T) {
+	info := exampleInfo()
+	info.ArchLinux.Compression = "gz"
+
+	var pkg bytes.Buffer
+	require.NoError(t, Default.Package(info, &pkg))
+	header := pkg.Bytes()[:10]
+	require.Equal(t, []byte{0, 0, 0, 0}, header[4:8], "mtime")
+	require.Equal(t, byte(255), header[9], "OS")
+}
+
+func TestArchInvalidCompression(t *testing.T) {
+	info := exampleInfo()
+	info.ArchLinux.Compression = "bzip2"
+	err := Default.Package(info, io.Discard)
+	require.EqualError(t, err, "unknown compression algorithm: bzip2")
+}
+
 func TestArch(t *testing.T) {
 	for _, arch := range []string{"386", "amd64", "arm64"} {
 		arch := arch
@@ -151,7 +226,7 @@ func TestArchPkginfo(t *testing.T) {
 	fields := extractPkginfoFields(pkginfoData)
 	require.Equal(t, "foo-test", fields["pkgname"])
 	require.Equal(t, "foo-test", fields["pkgbase"])
-	require.Equal(t, "1.0.0-1", fields["pkgver"])
+	require.Equal(t, "1.0.0beta_1-1", fields["pkgver"])
 	require.Equal(t, "Foo does things", fields["pkgdesc"])
 	require.Equal(t, "http://carlosbecker.com", fields["url"])
 	require.Equal(t, "Unknown Packager", fields["packager"])
@@ -188,7 +263,7 @@ func TestArchVersionWithRelease(t *testing.T) {
 	pkginfoData, err := makeTestPkginfo(t, info)
 	require.NoError(t, err)
 	fields := extractPkginfoFields(pkginfoData)
-	require.Equal(t, "0.0.1-4", fields["pkgver"])
+	require.Equal(t, "0.0.1beta_1-4", fields["pkgver"])
 }
 
 func TestArchVersionWithEpoch(t *testing.T) {
@@ -201,6 +276,82 @@ func TestArchVersionWithEpoch(t *testing.T) {
 	require.Equal(t, "2:0.0.1beta_1-1", fields["pkgver"])
 }
 
+func TestArchFullVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version, prerelease, release, epoch string
+		expected                            string
+	}{
+		{version: "1.2.3", expected: "1.2.3-1"},
+		{version: "1.2.3", release: "3", expected: "1.2.3-3"},
+		{version: "1.2.3", release: "1.1", expected: "1.2.3-1.1"},
+		{version: "1.2.3", prerelease: "rc1", expected: "1.2.3rc1-1"},
+		{version: "1.2.3", epoch: "1", expected: "1:1.2.3-1"},
+		{version: "1.2.3", prerelease: "rc-1", release: "2", epoch: "3", expected: "3:1.2.3rc_1-2"},
+	} {
+		info := exampleInfo()
+		info.Version = tc.version
+		info.Prerelease = tc.prerelease
+		info.Release = tc.release
+		info.Epoch = tc.epoch
+		pkginfoData, err := makeTestPkginfo(t, info)
+		require.NoError(t, err)
+		fields := extractPkginfoFields(pkginfoData)
+		require.Equal(t, tc.expected, fields["pkgver"])
+	}
+}
+
+func TestArchFileNameMatchesPkgver(t *testing.T) {
+	info := exampleInfo()
+	info.Version = "1.2.3"
+	info.Prerelease = "rc1"
+	info.Release = "2"
+	pkginfoData, err := makeTestPkginfo(t, info)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3rc1-2", extractPkginfoFields(pkginfoData)["pkgver"])
+	require.Equal(t, "foo-test-1.2.3rc1-2-x86_64.pkg.tar.zst", Default.ConventionalFileName(info))
+}
+
+func TestArchInvalidReleaseAndEpoch(t *testing.T) {
+	for _, release := range []string{"nope", "1-2", "1.", "-1"} {
+		info := exampleInfo()
+		info.Release = release
+		require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidPkgRel, release)
+	}
+	for _, epoch := range []string{"nope", "-1", "1.1"} {
+		info := exampleInfo()
+		info.Epoch = epoch
+		require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidEpoch, epoch)
+	}
+}
+
+func TestArchSnapshotVersion(t *testing.T) {
+	info := exampleInfo()
+	info.Prerelease = ""
+	info.MTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	info.Snapshot = &nfpm.Snapshot{Commit: "abcdef"}
+	pkginfoData, err := makeTestPkginfo(t, info)
+	require.NoError(t, err)
+	pkgver := extractPkginfoFields(pkginfoData)["pkgver"]
+	require.Equal(t, "1.0.0-0.20240101.abcdef", pkgver)
+	require.Equal(t, "foo-test-1.0.0-0.20240101.abcdef-x86_64.pkg.tar.zst", Default.ConventionalFileName(info))
+
+	// the snapshot sorts below the release of the version, as pacman compares
+	// them, and above the snapshots of the days before.
+	require.Negative(t, vercmp.Arch(pkgver, "1.0.0-1"))
+	require.Positive(t, vercmp.Arch(pkgver, "0.9.9-1"))
+	require.Positive(t, vercmp.Arch(pkgver, "1.0.0-0.20231231.fedcba"))
+}
+
+func TestArchInvalidVersion(t *testing.T) {
+	for _, version := range []string{"1.0-1", "1:1.0", "1.0/2", "1.0 2"} {
+		info := exampleInfo()
+		info.VersionSchema = "none"
+		info.Version = version
+		_, err := makeTestPkginfo(t, info)
+		require.ErrorIs(t, err, ErrInvalidPkgVer, version)
+	}
+}
+
 func TestArchOverrideArchitecture(t *testing.T) {
 	info := exampleInfo()
 	info.ArchLinux.Arch = "randomarch"
@@ -388,3 +539,141 @@ func TestGlob(t *testing.T) {
 		require.Equal(t, expect, strings.Split(line, " ")[1:], filename)
 	}
 }
+
+func TestArchDedup(t *testing.T) {
+	var pkg bytes.Buffer
+	require.NoError(t, Default.Package(nfpm.WithDefaults(&nfpm.Info{
+		Name:       "nfpm-dedup",
+		Version:    "1.0.0",
+		Maintainer: "asdfasdf",
+		MTime:      mtime,
+		Dedup:      true,
+		Overridables: nfpm.Overridables{
+			Contents: files.Contents{
+				{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/a.conf"},
+				{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/b.conf"},
+				{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/c.conf"},
+			},
+		},
+	}), &pkg))
+
+	zr, err := zstd.NewReader(&pkg)
+	require.NoError(t, err)
+	t.Cleanup(zr.Close)
+	headers := map[string]*tar.Header{}
+	var mtree []byte
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		headers[header.Name] = header
+		if header.Name == ".MTREE" {
+			gz, err := pgzip.NewReader(tr)
+			require.NoError(t, err)
+			mtree, err = io.ReadAll(gz)
+			require.NoError(t, err)
+		}
+	}
+
+	require.Equal(t, byte(tar.TypeReg), headers["usr/share/foo/a.conf"].Typeflag)
+	lines := map[string]string{}
+	for _, line := range strings.Split(string(mtree), "\n") {
+		name, attrs, _ := strings.Cut(line, " ")
+		lines[name] = attrs
+	}
+	for _, name := range []string{"usr/share/foo/b.conf", "usr/share/foo/c.conf"} {
+		require.Equal(t, byte(tar.TypeLink), headers[name].Typeflag, name)
+		require.Equal(t, "usr/share/foo/a.conf", headers[name].Linkname, name)
+		require.Equal(t, lines["./usr/share/foo/a.conf"], lines["./"+name], name)
+	}
+}
+
+func TestArchInstallScript(t *testing.T) {
+	dir := t.TempDir()
+	postInstall := dir + "/postinstall.sh"
+	require.NoError(t, os.WriteFile(postInstall, []byte("post_install() {\n\techo installed\n}\n"), 0o644))
+
+	info := exampleInfo()
+	info.Scripts.PostInstall = postInstall
+
+	var pkg bytes.Buffer
+	require.NoError(t, Default.Package(info, &pkg))
+
+	zr, err := zstd.NewReader(&pkg)
+	require.NoError(t, err)
+	t.Cleanup(zr.Close)
+
+	var install []byte
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Name == ".INSTALL" {
+			install, err = io.ReadAll(tr)
+			require.NoError(t, err)
+		}
+	}
+
+	require.Equal(t, `post_install() {
+	echo installed
+}
+
+function post_remove() {
+#!/bin/bash
+
+echo "Postremove" > /dev/null
+
+}
+
+function post_upgrade() {
+#!/bin/sh
+
+echo "$@"
+
+echo "PostUpgrade" > /dev/null
+
+}
+
+function pre_install() {
+#!/bin/bash
+
+echo "Preinstall" > /dev/null
+
+}
+
+function pre_remove() {
+#!/bin/bash
+
+echo "Preremove" > /dev/null
+
+}
+
+function pre_upgrade() {
+#!/bin/sh
+
+echo "$@"
+
+echo "PreUpgrade" > /dev/null
+
+}
+
+`, string(install))
+}
+
+func TestArchInstallScriptWrongFunction(t *testing.T) {
+	dir := t.TempDir()
+	preInstall := dir + "/preinstall.sh"
+	require.NoError(t, os.WriteFile(preInstall, []byte("function post_install() {\n\techo installed\n}\n"), 0o644))
+
+	info := exampleInfo()
+	info.Scripts.PreInstall = preInstall
+
+	err := Default.Package(info, io.Discard)
+	require.ErrorIs(t, err, ErrInvalidScript)
+}
@@ -0,0 +1,71 @@
+package deb
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// withCopyrightIfRequested adds a machine-readable copyright file to the
+// package if the license is set, unless Deb.DisableCopyrightFile is set or
+// the contents already have one.
+//
+// https://www.debian.org/doc/debian-policy/ch-docs.html#copyright-information
+// https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+func withCopyrightIfRequested(info *nfpm.Info) (*nfpm.Info, error) {
+	if info.License == "" || info.Deb.DisableCopyrightFile || isUdeb(info) {
+		return info, nil
+	}
+
+	dst := fmt.Sprintf("/usr/share/doc/%s/copyright", info.Name)
+	for _, content := range info.Contents {
+		if (content.Packager == "" || content.Packager == packagerName) &&
+			files.NormalizeAbsoluteFilePath(content.Destination) == dst {
+			return info, nil
+		}
+	}
+
+	copyright, err := formatCopyright(info)
+	if err != nil {
+		return nil, err
+	}
+	info.Contents = append(info.Contents, &files.Content{
+		Destination: dst,
+		Type:        files.TypeFile,
+		Data:        []byte(copyright),
+		FileInfo:    &files.ContentFileInfo{Mode: 0o644},
+	})
+	return info, nil
+}
+
+// formatCopyright formats the copyright file: its header, a single Files
+// paragraph for all of the files, with the vendor or else the maintainer as
+// the copyright holder, and a License paragraph with the text of the license
+// if Deb.LicenseFile is set.
+func formatCopyright(info *nfpm.Info) (string, error) {
+	var b strings.Builder
+	b.WriteString("Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\n")
+	fmt.Fprintf(&b, "Upstream-Name: %s\n", info.Name)
+	if info.Homepage != "" {
+		fmt.Fprintf(&b, "Source: %s\n", info.Homepage)
+	}
+
+	b.WriteString("\nFiles: *\n")
+	if holder := cmp.Or(info.Vendor, info.ResolveMaintainer()); holder != "" {
+		fmt.Fprintf(&b, "Copyright: %s\n", holder)
+	}
+	fmt.Fprintf(&b, "License: %s\n", info.License)
+
+	if info.Deb.LicenseFile != "" {
+		text, err := os.ReadFile(info.Deb.LicenseFile)
+		if err != nil {
+			return "", nfpm.MissingFileError("deb.license_file", info.Deb.LicenseFile, err)
+		}
+		fmt.Fprintf(&b, "\nLicense: %s\n", formatDescription(info.License+"\n"+string(text)))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,143 @@
+package deb
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// DebugSymbolsSuffix is appended to the name of a package to name the package
+// of its debug symbols, see DebugSymbols.
+const DebugSymbolsSuffix = "-dbgsym"
+
+// debugDir is where gdb, apt and debuginfod look up the debug files by their
+// build-id.
+const debugDir = "/usr/lib/debug/.build-id"
+
+// ErrNoBuildID happens when a debug file has no GNU build-id.
+var ErrNoBuildID = errors.New("no GNU build-id")
+
+// DebugSymbols returns the info of the `<name>-dbgsym` package, name being
+// the name of the deb package, shipping the separate debug files at the
+// given paths, e.g. written by `objcopy --only-keep-debug`, of the package of
+// info. Each file must be an ELF file with a GNU build-id, and is installed
+// as /usr/lib/debug/.build-id/xx/yyyy.debug, xx being the first byte of its
+// build-id. Like the packages dh_strip builds, it is marked as
+// `Auto-Built-Package: debug-symbols`, lists the build-ids in its `Build-Ids`
+// field and depends on the exact version of the package.
+func DebugSymbols(info *nfpm.Info, debugFiles []string) (*nfpm.Info, error) {
+	if len(debugFiles) == 0 {
+		return nil, errors.New("no debug files given")
+	}
+	base := nfpm.WithDefaults(info.Copy())
+	if base.Deb.PackageName != "" {
+		base.Name = base.Deb.PackageName
+	}
+
+	dbg := &nfpm.Info{
+		Name:            base.Name + DebugSymbolsSuffix,
+		Arch:            base.Arch,
+		Platform:        base.Platform,
+		Epoch:           base.Epoch,
+		Version:         base.Version,
+		VersionSchema:   "none",
+		Release:         base.Release,
+		Prerelease:      base.Prerelease,
+		VersionMetadata: base.VersionMetadata,
+		Section:         "debug",
+		Priority:        "optional",
+		Maintainer:      base.Maintainer,
+		Description:     "debug symbols for " + base.Name,
+		Vendor:          base.Vendor,
+		Homepage:        base.Homepage,
+		License:         base.License,
+		MTime:           base.MTime,
+	}
+	dbg.Depends = []string{fmt.Sprintf("%s (= %s)", base.Name, fullVersion(base))}
+	dbg.Deb.Arch = base.Deb.Arch
+	dbg.Deb.Compression = base.Deb.Compression
+
+	ids := make([]string, 0, len(debugFiles))
+	for _, debugFile := range debugFiles {
+		id, err := readBuildID(debugFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", debugFile, err)
+		}
+		if slices.Contains(ids, id) {
+			return nil, fmt.Errorf("%s: build-id %s is already used by another debug file", debugFile, id)
+		}
+		ids = append(ids, id)
+		dbg.Contents = append(dbg.Contents, &files.Content{
+			Source:      debugFile,
+			Destination: path.Join(debugDir, id[:2], id[2:]+".debug"),
+			FileInfo:    &files.ContentFileInfo{Mode: 0o644},
+		})
+	}
+	slices.Sort(ids)
+	dbg.Deb.Fields = map[string]string{
+		"Auto-Built-Package": "debug-symbols",
+		"Build-Ids":          strings.Join(ids, " "),
+	}
+	return dbg, nil
+}
+
+// readBuildID returns the GNU build-id of the ELF file at path, in hex.
+func readBuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() // nolint: errcheck
+
+	for _, section := range f.Sections {
+		if section.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return "", err
+		}
+		if id, ok := gnuBuildID(data, f.ByteOrder); ok {
+			return id, nil
+		}
+	}
+	return "", ErrNoBuildID
+}
+
+// gnuBuildID looks for the NT_GNU_BUILD_ID note of the "GNU" owner in the
+// notes of a SHT_NOTE section: each of them is made of the sizes of its name
+// and descriptor, its type, and its name and descriptor padded to 4 bytes.
+func gnuBuildID(notes []byte, order binary.ByteOrder) (string, bool) {
+	const ntGNUBuildID = 3
+	r := bytes.NewReader(notes)
+	for {
+		var header struct{ Namesz, Descsz, Type uint32 }
+		if err := binary.Read(r, order, &header); err != nil {
+			return "", false
+		}
+		if int64(header.Namesz)+int64(header.Descsz) > int64(r.Len()) {
+			return "", false
+		}
+		name := make([]byte, (header.Namesz+3)&^3)
+		desc := make([]byte, (header.Descsz+3)&^3)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", false
+		}
+		if _, err := io.ReadFull(r, desc); err != nil {
+			return "", false
+		}
+		if header.Type == ntGNUBuildID && string(name[:header.Namesz]) == "GNU\x00" && header.Descsz > 1 {
+			return hex.EncodeToString(desc[:header.Descsz]), true
+		}
+	}
+}
@@ -3,16 +3,19 @@ package deb
 
 import (
 	"archive/tar"
-	"bufio"
 	"bytes"
 	"compress/gzip"
 	"crypto/md5" // nolint:gas
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 	"time"
@@ -25,12 +28,18 @@ import (
 	"github.com/goreleaser/nfpm/v2/internal/maps"
 	"github.com/goreleaser/nfpm/v2/internal/modtime"
 	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
+	"github.com/goreleaser/nfpm/v2/internal/xzpin"
 	"github.com/klauspost/compress/zstd"
-	"github.com/ulikunitz/xz"
 )
 
 const packagerName = "deb"
 
+const (
+	packageTypeDeb  = "deb"
+	packageTypeUdeb = "udeb"
+)
+
 // nolint: gochecknoinits
 func init() {
 	nfpm.RegisterPackager(packagerName, Default)
@@ -49,11 +58,26 @@ var archToDebian = map[string]string{
 	"s390":     "s390x",
 }
 
+// ensureValidArch returns a copy of info with the arch translated to the
+// one the packager uses, and the name of the deb package set. The given info
+// is not modified.
 func ensureValidArch(info *nfpm.Info) *nfpm.Info {
-	if info.Deb.Arch != "" {
+	cp := *info
+	info = &cp
+	if info.Deb.PackageName != "" {
+		info.Name = info.Deb.PackageName
+	}
+	switch {
+	case info.Deb.Arch != "":
 		info.Arch = info.Deb.Arch
-	} else if arch, ok := archToDebian[info.Arch]; ok {
-		info.Arch = arch
+	case info.Goarm == "6" && (info.Arch == "arm" || info.Arch == "arm6"):
+		// debian armhf requires ARMv7, an explicit goarm 6 gets armel, while
+		// arch arm6 is still armhf.
+		info.Arch = "armel"
+	default:
+		if arch, ok := archToDebian[info.Arch]; ok {
+			info.Arch = arch
+		}
 	}
 
 	return info
@@ -70,7 +94,7 @@ type Deb struct{}
 // to the conventions for debian packages. See:
 // https://manpages.debian.org/buster/dpkg-dev/dpkg-name.1.en.html
 func (*Deb) ConventionalFileName(info *nfpm.Info) string {
-	info = ensureValidArch(info)
+	info = ensureValidArch(nfpm.WithSnapshot(info, packagerName))
 
 	version := info.Version
 	if info.Prerelease != "" {
@@ -86,7 +110,26 @@ func (*Deb) ConventionalFileName(info *nfpm.Info) string {
 	}
 
 	// package_version_architecture.package-type
-	return fmt.Sprintf("%s_%s_%s.deb", info.Name, version, info.Arch)
+	return fmt.Sprintf("%s_%s_%s%s", info.Name, version, info.Arch, Default.ConventionalExtensionFor(info))
+}
+
+// fullVersion returns the version of the package as written in the control
+// file, with the epoch, the prerelease, the metadata and the revision.
+func fullVersion(info *nfpm.Info) string {
+	version := info.Version
+	if info.Epoch != "" {
+		version = info.Epoch + ":" + version
+	}
+	if info.Prerelease != "" {
+		version += "~" + info.Prerelease
+	}
+	if info.VersionMetadata != "" {
+		version += "+" + info.VersionMetadata
+	}
+	if info.Release != "" {
+		version += "-" + info.Release
+	}
+	return version
 }
 
 // ConventionalExtension returns the file name conventionally used for Deb packages
@@ -94,15 +137,69 @@ func (*Deb) ConventionalExtension() string {
 	return ".deb"
 }
 
+// Capabilities returns the features of deb packages, see nfpm.Formats.
+func (*Deb) Capabilities() nfpm.Capabilities {
+	return nfpm.Capabilities{
+		Compressions:     []string{"gzip", "xz", "zstd", "none"},
+		Signing:          true,
+		WeakDependencies: true,
+		Triggers:         true,
+	}
+}
+
+// ConventionalExtensionFor returns the file extension conventionally used for
+// Deb packages of the package type configured in the given info.
+func (d *Deb) ConventionalExtensionFor(info *nfpm.Info) string {
+	if isUdeb(info) {
+		return ".udeb"
+	}
+	return d.ConventionalExtension()
+}
+
+// ErrInvalidPackageType happens if the package type of a deb is neither deb
+// nor udeb.
+var ErrInvalidPackageType = errors.New("invalid package type")
+
+func validatePackageType(packageType string) error {
+	switch packageType {
+	case "", packageTypeDeb, packageTypeUdeb:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q: must be deb or udeb", ErrInvalidPackageType, packageType)
+	}
+}
+
+func isUdeb(info *nfpm.Info) bool {
+	return info.Deb.PackageType == packageTypeUdeb
+}
+
 // ErrInvalidSignatureType happens if the signature type of a deb is not one of
 // origin, maint or archive.
 var ErrInvalidSignatureType = errors.New("invalid signature type")
 
+// ErrInvalidTag happens if a tag does not follow the facet::value grammar of
+// debtags.
+var ErrInvalidTag = errors.New("invalid tag")
+
+// nolint: gochecknoglobals
+var tagRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*::[a-z0-9][a-z0-9+.:-]*$`)
+
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if !tagRegexp.MatchString(tag) {
+			return fmt.Errorf("%w: %q: must be of the form facet::value", ErrInvalidTag, tag)
+		}
+	}
+	return nil
+}
+
 // Package writes a new deb package to the given writer using the given info.
 func (d *Deb) Package(info *nfpm.Info, deb io.Writer) (err error) { // nolint: funlen
-	info = ensureValidArch(info)
+	if err := validatePackageType(info.Deb.PackageType); err != nil {
+		return err
+	}
 
-	err = nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
+	info, err = prepareInfo(info)
 	if err != nil {
 		return err
 	}
@@ -110,12 +207,19 @@ func (d *Deb) Package(info *nfpm.Info, deb io.Writer) (err error) { // nolint: f
 	// Set up some deb specific defaults
 	d.SetPackagerDefaults(info)
 
-	dataTarball, md5sums, instSize, dataTarballName, err := createDataTarball(info)
+	if err := validateTags(info.Deb.Tags); err != nil {
+		return err
+	}
+	if err := validatePurge(info.Deb.Purge); err != nil {
+		return err
+	}
+
+	dataTarball, sums, instSize, dataTarballName, err := createDataTarball(info)
 	if err != nil {
 		return err
 	}
 
-	controlTarGz, err := createControl(instSize, md5sums, info)
+	controlTarGz, err := createControl(instSize, sums, info)
 	if err != nil {
 		return err
 	}
@@ -141,7 +245,7 @@ func (d *Deb) Package(info *nfpm.Info, deb io.Writer) (err error) { // nolint: f
 		return fmt.Errorf("cannot add data.tar.gz to deb: %w", err)
 	}
 
-	if info.Deb.Signature.KeyFile != "" || info.Deb.Signature.SignFn != nil {
+	if info.Deb.Signature.HasKey() || info.Deb.Signature.SignFn != nil {
 		sig, sigType, err := doSign(info, debianBinary, controlTarGz, dataTarball)
 		if err != nil {
 			return err
@@ -181,7 +285,7 @@ func dpkgSign(info *nfpm.Info, debianBinary, controlTarGz, dataTarball []byte) (
 	if signFn := info.Deb.Signature.SignFn; signFn != nil {
 		sig, err = signFn(data)
 	} else {
-		sig, err = sign.PGPClearSignWithKeyID(data, info.Deb.Signature.KeyFile, info.Deb.Signature.KeyPassphrase, info.Deb.Signature.KeyID)
+		sig, err = sign.PGPClearSignWithKeyID(data, sign.SignatureKey(info.Deb.Signature.PackageSignature), info.Deb.Signature.KeyPassphrase, info.Deb.Signature.KeyID)
 	}
 	if err != nil {
 		return nil, sigType, &nfpm.ErrSigningFailure{Err: err}
@@ -208,7 +312,7 @@ func debSign(info *nfpm.Info, debianBinary, controlTarGz, dataTarball []byte) ([
 	if signFn := info.Deb.Signature.SignFn; signFn != nil {
 		sig, err = signFn(data)
 	} else {
-		sig, err = sign.PGPArmoredDetachSignWithKeyID(data, info.Deb.Signature.KeyFile, info.Deb.Signature.KeyPassphrase, info.Deb.Signature.KeyID)
+		sig, err = sign.PGPArmoredDetachSignWithKeyID(data, sign.SignatureKey(info.Deb.Signature.PackageSignature), info.Deb.Signature.KeyPassphrase, info.Deb.Signature.KeyID)
 	}
 	if err != nil {
 		return nil, sigType, &nfpm.ErrSigningFailure{Err: err}
@@ -284,6 +388,10 @@ func (*Deb) SetPackagerDefaults(info *nfpm.Info) {
 		info.Priority = "optional"
 	}
 
+	if category, ok := info.ResolveCategory(); ok && info.Section == "" {
+		info.Section = category.Section
+	}
+
 	// The safe thing here feels like defaulting to something like below.
 	// That will prevent existing configs from breaking anyway...  Wondering
 	// if in the long run we should be more strict about this and error when
@@ -295,10 +403,15 @@ func (*Deb) SetPackagerDefaults(info *nfpm.Info) {
 }
 
 func addArFile(w *ar.Writer, name string, body []byte, date time.Time) error {
+	// like dpkg-deb, members are 100644 files owned by root, so that the
+	// headers only depend on the date, e.g. $SOURCE_DATE_EPOCH. The ar writer
+	// adds the regular file bits to the mode itself.
 	header := ar.Header{
 		Name:    files.ToNixPath(name),
 		Size:    int64(len(body)),
 		Mode:    0o644,
+		Uid:     0,
+		Gid:     0,
 		ModTime: date,
 	}
 	if err := w.WriteHeader(&header); err != nil {
@@ -314,7 +427,7 @@ type nopCloser struct {
 
 func (nopCloser) Close() error { return nil }
 
-func createDataTarball(info *nfpm.Info) (dataTarBall, md5sums []byte,
+func createDataTarball(info *nfpm.Info) (dataTarBall []byte, sums checksums,
 	instSize int64, name string, err error,
 ) {
 	var (
@@ -327,13 +440,13 @@ func createDataTarball(info *nfpm.Info) (dataTarBall, md5sums []byte,
 		dataTarballWriteCloser = gzip.NewWriter(&dataTarball)
 		name = "data.tar.gz"
 	case "xz":
-		dataTarballWriteCloser, err = xz.NewWriter(&dataTarball)
+		dataTarballWriteCloser, err = xzpin.NewWriter(&dataTarball, info.CompressionOptions.BlockSize)
 		if err != nil {
 			return nil, nil, 0, "", err
 		}
 		name = "data.tar.xz"
 	case "zstd":
-		dataTarballWriteCloser, err = zstd.NewWriter(&dataTarball)
+		dataTarballWriteCloser, err = zstd.NewWriter(&dataTarball, zstd.WithEncoderConcurrency(info.CompressionOptions.ZstdConcurrency()))
 		if err != nil {
 			return nil, nil, 0, "", err
 		}
@@ -348,7 +461,7 @@ func createDataTarball(info *nfpm.Info) (dataTarBall, md5sums []byte,
 	// the writer is properly closed later, this is just in case that we error out
 	defer dataTarballWriteCloser.Close() // nolint: errcheck
 
-	md5sums, instSize, err = fillDataTar(info, dataTarballWriteCloser)
+	sums, instSize, err = fillDataTar(info, dataTarballWriteCloser)
 	if err != nil {
 		return nil, nil, 0, "", err
 	}
@@ -357,17 +470,17 @@ func createDataTarball(info *nfpm.Info) (dataTarBall, md5sums []byte,
 		return nil, nil, 0, "", fmt.Errorf("closing data tarball: %w", err)
 	}
 
-	return dataTarball.Bytes(), md5sums, instSize, name, nil
+	return dataTarball.Bytes(), sums, instSize, name, nil
 }
 
-func fillDataTar(info *nfpm.Info, w io.Writer) (md5sums []byte, instSize int64, err error) {
+func fillDataTar(info *nfpm.Info, w io.Writer) (sums checksums, instSize int64, err error) {
 	out := tar.NewWriter(w)
 
 	// the writer is properly closed later, this is just in case that we have
 	// an error in another part of the code.
 	defer out.Close() // nolint: errcheck
 
-	md5buf, instSize, err := createFilesInsideDataTar(info, out)
+	sums, instSize, err = createFilesInsideDataTar(info, out)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -376,10 +489,18 @@ func fillDataTar(info *nfpm.Info, w io.Writer) (md5sums []byte, instSize int64,
 		return nil, 0, fmt.Errorf("closing data.tar.gz: %w", err)
 	}
 
-	return md5buf.Bytes(), instSize, nil
+	return sums, instSize, nil
 }
 
-func createFilesInsideDataTar(info *nfpm.Info, tw *tar.Writer) (md5buf bytes.Buffer, instSize int64, err error) {
+func createFilesInsideDataTar(info *nfpm.Info, tw *tar.Writer) (sums checksums, instSize int64, err error) {
+	sums, err = newChecksums(info.Deb.ExtraChecksums)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the digests of the files, for the hard links to them
+	digests := map[string]multiHash{}
+
 	// create files and implicit directories
 	for _, file := range info.Contents {
 		var size int64 // declare early to avoid shadowing err
@@ -388,15 +509,20 @@ func createFilesInsideDataTar(info *nfpm.Info, tw *tar.Writer) (md5buf bytes.Buf
 			// skip ghost files in deb
 			continue
 		case files.TypeDir, files.TypeImplicitDir:
-			err = tw.WriteHeader(&tar.Header{
+			if file.IsUnowned() {
+				// created by postinst instead
+				continue
+			}
+			header := &tar.Header{
 				Name:     files.AsExplicitRelativePath(file.Destination),
 				Mode:     int64(file.FileInfo.Mode),
 				Typeflag: tar.TypeDir,
 				Format:   tar.FormatGNU,
-				Uname:    file.FileInfo.Owner,
-				Gname:    file.FileInfo.Group,
 				ModTime:  modtime.Get(info.MTime),
-			})
+			}
+			header.Uname, header.Uid = file.FileInfo.TarOwner()
+			header.Gname, header.Gid = file.FileInfo.TarGroup()
+			err = tw.WriteHeader(header)
 		case files.TypeSymlink:
 			err = newItemInsideTar(tw, []byte{}, &tar.Header{
 				Name:     files.AsExplicitRelativePath(file.Destination),
@@ -405,31 +531,35 @@ func createFilesInsideDataTar(info *nfpm.Info, tw *tar.Writer) (md5buf bytes.Buf
 				ModTime:  modtime.Get(info.MTime),
 				Format:   tar.FormatGNU,
 			})
+		case files.TypeHardlink:
+			err = newHardlinkInsideTar(file, tw, sums, digests)
 		case files.TypeDebChangelog:
-			size, err = createChangelogInsideDataTar(tw, &md5buf, info, file.Destination)
+			size, err = createChangelogInsideDataTar(tw, sums, info, file.Destination)
 		default:
-			size, err = copyToTarAndDigest(file, tw, &md5buf)
+			var digest multiHash
+			size, digest, err = copyToTarAndDigest(file, tw, sums)
+			digests[file.Destination] = digest
 		}
 		if err != nil {
-			return md5buf, 0, err
+			return nil, 0, err
 		}
 		instSize += size
 	}
 
-	return md5buf, instSize, nil
+	return sums, instSize, nil
 }
 
-func copyToTarAndDigest(file *files.Content, tw *tar.Writer, md5w io.Writer) (int64, error) {
-	tarFile, err := os.OpenFile(file.Source, os.O_RDONLY, 0o600) //nolint:gosec
+func copyToTarAndDigest(file *files.Content, tw *tar.Writer, sums checksums) (int64, multiHash, error) {
+	tarFile, err := file.Open()
 	if err != nil {
-		return 0, fmt.Errorf("could not add tarFile to the archive: %w", err)
+		return 0, nil, fmt.Errorf("could not add tarFile to the archive: %w", err)
 	}
 	// don't care if it errs while closing...
 	defer tarFile.Close() // nolint: errcheck,gosec
 
 	header, err := tar.FileInfoHeader(file, file.Source)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	// tar.FileInfoHeader only uses file.Mode().Perm() which masks the mode with
@@ -437,23 +567,123 @@ func copyToTarAndDigest(file *files.Content, tw *tar.Writer, md5w io.Writer) (in
 	header.Mode = int64(file.Mode())
 	header.Format = tar.FormatGNU
 	header.Name = files.AsExplicitRelativePath(file.Destination)
-	header.Uname = file.FileInfo.Owner
-	header.Gname = file.FileInfo.Group
+	header.Uname, header.Uid = file.FileInfo.TarOwner()
+	header.Gname, header.Gid = file.FileInfo.TarGroup()
 	if err := tw.WriteHeader(header); err != nil {
-		return 0, fmt.Errorf("cannot write header of %s to data.tar.gz: %w", file.Source, err)
+		return 0, nil, fmt.Errorf("cannot write header of %s to data.tar.gz: %w", file.Source, err)
 	}
-	digest := md5.New() // nolint:gas
+	digest := sums.digest()
 	if _, err := io.Copy(tw, io.TeeReader(tarFile, digest)); err != nil {
-		return 0, fmt.Errorf("%s: failed to copy: %w", file.Source, err)
+		return 0, nil, fmt.Errorf("%s: failed to copy: %w", file.Source, err)
+	}
+	if err := sums.record(digest, header.Name); err != nil {
+		return 0, nil, fmt.Errorf("%s: failed to write checksums: %w", file.Source, err)
+	}
+	return file.Size(), digest, nil
+}
+
+// newHardlinkInsideTar adds a hard link to a file added before. It takes no
+// space of its own, but is listed in the checksums like the file itself, as
+// dpkg verifies each path.
+func newHardlinkInsideTar(file *files.Content, tw *tar.Writer, sums checksums, digests map[string]multiHash) error {
+	digest, ok := digests[file.Source]
+	if !ok {
+		return fmt.Errorf("%s: hard link to %s, which is not a file of the package", file.Destination, file.Source)
+	}
+	header := &tar.Header{
+		Name:     files.AsExplicitRelativePath(file.Destination),
+		Linkname: files.AsExplicitRelativePath(file.Source),
+		Mode:     int64(file.FileInfo.Mode),
+		Typeflag: tar.TypeLink,
+		ModTime:  file.FileInfo.MTime,
+		Format:   tar.FormatGNU,
+	}
+	header.Uname, header.Uid = file.FileInfo.TarOwner()
+	header.Gname, header.Gid = file.FileInfo.TarGroup()
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("cannot write header of %s to data.tar.gz: %w", file.Destination, err)
+	}
+	if err := sums.record(digest, header.Name); err != nil {
+		return fmt.Errorf("%s: failed to write checksums: %w", file.Destination, err)
+	}
+	return nil
+}
+
+// checksumHashes are the checksum algorithms deb packages can record the
+// digests of their files with, each in its own <algorithm>sums control member.
+// nolint: gochecknoglobals
+var checksumHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// checksumOrder is the order the checksum control members are written in.
+// nolint: gochecknoglobals
+var checksumOrder = []string{"md5", "sha256", "sha512"}
+
+// checksums holds the contents of the md5sums control member, and of the
+// members of the extra checksums, keyed by algorithm.
+type checksums map[string]*bytes.Buffer
+
+func newChecksums(extra []string) (checksums, error) {
+	sums := checksums{"md5": &bytes.Buffer{}}
+	for _, algorithm := range extra {
+		if _, ok := checksumHashes[algorithm]; !ok || algorithm == "md5" {
+			return nil, fmt.Errorf("unknown checksum algorithm: %s", algorithm)
+		}
+		sums[algorithm] = &bytes.Buffer{}
+	}
+	return sums, nil
+}
+
+// digest returns a writer hashing what is written to it with all the
+// algorithms of the checksums.
+func (c checksums) digest() multiHash {
+	digest := multiHash{}
+	for algorithm := range c {
+		digest[algorithm] = checksumHashes[algorithm]()
 	}
-	if _, err := fmt.Fprintf(md5w, "%x  %s\n", digest.Sum(nil), header.Name); err != nil {
-		return 0, fmt.Errorf("%s: failed to write md5: %w", file.Source, err)
+	return digest
+}
+
+// record adds the line of the given file to each of the checksums members.
+func (c checksums) record(digest multiHash, name string) error {
+	for algorithm, sum := range c {
+		if _, err := fmt.Fprintf(sum, "%x  %s\n", digest[algorithm].Sum(nil), name); err != nil {
+			return err
+		}
 	}
-	return file.Size(), nil
+	return nil
+}
+
+type multiHash map[string]hash.Hash
+
+func (m multiHash) Write(p []byte) (int, error) {
+	for _, h := range m {
+		if _, err := h.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// prepareInfo returns a copy of info prepared for the packager, so that the
+// given info is left as is and can be reused.
+func prepareInfo(info *nfpm.Info) (*nfpm.Info, error) {
+	info, err := withCopyrightIfRequested(withChangelogIfRequested(ensureValidArch(info.Copy())))
+	if err != nil {
+		return nil, err
+	}
+	if err := nfpm.PrepareForPackager(info, packagerName); err != nil {
+		return nil, err
+	}
+	applyMinToolVersion(info)
+	return info, nil
 }
 
 func withChangelogIfRequested(info *nfpm.Info) *nfpm.Info {
-	if info.Changelog == "" {
+	if info.Changelog == "" || info.Deb.DisableChangelogFile || isUdeb(info) {
 		return info
 	}
 
@@ -469,7 +699,7 @@ func withChangelogIfRequested(info *nfpm.Info) *nfpm.Info {
 
 func createChangelogInsideDataTar(
 	tarw *tar.Writer,
-	g io.Writer,
+	sums checksums,
 	info *nfpm.Info,
 	fileName string,
 ) (int64, error) {
@@ -500,17 +730,12 @@ func createChangelogInsideDataTar(
 
 	changelogData := buf.Bytes()
 
-	digest := md5.New() // nolint:gas
+	digest := sums.digest()
 	if _, err = digest.Write(changelogData); err != nil {
 		return 0, err
 	}
 
-	if _, err = fmt.Fprintf(
-		g,
-		"%x  %s\n",
-		digest.Sum(nil),
-		files.AsExplicitRelativePath(fileName),
-	); err != nil {
+	if err = sums.record(digest, files.AsExplicitRelativePath(fileName)); err != nil {
 		return 0, err
 	}
 
@@ -522,7 +747,7 @@ func createChangelogInsideDataTar(
 }
 
 func formatChangelog(info *nfpm.Info) (string, error) {
-	changelog, err := info.GetChangeLog()
+	changelog, err := info.GetSortedChangeLog(fullVersion(info), vercmp.Deb)
 	if err != nil {
 		return "", err
 	}
@@ -541,7 +766,7 @@ func formatChangelog(info *nfpm.Info) (string, error) {
 }
 
 // nolint:funlen
-func createControl(instSize int64, md5sums []byte, info *nfpm.Info) (controlTarGz []byte, err error) {
+func createControl(instSize int64, sums checksums, info *nfpm.Info) (controlTarGz []byte, err error) {
 	var buf bytes.Buffer
 	compress := gzip.NewWriter(&buf)
 	out := tar.NewWriter(compress)
@@ -562,11 +787,37 @@ func createControl(instSize int64, md5sums []byte, info *nfpm.Info) (controlTarG
 	if err := newFileInsideTar(out, "./control", body.Bytes(), mtime); err != nil {
 		return nil, err
 	}
-	if err := newFileInsideTar(out, "./md5sums", md5sums, mtime); err != nil {
-		return nil, err
-	}
-	if err := newFileInsideTar(out, "./conffiles", conffiles(info), mtime); err != nil {
-		return nil, err
+	// udebs carry neither checksums nor conffiles, as the installer neither
+	// checks the files nor handles configuration files.
+	if !isUdeb(info) {
+		for _, algorithm := range checksumOrder {
+			sum, ok := sums[algorithm]
+			if !ok && algorithm != "md5" {
+				continue
+			}
+			var content []byte
+			if sum != nil {
+				content = sum.Bytes()
+			}
+			// md5sums is always written, even without files.
+			if err := newFileInsideTar(out, "./"+algorithm+"sums", content, mtime); err != nil {
+				return nil, err
+			}
+		}
+		if err := newFileInsideTar(out, "./conffiles", conffiles(info), mtime); err != nil {
+			return nil, err
+		}
+		if info.AutoDeps {
+			shlibs, err := createShlibs(info)
+			if err != nil {
+				return nil, err
+			}
+			if len(shlibs) > 0 {
+				if err := newFileInsideTar(out, "./shlibs", shlibs, mtime); err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 
 	if triggers := createTriggers(info); len(triggers) > 0 {
@@ -575,48 +826,34 @@ func createControl(instSize int64, md5sums []byte, info *nfpm.Info) (controlTarG
 		}
 	}
 
-	type fileAndMode struct {
-		fileName string
-		mode     int64
+	scripts, err := maintainerScripts(info)
+	if err != nil {
+		return nil, err
 	}
-
-	specialFiles := map[string]*fileAndMode{
-		"preinst": {
-			fileName: info.Scripts.PreInstall,
-			mode:     0o755,
-		},
-		"postinst": {
-			fileName: info.Scripts.PostInstall,
-			mode:     0o755,
-		},
-		"prerm": {
-			fileName: info.Scripts.PreRemove,
-			mode:     0o755,
-		},
-		"postrm": {
-			fileName: info.Scripts.PostRemove,
-			mode:     0o755,
-		},
-		"rules": {
-			fileName: info.Overridables.Deb.Scripts.Rules,
-			mode:     0o755,
-		},
-		"templates": {
-			fileName: info.Overridables.Deb.Scripts.Templates,
-			mode:     0o644,
-		},
-		"config": {
-			fileName: info.Overridables.Deb.Scripts.Config,
-			mode:     0o755,
-		},
+	for _, name := range maps.Keys(scripts) {
+		if err := newItemInsideTar(out, []byte(scripts[name]), &tar.Header{
+			Name:     files.AsExplicitRelativePath(name),
+			Size:     int64(len(scripts[name])),
+			Mode:     0o755,
+			ModTime:  mtime,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatGNU,
+		}); err != nil {
+			return nil, err
+		}
 	}
-
-	for _, filename := range maps.Keys(specialFiles) {
-		dets := specialFiles[filename]
-		if dets.fileName == "" {
+	// rules and templates are no shell scripts, they sort after the scripts.
+	for _, file := range []struct {
+		name, path string
+		mode       int64
+	}{
+		{"rules", info.Deb.Scripts.Rules, 0o755},
+		{"templates", info.Deb.Scripts.Templates, 0o644},
+	} {
+		if file.path == "" {
 			continue
 		}
-		if err := newFilePathInsideTar(out, dets.fileName, filename, dets.mode, mtime); err != nil {
+		if err := newFilePathInsideTar(out, file.path, file.name, file.mode, mtime); err != nil {
 			return nil, err
 		}
 	}
@@ -630,6 +867,88 @@ func createControl(instSize int64, md5sums []byte, info *nfpm.Info) (controlTarG
 	return buf.Bytes(), nil
 }
 
+// Scriptlets returns the maintainer scripts of the deb package created with
+// the given info, i.e. preinst, postinst, prerm, postrm and the debconf
+// config script, with the snippets nfpm generates appended, see
+// nfpm.Scriptlets.
+func (*Deb) Scriptlets(info *nfpm.Info) (map[string]string, error) {
+	info, err := prepareInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	return maintainerScripts(info)
+}
+
+// maintainerScripts returns the maintainer scripts of the prepared info, by
+// name, each being the script of the info, or a new script of the shell, with
+// the snippets nfpm generates appended and, if Deb.ScriptPreamble is set, the
+// preamble added.
+func maintainerScripts(info *nfpm.Info) (map[string]string, error) {
+	setAttrs, clearAttrs := files.AttrScriptlets(info.Contents)
+	createDirs, purgeDirs := files.RemoveOnScriptlets(info.Contents)
+	createDirs = files.AppendScriptlet(createDirs, files.GhostScriptlet(info.Contents))
+	purgeFiles, err := purgeScriptlet(info)
+	if err != nil {
+		return nil, err
+	}
+	// the files are removed first, so that the directories they are in are
+	// empty.
+	purgeDirs = purgeFiles + purgeDirs
+	if purgeDirs != "" {
+		purgeDirs = "if [ \"$1\" = \"purge\" ] ; then\n" + purgeDirs + "fi\n"
+	}
+	installAlternatives, removeAlternatives := alternativesScriptlets(info.Alternatives)
+	snippets := map[string]string{
+		// the directories are created first, as attributes may be set on
+		// them.
+		"postinst": files.AppendScriptlet(files.AppendScriptlet(createDirs, setAttrs), installAlternatives),
+		// prerm also runs before the files of the new version of the package
+		// are unpacked on upgrades.
+		"prerm":  files.AppendScriptlet(removeAlternatives, clearAttrs),
+		"postrm": purgeDirs,
+	}
+
+	scripts := map[string]string{}
+	for name, path := range map[string]string{
+		"preinst":  info.Scripts.PreInstall,
+		"postinst": info.Scripts.PostInstall,
+		"prerm":    info.Scripts.PreRemove,
+		"postrm":   info.Scripts.PostRemove,
+		"config":   info.Deb.Scripts.Config,
+	} {
+		snippet := snippets[name]
+		if snippet == "" && path == "" {
+			continue
+		}
+		script := "#!" + info.ScriptInterpreter() + "\n"
+		if path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			script = string(data)
+		}
+		if info.Deb.ScriptPreamble {
+			script = withScriptPreamble(script, info.ScriptInterpreter())
+		}
+		scripts[name] = files.AppendScriptlet(script, snippet)
+	}
+	return scripts, nil
+}
+
+// alternativesScriptlets returns the postinst and prerm snippets that register
+// the alternatives and remove them, unless the package is being upgraded.
+func alternativesScriptlets(alternatives []nfpm.Alternative) (install, remove string) {
+	if len(alternatives) == 0 {
+		return "", ""
+	}
+	for _, alt := range alternatives {
+		install += alt.InstallCommand()
+		remove += alt.RemoveCommand()
+	}
+	return install, "if [ \"$1\" != \"upgrade\" ] ; then\n" + remove + "fi\n"
+}
+
 func newItemInsideTar(out *tar.Writer, content []byte, header *tar.Header) error {
 	if err := out.WriteHeader(header); err != nil {
 		return fmt.Errorf("cannot write header of %s file to control.tar.gz: %w", header.Name, err)
@@ -670,6 +989,37 @@ func newFilePathInsideTar(out *tar.Writer, path, dest string, mode int64, modtim
 	})
 }
 
+// nolint: gochecknoglobals
+var (
+	shellShebangRegexp   = regexp.MustCompile(`^#!\s*(?:/usr)?/bin/(?:env\s+)?(?:sh|bash|dash)(?:\s|$)`)
+	setErrexitRegexp     = regexp.MustCompile(`(?m)^\s*set\s+(?:-[a-zA-Z]*e|-o\s+errexit)`)
+	debianFrontendRegexp = regexp.MustCompile(`(?m)^\s*(?:export\s+)?DEBIAN_FRONTEND=`)
+)
+
+// withScriptPreamble adds `set -e` and `export DEBIAN_FRONTEND=noninteractive`
+// right after the shebang of the shell script, each unless the script already
+// sets it, and a shebang of the shell if it has none. Scripts with a shebang
+// of another interpreter are returned as is.
+func withScriptPreamble(script, shell string) string {
+	shebang, body := "#!"+shell+"\n", script
+	if strings.HasPrefix(script, "#!") {
+		line, rest, _ := strings.Cut(script, "\n")
+		if !shellShebangRegexp.MatchString(line) && strings.TrimSpace(line) != "#!"+shell {
+			return script
+		}
+		shebang, body = line+"\n", rest
+	}
+
+	var preamble string
+	if !setErrexitRegexp.MatchString(body) {
+		preamble += "set -e\n"
+	}
+	if !debianFrontendRegexp.MatchString(body) {
+		preamble += "export DEBIAN_FRONTEND=noninteractive\n"
+	}
+	return shebang + preamble + body
+}
+
 func conffiles(info *nfpm.Info) []byte {
 	// nolint: prealloc
 	var confs []string
@@ -682,6 +1032,35 @@ func conffiles(info *nfpm.Info) []byte {
 	return []byte(strings.Join(confs, "\n") + "\n")
 }
 
+// createShlibs returns the shlibs control file listing the shared objects the
+// package provides, see deb-shlibs(5), which other packages depend on at
+// least the version of the package for, like `dh_makeshlibs -V` does.
+// Shared objects whose soname is neither `libfoo.so.1` nor `libfoo-1.so` are
+// left out.
+func createShlibs(info *nfpm.Info) ([]byte, error) {
+	provided, _, err := files.SharedObjects(info.Contents)
+	if err != nil {
+		return nil, err
+	}
+	upstream := *info
+	upstream.Release = ""
+	var buf bytes.Buffer
+	for _, so := range provided {
+		name, version, ok := strings.Cut(so.Name, ".so.")
+		if !ok {
+			name, ok = strings.CutSuffix(so.Name, ".so")
+			if i := strings.LastIndexByte(name, '-'); ok && i > 0 {
+				name, version = name[:i], name[i+1:]
+			}
+		}
+		if name == "" || version == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %s %s (>= %s)\n", name, version, info.Name, fullVersion(&upstream))
+	}
+	return buf.Bytes(), nil
+}
+
 func createTriggers(info *nfpm.Info) []byte {
 	var buffer bytes.Buffer
 
@@ -749,6 +1128,15 @@ Breaks: {{join .}}
 {{- if .Info.Homepage}}
 Homepage: {{.Info.Homepage}}
 {{- end }}
+{{- with .Info.Deb.Tags}}
+Tag: {{join .}}
+{{- end }}
+{{- if eq .Info.Deb.PackageType "udeb" }}
+Package-Type: udeb
+{{- end }}
+{{- range $key, $value := .Info.Metadata }}
+Metadata-{{$key}}: {{$value}}
+{{- end }}
 {{- /* Mandatory fields */}}
 Description: {{multiline .Info.Description}}
 {{- range $key, $value := .Info.Deb.Fields }}
@@ -763,28 +1151,35 @@ type controlData struct {
 	InstalledSize int64
 }
 
+// formatDescription formats a description as the value of the Description
+// field: the first line is the synopsis, every following line is prefixed by a
+// space and empty lines become " .". The indentation of the following lines is
+// kept, so that lines indented by two or more spaces are still displayed
+// verbatim.
+func formatDescription(description string) string {
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(description), "\r\n", "\n"), "\n")
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(lines[0]))
+	for _, line := range lines[1:] {
+		b.WriteString("\n ")
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			b.WriteByte('.')
+		} else {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
 func writeControl(w io.Writer, data controlData) error {
 	tmpl := template.New("control")
 	tmpl.Funcs(template.FuncMap{
 		"join": func(strs []string) string {
 			return strings.Trim(strings.Join(strs, ", "), " ")
 		},
-		"multiline": func(strs string) string {
-			var b strings.Builder
-			s := bufio.NewScanner(strings.NewReader(strings.TrimSpace(strs)))
-			s.Scan()
-			b.Write(bytes.TrimSpace(s.Bytes()))
-			for s.Scan() {
-				b.WriteString("\n ")
-				l := bytes.TrimSpace(s.Bytes())
-				if len(l) == 0 {
-					b.WriteByte('.')
-				} else {
-					b.Write(l)
-				}
-			}
-			return b.String()
-		},
+		"multiline": formatDescription,
 		"nonEmpty": func(strs []string) []string {
 			var result []string
 			for _, s := range strs {
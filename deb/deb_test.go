@@ -5,14 +5,19 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/md5" // nolint: gosec
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -23,6 +28,9 @@ import (
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/files"
 	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+	"github.com/goreleaser/nfpm/v2/internal/xzpin"
 	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 	"github.com/xi2/xz"
@@ -102,6 +110,14 @@ func TestConventionalExtension(t *testing.T) {
 	require.Equal(t, ".deb", Default.ConventionalExtension())
 }
 
+func TestConventionalExtensionFor(t *testing.T) {
+	info := exampleInfo()
+	require.Equal(t, ".deb", Default.ConventionalExtensionFor(info))
+	info.Deb.PackageType = "udeb"
+	require.Equal(t, ".udeb", Default.ConventionalExtensionFor(info))
+	require.Equal(t, "foo_1.0.0_amd64.udeb", Default.ConventionalFileName(info))
+}
+
 func TestDeb(t *testing.T) {
 	for _, arch := range []string{"386", "amd64"} {
 		arch := arch
@@ -437,13 +453,18 @@ func TestConffiles(t *testing.T) {
 					Destination: "/etc/fake",
 					Type:        files.TypeConfig,
 				},
+				{
+					Source:      "../testdata/fake",
+					Destination: "/etc/fake.d/fake",
+					Type:        "config|noreplace|missingok",
+				},
 			},
 		},
 	})
 	err := nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
 	require.NoError(t, err)
 	out := conffiles(info)
-	require.Equal(t, "/etc/fake\n", string(out), "should have a trailing empty line")
+	require.Equal(t, "/etc/fake\n/etc/fake.d/fake\n", string(out), "should have a trailing empty line")
 }
 
 func TestMinimalFields(t *testing.T) {
@@ -541,6 +562,535 @@ func TestMultilineFields(t *testing.T) {
 	require.Equal(t, string(bts), w.String())
 }
 
+func TestDebCategory(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		section    string
+		category   string
+		categories map[string]nfpm.Category
+		expected   string
+	}{
+		"default":    {category: "utils", expected: "utils"},
+		"explicit":   {category: "utils", section: "misc", expected: "misc"},
+		"custom":     {category: "tools", categories: map[string]nfpm.Category{"tools": {Section: "devel"}}, expected: "devel"},
+		"override":   {category: "net", categories: map[string]nfpm.Category{"net": {Section: "web"}}, expected: "web"},
+		"group only": {category: "tools", categories: map[string]nfpm.Category{"tools": {Group: "Development/Tools"}}, expected: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.Section = testCase.section
+			info.Category = testCase.category
+			info.Categories = testCase.categories
+
+			var deb bytes.Buffer
+			require.NoError(t, Default.Package(info, &deb))
+
+			control := extractFileFromTar(t, inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./control")
+			require.Contains(t, string(control), "\nSection: "+testCase.expected+"\n")
+		})
+	}
+}
+
+func TestReproducibleArHeaders(t *testing.T) {
+	sourceDate := time.Date(2023, 11, 5, 23, 15, 17, 0, time.UTC)
+	t.Setenv("SOURCE_DATE_EPOCH", strconv.FormatInt(sourceDate.Unix(), 10))
+
+	build := func() []byte {
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(exampleInfo(), &deb))
+		return deb.Bytes()
+	}
+	first, second := build(), build()
+	require.Equal(t, first, second)
+
+	// each member header is 60 bytes: name (16), mtime (12), uid (6), gid
+	// (6), mode (8), size (10) and the "`\n" magic.
+	offset := len("!<arch>\n")
+	var names []string
+	for offset < len(first) {
+		header := string(first[offset : offset+60])
+		names = append(names, strings.TrimRight(header[0:16], " "))
+		require.Equal(t, strconv.FormatInt(sourceDate.Unix(), 10), strings.TrimSpace(header[16:28]), header)
+		require.Equal(t, "0", strings.TrimSpace(header[28:34]), header)
+		require.Equal(t, "0", strings.TrimSpace(header[34:40]), header)
+		require.Equal(t, "100644", strings.TrimSpace(header[40:48]), header)
+
+		size, err := strconv.Atoi(strings.TrimSpace(header[48:58]))
+		require.NoError(t, err)
+		offset += 60 + size + size%2
+	}
+	require.Equal(t, []string{"debian-binary", "control.tar.gz", "data.tar.gz"}, names)
+}
+
+func TestPackageName(t *testing.T) {
+	info := exampleInfo()
+	info.Deb.PackageName = "libfoo0"
+	info.RPM.PackageName = "libfoo"
+	require.Equal(t, "libfoo0_1.0.0_amd64.deb", Default.ConventionalFileName(info))
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	control := string(extractFileFromTar(t, inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./control"))
+	require.Contains(t, control, "Package: libfoo0\n")
+	require.Equal(t, "foo", info.Name)
+
+	dbg, err := DebugSymbols(info, []string{"../testdata/debug/foo.debug"})
+	require.NoError(t, err)
+	require.Equal(t, "libfoo0-dbgsym", dbg.Name)
+	require.Equal(t, []string{"libfoo0 (= 1.0.0)"}, dbg.Depends)
+}
+
+func TestDebugSymbols(t *testing.T) {
+	info := exampleInfo()
+	info.Release = "2"
+
+	dbg, err := DebugSymbols(info, []string{"../testdata/debug/foo.debug"})
+	require.NoError(t, err)
+	require.Equal(t, "foo-dbgsym", dbg.Name)
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(dbg, &deb))
+	control := string(extractFileFromTar(t, inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./control"))
+	for _, field := range []string{
+		"Package: foo-dbgsym\n",
+		"Version: 1.0.0-2\n",
+		"Section: debug\n",
+		"Priority: optional\n",
+		"Depends: foo (= 1.0.0-2)\n",
+		"Auto-Built-Package: debug-symbols\n",
+		"Build-Ids: 03b28cc67d82fb5bd7ba6d8493d05581edeef01a\n",
+		"Description: debug symbols for foo\n",
+	} {
+		require.Contains(t, control, field)
+	}
+
+	dataTar := inflate(t, findDataTarball(t, deb.Bytes()), extractFileFromAr(t, deb.Bytes(), findDataTarball(t, deb.Bytes())))
+	require.Equal(t, []string{
+		"./usr/",
+		"./usr/lib/",
+		"./usr/lib/debug/",
+		"./usr/lib/debug/.build-id/",
+		"./usr/lib/debug/.build-id/03/",
+		"./usr/lib/debug/.build-id/03/b28cc67d82fb5bd7ba6d8493d05581edeef01a.debug",
+	}, tarContents(t, dataTar))
+
+	t.Run("not an elf file", func(t *testing.T) {
+		_, err := DebugSymbols(info, []string{"../testdata/fake"})
+		require.ErrorContains(t, err, "../testdata/fake: ")
+	})
+
+	t.Run("same build-id", func(t *testing.T) {
+		_, err := DebugSymbols(info, []string{"../testdata/debug/foo.debug", "../testdata/debug/foo.debug"})
+		require.ErrorContains(t, err, "build-id 03b28cc67d82fb5bd7ba6d8493d05581edeef01a is already used")
+	})
+
+	t.Run("no build-id", func(t *testing.T) {
+		_, err := DebugSymbols(info, []string{"../testdata/debug/nobuildid.debug"})
+		require.ErrorIs(t, err, ErrNoBuildID)
+	})
+}
+
+func TestReproducibleCompression(t *testing.T) {
+	for _, compression := range []string{"xz", "zstd"} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			build := func() []byte {
+				info := exampleInfo()
+				info.Deb.Compression = compression
+				info.CompressionOptions.Threads = 1
+				var deb bytes.Buffer
+				require.NoError(t, Default.Package(info, &deb))
+				return deb.Bytes()
+			}
+			require.Equal(t, build(), build())
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		info := exampleInfo()
+		info.CompressionOptions.Threads = -1
+		err := Default.Package(info, io.Discard)
+		var target nfpm.ValidationError
+		require.ErrorAs(t, err, &target)
+		require.Equal(t, "invalid_compression_options", target.Code)
+		require.EqualError(t, err, "invalid compression options: threads must not be negative, got -1")
+	})
+}
+
+func TestReproducibleXZPayload(t *testing.T) {
+	build := func() []byte {
+		info := exampleInfo()
+		info.Deb.Compression = "xz"
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+		return extractFileFromAr(t, deb.Bytes(), "data.tar.xz")
+	}
+	payload := build()
+	require.Equal(t, payload, build())
+
+	// a single stream with CRC64 checks, compressed with the pinned settings
+	require.Equal(t, []byte{0xfd, '7', 'z', 'X', 'Z', 0, 0, 0x04}, payload[:8])
+	var expected bytes.Buffer
+	w, err := xzpin.NewWriter(&expected, 0)
+	require.NoError(t, err)
+	_, err = w.Write(inflate(t, "data.tar.xz", payload))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, expected.Bytes(), payload)
+}
+
+func TestMinToolVersion(t *testing.T) {
+	for minVersion, expected := range map[string]string{
+		"1.21.18": "data.tar.zst",
+		"1.19.0":  "data.tar.xz",
+		"1.15.5":  "data.tar.gz",
+	} {
+		t.Run(minVersion, func(t *testing.T) {
+			var w bytes.Buffer
+			prevNoticer := warning.Noticer
+			t.Cleanup(func() { warning.Noticer = prevNoticer })
+			warning.Noticer = &w
+
+			info := exampleInfo()
+			info.Deb.Compression = "zstd"
+			info.MinToolVersion = map[string]string{"deb": minVersion}
+			var deb bytes.Buffer
+			require.NoError(t, Default.Package(info, &deb))
+			require.Equal(t, []string{"debian-binary", "control.tar.gz", expected}, arMembers(t, deb.Bytes()))
+			downgraded := strings.Contains(w.String(), "dpkg "+minVersion+" does not support zstd data tarballs")
+			require.Equal(t, expected != "data.tar.zst", downgraded, w.String())
+		})
+	}
+
+	info := exampleInfo()
+	info.MinToolVersion = map[string]string{"deb": "bookworm"}
+	var target nfpm.ValidationError
+	require.ErrorAs(t, Default.Package(info, io.Discard), &target)
+	require.Equal(t, "invalid_min_tool_version", target.Code)
+}
+
+func TestLints(t *testing.T) {
+	for _, tc := range []struct {
+		section, priority, distro, format string
+		suppress                          []string
+		expected                          string
+	}{
+		{"utils", "optional", "", "deb", nil, ""},
+		{"contrib/net", "required", "", "deb", nil, ""},
+		{"universe/libs", "standard", "ubuntu", "deb", nil, ""},
+		{"", "", "", "deb", nil, ""},
+		{"utils", "extra", "", "deb", nil, `deb priority "extra" is deprecated, use "optional" instead (lint deb-priority)` + "\n"},
+		{"utils", "mandatory", "", "deb", nil, "unknown deb priority \"mandatory\", must be one of required, important, standard or optional (lint deb-priority)\n"},
+		{"default", "optional", "", "deb", nil, "unknown deb section \"default\" (lint deb-section)\n"},
+		{"default", "optional", "debian", "deb", nil, "target distro debian: unknown deb section \"default\" (lint deb-section)\n"},
+		{"private/utils", "optional", "", "deb", nil, "unknown deb archive area \"private\" in section \"private/utils\" (lint deb-section)\n"},
+		{"default", "extra", "", "rpm", nil, ""},
+		{"default", "extra", "", "deb", []string{"deb-section", "deb-priority"}, ""},
+	} {
+		t.Run(tc.section+"/"+tc.priority+"/"+tc.format, func(t *testing.T) {
+			var w bytes.Buffer
+			prevNoticer := warning.Noticer
+			t.Cleanup(func() { warning.Noticer = prevNoticer })
+			warning.Noticer = &w
+
+			info := nfpm.WithDefaults(&nfpm.Info{
+				Name:          "foo",
+				Arch:          "amd64",
+				Version:       "1.0.0",
+				Maintainer:    "Foo <foo@example.com>",
+				Section:       tc.section,
+				Priority:      tc.priority,
+				TargetDistro:  tc.distro,
+				SuppressLints: tc.suppress,
+			})
+			require.NoError(t, nfpm.PrepareForPackager(info, tc.format))
+			require.Equal(t, tc.expected, w.String())
+		})
+	}
+}
+
+// BenchmarkCompressionThreads compares the throughput of the zstd compression
+// of a large payload with one and with four threads.
+func BenchmarkCompressionThreads(b *testing.B) {
+	// half random, half zeroes, so that there is something to compress.
+	payload := make([]byte, 64<<20)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < len(payload); i += 2048 {
+		rng.Read(payload[i : i+1024])
+	}
+	path := filepath.Join(b.TempDir(), "payload")
+	require.NoError(b, os.WriteFile(path, payload, 0o644))
+
+	for _, threads := range []int{1, 4} {
+		threads := threads
+		b.Run(strconv.Itoa(threads), func(b *testing.B) {
+			info := exampleInfo()
+			info.Deb.Compression = "zstd"
+			info.CompressionOptions.Threads = threads
+			info.Contents = files.Contents{{Source: path, Destination: "/usr/share/foo/payload"}}
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, Default.Package(info, io.Discard))
+			}
+		})
+	}
+}
+
+func TestReproducibleGzipHeaders(t *testing.T) {
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(exampleInfo(), &deb))
+
+	for _, name := range []string{"control.tar.gz", "data.tar.gz"} {
+		header := extractFileFromAr(t, deb.Bytes(), name)[:10]
+		require.Equal(t, []byte{0x1f, 0x8b}, header[0:2], name)
+		require.Equal(t, []byte{0, 0, 0, 0}, header[4:8], "mtime of %s", name)
+		require.Equal(t, byte(255), header[9], "OS of %s", name)
+	}
+}
+
+func TestDebOwnerIDs(t *testing.T) {
+	info := exampleInfo()
+	info.PasswdFile = "../testdata/passwd"
+	info.GroupFile = "../testdata/group"
+	info.Contents = files.Contents{
+		{
+			Source:      "../testdata/fake",
+			Destination: "/usr/bin/fake",
+			FileInfo:    &files.ContentFileInfo{Owner: "foo", Group: "users"},
+		},
+	}
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	dataTar := inflate(t, findDataTarball(t, deb.Bytes()), extractFileFromAr(t, deb.Bytes(), findDataTarball(t, deb.Bytes())))
+	header := extractFileHeaderFromTar(t, dataTar, "/usr/bin/fake")
+	require.Equal(t, "foo", header.Uname)
+	require.Equal(t, 998, header.Uid)
+	require.Equal(t, "users", header.Gname)
+	require.Equal(t, 100, header.Gid)
+
+	info.Contents[0].FileInfo.Owner = "nobody"
+	require.ErrorIs(t, Default.Package(info, io.Discard), files.ErrUnknownOwner)
+}
+
+func TestDebTags(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		info := exampleInfo()
+		info.Deb.Tags = []string{"role::program", "implemented-in::c++", "interface::commandline"}
+
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+
+		control := extractFileFromTar(t, inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./control")
+		require.Contains(t, string(control), "\nTag: role::program, implemented-in::c++, interface::commandline\n")
+	})
+
+	t.Run("none", func(t *testing.T) {
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(exampleInfo(), &deb))
+
+		control := extractFileFromTar(t, inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./control")
+		require.NotContains(t, string(control), "\nTag:")
+	})
+
+	for _, tag := range []string{"program", "role:program", "role::", "::program", "Role::Program", "role::program, devel::lang"} {
+		t.Run("invalid "+tag, func(t *testing.T) {
+			info := exampleInfo()
+			info.Deb.Tags = []string{tag}
+			err := Default.Package(info, io.Discard)
+			require.ErrorIs(t, err, ErrInvalidTag)
+		})
+	}
+}
+
+func TestCopyrightFile(t *testing.T) {
+	dataTar := func(t *testing.T, info *nfpm.Info) []byte {
+		t.Helper()
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+		require.NoError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())))
+		return inflate(t, "data.tar.gz", extractFileFromAr(t, deb.Bytes(), "data.tar.gz"))
+	}
+
+	licenseFile := filepath.Join(t.TempDir(), "LICENSE")
+	require.NoError(t, os.WriteFile(licenseFile, []byte("MIT License\n\nPermission is hereby granted.\n"), 0o644))
+	info := exampleInfo()
+	info.License = "MIT"
+	info.Deb.LicenseFile = licenseFile
+	tarball := dataTar(t, info)
+	require.Equal(t, `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: foo
+Source: http://carlosbecker.com
+
+Files: *
+Copyright: nope
+License: MIT
+
+License: MIT
+ MIT License
+ .
+ Permission is hereby granted.
+`, string(extractFileFromTar(t, tarball, "./usr/share/doc/foo/copyright")))
+	require.Equal(t, int64(0o644), extractFileHeaderFromTar(t, tarball, "./usr/share/doc/foo/copyright").Mode)
+
+	t.Run("without license text", func(t *testing.T) {
+		info := exampleInfo()
+		info.License = "Apache-2.0"
+		copyright := string(extractFileFromTar(t, dataTar(t, info), "./usr/share/doc/foo/copyright"))
+		require.True(t, strings.HasSuffix(copyright, "\nFiles: *\nCopyright: nope\nLicense: Apache-2.0\n"), copyright)
+	})
+
+	t.Run("packaged", func(t *testing.T) {
+		info := exampleInfo()
+		info.License = "MIT"
+		info.Contents = append(info.Contents, &files.Content{
+			Destination: "/usr/share/doc/foo/copyright",
+			Data:        []byte("custom\n"),
+		})
+		require.Equal(t, "custom\n", string(extractFileFromTar(t, dataTar(t, info), "./usr/share/doc/foo/copyright")))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		info := exampleInfo()
+		info.License = "MIT"
+		info.Deb.DisableCopyrightFile = true
+		require.NotContains(t, tarContents(t, dataTar(t, info)), "./usr/share/doc/foo/copyright")
+		require.NotContains(t, tarContents(t, dataTar(t, exampleInfo())), "./usr/share/doc/foo/copyright")
+	})
+
+	info.Deb.LicenseFile = filepath.Join(t.TempDir(), "missing")
+	var target nfpm.ValidationError
+	require.ErrorAs(t, Default.Package(info, io.Discard), &target)
+	require.Equal(t, "missing_file", target.Code)
+}
+
+func TestRaw(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "foo.sh")
+	require.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\r\necho foo\r\n"), 0o644))
+	require.NoError(t, os.Chmod(src, 0o777))
+
+	info := exampleInfo()
+	info.Umask = 0o022
+	info.DefAttr = nfpm.DefAttr{FileMode: 0o600}
+	info.ModePolicies = []nfpm.ModePolicy{{Path: "/usr/share/raw/**", ForbidBits: 0o002, Enforce: nfpm.ModePolicyFix}}
+	info.Contents = append(info.Contents,
+		&files.Content{Source: src, Destination: "/usr/share/raw/foo.sh", Raw: true},
+		&files.Content{Source: src, Destination: "/usr/share/raw/bar.sh", NormalizeEOL: files.EOLLF},
+		&files.Content{
+			Destination: "/usr/share/raw/foo.txt",
+			Data:        []byte("foo\r\n"),
+			FileInfo:    &files.ContentFileInfo{Mode: 0o666},
+			Raw:         true,
+		},
+	)
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())))
+	dataTar := inflate(t, "data.tar.gz", extractFileFromAr(t, deb.Bytes(), "data.tar.gz"))
+
+	require.Equal(t, "#!/bin/sh\r\necho foo\r\n", string(extractFileFromTar(t, dataTar, "./usr/share/raw/foo.sh")))
+	require.Equal(t, int64(0o777), extractFileHeaderFromTar(t, dataTar, "./usr/share/raw/foo.sh").Mode)
+	require.Equal(t, "foo\r\n", string(extractFileFromTar(t, dataTar, "./usr/share/raw/foo.txt")))
+	require.Equal(t, int64(0o666), extractFileHeaderFromTar(t, dataTar, "./usr/share/raw/foo.txt").Mode)
+
+	// the same file without raw is transformed as usual
+	require.Equal(t, "#!/bin/sh\necho foo\n", string(extractFileFromTar(t, dataTar, "./usr/share/raw/bar.sh")))
+	require.Equal(t, int64(0o600), extractFileHeaderFromTar(t, dataTar, "./usr/share/raw/bar.sh").Mode)
+
+	info.Contents[len(info.Contents)-1].NormalizeEOL = files.EOLLF
+	require.ErrorIs(t, Default.Package(info, io.Discard), files.ErrInvalidRaw)
+}
+
+func TestUdeb(t *testing.T) {
+	info := exampleInfo()
+	info.Deb.PackageType = "udeb"
+	info.Changelog = "../testdata/changelog.yaml"
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+
+	controlTar := inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz"))
+	require.ElementsMatch(t, []string{"./control"}, tarContents(t, controlTar))
+	control := string(extractFileFromTar(t, controlTar, "./control"))
+	require.Contains(t, control, "\nPackage-Type: udeb\n")
+
+	dataTar := inflate(t, "data.tar.gz", extractFileFromAr(t, deb.Bytes(), "data.tar.gz"))
+	require.NotContains(t, tarContents(t, dataTar), "./usr/share/doc/foo/changelog.Debian.gz")
+	require.Contains(t, tarContents(t, dataTar), "./etc/fake/fake.conf")
+
+	t.Run("deb", func(t *testing.T) {
+		info := exampleInfo()
+		info.Deb.PackageType = "deb"
+
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+
+		controlTar := inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz"))
+		require.Contains(t, tarContents(t, controlTar), "./md5sums")
+		require.Contains(t, tarContents(t, controlTar), "./conffiles")
+		require.NotContains(t, string(extractFileFromTar(t, controlTar, "./control")), "Package-Type:")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		info := exampleInfo()
+		info.Deb.PackageType = "rpm"
+		require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidPackageType)
+	})
+}
+
+func TestDebRenames(t *testing.T) {
+	info := exampleInfo()
+	info.Renames = []nfpm.Rename{{From: "foo-old", UpToVersion: "1.0.0"}}
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+
+	control := string(extractFileFromTar(t, inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./control"))
+	require.Contains(t, control, "\nReplaces: svn, foo-old (<< 1.0.0)\n")
+	require.Contains(t, control, "\nProvides: bzr, foo-old (= 1.0.0)\n")
+	require.Contains(t, control, "\nConflicts: zsh, foo-old (<< 1.0.0)\n")
+}
+
+func TestFormatDescription(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		description string
+		expected    string
+	}{
+		"single line": {
+			description: "Foo does things",
+			expected:    "Foo does things",
+		},
+		"surrounding whitespace": {
+			description: "\n  Foo does things  \n\n",
+			expected:    "Foo does things",
+		},
+		"paragraphs": {
+			description: "Foo does things\nIt does them well.\n\nAnd fast,\nvery fast.\n\n\nThe end.",
+			expected:    "Foo does things\n It does them well.\n .\n And fast,\n very fast.\n .\n .\n The end.",
+		},
+		"whitespace only lines": {
+			description: "Foo does things\n \t \nThe end.",
+			expected:    "Foo does things\n .\n The end.",
+		},
+		"carriage returns": {
+			description: "Foo does things\r\nIt does them well.\r\n\r\nThe end.\r\n",
+			expected:    "Foo does things\n It does them well.\n .\n The end.",
+		},
+		"verbatim lines": {
+			description: "Foo does things\nUsage:\n  foo --bar   \n  foo --baz",
+			expected:    "Foo does things\n Usage:\n   foo --bar\n   foo --baz",
+		},
+		"long lines": {
+			description: "Foo does things\n" + strings.Repeat("a", 100_000),
+			expected:    "Foo does things\n " + strings.Repeat("a", 100_000),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, formatDescription(testCase.description))
+		})
+	}
+}
+
 func TestDEBConventionalFileName(t *testing.T) {
 	info := &nfpm.Info{
 		Name:       "testpkg",
@@ -612,6 +1162,54 @@ func TestDebChangelogData(t *testing.T) {
 	require.Equal(t, goldenChangelog, string(dataChangelog))
 }
 
+func TestDebChangelogSorted(t *testing.T) {
+	info := &nfpm.Info{
+		Name:      "changelog-test",
+		Changelog: "../testdata/changelog_unsorted.yaml",
+	}
+	changelog, err := formatChangelog(info)
+	require.NoError(t, err)
+
+	var versions []string
+	for _, match := range regexp.MustCompile(`(?m)^changelog-test \(([^)]+)\)`).FindAllStringSubmatch(changelog, -1) {
+		versions = append(versions, match[1])
+	}
+	// dpkg sorts a `^` after a `.`
+	require.Equal(t, []string{
+		"2.0.0^git20240101-1",
+		"2.0.0.1-1",
+		"1.10.0-1",
+		"1.2.0-1",
+		"1.2.0~rc1-1",
+		"1.1.0-1",
+		"1.1.0-1",
+		"1.0.0-1",
+	}, versions)
+	require.Less(t, strings.Index(changelog, "second 1.1.0 entry"), strings.Index(changelog, "first 1.1.0 entry"))
+}
+
+func TestDebChangelogDefaultVersion(t *testing.T) {
+	changelog := filepath.Join(t.TempDir(), "changelog.yaml")
+	require.NoError(t, os.WriteFile(changelog, []byte(`
+- packager: "Carlos A Becker <pkg@carlosbecker.com>"
+  date: "2024-01-01T10:00:00Z"
+  changes:
+    - note: "no version"
+`), 0o600))
+
+	info := &nfpm.Info{
+		Name:       "changelog-test",
+		Version:    "1.0.0",
+		Epoch:      "2",
+		Prerelease: "rc1",
+		Release:    "4",
+		Changelog:  changelog,
+	}
+	formatted, err := formatChangelog(info)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(formatted, "changelog-test (2:1.0.0~rc1-4)"), formatted)
+}
+
 func TestDebNoChangelogDataWithoutChangelogConfigured(t *testing.T) {
 	info := &nfpm.Info{
 		Name:        "no-changelog-test",
@@ -631,6 +1229,29 @@ func TestDebNoChangelogDataWithoutChangelogConfigured(t *testing.T) {
 	require.False(t, tarContains(t, inflate(t, dataTarballName, dataTarball), changelogName))
 }
 
+func TestDebChangelogDataDisabled(t *testing.T) {
+	info := &nfpm.Info{
+		Name:        "changelog-test",
+		Arch:        "amd64",
+		Description: "This package has a changelog but does not install it.",
+		Version:     "1.0.0",
+		Changelog:   "../testdata/changelog.yaml",
+		Maintainer:  "maintainer",
+		Overridables: nfpm.Overridables{
+			Deb: nfpm.Deb{DisableChangelogFile: true},
+		},
+	}
+	err := nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
+	require.NoError(t, err)
+
+	dataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+
+	changelogName := fmt.Sprintf("/usr/share/doc/%s/changelog.Debian.gz", info.Name)
+
+	require.False(t, tarContains(t, inflate(t, dataTarballName, dataTarball), changelogName))
+}
+
 func TestDebTriggers(t *testing.T) {
 	info := &nfpm.Info{
 		Name:        "no-triggers-test",
@@ -654,7 +1275,7 @@ func TestDebTriggers(t *testing.T) {
 	err := nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
 	require.NoError(t, err)
 
-	controlTarGz, err := createControl(0, []byte{}, info)
+	controlTarGz, err := createControl(0, nil, info)
 	require.NoError(t, err)
 
 	controlTriggers := extractFileFromTar(t, inflate(t, "gz", controlTarGz), "triggers")
@@ -694,7 +1315,7 @@ func TestDebNoTriggersInControlIfNoneProvided(t *testing.T) {
 	err := nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
 	require.NoError(t, err)
 
-	controlTarGz, err := createControl(0, []byte{}, info)
+	controlTarGz, err := createControl(0, nil, info)
 	require.NoError(t, err)
 
 	require.False(t, tarContains(t, inflate(t, "gz", controlTarGz), "triggers"))
@@ -741,6 +1362,40 @@ func TestSymlink(t *testing.T) {
 	require.Equal(t, symlinkTarget, packagedSymlinkHeader.Linkname)
 }
 
+func TestDedup(t *testing.T) {
+	info := exampleInfo()
+	info.Dedup = true
+	info.Contents = []*files.Content{
+		{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/a.conf"},
+		{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/b.conf"},
+		{Source: "../testdata/whatever.conf", Destination: "/usr/share/foo/c.conf"},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: files.TypeConfig},
+		{Source: "../testdata/fake", Destination: "/usr/bin/fake"},
+	}
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())))
+
+	dataTar := inflate(t, findDataTarball(t, deb.Bytes()), extractFileFromAr(t, deb.Bytes(), findDataTarball(t, deb.Bytes())))
+	conf, err := os.ReadFile("../testdata/whatever.conf")
+	require.NoError(t, err)
+	require.Equal(t, conf, extractFileFromTar(t, dataTar, "/usr/share/foo/a.conf"))
+	require.Equal(t, conf, extractFileFromTar(t, dataTar, "/etc/foo.conf"))
+	for _, name := range []string{"/usr/share/foo/b.conf", "/usr/share/foo/c.conf"} {
+		header := extractFileHeaderFromTar(t, dataTar, name)
+		require.Equal(t, uint8(tar.TypeLink), header.Typeflag, name)
+		require.Equal(t, "./usr/share/foo/a.conf", header.Linkname, name)
+		require.Zero(t, header.Size, name)
+	}
+	require.Equal(t, uint8(tar.TypeReg), extractFileHeaderFromTar(t, dataTar, "/usr/bin/fake").Typeflag)
+
+	control := extractFileFromTar(t, inflate(t, "gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz")), "./md5sums")
+	for _, name := range []string{"a.conf", "b.conf", "c.conf"} {
+		require.Contains(t, string(control), "  ./usr/share/foo/"+name+"\n")
+	}
+}
+
 func TestEnsureRelativePrefixInTarballs(t *testing.T) {
 	info := exampleInfo()
 	info.Contents = []*files.Content{
@@ -749,6 +1404,15 @@ func TestEnsureRelativePrefixInTarballs(t *testing.T) {
 			Destination: "/usr/share/doc/fake/fake.txt",
 			Type:        files.TypeSymlink,
 		},
+		{
+			Source:      "../testdata/fake",
+			Destination: "usr/bin//fake",
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "./etc/./foo//foo.conf",
+			Type:        files.TypeConfig,
+		},
 	}
 	info.Changelog = "../testdata/changelog.yaml"
 	err := nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
@@ -803,6 +1467,57 @@ func TestMD5Sums(t *testing.T) {
 	}
 }
 
+func TestExtraChecksums(t *testing.T) {
+	info := exampleInfo()
+	info.Changelog = "../testdata/changelog.yaml"
+	info.Deb.ExtraChecksums = []string{"sha512", "sha256"}
+
+	err := nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName)
+	require.NoError(t, err)
+
+	dataTarball, sums, instSize, tarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+
+	controlTarGz, err := createControl(instSize, sums, info)
+	require.NoError(t, err)
+
+	control := inflate(t, "gz", controlTarGz)
+	dataTar := inflate(t, tarballName, dataTarball)
+	md5Lines := strings.Split(strings.TrimRight(string(extractFileFromTar(t, control, "./md5sums")), "\n"), "\n")
+
+	for member, newHash := range map[string]func() hash.Hash{
+		"./sha256sums": sha256.New,
+		"./sha512sums": sha512.New,
+	} {
+		t.Run(member, func(t *testing.T) {
+			lines := strings.Split(strings.TrimRight(string(extractFileFromTar(t, control, member)), "\n"), "\n")
+			require.Len(t, lines, len(md5Lines))
+
+			for i, line := range lines {
+				parts := strings.Fields(line)
+				require.Len(t, parts, 2)
+
+				sum, fileName := parts[0], parts[1]
+				require.Equal(t, strings.Fields(md5Lines[i])[1], fileName)
+
+				digest := newHash()
+				_, err = digest.Write(extractFileFromTar(t, dataTar, fileName))
+				require.NoError(t, err)
+				require.Equal(t, sum, hex.EncodeToString(digest.Sum(nil)))
+			}
+		})
+	}
+}
+
+func TestExtraChecksumsInvalid(t *testing.T) {
+	info := exampleInfo()
+	info.Deb.ExtraChecksums = []string{"sha1"}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+	_, _, _, _, err := createDataTarball(info)
+	require.EqualError(t, err, "unknown checksum algorithm: sha1")
+}
+
 func TestDirectories(t *testing.T) {
 	info := exampleInfo()
 	info.Contents = []*files.Content{
@@ -930,6 +1645,8 @@ func testRelativePathPrefixInTar(tb testing.TB, tarFile []byte) {
 		}
 		require.NoError(tb, err)
 		require.True(tb, strings.HasPrefix(hdr.Name, "./"), "%s does not start with './'", hdr.Name)
+		require.NotContains(tb, hdr.Name, "//")
+		require.NotContains(tb, hdr.Name[1:], "/./")
 	}
 }
 
@@ -950,7 +1667,7 @@ func TestDebsigsSignature(t *testing.T) {
 	message := io.MultiReader(bytes.NewReader(debBinary),
 		bytes.NewReader(controlTarGz), bytes.NewReader(dataTarball))
 
-	err = sign.PGPVerify(message, signature, "../internal/sign/testdata/pubkey.asc")
+	err = sign.PGPVerify(message, signature, sign.Key{File: "../internal/sign/testdata/pubkey.asc"})
 	require.NoError(t, err)
 }
 
@@ -969,7 +1686,7 @@ func TestDebsigsSignatureError(t *testing.T) {
 func TestDebsigsSignatureCallback(t *testing.T) {
 	info := exampleInfo()
 	info.Deb.Signature.SignFn = func(r io.Reader) ([]byte, error) {
-		return sign.PGPArmoredDetachSignWithKeyID(r, "../internal/sign/testdata/privkey.asc", "hunter2", nil)
+		return sign.PGPArmoredDetachSignWithKeyID(r, sign.Key{File: "../internal/sign/testdata/privkey.asc"}, "hunter2", nil)
 	}
 
 	var deb bytes.Buffer
@@ -984,7 +1701,7 @@ func TestDebsigsSignatureCallback(t *testing.T) {
 	message := io.MultiReader(bytes.NewReader(debBinary),
 		bytes.NewReader(controlTarGz), bytes.NewReader(dataTarball))
 
-	err = sign.PGPVerify(message, signature, "../internal/sign/testdata/pubkey.asc")
+	err = sign.PGPVerify(message, signature, sign.Key{File: "../internal/sign/testdata/pubkey.asc"})
 	require.NoError(t, err)
 }
 
@@ -1001,7 +1718,7 @@ func TestDpkgSigSignature(t *testing.T) {
 
 	signature := extractFileFromAr(t, deb.Bytes(), "_gpgbuilder")
 
-	err = sign.PGPReadMessage(signature, "../internal/sign/testdata/pubkey.asc")
+	err = sign.PGPReadMessage(signature, sign.Key{File: "../internal/sign/testdata/pubkey.asc"})
 	require.NoError(t, err)
 }
 
@@ -1021,7 +1738,7 @@ func TestDpkgSigSignatureError(t *testing.T) {
 func TestDpkgSigSignatureCallback(t *testing.T) {
 	info := exampleInfo()
 	info.Deb.Signature.SignFn = func(r io.Reader) ([]byte, error) {
-		return sign.PGPClearSignWithKeyID(r, "../internal/sign/testdata/privkey.asc", "hunter2", nil)
+		return sign.PGPClearSignWithKeyID(r, sign.Key{File: "../internal/sign/testdata/privkey.asc"}, "hunter2", nil)
 	}
 	info.Deb.Signature.Method = "dpkg-sig"
 	info.Deb.Signature.Signer = "bob McRobert"
@@ -1032,7 +1749,7 @@ func TestDpkgSigSignatureCallback(t *testing.T) {
 
 	signature := extractFileFromAr(t, deb.Bytes(), "_gpgbuilder")
 
-	err = sign.PGPReadMessage(signature, "../internal/sign/testdata/pubkey.asc")
+	err = sign.PGPReadMessage(signature, sign.Key{File: "../internal/sign/testdata/pubkey.asc"})
 	require.NoError(t, err)
 }
 
@@ -1148,6 +1865,34 @@ func TestCompressionAlgorithms(t *testing.T) {
 	}
 }
 
+func TestUncompressedDataTar(t *testing.T) {
+	info := exampleInfo()
+	info.Deb.Compression = "none"
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+
+	// dpkg requires the members in this order, with the data tarball named
+	// after its compression.
+	reader := ar.NewReader(bytes.NewReader(deb.Bytes()))
+	var names []string
+	for {
+		hdr, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	require.Equal(t, []string{"debian-binary", "control.tar.gz", "data.tar"}, names)
+
+	// the member is a plain tar archive, readable without decompressing it
+	dataTar := extractFileFromAr(t, deb.Bytes(), "data.tar")
+	expected, err := os.ReadFile("../testdata/fake")
+	require.NoError(t, err)
+	require.Equal(t, expected, extractFileFromTar(t, dataTar, "/usr/bin/fake"))
+}
+
 func TestIgnoreUnrelatedFiles(t *testing.T) {
 	info := exampleInfo()
 	info.Contents = files.Contents{
@@ -1156,24 +1901,43 @@ func TestIgnoreUnrelatedFiles(t *testing.T) {
 			Destination: "/usr/bin/fake",
 			Packager:    "rpm",
 		},
+		{
+			Destination: "/var/log/whatever",
+			Type:        files.TypeRPMGhost,
+		},
+	}
+
+	require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+	dataTarball, _, _, tarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+
+	contents := tarContents(t, inflate(t, tarballName, dataTarball))
+	require.Empty(t, contents)
+}
+
+func TestRPMDocFilesAreRegularFiles(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = files.Contents{
 		{
 			Source:      "../testdata/whatever.conf",
-			Destination: "/usr/share/doc/fake/fake.txt",
-			Type:        files.TypeRPMLicence,
+			Destination: "/usr/share/doc/fake/changes.txt",
+			Type:        files.TypeRPMDoc,
 		},
 		{
 			Source:      "../testdata/whatever.conf",
-			Destination: "/etc/fake/fake.conf",
+			Destination: "/usr/share/doc/fake/LICENSE",
 			Type:        files.TypeRPMLicense,
 		},
 		{
 			Source:      "../testdata/whatever.conf",
-			Destination: "/etc/fake/fake2.conf",
-			Type:        files.TypeRPMReadme,
+			Destination: "/usr/share/doc/fake/NOTICE",
+			Type:        files.TypeRPMLicence,
 		},
 		{
-			Destination: "/var/log/whatever",
-			Type:        files.TypeRPMDoc,
+			Source:      "../testdata/whatever.conf",
+			Destination: "/usr/share/doc/fake/README",
+			Type:        files.TypeRPMReadme,
 		},
 	}
 
@@ -1182,8 +1946,12 @@ func TestIgnoreUnrelatedFiles(t *testing.T) {
 	dataTarball, _, _, tarballName, err := createDataTarball(info)
 	require.NoError(t, err)
 
-	contents := tarContents(t, inflate(t, tarballName, dataTarball))
-	require.Empty(t, contents)
+	dataTar := inflate(t, tarballName, dataTarball)
+	expected, err := os.ReadFile("../testdata/whatever.conf")
+	require.NoError(t, err)
+	for _, name := range []string{"changes.txt", "LICENSE", "NOTICE", "README"} {
+		require.Equal(t, expected, extractFileFromTar(t, dataTar, "/usr/share/doc/fake/"+name))
+	}
 }
 
 func extractFileFromTar(tb testing.TB, tarFile []byte, filename string) []byte {
@@ -1400,6 +2168,22 @@ func extractFileFromAr(tb testing.TB, arFile []byte, filename string) []byte {
 	return nil
 }
 
+func arMembers(tb testing.TB, arFile []byte) []string {
+	tb.Helper()
+
+	var names []string
+	tr := ar.NewReader(bytes.NewReader(arFile))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break // End of archive
+		}
+		require.NoError(tb, err)
+		names = append(names, hdr.Name)
+	}
+	return names
+}
+
 func TestEmptyButRequiredDebFields(t *testing.T) {
 	item := nfpm.WithDefaults(&nfpm.Info{
 		Name:    "foo",
@@ -1425,6 +2209,21 @@ func TestArches(t *testing.T) {
 		})
 	}
 
+	for goarm, expected := range map[string]string{
+		"5": "armel",
+		"6": "armel",
+		"7": "armhf",
+	} {
+		goarm, expected := goarm, expected
+		t.Run("goarm"+goarm, func(t *testing.T) {
+			info := exampleInfo()
+			info.Arch = "arm"
+			info.Goarm = goarm
+			info = ensureValidArch(nfpm.WithDefaults(info))
+			require.Equal(t, expected, info.Arch)
+		})
+	}
+
 	t.Run("override", func(t *testing.T) {
 		info := exampleInfo()
 		info.Deb.Arch = "foo64"
@@ -1506,3 +2305,800 @@ func (zrc *zstdReadCloser) Close() error {
 
 	return nil
 }
+
+func TestDirectoryModes(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/sudoers.d/foo",
+		},
+	}
+	info.DirectoryModes = map[string]files.ContentFileInfo{
+		"/etc/sudoers.d": {Mode: 0o750},
+	}
+
+	require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+	deflatedDataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+	dataTarball := inflate(t, dataTarballName, deflatedDataTarball)
+
+	h := extractFileHeaderFromTar(t, dataTarball, "/etc/sudoers.d")
+	require.Equal(t, byte(tar.TypeDir), h.Typeflag)
+	require.Equal(t, int64(0o750), h.Mode)
+	require.Equal(t, "root", h.Uname)
+	require.Equal(t, "root", h.Gname)
+
+	h = extractFileHeaderFromTar(t, dataTarball, "/etc")
+	require.Equal(t, int64(0o755), h.Mode)
+}
+
+func TestTemplate(t *testing.T) {
+	t.Setenv("NFPM_TEMPLATE_BUILDER", "ci")
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/templates/version.conf.tmpl",
+			Destination: "/etc/foo/version.conf",
+			Type:        files.TypeTemplate,
+		},
+	}
+
+	require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+	deflatedDataTarball, md5sums, instSize, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+	dataTarball := inflate(t, dataTarballName, deflatedDataTarball)
+
+	expected := "name=foo\nversion=1.0.0\narch=amd64\nbuilder=ci\n"
+	require.Equal(t, expected, string(extractFileFromTar(t, dataTarball, "/etc/foo/version.conf")))
+	require.Equal(t, int64(len(expected)), instSize)
+	require.Equal(t, int64(len(expected)), extractFileHeaderFromTar(t, dataTarball, "/etc/foo/version.conf").Size)
+	require.Equal(t, fmt.Sprintf("%x  ./etc/foo/version.conf\n", md5.Sum([]byte(expected))), md5sums["md5"].String())
+}
+
+func TestContentOrder(t *testing.T) {
+	newInfo := func(order string) *nfpm.Info {
+		info := exampleInfo()
+		info.ContentOrder = order
+		info.Contents = []*files.Content{
+			{
+				Source:      "../testdata/fake",
+				Destination: "/usr/bin/fake",
+			},
+			{
+				Source:      "../testdata/whatever.conf",
+				Destination: "/etc/foo/bar",
+			},
+			{
+				Destination: "/etc/foo",
+				Type:        files.TypeDir,
+			},
+		}
+		return info
+	}
+
+	for order, expected := range map[string][]string{
+		nfpm.ContentOrderConfig: {
+			"./usr/",
+			"./usr/bin/",
+			"./usr/bin/fake",
+			"./etc/",
+			"./etc/foo/",
+			"./etc/foo/bar",
+		},
+		nfpm.ContentOrderSorted: {
+			"./etc/",
+			"./etc/foo/",
+			"./etc/foo/bar",
+			"./usr/",
+			"./usr/bin/",
+			"./usr/bin/fake",
+		},
+	} {
+		order, expected := order, expected
+		t.Run(order, func(t *testing.T) {
+			var builds [][]byte
+			for i := 0; i < 2; i++ {
+				info := newInfo(order)
+				require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+				dataTarball, _, _, tarballName, err := createDataTarball(info)
+				require.NoError(t, err)
+
+				tarball := inflate(t, tarballName, dataTarball)
+				require.Equal(t, expected, tarContents(t, tarball))
+				builds = append(builds, tarball)
+			}
+			require.Equal(t, builds[0], builds[1])
+		})
+	}
+}
+
+func TestMergeDir(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Destination: "/etc/foo.d",
+			Type:        files.TypeMergeDir,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo.d/foo.conf",
+		},
+		{
+			Source:      "../testdata/fake",
+			Destination: "/usr/bin/fake",
+		},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+	dataTarball, _, _, tarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"./etc/foo.d/foo.conf",
+		"./usr/",
+		"./usr/bin/",
+		"./usr/bin/fake",
+	}, tarContents(t, inflate(t, tarballName, dataTarball)))
+}
+
+func TestVerify(t *testing.T) {
+	for name, setup := range map[string]func(info *nfpm.Info){
+		"default": func(*nfpm.Info) {},
+		"xz":      func(info *nfpm.Info) { info.Deb.Compression = "xz" },
+		"zstd":    func(info *nfpm.Info) { info.Deb.Compression = "zstd" },
+		"zstd threads": func(info *nfpm.Info) {
+			info.Deb.Compression = "zstd"
+			info.CompressionOptions.Threads = 4
+		},
+		"xz blocks": func(info *nfpm.Info) {
+			info.Deb.Compression = "xz"
+			info.CompressionOptions.BlockSize = 16
+		},
+		"none":      func(info *nfpm.Info) { info.Deb.Compression = "none" },
+		"changelog": func(info *nfpm.Info) { info.Changelog = "../testdata/changelog.yaml" },
+		"debsign":   func(info *nfpm.Info) { info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.asc" },
+		"dpkg-sig": func(info *nfpm.Info) {
+			info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+			info.Deb.Signature.Method = "dpkg-sig"
+		},
+		"signature type": func(info *nfpm.Info) {
+			info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+			info.Deb.Signature.Type = "maint"
+		},
+		"binary key files": func(info *nfpm.Info) { info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.gpg" },
+	} {
+		setup := setup
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.Deb.Signature.KeyPassphrase = "hunter2"
+			setup(info)
+
+			var deb bytes.Buffer
+			require.NoError(t, Default.Package(info, &deb))
+			require.NoError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())))
+		})
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	info := exampleInfo()
+	info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+	info.Deb.Signature.KeyPassphrase = "hunter2"
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+
+	dataTarball := extractFileFromAr(t, deb.Bytes(), findDataTarball(t, deb.Bytes()))
+	offset := bytes.Index(deb.Bytes(), dataTarball) + len(dataTarball)/2
+	corrupted := bytes.Clone(deb.Bytes())
+	corrupted[offset] ^= 0xff
+	require.Error(t, Default.Verify(info, bytes.NewReader(corrupted)))
+
+	t.Run("signature", func(t *testing.T) {
+		signature := extractFileFromAr(t, deb.Bytes(), "_gpgorigin")
+		resigned := bytes.Replace(deb.Bytes(), signature, bytes.Repeat([]byte{'A'}, len(signature)), 1)
+		require.ErrorContains(t, Default.Verify(info, bytes.NewReader(resigned)), "verifying signature")
+	})
+
+	t.Run("missing content", func(t *testing.T) {
+		info := exampleInfo()
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+		info.Contents = append(info.Contents, &files.Content{Source: "../testdata/fake", Destination: "/usr/bin/missing"})
+		require.EqualError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())), "/usr/bin/missing: missing from package")
+	})
+}
+
+func TestResign(t *testing.T) {
+	for name, setup := range map[string]func(info *nfpm.Info){
+		"debsign": func(*nfpm.Info) {},
+		"dpkg-sig": func(info *nfpm.Info) {
+			info.Deb.Signature.Method = "dpkg-sig"
+		},
+		"binary key files": func(info *nfpm.Info) { info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.gpg" },
+	} {
+		setup := setup
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			var unsigned bytes.Buffer
+			require.NoError(t, Default.Package(info, &unsigned))
+
+			info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+			info.Deb.Signature.KeyPassphrase = "hunter2"
+			setup(info)
+			var resigned bytes.Buffer
+			require.NoError(t, Default.Resign(info, bytes.NewReader(unsigned.Bytes()), &resigned))
+			require.NoError(t, Default.Verify(info, bytes.NewReader(resigned.Bytes())))
+		})
+	}
+
+	t.Run("replace", func(t *testing.T) {
+		info := exampleInfo()
+		info.Deb.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+		info.Deb.Signature.KeyPassphrase = "hunter2"
+		var signed bytes.Buffer
+		require.NoError(t, Default.Package(info, &signed))
+
+		info.Deb.Signature.Type = "maint"
+		var resigned bytes.Buffer
+		require.NoError(t, Default.Resign(info, bytes.NewReader(signed.Bytes()), &resigned))
+		require.NoError(t, Default.Verify(info, bytes.NewReader(resigned.Bytes())))
+		require.NotContains(t, arMembers(t, resigned.Bytes()), "_gpgorigin")
+		require.Contains(t, arMembers(t, resigned.Bytes()), "_gpgmaint")
+	})
+}
+
+func TestDisownStandardDirs(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		standardDirs []string
+		expected     []string
+	}{
+		"default": {
+			expected: []string{
+				"./usr/bin/fake",
+				"./usr/share/foo/",
+				"./usr/share/foo/whatever.conf",
+			},
+		},
+		"override": {
+			standardDirs: []string{"/usr", "/usr/share/foo/"},
+			expected: []string{
+				"./usr/bin/",
+				"./usr/bin/fake",
+				"./usr/share/",
+				"./usr/share/foo/whatever.conf",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.DisownStandardDirs = true
+			info.StandardDirs = testCase.standardDirs
+			info.Contents = []*files.Content{
+				{
+					Source:      "../testdata/fake",
+					Destination: "/usr/bin/fake",
+				},
+				{
+					Source:      "../testdata/whatever.conf",
+					Destination: "/usr/share/foo/whatever.conf",
+				},
+			}
+			require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+			dataTarball, _, _, tarballName, err := createDataTarball(info)
+			require.NoError(t, err)
+
+			require.Equal(t, testCase.expected, tarContents(t, inflate(t, tarballName, dataTarball)))
+		})
+	}
+}
+
+func TestWithScriptPreamble(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		script, expected string
+	}{
+		"shebang": {
+			script:   "#!/bin/bash\necho foo\n",
+			expected: "#!/bin/bash\nset -e\nexport DEBIAN_FRONTEND=noninteractive\necho foo\n",
+		},
+		"no shebang": {
+			script:   "echo foo\n",
+			expected: "#!/bin/sh\nset -e\nexport DEBIAN_FRONTEND=noninteractive\necho foo\n",
+		},
+		"env shebang": {
+			script:   "#!/usr/bin/env sh\necho foo\n",
+			expected: "#!/usr/bin/env sh\nset -e\nexport DEBIAN_FRONTEND=noninteractive\necho foo\n",
+		},
+		"already set": {
+			script:   "#!/bin/sh\nset -eu\nDEBIAN_FRONTEND=noninteractive\nexport DEBIAN_FRONTEND\necho foo\n",
+			expected: "#!/bin/sh\nset -eu\nDEBIAN_FRONTEND=noninteractive\nexport DEBIAN_FRONTEND\necho foo\n",
+		},
+		"errexit": {
+			script:   "#!/bin/sh\nset -o errexit\necho foo\n",
+			expected: "#!/bin/sh\nexport DEBIAN_FRONTEND=noninteractive\nset -o errexit\necho foo\n",
+		},
+		"other interpreter": {
+			script:   "#!/usr/bin/perl\nprint \"foo\";\n",
+			expected: "#!/usr/bin/perl\nprint \"foo\";\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result := withScriptPreamble(testCase.script, "/bin/sh")
+			require.Equal(t, testCase.expected, result)
+			require.Equal(t, result, withScriptPreamble(result, "/bin/sh"))
+		})
+	}
+}
+
+func TestScriptPreamble(t *testing.T) {
+	noShebang := filepath.Join(t.TempDir(), "prerm")
+	require.NoError(t, os.WriteFile(noShebang, []byte("echo prerm\n"), 0o755))
+
+	info := exampleInfo()
+	info.Deb.ScriptPreamble = true
+	info.Scripts.PreInstall = "../testdata/scripts/preinstall.sh"
+	info.Scripts.PreRemove = noShebang
+	info.Deb.Scripts.Templates = "../testdata/scripts/preinstall.sh"
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	control := inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz"))
+
+	require.Equal(t, "#!/bin/bash\nset -e\nexport DEBIAN_FRONTEND=noninteractive\n\necho \"Preinstall\" > /dev/null\n", string(extractFileFromTar(t, control, "./preinst")))
+	require.Equal(t, "#!/bin/sh\nset -e\nexport DEBIAN_FRONTEND=noninteractive\necho prerm\n", string(extractFileFromTar(t, control, "./prerm")))
+	templates, err := os.ReadFile(info.Deb.Scripts.Templates)
+	require.NoError(t, err)
+	require.Equal(t, string(templates), string(extractFileFromTar(t, control, "./templates")))
+	require.NotContains(t, tarContents(t, control), "./postinst")
+
+	t.Run("disabled", func(t *testing.T) {
+		info := exampleInfo()
+		info.Scripts.PreRemove = noShebang
+
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+		control := inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz"))
+		require.Equal(t, "echo prerm\n", string(extractFileFromTar(t, control, "./prerm")))
+	})
+}
+
+func TestAttrScripts(t *testing.T) {
+	attrs := &files.ContentFileInfo{Attrs: []string{"immutable"}}
+
+	t.Run("without scripts", func(t *testing.T) {
+		info := exampleInfo()
+		info.Contents = []*files.Content{
+			{Source: "../testdata/whatever.conf", Destination: "/etc/fake/fake.conf", Type: files.TypeConfig, FileInfo: attrs},
+		}
+		require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+		controlTarGz, err := createControl(0, nil, info)
+		require.NoError(t, err)
+		control := inflate(t, "control.tar.gz", controlTarGz)
+
+		require.Equal(t, "#!/bin/sh\n\nchattr +i '/etc/fake/fake.conf' || :\n", string(extractFileFromTar(t, control, "postinst")))
+		require.Equal(t, "#!/bin/sh\n\nchattr -i '/etc/fake/fake.conf' >/dev/null 2>&1 || :\n", string(extractFileFromTar(t, control, "prerm")))
+		require.NotContains(t, tarContents(t, control), "./preinst")
+	})
+
+	t.Run("with scripts", func(t *testing.T) {
+		info := exampleInfo()
+		info.Contents = []*files.Content{
+			{Source: "../testdata/whatever.conf", Destination: "/etc/fake/fake.conf", Type: files.TypeConfig, FileInfo: attrs},
+		}
+		info.Scripts.PostInstall = "../testdata/scripts/postinstall.sh"
+		info.Scripts.PreRemove = "../testdata/scripts/preremove.sh"
+		require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+		controlTarGz, err := createControl(0, nil, info)
+		require.NoError(t, err)
+		control := inflate(t, "control.tar.gz", controlTarGz)
+
+		postinst, err := os.ReadFile(info.Scripts.PostInstall)
+		require.NoError(t, err)
+		require.Equal(t, files.AppendScriptlet(string(postinst), "chattr +i '/etc/fake/fake.conf' || :\n"), string(extractFileFromTar(t, control, "postinst")))
+
+		prerm, err := os.ReadFile(info.Scripts.PreRemove)
+		require.NoError(t, err)
+		require.Equal(t, files.AppendScriptlet(string(prerm), "chattr -i '/etc/fake/fake.conf' >/dev/null 2>&1 || :\n"), string(extractFileFromTar(t, control, "prerm")))
+	})
+}
+
+func TestRemoveOnPurge(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Destination: "/var/lib/fake",
+			Type:        files.TypeDir,
+			RemoveOn:    files.RemoveOnPurge,
+			FileInfo:    &files.ContentFileInfo{Owner: "fake", Group: "fake", Mode: 0o750},
+		},
+		{Destination: "/var/log/fake", Type: files.TypeDir},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+	dataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+	contents := tarContents(t, inflate(t, dataTarballName, dataTarball))
+	require.Contains(t, contents, "./var/log/fake/")
+	require.NotContains(t, contents, "./var/lib/fake/")
+
+	controlTarGz, err := createControl(0, nil, info)
+	require.NoError(t, err)
+	control := inflate(t, "control.tar.gz", controlTarGz)
+
+	require.Equal(t, "#!/bin/sh\n\nmkdir -p '/var/lib/fake'\nchown 'fake:fake' '/var/lib/fake'\nchmod 0750 '/var/lib/fake'\n", string(extractFileFromTar(t, control, "postinst")))
+	require.Equal(t, "#!/bin/sh\n\nif [ \"$1\" = \"purge\" ] ; then\nrmdir '/var/lib/fake' >/dev/null 2>&1 || :\nfi\n", string(extractFileFromTar(t, control, "postrm")))
+	require.NotContains(t, tarContents(t, control), "./prerm")
+}
+
+func TestPurge(t *testing.T) {
+	newInfo := func(purge nfpm.DebPurge) *nfpm.Info {
+		info := exampleInfo()
+		info.Contents = []*files.Content{
+			{Destination: "/etc/fake/fake.conf", Type: files.TypeConfig, Data: []byte("a = b\n")},
+			{Destination: "/usr/bin/fake", Data: []byte("fake")},
+			{
+				Destination: "/var/lib/fake",
+				Type:        files.TypeDir,
+				RemoveOn:    files.RemoveOnPurge,
+				FileInfo:    &files.ContentFileInfo{Owner: "fake", Group: "fake", Mode: 0o750},
+			},
+		}
+		info.Deb.Purge = purge
+		require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+		return info
+	}
+	postrm := func(info *nfpm.Info) string {
+		controlTarGz, err := createControl(0, nil, info)
+		require.NoError(t, err)
+		return string(extractFileFromTar(t, inflate(t, "control.tar.gz", controlTarGz), "postrm"))
+	}
+
+	t.Run("conffiles and dirs", func(t *testing.T) {
+		info := newInfo(nfpm.DebPurge{Conffiles: true, Dirs: []string{"/var/cache/fake/", "/var/lib/fake/state"}})
+		require.Equal(t, `#!/bin/sh
+
+if [ "$1" = "purge" ] ; then
+rm -f '/etc/fake/fake.conf' '/etc/fake/fake.conf.dpkg-dist' '/etc/fake/fake.conf.dpkg-new' '/etc/fake/fake.conf.dpkg-old'
+rm -rf '/var/cache/fake'
+rm -rf '/var/lib/fake/state'
+rmdir '/var/lib/fake' >/dev/null 2>&1 || :
+fi
+`, postrm(info))
+	})
+
+	t.Run("keep modified", func(t *testing.T) {
+		info := newInfo(nfpm.DebPurge{Conffiles: true, KeepModified: true})
+		sum := fmt.Sprintf("%x", md5.Sum([]byte("a = b\n"))) // nolint:gosec
+		require.Equal(t, `#!/bin/sh
+
+if [ "$1" = "purge" ] ; then
+if [ "$(md5sum < '/etc/fake/fake.conf' 2>/dev/null | cut -d ' ' -f 1)" = "`+sum+`" ] ; then rm -f '/etc/fake/fake.conf' ; fi
+rm -f '/etc/fake/fake.conf.dpkg-dist' '/etc/fake/fake.conf.dpkg-new'
+rmdir '/var/lib/fake' >/dev/null 2>&1 || :
+fi
+`, postrm(info))
+	})
+
+	t.Run("script", func(t *testing.T) {
+		info := newInfo(nfpm.DebPurge{Dirs: []string{"/var/lib/fake"}})
+		script := filepath.Join(t.TempDir(), "postrm.sh")
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/bash\necho removed\n"), 0o755))
+		info.Scripts.PostRemove = script
+		require.Equal(t, `#!/bin/bash
+echo removed
+
+if [ "$1" = "purge" ] ; then
+rm -rf '/var/lib/fake'
+rmdir '/var/lib/fake' >/dev/null 2>&1 || :
+fi
+`, postrm(info))
+	})
+
+	t.Run("invalid dirs", func(t *testing.T) {
+		for _, dir := range []string{"/", "/var", "var/lib/fake", "/var/.."} {
+			info := exampleInfo()
+			info.Deb.Purge.Dirs = []string{dir}
+			require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidPurge, dir)
+		}
+	})
+}
+
+func TestGhostFiles(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Destination: "/var/lib/fake/state",
+			Type:        files.TypeRPMGhost,
+			Touch:       true,
+			FileInfo:    &files.ContentFileInfo{Owner: "fake", Group: "fake", Mode: 0o600},
+		},
+		{Destination: "/var/log/fake.log", Type: files.TypeRPMGhost},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+	// ghost files are not shipped, only their parents are
+	dataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+	contents := tarContents(t, inflate(t, dataTarballName, dataTarball))
+	require.Contains(t, contents, "./var/lib/fake/")
+	require.NotContains(t, contents, "./var/lib/fake/state")
+	require.NotContains(t, contents, "./var/log/fake.log")
+
+	// and only the ones setting touch are created by postinst
+	controlTarGz, err := createControl(0, nil, info)
+	require.NoError(t, err)
+	control := inflate(t, "control.tar.gz", controlTarGz)
+	require.Equal(t, `#!/bin/sh
+
+if [ ! -e '/var/lib/fake/state' ] ; then
+  touch '/var/lib/fake/state'
+  chown 'fake:fake' '/var/lib/fake/state'
+  chmod 0600 '/var/lib/fake/state'
+fi
+`, string(extractFileFromTar(t, control, "postinst")))
+	require.NotContains(t, tarContents(t, control), "./postrm")
+}
+
+func TestAlternatives(t *testing.T) {
+	info := exampleInfo()
+	info.Alternatives = []nfpm.Alternative{
+		{Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin/fake", Priority: 50},
+		{Name: "fake.conf", Link: "/etc/fake.conf", Path: "/etc/fake/fake.conf"},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+	controlTarGz, err := createControl(0, nil, info)
+	require.NoError(t, err)
+	control := inflate(t, "control.tar.gz", controlTarGz)
+
+	require.Equal(t, `#!/bin/sh
+
+update-alternatives --install /usr/bin/editor editor /usr/bin/fake 50
+update-alternatives --install /etc/fake.conf fake.conf /etc/fake/fake.conf 0
+`, string(extractFileFromTar(t, control, "postinst")))
+	require.Equal(t, `#!/bin/sh
+
+if [ "$1" != "upgrade" ] ; then
+update-alternatives --remove editor /usr/bin/fake
+update-alternatives --remove fake.conf /etc/fake/fake.conf
+fi
+`, string(extractFileFromTar(t, control, "prerm")))
+}
+
+func TestDataContent(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Destination: "/usr/bin/generated",
+			Data:        []byte("#!/bin/sh\necho generated\n"),
+			FileInfo:    &files.ContentFileInfo{Mode: 0o755},
+		},
+		{Destination: "/etc/generated.conf", Data: []byte("key = value\n"), Type: files.TypeConfig},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(buf.Bytes())))
+
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+	dataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+	data := inflate(t, dataTarballName, dataTarball)
+	require.Equal(t, "#!/bin/sh\necho generated\n", string(extractFileFromTar(t, data, "/usr/bin/generated")))
+	require.Equal(t, int64(0o755), extractFileHeaderFromTar(t, data, "/usr/bin/generated").Mode)
+	require.Equal(t, "key = value\n", string(extractFileFromTar(t, data, "/etc/generated.conf")))
+	require.Equal(t, int64(0o644), extractFileHeaderFromTar(t, data, "/etc/generated.conf").Mode)
+	require.Equal(t, "/etc/generated.conf\n", string(conffiles(info)))
+}
+
+func TestScriptShell(t *testing.T) {
+	info := exampleInfo()
+	info.ScriptShell = "/usr/bin/busybox-sh"
+	info.Deb.ScriptPreamble = true
+	info.Alternatives = []nfpm.Alternative{
+		{Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin/fake", Priority: 50},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+	controlTarGz, err := createControl(0, nil, info)
+	require.NoError(t, err)
+	control := inflate(t, "control.tar.gz", controlTarGz)
+
+	require.Equal(t, `#!/usr/bin/busybox-sh
+set -e
+export DEBIAN_FRONTEND=noninteractive
+
+update-alternatives --install /usr/bin/editor editor /usr/bin/fake 50
+`, string(extractFileFromTar(t, control, "postinst")))
+	require.True(t, strings.HasPrefix(string(extractFileFromTar(t, control, "prerm")), "#!/usr/bin/busybox-sh\n"))
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	info := exampleInfo()
+	info.MTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	info.Snapshot = &nfpm.Snapshot{Commit: "abcdef"}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+	require.Equal(t, "foo_1.0.0~snapshot.20240101.abcdef_amd64.deb", Default.ConventionalFileName(info))
+
+	version := info.Version + "~" + info.Prerelease
+	require.Negative(t, vercmp.Deb(version, "1.0.0"))
+	require.Negative(t, vercmp.Deb(version, "1.0.1"))
+	require.Positive(t, vercmp.Deb(version, "0.9.9"))
+	require.Positive(t, vercmp.Deb(version, "1.0.0~snapshot.20231231.fedcba"))
+	require.Positive(t, vercmp.Deb("1.0.0", "1.0.0~rc1"))
+}
+
+func TestNumericOwnership(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/fake",
+			Destination: "/usr/bin/fake",
+			FileInfo:    &files.ContentFileInfo{Owner: "1000", Group: "1001"},
+		},
+		{
+			Destination: "/var/lib/fake",
+			Type:        files.TypeDir,
+			FileInfo:    &files.ContentFileInfo{Owner: "65532", Group: "nogroup"},
+		},
+	}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+
+	dataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+
+	headers := map[string]*tar.Header{}
+	tr := tar.NewReader(bytes.NewReader(inflate(t, dataTarballName, dataTarball)))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		headers[hdr.Name] = hdr
+	}
+
+	bin := headers["./usr/bin/fake"]
+	require.NotNil(t, bin)
+	require.Equal(t, 1000, bin.Uid)
+	require.Equal(t, 1001, bin.Gid)
+	require.Empty(t, bin.Uname)
+	require.Empty(t, bin.Gname)
+
+	dir := headers["./var/lib/fake/"]
+	require.NotNil(t, dir)
+	require.Equal(t, 65532, dir.Uid)
+	require.Empty(t, dir.Uname)
+	require.Equal(t, 0, dir.Gid)
+	require.Equal(t, "nogroup", dir.Gname)
+}
+
+func TestDefAttr(t *testing.T) {
+	info := exampleInfo()
+	info.DefAttr = nfpm.DefAttr{FileMode: 0o640, DirMode: 0o750, Owner: "foo", Group: "bar"}
+	info.Contents = []*files.Content{
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/default.conf"},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo/explicit.conf",
+			FileInfo:    &files.ContentFileInfo{Mode: 0o600, Owner: "baz"},
+		},
+		{Destination: "/var/lib/foo", Type: files.TypeDir},
+		{Source: "../testdata/something", Destination: "/usr/share/foo", Type: files.TypeTree},
+	}
+
+	require.NoError(t, nfpm.PrepareForPackager(withChangelogIfRequested(info), packagerName))
+
+	deflatedDataTarball, _, _, dataTarballName, err := createDataTarball(info)
+	require.NoError(t, err)
+	dataTarball := inflate(t, dataTarballName, deflatedDataTarball)
+
+	for name, expected := range map[string]struct {
+		mode         int64
+		owner, group string
+	}{
+		"/etc/foo/default.conf":  {0o640, "foo", "bar"},
+		"/etc/foo/explicit.conf": {0o600, "baz", "bar"},
+		"/var/lib/foo":           {0o750, "foo", "bar"},
+		"/usr/share/foo/a":       {0o640, "foo", "bar"},
+		"/usr/share/foo/c":       {0o750, "foo", "bar"},
+		"/usr/share/foo/c/d":     {0o640, "foo", "bar"},
+		// implicit directories are left as is
+		"/etc": {0o755, "root", "root"},
+	} {
+		h := extractFileHeaderFromTar(t, dataTarball, name)
+		require.Equal(t, expected.mode, h.Mode, name)
+		require.Equal(t, expected.owner, h.Uname, name)
+		require.Equal(t, expected.group, h.Gname, name)
+	}
+}
+
+func TestMetaPackage(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = nil
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())))
+
+	dataTarballName := findDataTarball(t, deb.Bytes())
+	dataTarball := inflate(t, dataTarballName, extractFileFromAr(t, deb.Bytes(), dataTarballName))
+	_, err := tar.NewReader(bytes.NewReader(dataTarball)).Next()
+	require.ErrorIs(t, err, io.EOF)
+
+	controlTarball := inflate(t, "gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz"))
+	control := string(extractFileFromTar(t, controlTarball, "./control"))
+	require.Contains(t, control, "Installed-Size: 0\n")
+	require.Contains(t, control, "Depends: bash\n")
+	require.Empty(t, extractFileFromTar(t, controlTarball, "./md5sums"))
+}
+
+func TestShlibs(t *testing.T) {
+	info := exampleInfo()
+	info.Epoch = "1"
+	info.Release = "2"
+	info.AutoDeps = true
+	info.Contents = files.Contents{
+		{Source: "../testdata/shlibs/foo", Destination: "/usr/bin/foo"},
+		{Source: "../testdata/shlibs/libfoo.so.1.2.3", Destination: "/usr/lib/libfoo.so.1.2.3"},
+	}
+
+	var deb bytes.Buffer
+	require.NoError(t, Default.Package(info, &deb))
+	controlTar := inflate(t, "control.tar.gz", extractFileFromAr(t, deb.Bytes(), "control.tar.gz"))
+	require.Equal(t, "libfoo 1 foo (>= 1:1.0.0)\n", string(extractFileFromTar(t, controlTar, "./shlibs")))
+	require.NotContains(t, string(extractFileFromTar(t, controlTar, "./control")), "libbar")
+	require.NoError(t, Default.Verify(info, bytes.NewReader(deb.Bytes())))
+}
+
+func TestExportDebianDir(t *testing.T) {
+	info := exampleInfo()
+	info.Changelog = "../testdata/changelog.yaml"
+	info.Version = "1.0.0"
+	dir := filepath.Join(t.TempDir(), "debian")
+	require.NoError(t, ExportDebianDir(info, dir))
+
+	for _, name := range []string{"control", "changelog", "conffiles"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			golden := "testdata/debian/" + name + ".golden"
+			if *update {
+				require.NoError(t, os.WriteFile(golden, data, 0o600))
+			}
+			bts, err := os.ReadFile(golden) //nolint:gosec
+			require.NoError(t, err)
+			require.Equal(t, string(bts), string(data))
+		})
+	}
+
+	t.Run("same control as the package", func(t *testing.T) {
+		var deb bytes.Buffer
+		require.NoError(t, Default.Package(info, &deb))
+		members, err := readArMembers(&deb)
+		require.NoError(t, err)
+		control, err := readControlFile(members["control.tar.gz"])
+		require.NoError(t, err)
+		exported, err := os.ReadFile(filepath.Join(dir, "control"))
+		require.NoError(t, err)
+		require.Equal(t, string(control), string(exported))
+	})
+
+	t.Run("without changelog and conffiles", func(t *testing.T) {
+		info := exampleInfo()
+		info.Contents = info.Contents[:1]
+		dir := t.TempDir()
+		require.NoError(t, ExportDebianDir(info, dir))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "control", entries[0].Name())
+	})
+}
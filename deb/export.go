@@ -0,0 +1,65 @@
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/goreleaser/nfpm/v2"
+)
+
+// ExportDebianDir writes to dir the control, changelog and conffiles files the
+// deb package of info would hold, so that they can be compared with the
+// debian directory of a package built with debhelper. The control file is
+// the one of the binary package, with the Installed-Size of its contents,
+// the changelog is left out if info has none, and so are the conffiles if
+// the package has none. The given info is left as is.
+func ExportDebianDir(info *nfpm.Info, dir string) error {
+	if err := validatePackageType(info.Deb.PackageType); err != nil {
+		return err
+	}
+	info, err := prepareInfo(info)
+	if err != nil {
+		return err
+	}
+	Default.SetPackagerDefaults(info)
+	if err := validateTags(info.Deb.Tags); err != nil {
+		return err
+	}
+
+	_, instSize, err := fillDataTar(info, io.Discard)
+	if err != nil {
+		return err
+	}
+	var control bytes.Buffer
+	if err := writeControl(&control, controlData{
+		Info:          info,
+		InstalledSize: instSize / 1024,
+	}); err != nil {
+		return err
+	}
+
+	debianFiles := map[string][]byte{"control": control.Bytes()}
+	if info.Changelog != "" {
+		changelog, err := formatChangelog(info)
+		if err != nil {
+			return err
+		}
+		debianFiles["changelog"] = []byte(changelog)
+	}
+	if confs := conffiles(info); !isUdeb(info) && len(bytes.TrimSpace(confs)) > 0 {
+		debianFiles["conffiles"] = confs
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, data := range debianFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil { //nolint:gosec
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+	}
+	return nil
+}
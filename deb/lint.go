@@ -0,0 +1,76 @@
+package deb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+)
+
+// debAreas are the archive areas of debian and ubuntu a deb section may be
+// prefixed with, e.g. contrib/net.
+// nolint: gochecknoglobals
+var debAreas = []string{"main", "contrib", "non-free", "non-free-firmware", "restricted", "universe", "multiverse"}
+
+// debSections are the sections of the debian archive, see
+// https://www.debian.org/doc/debian-policy/ch-archive.html#sections.
+// nolint: gochecknoglobals
+var debSections = []string{
+	"admin", "cli-mono", "comm", "database", "debian-installer", "debug", "devel", "doc", "editors",
+	"education", "electronics", "embedded", "fonts", "games", "gnome", "gnu-r", "gnustep", "graphics",
+	"hamradio", "haskell", "httpd", "interpreters", "introspection", "java", "javascript", "kde",
+	"kernel", "libdevel", "libs", "lisp", "localization", "mail", "math", "metapackages", "misc",
+	"net", "news", "ocaml", "oldlibs", "otherosfs", "perl", "php", "python", "ruby", "rust",
+	"science", "shells", "sound", "tasks", "tex", "text", "utils", "vcs", "video", "web", "x11",
+	"xfce", "zope",
+}
+
+// Lints returns the lints of the section and the priority of the packages,
+// which must be in the vocabulary of debian.
+func (*Deb) Lints() []nfpm.Lint {
+	return []nfpm.Lint{
+		{
+			Name:        "deb-section",
+			Description: "deb sections outside of the vocabulary of debian",
+			Check:       lintSection,
+		},
+		{
+			Name:        "deb-priority",
+			Description: "deb priorities outside of the vocabulary of debian, or deprecated",
+			Check:       lintPriority,
+		},
+	}
+}
+
+func lintSection(info *nfpm.Info) string {
+	section := info.Section
+	if category, ok := info.ResolveCategory(); ok && section == "" {
+		section = category.Section
+	}
+	if section == "" {
+		return ""
+	}
+	area, name, ok := strings.Cut(section, "/")
+	if !ok {
+		area, name = "main", section
+	}
+	if !slices.Contains(debAreas, area) {
+		return fmt.Sprintf("unknown deb archive area %q in section %q", area, section)
+	}
+	if !slices.Contains(debSections, name) {
+		return fmt.Sprintf("unknown deb section %q", section)
+	}
+	return ""
+}
+
+func lintPriority(info *nfpm.Info) string {
+	switch info.Priority {
+	case "", "required", "important", "standard", "optional":
+		return ""
+	case "extra":
+		return `deb priority "extra" is deprecated, use "optional" instead`
+	default:
+		return fmt.Sprintf("unknown deb priority %q, must be one of required, important, standard or optional", info.Priority)
+	}
+}
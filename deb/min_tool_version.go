@@ -0,0 +1,44 @@
+package deb
+
+import (
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+)
+
+// compressionVersions are the dpkg versions that introduced the compressions
+// of the data tarball, and compressionFallbacks the compressions used instead
+// by older versions, see nfpm.Info.MinToolVersion.
+// nolint: gochecknoglobals
+var (
+	compressionVersions = map[string]string{
+		"xz":   "1.15.6",
+		"zstd": "1.21.18",
+	}
+	compressionFallbacks = map[string]string{
+		"xz":   "gzip",
+		"zstd": "xz",
+	}
+)
+
+// applyMinToolVersion falls back to the compression of the data tarball the
+// oldest dpkg version the package must install with supports, warning about
+// it.
+func applyMinToolVersion(info *nfpm.Info) {
+	minVersion, ok := info.MinToolVersion[packagerName]
+	if !ok {
+		return
+	}
+	compression := info.Deb.Compression
+	for {
+		version, ok := compressionVersions[compression]
+		if !ok || vercmp.Deb(minVersion, version) >= 0 {
+			break
+		}
+		compression = compressionFallbacks[compression]
+	}
+	if compression != info.Deb.Compression {
+		warning.Printf("dpkg %s does not support %s data tarballs, using %s instead", minVersion, info.Deb.Compression, compression)
+		info.Deb.Compression = compression
+	}
+}
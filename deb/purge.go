@@ -0,0 +1,76 @@
+package deb
+
+import (
+	"crypto/md5" // nolint:gas
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// ErrInvalidPurge happens when a directory of the purge branch is not an
+// absolute path below a top-level directory.
+var ErrInvalidPurge = errors.New("invalid purge")
+
+func validatePurge(purge nfpm.DebPurge) error {
+	for _, dir := range purge.Dirs {
+		clean := path.Clean(dir)
+		if !path.IsAbs(dir) || strings.Count(clean, "/") < 2 {
+			return fmt.Errorf("%w: %q: dirs must be absolute paths below a top-level directory", ErrInvalidPurge, dir)
+		}
+	}
+	return nil
+}
+
+// purgeScriptlet returns the commands of the purge branch of postrm, see
+// nfpm.DebPurge, which remove the conffiles and the state directories.
+func purgeScriptlet(info *nfpm.Info) (string, error) {
+	purge := info.Deb.Purge
+	var lines []string
+	if purge.Conffiles {
+		for _, content := range info.Contents {
+			if content.Type != files.TypeConfig && content.Type != files.TypeConfigNoReplace {
+				continue
+			}
+			dst := files.NormalizeAbsoluteFilePath(content.Destination)
+			if !purge.KeepModified {
+				lines = append(lines, "rm -f "+removedConffiles(dst, false))
+				continue
+			}
+			data, err := content.ReadAll()
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines,
+				fmt.Sprintf(`if [ "$(md5sum < %s 2>/dev/null | cut -d ' ' -f 1)" = "%x" ] ; then rm -f %s ; fi`,
+					files.ShellQuote(dst), md5.Sum(data), files.ShellQuote(dst)), // nolint:gosec
+				"rm -f "+removedConffiles(dst, true),
+			)
+		}
+	}
+	for _, dir := range purge.Dirs {
+		lines = append(lines, "rm -rf "+files.ShellQuote(path.Clean(dir)))
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// removedConffiles returns the quoted paths of the conffile dst and of the
+// copies dpkg may have left next to it that are removed on purge: all of them
+// but the conffile itself and its .dpkg-old copy, the previous version of the
+// admin, if the modified conffiles are kept.
+func removedConffiles(dst string, keepModified bool) string {
+	paths := []string{dst + ".dpkg-dist", dst + ".dpkg-new"}
+	if !keepModified {
+		paths = append([]string{dst}, append(paths, dst+".dpkg-old")...)
+	}
+	for i, p := range paths {
+		paths[i] = files.ShellQuote(p)
+	}
+	return strings.Join(paths, " ")
+}
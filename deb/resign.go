@@ -0,0 +1,88 @@
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/blakesmith/ar"
+	"github.com/goreleaser/nfpm/v2"
+)
+
+// Resign writes the deb package read from r to w with a new _gpg* signature
+// member, made with the signature of the given info, in place of the former
+// one. The other members are copied as is, and the modification time of
+// debian-binary is used as the date of dpkg-sig signatures.
+func (*Deb) Resign(info *nfpm.Info, r io.Reader, w io.Writer) error {
+	info = info.Copy()
+
+	type member struct {
+		name    string
+		body    []byte
+		modTime time.Time
+	}
+
+	var members []member
+	byName := map[string][]byte{}
+	rd := ar.NewReader(r)
+	for {
+		header, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading ar archive: %w", err)
+		}
+		body, err := io.ReadAll(rd)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+		if int64(len(body)) != header.Size {
+			return fmt.Errorf("%s: truncated", header.Name)
+		}
+		byName[header.Name] = body
+		if strings.HasPrefix(header.Name, "_gpg") {
+			continue
+		}
+		members = append(members, member{name: header.Name, body: body, modTime: header.ModTime})
+	}
+
+	if len(members) == 0 || members[0].name != "debian-binary" {
+		return errors.New("missing debian-binary")
+	}
+	controlTarGz, ok := byName["control.tar.gz"]
+	if !ok {
+		return errors.New("missing control.tar.gz")
+	}
+	dataName := dataTarballName(byName)
+	if dataName == "" {
+		return errors.New("missing data tarball")
+	}
+
+	mtime := members[0].modTime
+	if info.MTime.IsZero() {
+		info.MTime = mtime
+	}
+	sig, sigType, err := doSign(info, members[0].body, controlTarGz, byName[dataName])
+	if err != nil {
+		return err
+	}
+
+	aw := ar.NewWriter(w)
+	if err := aw.WriteGlobalHeader(); err != nil {
+		return fmt.Errorf("cannot write ar header to deb file: %w", err)
+	}
+	for _, m := range members {
+		if err := addArFile(aw, m.name, m.body, m.modTime); err != nil {
+			return fmt.Errorf("cannot add %s to deb: %w", m.name, err)
+		}
+	}
+	if err := addArFile(aw, "_gpg"+sigType, sig, mtime); err != nil {
+		return &nfpm.ErrSigningFailure{
+			Err: fmt.Errorf("add signature to ar file: %w", err),
+		}
+	}
+	return nil
+}
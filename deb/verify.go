@@ -0,0 +1,410 @@
+package deb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5" // nolint:gas
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/blakesmith/ar"
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Verify reads back a deb package created with the given info and checks that
+// its archives extract cleanly, that it holds all of the contents, that their
+// digests match the ones recorded in md5sums and that its signature, if any,
+// is valid. The contents are prepared for the packager like Package does.
+func (*Deb) Verify(info *nfpm.Info, deb io.Reader) error {
+	info, err := prepareInfo(info)
+	if err != nil {
+		return err
+	}
+
+	members, err := readArMembers(deb)
+	if err != nil {
+		return err
+	}
+
+	debianBinary, ok := members["debian-binary"]
+	if !ok {
+		return errors.New("missing debian-binary")
+	}
+	controlTarGz, ok := members["control.tar.gz"]
+	if !ok {
+		return errors.New("missing control.tar.gz")
+	}
+	dataName := dataTarballName(members)
+	if dataName == "" {
+		return errors.New("missing data tarball")
+	}
+	dataTarball := members[dataName]
+
+	md5sums, err := readMD5Sums(controlTarGz)
+	if err != nil {
+		return fmt.Errorf("control.tar.gz: %w", err)
+	}
+
+	entries, digests, err := readDataTarball(dataName, dataTarball)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dataName, err)
+	}
+
+	for name, digest := range digests {
+		sum, ok := md5sums[name]
+		if !ok {
+			return fmt.Errorf("%s: missing from md5sums", name)
+		}
+		if sum != digest {
+			return fmt.Errorf("%s: md5sum mismatch: expected %s, got %s", name, sum, digest)
+		}
+	}
+	for name := range md5sums {
+		if _, ok := digests[name]; !ok {
+			return fmt.Errorf("%s: listed in md5sums but not in %s", name, dataName)
+		}
+	}
+
+	if err := verifyContents(info.Contents, entries); err != nil {
+		return err
+	}
+
+	if !info.Deb.Signature.HasKey() || info.Deb.Signature.SignFn != nil {
+		// without a key there is nothing to verify the signature with.
+		return nil
+	}
+	return verifySignature(info, members, debianBinary, controlTarGz, dataTarball)
+}
+
+// metadataFieldPrefix prefixes the control fields Info.Metadata is
+// recorded in.
+const metadataFieldPrefix = "Metadata-"
+
+// ReadMetadata returns the Info.Metadata recorded in the control file of the
+// deb package read from r.
+func (*Deb) ReadMetadata(deb io.Reader) (map[string]string, error) {
+	fields, err := readControlFields(deb)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	for field, value := range fields {
+		if name, ok := strings.CutPrefix(field, metadataFieldPrefix); ok {
+			metadata[name] = value
+		}
+	}
+	return metadata, nil
+}
+
+// InstalledSize returns the Installed-Size recorded in the control file of
+// the deb package read from r, in bytes.
+func (*Deb) InstalledSize(deb io.Reader) (int64, error) {
+	fields, err := readControlFields(deb)
+	if err != nil {
+		return 0, err
+	}
+
+	value, ok := fields["Installed-Size"]
+	if !ok {
+		return 0, errors.New("missing Installed-Size")
+	}
+	kib, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Installed-Size: %q", value)
+	}
+	return kib * 1024, nil
+}
+
+// ReadIdentity returns the Package, Version and Architecture recorded in the
+// control file of the deb package read from r.
+func (*Deb) ReadIdentity(deb io.Reader) (nfpm.Identity, error) {
+	fields, err := readControlFields(deb)
+	if err != nil {
+		return nfpm.Identity{}, err
+	}
+
+	identity := nfpm.Identity{
+		Name:    fields["Package"],
+		Version: fields["Version"],
+		Arch:    fields["Architecture"],
+	}
+	if identity.Name == "" || identity.Version == "" || identity.Arch == "" {
+		return nfpm.Identity{}, errors.New("missing Package, Version or Architecture")
+	}
+	return identity, nil
+}
+
+// readControlFields returns the values of the fields of the control file of
+// the deb package read from r, by name. The continuation lines of multiline
+// fields, such as Description, are left out.
+func readControlFields(deb io.Reader) (map[string]string, error) {
+	members, err := readArMembers(deb)
+	if err != nil {
+		return nil, err
+	}
+	controlTarGz, ok := members["control.tar.gz"]
+	if !ok {
+		return nil, errors.New("missing control.tar.gz")
+	}
+	control, err := readControlFile(controlTarGz)
+	if err != nil {
+		return nil, fmt.Errorf("control.tar.gz: %w", err)
+	}
+
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(control))
+	for scanner.Scan() {
+		field, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok || strings.HasPrefix(field, " ") || strings.HasPrefix(field, "\t") {
+			continue
+		}
+		fields[field] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func readControlFile(controlTarGz []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(controlTarGz))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close() // nolint: errcheck
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing control")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if files.NormalizeAbsoluteFilePath(header.Name) == "/control" {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+func readArMembers(deb io.Reader) (map[string][]byte, error) {
+	r := ar.NewReader(deb)
+	members := map[string][]byte{}
+	for {
+		header, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return members, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading ar archive: %w", err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+		if int64(len(body)) != header.Size {
+			return nil, fmt.Errorf("%s: truncated", header.Name)
+		}
+		members[header.Name] = body
+	}
+}
+
+func dataTarballName(members map[string][]byte) string {
+	for _, name := range []string{"data.tar.gz", "data.tar.xz", "data.tar.zst", "data.tar"} {
+		if _, ok := members[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func readMD5Sums(controlTarGz []byte) (map[string]string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(controlTarGz))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close() // nolint: errcheck
+
+	md5sums := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return md5sums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", header.Name, err)
+		}
+		if files.NormalizeAbsoluteFilePath(header.Name) != "/md5sums" {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			sum, name, ok := strings.Cut(scanner.Text(), "  ")
+			if !ok {
+				return nil, fmt.Errorf("invalid md5sums line: %q", scanner.Text())
+			}
+			md5sums[files.NormalizeAbsoluteFilePath(name)] = sum
+		}
+	}
+}
+
+func readDataTarball(name string, dataTarball []byte) (map[string]*tar.Header, map[string]string, error) {
+	var r io.Reader = bytes.NewReader(dataTarball)
+	switch name {
+	case "data.tar.gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close() // nolint: errcheck
+		r = gz
+	case "data.tar.xz":
+		xzr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = xzr
+	case "data.tar.zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	entries := map[string]*tar.Header{}
+	digests := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		digest := md5.New() // nolint:gas
+		if _, err := io.Copy(digest, tr); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", header.Name, err)
+		}
+		name := files.NormalizeAbsoluteFilePath(header.Name)
+		entries[name] = header
+		switch header.Typeflag {
+		case tar.TypeReg:
+			digests[name] = fmt.Sprintf("%x", digest.Sum(nil))
+		case tar.TypeLink:
+			target, ok := digests[files.NormalizeAbsoluteFilePath(header.Linkname)]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: hard link to missing file %s", header.Name, header.Linkname)
+			}
+			digests[name] = target
+		}
+	}
+
+	// compressed streams are only checked once they are read until the end.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, nil, err
+	}
+	return entries, digests, nil
+}
+
+func verifyContents(contents files.Contents, entries map[string]*tar.Header) error {
+	for _, content := range contents {
+		if content.IsUnowned() {
+			continue
+		}
+		var typeflag byte
+		switch content.Type {
+		case files.TypeRPMGhost:
+			continue
+		case files.TypeDir, files.TypeImplicitDir:
+			typeflag = tar.TypeDir
+		case files.TypeSymlink:
+			typeflag = tar.TypeSymlink
+		case files.TypeHardlink:
+			typeflag = tar.TypeLink
+		default:
+			typeflag = tar.TypeReg
+		}
+
+		name := files.NormalizeAbsoluteFilePath(content.Destination)
+		header, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("%s: missing from package", name)
+		}
+		if header.Typeflag != typeflag {
+			return fmt.Errorf("%s: expected tar type %q, got %q", name, typeflag, header.Typeflag)
+		}
+		if typeflag == tar.TypeSymlink && header.Linkname != content.Source {
+			return fmt.Errorf("%s: expected symlink to %s, got %s", name, content.Source, header.Linkname)
+		}
+		if typeflag == tar.TypeLink && files.NormalizeAbsoluteFilePath(header.Linkname) != content.Source {
+			return fmt.Errorf("%s: expected hard link to %s, got %s", name, content.Source, header.Linkname)
+		}
+	}
+	return nil
+}
+
+func verifySignature(info *nfpm.Info, members map[string][]byte, debianBinary, controlTarGz, dataTarball []byte) error {
+	sigType := info.Deb.Signature.Type
+	if sigType == "" {
+		sigType = "origin"
+		if info.Deb.Signature.Method == "dpkg-sig" {
+			sigType = "builder"
+		}
+	}
+
+	sig, ok := members["_gpg"+sigType]
+	if !ok {
+		return fmt.Errorf("missing _gpg%s signature", sigType)
+	}
+
+	if info.Deb.Signature.Method != "dpkg-sig" {
+		data := readDebsignData(debianBinary, controlTarGz, dataTarball)
+		if err := sign.PGPVerify(data, sig, sign.SignatureKey(info.Deb.Signature.PackageSignature)); err != nil {
+			return fmt.Errorf("verifying signature: %w", err)
+		}
+		return nil
+	}
+
+	plaintext, err := sign.PGPVerifyClearSigned(sig, sign.SignatureKey(info.Deb.Signature.PackageSignature))
+	if err != nil {
+		return fmt.Errorf("verifying signature: %w", err)
+	}
+	data, err := readDpkgSigData(info, debianBinary, controlTarGz, dataTarball)
+	if err != nil {
+		return err
+	}
+	expected, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	// only the digests of the files are compared, as the signing date is not
+	// known when the package is not reproducible.
+	if !bytes.Equal(signedFiles(plaintext), signedFiles(expected)) {
+		return errors.New("signed digests do not match the package")
+	}
+	return nil
+}
+
+func signedFiles(data []byte) []byte {
+	_, lines, _ := bytes.Cut(data, []byte("\nFiles:\n"))
+	return bytes.TrimSpace(lines)
+}
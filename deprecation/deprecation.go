@@ -5,27 +5,41 @@ import (
 	"fmt"
 	"io"
 	"os"
-)
-
-type prefixed struct{ io.Writer }
 
-func (p prefixed) Write(b []byte) (int, error) {
-	return p.Writer.Write(append([]byte("DEPRECATION WARNING: "), b...))
-}
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+)
 
-var Noticer io.Writer = prefixed{os.Stderr}
+var Noticer io.Writer = warning.Prefixed{Writer: os.Stderr, Prefix: "DEPRECATION WARNING: "}
 
-// Print prints the given string to the Noticer.
+// Print prints the given string to the Noticer, or logs it as a warning of
+// the logger of the warnings, see nfpm.SetLogger, if one is set.
 func Print(s string) {
+	if log(s) {
+		return
+	}
 	fmt.Fprint(Noticer, s)
 }
 
-// Println printslns the given string to the Noticer.
+// Println printslns the given string to the Noticer, see Print.
 func Println(s string) {
+	if log(s) {
+		return
+	}
 	fmt.Fprintln(Noticer, s)
 }
 
-// Printf printfs the given string to the Noticer.
+// Printf printfs the given string to the Noticer, see Print.
 func Printf(format string, a ...interface{}) {
+	if log(fmt.Sprintf(format, a...)) {
+		return
+	}
 	fmt.Fprintf(Noticer, format, a...)
 }
+
+func log(s string) bool {
+	if warning.Logger() == nil {
+		return false
+	}
+	warning.Warn(s, "deprecation", true)
+	return true
+}
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 	"github.com/stretchr/testify/require"
 )
 
 func TestNotice(t *testing.T) {
 	var b bytes.Buffer
-	Noticer = prefixed{&b}
+	previous := Noticer
+	Noticer = warning.Prefixed{Writer: &b, Prefix: "DEPRECATION WARNING: "}
+	t.Cleanup(func() { Noticer = previous })
 	Print("blah\n")
 	Printf("blah: %v\n", true)
 	Println("foobar")
@@ -0,0 +1,84 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidAttr happens when a content sets a file attribute that is not
+// one of the known attributes or that cannot be set on its type.
+var ErrInvalidAttr = errors.New("invalid file attribute")
+
+// attrFlags maps the file attributes that can be set in ContentFileInfo.Attrs
+// to their chattr(1) flags.
+// nolint: gochecknoglobals
+var attrFlags = map[string]string{
+	"append-only":      "a",
+	"immutable":        "i",
+	"no-atime":         "A",
+	"no-copy-on-write": "C",
+	"no-dump":          "d",
+	"synchronous":      "S",
+}
+
+func validateAttrs(content *Content) error {
+	if content.FileInfo == nil || len(content.FileInfo.Attrs) == 0 {
+		return nil
+	}
+	switch content.Type {
+	case TypeSymlink, TypeTree, TypeMergeDir:
+		return fmt.Errorf("%w: %s: attributes cannot be set on contents of type %s", ErrInvalidAttr, content, content.Type)
+	}
+	for _, attr := range content.FileInfo.Attrs {
+		if _, ok := attrFlags[attr]; !ok {
+			return fmt.Errorf("%w: %s: unknown attribute %q", ErrInvalidAttr, content, attr)
+		}
+	}
+	return nil
+}
+
+// AttrScriptlets returns the shell snippets that set the attributes of the
+// contents with chattr(1) once they are installed, and that clear them again
+// before the contents are upgraded or removed, as no package format can store
+// them. Both are empty if no content has any attributes.
+func AttrScriptlets(contents Contents) (set, clear string) {
+	var setLines, clearLines []string
+	for _, content := range contents {
+		if content.FileInfo == nil || len(content.FileInfo.Attrs) == 0 {
+			continue
+		}
+
+		flags := make([]string, 0, len(content.FileInfo.Attrs))
+		for _, attr := range content.FileInfo.Attrs {
+			flags = append(flags, attrFlags[attr])
+		}
+		sort.Strings(flags)
+
+		path := ShellQuote(strings.TrimRight(content.Destination, "/"))
+		setLines = append(setLines, fmt.Sprintf("chattr +%s %s || :", strings.Join(flags, ""), path))
+		clearLines = append(clearLines, fmt.Sprintf("chattr -%s %s >/dev/null 2>&1 || :", strings.Join(flags, ""), path))
+	}
+	if len(setLines) == 0 {
+		return "", ""
+	}
+
+	return strings.Join(setLines, "\n") + "\n", strings.Join(clearLines, "\n") + "\n"
+}
+
+// AppendScriptlet appends the generated snippet to the user provided script.
+func AppendScriptlet(script, snippet string) string {
+	if script == "" || snippet == "" {
+		return script + snippet
+	}
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	return script + "\n" + snippet
+}
+
+// ShellQuote quotes s as a single word for the scriptlets.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
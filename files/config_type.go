@@ -0,0 +1,51 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The tokens that may follow `config` in a compound config type, such as
+// config|noreplace|missingok.
+const (
+	// ConfigNoReplace keeps the changes made to the file on upgrades, see
+	// TypeConfigNoReplace.
+	ConfigNoReplace = "noreplace"
+	// ConfigMissingOK lets the file be removed, rpm neither reporting it as
+	// missing when verifying the package nor installing it again on
+	// upgrades, see Content.MissingOK.
+	ConfigMissingOK = "missingok"
+)
+
+// ErrInvalidConfigType happens when a compound config type has a token other
+// than ConfigNoReplace and ConfigMissingOK.
+var ErrInvalidConfigType = errors.New("invalid config type")
+
+// NormalizeConfigTypes replaces the compound config types of the contents,
+// `config` followed by pipe separated tokens, with TypeConfigNoReplace if
+// they have the ConfigNoReplace token and TypeConfig otherwise, and sets
+// MissingOK if they have the ConfigMissingOK token. The contents are modified
+// in place.
+func NormalizeConfigTypes(contents Contents) error {
+	for _, content := range contents {
+		typ, tokens, ok := strings.Cut(content.Type, "|")
+		if !ok || typ != TypeConfig {
+			continue
+		}
+		typ = TypeConfig
+		for _, token := range strings.Split(tokens, "|") {
+			switch token {
+			case ConfigNoReplace:
+				typ = TypeConfigNoReplace
+			case ConfigMissingOK:
+				content.MissingOK = true
+			default:
+				return fmt.Errorf("%w: %s: unknown token %q in type %s, must be one of %s or %s",
+					ErrInvalidConfigType, content, token, content.Type, ConfigNoReplace, ConfigMissingOK)
+			}
+		}
+		content.Type = typ
+	}
+	return nil
+}
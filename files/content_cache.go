@@ -0,0 +1,81 @@
+package files
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// ContentCache memoizes the bodies of the sources of the contents, so that
+// the packages built from the same contents in several formats read each
+// source once, see Content.Cache. The bodies are keyed by file system,
+// source path, modification time and size, so a source changed meanwhile is
+// read again. As it holds the bodies in memory, a cache should only live as
+// long as the packages are built, and sources that do not fit in its limit
+// are read from disk as usual.
+type ContentCache struct {
+	mu      sync.Mutex
+	entries map[contentCacheKey]*contentCacheEntry
+	size    int64
+	limit   int64
+}
+
+type contentCacheKey struct {
+	fsys   fs.FS
+	source string
+	mtime  int64
+	size   int64
+}
+
+type contentCacheEntry struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// NewContentCache returns an empty cache holding up to limit bytes.
+func NewContentCache(limit int64) *ContentCache {
+	return &ContentCache{entries: map[contentCacheKey]*contentCacheEntry{}, limit: limit}
+}
+
+// read returns the body of the source of the content, and false if it is not
+// cached, e.g. because it would exceed the limit or its file system can not
+// be told apart from the others.
+func (c *ContentCache) read(content *Content) ([]byte, bool, error) {
+	if content.FS != nil && !reflect.TypeOf(content.FS).Comparable() {
+		return nil, false, nil
+	}
+	info, err := content.stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false, nil
+	}
+	key := contentCacheKey{
+		fsys:   content.FS,
+		source: content.Source,
+		mtime:  info.ModTime().UnixNano(),
+		size:   info.Size(),
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		if c.size+key.size > c.limit {
+			c.mu.Unlock()
+			return nil, false, nil
+		}
+		entry = &contentCacheEntry{}
+		c.entries[key] = entry
+		c.size += key.size
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		if content.FS != nil {
+			entry.data, entry.err = fs.ReadFile(content.FS, content.Source)
+		} else {
+			entry.data, entry.err = os.ReadFile(content.Source)
+		}
+	})
+	return entry.data, true, entry.err
+}
@@ -0,0 +1,35 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidContentPath happens when the destination of a content cannot be
+// installed as is.
+var ErrInvalidContentPath = errors.New("invalid content path")
+
+// ContentPaths returns an error for each content whose destination contains
+// control characters, is not absolute, or is longer than maxLength bytes, if
+// maxLength is positive.
+func ContentPaths(contents Contents, maxLength int) []error {
+	var errs []error
+	for _, content := range contents {
+		dst := content.Destination
+		if dst != "/" {
+			dst = strings.TrimSuffix(dst, "/")
+		}
+		switch {
+		case strings.ContainsFunc(dst, unicode.IsControl):
+			errs = append(errs, fmt.Errorf("%w %q: contains control characters", ErrInvalidContentPath, dst))
+		case !path.IsAbs(dst):
+			errs = append(errs, fmt.Errorf("%w %q: is not absolute", ErrInvalidContentPath, dst))
+		case maxLength > 0 && len(dst) > maxLength:
+			errs = append(errs, fmt.Errorf("%w %q: is %d bytes long, longer than the max path length of %d", ErrInvalidContentPath, dst, len(dst), maxLength))
+		}
+	}
+	return errs
+}
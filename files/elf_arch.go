@@ -0,0 +1,92 @@
+package files
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+)
+
+// ErrELFArchMismatch happens when an executable or shared library is built
+// for another architecture than the one of the package.
+var ErrELFArchMismatch = errors.New("ELF architecture does not match the package")
+
+// elfArch is the machine, class and byte order of the ELF files built for an
+// architecture.
+type elfArch struct {
+	machine elf.Machine
+	class   elf.Class
+	data    elf.Data
+}
+
+// elfArchs maps the architectures of the packages, in the nomenclature of
+// nfpm as well as of deb, rpm, apk and archlinux, to their ELF files.
+// nolint: gochecknoglobals
+var elfArchs = map[string]elfArch{
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"x86_64":   {elf.EM_X86_64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"386":      {elf.EM_386, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"i386":     {elf.EM_386, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"i686":     {elf.EM_386, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"x86":      {elf.EM_386, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"aarch64":  {elf.EM_AARCH64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"arm5":     {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"arm6":     {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"arm7":     {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armel":    {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armhf":    {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armv5tel": {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armv6hl":  {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armv7hl":  {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armv7h":   {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"armv7":    {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2MSB},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"mipsel":   {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"mips64el": {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"ppc64el":  {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"loong64":  {elf.EM_LOONGARCH, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, elf.ELFDATA2MSB},
+}
+
+// CheckELFArch returns an error for each executable or shared library of the
+// contents built for another architecture than arch, comparing the machine,
+// class and byte order of their ELF headers. Files that are not ELF files,
+// as well as ELF object files, are ignored. Nothing is checked if arch is
+// architecture independent, such as all or noarch, or not known.
+func CheckELFArch(contents Contents, arch string) ([]error, error) {
+	expected, ok := elfArchs[arch]
+	if !ok {
+		return nil, nil
+	}
+	var errs []error
+	for _, content := range contents {
+		switch content.Type {
+		case TypeFile, TypeConfig, TypeConfigNoReplace, "":
+		default:
+			continue
+		}
+		f, err := openELF(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", content.Destination, err)
+		}
+		if f == nil || (f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN) {
+			continue
+		}
+		actual := elfArch{f.Machine, f.Class, f.Data}
+		if actual != expected {
+			errs = append(errs, fmt.Errorf("%s: %w: built for %s, not %s",
+				content.Destination, ErrELFArchMismatch, actual, arch))
+		}
+	}
+	return errs, nil
+}
+
+func (a elfArch) String() string {
+	return fmt.Sprintf("%s %s %s", a.machine, a.class, a.data)
+}
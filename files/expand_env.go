@@ -0,0 +1,69 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// ErrInvalidExpandEnv happens when ExpandEnv is set on a content that is not
+// a regular file, or whose body is not text.
+var ErrInvalidExpandEnv = errors.New("invalid expand_env")
+
+// envRef matches the `${VAR}` references ExpandEnv substitutes. Unlike
+// os.Expand, it leaves `$VAR` alone, so that the `$1` and `$@` of shell
+// scripts are kept.
+// nolint: gochecknoglobals
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func validateExpandEnv(content *Content) error {
+	if !content.ExpandEnv {
+		return nil
+	}
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, TypeTree, "":
+		return nil
+	default:
+		return fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidExpandEnv, content, content.Type)
+	}
+}
+
+// ExpandEnv substitutes the `${VAR}` references in the bodies of the files
+// that set ExpandEnv with the values returned by mapping, and replaces their
+// sources with the result. Files that are not valid UTF-8 or contain NUL bytes
+// are considered binary and rejected.
+func ExpandEnv(contents Contents, mapping func(string) string) error {
+	for _, content := range contents {
+		if !content.ExpandEnv {
+			continue
+		}
+		switch content.Type {
+		case TypeFile, TypeConfig, TypeConfigNoReplace:
+		default:
+			continue
+		}
+
+		data, err := content.ReadAll()
+		if err != nil {
+			return err
+		}
+		if !isText(data) {
+			return fmt.Errorf("%w: %s: not a text file", ErrInvalidExpandEnv, content)
+		}
+		content.Data = envRef.ReplaceAllFunc(data, func(ref []byte) []byte {
+			return []byte(mapping(string(ref[2 : len(ref)-1])))
+		})
+		if content.FileInfo != nil {
+			content.FileInfo.Size = int64(len(content.Data))
+		}
+	}
+	return nil
+}
+
+// isText reports whether data is the body of a text file: valid UTF-8 without
+// NUL bytes.
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
@@ -0,0 +1,35 @@
+package files
+
+// WithFileInfoOverride returns the content with the owner, group and mode of
+// the override of its file info for the packager, see
+// ContentFileInfo.Overrides, replacing the ones of the file info. The
+// override takes precedence over the file info, and over the defaults of the
+// paths, as the mode it sets is no longer considered unset. The content is
+// returned as is if it has no override for the packager, and copied
+// otherwise, as it might be shared between packagers.
+func WithFileInfoOverride(content *Content, packager string) *Content {
+	if content.FileInfo == nil || packager == "" {
+		return content
+	}
+	override, ok := content.FileInfo.Overrides[packager]
+	if !ok || override == nil {
+		return content
+	}
+
+	cc := *content
+	fileInfo := *content.FileInfo
+	cc.FileInfo = &fileInfo
+	if override.Owner != "" {
+		fileInfo.Owner = override.Owner
+		fileInfo.Unset.Owner = false
+	}
+	if override.Group != "" {
+		fileInfo.Group = override.Group
+		fileInfo.Unset.Group = false
+	}
+	if override.Mode != 0 {
+		fileInfo.Mode = override.Mode
+		fileInfo.Unset.Mode = false
+	}
+	return &cc
+}
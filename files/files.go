@@ -1,10 +1,16 @@
 package files
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -35,32 +41,164 @@ const (
 	// that is respected by RPM-based distributions. For all other packages it
 	// is handled exactly like TypeConfig.
 	TypeConfigNoReplace = "config|noreplace"
-	// TypeGhost is the type of an RPM ghost file which is ignored by other packagers.
+	// TypeRPMGhost is the type of a file that is owned by the package but not
+	// shipped in it: rpm lists it as %ghost, the other packagers leave it out
+	// of the package entirely, see Content.Touch.
 	TypeRPMGhost = "ghost"
-	// TypeRPMDoc is the type of an RPM doc file which is ignored by other packagers.
+	// TypeRPMDoc is the type of an RPM doc file, which other packagers ship as
+	// a regular file.
 	TypeRPMDoc = "doc"
-	// TypeRPMLicence is the type of an RPM licence file which is ignored by other packagers.
+	// TypeRPMLicence is the type of an RPM licence file, which other packagers
+	// ship as a regular file.
 	TypeRPMLicence = "licence"
 	// TypeRPMLicense a different spelling of TypeRPMLicence.
 	TypeRPMLicense = "license"
-	// TypeRPMReadme is the type of an RPM readme file which is ignored by other packagers.
+	// TypeRPMReadme is the type of an RPM readme file, which other packagers
+	// ship as a regular file.
 	TypeRPMReadme = "readme"
+	// TypeTemplate is the type of a file whose source is rendered as a Go
+	// text/template at build time. The rendered output is packaged as a regular
+	// file.
+	TypeTemplate = "template"
+	// TypeMergeDir is the type of an existing system directory that contents
+	// are merged into. Neither the directory nor its parents are created or
+	// owned by the package, unless they are added explicitly.
+	TypeMergeDir = "merge_dir"
 	// TypeDebChangelog is the type of a Debian changelog archive file which is
 	// ignored by other packagers. This type should never be set for a content
 	// entry as it is automatically added when a changelog is configred.
 	TypeDebChangelog = "debian changelog"
+	// TypeHardlink is the type of a hard link that is created at the
+	// destination path and links to the file at the source path, which is
+	// part of the same package. This type should never be set for a content
+	// entry as it is automatically added when nfpm.Info.Dedup is set.
+	TypeHardlink = "hardlink"
 )
 
 // Content describes the source and destination
 // of one file to copy into a package.
 type Content struct {
-	Source      string           `yaml:"src,omitempty" json:"src,omitempty"`
+	Source string `yaml:"src,omitempty" json:"src,omitempty"`
+	// Sources lists several source roots (or globs) whose matches are all
+	// merged into Destination. It can be used instead of Source for files,
+	// config files and trees.
+	Sources     []string         `yaml:"srcs,omitempty" json:"srcs,omitempty"`
 	Destination string           `yaml:"dst" json:"dst"`
-	Type        string           `yaml:"type,omitempty" json:"type,omitempty" jsonschema:"enum=symlink,enum=ghost,enum=config,enum=config|noreplace,enum=dir,enum=tree,enum=,default="`
+	Type        string           `yaml:"type,omitempty" json:"type,omitempty" jsonschema:"enum=symlink,enum=ghost,enum=config,enum=config|noreplace,enum=config|missingok,enum=config|noreplace|missingok,enum=dir,enum=tree,enum=template,enum=merge_dir,enum=doc,enum=license,enum=licence,enum=readme,enum=,default="`
 	Packager    string           `yaml:"packager,omitempty" json:"packager,omitempty"`
 	FileInfo    *ContentFileInfo `yaml:"file_info,omitempty" json:"file_info,omitempty"`
 	Expand      bool             `yaml:"expand,omitempty" json:"expand,omitempty"`
 	Excludes    []string         `yaml:"excludes,omitempty" json:"excludes,omitempty"`
+	// IncludeFormats, if set, restricts the content to the given packagers,
+	// e.g. rpm, while ExcludeFormats leaves it out of the given ones. Both
+	// work like Packager, for several packagers at once.
+	IncludeFormats []string `yaml:"include_formats,omitempty" json:"include_formats,omitempty" jsonschema:"title=packagers the content is restricted to,example=rpm"`
+	ExcludeFormats []string `yaml:"exclude_formats,omitempty" json:"exclude_formats,omitempty" jsonschema:"title=packagers the content is left out of,example=apk"`
+	// When is a condition, such as `Arch == "arm64" && Format == "rpm"`, the
+	// content is only packaged if it holds, see the expr package for its
+	// syntax. It is evaluated with the Go arch when the config is read, and
+	// with the arch of the packager otherwise.
+	When string `yaml:"when,omitempty" json:"when,omitempty" jsonschema:"title=condition the content is packaged on"`
+	// FileInfoRef is the name of one of the file info templates of the info,
+	// which FileInfo is merged over, its own fields taking precedence.
+	FileInfoRef string `yaml:"file_info_ref,omitempty" json:"file_info_ref,omitempty" jsonschema:"title=name of the file info template of the content,example=exe"`
+	// Manifest is the path of an install list, whose lines are expanded into
+	// contents by ExpandManifests. Source, Sources and Destination must not be
+	// set, the other fields are the defaults of the listed contents.
+	Manifest string `yaml:"manifest,omitempty" json:"manifest,omitempty" jsonschema:"title=install list with one src dst [mode owner group type] per line"`
+	// SkipIfMissing leaves the content out of the package, instead of
+	// failing, if its literal source does not exist.
+	SkipIfMissing bool `yaml:"skip_if_missing,omitempty" json:"skip_if_missing,omitempty" jsonschema:"title=skip the content if its source does not exist,default=false"`
+	// ExcludeHidden leaves the hidden files the source matches, i.e. the ones
+	// with a path element starting with a dot, out of the package, unless the
+	// source names them with an element that starts with a dot, e.g. `src/.*`.
+	// By default, matchers and directories include hidden files.
+	ExcludeHidden bool `yaml:"exclude_hidden,omitempty" json:"exclude_hidden,omitempty" jsonschema:"title=leave out the hidden files the source matches,default=false"`
+	// ExcludeDirs prunes the directories the source matches, or the tree
+	// contains, that are matched by one of its patterns, e.g. `.git` or
+	// `__pycache__`, leaving them and everything within them out of the
+	// package. Patterns without a slash match the name of a directory at any
+	// depth, the others its path relative to the source directory, or to the
+	// directory the source starts to match in if it is a glob.
+	ExcludeDirs []string `yaml:"exclude_dirs,omitempty" json:"exclude_dirs,omitempty" jsonschema:"title=directories pruned from the source,example=.git"`
+	// DisableGlobbing takes the source literally, like the disable_globbing
+	// option of the info does for all contents, so that paths containing
+	// `*`, `?`, `[` or `{` can be packaged.
+	DisableGlobbing bool `yaml:"disable_globbing,omitempty" json:"disable_globbing,omitempty" jsonschema:"title=take the source literally,default=false"`
+	// ExpandEnv substitutes the `${VAR}` references in the body of the file
+	// with the environment variables when packaging, see ExpandEnv. Trees
+	// and globs pass it on to the files they contain.
+	ExpandEnv bool `yaml:"expand_env,omitempty" json:"expand_env,omitempty" jsonschema:"title=substitute the environment variables in the body of the file,default=false"`
+	// Lang is the locale the file is specific to, e.g. de, recorded by rpm as
+	// its %lang, so that the files of the locales that are not installed can
+	// be left out. Trees and globs pass it on to the files they contain. The
+	// other packagers ignore it.
+	Lang string `yaml:"lang,omitempty" json:"lang,omitempty" jsonschema:"title=locale of the file for rpm,example=de"`
+	// NormalizeEOL rewrites the line endings of the body of the file to
+	// EOLLF or EOLCRLF when packaging, see NormalizeEOL. Trees and globs pass
+	// it on to the files they contain.
+	NormalizeEOL string `yaml:"normalize_eol,omitempty" json:"normalize_eol,omitempty" jsonschema:"title=line endings of the body of the file,enum=lf,enum=crlf,enum=none,default=none"`
+	// TypeByExtension sets the types of the files expanded from a glob or a
+	// tree by their extension, e.g. `.conf: config`. The longest matching
+	// extension wins, and files whose extension is not mapped keep the type
+	// of the content.
+	TypeByExtension map[string]string `yaml:"type_by_extension,omitempty" json:"type_by_extension,omitempty" jsonschema:"title=types of the expanded files by extension"`
+	// OnEmptyGlob controls what happens when the glob of the source matches
+	// no files: OnEmptyGlobError fails, OnEmptyGlobWarn and OnEmptyGlobSkip
+	// leave the content out of the package, the former with a warning.
+	OnEmptyGlob string `yaml:"on_empty_glob,omitempty" json:"on_empty_glob,omitempty" jsonschema:"title=what happens when the glob of the source matches no files,enum=error,enum=warn,enum=skip,default=error"`
+	// SymlinkResolve tells what becomes of the sources that are symbolic
+	// links: SymlinkResolveNone recreates them as is, SymlinkResolveFirst
+	// resolves one level of a chain of links and SymlinkResolveFull packages
+	// the content of the final target. Symbolic links to directories within
+	// trees are always recreated as links.
+	SymlinkResolve string `yaml:"symlink_resolve,omitempty" json:"symlink_resolve,omitempty" jsonschema:"title=what becomes of sources that are symbolic links,enum=none,enum=first,enum=full,default=none"`
+	// Raw packages the file, or each file the glob of the source matches,
+	// as is: its body is never rewritten, its mode is the one of file_info or
+	// of the source, without the umask, the defattr, the path defaults or
+	// the fixes of the mode policies, and it is never compressed, dedupped or
+	// given the mtime of a reproducible build. It can not be combined with
+	// expand_env, normalize_eol and type_by_extension.
+	Raw bool `yaml:"raw,omitempty" json:"raw,omitempty" jsonschema:"title=package the file without any transformation,default=false"`
+	// Rename is a text/template rendering the base name of the destination
+	// of the file, or of each file the glob of the source matches, e.g.
+	// `{{ trimSuffix "-linux-amd64" .Name }}` or simply `foo`. It is executed
+	// with the Name, Stem and Ext of the base name, and has the trimPrefix,
+	// trimSuffix, replace, lower and upper functions.
+	Rename string `yaml:"rename,omitempty" json:"rename,omitempty" jsonschema:"title=template of the base name of the destination,example={{ trimSuffix \"-linux-amd64\" .Name }}"`
+	// Touch, on a ghost file, makes the packagers without ghost files, which
+	// leave them out of the package, create it empty once the package is
+	// installed, if it does not exist yet, see GhostScriptlet.
+	Touch bool `yaml:"touch,omitempty" json:"touch,omitempty" jsonschema:"title=create the ghost file on install with the packagers without ghost files,default=false"`
+	// MissingOK marks a config file as %config(missingok) in rpm packages.
+	// It is set by the ConfigMissingOK token of the compound config types,
+	// see NormalizeConfigTypes.
+	MissingOK bool `yaml:"-" json:"-"`
+	// RemoveOn controls when an empty directory is removed, either
+	// RemoveOnUninstall, RemoveOnPurge or RemoveOnNone.
+	RemoveOn string `yaml:"remove_on,omitempty" json:"remove_on,omitempty" jsonschema:"title=when the directory is removed,enum=none,enum=uninstall,enum=purge,default=uninstall"`
+	// Data, if set, is used as the body of the file instead of the contents
+	// of Source, which can then be left empty, e.g. to package a file
+	// generated in memory. The size of the file is the length of Data and
+	// its mode, if FileInfo sets none, 0644 minus the umask.
+	Data []byte `yaml:"-" json:"-"`
+	// FS, if set, is the file system Source is read from, e.g. an embed.FS,
+	// instead of the OS file system. Sources are then relative to its root and
+	// symbolic links are followed, as fs.FS provides no way to read them.
+	// Contents expanded from globs and trees inherit it.
+	FS fs.FS `yaml:"-" json:"-"`
+	// Cache, if set, memoizes the body of Source for Open and ReadAll, see
+	// ContentCache. The bodies ReadAll returns are then shared and must not
+	// be modified.
+	Cache *ContentCache `yaml:"-" json:"-"`
+}
+
+// UnsetFileInfo records the fields of a ContentFileInfo that were left unset,
+// see ContentFileInfo.Unset.
+type UnsetFileInfo struct {
+	Owner bool
+	Group bool
+	Mode  bool
 }
 
 type ContentFileInfo struct {
@@ -69,6 +207,40 @@ type ContentFileInfo struct {
 	Mode  os.FileMode `yaml:"mode,omitempty" json:"mode,omitempty"`
 	MTime time.Time   `yaml:"mtime,omitempty" json:"mtime,omitempty"`
 	Size  int64       `yaml:"-" json:"-"`
+	// Attrs are the file attributes, such as immutable, that are set with
+	// chattr(1) once the content is installed, see AttrScriptlets.
+	Attrs []string `yaml:"attrs,omitempty" json:"attrs,omitempty" jsonschema:"title=file attributes set after installation,enum=immutable,enum=append-only,enum=no-atime,enum=no-copy-on-write,enum=no-dump,enum=synchronous"`
+	// PreserveMTime uses the modification time of the source file, unless
+	// MTime is set, instead of the mtime of the package. Trees and globs pass
+	// it on to the files they contain.
+	PreserveMTime bool `yaml:"preserve_mtime,omitempty" json:"preserve_mtime,omitempty" jsonschema:"title=use the modification time of the source file,default=false"`
+	// PreserveDirModes uses the mode of each directory of a tree on disk,
+	// minus the umask, even if Mode or a default dir mode is set, which then
+	// only apply to the files of the tree.
+	PreserveDirModes bool `yaml:"preserve_dir_modes,omitempty" json:"preserve_dir_modes,omitempty" jsonschema:"title=use the modes of the source directories of a tree,default=false"`
+	// DirModes sets the mode of some directories of a tree, keyed by their
+	// path relative to the tree, e.g. `.` for the tree itself. It takes
+	// precedence over all the other modes.
+	DirModes map[string]os.FileMode `yaml:"dir_modes,omitempty" json:"dir_modes,omitempty" jsonschema:"title=modes of the directories of a tree"`
+	// DefaultMode and DefaultDirMode, if set, are used instead of the mode of
+	// the source file or directory when Mode is not set. Trees, globs and
+	// manifests pass them on to the contents they contain. They are set by
+	// the defattr of the info.
+	DefaultMode    os.FileMode `yaml:"-" json:"-"`
+	DefaultDirMode os.FileMode `yaml:"-" json:"-"`
+	// Unset records which of Owner, Group and Mode the content left to their
+	// defaults, so that they can be set depending on the destinations of the
+	// contents it expands to. Trees, globs and manifests pass it on to the
+	// contents they contain. It is set by the path defaults of the info.
+	Unset UnsetFileInfo `yaml:"-" json:"-"`
+	// UID and GID are the ids tar headers record along with the names of the
+	// owner and the group, see ResolveOwners. They default to 0.
+	UID int `yaml:"-" json:"-"`
+	GID int `yaml:"-" json:"-"`
+	// Overrides replace the owner, group and mode of the file info, when set,
+	// for the packager they are keyed by, e.g. rpm, see
+	// WithFileInfoOverride. Their other fields are ignored.
+	Overrides map[string]*ContentFileInfo `yaml:"overrides,omitempty" json:"overrides,omitempty" jsonschema:"title=owner group and mode of the content for specific packagers"`
 }
 
 // Contents list of Content to process.
@@ -108,17 +280,28 @@ func (c Contents) ContainsDestination(dst string) bool {
 
 func (c *Content) WithFileInfoDefaults(umask fs.FileMode, mtime time.Time) *Content {
 	cc := &Content{
-		Source:      c.Source,
-		Destination: c.Destination,
-		Type:        c.Type,
-		Packager:    c.Packager,
-		FileInfo:    c.FileInfo,
+		Source:       c.Source,
+		Destination:  c.Destination,
+		Type:         c.Type,
+		Packager:     c.Packager,
+		RemoveOn:     c.RemoveOn,
+		Touch:        c.Touch,
+		MissingOK:    c.MissingOK,
+		ExpandEnv:    c.ExpandEnv,
+		NormalizeEOL: c.NormalizeEOL,
+		Raw:          c.Raw,
+		Lang:         c.Lang,
+		Data:         c.Data,
+		FS:           c.FS,
 	}
 	if cc.Type == "" {
 		cc.Type = TypeFile
 	}
-	if cc.FileInfo == nil {
-		cc.FileInfo = &ContentFileInfo{}
+	// copy the file info so that the defaults are not written back into the
+	// original content, which might be shared between packagers
+	cc.FileInfo = &ContentFileInfo{}
+	if c.FileInfo != nil {
+		*cc.FileInfo = *c.FileInfo
 	}
 	if cc.FileInfo.Owner == "" {
 		cc.FileInfo.Owner = "root"
@@ -126,10 +309,25 @@ func (c *Content) WithFileInfoDefaults(umask fs.FileMode, mtime time.Time) *Cont
 	if cc.FileInfo.Group == "" {
 		cc.FileInfo.Group = "root"
 	}
+	if c.Raw {
+		// the mode is the declared one or the one of the source as is.
+		umask = 0
+		cc.FileInfo.DefaultMode = 0
+	}
+	if cc.FileInfo.Mode == 0 {
+		switch cc.Type {
+		case TypeDir, TypeImplicitDir:
+			cc.FileInfo.Mode = cc.FileInfo.DefaultDirMode
+		case TypeSymlink:
+		default:
+			cc.FileInfo.Mode = cc.FileInfo.DefaultMode
+		}
+	}
 	if (cc.Type == TypeDir || cc.Type == TypeImplicitDir) && cc.FileInfo.Mode == 0 {
 		cc.FileInfo.Mode = 0o755
 	}
-	if cc.FileInfo.MTime.IsZero() {
+	preserveMTime := cc.FileInfo.PreserveMTime && cc.Type != TypeSymlink && cc.Data == nil
+	if cc.FileInfo.MTime.IsZero() && !preserveMTime {
 		cc.FileInfo.MTime = mtime
 	}
 
@@ -140,7 +338,7 @@ func (c *Content) WithFileInfoDefaults(umask fs.FileMode, mtime time.Time) *Cont
 
 	// only stat source when we actually need more information
 	if cc.Source != "" && !fileInfoAlreadyComplete {
-		info, err := os.Stat(cc.Source)
+		info, err := cc.stat()
 		if err == nil {
 			if cc.FileInfo.MTime.IsZero() {
 				cc.FileInfo.MTime = info.ModTime()
@@ -152,12 +350,63 @@ func (c *Content) WithFileInfoDefaults(umask fs.FileMode, mtime time.Time) *Cont
 		}
 	}
 
+	if cc.Data != nil {
+		cc.FileInfo.Size = int64(len(cc.Data))
+		// there is no source file to take the mode from.
+		if cc.FileInfo.Mode == 0 {
+			cc.FileInfo.Mode = 0o644 &^ umask
+		}
+	}
+
 	if cc.FileInfo.MTime.IsZero() {
 		cc.FileInfo.MTime = mtime
 	}
 	return cc
 }
 
+// Open opens the content for reading. If the content holds Data, a reader for
+// it is returned, otherwise Source is opened from FS or the OS file system.
+func (c *Content) Open() (io.ReadCloser, error) {
+	if c.Data != nil {
+		return io.NopCloser(bytes.NewReader(c.Data)), nil
+	}
+	if c.Cache != nil {
+		if data, ok, err := c.Cache.read(c); ok {
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+	if c.FS != nil {
+		return c.FS.Open(c.Source)
+	}
+	return os.Open(c.Source) //nolint:gosec
+}
+
+// ReadAll returns the body of the content, see Open.
+func (c *Content) ReadAll() ([]byte, error) {
+	if c.Data != nil {
+		return c.Data, nil
+	}
+	if c.Cache != nil {
+		if data, ok, err := c.Cache.read(c); ok {
+			return data, err
+		}
+	}
+	if c.FS != nil {
+		return fs.ReadFile(c.FS, c.Source)
+	}
+	return os.ReadFile(c.Source)
+}
+
+func (c *Content) stat() (fs.FileInfo, error) {
+	if c.FS != nil {
+		return fs.Stat(c.FS, c.Source)
+	}
+	return os.Stat(c.Source)
+}
+
 // Name to part of the os.FileInfo interface
 func (c *Content) Name() string {
 	return c.Source
@@ -193,6 +442,9 @@ func (c *Content) String() string {
 	if c.Source != "" {
 		properties = append(properties, "src="+c.Source)
 	}
+	if len(c.Sources) > 0 {
+		properties = append(properties, "srcs="+strings.Join(c.Sources, ":"))
+	}
 	if c.Destination != "" {
 		properties = append(properties, "dst="+c.Destination)
 	}
@@ -242,69 +494,212 @@ func PrepareForPackager(
 	disableGlobbing bool,
 	mtime time.Time,
 ) (Contents, error) {
+	res, _, err := prepareForPackager(rawContents, umask, packager, disableGlobbing, mtime)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(res)
+
+	return res, nil
+}
+
+// PrepareForPackagerInConfigOrder works like PrepareForPackager, but keeps the
+// contents in the order in which they are declared instead of sorting them by
+// destination. Contents expanded from the same glob or tree are sorted by
+// destination, and parent directories always precede their contents.
+func PrepareForPackagerInConfigOrder(
+	rawContents Contents,
+	umask fs.FileMode,
+	packager string,
+	disableGlobbing bool,
+	mtime time.Time,
+) (Contents, error) {
+	res, order, err := prepareForPackager(rawContents, umask, packager, disableGlobbing, mtime)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return order[res[i].Destination] < order[res[j].Destination]
+	})
+
+	return res, nil
+}
+
+func prepareForPackager(
+	rawContents Contents,
+	umask fs.FileMode,
+	packager string,
+	disableGlobbing bool,
+	mtime time.Time,
+) (Contents, map[string]int, error) {
 	contentMap := make(map[string]*Content)
+	order := make(map[string]int)
+	var mergeDirs []string
+
+	rawContents, err := ExpandManifests(rawContents)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawContents, err = expandSources(rawContents)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := NormalizeConfigTypes(rawContents); err != nil {
+		return nil, nil, err
+	}
 
 	for _, content := range rawContents {
 		if !isRelevantForPackager(packager, content) {
 			continue
 		}
+		content = WithFileInfoOverride(content, packager)
+		if err := validateAttrs(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateRemoveOn(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateTouch(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateExpandEnv(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateSymlinkResolve(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateRename(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateNormalizeEOL(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateLang(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateRaw(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateTypeByExtension(content); err != nil {
+			return nil, nil, err
+		}
+		if err := validateOnEmptyGlob(content); err != nil {
+			return nil, nil, err
+		}
+		literal := disableGlobbing || content.DisableGlobbing
+		missing, err := isMissing(content, literal)
+		if err != nil {
+			return nil, nil, err
+		}
+		if missing {
+			continue
+		}
 
 		switch content.Type {
 		case TypeDir:
 			// implicit directories at the same destination can just be overwritten
 			presentContent, destinationOccupied := contentMap[NormalizeAbsoluteDirPath(content.Destination)]
 			if destinationOccupied && presentContent.Type != TypeImplicitDir {
-				return nil, contentCollisionError(content, presentContent)
+				return nil, nil, contentCollisionError(content, presentContent)
 			}
 
-			err := addParents(contentMap, content.Destination, mtime)
+			err := addParents(contentMap, order, content.Destination, mtime)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			cc := content.WithFileInfoDefaults(umask, mtime)
 			cc.Source = ToNixPath(cc.Source)
 			cc.Destination = NormalizeAbsoluteDirPath(cc.Destination)
-			contentMap[cc.Destination] = cc
+			addContent(contentMap, order, cc)
 		case TypeImplicitDir:
 			// if there's an implicit directory, the contents probably already
 			// have been expanded so we can just ignore it, it will be created
 			// by another content element again anyway
-		case TypeRPMGhost, TypeSymlink, TypeRPMDoc, TypeRPMLicence, TypeRPMLicense, TypeRPMReadme, TypeDebChangelog:
-			presentContent, destinationOccupied := contentMap[NormalizeAbsoluteFilePath(content.Destination)]
+		case TypeMergeDir:
+			mergeDirs = append(mergeDirs, content.Destination)
+		case TypeRPMGhost, TypeSymlink, TypeRPMDoc, TypeRPMLicence, TypeRPMLicense, TypeRPMReadme, TypeDebChangelog, TypeTemplate:
+			dst := NormalizeAbsoluteFilePath(content.Destination)
+			if content.Type != TypeRPMGhost && content.Type != TypeSymlink {
+				dst = fileDestination(content)
+			}
+			presentContent, destinationOccupied := contentMap[dst]
 			if destinationOccupied {
-				return nil, contentCollisionError(content, presentContent)
+				return nil, nil, contentCollisionError(content, presentContent)
 			}
 
-			err := addParents(contentMap, content.Destination, mtime)
+			err := addParents(contentMap, order, dst, mtime)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			cc := content.WithFileInfoDefaults(umask, mtime)
 			cc.Source = ToNixPath(cc.Source)
-			cc.Destination = NormalizeAbsoluteFilePath(cc.Destination)
-			contentMap[cc.Destination] = cc
+			cc.Destination = dst
+			if packager != "rpm" && isRPMDocType(cc.Type) {
+				cc.Type = TypeFile
+			}
+			addContent(contentMap, order, cc)
 		case TypeTree:
-			err := addTree(contentMap, content, umask, mtime)
+			err := addTrees(contentMap, order, content, umask, mtime)
 			if err != nil {
-				return nil, fmt.Errorf("add tree: %w", err)
+				return nil, nil, fmt.Errorf("add tree: %w", err)
 			}
 		case TypeConfig, TypeConfigNoReplace, TypeFile, "":
-			globbed, err := glob.Glob(
+			if content.Data != nil {
+				// the body is given, e.g. downloaded from a URL source, so
+				// there is nothing to glob.
+				if err := addDataFile(contentMap, order, content, umask, mtime); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			globbed, err := glob.GlobExcludeDirs(
+				content.FS,
 				filepath.ToSlash(content.Source),
 				filepath.ToSlash(content.Destination),
-				disableGlobbing,
+				literal,
+				!content.ExcludeHidden,
+				content.ExcludeDirs,
 			)
+			if skipEmptyGlob(content, err) {
+				continue
+			}
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
-			if err := addGlobbedFiles(contentMap, globbed, content, umask, mtime); err != nil {
-				return nil, fmt.Errorf("add globbed files from %q: %w", content.Source, err)
+			if err := addGlobbedFiles(contentMap, order, globbed, content, umask, mtime); err != nil {
+				return nil, nil, fmt.Errorf("add globbed files from %q: %w", content.Source, err)
 			}
 		default:
-			return nil, fmt.Errorf("invalid content type: %s", content.Type)
+			return nil, nil, fmt.Errorf("invalid content type: %s", content.Type)
+		}
+	}
+
+	// merge directories and their parents already exist on the system, so
+	// they must not be added implicitly
+	for _, dir := range mergeDirs {
+		for _, parent := range append(sortedParents(dir), dir) {
+			parent = NormalizeAbsoluteDirPath(parent)
+			if c, ok := contentMap[parent]; ok && c.Type == TypeImplicitDir {
+				delete(contentMap, parent)
+			}
+		}
+	}
+
+	// unowned directories are created by the scriptlets, which would leave
+	// anything within them without an owned parent.
+	for dest, content := range contentMap {
+		if !content.IsUnowned() {
+			continue
+		}
+		for other := range contentMap {
+			if other != dest && strings.HasPrefix(other, dest) {
+				return nil, nil, fmt.Errorf("%w: %s: directory is not empty, it contains %s", ErrInvalidRemoveOn, content, other)
+			}
 		}
 	}
 
@@ -314,24 +709,90 @@ func PrepareForPackager(
 		res = append(res, content)
 	}
 
-	sort.Sort(res)
+	return res, order, nil
+}
+
+// ErrInvalidSources happens when a content sets multiple sources but they
+// cannot be merged.
+var ErrInvalidSources = errors.New("invalid srcs")
+
+// expandSources replaces each file with multiple sources by one content per
+// source, which all share the destination and the remaining settings of the
+// original content.
+func expandSources(contents Contents) (Contents, error) {
+	var res Contents
+	for _, content := range contents {
+		if len(content.Sources) == 0 {
+			res = append(res, content)
+			continue
+		}
+
+		if content.Source != "" {
+			return nil, fmt.Errorf("%w: %s: src and srcs are mutually exclusive", ErrInvalidSources, content)
+		}
+
+		switch content.Type {
+		case TypeConfig, TypeConfigNoReplace, TypeFile, "":
+		case TypeTree:
+			// trees are merged by addTrees
+			res = append(res, content)
+			continue
+		default:
+			return nil, fmt.Errorf("%w: %s: only files, config files and trees support multiple sources", ErrInvalidSources, content)
+		}
+
+		for _, src := range content.Sources {
+			c := *content
+			c.Source = src
+			c.Sources = nil
+			res = append(res, &c)
+		}
+	}
 
 	return res, nil
 }
 
+// addContent adds the content to the map, keyed by its destination, and
+// records the position at which it was added. Contents replacing an implicit
+// directory take over its position so that directories still precede their
+// contents when sorted in config order.
+func addContent(contentMap map[string]*Content, order map[string]int, content *Content) {
+	if _, ok := order[content.Destination]; !ok {
+		order[content.Destination] = len(order)
+	}
+	contentMap[content.Destination] = content
+}
+
+// IsForFormat reports whether the content is packaged by the given packager
+// according to its Packager, IncludeFormats and ExcludeFormats.
+func (c *Content) IsForFormat(packager string) bool {
+	if c.Packager != "" && c.Packager != packager {
+		return false
+	}
+	if len(c.IncludeFormats) > 0 && !slices.Contains(c.IncludeFormats, packager) {
+		return false
+	}
+	return !slices.Contains(c.ExcludeFormats, packager)
+}
+
+// isRPMDocType reports whether the type is one of the doc, license and
+// readme types, which only rpm flags as such.
+func isRPMDocType(typ string) bool {
+	return typ == TypeRPMDoc || typ == TypeRPMLicence || typ == TypeRPMLicense || typ == TypeRPMReadme
+}
+
 func isRelevantForPackager(packager string, content *Content) bool {
 	if packager == "" {
 		return true
 	}
 
-	if content.Packager != "" && content.Packager != packager {
+	if !content.IsForFormat(packager) {
 		return false
 	}
 
-	if packager != "rpm" &&
-		(content.Type == TypeRPMDoc || content.Type == TypeRPMLicence ||
-			content.Type == TypeRPMLicense || content.Type == TypeRPMReadme ||
-			content.Type == TypeRPMGhost) {
+	// the other packagers only need the ghost files they create, so that
+	// their parents are shipped.
+	if packager != "rpm" && content.Type == TypeRPMGhost && !content.Touch {
 		return false
 	}
 
@@ -342,7 +803,7 @@ func isRelevantForPackager(packager string, content *Content) bool {
 	return true
 }
 
-func addParents(contentMap map[string]*Content, path string, mtime time.Time) error {
+func addParents(contentMap map[string]*Content, order map[string]int, path string, mtime time.Time) error {
 	for _, parent := range sortedParents(path) {
 		parent = NormalizeAbsoluteDirPath(parent)
 		// check for content collision and just overwrite previously created
@@ -361,7 +822,7 @@ func addParents(contentMap map[string]*Content, path string, mtime time.Time) er
 			}, c)
 		}
 
-		contentMap[parent] = &Content{
+		addContent(contentMap, order, &Content{
 			Destination: parent,
 			Type:        TypeImplicitDir,
 			FileInfo: &ContentFileInfo{
@@ -370,7 +831,7 @@ func addParents(contentMap map[string]*Content, path string, mtime time.Time) er
 				Mode:  0o755,
 				MTime: mtime,
 			},
-		}
+		})
 	}
 
 	return nil
@@ -398,13 +859,25 @@ func sortedParents(dst string) []string {
 
 func addGlobbedFiles(
 	all map[string]*Content,
+	order map[string]int,
 	globbed map[string]string,
 	origFile *Content,
 	umask fs.FileMode,
 	mtime time.Time,
 ) error {
-	for src, dst := range globbed {
-		dst = NormalizeAbsoluteFilePath(dst)
+	sources := make([]string, 0, len(globbed))
+	for src := range globbed {
+		sources = append(sources, src)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return globbed[sources[i]] < globbed[sources[j]]
+	})
+
+	for _, src := range sources {
+		dst, err := renameDestination(origFile, NormalizeAbsoluteFilePath(globbed[src]))
+		if err != nil {
+			return err
+		}
 		presentContent, destinationOccupied := all[dst]
 		if destinationOccupied {
 			c := *origFile
@@ -412,7 +885,7 @@ func addGlobbedFiles(
 			return contentCollisionError(&c, presentContent)
 		}
 
-		if err := addParents(all, dst, mtime); err != nil {
+		if err := addParents(all, order, dst, mtime); err != nil {
 			return err
 		}
 
@@ -425,42 +898,119 @@ func addGlobbedFiles(
 		}
 
 		newFile := (&Content{
-			Destination: NormalizeAbsoluteFilePath(dst),
-			Source:      ToNixPath(src),
-			Type:        origFile.Type,
-			FileInfo:    newFileInfo,
-			Packager:    origFile.Packager,
+			Destination:  NormalizeAbsoluteFilePath(dst),
+			Source:       ToNixPath(src),
+			Type:         typeByExtension(origFile, dst, origFile.Type),
+			FileInfo:     newFileInfo,
+			Packager:     origFile.Packager,
+			MissingOK:    origFile.MissingOK,
+			ExpandEnv:    origFile.ExpandEnv,
+			NormalizeEOL: origFile.NormalizeEOL,
+			Raw:          origFile.Raw,
+			Lang:         origFile.Lang,
+			FS:           origFile.FS,
 		}).WithFileInfoDefaults(umask, mtime)
-		if dst, err := os.Readlink(src); err == nil {
-			newFile.Source = dst
-			newFile.Type = TypeSymlink
+		if origFile.FS == nil {
+			target, isLink, err := resolveSymlink(src, origFile.SymlinkResolve)
+			if err != nil {
+				return err
+			}
+			if isLink {
+				newFile.Source = target
+				newFile.Type = TypeSymlink
+			}
 		}
 
-		all[dst] = newFile
+		addContent(all, order, newFile)
 	}
 
 	return nil
 }
 
+// addDataFile adds a file whose body is given by its Data.
+func addDataFile(all map[string]*Content, order map[string]int, content *Content, umask fs.FileMode, mtime time.Time) error {
+	dst, err := renameDestination(content, fileDestination(content))
+	if err != nil {
+		return err
+	}
+	if presentContent, destinationOccupied := all[dst]; destinationOccupied {
+		return contentCollisionError(content, presentContent)
+	}
+	if err := addParents(all, order, dst, mtime); err != nil {
+		return err
+	}
+	cc := content.WithFileInfoDefaults(umask, mtime)
+	cc.Destination = dst
+	addContent(all, order, cc)
+	return nil
+}
+
+// addTrees adds the tree, or each of its source roots merged into the same
+// destination if it has multiple sources.
+func addTrees(
+	all map[string]*Content,
+	order map[string]int,
+	tree *Content,
+	umask os.FileMode,
+	mtime time.Time,
+) error {
+	if len(tree.Sources) == 0 {
+		return addTree(all, order, tree, umask, mtime, false)
+	}
+
+	for _, src := range tree.Sources {
+		root := *tree
+		root.Source = src
+		root.Sources = nil
+		if err := addTree(all, order, &root, umask, mtime, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addTree adds the contents of the tree. If merge is set, directories that
+// were already added by another root of the same tree are kept, while any
+// other content at an occupied destination is a collision.
 func addTree(
 	all map[string]*Content,
+	order map[string]int,
 	tree *Content,
 	umask os.FileMode,
 	mtime time.Time,
+	merge bool,
 ) error {
 	if tree.Destination != "/" && tree.Destination != "" {
 		presentContent, destinationOccupied := all[NormalizeAbsoluteDirPath(tree.Destination)]
-		if destinationOccupied && presentContent.Type != TypeImplicitDir {
+		if destinationOccupied && presentContent.Type != TypeImplicitDir &&
+			!(merge && presentContent.Type == TypeDir) {
 			return contentCollisionError(tree, presentContent)
 		}
 	}
 
-	err := addParents(all, tree.Destination, mtime)
+	err := addParents(all, order, tree.Destination, mtime)
 	if err != nil {
 		return err
 	}
 
-	return filepath.WalkDir(tree.Source, func(path string, d fs.DirEntry, err error) error {
+	var preserveDirModes bool
+	dirModes := map[string]os.FileMode{}
+	if tree.FileInfo != nil {
+		preserveDirModes = tree.FileInfo.PreserveDirModes
+		for dir, mode := range tree.FileInfo.DirModes {
+			dirModes[filepath.Clean(filepath.FromSlash(dir))] = mode
+		}
+	}
+
+	walkDir := filepath.WalkDir
+	if tree.FS != nil {
+		walkDir = func(root string, fn fs.WalkDirFunc) error {
+			return fs.WalkDir(tree.FS, filepath.ToSlash(filepath.Clean(root)), fn)
+		}
+	}
+
+	return walkDir(tree.Source, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -472,6 +1022,16 @@ func addTree(
 
 		destination := filepath.Join(tree.Destination, relPath)
 
+		if d.IsDir() && relPath != "." {
+			excluded, err := glob.ExcludedDir(tree.ExcludeDirs, filepath.ToSlash(relPath))
+			if err != nil {
+				return err
+			}
+			if excluded {
+				return fs.SkipDir
+			}
+		}
+
 		if tree.Excludes != nil {
 			// Check if src matches any of the exclude patterns
 			for _, exclude := range tree.Excludes {
@@ -488,6 +1048,24 @@ func addTree(
 			c.FileInfo.Owner = tree.FileInfo.Owner
 			c.FileInfo.Group = tree.FileInfo.Group
 		}
+		if tree.FileInfo != nil {
+			c.FileInfo.PreserveMTime = tree.FileInfo.PreserveMTime
+			c.FileInfo.DefaultMode = tree.FileInfo.DefaultMode
+			c.FileInfo.DefaultDirMode = tree.FileInfo.DefaultDirMode
+			c.FileInfo.Unset = tree.FileInfo.Unset
+		}
+
+		var linkDestination string
+		isLink := d.Type()&os.ModeSymlink != 0 && tree.FS == nil
+		if isLink {
+			linkDestination, isLink, err = resolveSymlink(path, tree.SymlinkResolve)
+			if err != nil {
+				return err
+			}
+			if info, err := os.Stat(path); !isLink && err == nil && info.IsDir() {
+				linkDestination, isLink, _ = resolveSymlink(path, SymlinkResolveNone)
+			}
+		}
 
 		switch {
 		case d.IsDir():
@@ -498,29 +1076,48 @@ func addTree(
 
 			c.Type = TypeDir
 			c.Destination = NormalizeAbsoluteDirPath(destination)
-			c.FileInfo.Mode = info.Mode() &^ umask
-			c.FileInfo.MTime = info.ModTime()
-		case d.Type()&os.ModeSymlink != 0:
-			linkDestination, err := os.Readlink(path)
-			if err != nil {
-				return err
+			if c.FileInfo.DefaultDirMode == 0 || preserveDirModes {
+				c.FileInfo.Mode = info.Mode() &^ umask
 			}
-
+			c.FileInfo.MTime = info.ModTime()
+		case isLink:
 			c.Type = TypeSymlink
 			c.Source = filepath.ToSlash(strings.TrimPrefix(linkDestination, filepath.VolumeName(linkDestination)))
 			c.Destination = NormalizeAbsoluteFilePath(destination)
 		default:
-			c.Type = TypeFile
+			c.Type = typeByExtension(tree, destination, TypeFile)
 			c.Source = path
+			c.FS = tree.FS
+			c.ExpandEnv = tree.ExpandEnv
+			c.NormalizeEOL = tree.NormalizeEOL
+			c.Lang = tree.Lang
 			c.Destination = NormalizeAbsoluteFilePath(destination)
-			c.FileInfo.Mode = d.Type() &^ umask
+			// resolved symbolic links take the mode of their target
+			c.FileInfo.Mode = d.Type() &^ os.ModeSymlink &^ umask
 		}
 
-		if tree.FileInfo != nil && tree.FileInfo.Mode != 0 && c.Type != TypeSymlink {
+		if tree.FileInfo != nil && tree.FileInfo.Mode != 0 && c.Type != TypeSymlink &&
+			!(c.Type == TypeDir && preserveDirModes) {
 			c.FileInfo.Mode = tree.FileInfo.Mode
 		}
+		if mode, ok := dirModes[relPath]; ok && c.Type == TypeDir {
+			c.FileInfo.Mode = mode
+			c.FileInfo.Unset.Mode = false
+		}
+		if c.Type == TypeDir && preserveDirModes {
+			c.FileInfo.Unset.Mode = false
+		}
 
-		all[c.Destination] = c.WithFileInfoDefaults(umask, mtime)
+		if presentContent, destinationOccupied := all[c.Destination]; merge && destinationOccupied {
+			switch {
+			case c.Type == TypeDir && presentContent.Type == TypeDir:
+				return nil
+			case presentContent.Type != TypeImplicitDir:
+				return contentCollisionError(c, presentContent)
+			}
+		}
+
+		addContent(all, order, c.WithFileInfoDefaults(umask, mtime))
 
 		return nil
 	})
@@ -528,6 +1125,127 @@ func addTree(
 
 var ErrContentCollision = fmt.Errorf("content collision")
 
+// ErrEscapingSymlink happens when a symlink points outside of the directories
+// the package installs files into.
+var ErrEscapingSymlink = errors.New("symlink escapes the package tree")
+
+// EscapingSymlinks returns an error for each symlink in the given contents
+// whose target lies outside of the package's install tree. Relative targets
+// escape if they traverse above the root directory, absolute targets escape if
+// they are not located below a top-level directory that is part of the
+// package (for example /etc/foo -> /home/builder/foo in a package that only
+// installs into /etc and /usr).
+func EscapingSymlinks(contents Contents) []error {
+	roots := map[string]bool{}
+	for _, content := range contents {
+		roots[topLevelDir(content.Destination)] = true
+	}
+
+	var errs []error
+	for _, content := range contents {
+		if content.Type != TypeSymlink {
+			continue
+		}
+
+		target := ToNixPath(content.Source)
+		if !path.IsAbs(target) {
+			if !relativeLinkEscapes(path.Dir(NormalizeAbsoluteFilePath(content.Destination)), target) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%s -> %s traverses above the root directory: %w",
+				content.Destination, content.Source, ErrEscapingSymlink))
+			continue
+		}
+
+		if !roots[topLevelDir(target)] {
+			errs = append(errs, fmt.Errorf("%s -> %s: %w",
+				content.Destination, content.Source, ErrEscapingSymlink))
+		}
+	}
+
+	return errs
+}
+
+// relativeLinkEscapes reports whether resolving target relative to dir
+// traverses above the root directory.
+func relativeLinkEscapes(dir, target string) bool {
+	depth := len(strings.Split(strings.Trim(dir, "/"), "/"))
+	if dir == "/" {
+		depth = 0
+	}
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if depth == 0 {
+				return true
+			}
+			depth--
+		default:
+			depth++
+		}
+	}
+	return false
+}
+
+func topLevelDir(p string) string {
+	return strings.SplitN(strings.Trim(ToNixPath(p), "/"), "/", 2)[0]
+}
+
+// ErrNumericOwnership happens when a content is owned by a numeric user or
+// group id instead of a name.
+var ErrNumericOwnership = errors.New("owner is a numeric id")
+
+// NumericOwnership returns an error for each content whose owner or group is
+// numeric-only. Such owners are recorded as ids, see TarOwner, and their
+// meaning depends on the machine the package is installed on.
+func NumericOwnership(contents Contents) []error {
+	var errs []error
+	for _, content := range contents {
+		if content.FileInfo == nil {
+			continue
+		}
+		if isNumeric(content.FileInfo.Owner) {
+			errs = append(errs, fmt.Errorf("%s: owner %s: %w",
+				content.Destination, content.FileInfo.Owner, ErrNumericOwnership))
+		}
+		if isNumeric(content.FileInfo.Group) {
+			errs = append(errs, fmt.Errorf("%s: group %s: %w",
+				content.Destination, content.FileInfo.Group, ErrNumericOwnership))
+		}
+	}
+
+	return errs
+}
+
+func isNumeric(s string) bool {
+	_, ok := NumericID(s)
+	return ok
+}
+
+// NumericID returns the id of a numeric-only owner or group, e.g. for
+// minimal images that have no passwd entry for it.
+func NumericID(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(name, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// TarOwner returns the name and the id a tar header records for the given
+// owner or group. Numeric-only ones are recorded by id only, as there may be
+// no user or group with that name.
+func TarOwner(name string) (string, int) {
+	if id, ok := NumericID(name); ok {
+		return "", id
+	}
+	return name, 0
+}
+
 func contentCollisionError(new *Content, present *Content) error {
 	var presentSource string
 	if present.Source != "" {
@@ -565,6 +1283,25 @@ func AsRelativePath(path string) string {
 	return cleanedPath
 }
 
+// fileDestination returns the normalized destination of the content of a
+// single file. Like for the files matched by a glob, a destination ending
+// with a slash is the directory the file is put in under the name of its
+// source, or of the path of its URL source.
+func fileDestination(content *Content) string {
+	dst := content.Destination
+	if !strings.HasSuffix(dst, "/") || content.Source == "" {
+		return NormalizeAbsoluteFilePath(dst)
+	}
+	src := ToNixPath(content.Source)
+	if u, err := url.Parse(content.Source); err == nil && u.Scheme != "" && u.Host != "" {
+		src = u.Path
+	}
+	if name := path.Base(src); name != "." && name != "/" {
+		dst += name
+	}
+	return NormalizeAbsoluteFilePath(dst)
+}
+
 // NormalizeAbsoluteFilePath returns an absolute cleaned path separated by
 // slashes.
 func NormalizeAbsoluteFilePath(src string) string {
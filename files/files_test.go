@@ -1,18 +1,25 @@
 package files_test
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/glob"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -353,6 +360,107 @@ func TestCollision(t *testing.T) {
 	})
 }
 
+func TestMultipleSources(t *testing.T) {
+	writeFile := func(t *testing.T, path string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(path), 0o644))
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "out", "bin", "usr", "bin", "foo"))
+	writeFile(t, filepath.Join(dir, "out", "etc", "etc", "foo.conf"))
+	writeFile(t, filepath.Join(dir, "other", "etc", "foo.conf"))
+
+	fileDestinations := func(contents files.Contents) []string {
+		var destinations []string
+		for _, f := range contents {
+			if f.Type == files.TypeFile {
+				destinations = append(destinations, f.Destination)
+			}
+		}
+		return destinations
+	}
+
+	t.Run("merge globs", func(t *testing.T) {
+		results, err := files.PrepareForPackager(
+			files.Contents{
+				{
+					Sources: []string{
+						filepath.Join(dir, "out", "bin", "usr", "bin", "*"),
+						filepath.Join(dir, "out", "etc", "etc", "*"),
+					},
+					Destination: "/opt/foo",
+				},
+			},
+			0,
+			"",
+			false,
+			mtime,
+		)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/opt/foo/foo", "/opt/foo/foo.conf"}, fileDestinations(results))
+	})
+
+	t.Run("merge trees", func(t *testing.T) {
+		results, err := files.PrepareForPackager(
+			files.Contents{
+				{
+					Sources: []string{
+						filepath.Join(dir, "out", "bin"),
+						filepath.Join(dir, "out", "etc"),
+					},
+					Destination: "/",
+					Type:        files.TypeTree,
+				},
+			},
+			0,
+			"",
+			false,
+			mtime,
+		)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/etc/foo.conf", "/usr/bin/foo"}, fileDestinations(results))
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		_, err := files.PrepareForPackager(
+			files.Contents{
+				{
+					Sources: []string{
+						filepath.Join(dir, "out", "etc"),
+						filepath.Join(dir, "other"),
+					},
+					Destination: "/",
+					Type:        files.TypeTree,
+				},
+			},
+			0,
+			"",
+			false,
+			mtime,
+		)
+		require.ErrorIs(t, err, files.ErrContentCollision)
+	})
+
+	t.Run("src and srcs", func(t *testing.T) {
+		_, err := files.PrepareForPackager(
+			files.Contents{
+				{
+					Source:      filepath.Join(dir, "other"),
+					Sources:     []string{filepath.Join(dir, "out")},
+					Destination: "/",
+				},
+			},
+			0,
+			"",
+			false,
+			mtime,
+		)
+		require.ErrorIs(t, err, files.ErrInvalidSources)
+	})
+}
+
 func TestDisableGlobbing(t *testing.T) {
 	testCases := []files.Content{
 		{
@@ -411,6 +519,190 @@ func TestDisableGlobbing(t *testing.T) {
 	}
 }
 
+func TestContentDisableGlobbing(t *testing.T) {
+	prepare := func(contents ...*files.Content) (files.Contents, error) {
+		results, err := files.PrepareForPackager(contents, 0, "", false, mtime)
+		return withoutImplicitDirs(results), err
+	}
+
+	t.Run("literal", func(t *testing.T) {
+		results, err := prepare(
+			&files.Content{
+				Source:          "testdata/{test}/[f]oo",
+				Destination:     "/etc/foo/[f]oo",
+				DisableGlobbing: true,
+			},
+			// other contents are still globbed
+			&files.Content{
+				Source:      "testdata/globtest/*.txt",
+				Destination: "/etc/foo/",
+			},
+		)
+		require.NoError(t, err)
+		sources := map[string]string{}
+		for _, f := range results {
+			sources[f.Destination] = f.Source
+		}
+		require.Equal(t, map[string]string{
+			"/etc/foo/[f]oo": "testdata/{test}/[f]oo",
+			"/etc/foo/a.txt": "testdata/globtest/a.txt",
+		}, sources)
+	})
+
+	t.Run("globbed", func(t *testing.T) {
+		_, err := prepare(&files.Content{
+			Source:      "testdata/{test}/[f]oo",
+			Destination: "/etc/foo/[f]oo",
+		})
+		require.ErrorAs(t, err, &glob.ErrGlobNoMatch{})
+	})
+
+	t.Run("skip if missing", func(t *testing.T) {
+		results, err := prepare(&files.Content{
+			Source:          "testdata/{test}/[b]ar",
+			Destination:     "/etc/foo/[b]ar",
+			DisableGlobbing: true,
+			SkipIfMissing:   true,
+		})
+		require.NoError(t, err)
+		require.Empty(t, results)
+	})
+}
+
+func TestExpandEnv(t *testing.T) {
+	dir := t.TempDir()
+	text := filepath.Join(dir, "VERSION")
+	require.NoError(t, os.WriteFile(text, []byte("${VERSION} on ${UNSET}\nexec foo \"$@\" $1 ${1}\n"), 0o644))
+	binary := filepath.Join(dir, "foo.bin")
+	require.NoError(t, os.WriteFile(binary, []byte("\x7fELF\x00${VERSION}"), 0o755))
+	mapping := func(name string) string {
+		if name == "VERSION" {
+			return "1.2.3"
+		}
+		return ""
+	}
+
+	t.Run("text", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: text, Destination: "/usr/share/foo/VERSION", ExpandEnv: true},
+			{Source: text, Destination: "/usr/share/foo/VERSION.orig"},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		results = withoutImplicitDirs(results)
+		require.NoError(t, files.ExpandEnv(results, mapping))
+		for _, f := range results {
+			if f.Destination == "/usr/share/foo/VERSION" {
+				require.Equal(t, "1.2.3 on \nexec foo \"$@\" $1 ${1}\n", string(f.Data))
+				require.Equal(t, int64(len(f.Data)), f.FileInfo.Size)
+			} else {
+				require.Nil(t, f.Data)
+			}
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: binary, Destination: "/usr/bin/foo", ExpandEnv: true},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		err = files.ExpandEnv(results, mapping)
+		require.ErrorIs(t, err, files.ErrInvalidExpandEnv)
+		require.ErrorContains(t, err, "not a text file")
+
+		// globs pass it on to the files they match
+		results, err = files.PrepareForPackager(files.Contents{
+			{Source: filepath.Join(dir, "*.bin"), Destination: "/usr/bin/", ExpandEnv: true},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		require.ErrorIs(t, files.ExpandEnv(results, mapping), files.ErrInvalidExpandEnv)
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		tree := filepath.Join(dir, "tree")
+		require.NoError(t, os.Mkdir(tree, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(tree, "a.conf"), []byte("v=${VERSION}"), 0o644))
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: tree, Destination: "/etc/foo", Type: files.TypeTree, ExpandEnv: true},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		require.NoError(t, files.ExpandEnv(results, mapping))
+		for _, f := range results {
+			if f.Destination == "/etc/foo/a.conf" {
+				require.Equal(t, "v=1.2.3", string(f.Data))
+			}
+		}
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		_, err := files.PrepareForPackager(files.Contents{
+			{Source: "/usr/bin/foo", Destination: "/usr/bin/bar", Type: files.TypeSymlink, ExpandEnv: true},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, files.ErrInvalidExpandEnv)
+	})
+}
+
+func TestNormalizeEOL(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "foo.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\r\necho foo\r\necho bar\n"), 0o755))
+	binary := filepath.Join(dir, "foo.bin")
+	binaryData := []byte("\x7fELF\x00\r\n\x01\r\n")
+	require.NoError(t, os.WriteFile(binary, binaryData, 0o755))
+
+	normalize := func(t *testing.T, contents files.Contents) map[string]string {
+		t.Helper()
+		results, err := files.PrepareForPackager(contents, 0, "", false, mtime)
+		require.NoError(t, err)
+		require.NoError(t, files.NormalizeEOL(results))
+		bodies := map[string]string{}
+		for _, f := range withoutImplicitDirs(results) {
+			data, err := f.ReadAll()
+			require.NoError(t, err)
+			bodies[f.Destination] = string(data)
+			require.Equal(t, int64(len(data)), f.FileInfo.Size, f.Destination)
+		}
+		return bodies
+	}
+
+	t.Run("lf", func(t *testing.T) {
+		bodies := normalize(t, files.Contents{
+			{Source: script, Destination: "/usr/bin/foo", NormalizeEOL: files.EOLLF},
+			{Source: binary, Destination: "/usr/bin/foo.bin", NormalizeEOL: files.EOLLF},
+			{Source: script, Destination: "/usr/share/foo/foo.sh"},
+		})
+		require.Equal(t, "#!/bin/sh\necho foo\necho bar\n", bodies["/usr/bin/foo"])
+		require.Equal(t, string(binaryData), bodies["/usr/bin/foo.bin"])
+		require.Equal(t, "#!/bin/sh\r\necho foo\r\necho bar\n", bodies["/usr/share/foo/foo.sh"])
+	})
+
+	t.Run("crlf", func(t *testing.T) {
+		bodies := normalize(t, files.Contents{
+			{Source: script, Destination: "/usr/bin/foo", NormalizeEOL: files.EOLCRLF},
+		})
+		require.Equal(t, "#!/bin/sh\r\necho foo\r\necho bar\r\n", bodies["/usr/bin/foo"])
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		bodies := normalize(t, files.Contents{
+			{Source: filepath.Join(dir, "foo.*"), Destination: "/usr/bin/", NormalizeEOL: files.EOLLF},
+		})
+		require.Equal(t, "#!/bin/sh\necho foo\necho bar\n", bodies["/usr/bin/foo.sh"])
+		require.Equal(t, string(binaryData), bodies["/usr/bin/foo.bin"])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := files.PrepareForPackager(files.Contents{
+			{Source: script, Destination: "/usr/bin/foo", NormalizeEOL: "cr"},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, files.ErrInvalidNormalizeEOL)
+
+		_, err = files.PrepareForPackager(files.Contents{
+			{Source: "/usr/bin/foo", Destination: "/usr/bin/bar", Type: files.TypeSymlink, NormalizeEOL: files.EOLLF},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, files.ErrInvalidNormalizeEOL)
+	})
+}
+
 func withoutImplicitDirs(contents files.Contents) files.Contents {
 	filtered := make(files.Contents, 0, len(contents))
 
@@ -520,6 +812,35 @@ func TestDestEndsWithSlash(t *testing.T) {
 	require.Equal(t, "/foo/a.txt", result[0].Destination)
 }
 
+func TestLiteralDestEndsWithSlash(t *testing.T) {
+	for name, content := range map[string]*files.Content{
+		"file":     {Source: "./testdata/globtest/a.txt", Destination: "/usr/bin/", DisableGlobbing: true},
+		"config":   {Source: "./testdata/globtest/a.txt", Destination: "/usr/bin/", Type: files.TypeConfig, DisableGlobbing: true},
+		"doc":      {Source: "./testdata/globtest/a.txt", Destination: "/usr/bin/", Type: files.TypeRPMDoc},
+		"template": {Source: "./testdata/globtest/a.txt", Destination: "/usr/bin/", Type: files.TypeTemplate},
+		"url":      {Source: "https://example.com/dl/a.txt?raw=1", Destination: "/usr/bin/", Data: []byte("a")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, disableGlobbing := range []bool{false, true} {
+				result, err := files.PrepareForPackager(files.Contents{content}, 0, "rpm", disableGlobbing, mtime)
+				require.NoError(t, err)
+				result = withoutImplicitDirs(result)
+				require.Len(t, result, 1)
+				require.Equal(t, "/usr/bin/a.txt", result[0].Destination)
+			}
+		})
+	}
+
+	// symlinks and ghost files have no source file to be named after.
+	result, err := files.PrepareForPackager(files.Contents{
+		{Source: "/usr/bin/a.txt", Destination: "/usr/local/bin/", Type: files.TypeSymlink},
+		{Destination: "/var/log/foo/", Type: files.TypeRPMGhost},
+	}, 0, "rpm", false, mtime)
+	require.NoError(t, err)
+	result = withoutImplicitDirs(result)
+	require.ElementsMatch(t, []string{"/usr/local/bin", "/var/log/foo"}, []string{result[0].Destination, result[1].Destination})
+}
+
 func TestInvalidFileType(t *testing.T) {
 	var config testStruct
 	dec := yaml.NewDecoder(strings.NewReader(`---
@@ -613,6 +934,36 @@ func TestImplicitDirectories(t *testing.T) {
 	require.Equal(t, expected, withoutFileInfo(results))
 }
 
+func TestImplicitDirectoriesOfSymlinks(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{
+				Source:      "/usr/bin/foo",
+				Destination: "/usr/lib/foo/link",
+				Type:        files.TypeSymlink,
+			},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	expected := files.Contents{
+		{Destination: "/usr/", Type: files.TypeImplicitDir},
+		{Destination: "/usr/lib/", Type: files.TypeImplicitDir},
+		{Destination: "/usr/lib/foo/", Type: files.TypeImplicitDir},
+		{Source: "/usr/bin/foo", Destination: "/usr/lib/foo/link", Type: files.TypeSymlink},
+	}
+	require.Equal(t, expected, withoutFileInfo(results))
+	require.Equal(t, "root", results[2].FileInfo.Owner)
+	require.Equal(t, os.FileMode(0o755), results[2].FileInfo.Mode)
+
+	// the standard directories are not owned, the directory of the link is
+	require.Equal(t, expected[2:], withoutFileInfo(files.DisownDirectories(results, nil)))
+}
+
 func TestRelevantFiles(t *testing.T) {
 	contents := files.Contents{
 		{
@@ -687,6 +1038,26 @@ func TestRelevantFiles(t *testing.T) {
 				Destination: "/4debchangelog",
 				Type:        files.TypeDebChangelog,
 			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/6doc",
+				Type:        files.TypeFile,
+			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/7licence",
+				Type:        files.TypeFile,
+			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/8license",
+				Type:        files.TypeFile,
+			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/9readme",
+				Type:        files.TypeFile,
+			},
 		}, withoutFileInfo(results))
 	})
 
@@ -754,10 +1125,59 @@ func TestRelevantFiles(t *testing.T) {
 				Destination: "/1allpackagers",
 				Type:        files.TypeFile,
 			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/6doc",
+				Type:        files.TypeFile,
+			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/7licence",
+				Type:        files.TypeFile,
+			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/8license",
+				Type:        files.TypeFile,
+			},
+			{
+				Source:      "testdata/globtest/a.txt",
+				Destination: "/9readme",
+				Type:        files.TypeFile,
+			},
 		}, withoutFileInfo(results))
 	})
 }
 
+func TestIncludeExcludeFormats(t *testing.T) {
+	contents := files.Contents{
+		{Source: "./testdata/globtest/a.txt", Destination: "/usr/share/all"},
+		{Source: "./testdata/globtest/a.txt", Destination: "/usr/share/selinux/foo.pp", IncludeFormats: []string{"rpm"}},
+		{Source: "./testdata/globtest/a.txt", Destination: "/usr/share/not-rpm", ExcludeFormats: []string{"rpm"}},
+		{Source: "./testdata/globtest/a.txt", Destination: "/usr/share/deb-apk", IncludeFormats: []string{"deb", "apk"}, ExcludeFormats: []string{"apk"}},
+	}
+
+	for packager, expected := range map[string][]string{
+		"deb": {"/usr/share/all", "/usr/share/not-rpm", "/usr/share/deb-apk"},
+		"rpm": {"/usr/share/all", "/usr/share/selinux/foo.pp"},
+		"apk": {"/usr/share/all", "/usr/share/not-rpm"},
+		"":    {"/usr/share/all", "/usr/share/selinux/foo.pp", "/usr/share/not-rpm", "/usr/share/deb-apk"},
+	} {
+		t.Run(packager, func(t *testing.T) {
+			results, err := files.PrepareForPackager(contents, 0, packager, false, mtime)
+			require.NoError(t, err)
+
+			var dsts []string
+			for _, content := range results {
+				if content.Type != files.TypeImplicitDir {
+					dsts = append(dsts, content.Destination)
+				}
+			}
+			require.ElementsMatch(t, expected, dsts)
+		})
+	}
+}
+
 func TestTreeOwner(t *testing.T) {
 	results, err := files.PrepareForPackager(
 		files.Contents{
@@ -931,14 +1351,105 @@ func TestTreeMode(t *testing.T) {
 	}
 }
 
-func TestExcludesTree(t *testing.T) {
+func TestTreePreserveDirModes(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"private", "shared", "other"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, sub), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, sub, "file"), []byte(sub), 0o644))
+	}
+	// set explicitly, the umask applies to Mkdir
+	require.NoError(t, os.Chmod(dir, 0o755))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "private"), 0o700))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "shared"), 0o775))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "other"), 0o711))
+
+	prepare := func(t *testing.T, fi *files.ContentFileInfo) map[string]fs.FileMode {
+		t.Helper()
+		results, err := files.PrepareForPackager(
+			files.Contents{{
+				Source:      dir,
+				Destination: "/usr/share/foo",
+				Type:        files.TypeTree,
+				FileInfo:    fi,
+			}},
+			0o022,
+			"",
+			false,
+			mtime,
+		)
+		require.NoError(t, err)
+		modes := map[string]fs.FileMode{}
+		for _, f := range results {
+			modes[f.Destination] = f.FileInfo.Mode.Perm()
+		}
+		return modes
+	}
+
+	t.Run("mode", func(t *testing.T) {
+		modes := prepare(t, &files.ContentFileInfo{Mode: 0o640})
+		require.Equal(t, fs.FileMode(0o640), modes["/usr/share/foo/private/"])
+		require.Equal(t, fs.FileMode(0o640), modes["/usr/share/foo/private/file"])
+	})
+
+	t.Run("preserved", func(t *testing.T) {
+		modes := prepare(t, &files.ContentFileInfo{
+			Mode:             0o640,
+			PreserveDirModes: true,
+			DefaultDirMode:   0o750,
+			DirModes:         map[string]fs.FileMode{"./other/": 0o750},
+		})
+		require.Equal(t, map[string]fs.FileMode{
+			"/usr/":                       0o755,
+			"/usr/share/":                 0o755,
+			"/usr/share/foo/":             0o755,
+			"/usr/share/foo/private/":     0o700,
+			"/usr/share/foo/private/file": 0o640,
+			// minus the umask
+			"/usr/share/foo/shared/":     0o755,
+			"/usr/share/foo/shared/file": 0o640,
+			"/usr/share/foo/other/":      0o750,
+			"/usr/share/foo/other/file":  0o640,
+		}, modes)
+	})
+}
+
+func TestPreserveMTime(t *testing.T) {
+	dir := t.TempDir()
+	sourceMTime := time.Date(2020, 2, 2, 12, 0, 0, 0, time.UTC)
+	explicitMTime := time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"a.pem", "b.pem", filepath.Join("tree", "c.pem")} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o644))
+		require.NoError(t, os.Chtimes(path, sourceMTime, sourceMTime))
+	}
+
 	results, err := files.PrepareForPackager(
 		files.Contents{
 			{
-				Source:      filepath.Join("testdata", "tree"),
-				Destination: "/base",
+				Source:      filepath.Join(dir, "a.pem"),
+				Destination: "/etc/ssl/a.pem",
+				FileInfo:    &files.ContentFileInfo{PreserveMTime: true},
+			},
+			{
+				Source:      filepath.Join(dir, "b.pem"),
+				Destination: "/etc/ssl/b.pem",
+			},
+			{
+				Source:      filepath.Join(dir, "b.pem"),
+				Destination: "/etc/ssl/explicit.pem",
+				FileInfo:    &files.ContentFileInfo{PreserveMTime: true, MTime: explicitMTime},
+			},
+			{
+				Source:      filepath.Join(dir, "tree"),
+				Destination: "/usr/share/certs",
 				Type:        files.TypeTree,
-				Excludes:    []string{"/base/files/b"},
+				FileInfo:    &files.ContentFileInfo{PreserveMTime: true},
+			},
+			{
+				Source:      filepath.Join(dir, "*.pem"),
+				Destination: "/usr/share/globbed",
+				FileInfo:    &files.ContentFileInfo{PreserveMTime: true},
 			},
 		},
 		0,
@@ -948,51 +1459,338 @@ func TestExcludesTree(t *testing.T) {
 	)
 	require.NoError(t, err)
 
-	require.Equal(t, files.Contents{
-		{
-			Source:      "",
-			Destination: "/base/",
-			Type:        files.TypeDir,
-		},
-		{
-			Source:      "",
-			Destination: "/base/files/",
-			Type:        files.TypeDir,
-		},
-		{
-			Source:      filepath.Join("testdata", "tree", "files", "a"),
-			Destination: "/base/files/a",
-			Type:        files.TypeFile,
-		},
-		{
-			Source:      "",
-			Destination: "/base/symlinks/",
-			Type:        files.TypeDir,
-		},
-		{
-			Source:      "/etc/foo",
-			Destination: "/base/symlinks/link1",
-			Type:        files.TypeSymlink,
-		},
-		{
-			Source:      "../files/a",
-			Destination: "/base/symlinks/link2",
-			Type:        files.TypeSymlink,
-		},
-	}, withoutFileInfo(results))
+	mtimes := map[string]time.Time{}
+	for _, f := range results {
+		mtimes[f.Destination] = f.ModTime().UTC()
+	}
+	require.Equal(t, sourceMTime, mtimes["/etc/ssl/a.pem"])
+	require.Equal(t, mtime, mtimes["/etc/ssl/b.pem"])
+	require.Equal(t, explicitMTime, mtimes["/etc/ssl/explicit.pem"])
+	require.Equal(t, sourceMTime, mtimes["/usr/share/certs/c.pem"])
+	require.Equal(t, sourceMTime, mtimes["/usr/share/globbed/a.pem"])
+	require.Equal(t, sourceMTime, mtimes["/usr/share/globbed/b.pem"])
+	require.Equal(t, mtime, mtimes["/etc/ssl/"])
 }
 
-func withoutFileInfo(contents files.Contents) files.Contents {
-	filtered := make(files.Contents, 0, len(contents))
-
-	for _, c := range contents {
-		cc := *c
-		cc.FileInfo = nil
-		filtered = append(filtered, &cc)
+func TestSkipIfMissing(t *testing.T) {
+	for name, content := range map[string]*files.Content{
+		"file":    {Source: "testdata/missing", Destination: "/usr/bin/missing"},
+		"config":  {Source: "testdata/missing.conf", Destination: "/etc/missing.conf", Type: files.TypeConfig},
+		"tree":    {Source: "testdata/missing", Destination: "/usr/share/missing", Type: files.TypeTree},
+		"license": {Source: "testdata/LICENSE.commercial", Destination: "/usr/share/doc/foo/LICENSE", Type: files.TypeRPMLicense},
+		"fs":      {Source: "missing", Destination: "/usr/bin/missing", FS: fstest.MapFS{}},
+	} {
+		t.Run("absent "+name, func(t *testing.T) {
+			content.SkipIfMissing = true
+			results, err := files.PrepareForPackager(files.Contents{
+				content,
+				{Source: "testdata/globtest/a.txt", Destination: "/usr/share/foo/a.txt"},
+			}, 0, "", false, mtime)
+			require.NoError(t, err)
+			require.False(t, results.ContainsDestination(content.Destination))
+			require.True(t, results.ContainsDestination("/usr/share/foo/a.txt"))
+		})
 	}
 
-	return filtered
-}
+	t.Run("present", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: "testdata/globtest/a.txt", Destination: "/usr/share/foo/a.txt", SkipIfMissing: true},
+			{Source: "testdata/tree", Destination: "/usr/share/tree", Type: files.TypeTree, SkipIfMissing: true},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		require.True(t, results.ContainsDestination("/usr/share/foo/a.txt"))
+		require.True(t, results.ContainsDestination("/usr/share/tree/files/a"))
+	})
+
+	t.Run("absent without the flag", func(t *testing.T) {
+		_, err := files.PrepareForPackager(files.Contents{
+			{Source: "testdata/missing", Destination: "/usr/bin/missing"},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("literal brackets without globbing", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: "testdata/[missing]", Destination: "/usr/bin/missing", SkipIfMissing: true},
+		}, 0, "", true, mtime)
+		require.NoError(t, err)
+		require.False(t, results.ContainsDestination("/usr/bin/missing"))
+	})
+
+	for name, content := range map[string]*files.Content{
+		"glob":    {Source: "testdata/missing/*", Destination: "/usr/bin/"},
+		"symlink": {Source: "/usr/bin/foo", Destination: "/usr/bin/bar", Type: files.TypeSymlink},
+		"no src":  {Destination: "/usr/share/foo", Type: files.TypeTree},
+	} {
+		t.Run("invalid "+name, func(t *testing.T) {
+			content.SkipIfMissing = true
+			_, err := files.PrepareForPackager(files.Contents{content}, 0, "", false, mtime)
+			require.ErrorIs(t, err, files.ErrInvalidSkipIfMissing)
+		})
+	}
+}
+
+func TestOnEmptyGlob(t *testing.T) {
+	prepare := func(t *testing.T, policy string) (files.Contents, string, error) {
+		t.Helper()
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: "testdata/globtest/*.nope", Destination: "/usr/share/foo/", OnEmptyGlob: policy},
+			{Source: "testdata/globtest/a.txt", Destination: "/usr/share/foo/a.txt"},
+		}, 0, "", false, mtime)
+		return results, w.String(), err
+	}
+
+	for _, policy := range []string{"", files.OnEmptyGlobError} {
+		t.Run("error "+policy, func(t *testing.T) {
+			_, _, err := prepare(t, policy)
+			require.ErrorAs(t, err, &glob.ErrGlobNoMatch{})
+		})
+	}
+
+	t.Run("warn", func(t *testing.T) {
+		results, out, err := prepare(t, files.OnEmptyGlobWarn)
+		require.NoError(t, err)
+		require.True(t, results.ContainsDestination("/usr/share/foo/a.txt"))
+		require.Contains(t, out, "testdata/globtest/*.nope: no matching files, skipping")
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		results, out, err := prepare(t, files.OnEmptyGlobSkip)
+		require.NoError(t, err)
+		require.True(t, results.ContainsDestination("/usr/share/foo/a.txt"))
+		require.Empty(t, out)
+	})
+
+	t.Run("matching glob", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: "testdata/globtest/*.txt", Destination: "/usr/share/foo/", OnEmptyGlob: files.OnEmptyGlobSkip},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		require.True(t, results.ContainsDestination("/usr/share/foo/a.txt"))
+	})
+
+	t.Run("missing literal source", func(t *testing.T) {
+		_, err := files.PrepareForPackager(files.Contents{
+			{Source: "testdata/missing", Destination: "/usr/bin/missing", OnEmptyGlob: files.OnEmptyGlobSkip},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, _, err := prepare(t, "ignore")
+		require.ErrorIs(t, err, files.ErrInvalidOnEmptyGlob)
+	})
+}
+
+func TestExcludeHidden(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/.env":       {Data: []byte("e")},
+		"src/.git/HEAD":  {Data: []byte("h")},
+		"src/main.go":    {Data: []byte("m")},
+		"src/sub/sub.go": {Data: []byte("s")},
+	}
+
+	for _, excludeHidden := range []bool{false, true} {
+		t.Run(fmt.Sprintf("exclude_hidden=%v", excludeHidden), func(t *testing.T) {
+			results, err := files.PrepareForPackager(files.Contents{
+				{Source: "src/*", Destination: "/usr/share/foo", FS: fsys, ExcludeHidden: excludeHidden},
+			}, 0, "", false, mtime)
+			require.NoError(t, err)
+			require.True(t, results.ContainsDestination("/usr/share/foo/main.go"))
+			require.True(t, results.ContainsDestination("/usr/share/foo/sub/sub.go"))
+			require.Equal(t, !excludeHidden, results.ContainsDestination("/usr/share/foo/.env"))
+			require.Equal(t, !excludeHidden, results.ContainsDestination("/usr/share/foo/.git/HEAD"))
+		})
+	}
+
+	t.Run("explicit", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: "src/.env", Destination: "/etc/foo/env", FS: fsys, ExcludeHidden: true},
+		}, 0, "", false, mtime)
+		require.NoError(t, err)
+		require.True(t, results.ContainsDestination("/etc/foo/env"))
+	})
+}
+
+func TestGlobCaptures(t *testing.T) {
+	fsys := fstest.MapFS{
+		"plugins/foo/plugin.so": {Data: []byte("f")},
+		"plugins/bar/plugin.so": {Data: []byte("b")},
+	}
+
+	results, err := files.PrepareForPackager(files.Contents{
+		{Source: "plugins/*/plugin.so", Destination: "/usr/lib/myapp/plugins/$1.so", FS: fsys},
+	}, 0, "", false, mtime)
+	require.NoError(t, err)
+	require.True(t, results.ContainsDestination("/usr/lib/myapp/plugins/foo.so"))
+	require.True(t, results.ContainsDestination("/usr/lib/myapp/plugins/bar.so"))
+
+	t.Run("disabled globbing", func(t *testing.T) {
+		results, err := files.PrepareForPackager(files.Contents{
+			{Source: "plugins/foo/plugin.so", Destination: "/usr/lib/myapp/$1.so", FS: fsys},
+		}, 0, "", true, mtime)
+		require.NoError(t, err)
+		require.True(t, results.ContainsDestination("/usr/lib/myapp/$1.so"))
+	})
+}
+
+func TestParseManifest(t *testing.T) {
+	manifest := `
+# comment
+bin/foo /usr/bin/foo
+bin/bar /usr/bin/bar 0755
+etc/foo.conf /etc/foo.conf 0640 foo
+etc/bar.conf /etc/bar.conf 0640 - bar config
+"with space/a b" 'dst with space/a b' - - - doc
+with\ escape /usr/share/escape
+   indented /usr/share/indented
+`
+	contents, err := files.ParseManifest(strings.NewReader(manifest), "manifest.txt", &files.Content{
+		Packager: "deb",
+		FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app", Mode: 0o644},
+	})
+	require.NoError(t, err)
+	require.Equal(t, files.Contents{
+		{Source: "bin/foo", Destination: "/usr/bin/foo", Packager: "deb", FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app", Mode: 0o644}},
+		{Source: "bin/bar", Destination: "/usr/bin/bar", Packager: "deb", FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app", Mode: 0o755}},
+		{Source: "etc/foo.conf", Destination: "/etc/foo.conf", Packager: "deb", FileInfo: &files.ContentFileInfo{Owner: "foo", Group: "app", Mode: 0o640}},
+		{Source: "etc/bar.conf", Destination: "/etc/bar.conf", Packager: "deb", Type: files.TypeConfig, FileInfo: &files.ContentFileInfo{Owner: "app", Group: "bar", Mode: 0o640}},
+		{Source: "with space/a b", Destination: "dst with space/a b", Packager: "deb", Type: files.TypeRPMDoc, FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app", Mode: 0o644}},
+		{Source: "with escape", Destination: "/usr/share/escape", Packager: "deb", FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app", Mode: 0o644}},
+		{Source: "indented", Destination: "/usr/share/indented", Packager: "deb", FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app", Mode: 0o644}},
+	}, contents)
+
+	for line, expected := range map[string]string{
+		"bin/foo":                       "manifest.txt:2: expected src dst [mode owner group type], got 1 fields",
+		"a b 0644 root root file extra": "manifest.txt:2: expected src dst [mode owner group type], got 7 fields",
+		"a b 0999":                      `manifest.txt:2: invalid mode "0999", expected an octal mode such as 0644`,
+		"a b 17777":                     `manifest.txt:2: invalid mode "17777", expected an octal mode such as 0644`,
+		"a b - - - dir":                 `manifest.txt:2: invalid type "dir", manifests can only list contents with a source`,
+		`"a b`:                          "manifest.txt:2: unterminated quote or escape",
+	} {
+		t.Run(line, func(t *testing.T) {
+			_, err := files.ParseManifest(strings.NewReader("# header\n"+line+"\n"), "manifest.txt", &files.Content{})
+			require.ErrorIs(t, err, files.ErrInvalidManifest)
+			require.EqualError(t, err, "invalid manifest: "+expected)
+		})
+	}
+}
+
+func TestExpandManifests(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{Manifest: "testdata/manifest.txt", FileInfo: &files.ContentFileInfo{Group: "staff"}},
+			{Source: "testdata/globtest/nested/b.txt", Destination: "/usr/share/foo/b.txt"},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	byDst := map[string]*files.Content{}
+	for _, content := range results {
+		byDst[content.Destination] = content
+	}
+	require.Equal(t, "staff", byDst["/usr/share/foo/a.txt"].FileInfo.Group)
+	require.Equal(t, fs.FileMode(0o755), byDst["/usr/bin/a"].FileInfo.Mode)
+	require.Equal(t, "wheel", byDst["/usr/bin/a"].FileInfo.Group)
+	require.Equal(t, "nobody", byDst["/usr/share/foo/my file.txt"].FileInfo.Owner)
+	require.Equal(t, "testdata/with space/my file.txt", byDst["/usr/share/foo/my file.txt"].Source)
+	require.Equal(t, files.TypeConfigNoReplace, byDst["/etc/foo/b.conf"].Type)
+	require.Equal(t, fs.FileMode(0o640), byDst["/etc/foo/b.conf"].FileInfo.Mode)
+	require.Contains(t, byDst, "/usr/share/foo/b.txt")
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := files.ExpandManifests(files.Contents{{Manifest: "testdata/missing.txt"}})
+		require.ErrorIs(t, err, files.ErrInvalidManifest)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("with dst", func(t *testing.T) {
+		_, err := files.ExpandManifests(files.Contents{{Manifest: "testdata/manifest.txt", Destination: "/usr"}})
+		require.ErrorIs(t, err, files.ErrInvalidManifest)
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		contents, err := files.ExpandManifests(files.Contents{{
+			Manifest: "manifest.txt",
+			FS:       fstest.MapFS{"manifest.txt": {Data: []byte("a.txt /usr/share/a.txt\n")}},
+		}})
+		require.NoError(t, err)
+		require.Len(t, contents, 1)
+		require.NotNil(t, contents[0].FS)
+	})
+}
+
+func TestExcludesTree(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{
+				Source:      filepath.Join("testdata", "tree"),
+				Destination: "/base",
+				Type:        files.TypeTree,
+				Excludes:    []string{"/base/files/b"},
+			},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, files.Contents{
+		{
+			Source:      "",
+			Destination: "/base/",
+			Type:        files.TypeDir,
+		},
+		{
+			Source:      "",
+			Destination: "/base/files/",
+			Type:        files.TypeDir,
+		},
+		{
+			Source:      filepath.Join("testdata", "tree", "files", "a"),
+			Destination: "/base/files/a",
+			Type:        files.TypeFile,
+		},
+		{
+			Source:      "",
+			Destination: "/base/symlinks/",
+			Type:        files.TypeDir,
+		},
+		{
+			Source:      "/etc/foo",
+			Destination: "/base/symlinks/link1",
+			Type:        files.TypeSymlink,
+		},
+		{
+			Source:      "../files/a",
+			Destination: "/base/symlinks/link2",
+			Type:        files.TypeSymlink,
+		},
+	}, withoutFileInfo(results))
+}
+
+func withoutFileInfo(contents files.Contents) files.Contents {
+	filtered := make(files.Contents, 0, len(contents))
+
+	for _, c := range contents {
+		cc := *c
+		cc.FileInfo = nil
+		filtered = append(filtered, &cc)
+	}
+
+	return filtered
+}
 
 func TestAsRelativePath(t *testing.T) {
 	sep := fmt.Sprintf("%c", filepath.Separator)
@@ -1025,3 +1823,889 @@ func TestAsExplicitRelativePath(t *testing.T) {
 		assert.Equal(t, expected, files.AsExplicitRelativePath(input))
 	}
 }
+
+func TestEscapingSymlinks(t *testing.T) {
+	contents := files.Contents{
+		{Source: "../share/foo/bar", Destination: "/usr/bin/bar", Type: files.TypeSymlink},
+		{Source: "/usr/share/foo/baz", Destination: "/usr/bin/baz", Type: files.TypeSymlink},
+		{Source: "./baz", Destination: "/usr/bin/qux", Type: files.TypeSymlink},
+		{Source: "/home/builder/foo.conf", Destination: "/etc/foo.conf", Type: files.TypeSymlink},
+		{Source: "../../../../tmp/foo", Destination: "/etc/foo/foo", Type: files.TypeSymlink},
+		{Source: "../foo", Destination: "/foo", Type: files.TypeSymlink},
+		{Source: "/usr/bin/bar", Destination: "/usr/bin/safe"},
+	}
+
+	errs := files.EscapingSymlinks(contents)
+	require.Len(t, errs, 3)
+	for _, err := range errs {
+		require.ErrorIs(t, err, files.ErrEscapingSymlink)
+	}
+	require.EqualError(t, errs[0], "/etc/foo.conf -> /home/builder/foo.conf: symlink escapes the package tree")
+	require.EqualError(t, errs[1], "/etc/foo/foo -> ../../../../tmp/foo traverses above the root directory: symlink escapes the package tree")
+	require.EqualError(t, errs[2], "/foo -> ../foo traverses above the root directory: symlink escapes the package tree")
+}
+
+func TestNumericOwnership(t *testing.T) {
+	contents := files.Contents{
+		{Destination: "/etc/foo", FileInfo: &files.ContentFileInfo{Owner: "root", Group: "root"}},
+		{Destination: "/etc/bar", FileInfo: &files.ContentFileInfo{Owner: "1000", Group: "adm"}},
+		{Destination: "/etc/baz", FileInfo: &files.ContentFileInfo{Owner: "foo1", Group: "0"}},
+		{Destination: "/etc/qux"},
+	}
+
+	errs := files.NumericOwnership(contents)
+	require.Len(t, errs, 2)
+	for _, err := range errs {
+		require.ErrorIs(t, err, files.ErrNumericOwnership)
+	}
+	require.EqualError(t, errs[0], "/etc/bar: owner 1000: owner is a numeric id")
+	require.EqualError(t, errs[1], "/etc/baz: group 0: owner is a numeric id")
+}
+
+func TestWorldWritable(t *testing.T) {
+	contents := files.Contents{
+		{Destination: "/usr/share/foo/a.txt", FileInfo: &files.ContentFileInfo{Mode: 0o666}},
+		{Destination: "/usr/share/foo/b.txt", FileInfo: &files.ContentFileInfo{Mode: 0o644}},
+		{Destination: "/var/tmp/foo/", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Mode: 0o777}},
+		{Destination: "/tmp/foo", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Mode: 0o1777}},
+		{Source: "/usr/share/foo/a.txt", Destination: "/usr/bin/foo", Type: files.TypeSymlink, FileInfo: &files.ContentFileInfo{Mode: 0o777}},
+	}
+
+	errs := files.WorldWritable(contents, []string{"/tmp/*"})
+	require.Len(t, errs, 2)
+	for _, err := range errs {
+		require.ErrorIs(t, err, files.ErrWorldWritable)
+	}
+	require.EqualError(t, errs[0], "/usr/share/foo/a.txt: mode 0666 is world-writable")
+	require.EqualError(t, errs[1], "/var/tmp/foo: mode 0777 is world-writable")
+
+	require.Empty(t, files.WorldWritable(contents, []string{"/usr/share/foo/**", "/var/tmp/foo", "/tmp/foo"}))
+}
+
+func TestContentPaths(t *testing.T) {
+	contents := files.Contents{
+		{Destination: "/"},
+		{Destination: "/usr/share/foo/"},
+		{Destination: "/etc/foo\nbar.conf"},
+		{Destination: "etc/foo.conf"},
+		{Destination: "/usr/share/foo/bar/baz.txt"},
+	}
+
+	errs := files.ContentPaths(contents, 20)
+	require.Len(t, errs, 3)
+	for _, err := range errs {
+		require.ErrorIs(t, err, files.ErrInvalidContentPath)
+	}
+	require.EqualError(t, errs[0], `invalid content path "/etc/foo\nbar.conf": contains control characters`)
+	require.EqualError(t, errs[1], `invalid content path "etc/foo.conf": is not absolute`)
+	require.EqualError(t, errs[2], `invalid content path "/usr/share/foo/bar/baz.txt": is 26 bytes long, longer than the max path length of 20`)
+
+	require.Len(t, files.ContentPaths(contents, 0), 2)
+}
+
+func TestNormalizeConfigTypes(t *testing.T) {
+	for typ, expected := range map[string]struct {
+		typ       string
+		missingOK bool
+	}{
+		"config":                     {files.TypeConfig, false},
+		"config|noreplace":           {files.TypeConfigNoReplace, false},
+		"config|missingok":           {files.TypeConfig, true},
+		"config|noreplace|missingok": {files.TypeConfigNoReplace, true},
+		"config|missingok|noreplace": {files.TypeConfigNoReplace, true},
+		"file":                       {files.TypeFile, false},
+	} {
+		t.Run(typ, func(t *testing.T) {
+			contents := files.Contents{{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: typ}}
+			require.NoError(t, files.NormalizeConfigTypes(contents))
+			require.Equal(t, expected.typ, contents[0].Type)
+			require.Equal(t, expected.missingOK, contents[0].MissingOK)
+
+			// the flags are kept through the preparation
+			result, err := files.PrepareForPackager(files.Contents{{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: typ}}, 0, "rpm", false, mtime)
+			require.NoError(t, err)
+			result = withoutImplicitDirs(result)
+			require.Equal(t, expected.typ, result[0].Type)
+			require.Equal(t, expected.missingOK, result[0].MissingOK)
+		})
+	}
+
+	for _, typ := range []string{"config|verify", "config|noreplace|", "config|NoReplace"} {
+		t.Run(typ, func(t *testing.T) {
+			err := files.NormalizeConfigTypes(files.Contents{{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: typ}})
+			require.ErrorIs(t, err, files.ErrInvalidConfigType)
+		})
+	}
+	err := files.NormalizeConfigTypes(files.Contents{{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: "config|missingok|verify"}})
+	require.ErrorContains(t, err, `unknown token "verify" in type config|missingok|verify`)
+}
+
+func TestFileInfoOverrides(t *testing.T) {
+	var contents files.Contents
+	dec := yaml.NewDecoder(strings.NewReader(`---
+- src: ../testdata/fake
+  dst: /usr/bin/fake
+  file_info:
+    mode: 0755
+    group: adm
+    overrides:
+      rpm:
+        mode: 0750
+        group: wheel
+      deb:
+        owner: foo
+- src: ../testdata/whatever.conf
+  dst: /etc/foo.conf
+`))
+	require.NoError(t, dec.Decode(&contents))
+	require.Equal(t, fs.FileMode(0o750), contents[0].FileInfo.Overrides["rpm"].Mode)
+
+	type fileInfo struct {
+		Owner, Group string
+		Mode         fs.FileMode
+	}
+	for packager, expected := range map[string]fileInfo{
+		"rpm": {"root", "wheel", 0o750},
+		"deb": {"foo", "adm", 0o755},
+		"apk": {"root", "adm", 0o755},
+		"":    {"root", "adm", 0o755},
+	} {
+		t.Run(packager, func(t *testing.T) {
+			result, err := files.PrepareForPackager(contents, 0, packager, false, mtime)
+			require.NoError(t, err)
+			for _, content := range result {
+				if content.Destination != "/usr/bin/fake" {
+					continue
+				}
+				require.Equal(t, expected, fileInfo{content.FileInfo.Owner, content.FileInfo.Group, content.FileInfo.Mode})
+			}
+		})
+	}
+	// the contents are left as is, so that they can be prepared for other
+	// packagers
+	require.Equal(t, fs.FileMode(0o755), contents[0].FileInfo.Mode)
+	require.Equal(t, "adm", contents[0].FileInfo.Group)
+
+	t.Run("tree", func(t *testing.T) {
+		result, err := files.PrepareForPackager(files.Contents{{
+			Source:      "../testdata/globtest",
+			Destination: "/opt/globtest",
+			Type:        files.TypeTree,
+			FileInfo: &files.ContentFileInfo{Overrides: map[string]*files.ContentFileInfo{
+				"rpm": {Mode: 0o600},
+			}},
+		}}, 0, "rpm", false, mtime)
+		require.NoError(t, err)
+		for _, content := range result {
+			if content.Type == files.TypeFile {
+				require.Equal(t, fs.FileMode(0o600), content.FileInfo.Mode, content.Destination)
+			}
+		}
+	})
+}
+
+func TestNonRootOwnership(t *testing.T) {
+	contents := files.Contents{
+		{Destination: "/usr/bin/foo", FileInfo: &files.ContentFileInfo{Owner: "foo", Group: "root"}},
+		{Destination: "/usr/lib/foo/", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Owner: "0", Group: "foo"}},
+		{Destination: "/etc/foo/secret.conf", FileInfo: &files.ContentFileInfo{Owner: "root", Group: "foo"}},
+		{Destination: "/etc/foo/foo.conf", FileInfo: &files.ContentFileInfo{Owner: "foo", Group: "foo"}},
+		{Destination: "/var/lib/app/", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Owner: "app", Group: "app"}},
+		{Destination: "/usr/share/foo/", Type: files.TypeImplicitDir, FileInfo: &files.ContentFileInfo{Owner: "foo", Group: "foo"}},
+		{Destination: "/usr/bin/bar", FileInfo: &files.ContentFileInfo{}},
+		{Destination: "/usr/bin/baz"},
+	}
+
+	errs := files.NonRootOwnership(contents)
+	require.Len(t, errs, 3)
+	for _, err := range errs {
+		require.ErrorIs(t, err, files.ErrNonRootOwnership)
+	}
+	require.EqualError(t, errs[0], "/usr/bin/foo: owner foo: owned by non-root in a system directory")
+	require.EqualError(t, errs[1], "/usr/lib/foo/: group foo: owned by non-root in a system directory")
+	require.EqualError(t, errs[2], "/etc/foo/foo.conf: owner foo: owned by non-root in a system directory")
+}
+
+func TestSharedObjects(t *testing.T) {
+	contents := files.Contents{
+		{Source: "../testdata/shlibs/foo", Destination: "/usr/bin/foo", Type: files.TypeFile},
+		{Source: "../testdata/shlibs/libfoo.so.1.2.3", Destination: "/usr/lib/libfoo.so.1.2.3", Type: files.TypeFile},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: files.TypeConfig},
+		{Destination: "/usr/bin/fake", Data: []byte("\x7fELF\x02\x01"), Type: files.TypeFile},
+		{Source: "/usr/lib/libfoo.so.1.2.3", Destination: "/usr/lib/libfoo.so.1", Type: files.TypeSymlink},
+	}
+
+	provides, needs, err := files.SharedObjects(contents)
+	require.NoError(t, err)
+	require.Equal(t, []files.SharedObject{{Name: "libfoo.so.1", Is64Bit: true, Version: "1.2.3"}}, provides)
+	require.Equal(t, []files.SharedObject{{Name: "libbar.so.2", Is64Bit: true}}, needs)
+
+	provides, needs, err = files.SharedObjects(contents[:1])
+	require.NoError(t, err)
+	require.Empty(t, provides)
+	require.Equal(t, []files.SharedObject{{Name: "libfoo.so.1", Is64Bit: true}}, needs)
+}
+
+func TestCheckELFArch(t *testing.T) {
+	bin, err := os.ReadFile("../testdata/shlibs/foo")
+	require.NoError(t, err)
+	// patches the e_type or e_machine of the amd64 executable.
+	patched := func(offset int, value uint16) []byte {
+		data := slices.Clone(bin)
+		binary.LittleEndian.PutUint16(data[offset:], value)
+		return data
+	}
+	contents := files.Contents{
+		{Source: "../testdata/shlibs/foo", Destination: "/usr/bin/foo", Type: files.TypeFile},
+		{Source: "../testdata/shlibs/libfoo.so.1.2.3", Destination: "/usr/lib/libfoo.so.1.2.3", Type: files.TypeFile},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Type: files.TypeConfig},
+		{Destination: "/usr/lib/foo/foo.o", Data: patched(16, uint16(elf.ET_REL)), Type: files.TypeFile},
+		{Source: "/usr/lib/libfoo.so.1.2.3", Destination: "/usr/lib/libfoo.so.1", Type: files.TypeSymlink},
+	}
+
+	for _, arch := range []string{"amd64", "x86_64", "all", "noarch", "unknown"} {
+		errs, err := files.CheckELFArch(contents, arch)
+		require.NoError(t, err)
+		require.Empty(t, errs, arch)
+	}
+
+	errs, err := files.CheckELFArch(contents, "arm64")
+	require.NoError(t, err)
+	require.Len(t, errs, 2)
+	require.ErrorIs(t, errs[0], files.ErrELFArchMismatch)
+	require.EqualError(t, errs[0], "/usr/bin/foo: ELF architecture does not match the package: built for EM_X86_64 ELFCLASS64 ELFDATA2LSB, not arm64")
+	require.EqualError(t, errs[1], "/usr/lib/libfoo.so.1.2.3: ELF architecture does not match the package: built for EM_X86_64 ELFCLASS64 ELFDATA2LSB, not arm64")
+
+	arm64 := files.Contents{{Destination: "/usr/bin/foo", Data: patched(18, uint16(elf.EM_AARCH64)), Type: files.TypeFile}}
+	errs, err = files.CheckELFArch(arm64, "arm64")
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	errs, err = files.CheckELFArch(arm64, "amd64")
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], files.ErrELFArchMismatch)
+	errs, err = files.CheckELFArch(arm64, "arm7")
+	require.NoError(t, err)
+	require.Len(t, errs, 1, "the class does not match either")
+}
+
+func TestResolveOwners(t *testing.T) {
+	users, err := files.ReadIDs("../testdata/passwd")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"root": 0, "foo": 998, "bar": 1000}, users)
+	groups, err := files.ReadIDs("../testdata/group")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"root": 0, "foo": 997, "users": 100}, groups)
+
+	t.Run("resolved", func(t *testing.T) {
+		contents := files.Contents{
+			{Destination: "/etc/foo", FileInfo: &files.ContentFileInfo{Owner: "foo", Group: "users"}},
+			{Destination: "/etc/bar", FileInfo: &files.ContentFileInfo{Owner: "1234", Group: "foo"}},
+			{Destination: "/etc/qux"},
+		}
+		require.NoError(t, files.ResolveOwners(contents, users, groups))
+
+		uname, uid := contents[0].FileInfo.TarOwner()
+		require.Equal(t, "foo", uname)
+		require.Equal(t, 998, uid)
+		gname, gid := contents[0].FileInfo.TarGroup()
+		require.Equal(t, "users", gname)
+		require.Equal(t, 100, gid)
+
+		// numeric owners are kept as is
+		uname, uid = contents[1].FileInfo.TarOwner()
+		require.Empty(t, uname)
+		require.Equal(t, 1234, uid)
+		_, gid = contents[1].FileInfo.TarGroup()
+		require.Equal(t, 997, gid)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		err := files.ResolveOwners(files.Contents{
+			{Destination: "/etc/foo", FileInfo: &files.ContentFileInfo{Owner: "baz", Group: "users"}},
+		}, users, groups)
+		require.ErrorIs(t, err, files.ErrUnknownOwner)
+		require.EqualError(t, err, "unknown owner: /etc/foo: user baz")
+
+		err = files.ResolveOwners(files.Contents{
+			{Destination: "/etc/foo", FileInfo: &files.ContentFileInfo{Owner: "baz", Group: "wheel"}},
+		}, nil, groups)
+		require.EqualError(t, err, "unknown owner: /etc/foo: group wheel")
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "passwd")
+		require.NoError(t, os.WriteFile(path, []byte("root:x:0:0::/root:/bin/sh\nfoo:x:bar:0::/:/bin/sh\n"), 0o644))
+		_, err := files.ReadIDs(path)
+		require.EqualError(t, err, path+`:2: invalid id of foo: "bar"`)
+	})
+}
+
+func TestExcludeDirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/.git/HEAD":                {Data: []byte("h"), Mode: 0o644, ModTime: mtime},
+		"src/app/main.py":              {Data: []byte("m"), Mode: 0o644, ModTime: mtime},
+		"src/app/__pycache__/main.pyc": {Data: []byte("c"), Mode: 0o644, ModTime: mtime},
+	}
+	excludeDirs := []string{".git", "__pycache__"}
+
+	for name, content := range map[string]*files.Content{
+		"glob": {Source: "src/**", Destination: "/opt/foo", FS: fsys, ExcludeDirs: excludeDirs},
+		"tree": {Source: "src", Destination: "/opt/foo", Type: files.TypeTree, FS: fsys, ExcludeDirs: excludeDirs},
+	} {
+		t.Run(name, func(t *testing.T) {
+			results, err := files.PrepareForPackager(files.Contents{content}, 0, "", false, mtime)
+			require.NoError(t, err)
+			for _, c := range results {
+				require.NotContains(t, c.Destination, ".git", c.Destination)
+				require.NotContains(t, c.Destination, "__pycache__", c.Destination)
+			}
+			require.True(t, slices.ContainsFunc(results, func(c *files.Content) bool {
+				return strings.HasSuffix(c.Destination, "/main.py")
+			}))
+		})
+	}
+}
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"myapp-linux-amd64", "myctl-linux-amd64", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o755))
+	}
+	prepare := func(contents ...*files.Content) (map[string]string, error) {
+		results, err := files.PrepareForPackager(contents, 0, "", false, mtime)
+		if err != nil {
+			return nil, err
+		}
+		sources := map[string]string{}
+		for _, c := range results {
+			if c.Type != files.TypeImplicitDir {
+				sources[c.Destination] = filepath.Base(c.Source)
+			}
+		}
+		return sources, nil
+	}
+
+	t.Run("literal", func(t *testing.T) {
+		sources, err := prepare(&files.Content{
+			Source:      filepath.Join(dir, "myapp-linux-amd64"),
+			Destination: "/usr/bin/",
+			Rename:      "myapp",
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"/usr/bin/myapp": "myapp-linux-amd64"}, sources)
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		sources, err := prepare(&files.Content{
+			Source:      filepath.Join(dir, "*-linux-amd64"),
+			Destination: "/usr/bin",
+			Rename:      `{{ trimSuffix "-linux-amd64" .Name }}`,
+		}, &files.Content{
+			Source:      filepath.Join(dir, "*.md"),
+			Destination: "/usr/share/doc/myapp",
+			Rename:      `{{ .Stem | lower }}.txt`,
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"/usr/bin/myapp":                  "myapp-linux-amd64",
+			"/usr/bin/myctl":                  "myctl-linux-amd64",
+			"/usr/share/doc/myapp/readme.txt": "README.md",
+		}, sources)
+	})
+
+	t.Run("data", func(t *testing.T) {
+		sources, err := prepare(&files.Content{
+			Destination: "/etc/foo/foo.conf.example",
+			Data:        []byte("foo"),
+			Rename:      `{{ trimSuffix ".example" .Name }}`,
+		})
+		require.NoError(t, err)
+		require.Contains(t, sources, "/etc/foo/foo.conf")
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		_, err := prepare(&files.Content{
+			Source:      filepath.Join(dir, "*-linux-amd64"),
+			Destination: "/usr/bin",
+			Rename:      "myapp",
+		})
+		require.ErrorIs(t, err, files.ErrContentCollision)
+
+		_, err = prepare(&files.Content{
+			Source:      filepath.Join(dir, "myctl-linux-amd64"),
+			Destination: "/usr/bin/myctl",
+		}, &files.Content{
+			Source:      filepath.Join(dir, "myapp-linux-amd64"),
+			Destination: "/usr/bin/",
+			Rename:      `{{ replace "app" "ctl" .Name | trimSuffix "-linux-amd64" }}`,
+		})
+		require.ErrorIs(t, err, files.ErrContentCollision)
+	})
+
+	for name, content := range map[string]*files.Content{
+		"tree":      {Source: dir, Destination: "/usr/share/foo", Type: files.TypeTree, Rename: "foo"},
+		"symlink":   {Source: "/usr/bin/myapp", Destination: "/usr/bin/app", Type: files.TypeSymlink, Rename: "foo"},
+		"syntax":    {Source: filepath.Join(dir, "README.md"), Destination: "/usr/share/doc/", Rename: "{{ .Name"},
+		"field":     {Source: filepath.Join(dir, "README.md"), Destination: "/usr/share/doc/", Rename: "{{ .Path }}"},
+		"directory": {Source: filepath.Join(dir, "README.md"), Destination: "/usr/share/doc/", Rename: "foo/{{ .Name }}"},
+		"empty":     {Source: filepath.Join(dir, "README.md"), Destination: "/usr/share/doc/", Rename: `{{ trimSuffix "README.md" .Name }}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := prepare(content)
+			require.ErrorIs(t, err, files.ErrInvalidRename)
+		})
+	}
+}
+
+func TestSymlinkResolve(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "target.txt"), []byte("target"), 0o640))
+	require.NoError(t, os.Symlink("target.txt", filepath.Join(dir, "b")))
+	require.NoError(t, os.Symlink("b", filepath.Join(dir, "a")))
+
+	type entry struct {
+		typ, src string
+	}
+	prepare := func(t *testing.T, content *files.Content) map[string]entry {
+		t.Helper()
+		results, err := files.PrepareForPackager(files.Contents{content}, 0, "", false, mtime)
+		require.NoError(t, err)
+		entries := map[string]entry{}
+		for _, c := range results {
+			if c.Type == files.TypeDir || c.Type == files.TypeImplicitDir {
+				continue
+			}
+			src := c.Source
+			if c.Type != files.TypeSymlink {
+				src = filepath.Base(src)
+				require.Equal(t, fs.FileMode(0o640), c.FileInfo.Mode.Perm(), c.Destination)
+				require.Equal(t, int64(len("target")), c.FileInfo.Size, c.Destination)
+			}
+			entries[c.Destination] = entry{c.Type, src}
+		}
+		return entries
+	}
+
+	for resolve, expected := range map[string]entry{
+		"":                        {files.TypeSymlink, "b"},
+		files.SymlinkResolveNone:  {files.TypeSymlink, "b"},
+		files.SymlinkResolveFirst: {files.TypeSymlink, "target.txt"},
+		files.SymlinkResolveFull:  {files.TypeFile, "a"},
+	} {
+		t.Run("file "+resolve, func(t *testing.T) {
+			require.Equal(t, map[string]entry{"/usr/share/foo/a": expected}, prepare(t, &files.Content{
+				Source:         filepath.Join(dir, "a"),
+				Destination:    "/usr/share/foo/a",
+				SymlinkResolve: resolve,
+			}))
+		})
+	}
+
+	for resolve, expected := range map[string]map[string]entry{
+		files.SymlinkResolveNone: {
+			"/usr/share/foo/a": {files.TypeSymlink, "b"},
+			"/usr/share/foo/b": {files.TypeSymlink, "target.txt"},
+		},
+		files.SymlinkResolveFirst: {
+			"/usr/share/foo/a": {files.TypeSymlink, "target.txt"},
+			"/usr/share/foo/b": {files.TypeFile, "b"},
+		},
+		files.SymlinkResolveFull: {
+			"/usr/share/foo/a": {files.TypeFile, "a"},
+			"/usr/share/foo/b": {files.TypeFile, "b"},
+		},
+	} {
+		t.Run("tree "+resolve, func(t *testing.T) {
+			expected["/usr/share/foo/target.txt"] = entry{files.TypeFile, "target.txt"}
+			require.Equal(t, expected, prepare(t, &files.Content{
+				Source:         dir,
+				Destination:    "/usr/share/foo",
+				Type:           files.TypeTree,
+				SymlinkResolve: resolve,
+			}))
+		})
+	}
+
+	t.Run("dangling", func(t *testing.T) {
+		tree := t.TempDir()
+		require.NoError(t, os.Symlink("missing", filepath.Join(tree, "dangling")))
+		for _, resolve := range []string{files.SymlinkResolveFirst, files.SymlinkResolveFull} {
+			_, err := files.PrepareForPackager(files.Contents{
+				{Source: tree, Destination: "/usr/share/foo", Type: files.TypeTree, SymlinkResolve: resolve},
+			}, 0, "", false, mtime)
+			require.ErrorIs(t, err, files.ErrInvalidSymlinkResolve)
+		}
+		entries := prepare(t, &files.Content{Source: tree, Destination: "/usr/share/foo", Type: files.TypeTree})
+		require.Equal(t, map[string]entry{"/usr/share/foo/dangling": {files.TypeSymlink, "missing"}}, entries)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []*files.Content{
+			{Source: filepath.Join(dir, "a"), Destination: "/usr/share/foo/a", SymlinkResolve: "all"},
+			{Source: "/usr/share/foo/a", Destination: "/usr/bin/a", Type: files.TypeSymlink, SymlinkResolve: files.SymlinkResolveFull},
+		} {
+			_, err := files.PrepareForPackager(files.Contents{content}, 0, "", false, mtime)
+			require.ErrorIs(t, err, files.ErrInvalidSymlinkResolve)
+		}
+	})
+}
+
+func TestTypeByExtension(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/foo.conf":                {Data: []byte("foo=bar\n"), Mode: 0o644, ModTime: mtime},
+		"etc/foo.conf.d/a.conf":       {Data: []byte("a=b\n"), Mode: 0o644, ModTime: mtime},
+		"etc/foo.conf.d/a.conf.dpkg":  {Data: []byte("a=c\n"), Mode: 0o644, ModTime: mtime},
+		"etc/.conf":                   {Data: []byte("\n"), Mode: 0o644, ModTime: mtime},
+		"share/doc/foo/README.md":     {Data: []byte("# foo\n"), Mode: 0o644, ModTime: mtime},
+		"share/doc/foo/changes.md.gz": {Data: []byte("gz"), Mode: 0o644, ModTime: mtime},
+	}
+	mapping := map[string]string{
+		".conf":  files.TypeConfig,
+		"md":     files.TypeRPMDoc,
+		".md.gz": files.TypeFile,
+	}
+
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{Source: "etc", Destination: "/etc", Type: files.TypeTree, FS: fsys, TypeByExtension: mapping},
+			{Source: "share/doc/foo/*", Destination: "/usr/share/doc/foo/", FS: fsys, TypeByExtension: mapping},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	types := map[string]string{}
+	for _, content := range results {
+		if content.Type != files.TypeDir && content.Type != files.TypeImplicitDir {
+			types[content.Destination] = content.Type
+		}
+	}
+	require.Equal(t, map[string]string{
+		"/etc/foo.conf":                    files.TypeConfig,
+		"/etc/foo.conf.d/a.conf":           files.TypeConfig,
+		"/etc/foo.conf.d/a.conf.dpkg":      files.TypeFile,
+		"/etc/.conf":                       files.TypeFile,
+		"/usr/share/doc/foo/README.md":     files.TypeRPMDoc,
+		"/usr/share/doc/foo/changes.md.gz": files.TypeFile,
+	}, types)
+
+	t.Run("invalid type", func(t *testing.T) {
+		_, err := files.PrepareForPackager(files.Contents{
+			{Source: "etc", Destination: "/etc", Type: files.TypeTree, FS: fsys, TypeByExtension: map[string]string{".conf": files.TypeDir}},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, files.ErrInvalidTypeByExtension)
+	})
+
+	t.Run("invalid content type", func(t *testing.T) {
+		_, err := files.PrepareForPackager(files.Contents{
+			{Source: "etc/foo.conf", Destination: "/etc/foo.conf", Type: files.TypeConfig, FS: fsys, TypeByExtension: mapping},
+		}, 0, "", false, mtime)
+		require.ErrorIs(t, err, files.ErrInvalidTypeByExtension)
+	})
+}
+
+func TestMergeDir(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{Destination: "/opt/foo/conf.d", Type: files.TypeMergeDir},
+			{Destination: "/opt/foo", Type: files.TypeDir},
+			{Source: "../testdata/whatever.conf", Destination: "/opt/foo/conf.d/foo.conf"},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	var destinations []string
+	for _, f := range results {
+		destinations = append(destinations, f.Destination)
+	}
+	// the explicitly added parent is kept, the implicit ones are not
+	require.Equal(t, []string{"/opt/foo/", "/opt/foo/conf.d/foo.conf"}, destinations)
+}
+
+func TestFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bin/foo":           {Data: []byte("#!/bin/sh\n"), Mode: 0o755, ModTime: mtime},
+		"conf/foo.conf":     {Data: []byte("foo=bar\n"), Mode: 0o644, ModTime: mtime},
+		"share/foo/a.txt":   {Data: []byte("a\n"), Mode: 0o644, ModTime: mtime},
+		"share/foo/b/c.txt": {Data: []byte("c\n"), Mode: 0o600, ModTime: mtime},
+	}
+
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{Source: "bin/foo", Destination: "/usr/bin/foo", FS: fsys},
+			{Source: "conf/*.conf", Destination: "/etc/foo/", Type: files.TypeConfig, FS: fsys},
+			{Source: "./share/foo", Destination: "/usr/share/foo", Type: files.TypeTree, FS: fsys},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	bodies := map[string]string{}
+	modes := map[string]fs.FileMode{}
+	for _, content := range results {
+		if content.Type == files.TypeDir || content.Type == files.TypeImplicitDir {
+			continue
+		}
+		require.NotNil(t, content.FS, content.Destination)
+		body, err := content.ReadAll()
+		require.NoError(t, err)
+		bodies[content.Destination] = string(body)
+		modes[content.Destination] = content.Mode()
+		require.Equal(t, int64(len(body)), content.Size(), content.Destination)
+
+		r, err := content.Open()
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+	}
+	require.Equal(t, map[string]string{
+		"/usr/bin/foo":           "#!/bin/sh\n",
+		"/etc/foo/foo.conf":      "foo=bar\n",
+		"/usr/share/foo/a.txt":   "a\n",
+		"/usr/share/foo/b/c.txt": "c\n",
+	}, bodies)
+	require.Equal(t, map[string]fs.FileMode{
+		"/usr/bin/foo":           0o755,
+		"/etc/foo/foo.conf":      0o644,
+		"/usr/share/foo/a.txt":   0o644,
+		"/usr/share/foo/b/c.txt": 0o600,
+	}, modes)
+	require.True(t, results.ContainsDestination("/usr/share/foo/b/"))
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := files.PrepareForPackager(
+			files.Contents{{Source: "bin/missing", Destination: "/usr/bin/missing", FS: fsys}},
+			0,
+			"",
+			false,
+			mtime,
+		)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+}
+
+func TestAttrScriptlets(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{
+				Source:      "../testdata/whatever.conf",
+				Destination: "/etc/foo/foo.conf",
+				Type:        files.TypeConfig,
+				FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable"}},
+			},
+			{
+				Destination: "/var/log/foo",
+				Type:        files.TypeDir,
+				FileInfo:    &files.ContentFileInfo{Attrs: []string{"no-dump", "append-only"}},
+			},
+			{
+				Source:      "../testdata/whatever.conf",
+				Destination: "/etc/foo/it's.conf",
+				FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable"}},
+			},
+			{
+				Source:      "../testdata/fake",
+				Destination: "/usr/bin/fake",
+			},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	set, clear := files.AttrScriptlets(results)
+	require.Equal(t, `chattr +i '/etc/foo/foo.conf' || :
+chattr +i '/etc/foo/it'\''s.conf' || :
+chattr +ad '/var/log/foo' || :
+`, set)
+	require.Equal(t, `chattr -i '/etc/foo/foo.conf' >/dev/null 2>&1 || :
+chattr -i '/etc/foo/it'\''s.conf' >/dev/null 2>&1 || :
+chattr -ad '/var/log/foo' >/dev/null 2>&1 || :
+`, clear)
+
+	set, clear = files.AttrScriptlets(files.Contents{{Destination: "/usr/bin/fake"}})
+	require.Empty(t, set)
+	require.Empty(t, clear)
+}
+
+func TestInvalidAttrs(t *testing.T) {
+	for name, content := range map[string]*files.Content{
+		"unknown": {
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo.conf",
+			FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable", "invisible"}},
+		},
+		"symlink": {
+			Source:      "/etc/foo.conf",
+			Destination: "/etc/bar.conf",
+			Type:        files.TypeSymlink,
+			FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable"}},
+		},
+		"tree": {
+			Source:      "testdata/tree",
+			Destination: "/usr/share/foo",
+			Type:        files.TypeTree,
+			FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := files.PrepareForPackager(files.Contents{content}, 0, "", false, mtime)
+			require.ErrorIs(t, err, files.ErrInvalidAttr)
+		})
+	}
+}
+
+func TestRemoveOnScriptlets(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{
+				Destination: "/var/lib/foo",
+				Type:        files.TypeDir,
+				RemoveOn:    files.RemoveOnPurge,
+				FileInfo:    &files.ContentFileInfo{Owner: "foo", Group: "bar", Mode: 0o2750},
+			},
+			{
+				Destination: "/var/cache/foo/",
+				Type:        files.TypeDir,
+				RemoveOn:    files.RemoveOnNone,
+			},
+			{
+				Destination: "/var/log/foo",
+				Type:        files.TypeDir,
+				RemoveOn:    files.RemoveOnUninstall,
+			},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	create, purge := files.RemoveOnScriptlets(results)
+	require.Equal(t, `mkdir -p '/var/cache/foo'
+chown 'root:root' '/var/cache/foo'
+chmod 0755 '/var/cache/foo'
+mkdir -p '/var/lib/foo'
+chown 'foo:bar' '/var/lib/foo'
+chmod 2750 '/var/lib/foo'
+`, create)
+	require.Equal(t, "rmdir '/var/lib/foo' >/dev/null 2>&1 || :\n", purge)
+
+	create, purge = files.RemoveOnScriptlets(files.Contents{{Destination: "/var/log/foo", Type: files.TypeDir}})
+	require.Empty(t, create)
+	require.Empty(t, purge)
+}
+
+func TestInvalidRemoveOn(t *testing.T) {
+	for name, contents := range map[string]files.Contents{
+		"unknown": {{
+			Destination: "/var/lib/foo",
+			Type:        files.TypeDir,
+			RemoveOn:    "upgrade",
+		}},
+		"file": {{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo.conf",
+			RemoveOn:    files.RemoveOnNone,
+		}},
+		"not empty": {
+			{
+				Destination: "/var/lib/foo",
+				Type:        files.TypeDir,
+				RemoveOn:    files.RemoveOnPurge,
+			},
+			{
+				Source:      "../testdata/whatever.conf",
+				Destination: "/var/lib/foo/foo.conf",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := files.PrepareForPackager(contents, 0, "", false, mtime)
+			require.ErrorIs(t, err, files.ErrInvalidRemoveOn)
+		})
+	}
+}
+
+func TestGhostScriptlet(t *testing.T) {
+	results, err := files.PrepareForPackager(
+		files.Contents{
+			{
+				Destination: "/var/lib/foo/state",
+				Type:        files.TypeRPMGhost,
+				Touch:       true,
+				FileInfo:    &files.ContentFileInfo{Owner: "foo", Group: "bar", Mode: 0o640},
+			},
+			{
+				Destination: "/var/log/foo.log",
+				Type:        files.TypeRPMGhost,
+			},
+		},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, `if [ ! -e '/var/lib/foo/state' ] ; then
+  touch '/var/lib/foo/state'
+  chown 'foo:bar' '/var/lib/foo/state'
+  chmod 0640 '/var/lib/foo/state'
+fi
+`, files.GhostScriptlet(results))
+	require.Empty(t, files.GhostScriptlet(files.Contents{{Destination: "/var/log/foo.log", Type: files.TypeRPMGhost}}))
+
+	_, err = files.PrepareForPackager(
+		files.Contents{{Source: "../testdata/whatever.conf", Destination: "/etc/foo.conf", Touch: true}},
+		0,
+		"",
+		false,
+		mtime,
+	)
+	require.ErrorIs(t, err, files.ErrInvalidTouch)
+}
+
+func TestAppendScriptlet(t *testing.T) {
+	require.Equal(t, "", files.AppendScriptlet("", ""))
+	require.Equal(t, "snippet\n", files.AppendScriptlet("", "snippet\n"))
+	require.Equal(t, "script\n", files.AppendScriptlet("script\n", ""))
+	require.Equal(t, "script\n\nsnippet\n", files.AppendScriptlet("script", "snippet\n"))
+}
+
+func TestDataContents(t *testing.T) {
+	results, err := files.PrepareForPackager(files.Contents{
+		{Source: "https://example.com/[not a glob]", Destination: "/usr/share/foo/data", Data: []byte("data")},
+		{Source: "https://example.com/foo.conf", Destination: "/etc/foo.conf", Type: files.TypeConfig, Data: []byte("foo=bar\n"), FileInfo: &files.ContentFileInfo{Mode: 0o600}},
+	}, 0o022, "", false, mtime)
+	require.NoError(t, err)
+	for _, content := range results {
+		switch content.Destination {
+		case "/usr/share/foo/data":
+			require.Equal(t, fs.FileMode(0o644), content.Mode())
+			require.Equal(t, int64(4), content.Size())
+		case "/etc/foo.conf":
+			require.Equal(t, fs.FileMode(0o600), content.Mode())
+		}
+	}
+	require.True(t, results.ContainsDestination("/usr/share/foo/"))
+
+	_, err = files.PrepareForPackager(files.Contents{
+		{Source: "a", Destination: "/usr/share/foo/data", Data: []byte("a")},
+		{Source: "b", Destination: "/usr/share/foo/data", Data: []byte("b")},
+	}, 0, "", false, mtime)
+	require.ErrorIs(t, err, files.ErrContentCollision)
+}
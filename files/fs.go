@@ -1,6 +1,9 @@
 package files
 
-import "path/filepath"
+import (
+	"path/filepath"
+	"slices"
+)
 
 func ownedByFilesystem(path string) bool {
 	p := filepath.Clean(path)
@@ -12,6 +15,35 @@ func ownedByFilesystem(path string) bool {
 	return false
 }
 
+// StandardDirectories returns the directories which are owned by the
+// filesystem package of common distributions.
+func StandardDirectories() []string {
+	return slices.Clone(fsPaths)
+}
+
+// DisownDirectories removes the directories in dirs from the contents, so that
+// they are not owned by the package. The standard directories are used if dirs
+// is nil. Contents inside of those directories are kept.
+func DisownDirectories(contents Contents, dirs []string) Contents {
+	if dirs == nil {
+		dirs = fsPaths
+	}
+	disowned := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		disowned[NormalizeAbsoluteDirPath(dir)] = true
+	}
+
+	res := make(Contents, 0, len(contents))
+	for _, content := range contents {
+		if (content.Type == TypeDir || content.Type == TypeImplicitDir) &&
+			disowned[NormalizeAbsoluteDirPath(content.Destination)] {
+			continue
+		}
+		res = append(res, content)
+	}
+	return res
+}
+
 // from: repoquery --installed -l filesystem | while read -r f; do test -d $f && echo $f; done
 var fsPaths = []string{
 	"/afs",
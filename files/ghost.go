@@ -0,0 +1,46 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidTouch happens when Touch is set on a content that is not a ghost
+// file.
+var ErrInvalidTouch = errors.New("invalid touch")
+
+func validateTouch(content *Content) error {
+	if content.Touch && content.Type != TypeRPMGhost {
+		return fmt.Errorf("%w: %s: can only be set on contents of type %s", ErrInvalidTouch, content, TypeRPMGhost)
+	}
+	return nil
+}
+
+// GhostScriptlet returns the shell snippet that creates the empty ghost files
+// that set Touch, with their owner and mode, if they do not exist yet, for
+// the packagers without ghost files, that leave them out of the package. It is
+// empty if no ghost file sets Touch.
+func GhostScriptlet(contents Contents) string {
+	var lines []string
+	for _, content := range contents {
+		if content.Type != TypeRPMGhost || !content.Touch {
+			continue
+		}
+
+		path := ShellQuote(content.Destination)
+		lines = append(lines,
+			fmt.Sprintf("if [ ! -e %s ] ; then", path),
+			"  touch "+path,
+			fmt.Sprintf("  chown %s %s", ShellQuote(content.FileInfo.Owner+":"+content.FileInfo.Group), path),
+		)
+		if mode := uint32(content.FileInfo.Mode) & 0o7777; mode != 0 {
+			lines = append(lines, fmt.Sprintf("  chmod %04o %s", mode, path))
+		}
+		lines = append(lines, "fi")
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,22 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrInvalidLang happens when the lang of a content is not a locale name.
+var ErrInvalidLang = errors.New("invalid lang")
+
+// langRegexp matches the locale names of the contents, such as de, pt_BR or
+// sr@latin, as they are named below /usr/share/locale.
+// nolint: gochecknoglobals
+var langRegexp = regexp.MustCompile(`^[a-zA-Z]{2,3}(_[a-zA-Z0-9]{2,3})?(\.[a-zA-Z0-9-]+)?(@[a-zA-Z0-9]+)?$`)
+
+func validateLang(content *Content) error {
+	if content.Lang == "" || langRegexp.MatchString(content.Lang) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %q is not a locale name, such as de or pt_BR", ErrInvalidLang, content, content.Lang)
+}
@@ -0,0 +1,193 @@
+package files
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidManifest happens when a manifest can not be read, or one of its
+// lines is not a valid content.
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// ExpandManifests replaces each content that sets Manifest by the contents
+// listed in the manifest file, see ParseManifest. The manifest is read from
+// the FS of the content if it has one.
+func ExpandManifests(contents Contents) (Contents, error) {
+	var res Contents
+	for _, content := range contents {
+		if content.Manifest == "" {
+			res = append(res, content)
+			continue
+		}
+
+		if content.Source != "" || len(content.Sources) > 0 || content.Destination != "" {
+			return nil, fmt.Errorf("%w: %s: manifest can not be combined with src, srcs or dst", ErrInvalidManifest, content.Manifest)
+		}
+
+		var f io.ReadCloser
+		var err error
+		if content.FS != nil {
+			f, err = content.FS.Open(content.Manifest)
+		} else {
+			f, err = os.Open(content.Manifest) //nolint:gosec
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+		}
+		expanded, err := ParseManifest(f, content.Manifest, content)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, expanded...)
+	}
+	return res, nil
+}
+
+// ParseManifest parses an install list, with one content per line in the
+// form `src dst [mode owner group type]`. Empty lines and lines starting with
+// `#` are ignored, fields containing spaces can be quoted with single or
+// double quotes and optional fields can be set to `-` to keep their default.
+// The defaults are taken from base: its type, packager, formats, condition,
+// excludes, skip_if_missing, file info and file system apply to all the
+// contents of the manifest, which are not expanded with env vars. The name is
+// used in the errors.
+func ParseManifest(r io.Reader, name string, base *Content) (Contents, error) {
+	var res Contents
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		content, err := parseManifestLine(text, base)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s:%d: %w", ErrInvalidManifest, name, line, err)
+		}
+		res = append(res, content)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidManifest, name, err)
+	}
+	return res, nil
+}
+
+func parseManifestLine(line string, base *Content) (*Content, error) {
+	fields, err := splitManifestLine(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 || len(fields) > 6 {
+		return nil, fmt.Errorf("expected src dst [mode owner group type], got %d fields", len(fields))
+	}
+
+	content := &Content{
+		Source:         fields[0],
+		Destination:    fields[1],
+		Type:           base.Type,
+		Packager:       base.Packager,
+		IncludeFormats: base.IncludeFormats,
+		ExcludeFormats: base.ExcludeFormats,
+		When:           base.When,
+		Excludes:       base.Excludes,
+		SkipIfMissing:  base.SkipIfMissing,
+		OnEmptyGlob:    base.OnEmptyGlob,
+		ExcludeHidden:  base.ExcludeHidden,
+		ExcludeDirs:    base.ExcludeDirs,
+		SymlinkResolve: base.SymlinkResolve,
+		Rename:         base.Rename,
+		Lang:           base.Lang,
+		FS:             base.FS,
+	}
+	content.FileInfo = &ContentFileInfo{}
+	if base.FileInfo != nil {
+		*content.FileInfo = *base.FileInfo
+		content.FileInfo.Attrs = append([]string(nil), base.FileInfo.Attrs...)
+	}
+
+	optional := func(i int) (string, bool) {
+		if i >= len(fields) || fields[i] == "-" {
+			return "", false
+		}
+		return fields[i], true
+	}
+	if mode, ok := optional(2); ok {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || m > 0o7777 {
+			return nil, fmt.Errorf("invalid mode %q, expected an octal mode such as 0644", mode)
+		}
+		content.FileInfo.Mode = fs.FileMode(m)
+		content.FileInfo.Unset.Mode = false
+	}
+	if owner, ok := optional(3); ok {
+		content.FileInfo.Owner = owner
+		content.FileInfo.Unset.Owner = false
+	}
+	if group, ok := optional(4); ok {
+		content.FileInfo.Group = group
+		content.FileInfo.Unset.Group = false
+	}
+	if typ, ok := optional(5); ok {
+		content.Type = typ
+	}
+
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, TypeSymlink, TypeTree, TypeTemplate,
+		TypeRPMDoc, TypeRPMLicence, TypeRPMLicense, TypeRPMReadme, "":
+	default:
+		return nil, fmt.Errorf("invalid type %q, manifests can only list contents with a source", content.Type)
+	}
+	return content, nil
+}
+
+// splitManifestLine splits the line at whitespace, keeping quoted fields
+// together. Backslashes escape the next character outside of single quotes.
+func splitManifestLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			field.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inField = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				field.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inField = true
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,60 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrNonRootOwnership happens when a content of a system directory is owned
+// by a user or group other than root.
+var ErrNonRootOwnership = errors.New("owned by non-root in a system directory")
+
+// systemDirs are the directories of the executables, libraries and
+// configuration of the system, whose files are expected to be owned by root.
+// State directories such as /var or /srv, which are commonly owned by the
+// user of a service, are not among them.
+// nolint: gochecknoglobals
+var systemDirs = []string{"/bin", "/boot", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/sbin", "/usr"}
+
+// NonRootOwnership returns an error for each content of a system directory
+// whose owner or group is not root. In /etc, whose files are commonly
+// readable by the group of a service, only the owners are checked. Implicit
+// directories are owned by root and not checked.
+func NonRootOwnership(contents Contents) []error {
+	var errs []error
+	for _, content := range contents {
+		if content.FileInfo == nil || content.Type == TypeImplicitDir {
+			continue
+		}
+		dir, ok := systemDir(content.Destination)
+		if !ok {
+			continue
+		}
+		if !isRoot(content.FileInfo.Owner) {
+			errs = append(errs, fmt.Errorf("%s: owner %s: %w",
+				content.Destination, content.FileInfo.Owner, ErrNonRootOwnership))
+		}
+		if dir != "/etc" && !isRoot(content.FileInfo.Group) {
+			errs = append(errs, fmt.Errorf("%s: group %s: %w",
+				content.Destination, content.FileInfo.Group, ErrNonRootOwnership))
+		}
+	}
+	return errs
+}
+
+// systemDir returns the system directory dst is below, if any.
+func systemDir(dst string) (string, bool) {
+	dst = path.Clean("/" + ToNixPath(dst))
+	for _, dir := range systemDirs {
+		if dst == dir || strings.HasPrefix(dst, dir+"/") {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+func isRoot(name string) bool {
+	return name == "" || name == "root" || name == "0"
+}
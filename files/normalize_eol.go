@@ -0,0 +1,67 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// The line endings NormalizeEOL rewrites the text files to.
+const (
+	EOLLF   = "lf"
+	EOLCRLF = "crlf"
+	EOLNone = "none"
+)
+
+// ErrInvalidNormalizeEOL happens when NormalizeEOL is not one of the line
+// endings, or is set on a content that is not a regular file.
+var ErrInvalidNormalizeEOL = errors.New("invalid normalize_eol")
+
+func validateNormalizeEOL(content *Content) error {
+	switch content.NormalizeEOL {
+	case "", EOLNone:
+		return nil
+	case EOLLF, EOLCRLF:
+	default:
+		return fmt.Errorf("%w: %s: %q, must be one of lf, crlf or none", ErrInvalidNormalizeEOL, content, content.NormalizeEOL)
+	}
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, TypeTree, "":
+		return nil
+	default:
+		return fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidNormalizeEOL, content, content.Type)
+	}
+}
+
+// NormalizeEOL rewrites the line endings of the bodies of the files that set
+// NormalizeEOL, and replaces their sources with the result. Files that are not
+// valid UTF-8 or contain NUL bytes are considered binary and left as is.
+func NormalizeEOL(contents Contents) error {
+	for _, content := range contents {
+		if content.NormalizeEOL != EOLLF && content.NormalizeEOL != EOLCRLF {
+			continue
+		}
+		switch content.Type {
+		case TypeFile, TypeConfig, TypeConfigNoReplace:
+		default:
+			continue
+		}
+
+		data, err := content.ReadAll()
+		if err != nil {
+			return err
+		}
+		if !isText(data) {
+			continue
+		}
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		if content.NormalizeEOL == EOLCRLF {
+			data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+		}
+		content.Data = data
+		if content.FileInfo != nil {
+			content.FileInfo.Size = int64(len(content.Data))
+		}
+	}
+	return nil
+}
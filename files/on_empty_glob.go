@@ -0,0 +1,52 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goreleaser/nfpm/v2/internal/glob"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+)
+
+// The values of OnEmptyGlob.
+const (
+	// OnEmptyGlobError fails when the glob of the content matches nothing,
+	// the default.
+	OnEmptyGlobError = "error"
+	// OnEmptyGlobWarn warns and leaves the content out of the package.
+	OnEmptyGlobWarn = "warn"
+	// OnEmptyGlobSkip silently leaves the content out of the package.
+	OnEmptyGlobSkip = "skip"
+)
+
+// ErrInvalidOnEmptyGlob happens when OnEmptyGlob is not one of
+// OnEmptyGlobError, OnEmptyGlobWarn or OnEmptyGlobSkip.
+var ErrInvalidOnEmptyGlob = errors.New("invalid on_empty_glob")
+
+func validateOnEmptyGlob(content *Content) error {
+	switch content.OnEmptyGlob {
+	case "", OnEmptyGlobError, OnEmptyGlobWarn, OnEmptyGlobSkip:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s: must be one of error, warn or skip, got %q", ErrInvalidOnEmptyGlob, content, content.OnEmptyGlob)
+	}
+}
+
+// skipEmptyGlob reports whether err is the glob of the content matching
+// nothing and the content is then left out of the package, warning about it
+// if it sets OnEmptyGlobWarn.
+func skipEmptyGlob(content *Content, err error) bool {
+	var noMatch glob.ErrGlobNoMatch
+	if !errors.As(err, &noMatch) {
+		return false
+	}
+	switch content.OnEmptyGlob {
+	case OnEmptyGlobWarn:
+		warning.Warn(fmt.Sprintf("%s: %v, skipping", content, err), "path", content.Destination)
+		return true
+	case OnEmptyGlobSkip:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,95 @@
+package files
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownOwner happens when the owner or the group of a content is missing
+// from the passwd or group file it is resolved with, see ResolveOwners.
+var ErrUnknownOwner = errors.New("unknown owner")
+
+// ReadIDs reads the names and the ids of the users or groups of a file in the
+// format of passwd(5) or group(5): one entry per line, made of colon separated
+// fields whose first one is the name and third one the id. Empty lines and
+// comments are skipped.
+func ReadIDs(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint: errcheck
+
+	ids := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			return nil, fmt.Errorf("%s:%d: invalid entry: %q", path, n, line)
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid id of %s: %q", path, n, fields[0], fields[2])
+		}
+		if _, ok := ids[fields[0]]; !ok {
+			ids[fields[0]] = int(id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ResolveOwners sets the UID and GID of the contents to the ids of their
+// owners in users and of their groups in groups. Owners are not resolved if
+// users is nil, and groups if groups is nil. Numeric owners and groups are
+// kept as is.
+func ResolveOwners(contents Contents, users, groups map[string]int) error {
+	for _, content := range contents {
+		if content.FileInfo == nil {
+			continue
+		}
+		if users != nil && !isNumeric(content.FileInfo.Owner) {
+			uid, ok := users[content.FileInfo.Owner]
+			if !ok {
+				return fmt.Errorf("%w: %s: user %s", ErrUnknownOwner, content.Destination, content.FileInfo.Owner)
+			}
+			content.FileInfo.UID = uid
+		}
+		if groups != nil && !isNumeric(content.FileInfo.Group) {
+			gid, ok := groups[content.FileInfo.Group]
+			if !ok {
+				return fmt.Errorf("%w: %s: group %s", ErrUnknownOwner, content.Destination, content.FileInfo.Group)
+			}
+			content.FileInfo.GID = gid
+		}
+	}
+	return nil
+}
+
+// TarOwner returns the name and the id a tar header records for the owner:
+// numeric-only owners are recorded by id only, see TarOwner, the others by
+// name and UID.
+func (info *ContentFileInfo) TarOwner() (string, int) {
+	if name, id := TarOwner(info.Owner); name == "" {
+		return name, id
+	}
+	return info.Owner, info.UID
+}
+
+// TarGroup is like TarOwner, for the group and GID.
+func (info *ContentFileInfo) TarGroup() (string, int) {
+	if name, id := TarOwner(info.Group); name == "" {
+		return name, id
+	}
+	return info.Group, info.GID
+}
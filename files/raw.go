@@ -0,0 +1,33 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidRaw happens when Raw is set on a content that is not a regular
+// file, or along with a transformation of its body or type.
+var ErrInvalidRaw = errors.New("invalid raw")
+
+func validateRaw(content *Content) error {
+	if !content.Raw {
+		return nil
+	}
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, "":
+	default:
+		return fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidRaw, content, content.Type)
+	}
+	var transform string
+	switch {
+	case content.ExpandEnv:
+		transform = "expand_env"
+	case content.NormalizeEOL != "" && content.NormalizeEOL != EOLNone:
+		transform = "normalize_eol"
+	case len(content.TypeByExtension) > 0:
+		transform = "type_by_extension"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s: can not be combined with %s", ErrInvalidRaw, content, transform)
+}
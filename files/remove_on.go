@@ -0,0 +1,76 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// RemoveOnUninstall removes the directory, if it is empty, when the
+	// package is removed. This is the default.
+	RemoveOnUninstall = "uninstall"
+	// RemoveOnPurge keeps the directory when the package is removed, and
+	// removes it, if it is empty, only when the package is purged. Only deb
+	// packages can be purged, other packagers treat it as RemoveOnNone.
+	RemoveOnPurge = "purge"
+	// RemoveOnNone never removes the directory.
+	RemoveOnNone = "none"
+)
+
+// ErrInvalidRemoveOn happens when a content sets an unknown RemoveOn, or sets
+// it on a content that is not a directory.
+var ErrInvalidRemoveOn = errors.New("invalid remove_on")
+
+func validateRemoveOn(content *Content) error {
+	switch content.RemoveOn {
+	case "", RemoveOnUninstall:
+		return nil
+	case RemoveOnPurge, RemoveOnNone:
+	default:
+		return fmt.Errorf("%w: %s: must be one of %s, %s or %s", ErrInvalidRemoveOn, content, RemoveOnNone, RemoveOnUninstall, RemoveOnPurge)
+	}
+	if content.Type != TypeDir {
+		return fmt.Errorf("%w: %s: can only be set on contents of type %s", ErrInvalidRemoveOn, content, TypeDir)
+	}
+	return nil
+}
+
+// IsUnowned reports whether the content is a directory that is kept when the
+// package is removed. As package managers remove the directories they own,
+// it is left out of the package and created by the scriptlets returned by
+// RemoveOnScriptlets instead.
+func (c *Content) IsUnowned() bool {
+	return c.RemoveOn == RemoveOnPurge || c.RemoveOn == RemoveOnNone
+}
+
+// RemoveOnScriptlets returns the shell snippets that create the unowned
+// directories, with their owner and mode, once the package is installed, and
+// that remove the ones with RemoveOnPurge, if they are empty, when the
+// package is purged. Both are empty if there are no unowned directories.
+func RemoveOnScriptlets(contents Contents) (create, purge string) {
+	var createLines, purgeLines []string
+	for _, content := range contents {
+		if !content.IsUnowned() {
+			continue
+		}
+
+		path := ShellQuote(strings.TrimRight(content.Destination, "/"))
+		createLines = append(createLines,
+			"mkdir -p "+path,
+			fmt.Sprintf("chown %s %s", ShellQuote(content.FileInfo.Owner+":"+content.FileInfo.Group), path),
+			fmt.Sprintf("chmod %04o %s", uint32(content.FileInfo.Mode)&0o7777, path),
+		)
+		if content.RemoveOn == RemoveOnPurge {
+			purgeLines = append(purgeLines, fmt.Sprintf("rmdir %s >/dev/null 2>&1 || :", path))
+		}
+	}
+
+	if len(createLines) > 0 {
+		create = strings.Join(createLines, "\n") + "\n"
+	}
+	if len(purgeLines) > 0 {
+		purge = strings.Join(purgeLines, "\n") + "\n"
+	}
+	return create, purge
+}
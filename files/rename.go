@@ -0,0 +1,80 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// ErrInvalidRename happens when the rename template of a content can not be
+// parsed or executed, renders an invalid file name, or is set on a content
+// that is not a file.
+var ErrInvalidRename = errors.New("invalid rename")
+
+// renameFuncs are the functions of the rename templates. Like the sprig ones,
+// they take the string they transform last, so that they can be piped.
+// nolint: gochecknoglobals
+var renameFuncs = template.FuncMap{
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+}
+
+// renameData is the data the rename templates are executed with.
+type renameData struct {
+	// Name is the base name of the destination, e.g. foo.tar.gz.
+	Name string
+	// Ext is its extension, e.g. .gz, and Stem the name without it.
+	Ext  string
+	Stem string
+}
+
+func validateRename(content *Content) error {
+	if content.Rename == "" {
+		return nil
+	}
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, "":
+	default:
+		return fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidRename, content, content.Type)
+	}
+	if _, err := parseRename(content); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseRename(content *Content) (*template.Template, error) {
+	tpl, err := template.New("rename").Funcs(renameFuncs).Option("missingkey=error").Parse(content.Rename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidRename, content, err)
+	}
+	return tpl, nil
+}
+
+// renameDestination replaces the base name of dst, a destination of the
+// content, with the one its rename template renders, if it has one.
+func renameDestination(content *Content, dst string) (string, error) {
+	if content.Rename == "" {
+		return dst, nil
+	}
+	tpl, err := parseRename(content)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(dst)
+	ext := path.Ext(name)
+	var b strings.Builder
+	if err := tpl.Execute(&b, renameData{Name: name, Ext: ext, Stem: strings.TrimSuffix(name, ext)}); err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrInvalidRename, content, err)
+	}
+	renamed := b.String()
+	if renamed == "" || renamed == "." || renamed == ".." || strings.ContainsAny(renamed, `/\`) {
+		return "", fmt.Errorf("%w: %s: %q renamed to %q, which is not a file name", ErrInvalidRename, content, name, renamed)
+	}
+	return path.Join(path.Dir(dst), renamed), nil
+}
@@ -0,0 +1,110 @@
+package files
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+// SharedObject is a shared object the ELF files of a package provide or
+// need, see SharedObjects.
+type SharedObject struct {
+	// Name is the soname, e.g. libfoo.so.1.
+	Name string
+	// Is64Bit is set for the shared objects of 64-bit ELF files.
+	Is64Bit bool
+	// Version is the version in the name of the file providing the shared
+	// object, e.g. 1.2.3 for libfoo.so.1.2.3, or 0 if it has none. It is
+	// empty for the needed shared objects.
+	Version string
+}
+
+// SharedObjects scans the regular files of the contents that are ELF files
+// for the sonames they provide, their DT_SONAME, and the ones they need, their
+// DT_NEEDED, like dpkg-shlibdeps, the find-provides and find-requires of rpm,
+// or abuild do. The shared objects provided by the contents themselves are
+// not needed. Both are sorted by name.
+func SharedObjects(contents Contents) (provides, needs []SharedObject, err error) {
+	for _, content := range contents {
+		switch content.Type {
+		case TypeFile, TypeConfig, TypeConfigNoReplace, "":
+		default:
+			continue
+		}
+		f, err := openELF(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", content.Destination, err)
+		}
+		if f == nil {
+			continue
+		}
+		is64Bit := f.Class == elf.ELFCLASS64
+		if sonames, _ := f.DynString(elf.DT_SONAME); len(sonames) > 0 {
+			provides = appendSharedObject(provides, SharedObject{
+				Name:    sonames[0],
+				Is64Bit: is64Bit,
+				Version: soVersion(content.Destination),
+			})
+		}
+		needed, _ := f.ImportedLibraries()
+		for _, name := range needed {
+			needs = appendSharedObject(needs, SharedObject{Name: name, Is64Bit: is64Bit})
+		}
+	}
+
+	needs = slices.DeleteFunc(needs, func(so SharedObject) bool {
+		return slices.ContainsFunc(provides, func(provided SharedObject) bool {
+			return provided.Name == so.Name && provided.Is64Bit == so.Is64Bit
+		})
+	})
+	for _, sos := range [][]SharedObject{provides, needs} {
+		slices.SortFunc(sos, func(a, b SharedObject) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return provides, needs, nil
+}
+
+// openELF parses the content as an ELF file, or returns nil if it is not one.
+func openELF(content *Content) (*elf.File, error) {
+	r, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(elf.ELFMAG))
+	_, err = io.ReadFull(r, magic)
+	r.Close() // nolint: errcheck,gosec
+	if err != nil || string(magic) != elf.ELFMAG {
+		return nil, nil
+	}
+	data, err := content.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		// merely starting like an ELF file
+		return nil, nil
+	}
+	return f, nil
+}
+
+func appendSharedObject(sos []SharedObject, so SharedObject) []SharedObject {
+	if slices.ContainsFunc(sos, func(other SharedObject) bool {
+		return other.Name == so.Name && other.Is64Bit == so.Is64Bit
+	}) {
+		return sos
+	}
+	return append(sos, so)
+}
+
+// soVersion returns the version in the name of a shared object file, the
+// part after `.so.`, or 0 if it has none, like abuild does.
+func soVersion(dst string) string {
+	if _, version, ok := strings.Cut(path.Base(dst), ".so."); ok && version != "" {
+		return version
+	}
+	return "0"
+}
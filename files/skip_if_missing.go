@@ -0,0 +1,43 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// ErrInvalidSkipIfMissing happens when SkipIfMissing is set on a content that
+// has no literal source.
+var ErrInvalidSkipIfMissing = errors.New("invalid skip_if_missing")
+
+// isMissing reports whether the content sets SkipIfMissing and its source
+// does not exist, in which case it is left out of the package.
+func isMissing(content *Content, disableGlobbing bool) (bool, error) {
+	if !content.SkipIfMissing {
+		return false, nil
+	}
+
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, TypeTree, TypeTemplate,
+		TypeRPMDoc, TypeRPMLicence, TypeRPMLicense, TypeRPMReadme, "":
+	default:
+		return false, fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidSkipIfMissing, content, content.Type)
+	}
+	if content.Source == "" {
+		return false, fmt.Errorf("%w: %s: requires src", ErrInvalidSkipIfMissing, content)
+	}
+	// a glob that matches nothing fails with ErrGlobNoMatch instead, so that
+	// a typo in the pattern does not silently leave the files out
+	if !disableGlobbing && content.Type != TypeTree && strings.ContainsAny(content.Source, "*?[{") {
+		return false, fmt.Errorf("%w: %s: can only be set on literal sources, not on globs", ErrInvalidSkipIfMissing, content)
+	}
+
+	if _, err := content.stat(); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,114 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goreleaser/fileglob"
+	"github.com/goreleaser/nfpm/v2/internal/glob"
+)
+
+// ErrInvalidStagingRoot happens when the staging root is not a directory.
+var ErrInvalidStagingRoot = errors.New("invalid staging root")
+
+// FromStagingRoot sets the destinations of the contents without one whose
+// source is within root, a staging tree such as the DESTDIR of `make
+// install`, to their paths within root: `$root/usr/bin/foo` is installed as
+// /usr/bin/foo. A content whose source is a glob is replaced by one content
+// per file it matches, as the destinations of globbed files otherwise depend
+// on the longest common prefix of the matches. The files that are the
+// sources of other contents are left to them, e.g. to mark one of the files
+// of `$root/**` as a config file.
+func FromStagingRoot(contents Contents, root string, disableGlobbing bool) (Contents, error) {
+	if root == "" {
+		return contents, nil
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidStagingRoot, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s: not a directory", ErrInvalidStagingRoot, root)
+	}
+
+	claimed := map[string]bool{}
+	for _, content := range contents {
+		if disableGlobbing || isLiteral(content) {
+			claimed[filepath.Clean(content.Source)] = true
+		}
+	}
+
+	result := make(Contents, 0, len(contents))
+	for _, content := range contents {
+		if content.Destination != "" || !isStaged(content, root) {
+			result = append(result, content)
+			continue
+		}
+		if disableGlobbing || isLiteral(content) {
+			cc := *content
+			cc.Destination = stagedDestination(root, content.Source)
+			result = append(result, &cc)
+			continue
+		}
+
+		globbed, err := glob.GlobExcludeDirs(nil, filepath.ToSlash(content.Source), "/", false, !content.ExcludeHidden, content.ExcludeDirs)
+		if err != nil {
+			var noMatch glob.ErrGlobNoMatch
+			if !errors.As(err, &noMatch) {
+				return nil, err
+			}
+			// the contents are prepared with the on_empty_glob of the
+			// content.
+			cc := *content
+			cc.Destination = "/"
+			result = append(result, &cc)
+			continue
+		}
+		sources := make([]string, 0, len(globbed))
+		for src := range globbed {
+			if !claimed[filepath.Clean(src)] {
+				sources = append(sources, src)
+			}
+		}
+		sort.Strings(sources)
+		for _, src := range sources {
+			cc := *content
+			cc.Source = src
+			cc.Destination = stagedDestination(root, src)
+			cc.DisableGlobbing = true
+			result = append(result, &cc)
+		}
+	}
+	return result, nil
+}
+
+// isStaged reports whether the source of the content is a file, or a glob, of
+// the staging root.
+func isStaged(content *Content, root string) bool {
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, TypeTree, "":
+	default:
+		return false
+	}
+	if content.FS != nil || content.Data != nil || content.Source == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, content.Source)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isLiteral reports whether the source of the content is a single file or
+// directory rather than a glob.
+func isLiteral(content *Content) bool {
+	return content.DisableGlobbing || !fileglob.ContainsMatchers(filepath.ToSlash(content.Source))
+}
+
+func stagedDestination(root, src string) string {
+	rel, _ := filepath.Rel(root, src)
+	return path.Join("/", filepath.ToSlash(rel))
+}
@@ -0,0 +1,87 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The values of Content.SymlinkResolve, which tell what becomes of the
+// sources that are symbolic links.
+const (
+	// SymlinkResolveNone recreates the symbolic link as is. It is the
+	// default.
+	SymlinkResolveNone = "none"
+	// SymlinkResolveFirst resolves one level of a chain of symbolic links:
+	// the link is recreated pointing to the target of its target, or the
+	// content of its target is packaged if the target is no symbolic link.
+	SymlinkResolveFirst = "first"
+	// SymlinkResolveFull follows the whole chain and packages the content of
+	// its final target.
+	SymlinkResolveFull = "full"
+)
+
+// ErrInvalidSymlinkResolve happens when the symlink_resolve of a content is
+// unknown, set on a content that is neither a file nor a tree, or when a
+// chain of symbolic links can not be resolved.
+var ErrInvalidSymlinkResolve = errors.New("invalid symlink_resolve")
+
+func validateSymlinkResolve(content *Content) error {
+	switch content.SymlinkResolve {
+	case "":
+		return nil
+	case SymlinkResolveNone, SymlinkResolveFirst, SymlinkResolveFull:
+	default:
+		return fmt.Errorf("%w: %s: %q, must be one of %s, %s or %s", ErrInvalidSymlinkResolve,
+			content, content.SymlinkResolve, SymlinkResolveNone, SymlinkResolveFirst, SymlinkResolveFull)
+	}
+	switch content.Type {
+	case TypeFile, TypeConfig, TypeConfigNoReplace, TypeTree, "":
+		return nil
+	default:
+		return fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidSymlinkResolve, content, content.Type)
+	}
+}
+
+// resolveSymlink tells what becomes of the source src given the resolve mode,
+// see Content.SymlinkResolve: if it is to be packaged as a symbolic link, its
+// target is returned along with true. Otherwise the content of src, which may
+// not be a symbolic link at all, is packaged.
+func resolveSymlink(src, resolve string) (string, bool, error) {
+	target, err := os.Readlink(src)
+	if err != nil {
+		// not a symbolic link
+		return "", false, nil
+	}
+	switch resolve {
+	case SymlinkResolveFirst:
+		next, err := os.Readlink(joinLinkTarget(filepath.Dir(src), target))
+		if err == nil {
+			if !filepath.IsAbs(next) {
+				next = filepath.Clean(joinLinkTarget(filepath.Dir(target), next))
+			}
+			return next, true, nil
+		}
+		if _, err := os.Stat(src); err != nil {
+			return "", false, fmt.Errorf("%w: %s: %w", ErrInvalidSymlinkResolve, src, err)
+		}
+		return "", false, nil
+	case SymlinkResolveFull:
+		if _, err := os.Stat(src); err != nil {
+			return "", false, fmt.Errorf("%w: %s: %w", ErrInvalidSymlinkResolve, src, err)
+		}
+		return "", false, nil
+	default:
+		return target, true, nil
+	}
+}
+
+// joinLinkTarget returns the path target, the target of a symbolic link in
+// dir, refers to.
+func joinLinkTarget(dir, target string) string {
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(dir, target)
+}
@@ -0,0 +1,49 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrInvalidTypeByExtension happens when TypeByExtension maps an extension to
+// a type that is not one of a file, or is set on a content that is neither a
+// file nor a tree.
+var ErrInvalidTypeByExtension = errors.New("invalid type_by_extension")
+
+func validateTypeByExtension(content *Content) error {
+	if len(content.TypeByExtension) == 0 {
+		return nil
+	}
+	switch content.Type {
+	case TypeFile, TypeTree, "":
+	default:
+		return fmt.Errorf("%w: %s: can not be set on contents of type %s", ErrInvalidTypeByExtension, content, content.Type)
+	}
+	for ext, typ := range content.TypeByExtension {
+		switch typ {
+		case TypeFile, TypeConfig, TypeConfigNoReplace, TypeRPMDoc, TypeRPMLicence, TypeRPMLicense, TypeRPMReadme:
+		default:
+			return fmt.Errorf("%w: %s: %s: can not be mapped to type %s", ErrInvalidTypeByExtension, content, ext, typ)
+		}
+	}
+	return nil
+}
+
+// typeByExtension returns the type of the file at dst expanded from the
+// content: the type its extension is mapped to, the longest extension
+// winning, or typ if none is.
+func typeByExtension(content *Content, dst, typ string) string {
+	name := path.Base(dst)
+	var longest string
+	for ext, t := range content.TypeByExtension {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) > len(longest) && len(ext) < len(name) && strings.HasSuffix(name, ext) {
+			longest, typ = ext, t
+		}
+	}
+	return typ
+}
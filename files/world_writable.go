@@ -0,0 +1,40 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ErrWorldWritable happens when a content is writable by others.
+var ErrWorldWritable = errors.New("world-writable")
+
+// WorldWritable returns an error for each content, symlinks aside, that is
+// writable by others and does not match one of the allowlist patterns, see
+// MatchesPath.
+func WorldWritable(contents Contents, allowlist []string) []error {
+	var errs []error
+	for _, content := range contents {
+		if content.Type == TypeSymlink || content.FileInfo == nil || content.FileInfo.Mode&0o002 == 0 {
+			continue
+		}
+		dst := path.Clean(NormalizeAbsoluteFilePath(content.Destination))
+		if slices.ContainsFunc(allowlist, func(pattern string) bool { return MatchesPath(pattern, dst) }) {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: mode %04o is %w", dst, uint32(content.FileInfo.Mode.Perm()), ErrWorldWritable))
+	}
+	return errs
+}
+
+// MatchesPath matches dst against pattern with path.Match, a trailing /**
+// matching all the paths below the directory.
+func MatchesPath(pattern, dst string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return strings.HasPrefix(dst, dir+"/")
+	}
+	ok, _ := path.Match(pattern, dst)
+	return ok
+}
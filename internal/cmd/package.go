@@ -16,6 +16,7 @@ type packageCmd struct {
 	config   string
 	target   string
 	packager string
+	snapshot bool
 }
 
 func newPackageCmd() *packageCmd {
@@ -29,12 +30,12 @@ func newPackageCmd() *packageCmd {
 		Args:              cobra.NoArgs,
 		ValidArgsFunction: cobra.NoFileCompletions,
 		RunE: func(*cobra.Command, []string) error {
-			return doPackage(root.config, root.target, root.packager)
+			return doPackage(root.config, root.target, root.packager, root.snapshot)
 		},
 	}
 
 	cmd.Flags().StringVarP(&root.config, "config", "f", "nfpm.yaml", "config file to be used")
-	_ = cmd.MarkFlagFilename("config", "yaml", "yml")
+	_ = cmd.MarkFlagFilename("config", "yaml", "yml", "toml", "json")
 	cmd.Flags().StringVarP(&root.target, "target", "t", "", "where to save the generated package (filename, folder or empty for current folder)")
 	_ = cmd.MarkFlagFilename("target")
 	cmd.Flags().StringVarP(&root.packager, "packager", "p", "", "which packager implementation to use [apk|deb|rpm|archlinux]")
@@ -42,6 +43,7 @@ func newPackageCmd() *packageCmd {
 		[]string{"apk", "deb", "rpm", "archlinux"},
 		cobra.ShellCompDirectiveNoFileComp,
 	))
+	cmd.Flags().BoolVar(&root.snapshot, "snapshot", false, "create a snapshot build, whose version sorts below the configured one")
 
 	root.cmd = cmd
 	return root
@@ -50,7 +52,7 @@ func newPackageCmd() *packageCmd {
 var errInsufficientParams = errors.New("a packager must be specified if target is a directory or blank")
 
 // nolint:funlen
-func doPackage(configPath, target, packager string) error {
+func doPackage(configPath, target, packager string, snapshot bool) error {
 	targetIsADirectory := false
 	stat, err := os.Stat(target)
 	if err == nil && stat.IsDir() {
@@ -71,6 +73,9 @@ func doPackage(configPath, target, packager string) error {
 	if err != nil {
 		return err
 	}
+	if snapshot && config.Snapshot == nil {
+		config.Snapshot = &nfpm.Snapshot{}
+	}
 
 	info, err := config.Get(packager)
 	if err != nil {
@@ -95,19 +100,13 @@ func doPackage(configPath, target, packager string) error {
 		target = path.Join(target, pkg.ConventionalFileName(info))
 	}
 
-	f, err := os.Create(target)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	info.Target = target
-
-	if err := pkg.Package(info, f); err != nil {
-		os.Remove(target)
+	if err := nfpm.PackageFile(info, packager, target, nfpm.WriteOptions{
+		Atomic:    true,
+		Overwrite: true,
+	}); err != nil {
 		return err
 	}
 
 	fmt.Printf("created package: %s\n", target)
-	return f.Close()
+	return nil
 }
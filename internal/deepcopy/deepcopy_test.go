@@ -0,0 +1,67 @@
+package deepcopy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type inner struct {
+	Names []string
+}
+
+type outer struct {
+	Name     string
+	Inner    inner
+	Pointer  *inner
+	Pointers []*inner
+	Map      map[string][]string
+	Array    [2][]int
+	Func     func() string
+	Any      any
+	Time     time.Time
+	private  []string
+}
+
+func TestCopy(t *testing.T) {
+	now := time.Now()
+	orig := &outer{
+		Name:     "foo",
+		Inner:    inner{Names: []string{"a"}},
+		Pointer:  &inner{Names: []string{"b"}},
+		Pointers: []*inner{{Names: []string{"c"}}},
+		Map:      map[string][]string{"d": {"e"}},
+		Array:    [2][]int{{1}, {2}},
+		Func:     func() string { return "func" },
+		Any:      "any",
+		Time:     now,
+		private:  []string{"f"},
+	}
+
+	cp := Copy(orig)
+	require.NotSame(t, orig, cp)
+	require.Equal(t, "foo", cp.Name)
+	require.Equal(t, "func", cp.Func())
+	require.Equal(t, "any", cp.Any)
+	require.True(t, now.Equal(cp.Time))
+
+	cp.Inner.Names[0] = "changed"
+	cp.Pointer.Names[0] = "changed"
+	cp.Pointers[0].Names[0] = "changed"
+	cp.Map["d"][0] = "changed"
+	cp.Map["new"] = nil
+	cp.Array[0][0] = 0
+	require.Equal(t, []string{"a"}, orig.Inner.Names)
+	require.Equal(t, []string{"b"}, orig.Pointer.Names)
+	require.Equal(t, []string{"c"}, orig.Pointers[0].Names)
+	require.Equal(t, map[string][]string{"d": {"e"}}, orig.Map)
+	require.Equal(t, [2][]int{{1}, {2}}, orig.Array)
+
+	// unexported fields are shared
+	require.Equal(t, []string{"f"}, cp.private)
+
+	var nilPtr *outer
+	require.Nil(t, Copy(nilPtr))
+	require.Nil(t, Copy(outer{}).Map)
+}
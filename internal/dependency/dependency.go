@@ -0,0 +1,231 @@
+// Package dependency checks the relationships of packages, such as their
+// dependencies and conflicts, against each other and against the package
+// itself.
+package dependency
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Package is the package whose relationships are checked.
+type Package struct {
+	Name       string
+	Version    string
+	Epoch      string
+	Prerelease string
+	Release    string
+	Depends    []string
+	Conflicts  []string
+	Breaks     []string
+	Provides   []string
+}
+
+// Error happens when the version constraints on a package can not be
+// satisfied together, or contradict the package itself.
+type Error struct {
+	Name   string
+	Reason string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("invalid dependency on %q: %s", e.Name, e.Reason)
+}
+
+// nolint: gochecknoglobals
+var dependencyRegexp = regexp.MustCompile(`^([^\s<>=!()|]+(?:\([^\s()]*\))?)\s*(?:\(\s*(<<|>>|<=|>=|==|=|<|>)\s*([^\s()]+)\s*\)|(<<|>>|<=|>=|==|=|<|>)\s*([^\s()]+))?$`)
+
+// versionRange is the range of versions a dependency such as `foo >= 1.0`
+// allows, unbounded on the sides whose version is empty.
+type versionRange struct {
+	min, max                   string
+	minInclusive, maxInclusive bool
+}
+
+// parseDependency parses dependencies in the syntax shared by the packagers,
+// e.g. `foo`, `foo >= 1.0`, `foo (>= 1.0)` or `foo(x86-64) = 1.0`. It reports
+// false for the ones it does not understand, such as alternatives or rich
+// dependencies, which are hence not checked.
+func parseDependency(dep string) (name string, r versionRange, ok bool) {
+	m := dependencyRegexp.FindStringSubmatch(strings.TrimSpace(dep))
+	if m == nil {
+		return "", versionRange{}, false
+	}
+	op, version := m[2]+m[4], m[3]+m[5]
+	switch op {
+	case ">=":
+		r = versionRange{min: version, minInclusive: true}
+	case ">", ">>":
+		r = versionRange{min: version}
+	case "<=":
+		r = versionRange{max: version, maxInclusive: true}
+	case "<", "<<":
+		r = versionRange{max: version}
+	case "=", "==":
+		r = versionRange{min: version, max: version, minInclusive: true, maxInclusive: true}
+	}
+	return m[1], r, true
+}
+
+// intersect returns the versions allowed by both ranges, as compared by
+// compare.
+func (r versionRange) intersect(other versionRange, compare func(a, b string) int) versionRange {
+	if other.min != "" {
+		if c := compare(other.min, r.min); r.min == "" || c > 0 || (c == 0 && !other.minInclusive) {
+			r.min, r.minInclusive = other.min, other.minInclusive
+		}
+	}
+	if other.max != "" {
+		if c := compare(other.max, r.max); r.max == "" || c < 0 || (c == 0 && !other.maxInclusive) {
+			r.max, r.maxInclusive = other.max, other.maxInclusive
+		}
+	}
+	return r
+}
+
+func (r versionRange) empty(compare func(a, b string) int) bool {
+	if r.min == "" || r.max == "" {
+		return false
+	}
+	c := compare(r.min, r.max)
+	return c > 0 || (c == 0 && !(r.minInclusive && r.maxInclusive))
+}
+
+// contains reports whether all versions of the other range are in r.
+func (r versionRange) contains(other versionRange, compare func(a, b string) int) bool {
+	return r.intersect(other, compare) == other
+}
+
+// Validate checks that the constraints of the dependencies of the package
+// can be satisfied together, and that no package is both a dependency and a
+// conflict or broken for all the versions depended on, see also
+// validateSelf. Versions are compared by compare, such as vercmp.Deb.
+func Validate(pkg Package, compare func(a, b string) int) error {
+	if err := validateSelf(pkg, compare); err != nil {
+		return err
+	}
+	type constraint struct {
+		dep string
+		r   versionRange
+	}
+	depends := map[string][]constraint{}
+	ranges := map[string]versionRange{}
+	for _, dep := range pkg.Depends {
+		name, r, ok := parseDependency(dep)
+		if !ok {
+			continue
+		}
+		for _, other := range depends[name] {
+			if other.r.intersect(r, compare).empty(compare) {
+				return Error{
+					Name:   name,
+					Reason: fmt.Sprintf("%q and %q can not both be satisfied", other.dep, dep),
+				}
+			}
+		}
+		depends[name] = append(depends[name], constraint{dep, r})
+		ranges[name] = ranges[name].intersect(r, compare)
+	}
+
+	for _, list := range []struct {
+		field string
+		deps  []string
+	}{
+		{"conflicts", pkg.Conflicts},
+		{"breaks", pkg.Breaks},
+	} {
+		for _, dep := range list.deps {
+			name, r, ok := parseDependency(dep)
+			if !ok {
+				continue
+			}
+			if constraints, ok := depends[name]; ok && r.contains(ranges[name], compare) {
+				return Error{
+					Name:   name,
+					Reason: fmt.Sprintf("%q contradicts %s entry %q", constraints[0].dep, list.field, dep),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSelf checks that the package neither depends on itself,
+// nor conflicts with or breaks its own version, nor provides its own name at
+// another version than its own. Versions without a release are compared to
+// the version of the package without its release, as rpm does.
+func validateSelf(pkg Package, compare func(a, b string) int) error {
+	if pkg.Name == "" {
+		return nil
+	}
+	for _, dep := range pkg.Depends {
+		if name, _, ok := parseDependency(dep); ok && name == pkg.Name {
+			return Error{
+				Name:   name,
+				Reason: fmt.Sprintf("the package depends on itself with %q", dep),
+			}
+		}
+	}
+	for _, list := range []struct {
+		field string
+		deps  []string
+	}{
+		{"conflicts", pkg.Conflicts},
+		{"breaks", pkg.Breaks},
+	} {
+		for _, dep := range list.deps {
+			if name, r, ok := parseDependency(dep); ok && name == pkg.Name && r.containsOwnVersion(pkg, compare) {
+				return Error{
+					Name:   name,
+					Reason: fmt.Sprintf("%s entry %q matches the package itself", list.field, dep),
+				}
+			}
+		}
+	}
+	for _, dep := range pkg.Provides {
+		name, r, ok := parseDependency(dep)
+		if !ok || name != pkg.Name || r == (versionRange{}) || pkg.Version == "" {
+			continue
+		}
+		if !r.containsOwnVersion(pkg, compare) {
+			return Error{
+				Name:   name,
+				Reason: fmt.Sprintf("the package provides its own name with %q, which does not match its version %s", dep, ownVersion(pkg, true)),
+			}
+		}
+	}
+	return nil
+}
+
+// containsOwnVersion reports whether the version of the package is
+// in the range, which is always the case for packages without a version and
+// unversioned ranges.
+func (r versionRange) containsOwnVersion(pkg Package, compare func(a, b string) int) bool {
+	if pkg.Version == "" || r == (versionRange{}) {
+		return true
+	}
+	bound := r.min
+	if bound == "" {
+		bound = r.max
+	}
+	version := ownVersion(pkg, strings.Contains(bound, "-"))
+	own := versionRange{min: version, max: version, minInclusive: true, maxInclusive: true}
+	return !r.intersect(own, compare).empty(compare)
+}
+
+// ownVersion returns the version of the package as dependencies on it
+// spell it, with or without its release.
+func ownVersion(pkg Package, withRelease bool) string {
+	version := pkg.Version
+	if pkg.Epoch != "" {
+		version = pkg.Epoch + ":" + version
+	}
+	if pkg.Prerelease != "" {
+		version += "~" + pkg.Prerelease
+	}
+	if withRelease && pkg.Release != "" {
+		version += "-" + pkg.Release
+	}
+	return version
+}
@@ -0,0 +1,121 @@
+// Package download fetches the http:// and https:// sources of contents,
+// retrying the failed attempts with an exponential backoff.
+//
+// Network errors, 429 Too Many Requests and 5xx responses are retried, any
+// other response is final. The Retry-After header of 429 and 503 responses
+// takes precedence over the backoff.
+package download
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBackoff is the wait before the first retry if Options.Backoff is
+// not set.
+const DefaultBackoff = time.Second
+
+// Options configure Get.
+type Options struct {
+	// Retries is the number of attempts made after the first one fails.
+	Retries int
+	// Timeout limits each attempt, including reading the body. Zero means
+	// no limit.
+	Timeout time.Duration
+	// Backoff is the wait before the first retry, doubled for each of the
+	// following ones.
+	Backoff time.Duration
+}
+
+// IsURL reports whether the source is an http:// or https:// URL.
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// StatusError is the error of an attempt that got a response other than
+// 200 OK.
+type StatusError struct {
+	Status     string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// Get returns the body of the given URL. Once all attempts failed, the error
+// holds the URL, the number of attempts and the error of the last one, which
+// is a StatusError if the server responded.
+func Get(url string, opts Options) ([]byte, error) {
+	client := &http.Client{Timeout: opts.Timeout}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+
+	var attempt int
+	for {
+		attempt++
+		body, wait, err := get(client, url)
+		if err == nil {
+			return body, nil
+		}
+		if wait < 0 || attempt > opts.Retries {
+			return nil, fmt.Errorf("%s: giving up after %d attempt(s): %w", url, attempt, err)
+		}
+		if wait == 0 {
+			wait = backoff << (attempt - 1)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// get makes a single attempt. On failure, it returns how long to wait for
+// before retrying: a negative wait if the error is final, or zero to use the
+// backoff.
+func get(client *http.Client, url string) ([]byte, time.Duration, error) {
+	resp, err := client.Get(url) // nolint:noctx
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		err := StatusError{Status: resp.Status, StatusCode: resp.StatusCode}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			return nil, retryAfter(resp.Header.Get("Retry-After")), err
+		case resp.StatusCode >= 500:
+			return nil, 0, err
+		default:
+			return nil, -1, err
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, 0, nil
+}
+
+// retryAfter parses a Retry-After header, which is either a number of
+// seconds or a date. It returns zero if there is none or it cannot be parsed.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
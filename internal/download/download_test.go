@@ -0,0 +1,105 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer fails the first requests with the given statuses, then serves
+// the body.
+func flakyServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestGet(t *testing.T) {
+	opts := Options{Retries: 3, Backoff: time.Millisecond}
+
+	t.Run("success", func(t *testing.T) {
+		srv, requests := flakyServer(t, nil)
+		body, err := Get(srv.URL, opts)
+		require.NoError(t, err)
+		require.Equal(t, "body", string(body))
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		srv, requests := flakyServer(t, nil, http.StatusBadGateway, http.StatusTooManyRequests, http.StatusInternalServerError)
+		body, err := Get(srv.URL, opts)
+		require.NoError(t, err)
+		require.Equal(t, "body", string(body))
+		require.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("giving up", func(t *testing.T) {
+		srv, requests := flakyServer(t, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable)
+		_, err := Get(srv.URL, opts)
+		require.EqualError(t, err, srv.URL+": giving up after 4 attempt(s): unexpected status: 503 Service Unavailable")
+		var status StatusError
+		require.ErrorAs(t, err, &status)
+		require.Equal(t, http.StatusServiceUnavailable, status.StatusCode)
+		require.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("final status", func(t *testing.T) {
+		srv, requests := flakyServer(t, nil, http.StatusNotFound)
+		_, err := Get(srv.URL, opts)
+		require.EqualError(t, err, srv.URL+": giving up after 1 attempt(s): unexpected status: 404 Not Found")
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		srv, requests := flakyServer(t, nil, http.StatusBadGateway)
+		_, err := Get(srv.URL, Options{})
+		require.Error(t, err)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		srv, requests := flakyServer(t, http.Header{"Retry-After": {"1"}}, http.StatusServiceUnavailable)
+		start := time.Now()
+		body, err := Get(srv.URL, opts)
+		require.NoError(t, err)
+		require.Equal(t, "body", string(body))
+		require.Equal(t, int32(2), requests.Load())
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		t.Cleanup(srv.Close)
+		_, err := Get(srv.URL, Options{Timeout: 10 * time.Millisecond})
+		require.ErrorContains(t, err, "giving up after 1 attempt(s)")
+		require.ErrorContains(t, err, "Timeout")
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Zero(t, retryAfter(""))
+	require.Zero(t, retryAfter("soon"))
+	require.Zero(t, retryAfter("0"))
+	require.Equal(t, 2*time.Second, retryAfter("2"))
+	require.Zero(t, retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	wait := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	require.Greater(t, wait, 59*time.Minute)
+}
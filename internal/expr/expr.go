@@ -0,0 +1,233 @@
+// Package expr evaluates the conditions of contents, such as
+// `Arch == "arm64" && Format == "rpm"`.
+//
+// A condition compares strings, which are either double quoted literals,
+// variables or environment variables written as Env.NAME, with == and !=, and
+// combines the comparisons with !, && and || and parentheses. There are no
+// other operators, so evaluating a condition has no side effects.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrSyntax happens when a condition cannot be parsed.
+var ErrSyntax = errors.New("syntax error")
+
+// ErrUnknownVariable happens when a condition refers to a variable that is not
+// defined.
+var ErrUnknownVariable = errors.New("unknown variable")
+
+// Eval evaluates the condition with the given variables, looking up the
+// environment variables with env.
+func Eval(condition string, vars map[string]string, env func(string) string) (bool, error) {
+	tokens, err := tokenize(condition)
+	if err != nil {
+		return false, err
+	}
+	p := &parser{tokens: tokens, vars: vars, env: env}
+	result, err := p.or()
+	if err != nil {
+		return false, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return false, fmt.Errorf("%w: unexpected %s", ErrSyntax, tok)
+	}
+	return result, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of condition"
+	case tokenString:
+		return strconv.Quote(t.value)
+	default:
+		return fmt.Sprintf("%q", t.value)
+	}
+}
+
+// nolint: gochecknoglobals
+var operators = []string{"==", "!=", "&&", "||", "!", "(", ")"}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrSyntax)
+			}
+			value, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrSyntax, s[i:end+1])
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value})
+			i = end + 1
+		case c == '_' || unicode.IsLetter(c):
+			end := i
+			for end < len(s) && (s[end] == '_' || s[end] == '.' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: s[i:end]})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, c)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, value: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]string
+	env    func(string) string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.value == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// or parses `and ('||' and)*`. Both sides are always parsed, so that syntax
+// errors are reported regardless of the values.
+func (p *parser) or() (bool, error) {
+	result, err := p.and()
+	if err != nil {
+		return false, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+// and parses `not ('&&' not)*`.
+func (p *parser) and() (bool, error) {
+	result, err := p.not()
+	if err != nil {
+		return false, err
+	}
+	for p.accept("&&") {
+		right, err := p.not()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+// not parses `'!' not | '(' or ')' | comparison`.
+func (p *parser) not() (bool, error) {
+	if p.accept("!") {
+		result, err := p.not()
+		return !result, err
+	}
+	if p.accept("(") {
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+		if !p.accept(")") {
+			return false, fmt.Errorf("%w: expected \")\", got %s", ErrSyntax, p.peek())
+		}
+		return result, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses `operand ('==' | '!=') operand`.
+func (p *parser) comparison() (bool, error) {
+	left, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case p.accept("=="):
+		right, err := p.operand()
+		return left == right, err
+	case p.accept("!="):
+		right, err := p.operand()
+		return left != right, err
+	default:
+		return false, fmt.Errorf("%w: expected \"==\" or \"!=\", got %s", ErrSyntax, p.peek())
+	}
+}
+
+func (p *parser) operand() (string, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString:
+		return tok.value, nil
+	case tokenIdent:
+		if name, ok := strings.CutPrefix(tok.value, "Env."); ok && name != "" && !strings.Contains(name, ".") {
+			return p.env(name), nil
+		}
+		value, ok := p.vars[tok.value]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnknownVariable, tok.value)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("%w: expected a string or a variable, got %s", ErrSyntax, tok)
+	}
+}
@@ -0,0 +1,72 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]string{
+		"Arch":    "arm64",
+		"Format":  "rpm",
+		"Version": "1.2.3",
+	}
+	env := func(name string) string {
+		if name == "FLAVOR" {
+			return "minimal"
+		}
+		return ""
+	}
+
+	for condition, expected := range map[string]bool{
+		`Arch == "arm64"`:                                         true,
+		`Arch != "arm64"`:                                         false,
+		`"rpm" == Format`:                                         true,
+		`Arch == "arm64" && Format == "rpm"`:                      true,
+		`Arch == "arm64" && Format == "deb"`:                      false,
+		`Arch == "amd64" || Format == "rpm"`:                      true,
+		`Arch == "amd64" || Format == "deb"`:                      false,
+		`!(Format == "deb")`:                                      true,
+		`!Format == "rpm"`:                                        false,
+		`Format == "deb" || Format == "rpm" && Arch == "arm64"`:   true,
+		`(Format == "deb" || Format == "rpm") && Arch == "amd64"`: false,
+		`Version == "1.2.3"`:                                      true,
+		`Env.FLAVOR == "minimal"`:                                 true,
+		`Env.UNSET == ""`:                                         true,
+		`Arch == "arm\x36\x34"`:                                   true,
+		`Format=="rpm"&&Arch!="amd64"`:                            true,
+	} {
+		t.Run(condition, func(t *testing.T) {
+			result, err := Eval(condition, vars, env)
+			require.NoError(t, err)
+			require.Equal(t, expected, result)
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	vars := map[string]string{"Arch": "arm64"}
+	env := func(string) string { return "" }
+
+	for condition, expected := range map[string]error{
+		``:                                 ErrSyntax,
+		`Arch`:                             ErrSyntax,
+		`Arch = "arm64"`:                   ErrSyntax,
+		`Arch == "arm64`:                   ErrSyntax,
+		`Arch == "arm64" &&`:               ErrSyntax,
+		`(Arch == "arm64"`:                 ErrSyntax,
+		`Arch == "arm64")`:                 ErrSyntax,
+		`Arch == "arm64" "amd64"`:          ErrSyntax,
+		`Arch == == "arm64"`:               ErrSyntax,
+		`Arch == 'arm64'`:                  ErrSyntax,
+		`Os == "linux"`:                    ErrUnknownVariable,
+		`Env. == ""`:                       ErrUnknownVariable,
+		`Arch == "amd64" || Os == "linux"`: ErrUnknownVariable,
+	} {
+		t.Run(condition, func(t *testing.T) {
+			_, err := Eval(condition, vars, env)
+			require.ErrorIs(t, err, expected)
+		})
+	}
+}
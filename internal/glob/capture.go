@@ -0,0 +1,141 @@
+package glob
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// captureRef matches the references to the matchers of the pattern in a
+// templated destination, e.g. `$1` or `${1}`.
+var captureRef = regexp.MustCompile(`\$(\d+|\{\d+\})`)
+
+// hasCaptureRefs reports whether dst references the matchers of the pattern,
+// see captureTemplate.
+func hasCaptureRefs(dst string) bool {
+	return captureRef.MatchString(dst)
+}
+
+// captureTemplate maps matched files to a destination that references what
+// the matchers of the pattern matched: `$1` is replaced by the part of the
+// path matched by the first matcher (`*`, `**`, `?`, a character class or
+// an alternative), `$2` by the second one and so on. Files within a matched
+// directory are placed below the destination of the directory.
+type captureTemplate struct {
+	pattern string
+	re      *regexp.Regexp
+	dst     string
+	// seen maps the destinations to the file mapped to them first.
+	seen map[string]string
+}
+
+func newCaptureTemplate(pattern, dst string) (*captureTemplate, error) {
+	expr, groups, err := captureRegexp(path.Clean(filepath.ToSlash(pattern)))
+	if err != nil {
+		return nil, fmt.Errorf("glob failed: %s: %w", pattern, err)
+	}
+	for _, ref := range captureRef.FindAllStringSubmatch(dst, -1) {
+		n, _ := strconv.Atoi(strings.Trim(ref[1], "{}"))
+		if n == 0 || n > groups {
+			return nil, fmt.Errorf("glob failed: %s: %s: the pattern has %d matcher(s)", pattern, ref[0], groups)
+		}
+	}
+	re, err := regexp.Compile("^" + expr + "(/.*)?$")
+	if err != nil {
+		return nil, fmt.Errorf("glob failed: %s: %w", pattern, err)
+	}
+	return &captureTemplate{
+		pattern: pattern,
+		re:      re,
+		dst:     dst,
+		seen:    map[string]string{},
+	}, nil
+}
+
+// destination returns the destination of the matched file src. It fails if
+// another file was already mapped to it.
+func (t *captureTemplate) destination(src string) (string, error) {
+	match := t.re.FindStringSubmatch(path.Clean(filepath.ToSlash(src)))
+	if match == nil {
+		return "", fmt.Errorf("glob failed: %s: cannot capture the matchers in %s", t.pattern, src)
+	}
+	dst := captureRef.ReplaceAllStringFunc(t.dst, func(ref string) string {
+		n, _ := strconv.Atoi(strings.Trim(ref[1:], "{}"))
+		return match[n]
+	})
+	if rest := match[len(match)-1]; rest != "" {
+		dst = path.Join(dst, rest)
+	} else if strings.HasSuffix(dst, "/") {
+		dst = path.Join(dst, path.Base(src))
+	}
+	dst = path.Clean(dst)
+
+	if other, ok := t.seen[dst]; ok {
+		return "", fmt.Errorf("glob failed: %s: %s and %s are both mapped to %s", t.pattern, other, src, dst)
+	}
+	t.seen[dst] = src
+	return dst, nil
+}
+
+// captureRegexp translates a glob pattern into a regular expression with a
+// group for each matcher, and returns it along with the number of groups.
+func captureRegexp(pattern string) (string, int, error) {
+	var expr strings.Builder
+	var groups int
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '*':
+			groups++
+			switch {
+			case strings.HasPrefix(pattern[i:], "**/"):
+				// also matches no directory at all
+				expr.WriteString("((?:.*/)?)")
+				i += 2
+			case strings.HasPrefix(pattern[i:], "**"):
+				expr.WriteString("(.*)")
+				i++
+			default:
+				expr.WriteString("([^/]*)")
+			}
+		case '?':
+			groups++
+			expr.WriteString("([^/])")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", 0, errors.New("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			groups++
+			expr.WriteString("([" + strings.ReplaceAll(class, `\`, `\\`) + "])")
+			i += end + 1
+		case '{':
+			end := strings.IndexByte(pattern[i+1:], '}')
+			if end < 0 {
+				return "", 0, errors.New("unterminated alternative")
+			}
+			alternatives := strings.Split(pattern[i+1:i+1+end], ",")
+			for j, alternative := range alternatives {
+				alternatives[j] = regexp.QuoteMeta(alternative)
+			}
+			groups++
+			expr.WriteString("(" + strings.Join(alternatives, "|") + ")")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String(), groups, nil
+}
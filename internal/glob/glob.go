@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -52,77 +53,214 @@ func (e ErrGlobNoMatch) Error() string {
 	return fmt.Sprintf("glob failed: %s: no matching files", e.glob)
 }
 
+// Glob returns the files matched by pattern, mapped to their destination
+// below dst. If dst references the matchers of the pattern with `$1`, `$2`
+// and so on, or `${1}`, the destination of each file is dst with the
+// references replaced by what the respective matcher matched, e.g. pattern
+// `plugins/*/plugin.so` and dst `/usr/lib/foo/$1.so` map
+// `plugins/bar/plugin.so` to `/usr/lib/foo/bar.so`, and two files mapped to
+// the same destination are an error. Matchers match hidden files, i.e. files with a path element that
+// starts with a dot, just like any other file, so `src/*` matches `src/.env`
+// and a directory includes its hidden files, see GlobIncludeHidden.
 func Glob(pattern, dst string, ignoreMatchers bool) (map[string]string, error) {
-	return globCommon(pattern, dst, ignoreMatchers, nil)
+	return globCommon(nil, pattern, dst, ignoreMatchers, nil, nil, nil, false, true)
+}
+
+// GlobFS is like Glob, but matches the pattern against the files of fsys, e.g.
+// an embed.FS or an os.DirFS, instead of the OS file system. The pattern and
+// the returned sources are relative to the root of fsys, so patterns may
+// neither be absolute nor start with "../". Symbolic links are followed, as
+// fs.FS provides no way to read them. A nil fsys globs the OS file system,
+// just as Glob does.
+func GlobFS(fsys fs.FS, pattern, dst string, ignoreMatchers bool) (map[string]string, error) {
+	return globCommon(fsys, pattern, dst, ignoreMatchers, nil, nil, nil, false, true)
+}
+
+// GlobIncludeHidden is like GlobFS, but leaves out hidden files unless
+// includeHidden is set. A file is hidden if a path element below the
+// directory the pattern starts to match in starts with a dot, and it is only
+// kept if that element is matched by an element of the pattern which starts
+// with a dot itself, e.g. `src/.env`, `src/.*` or `**/.config`.
+func GlobIncludeHidden(fsys fs.FS, pattern, dst string, ignoreMatchers, includeHidden bool) (map[string]string, error) {
+	return globCommon(fsys, pattern, dst, ignoreMatchers, nil, nil, nil, false, includeHidden)
+}
+
+// GlobExcludeDirs is like GlobIncludeHidden, but also prunes the directories
+// below the directory the pattern starts to match in, or below the pattern if
+// it is a directory, that are matched by one of excludeDirs, leaving everything within them out, see ExcludedDir. They
+// are pruned before the longest common prefix is computed, so that they do
+// not change the destinations of the remaining files.
+func GlobExcludeDirs(fsys fs.FS, pattern, dst string, ignoreMatchers, includeHidden bool, excludeDirs []string) (map[string]string, error) {
+	return globCommon(fsys, pattern, dst, ignoreMatchers, nil, excludeDirs, nil, false, includeHidden)
 }
 
 func GlobExcludes(pattern, dst string, excludes []string) (map[string]string, error) {
-	return globCommon(pattern, dst, false, excludes)
+	return globCommon(nil, pattern, dst, false, excludes, nil, nil, false, true)
+}
+
+// Filter decides whether a globbed file should be kept. It is called with the
+// path and the (not followed) file info of each matched file.
+type Filter func(path string, info fs.FileInfo) bool
+
+// GlobWithFilter is like Glob, but drops all matched files for which filter
+// returns false, e.g. files over a certain size, VCS metadata or sockets.
+//
+// Note that the longest common prefix is computed over the filtered matches,
+// so filtering files out may change the destinations of the remaining files.
+func GlobWithFilter(pattern, dst string, filter Filter) (map[string]string, error) {
+	return globCommon(nil, pattern, dst, false, nil, nil, filter, false, true)
+}
+
+// GlobNoCrossSymlink is like Glob, but does not descend into symbolic links
+// to directories: they are returned as files themselves, so that the tree
+// they point to is not included by accident. Only symbolic links within the
+// directory the first path element with matchers is in, or within the parent
+// of the pattern if it has none, are affected, so a pattern can still name a
+// symbolic link explicitly, e.g. `link/*`.
+func GlobNoCrossSymlink(pattern, dst string, ignoreMatchers bool) (map[string]string, error) {
+	return globCommon(nil, pattern, dst, ignoreMatchers, nil, nil, nil, true, true)
+}
+
+// GlobWalk is like Glob, but calls fn with the source and destination of each
+// match instead of returning them all in a map, stopping at the first error
+// fn returns. As the destinations depend on the longest common prefix of all
+// matches, the matched paths are still collected first, but the destinations
+// are only computed as fn is called, so that huge trees do not need to be
+// held in memory twice.
+func GlobWalk(pattern, dst string, fn func(src, dst string) error) error {
+	return walkCommon(nil, pattern, dst, false, nil, nil, nil, false, true, fn)
 }
 
 // Glob returns a map with source file path as keys and destination as values.
 // First the longest common prefix (lcp) of all globbed files is found. The destination
 // for each globbed file is then dst joined with src with the lcp trimmed off.
-func globCommon(pattern, dst string, ignoreMatchers bool, excludes []string) (map[string]string, error) {
+// Files are looked up in fsys, or in the OS file system if fsys is nil.
+func globCommon(fsys fs.FS, pattern, dst string, ignoreMatchers bool, excludes, excludeDirs []string, filter Filter, noCrossSymlink, includeHidden bool) (map[string]string, error) {
+	files := make(map[string]string)
+	err := walkCommon(fsys, pattern, dst, ignoreMatchers, excludes, excludeDirs, filter, noCrossSymlink, includeHidden, func(src, dst string) error {
+		files[src] = dst
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func walkCommon(fsys fs.FS, pattern, dst string, ignoreMatchers bool, excludes, excludeDirs []string, filter Filter, noCrossSymlink, includeHidden bool, fn func(src, dst string) error) error {
 	options := []fileglob.OptFunc{fileglob.MatchDirectoryIncludesContents}
 	if ignoreMatchers {
 		options = append(options, fileglob.QuoteMeta)
 	}
 
-	if strings.HasPrefix(pattern, "../") {
-		p, err := filepath.Abs(pattern)
-		if err != nil {
-			return nil, fmt.Errorf("failed to resolve pattern: %s: %w", pattern, err)
+	if fsys != nil {
+		if strings.HasPrefix(pattern, "/") || pattern == ".." || strings.HasPrefix(pattern, "../") {
+			return fmt.Errorf("glob failed: %s: pattern must be relative to the file system", pattern)
+		}
+		options = append(options, fileglob.WithFs(fsys))
+	} else {
+		if strings.HasPrefix(pattern, "../") {
+			p, err := filepath.Abs(pattern)
+			if err != nil {
+				return fmt.Errorf("failed to resolve pattern: %s: %w", pattern, err)
+			}
+			pattern = filepath.ToSlash(p)
 		}
-		pattern = filepath.ToSlash(p)
+		options = append(options, fileglob.MaybeRootFS)
 	}
 
-	matches, err := fileglob.Glob(pattern, append(options, fileglob.MaybeRootFS)...)
+	matches, err := fileglob.Glob(pattern, options...)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, err
+			return err
 		}
 
-		return nil, fmt.Errorf("glob failed: %s: %w", pattern, err)
+		return fmt.Errorf("glob failed: %s: %w", pattern, err)
+	}
+
+	if noCrossSymlink {
+		matches, err = uncrossSymlinks(staticRoot(pattern, ignoreMatchers), matches)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(excludeDirs) > 0 {
+		matches, err = pruneDirs(pattern, ignoreMatchers, excludeDirs, matches)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !includeHidden {
+		matches, err = dropHidden(pattern, ignoreMatchers, matches)
+		if err != nil {
+			return err
+		}
+	}
+
+	if filter != nil {
+		matches, err = filterMatches(fsys, matches, filter)
+		if err != nil {
+			return err
+		}
 	}
 
 	if len(matches) == 0 {
-		return nil, ErrGlobNoMatch{pattern}
+		return ErrGlobNoMatch{pattern}
+	}
+
+	var capture *captureTemplate
+	if !ignoreMatchers && hasCaptureRefs(dst) {
+		if capture, err = newCaptureTemplate(pattern, dst); err != nil {
+			return err
+		}
 	}
 
-	files := make(map[string]string)
 	prefix := pattern
 	// the prefix may not be a complete path or may use glob patterns, in that case use the parent directory
-	if _, err := os.Stat(prefix); errors.Is(err, fs.ErrNotExist) || (fileglob.ContainsMatchers(pattern) && !ignoreMatchers) {
+	if _, err := stat(fsys, prefix); errors.Is(err, fs.ErrNotExist) || (fileglob.ContainsMatchers(pattern) && !ignoreMatchers) {
 		prefix = filepath.Dir(longestCommonPrefix(matches))
 	}
 
 	for _, src := range matches {
 		// only include files
-		if f, err := os.Stat(src); err == nil && f.Mode().IsDir() {
+		statFn := stat
+		if noCrossSymlink {
+			statFn = lstat
+		}
+		if f, err := statFn(fsys, src); err == nil && f.Mode().IsDir() {
 			continue
 		}
 
-		if strings.HasSuffix(dst, "/") {
-			files[src] = filepath.Join(dst, filepath.Base(src))
+		if capture == nil && strings.HasSuffix(dst, "/") {
+			if err := fn(src, filepath.Join(dst, filepath.Base(src))); err != nil {
+				return err
+			}
 			continue
 		}
 
-		relpath, err := filepath.Rel(prefix, src)
-		if err != nil {
-			// since prefix is a prefix of src a relative path should always be found
-			return nil, err
+		var dst_relpath string
+		if capture != nil {
+			if dst_relpath, err = capture.destination(src); err != nil {
+				return err
+			}
+		} else {
+			relpath, err := filepath.Rel(prefix, src)
+			if err != nil {
+				// since prefix is a prefix of src a relative path should always be found
+				return err
+			}
+			dst_relpath = filepath.Join(dst, relpath)
 		}
 
-		dst_relpath := filepath.Join(dst, relpath)
-
 		// Check if src matches any of the exclude patterns
 		if excludes != nil {
 			excluded := false
 			for _, exclude := range excludes {
 				matched, err := filepath.Match(exclude, dst_relpath)
 				if err != nil {
-					return nil, fmt.Errorf("failed to match exclude pattern: %s: %w", exclude, err)
+					return fmt.Errorf("failed to match exclude pattern: %s: %w", exclude, err)
 				}
 				if matched {
 					excluded = true
@@ -134,9 +272,198 @@ func globCommon(pattern, dst string, ignoreMatchers bool, excludes []string) (ma
 			}
 		}
 
-		globdst := filepath.ToSlash(dst_relpath)
-		files[src] = globdst
+		if err := fn(src, filepath.ToSlash(dst_relpath)); err != nil {
+			return err
+		}
 	}
 
-	return files, nil
+	return nil
+}
+
+func filterMatches(fsys fs.FS, matches []string, filter Filter) ([]string, error) {
+	var filtered []string
+	for _, match := range matches {
+		info, err := lstat(fsys, match)
+		if err != nil {
+			return nil, fmt.Errorf("glob failed: %s: %w", match, err)
+		}
+		if filter(match, info) {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, nil
+}
+
+// dropHidden removes the hidden files the pattern does not name explicitly
+// from matches, see GlobIncludeHidden.
+func dropHidden(pattern string, ignoreMatchers bool, matches []string) ([]string, error) {
+	root := staticRoot(pattern, ignoreMatchers)
+	var explicit []string
+	if rel, err := filepath.Rel(root, pattern); err == nil {
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+				explicit = append(explicit, part)
+			}
+		}
+	}
+	isExplicit := func(name string) bool {
+		for _, part := range explicit {
+			if ignoreMatchers {
+				if part == name {
+					return true
+				}
+				continue
+			}
+			if ok, _ := path.Match(part, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result []string
+	for _, match := range matches {
+		rel, err := filepath.Rel(root, match)
+		if err != nil {
+			return nil, fmt.Errorf("glob failed: %s: %w", match, err)
+		}
+		hidden := false
+		for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+			if strings.HasPrefix(name, ".") && name != "." && name != ".." && !isExplicit(name) {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			result = append(result, match)
+		}
+	}
+	return result, nil
+}
+
+// ExcludedDir reports whether the directory at rel, a slash separated path
+// relative to the root of a glob or tree, is matched by one of excludeDirs:
+// patterns without a slash, e.g. `.git` or `__pycache__`, match the name of
+// the directory at any depth, the others, e.g. `vendor/cache`, match its
+// whole path.
+func ExcludedDir(excludeDirs []string, rel string) (bool, error) {
+	for _, exclude := range excludeDirs {
+		name := rel
+		if !strings.Contains(exclude, "/") {
+			name = path.Base(rel)
+		}
+		matched, err := path.Match(exclude, name)
+		if err != nil {
+			return false, fmt.Errorf("failed to match exclude_dirs pattern: %s: %w", exclude, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pruneDirs removes the matches within the directories below the static root
+// of the pattern, or below the pattern if it is a directory without matchers,
+// that are matched by excludeDirs, see ExcludedDir.
+func pruneDirs(pattern string, ignoreMatchers bool, excludeDirs []string, matches []string) ([]string, error) {
+	root := staticRoot(pattern, ignoreMatchers)
+	literal := ignoreMatchers || !fileglob.ContainsMatchers(pattern)
+	var result []string
+	for _, match := range matches {
+		base := root
+		if literal && strings.HasPrefix(match, strings.TrimSuffix(pattern, "/")+"/") {
+			base = pattern
+		}
+		rel, err := filepath.Rel(base, match)
+		if err != nil {
+			return nil, fmt.Errorf("glob failed: %s: %w", match, err)
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		pruned := false
+		for i := range parts[:len(parts)-1] {
+			if parts[i] == "." || parts[i] == ".." {
+				continue
+			}
+			if pruned, err = ExcludedDir(excludeDirs, strings.Join(parts[:i+1], "/")); err != nil {
+				return nil, err
+			}
+			if pruned {
+				break
+			}
+		}
+		if !pruned {
+			result = append(result, match)
+		}
+	}
+	return result, nil
+}
+
+// staticRoot returns the directory a pattern starts to match in: the parent
+// of its first path element with matchers, or of the pattern if it has none.
+func staticRoot(pattern string, ignoreMatchers bool) string {
+	if ignoreMatchers || !fileglob.ContainsMatchers(pattern) {
+		return filepath.Dir(pattern)
+	}
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if !fileglob.ContainsMatchers(part) {
+			continue
+		}
+		if root := strings.Join(parts[:i], "/"); root != "" {
+			return root
+		}
+		if strings.HasPrefix(pattern, "/") {
+			return "/"
+		}
+		return "."
+	}
+	return filepath.Dir(pattern)
+}
+
+// uncrossSymlinks replaces the matches found within a symbolic link to a
+// directory below root by the symbolic link itself.
+func uncrossSymlinks(root string, matches []string) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	for _, match := range matches {
+		rel, err := filepath.Rel(root, match)
+		if err != nil {
+			return nil, fmt.Errorf("glob failed: %s: %w", match, err)
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		dir := root
+		for _, part := range parts[:len(parts)-1] {
+			dir = filepath.ToSlash(filepath.Join(dir, part))
+			info, err := os.Lstat(dir)
+			if err != nil {
+				return nil, fmt.Errorf("glob failed: %s: %w", match, err)
+			}
+			if info.Mode()&fs.ModeSymlink != 0 {
+				match = dir
+				break
+			}
+		}
+		if !seen[match] {
+			seen[match] = true
+			result = append(result, match)
+		}
+	}
+	return result, nil
+}
+
+func stat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(fsys, path.Clean(name))
+}
+
+// lstat is like stat, but does not follow symbolic links on the OS file
+// system. They are followed on any other file system.
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys == nil {
+		return os.Lstat(name)
+	}
+	return stat(fsys, name)
 }
@@ -1,8 +1,13 @@
 package glob
 
 import (
+	"errors"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -112,3 +117,393 @@ func TestGlob(t *testing.T) {
 		require.Equal(t, "/foo/bar/dir_b/test_b.txt", files["testdata/dir_a/dir_b/test_b.txt"])
 	})
 }
+
+func TestGlobWithFilter(t *testing.T) {
+	t.Run("by size", func(t *testing.T) {
+		dir := filepath.ToSlash(t.TempDir())
+		require.NoError(t, os.WriteFile(dir+"/small.txt", []byte("small"), 0o644))
+		require.NoError(t, os.WriteFile(dir+"/huge.img", make([]byte, 1024), 0o644))
+
+		files, err := GlobWithFilter(dir+"/*", "/foo/bar", func(_ string, info fs.FileInfo) bool {
+			return info.Size() < 1024
+		})
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		require.Equal(t, "/foo/bar/small.txt", files[dir+"/small.txt"])
+	})
+
+	t.Run("by name", func(t *testing.T) {
+		files, err := GlobWithFilter("./testdata/dir_a/dir_*/*", "/foo/bar", func(path string, _ fs.FileInfo) bool {
+			return !strings.Contains(path, "dir_c")
+		})
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		// the longest common prefix is computed after filtering
+		require.Equal(t, "/foo/bar/test_b.txt", files["testdata/dir_a/dir_b/test_b.txt"])
+	})
+
+	t.Run("everything filtered", func(t *testing.T) {
+		files, err := GlobWithFilter("./testdata/dir_a/dir_*/*", "/foo/bar", func(string, fs.FileInfo) bool {
+			return false
+		})
+		require.Nil(t, files)
+		require.EqualError(t, err, "glob failed: ./testdata/dir_a/dir_*/*: no matching files")
+	})
+}
+
+func TestGlobWalk(t *testing.T) {
+	t.Run("destinations", func(t *testing.T) {
+		files := map[string]string{}
+		calls := 0
+		err := GlobWalk("./testdata/dir_a/dir_*/*", "/foo/bar", func(src, dst string) error {
+			calls++
+			files[src] = dst
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, calls)
+		require.Equal(t, map[string]string{
+			"testdata/dir_a/dir_b/test_b.txt": "/foo/bar/dir_b/test_b.txt",
+			"testdata/dir_a/dir_c/test_c.txt": "/foo/bar/dir_c/test_c.txt",
+		}, files)
+
+		// the same as Glob
+		globbed, err := Glob("./testdata/dir_a/dir_*/*", "/foo/bar", false)
+		require.NoError(t, err)
+		require.Equal(t, globbed, files)
+	})
+
+	t.Run("dst is a dir", func(t *testing.T) {
+		var dsts []string
+		err := GlobWalk("testdata/**/test*.txt", "/foo/bar/", func(_, dst string) error {
+			dsts = append(dsts, filepath.ToSlash(dst))
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"/foo/bar/test_b.txt", "/foo/bar/test_c.txt", "/foo/bar/test_brace.txt"}, dsts)
+	})
+
+	t.Run("stops on error", func(t *testing.T) {
+		errStop := errors.New("stop")
+		calls := 0
+		err := GlobWalk("testdata/**/test*.txt", "/foo/bar", func(string, string) error {
+			calls++
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		err := GlobWalk("testdata/nothing*", "/foo/bar", func(string, string) error {
+			t.Fatal("unexpected call")
+			return nil
+		})
+		require.EqualError(t, err, "glob failed: testdata/nothing*: no matching files")
+	})
+}
+
+func TestGlobNoCrossSymlink(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	require.NoError(t, os.MkdirAll(dir+"/tree/real", 0o755))
+	require.NoError(t, os.MkdirAll(dir+"/outside/sub", 0o755))
+	require.NoError(t, os.WriteFile(dir+"/tree/real/a.txt", []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(dir+"/outside/b.txt", []byte("b"), 0o644))
+	require.NoError(t, os.WriteFile(dir+"/outside/sub/c.txt", []byte("c"), 0o644))
+	require.NoError(t, os.Symlink("../outside", dir+"/tree/link"))
+
+	t.Run("default follows the symlink", func(t *testing.T) {
+		files, err := Glob(dir+"/tree/link", "/foo", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			dir + "/tree/link/b.txt":     "/foo/b.txt",
+			dir + "/tree/link/sub/c.txt": "/foo/sub/c.txt",
+		}, files)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		files, err := GlobNoCrossSymlink(dir+"/tree", "/foo", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			dir + "/tree/real/a.txt": "/foo/real/a.txt",
+			dir + "/tree/link":       "/foo/link",
+		}, files)
+	})
+
+	t.Run("matchers", func(t *testing.T) {
+		files, err := GlobNoCrossSymlink(dir+"/tree/*", "/foo", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			dir + "/tree/real/a.txt": "/foo/real/a.txt",
+			dir + "/tree/link":       "/foo/link",
+		}, files)
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		files, err := GlobNoCrossSymlink(dir+"/tree/link", "/foo", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{dir + "/tree/link": "/foo"}, files)
+	})
+
+	t.Run("explicitly named symlink", func(t *testing.T) {
+		files, err := GlobNoCrossSymlink(dir+"/tree/link/*", "/foo", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			dir + "/tree/link/b.txt":     "/foo/b.txt",
+			dir + "/tree/link/sub/c.txt": "/foo/sub/c.txt",
+		}, files)
+	})
+}
+
+func TestGlobFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir_a/dir_b/test_b.txt": {Data: []byte("b")},
+		"dir_a/dir_c/test_c.txt": {Data: []byte("c")},
+		"dir_a/test_a.txt":       {Data: []byte("a")},
+	}
+
+	t.Run("simple", func(t *testing.T) {
+		files, err := GlobFS(fsys, "./dir_a/dir_*/*", "/foo/bar", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"dir_a/dir_b/test_b.txt": "/foo/bar/dir_b/test_b.txt",
+			"dir_a/dir_c/test_c.txt": "/foo/bar/dir_c/test_c.txt",
+		}, files)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		files, err := GlobFS(fsys, "dir_a", "/foo/bar", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"dir_a/dir_b/test_b.txt": "/foo/bar/dir_b/test_b.txt",
+			"dir_a/dir_c/test_c.txt": "/foo/bar/dir_c/test_c.txt",
+			"dir_a/test_a.txt":       "/foo/bar/test_a.txt",
+		}, files)
+	})
+
+	t.Run("no glob", func(t *testing.T) {
+		files, err := GlobFS(fsys, "dir_a/test_a.txt", "/foo/bar/dest.dat", false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"dir_a/test_a.txt": "/foo/bar/dest.dat"}, files)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		_, err := GlobFS(fsys, "dir_a/*.conf", "/foo/bar", false)
+		require.EqualError(t, err, "glob failed: dir_a/*.conf: no matching files")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := GlobFS(fsys, "dir_a/missing.txt", "/foo/bar", false)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	for _, pattern := range []string{"/dir_a/*", "../dir_a/*"} {
+		t.Run("outside of the file system "+pattern, func(t *testing.T) {
+			_, err := GlobFS(fsys, pattern, "/foo/bar", false)
+			require.EqualError(t, err, "glob failed: "+pattern+": pattern must be relative to the file system")
+		})
+	}
+
+	t.Run("nil file system", func(t *testing.T) {
+		files, err := GlobFS(nil, "./testdata/dir_a/dir_*/*", "/foo/bar", false)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+		require.Equal(t, "/foo/bar/dir_b/test_b.txt", files["testdata/dir_a/dir_b/test_b.txt"])
+	})
+}
+
+func TestGlobIncludeHidden(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/.config/app.conf": {Data: []byte("c")},
+		"src/.env":             {Data: []byte("e")},
+		"src/main.go":          {Data: []byte("m")},
+		"src/sub/.keep":        {Data: []byte("k")},
+		"src/sub/sub.go":       {Data: []byte("s")},
+	}
+	all := map[string]string{
+		"src/.config/app.conf": "/foo/.config/app.conf",
+		"src/.env":             "/foo/.env",
+		"src/main.go":          "/foo/main.go",
+		"src/sub/.keep":        "/foo/sub/.keep",
+		"src/sub/sub.go":       "/foo/sub/sub.go",
+	}
+	visible := map[string]string{
+		"src/main.go":    "/foo/main.go",
+		"src/sub/sub.go": "/foo/sub/sub.go",
+	}
+
+	for _, pattern := range []string{"src/*", "src/**", "src"} {
+		t.Run(pattern, func(t *testing.T) {
+			files, err := GlobFS(fsys, pattern, "/foo", false)
+			require.NoError(t, err)
+			require.Equal(t, all, files)
+
+			files, err = GlobIncludeHidden(fsys, pattern, "/foo", false, true)
+			require.NoError(t, err)
+			require.Equal(t, all, files)
+
+			files, err = GlobIncludeHidden(fsys, pattern, "/foo", false, false)
+			require.NoError(t, err)
+			require.Equal(t, visible, files)
+		})
+	}
+
+	t.Run("explicit", func(t *testing.T) {
+		files, err := GlobIncludeHidden(fsys, "src/.*", "/foo", false, false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"src/.config/app.conf": "/foo/.config/app.conf",
+			"src/.env":             "/foo/.env",
+		}, files)
+
+		files, err = GlobIncludeHidden(fsys, "src/.env", "/foo/.env", true, false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"src/.env": "/foo/.env"}, files)
+
+		files, err = GlobIncludeHidden(fsys, "src/**/.keep", "/foo", false, false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"src/sub/.keep": "/foo/.keep"}, files)
+	})
+
+	t.Run("hidden static root", func(t *testing.T) {
+		files, err := GlobIncludeHidden(fsys, "src/.config/*", "/foo", false, false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"src/.config/app.conf": "/foo/app.conf"}, files)
+	})
+
+	t.Run("only hidden", func(t *testing.T) {
+		_, err := GlobIncludeHidden(fsys, "src/*/app.conf", "/foo", false, false)
+		require.EqualError(t, err, "glob failed: src/*/app.conf: no matching files")
+	})
+}
+
+func TestGlobExcludeDirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/.git/HEAD":                   {Data: []byte("h")},
+		"src/.git/objects/ab/cdef":        {Data: []byte("o")},
+		"src/app/main.py":                 {Data: []byte("m")},
+		"src/app/__pycache__/main.pyc":    {Data: []byte("c")},
+		"src/app/vendor/cache/a.txt":      {Data: []byte("a")},
+		"src/app/vendor/lib/b.txt":        {Data: []byte("b")},
+		"src/app/templates/.git/keep.txt": {Data: []byte("k")},
+	}
+
+	t.Run(".git", func(t *testing.T) {
+		files, err := GlobExcludeDirs(fsys, "src/**", "/foo", false, true, []string{".git"})
+		require.NoError(t, err)
+		// the pruned .git directory is not part of the longest common
+		// prefix, which is src/app.
+		require.Equal(t, map[string]string{
+			"src/app/main.py":              "/foo/main.py",
+			"src/app/__pycache__/main.pyc": "/foo/__pycache__/main.pyc",
+			"src/app/vendor/cache/a.txt":   "/foo/vendor/cache/a.txt",
+			"src/app/vendor/lib/b.txt":     "/foo/vendor/lib/b.txt",
+		}, files)
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		files, err := GlobExcludeDirs(fsys, "src/app", "/foo", false, true, []string{"__pycache__", "vendor/cache", ".git"})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"src/app/main.py":          "/foo/main.py",
+			"src/app/vendor/lib/b.txt": "/foo/vendor/lib/b.txt",
+		}, files)
+	})
+
+	t.Run("everything pruned", func(t *testing.T) {
+		_, err := GlobExcludeDirs(fsys, "src/app/*/*", "/foo", false, true, []string{"*"})
+		require.EqualError(t, err, "glob failed: src/app/*/*: no matching files")
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := GlobExcludeDirs(fsys, "src/**", "/foo", false, true, []string{"[.git"})
+		require.ErrorContains(t, err, "failed to match exclude_dirs pattern: [.git")
+	})
+}
+
+func TestGlobCaptures(t *testing.T) {
+	fsys := fstest.MapFS{
+		"plugins/foo/plugin.so":      {Data: []byte("f")},
+		"plugins/bar/plugin.so":      {Data: []byte("b")},
+		"plugins/bar/README.md":      {Data: []byte("r")},
+		"share/en/foo.mo":            {Data: []byte("e")},
+		"share/de/foo.mo":            {Data: []byte("d")},
+		"conf/site/a/settings.conf":  {Data: []byte("a")},
+		"conf/site/a/b/nested.conf":  {Data: []byte("n")},
+		"conf/other/a/settings.conf": {Data: []byte("o")},
+	}
+
+	for _, tc := range []struct {
+		pattern, dst string
+		expected     map[string]string
+	}{
+		{
+			pattern: "plugins/*/plugin.so",
+			dst:     "/usr/lib/myapp/plugins/$1.so",
+			expected: map[string]string{
+				"plugins/foo/plugin.so": "/usr/lib/myapp/plugins/foo.so",
+				"plugins/bar/plugin.so": "/usr/lib/myapp/plugins/bar.so",
+			},
+		},
+		{
+			pattern: "share/*/*.mo",
+			dst:     "/usr/share/locale/${1}/LC_MESSAGES/$2.mo",
+			expected: map[string]string{
+				"share/en/foo.mo": "/usr/share/locale/en/LC_MESSAGES/foo.mo",
+				"share/de/foo.mo": "/usr/share/locale/de/LC_MESSAGES/foo.mo",
+			},
+		},
+		{
+			pattern: "./share/{en,fr}/foo.mo",
+			dst:     "/usr/share/foo/$1/",
+			expected: map[string]string{
+				"share/en/foo.mo": "/usr/share/foo/en/foo.mo",
+			},
+		},
+		{
+			// files within matched directories are placed below the
+			// destination of the directory
+			pattern: "conf/*",
+			dst:     "/etc/$1.d",
+			expected: map[string]string{
+				"conf/site/a/settings.conf":  "/etc/site.d/a/settings.conf",
+				"conf/site/a/b/nested.conf":  "/etc/site.d/a/b/nested.conf",
+				"conf/other/a/settings.conf": "/etc/other.d/a/settings.conf",
+			},
+		},
+		{
+			pattern: "conf/site/**/*.conf",
+			dst:     "/etc/site/$1$2",
+			expected: map[string]string{
+				"conf/site/a/settings.conf": "/etc/site/a/settings",
+				"conf/site/a/b/nested.conf": "/etc/site/a/b/nested",
+			},
+		},
+	} {
+		t.Run(tc.pattern, func(t *testing.T) {
+			files, err := GlobFS(fsys, tc.pattern, tc.dst, false)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, files)
+		})
+	}
+
+	t.Run("invalid references", func(t *testing.T) {
+		_, err := GlobFS(fsys, "conf/*/a/settings.conf", "/etc/settings.conf$0", false)
+		require.EqualError(t, err, "glob failed: conf/*/a/settings.conf: $0: the pattern has 1 matcher(s)")
+
+		_, err = GlobFS(fsys, "share/*/foo.mo", "/usr/share/foo/foo$2.mo", false)
+		require.EqualError(t, err, "glob failed: share/*/foo.mo: $2: the pattern has 1 matcher(s)")
+	})
+
+	t.Run("duplicate destinations", func(t *testing.T) {
+		_, err := GlobFS(fsys, "plugins/*/*", "/usr/lib/myapp/$2", false)
+		require.ErrorContains(t, err, "glob failed: plugins/*/*: ")
+		require.ErrorContains(t, err, " are both mapped to /usr/lib/myapp/plugin.so")
+	})
+
+	t.Run("ignored matchers", func(t *testing.T) {
+		files, err := GlobFS(fsys, "plugins/foo/plugin.so", "/usr/lib/myapp/$1.so", true)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"plugins/foo/plugin.so": "/usr/lib/myapp/$1.so"}, files)
+	})
+}
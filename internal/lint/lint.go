@@ -0,0 +1,286 @@
+// Package lint checks the contents of packages against the conventions of
+// the distro they are built for, see nfpm.Info.TargetDistro.
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// families maps the supported target distros to the family whose
+// conventions they follow.
+// nolint: gochecknoglobals
+var families = map[string]string{
+	"debian":    "debian",
+	"ubuntu":    "debian",
+	"fedora":    "fedora",
+	"rhel":      "fedora",
+	"centos":    "fedora",
+	"rocky":     "fedora",
+	"almalinux": "fedora",
+	"opensuse":  "suse",
+	"sles":      "suse",
+	"alpine":    "alpine",
+	"arch":      "arch",
+	"archlinux": "arch",
+}
+
+// familyFormats are the package formats native to each distro family.
+// nolint: gochecknoglobals
+var familyFormats = map[string]string{
+	"debian": "deb",
+	"fedora": "rpm",
+	"suse":   "rpm",
+	"alpine": "apk",
+	"arch":   "archlinux",
+}
+
+// IsSupported reports whether distro is a supported target distro.
+func IsSupported(distro string) bool {
+	_, ok := families[distro]
+	return ok
+}
+
+// Lint is a heuristic check of the contents against the conventions of the
+// target distro.
+type Lint struct {
+	// Name is used to suppress the lint with nfpm.Info.SuppressLints.
+	Name        string
+	Description string
+	// check returns why the content does not follow the conventions of the
+	// distro family, or an empty string if it does. It is called with a nil
+	// content once per package, to check the package itself.
+	check func(family, format string, content *files.Content) string
+	// anyDistro makes the lint run whether a target distro is set or not,
+	// with an empty family when it is not.
+	anyDistro bool
+}
+
+// Lints are the lints enabled by the target distro, or always for the ones
+// that do not depend on it.
+// nolint: gochecknoglobals
+var Lints = []Lint{
+	{
+		Name:        "format",
+		Description: "the package format is not the one of the distro",
+		check: func(family, format string, content *files.Content) string {
+			if content != nil || familyFormats[family] == format {
+				return ""
+			}
+			return fmt.Sprintf("%s packages are %s, not %s", family, familyFormats[family], format)
+		},
+	},
+	{
+		Name:        "usr-merge",
+		Description: "contents below /bin, /sbin, /lib or /lib64 on distros that merged them into /usr",
+		check: func(family, _ string, content *files.Content) string {
+			if content == nil || (family != "fedora" && family != "arch") {
+				return ""
+			}
+			for _, dir := range []string{"/bin", "/sbin", "/lib", "/lib64"} {
+				if isBelow(content.Destination, dir) {
+					return fmt.Sprintf("%s has merged %s into /usr%s", family, dir, dir)
+				}
+			}
+			return ""
+		},
+	},
+	{
+		Name:        "lib64",
+		Description: "contents below /usr/lib64 on distros that do not use it",
+		check: func(family, _ string, content *files.Content) string {
+			if content == nil || (family != "debian" && family != "alpine" && family != "arch") {
+				return ""
+			}
+			if isBelow(content.Destination, "/usr/lib64") || (family != "arch" && isBelow(content.Destination, "/lib64")) {
+				return fmt.Sprintf("%s installs libraries to /usr/lib, not lib64", family)
+			}
+			return ""
+		},
+	},
+	{
+		Name:        "sysconfig",
+		Description: "service defaults in /etc/sysconfig on debian, or in /etc/default on fedora and suse",
+		check: func(family, _ string, content *files.Content) string {
+			switch {
+			case content == nil:
+			case family == "debian" && isBelow(content.Destination, "/etc/sysconfig"):
+				return "debian keeps the service defaults in /etc/default"
+			case (family == "fedora" || family == "suse") && isBelow(content.Destination, "/etc/default"):
+				return family + " keeps the service defaults in /etc/sysconfig"
+			}
+			return ""
+		},
+	},
+	{
+		Name:        "systemd",
+		Description: "systemd units on distros that do not use systemd",
+		check: func(family, _ string, content *files.Content) string {
+			if content == nil || family != "alpine" || !inSystemdDir(content.Destination) {
+				return ""
+			}
+			return "alpine uses OpenRC, with its services in /etc/init.d, instead of systemd"
+		},
+	},
+	{
+		Name:        "conffile-location",
+		Description: "config files outside of /etc in deb packages",
+		check: func(_, format string, content *files.Content) string {
+			if content == nil || format != "deb" || isBelow(content.Destination, "/etc") {
+				return ""
+			}
+			if content.Type != files.TypeConfig && content.Type != files.TypeConfigNoReplace {
+				return ""
+			}
+			return "debian expects the conffiles to be below /etc"
+		},
+		anyDistro: true,
+	},
+	{
+		Name:        "script-shebang",
+		Description: "executable text files in bin or sbin directories without a shebang",
+		check: func(_, _ string, content *files.Content) string {
+			if !isExecutableFile(content) || !inBinDir(content.Destination) {
+				return ""
+			}
+			head := readHead(content)
+			if len(head) == 0 || bytes.IndexByte(head, 0) >= 0 || bytes.HasPrefix(head, []byte("#!")) {
+				return ""
+			}
+			return "executable text file without a shebang, it cannot be executed"
+		},
+		anyDistro: true,
+	},
+	{
+		Name:        "executable-location",
+		Description: "executable files in directories of documentation, data or configuration",
+		check: func(_, _ string, content *files.Content) string {
+			if !isExecutableFile(content) || !inNonExecutableDir(content.Destination) {
+				return ""
+			}
+			return fmt.Sprintf("executable file with mode %#o in a directory of non-executable files", content.Mode()&fs.ModePerm)
+		},
+		anyDistro: true,
+	},
+}
+
+// Finding is why a content, or the package itself, does not follow the
+// conventions of the target distro.
+type Finding struct {
+	Lint string
+	// Path is the destination of the content, empty if the finding is about
+	// the package itself.
+	Path   string
+	Reason string
+}
+
+// Run runs the Lints that are not suppressed against the contents of the
+// package built in the given format for the target distro. Without a
+// supported distro, only the lints that do not depend on it run. Implicit
+// directories are not checked, as they are reported with their contents.
+func Run(distro, format string, contents files.Contents, suppressed []string) []Finding {
+	family, ok := families[distro]
+	var findings []Finding
+	for _, lint := range Lints {
+		if slices.Contains(suppressed, lint.Name) || (!ok && !lint.anyDistro) {
+			continue
+		}
+		if reason := lint.check(family, format, nil); reason != "" {
+			findings = append(findings, Finding{Lint: lint.Name, Reason: reason})
+		}
+		for _, content := range contents {
+			if content.Type == files.TypeImplicitDir {
+				continue
+			}
+			if reason := lint.check(family, format, content); reason != "" {
+				findings = append(findings, Finding{
+					Lint:   lint.Name,
+					Path:   files.NormalizeAbsoluteFilePath(content.Destination),
+					Reason: reason,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// isExecutableFile reports whether the content is a regular file with an
+// executable bit set.
+func isExecutableFile(content *files.Content) bool {
+	if content == nil || content.FileInfo == nil || content.FileInfo.Mode&0o111 == 0 {
+		return false
+	}
+	switch content.Type {
+	case files.TypeFile, files.TypeConfig, files.TypeConfigNoReplace, "":
+		return true
+	default:
+		return false
+	}
+}
+
+// inBinDir reports whether dst is a file of a bin or sbin directory, e.g.
+// /usr/bin or /opt/foo/sbin.
+func inBinDir(dst string) bool {
+	dir := path.Base(path.Dir(path.Clean("/" + dst)))
+	return dir == "bin" || dir == "sbin"
+}
+
+// inNonExecutableDir reports whether dst is below a directory whose files are
+// not meant to be executed: documentation, headers, desktop data, or /etc,
+// except for its hook directories such as /etc/init.d or /etc/cron.daily.
+func inNonExecutableDir(dst string) bool {
+	for _, dir := range []string{
+		"/usr/share/doc", "/usr/share/man", "/usr/share/info", "/usr/share/licenses",
+		"/usr/share/applications", "/usr/share/icons", "/usr/share/pixmaps", "/usr/include",
+	} {
+		if isBelow(dst, dir) {
+			return true
+		}
+	}
+	if !isBelow(dst, "/etc") {
+		return false
+	}
+	for _, elem := range strings.Split(path.Dir(path.Clean("/"+dst)), "/") {
+		if strings.HasSuffix(elem, ".d") || strings.HasPrefix(elem, "cron.") {
+			return false
+		}
+	}
+	return true
+}
+
+// inSystemdDir reports whether dst is below one of the directories systemd
+// loads its units and configuration from.
+func inSystemdDir(dst string) bool {
+	for _, dir := range []string{"/etc/systemd", "/lib/systemd", "/usr/lib/systemd"} {
+		if isBelow(dst, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHead returns the first bytes of the body of the content, or nil if it
+// cannot be read.
+func readHead(content *files.Content) []byte {
+	f, err := content.Open()
+	if err != nil {
+		return nil
+	}
+	defer f.Close() // nolint: errcheck
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return head[:n]
+}
+
+// isBelow reports whether dst is dir or a path below it.
+func isBelow(dst, dir string) bool {
+	dst = path.Clean("/" + dst)
+	return dst == dir || strings.HasPrefix(dst, dir+"/")
+}
@@ -0,0 +1,33 @@
+package sign
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/goreleaser/nfpm/v2"
+)
+
+// Key is where a key, or a keyring, is read from: the environment variable
+// Env if it is set, see nfpm.PackageSignature.KeyEnv, or else the file File.
+type Key struct {
+	File string
+	Env  string
+}
+
+// SignatureKey returns the Key of the signature.
+func SignatureKey(sig nfpm.PackageSignature) Key {
+	return Key{File: sig.KeyFile, Env: sig.KeyEnv}
+}
+
+// read returns the contents of the key. The caller should clear the returned
+// key material once it is parsed.
+func (k Key) read() ([]byte, error) {
+	if k.Env != "" {
+		key := os.Getenv(k.Env)
+		if key == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", k.Env)
+		}
+		return []byte(key), nil
+	}
+	return os.ReadFile(k.File)
+}
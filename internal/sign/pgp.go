@@ -3,11 +3,13 @@ package sign
 import (
 	"bytes"
 	"crypto"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"strconv"
+	"strings"
 	"unicode"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -18,14 +20,14 @@ import (
 
 // PGPSignerWithKeyID returns a PGP signer that creates a detached non-ASCII-armored
 // signature and is compatible with rpmpack's signature API.
-func PGPSignerWithKeyID(keyFile, passphrase string, hexKeyID *string) func([]byte) ([]byte, error) {
+func PGPSignerWithKeyID(key Key, passphrase string, hexKeyID *string) func([]byte) ([]byte, error) {
 	return func(data []byte) ([]byte, error) {
-		keyID, err := parseKeyID(hexKeyID)
+		keyID, fingerprint, err := parseKeyID(hexKeyID)
 		if err != nil {
 			return nil, fmt.Errorf("%v is not a valid key id: %w", hexKeyID, err)
 		}
 
-		key, err := readSigningKey(keyFile, passphrase)
+		entity, err := readSigningKey(key, passphrase, fingerprint)
 		if err != nil {
 			return nil, &nfpm.ErrSigningFailure{Err: err}
 		}
@@ -34,7 +36,7 @@ func PGPSignerWithKeyID(keyFile, passphrase string, hexKeyID *string) func([]byt
 
 		if err := openpgp.DetachSign(
 			&signature,
-			key,
+			entity,
 			bytes.NewReader(data),
 			&packet.Config{
 				SigningKeyId: keyID,
@@ -49,25 +51,25 @@ func PGPSignerWithKeyID(keyFile, passphrase string, hexKeyID *string) func([]byt
 }
 
 // PGPArmoredDetachSign creates an ASCII-armored detached signature.
-func PGPArmoredDetachSign(message io.Reader, keyFile, passphrase string) ([]byte, error) {
-	return PGPArmoredDetachSignWithKeyID(message, keyFile, passphrase, nil)
+func PGPArmoredDetachSign(message io.Reader, key Key, passphrase string) ([]byte, error) {
+	return PGPArmoredDetachSignWithKeyID(message, key, passphrase, nil)
 }
 
 // PGPArmoredDetachSignWithKeyID creates an ASCII-armored detached signature.
-func PGPArmoredDetachSignWithKeyID(message io.Reader, keyFile, passphrase string, hexKeyID *string) ([]byte, error) {
-	keyID, err := parseKeyID(hexKeyID)
+func PGPArmoredDetachSignWithKeyID(message io.Reader, key Key, passphrase string, hexKeyID *string) ([]byte, error) {
+	keyID, fingerprint, err := parseKeyID(hexKeyID)
 	if err != nil {
 		return nil, fmt.Errorf("%v is not a valid key id: %w", hexKeyID, err)
 	}
 
-	key, err := readSigningKey(keyFile, passphrase)
+	entity, err := readSigningKey(key, passphrase, fingerprint)
 	if err != nil {
 		return nil, fmt.Errorf("armored detach sign: %w", err)
 	}
 
 	var signature bytes.Buffer
 
-	err = openpgp.ArmoredDetachSign(&signature, key, message, &packet.Config{
+	err = openpgp.ArmoredDetachSign(&signature, entity, message, &packet.Config{
 		SigningKeyId: keyID,
 		DefaultHash:  crypto.SHA256,
 	})
@@ -78,20 +80,20 @@ func PGPArmoredDetachSignWithKeyID(message io.Reader, keyFile, passphrase string
 	return signature.Bytes(), nil
 }
 
-func PGPClearSignWithKeyID(message io.Reader, keyFile, passphrase string, hexKeyID *string) ([]byte, error) {
-	keyID, err := parseKeyID(hexKeyID)
+func PGPClearSignWithKeyID(message io.Reader, key Key, passphrase string, hexKeyID *string) ([]byte, error) {
+	keyID, fingerprint, err := parseKeyID(hexKeyID)
 	if err != nil {
 		return nil, fmt.Errorf("%v is not a valid key id: %w", hexKeyID, err)
 	}
 
-	key, err := readSigningKey(keyFile, passphrase)
+	entity, err := readSigningKey(key, passphrase, fingerprint)
 	if err != nil {
 		return nil, fmt.Errorf("clear sign: %w", err)
 	}
 
 	var signature bytes.Buffer
 
-	writeCloser, err := clearsign.Encode(&signature, key.PrivateKey, &packet.Config{
+	writeCloser, err := clearsign.Encode(&signature, entity.PrivateKey, &packet.Config{
 		SigningKeyId: keyID,
 		DefaultHash:  crypto.SHA256,
 	})
@@ -114,24 +116,10 @@ func PGPClearSignWithKeyID(message io.Reader, keyFile, passphrase string, hexKey
 // signature using an ASCII-armored or non-ASCII-armored public key file. The signer
 // identity is not explicitly checked, other that the obvious fact that the signer's key must
 // be in the armoredPubKeyFile.
-func PGPVerify(message io.Reader, signature []byte, armoredPubKeyFile string) error {
-	keyFileContent, err := os.ReadFile(armoredPubKeyFile)
+func PGPVerify(message io.Reader, signature []byte, armoredPubKey Key) error {
+	keyring, err := PGPReadKeyring(armoredPubKey)
 	if err != nil {
-		return fmt.Errorf("reading armored public key file: %w", err)
-	}
-
-	var keyring openpgp.EntityList
-
-	if isASCII(keyFileContent) {
-		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(keyFileContent))
-		if err != nil {
-			return fmt.Errorf("decoding armored public key file: %w", err)
-		}
-	} else {
-		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(keyFileContent))
-		if err != nil {
-			return fmt.Errorf("decoding public key file: %w", err)
-		}
+		return err
 	}
 
 	if isASCII(signature) {
@@ -143,55 +131,98 @@ func PGPVerify(message io.Reader, signature []byte, armoredPubKeyFile string) er
 	return err
 }
 
-func PGPReadMessage(message []byte, armoredPubKeyFile string) error {
-	keyFileContent, err := os.ReadFile(armoredPubKeyFile)
+func PGPReadMessage(message []byte, armoredPubKey Key) error {
+	_, err := PGPVerifyClearSigned(message, armoredPubKey)
+	return err
+}
+
+// PGPVerifyClearSigned verifies a clear signed message using an ASCII-armored
+// or non-ASCII-armored key file and returns the signed plaintext.
+func PGPVerifyClearSigned(message []byte, key Key) ([]byte, error) {
+	keyring, err := PGPReadKeyring(key)
 	if err != nil {
-		return fmt.Errorf("reading armored public key file: %w", err)
+		return nil, err
 	}
 
-	var keyring openpgp.EntityList
+	block, _ := clearsign.Decode(message)
+	if block == nil {
+		return nil, errNoClearSignedMessage
+	}
+	if _, err := block.VerifySignature(keyring, nil); err != nil {
+		return nil, err
+	}
+
+	return block.Plaintext, nil
+}
+
+// PGPReadKeyring reads an ASCII-armored or non-ASCII-armored keyring. Secret
+// keyrings can be read as well, in which case the public part of their keys is
+// available to verify signatures.
+func PGPReadKeyring(key Key) (openpgp.EntityList, error) {
+	keyFileContent, err := key.read()
+	if err != nil {
+		return nil, fmt.Errorf("reading armored public key file: %w", err)
+	}
+	defer clear(keyFileContent)
 
 	if isASCII(keyFileContent) {
-		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(keyFileContent))
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyFileContent))
 		if err != nil {
-			return fmt.Errorf("decoding armored public key file: %w", err)
-		}
-	} else {
-		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(keyFileContent))
-		if err != nil {
-			return fmt.Errorf("decoding public key file: %w", err)
+			return nil, fmt.Errorf("decoding armored public key file: %w", err)
 		}
+		return keyring, nil
 	}
 
-	block, _ := clearsign.Decode(message)
-	_, err = block.VerifySignature(keyring, nil)
-
-	return err
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(keyFileContent))
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key file: %w", err)
+	}
+	return keyring, nil
 }
 
-func parseKeyID(hexKeyID *string) (uint64, error) {
+// parseKeyID parses either a 16 characters long key id or a 40 characters
+// long fingerprint, in which case the fingerprint is returned as well so the
+// key can be looked up in a keyring holding more than one key.
+func parseKeyID(hexKeyID *string) (uint64, []byte, error) {
 	if hexKeyID == nil || *hexKeyID == "" {
-		return 0, nil
+		return 0, nil, nil
 	}
 
-	result, err := strconv.ParseUint(*hexKeyID, 16, 64)
+	id := strings.ReplaceAll(*hexKeyID, " ", "")
+	if len(id) == 2*fingerprintLen {
+		fingerprint, err := hex.DecodeString(id)
+		if err != nil {
+			return 0, nil, err
+		}
+		// the key id of a v4 key is the low 64 bits of its fingerprint.
+		return binary.BigEndian.Uint64(fingerprint[fingerprintLen-8:]), fingerprint, nil
+	}
+
+	result, err := strconv.ParseUint(id, 16, 64)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
-	return result, nil
+	return result, nil, nil
 }
 
+const fingerprintLen = 20
+
 var (
 	errMoreThanOneKey = errors.New("more than one signing key in keyring")
 	errNoKeys         = errors.New("no signing key in keyring")
 	errNoPassword     = errors.New("key is encrypted but no passphrase was provided")
+	errKeyNotFound    = errors.New("key not found in keyring")
+	errNotSecretKey   = errors.New("key is not a secret key")
+
+	errNoClearSignedMessage = errors.New("no clear signed message found")
 )
 
-func readSigningKey(keyFile, passphrase string) (*openpgp.Entity, error) {
-	fileContent, err := os.ReadFile(keyFile)
+func readSigningKey(key Key, passphrase string, fingerprint []byte) (*openpgp.Entity, error) {
+	fileContent, err := key.read()
 	if err != nil {
 		return nil, fmt.Errorf("reading PGP key file: %w", err)
 	}
+	defer clear(fileContent)
 
 	var entityList openpgp.EntityList
 
@@ -206,6 +237,40 @@ func readSigningKey(keyFile, passphrase string) (*openpgp.Entity, error) {
 			return nil, fmt.Errorf("decoding PGP keyring: %w", err)
 		}
 	}
+
+	var entity *openpgp.Entity
+	if fingerprint != nil {
+		entity, err = findKeyByFingerprint(entityList, fingerprint)
+	} else {
+		entity, err = findSigningKey(entityList)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, errNoPassword
+		}
+		pw := []byte(passphrase)
+		err = entity.PrivateKey.Decrypt(pw)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt secret signing entity: %w", err)
+		}
+		for _, sub := range entity.Subkeys {
+			if sub.PrivateKey != nil {
+				if err := sub.PrivateKey.Decrypt(pw); err != nil {
+					return nil, fmt.Errorf("gopenpgp: error in unlocking sub entity: %w", err)
+				}
+			}
+		}
+	}
+
+	return entity, nil
+}
+
+// findSigningKey returns the only secret signing key of the keyring.
+func findSigningKey(entityList openpgp.EntityList) (*openpgp.Entity, error) {
 	var key *openpgp.Entity
 
 	for _, candidate := range entityList {
@@ -228,25 +293,30 @@ func readSigningKey(keyFile, passphrase string) (*openpgp.Entity, error) {
 		return nil, errNoKeys
 	}
 
-	if key.PrivateKey.Encrypted {
-		if passphrase == "" {
-			return nil, errNoPassword
-		}
-		pw := []byte(passphrase)
-		err = key.PrivateKey.Decrypt(pw)
-		if err != nil {
-			return nil, fmt.Errorf("decrypt secret signing key: %w", err)
+	return key, nil
+}
+
+// findKeyByFingerprint returns the entity whose primary key or one of its
+// subkeys has the given fingerprint, making sure its secret key is available.
+func findKeyByFingerprint(entityList openpgp.EntityList, fingerprint []byte) (*openpgp.Entity, error) {
+	for _, entity := range entityList {
+		if bytes.Equal(entity.PrimaryKey.Fingerprint, fingerprint) {
+			if entity.PrivateKey == nil || entity.PrivateKey.Dummy() {
+				return nil, fmt.Errorf("%X: %w", fingerprint, errNotSecretKey)
+			}
+			return entity, nil
 		}
-		for _, sub := range key.Subkeys {
-			if sub.PrivateKey != nil {
-				if err := sub.PrivateKey.Decrypt(pw); err != nil {
-					return nil, fmt.Errorf("gopenpgp: error in unlocking sub key: %w", err)
-				}
+		for _, sub := range entity.Subkeys {
+			if !bytes.Equal(sub.PublicKey.Fingerprint, fingerprint) {
+				continue
+			}
+			if entity.PrivateKey == nil || sub.PrivateKey == nil || sub.PrivateKey.Dummy() {
+				return nil, fmt.Errorf("%X: %w", fingerprint, errNotSecretKey)
 			}
+			return entity, nil
 		}
 	}
-
-	return key, nil
+	return nil, fmt.Errorf("%X: %w", fingerprint, errKeyNotFound)
 }
 
 func isASCII(s []byte) bool {
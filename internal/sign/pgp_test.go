@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/AlekSi/pointer"
@@ -40,13 +41,13 @@ func TestPGPSignerAndVerify(t *testing.T) {
 		t.Run(testCase.name, func(t *testing.T) {
 			armoredPublicKey := fmt.Sprintf("%s.asc", testCase.pubKeyFile)
 			gpgPublicKey := fmt.Sprintf("%s.gpg", testCase.pubKeyFile)
-			sig, err := PGPSignerWithKeyID(testCase.privKeyFile, testCase.pass, testCase.keyID)(data)
+			sig, err := PGPSignerWithKeyID(Key{File: testCase.privKeyFile}, testCase.pass, testCase.keyID)(data)
 			require.NoError(t, err)
 
-			err = PGPVerify(bytes.NewReader(data), sig, armoredPublicKey)
+			err = PGPVerify(bytes.NewReader(data), sig, Key{File: armoredPublicKey})
 			require.NoError(t, err)
 
-			err = PGPVerify(bytes.NewReader(data), sig, gpgPublicKey)
+			err = PGPVerify(bytes.NewReader(data), sig, Key{File: gpgPublicKey})
 			require.NoError(t, err)
 			if testCase.keyID != nil {
 				var pgpSignature *crypto.PGPSignature
@@ -73,16 +74,16 @@ func TestArmoredDetachSignAndVerify(t *testing.T) {
 			gpgPublicKey := fmt.Sprintf("%s.gpg", testCase.pubKeyFile)
 			sig, err := PGPArmoredDetachSignWithKeyID(
 				bytes.NewReader(data),
-				testCase.privKeyFile,
+				Key{File: testCase.privKeyFile},
 				testCase.pass,
 				testCase.keyID,
 			)
 			require.NoError(t, err)
 
-			err = PGPVerify(bytes.NewReader(data), sig, armoredPublicKey)
+			err = PGPVerify(bytes.NewReader(data), sig, Key{File: armoredPublicKey})
 			require.NoError(t, err)
 
-			err = PGPVerify(bytes.NewReader(data), sig, gpgPublicKey)
+			err = PGPVerify(bytes.NewReader(data), sig, Key{File: gpgPublicKey})
 			require.NoError(t, err)
 			if testCase.keyID != nil {
 				var pgpSignature *crypto.PGPSignature
@@ -101,7 +102,7 @@ func TestArmoredDetachSignAndVerify(t *testing.T) {
 }
 
 func TestPGPSignerError(t *testing.T) {
-	_, err := PGPSignerWithKeyID("/does/not/exist", "", nil)([]byte("data"))
+	_, err := PGPSignerWithKeyID(Key{File: "/does/not/exist"}, "", nil)([]byte("data"))
 	require.Error(t, err)
 
 	var expectedError *nfpm.ErrSigningFailure
@@ -109,35 +110,84 @@ func TestPGPSignerError(t *testing.T) {
 }
 
 func TestNoSigningKey(t *testing.T) {
-	_, err := readSigningKey("testdata/pubkey.asc", pass)
+	_, err := readSigningKey(Key{File: "testdata/pubkey.asc"}, pass, nil)
 	require.EqualError(t, err, "no signing key in keyring")
 }
 
 func TestMultipleKeys(t *testing.T) {
-	_, err := readSigningKey("testdata/multiple_privkeys.asc", pass)
+	_, err := readSigningKey(Key{File: "testdata/multiple_privkeys.asc"}, pass, nil)
 	require.EqualError(t, err, "more than one signing key in keyring")
 }
 
 func TestWrongPass(t *testing.T) {
-	_, err := readSigningKey("testdata/privkey.asc", "password123")
+	_, err := readSigningKey(Key{File: "testdata/privkey.asc"}, "password123", nil)
 	require.Contains(t, err.Error(), "private key checksum failure")
 }
 
 func TestEmptyPass(t *testing.T) {
-	_, err := readSigningKey("testdata/privkey.asc", "")
+	_, err := readSigningKey(Key{File: "testdata/privkey.asc"}, "", nil)
 	require.EqualError(t, err, "key is encrypted but no passphrase was provided")
 }
 
 func TestReadArmoredKey(t *testing.T) {
-	_, err := readSigningKey("testdata/privkey.asc", pass)
+	_, err := readSigningKey(Key{File: "testdata/privkey.asc"}, pass, nil)
 	require.NoError(t, err)
 }
 
 func TestReadKey(t *testing.T) {
-	_, err := readSigningKey("testdata/privkey.gpg", pass)
+	_, err := readSigningKey(Key{File: "testdata/privkey.gpg"}, pass, nil)
 	require.NoError(t, err)
 }
 
+func TestReadKeyFromEnv(t *testing.T) {
+	key, err := os.ReadFile("testdata/privkey.asc")
+	require.NoError(t, err)
+	t.Setenv("TEST_SIGNING_KEY", string(key))
+	_, err = readSigningKey(Key{Env: "TEST_SIGNING_KEY"}, pass, nil)
+	require.NoError(t, err)
+}
+
+func TestReadKeyFromEmptyEnv(t *testing.T) {
+	t.Setenv("TEST_SIGNING_KEY", "")
+	_, err := readSigningKey(Key{Env: "TEST_SIGNING_KEY"}, pass, nil)
+	require.ErrorContains(t, err, "environment variable TEST_SIGNING_KEY is empty")
+}
+
+func TestKeyringFingerprint(t *testing.T) {
+	data := []byte("testdata")
+	for name, fingerprint := range map[string]string{
+		"first key":            "866F6C83BAB3E49381ADE4C1BC8ACDD415BD80B3",
+		"second key":           "A70225080FACE80EDAB48D15D0AAB2985270817B",
+		"second key subkey":    "99BE88840485EFAFDECB29337CCED7F5A4A8E599",
+		"lowercase":            "a70225080face80edab48d15d0aab2985270817b",
+		"gpg formatted output": "A702 2508 0FAC E80E DAB4  8D15 D0AA B298 5270 817B",
+	} {
+		fingerprint := fingerprint
+		t.Run(name, func(t *testing.T) {
+			sig, err := PGPSignerWithKeyID(Key{File: "testdata/multiple_privkeys.asc"}, pass, &fingerprint)(data)
+			require.NoError(t, err)
+			require.NoError(t, PGPVerify(bytes.NewReader(data), sig, Key{File: "testdata/multiple_privkeys.asc"}))
+
+			sigID, _ := crypto.NewPGPSignature(sig).GetSignatureKeyIDs()
+			require.Len(t, sigID, 1)
+			id := strings.ReplaceAll(fingerprint, " ", "")
+			require.Equal(t, strings.ToLower(id[24:]), fmt.Sprintf("%x", sigID[0]))
+		})
+	}
+}
+
+func TestKeyringFingerprintNotFound(t *testing.T) {
+	_, err := readSigningKey(Key{File: "testdata/multiple_privkeys.asc"}, pass, bytes.Repeat([]byte{0xAB}, fingerprintLen))
+	require.ErrorIs(t, err, errKeyNotFound)
+}
+
+func TestKeyringFingerprintNotSecret(t *testing.T) {
+	_, fingerprint, err := parseKeyID(pointer.ToString("866F6C83BAB3E49381ADE4C1BC8ACDD415BD80B3"))
+	require.NoError(t, err)
+	_, err = readSigningKey(Key{File: "testdata/pubkey.asc"}, pass, fingerprint)
+	require.ErrorIs(t, err, errNotSecretKey)
+}
+
 func TestIsASCII(t *testing.T) {
 	data, err := os.ReadFile("testdata/privkey.asc")
 	require.NoError(t, err)
@@ -27,21 +27,39 @@ const (
 
 // RSASignSHA1Digest signs the provided SHA1 message digest. The key file
 // must be in the PEM format and can either be encrypted or not.
-func RSASignSHA1Digest(sha1Digest []byte, keyFile, passphrase string) ([]byte, error) {
+func RSASignSHA1Digest(sha1Digest []byte, key Key, passphrase string) ([]byte, error) {
 	if len(sha1Digest) != sha1.Size {
 		return nil, errDigestNotSH1
 	}
 
-	keyFileContent, err := os.ReadFile(keyFile)
+	priv, err := readRSAPrivateKey(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := priv.Sign(rand.Reader, sha1Digest, crypto.SHA1)
+	if err != nil {
+		return nil, fmt.Errorf("signing: %w", err)
+	}
+
+	return signature, nil
+}
+
+// readRSAPrivateKey reads a PEM private key, which can either be encrypted or
+// not.
+func readRSAPrivateKey(key Key, passphrase string) (crypto.Signer, error) {
+	keyFileContent, err := key.read()
 	if err != nil {
 		return nil, fmt.Errorf("reading key file: %w", err)
 	}
+	defer clear(keyFileContent)
 
 	block, _ := pem.Decode(keyFileContent)
 	if block == nil {
 		return nil, errNoPemBlock
 	}
 
+	defer clear(block.Bytes)
 	blockData := block.Bytes
 	if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
 		if passphrase == "" {
@@ -55,6 +73,7 @@ func RSASignSHA1Digest(sha1Digest []byte, keyFile, passphrase string) ([]byte, e
 			return nil, fmt.Errorf("decrypt private key PEM block: %w", err)
 		}
 
+		defer clear(decryptedBlockData)
 		blockData = decryptedBlockData
 	}
 
@@ -80,22 +99,17 @@ func RSASignSHA1Digest(sha1Digest []byte, keyFile, passphrase string) ([]byte, e
 		return nil, fmt.Errorf(`key type "%v" is not supported`, block.Type)
 	}
 
-	signature, err := priv.Sign(rand.Reader, sha1Digest, crypto.SHA1)
-	if err != nil {
-		return nil, fmt.Errorf("signing: %w", err)
-	}
-
-	return signature, nil
+	return priv, nil
 }
 
-func rsaSign(message io.Reader, keyFile, passphrase string) ([]byte, error) {
+func rsaSign(message io.Reader, key Key, passphrase string) ([]byte, error) {
 	sha1Hash := sha1.New() // nolint:gosec
 	_, err := io.Copy(sha1Hash, message)
 	if err != nil {
 		return nil, fmt.Errorf("create SHA1 message digest: %w", err)
 	}
 
-	return RSASignSHA1Digest(sha1Hash.Sum(nil), keyFile, passphrase)
+	return RSASignSHA1Digest(sha1Hash.Sum(nil), key, passphrase)
 }
 
 // RSAVerifySHA1Digest is exported for use in tests and verifies a signature over the
@@ -133,6 +147,32 @@ func RSAVerifySHA1Digest(sha1Digest, signature []byte, publicKeyFile string) err
 	return nil
 }
 
+// RSAVerifySHA1DigestWithPrivateKey verifies a signature over the provided
+// SHA1 hash of a message using the public part of the given private key file,
+// which can either be encrypted or not.
+func RSAVerifySHA1DigestWithPrivateKey(sha1Digest, signature []byte, key Key, passphrase string) error {
+	if len(sha1Digest) != sha1.Size {
+		return errDigestNotSH1
+	}
+
+	priv, err := readRSAPrivateKey(key, passphrase)
+	if err != nil {
+		return err
+	}
+
+	rsaPub, ok := priv.Public().(*rsa.PublicKey)
+	if !ok {
+		return errNoRSAKey
+	}
+
+	err = rsa.VerifyPKCS1v15(rsaPub, crypto.SHA1, sha1Digest, signature)
+	if err != nil {
+		return fmt.Errorf("verify PKCS1v15 signature: %w", err)
+	}
+
+	return nil
+}
+
 func rsaVerify(message io.Reader, signature []byte, publicKeyFile string) error {
 	sha1Hash := sha1.New() // nolint:gosec
 	_, err := io.Copy(sha1Hash, message)
@@ -25,7 +25,7 @@ func TestRSASignAndVerify(t *testing.T) {
 	for _, testCase := range testCases {
 		testCase := testCase
 		t.Run(testCase.name, func(t *testing.T) {
-			sig, err := rsaSign(bytes.NewReader(testData), testCase.privKey, testCase.passphrase)
+			sig, err := rsaSign(bytes.NewReader(testData), Key{File: testCase.privKey}, testCase.passphrase)
 			require.NoError(t, err)
 
 			err = rsaVerify(bytes.NewReader(testData), sig, testCase.pubKey)
@@ -36,19 +36,19 @@ func TestRSASignAndVerify(t *testing.T) {
 
 func TestWrongPassphrase(t *testing.T) {
 	testData := []byte("test")
-	_, err := rsaSign(bytes.NewReader(testData), "testdata/rsa.priv", "password123")
+	_, err := rsaSign(bytes.NewReader(testData), Key{File: "testdata/rsa.priv"}, "password123")
 	require.EqualError(t, err, "decrypt private key PEM block: x509: decryption password incorrect")
 }
 
 func TestNoPassphrase(t *testing.T) {
 	testData := []byte("test")
-	_, err := rsaSign(bytes.NewReader(testData), "testdata/rsa.priv", "")
+	_, err := rsaSign(bytes.NewReader(testData), Key{File: "testdata/rsa.priv"}, "")
 	require.EqualError(t, err, "key is encrypted but no passphrase was provided")
 }
 
 func TestInvalidHash(t *testing.T) {
 	invalidDigest := []byte("test")
-	_, err := RSASignSHA1Digest(invalidDigest, "testdata/rsa.priv", "hunter2")
+	_, err := RSASignSHA1Digest(invalidDigest, Key{File: "testdata/rsa.priv"}, "hunter2")
 	require.EqualError(t, err, "digest is not a SHA1 hash")
 }
 
@@ -65,7 +65,7 @@ func TestRSAVerifyWrongKey(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		sig, err := rsaSign(bytes.NewReader(digest), testCase.privKey, "")
+		sig, err := rsaSign(bytes.NewReader(digest), Key{File: testCase.privKey}, "")
 		require.NoError(t, err)
 
 		err = RSAVerifySHA1Digest(digest, sig, testCase.pubKey)
@@ -93,7 +93,7 @@ func TestRSAVerifyWrongSignature(t *testing.T) {
 func TestRSAVerifyWrongPublicKeyFormat(t *testing.T) {
 	digest := sha1.New().Sum(nil) // nolint:gosec
 
-	sig, err := rsaSign(bytes.NewReader(digest), "testdata/rsa_unprotected.priv", "")
+	sig, err := rsaSign(bytes.NewReader(digest), Key{File: "testdata/rsa_unprotected.priv"}, "")
 	require.NoError(t, err)
 
 	err = RSAVerifySHA1Digest(digest, sig, "testdata/wrong_key_format.pub")
@@ -103,6 +103,6 @@ func TestRSAVerifyWrongPublicKeyFormat(t *testing.T) {
 func TestRSAVerifyWrongSecretKeyFormat(t *testing.T) {
 	digest := sha1.New().Sum(nil) // nolint:gosec
 
-	_, err := rsaSign(bytes.NewReader(digest), "testdata/wrong_key_format.priv", "")
+	_, err := rsaSign(bytes.NewReader(digest), Key{File: "testdata/wrong_key_format.priv"}, "")
 	require.Error(t, err)
 }
@@ -0,0 +1,9 @@
+// Package sparse detects sparse files, i.e. files containing holes which do not
+// occupy any space on disk.
+package sparse
+
+// HoleSize returns the amount of bytes of the file at the given path which are
+// part of a hole. On systems which can not detect holes it always returns 0.
+func HoleSize(path string) (int64, error) {
+	return holeSize(path)
+}
@@ -0,0 +1,43 @@
+package sparse
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func holeSize(path string) (int64, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close() // nolint: errcheck
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	var data, offset int64
+	for offset < size {
+		start, err := f.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// no more data until the end of the file
+			break
+		}
+		if err != nil {
+			// the file system does not support detecting holes
+			return 0, nil //nolint:nilerr
+		}
+		end, err := f.Seek(start, unix.SEEK_HOLE)
+		if err != nil {
+			return 0, nil //nolint:nilerr
+		}
+		data += end - start
+		offset = end
+	}
+
+	return size - data, nil
+}
@@ -0,0 +1,39 @@
+package sparse
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoleSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(16<<20))
+	require.NoError(t, f.Close())
+
+	holes, err := HoleSize(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "linux" {
+		require.Zero(t, holes)
+		return
+	}
+	require.Greater(t, holes, int64(15<<20))
+
+	dense := filepath.Join(t.TempDir(), "dense")
+	require.NoError(t, os.WriteFile(dense, []byte("data"), 0o644))
+	holes, err = HoleSize(dense)
+	require.NoError(t, err)
+	require.Zero(t, holes)
+}
+
+func TestHoleSizeNotExist(t *testing.T) {
+	_, err := HoleSize("/does/not/exist")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
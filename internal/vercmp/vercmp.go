@@ -0,0 +1,273 @@
+// Package vercmp compares package versions the way the packagers do, for the
+// dependency checks and the sorting of the changelogs.
+package vercmp
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+// Deb compares two versions the way dpkg does: epochs first, then the
+// upstream versions and last the revisions, which follow the last hyphen.
+func Deb(a, b string) int {
+	epochA, upstreamA, revisionA := splitVersion(a)
+	epochB, upstreamB, revisionB := splitVersion(b)
+	if c := cmp.Compare(epochA, epochB); c != 0 {
+		return c
+	}
+	if c := verrevcmp(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return verrevcmp(revisionA, revisionB)
+}
+
+// verrevcmp compares alternating runs of non-digits and digits. Non-digits
+// are compared character by character, letters sorting before the other
+// characters and a `~` before anything, even the end of the version. Digits
+// are compared numerically.
+func verrevcmp(a, b string) int {
+	for a != "" || b != "" {
+		for a != "" && !isDigit(a[0]) || b != "" && !isDigit(b[0]) {
+			if c := cmp.Compare(order(a), order(b)); c != 0 {
+				return c
+			}
+			a, b = skip(a), skip(b)
+		}
+
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		var na, nb string
+		na, a = cutDigits(a)
+		nb, b = cutDigits(b)
+		if c := cmp.Compare(len(na), len(nb)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(na, nb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// order returns the weight of the first character of the version in the
+// comparison of the non-digits.
+func order(version string) int {
+	switch {
+	case version == "" || isDigit(version[0]):
+		return 0
+	case version[0] == '~':
+		return -1
+	case isLetter(version[0]):
+		return int(version[0])
+	default:
+		return int(version[0]) + 256
+	}
+}
+
+func skip(version string) string {
+	if version == "" {
+		return version
+	}
+	return version[1:]
+}
+
+func cutDigits(version string) (digits, rest string) {
+	i := 0
+	for i < len(version) && isDigit(version[i]) {
+		i++
+	}
+	return version[:i], version[i:]
+}
+
+// RPM compares two versions the way rpm does: epochs first, then the versions
+// and last the releases, which follow the last hyphen.
+func RPM(a, b string) int {
+	epochA, versionA, releaseA := splitVersion(a)
+	epochB, versionB, releaseB := splitVersion(b)
+	if c := cmp.Compare(epochA, epochB); c != 0 {
+		return c
+	}
+	if c := rpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	return rpmvercmp(releaseA, releaseB)
+}
+
+// rpmvercmp compares the runs of digits and letters of the versions, ignoring
+// the other characters. Digits are compared numerically and sort after
+// letters. A `~` sorts before anything, even the end of the version, and a
+// `^` after the end of the version but before anything else.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for a != "" || b != "" {
+		a = strings.TrimLeftFunc(a, isSeparator)
+		b = strings.TrimLeftFunc(b, isSeparator)
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			switch {
+			case a == "":
+				return -1
+			case b == "":
+				return 1
+			case !strings.HasPrefix(a, "^"):
+				return 1
+			case !strings.HasPrefix(b, "^"):
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		var sa, sb string
+		sa, a = cutSegment(a, numeric)
+		sb, b = cutSegment(b, numeric)
+		if sb == "" {
+			// digits are newer than letters
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			sa, sb = strings.TrimLeft(sa, "0"), strings.TrimLeft(sb, "0")
+			if c := cmp.Compare(len(sa), len(sb)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// cutSegment cuts the leading run of digits, or of letters, off the version.
+func cutSegment(version string, numeric bool) (segment, rest string) {
+	i := 0
+	for i < len(version) && (numeric && isDigit(version[i]) || !numeric && isLetter(version[i])) {
+		i++
+	}
+	return version[:i], version[i:]
+}
+
+func isSeparator(r rune) bool {
+	return r >= 128 || !isDigit(byte(r)) && !isLetter(byte(r)) && r != '~' && r != '^'
+}
+
+// Arch compares two versions the way pacman does: epochs first, then the
+// versions and last the releases, which follow the last hyphen and are only
+// compared if both versions have one.
+func Arch(a, b string) int {
+	epochA, versionA, releaseA := splitVersion(a)
+	epochB, versionB, releaseB := splitVersion(b)
+	if c := cmp.Compare(epochA, epochB); c != 0 {
+		return c
+	}
+	if c := alpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	if releaseA == "" || releaseB == "" {
+		return 0
+	}
+	return alpmvercmp(releaseA, releaseB)
+}
+
+// alpmvercmp compares the runs of digits and letters of the versions like
+// rpmvercmp, but without the special `~` and `^`: the other characters are
+// all separators, a longer run of them sorting after a shorter one. Once a
+// version runs out, the other one is older if the rest of it starts with a
+// letter, and newer otherwise, so that 1.0rc1 sorts before 1.0 but 1.0~rc1
+// and 1.0.1 after it.
+func alpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for a != "" && b != "" {
+		restA, restB := trimAlpmSeparators(a), trimAlpmSeparators(b)
+		sepA, sepB := len(a)-len(restA), len(b)-len(restB)
+		a, b = restA, restB
+		if a == "" || b == "" {
+			break
+		}
+		if sepA != sepB {
+			return cmp.Compare(sepA, sepB)
+		}
+
+		numeric := isDigit(a[0])
+		var sa, sb string
+		sa, a = cutSegment(a, numeric)
+		sb, b = cutSegment(b, numeric)
+		if sb == "" {
+			// digits are newer than letters
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			sa, sb = strings.TrimLeft(sa, "0"), strings.TrimLeft(sb, "0")
+			if c := cmp.Compare(len(sa), len(sb)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "" && !isLetter(b[0]), a != "" && isLetter(a[0]):
+		return -1
+	default:
+		return 1
+	}
+}
+
+// trimAlpmSeparators trims the leading characters that are neither digits nor
+// letters off the version.
+func trimAlpmSeparators(version string) string {
+	i := 0
+	for i < len(version) && !isDigit(version[i]) && !isLetter(version[i]) {
+		i++
+	}
+	return version[i:]
+}
+
+// splitVersion splits the version into its epoch, its version and its
+// revision, or release, which follows the last hyphen.
+func splitVersion(version string) (epoch uint64, ver, revision string) {
+	if e, rest, ok := strings.Cut(version, ":"); ok {
+		if n, err := strconv.ParseUint(e, 10, 64); err == nil {
+			epoch, version = n, rest
+		}
+	}
+	if i := strings.LastIndexByte(version, '-'); i >= 0 {
+		return epoch, version[:i], version[i+1:]
+	}
+	return epoch, version, ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
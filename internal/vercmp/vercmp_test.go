@@ -0,0 +1,90 @@
+package vercmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeb(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.01", "1.1", 0},
+		{"1.0.0~rc1", "1.0.0", -1},
+		{"1.0.0~rc1", "1.0.0~rc1~1", 1},
+		{"1.0.0", "1.0.0a", -1},
+		{"1.0a", "1.0+a", -1},
+		{"1.0^1", "1.0.1", 1},
+		{"1:1.0", "2.0", 1},
+		{"1.0-2", "1.0-10", -1},
+		{"1.0-1", "1.0", 1},
+	} {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			require.Equal(t, tc.expected, Deb(tc.a, tc.b))
+			require.Equal(t, -tc.expected, Deb(tc.b, tc.a))
+		})
+	}
+}
+
+func TestRPM(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.01", "1.1", 0},
+		{"1.0.0~rc1", "1.0.0", -1},
+		{"1.0.0~rc1", "1.0.0~rc1~1", 1},
+		{"1.0.0", "1.0.0a", -1},
+		{"1.0a", "1.0+a", 0},
+		{"1.0a", "1.0.1", -1},
+		{"1.0^1", "1.0.1", -1},
+		{"1.0^1", "1.0", 1},
+		{"1.0^1", "1.0~1", 1},
+		{"1:1.0", "2.0", 1},
+		{"1.0-2", "1.0-10", -1},
+		{"1.0-1", "1.0", 1},
+	} {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			require.Equal(t, tc.expected, RPM(tc.a, tc.b))
+			require.Equal(t, -tc.expected, RPM(tc.b, tc.a))
+		})
+	}
+}
+
+func TestArch(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.5.0", "1.5.0", 0},
+		{"1.5.1", "1.5.0", 1},
+		{"1.5.1", "1.5", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.01", "1.1", 0},
+		{"1.5.0-1", "1.5.0-2", -1},
+		{"1.5-1", "1.5", 0},
+		{"1.0rc1", "1.0", -1},
+		{"1.0a", "1.0alpha", -1},
+		{"1.0alpha", "1.0b", -1},
+		{"1.0a", "1.0.1", -1},
+		{"1.5.b", "1.5", 1},
+		{"1.0~rc1", "1.0", 1},
+		{"1.0..1", "1.0.1", 1},
+		{"1:1.0", "2.0", 1},
+		{"1.0-0.20240101.abcdef", "1.0-1", -1},
+		{"1.0-0.20240102.abcdef", "1.0-0.20240101.fedcba", 1},
+	} {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			require.Equal(t, tc.expected, Arch(tc.a, tc.b))
+			require.Equal(t, -tc.expected, Arch(tc.b, tc.a))
+		})
+	}
+}
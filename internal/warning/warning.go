@@ -0,0 +1,63 @@
+// Package warning provides centralized warning messaging for nfpm.
+package warning
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Prefixed is an io.Writer that prefixes every write with Prefix, used for
+// the Noticer of the warnings and of the deprecation notices.
+type Prefixed struct {
+	io.Writer
+	Prefix string
+}
+
+func (p Prefixed) Write(b []byte) (int, error) {
+	return p.Writer.Write(append([]byte(p.Prefix), b...))
+}
+
+var Noticer io.Writer = Prefixed{Writer: os.Stderr, Prefix: "WARNING: "}
+
+// nolint: gochecknoglobals
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger makes the warnings go to the logger, at the warn level, instead
+// of the Noticer. A nil logger restores the Noticer.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Logger returns the logger set with SetLogger, nil if none is.
+func Logger() *slog.Logger {
+	return logger.Load()
+}
+
+// Warn prints the message, on its own line, to the Noticer, or logs it with
+// the attributes given as key-value pairs, as slog.Logger.Warn does, if a
+// logger is set.
+func Warn(msg string, args ...any) {
+	if l := logger.Load(); l != nil {
+		l.Warn(strings.TrimSuffix(msg, "\n"), args...)
+		return
+	}
+	fmt.Fprintln(Noticer, strings.TrimSuffix(msg, "\n"))
+}
+
+// Println printlns the given string to the Noticer.
+func Println(s string) {
+	Warn(s)
+}
+
+// Printf printfs the given string to the Noticer.
+func Printf(format string, a ...interface{}) {
+	if logger.Load() != nil {
+		Warn(fmt.Sprintf(format, a...))
+		return
+	}
+	fmt.Fprintf(Noticer, format, a...)
+}
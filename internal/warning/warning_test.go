@@ -0,0 +1,48 @@
+package warning
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotice(t *testing.T) {
+	var b bytes.Buffer
+	setNoticer(t, &b)
+	Printf("blah: %v\n", true)
+	Println("foobar")
+	require.Equal(t, "WARNING: blah: true\nWARNING: foobar\n", b.String())
+}
+
+func TestLogger(t *testing.T) {
+	var noticed, logged bytes.Buffer
+	setNoticer(t, &noticed)
+	SetLogger(slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	Printf("blah: %v\n", true)
+	Warn("foobar", "path", "/usr/bin/foo")
+	require.Empty(t, noticed.String())
+	require.Equal(t, "level=WARN msg=\"blah: true\"\nlevel=WARN msg=foobar path=/usr/bin/foo\n", logged.String())
+
+	SetLogger(nil)
+	Warn("foobar", "path", "/usr/bin/foo")
+	require.Equal(t, "WARNING: foobar\n", noticed.String())
+}
+
+func setNoticer(t *testing.T, w io.Writer) {
+	t.Helper()
+	previous := Noticer
+	Noticer = Prefixed{Writer: w, Prefix: "WARNING: "}
+	t.Cleanup(func() { Noticer = previous })
+}
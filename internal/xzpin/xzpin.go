@@ -0,0 +1,45 @@
+// Package xzpin creates the xz writers of the packagers with pinned settings,
+// so that the same payload always compresses to the same bytes.
+package xzpin
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// The settings of the xz streams, the defaults of github.com/ulikunitz/xz
+// spelled out, so that a change of its defaults does not change the packages.
+const (
+	// DictCap is the size of the LZMA2 dictionary, 8 MiB.
+	DictCap = 8 << 20
+	// BufSize is the size of the buffer of the LZMA2 encoder.
+	BufSize = 4096
+	// BlockSize is the size of the blocks when none is given: a single block
+	// holding the whole payload.
+	BlockSize = int64(^uint64(0) >> 1)
+)
+
+// Config returns the configuration of an xz writer with the pinned settings:
+// a single stream, with the LZMA properties lc=3, lp=0, pb=2, the given
+// block size, or a single block if it is 0, the HashTable4 match finder and
+// CRC64 checks. The xz format records no timestamps or file names.
+func Config(blockSize int64) xz.WriterConfig {
+	if blockSize == 0 {
+		blockSize = BlockSize
+	}
+	return xz.WriterConfig{
+		Properties: &lzma.Properties{LC: 3, LP: 0, PB: 2},
+		DictCap:    DictCap,
+		BufSize:    BufSize,
+		BlockSize:  blockSize,
+		CheckSum:   xz.CRC64,
+		Matcher:    lzma.HashTable4,
+	}
+}
+
+// NewWriter returns an xz writer with the pinned settings, see Config.
+func NewWriter(w io.Writer, blockSize int64) (io.WriteCloser, error) {
+	return Config(blockSize).NewWriter(w)
+}
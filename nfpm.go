@@ -3,21 +3,48 @@
 package nfpm
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/md5"  // nolint:gas
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"maps"
+	"net/mail"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
 
 	"dario.cat/mergo"
 	"github.com/AlekSi/pointer"
+	"github.com/BurntSushi/toml"
 	"github.com/Masterminds/semver/v3"
 	"github.com/goreleaser/chglog"
 	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/deepcopy"
+	"github.com/goreleaser/nfpm/v2/internal/dependency"
+	"github.com/goreleaser/nfpm/v2/internal/download"
+	"github.com/goreleaser/nfpm/v2/internal/expr"
+	"github.com/goreleaser/nfpm/v2/internal/lint"
 	"github.com/goreleaser/nfpm/v2/internal/modtime"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 	"gopkg.in/yaml.v3"
 )
 
@@ -59,6 +86,123 @@ func Get(format string) (Packager, error) {
 	return p, nil
 }
 
+// packageExtensions maps the extensions of the packages of the known formats,
+// including the ones depending on the compression or the kind of package, to
+// their format, see FormatFromFilename.
+// nolint: gochecknoglobals
+var packageExtensions = map[string]string{
+	".deb":         "deb",
+	".udeb":        "deb",
+	".rpm":         "rpm",
+	".apk":         "apk",
+	".ipk":         "ipk",
+	".pkg.tar.zst": "archlinux",
+	".pkg.tar.xz":  "archlinux",
+	".pkg.tar.gz":  "archlinux",
+	".pkg.tar":     "archlinux",
+}
+
+// ErrUnknownExtension happens when the format of a package can not be told
+// from its file name.
+type ErrUnknownExtension struct {
+	Path string
+}
+
+func (e ErrUnknownExtension) Error() string {
+	exts := make([]string, 0, len(packageExtensions))
+	for ext := range packageExtensions {
+		exts = append(exts, ext)
+	}
+	slices.Sort(exts)
+	return fmt.Sprintf("unknown package extension: %s: must be one of %s", e.Path, strings.Join(exts, ", "))
+}
+
+// FormatFromFilename returns the format of the package at path, based on its
+// extension, e.g. deb for foo_1.0_amd64.deb or archlinux for
+// foo-1.0-1-x86_64.pkg.tar.zst. Besides the extensions of the known formats,
+// the conventional extensions of the registered packagers are recognized, the
+// longest matching extension taking precedence. The format need not be
+// registered, Get tells whether it is.
+func FormatFromFilename(path string) (string, error) {
+	name := strings.ToLower(filepath.Base(path))
+	var format, ext string
+	match := func(candidate, candidateFormat string) {
+		if len(candidate) > len(ext) && len(name) > len(candidate) && strings.HasSuffix(name, candidate) {
+			format, ext = candidateFormat, candidate
+		}
+	}
+	for candidate, candidateFormat := range packageExtensions {
+		match(candidate, candidateFormat)
+	}
+	lock.Lock()
+	for registered, p := range packagers {
+		if p, ok := p.(PackagerWithExtension); ok && p.ConventionalExtension() != "" {
+			match(strings.ToLower(p.ConventionalExtension()), registered)
+		}
+	}
+	lock.Unlock()
+	if format == "" {
+		return "", ErrUnknownExtension{path}
+	}
+	return format, nil
+}
+
+// PackageByPath creates a package at path, replacing any existing file, in
+// the format FormatFromFilename tells from its extension.
+func PackageByPath(info *Info, path string) error {
+	format, err := FormatFromFilename(path)
+	if err != nil {
+		return err
+	}
+	return PackageFile(info, format, path, WriteOptions{Overwrite: true})
+}
+
+// FormatInfo describes a registered format, see Formats.
+type FormatInfo struct {
+	Capabilities
+	// Name is the format the packager is registered for, e.g. deb.
+	Name string
+	// Extension is the conventional extension of the packages, empty if the
+	// packager does not implement PackagerWithExtension.
+	Extension string
+	// Verify reports whether the packager implements PackagerWithVerify.
+	Verify bool
+	// Resign reports whether the packager implements PackagerWithResign.
+	Resign bool
+}
+
+// Formats returns the registered formats, sorted by name. The capabilities
+// of the packagers that do not implement PackagerWithCapabilities are left
+// empty.
+func Formats() []FormatInfo {
+	lock.Lock()
+	defer lock.Unlock()
+	formats := make([]FormatInfo, 0, len(packagers))
+	for name, p := range packagers {
+		format := FormatInfo{Name: name}
+		if p, ok := p.(PackagerWithExtension); ok {
+			format.Extension = p.ConventionalExtension()
+		}
+		if p, ok := p.(PackagerWithCapabilities); ok {
+			format.Capabilities = p.Capabilities()
+		}
+		_, format.Verify = p.(PackagerWithVerify)
+		_, format.Resign = p.(PackagerWithResign)
+		formats = append(formats, format)
+	}
+	slices.SortFunc(formats, func(a, b FormatInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return formats
+}
+
+// Configuration formats, see ParseFormatWithEnvMapping.
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
 // Parse decodes YAML data from an io.Reader into a configuration struct.
 func Parse(in io.Reader) (config Config, err error) {
 	return ParseWithEnvMapping(in, os.Getenv)
@@ -66,22 +210,118 @@ func Parse(in io.Reader) (config Config, err error) {
 
 // ParseWithEnvMapping decodes YAML data from an io.Reader into a configuration struct.
 func ParseWithEnvMapping(in io.Reader, mapping func(string) string) (config Config, err error) {
+	return ParseFormatWithEnvMapping(in, FormatYAML, mapping)
+}
+
+// ParseFormatWithEnvMapping decodes data in the given format from an
+// io.Reader into a configuration struct. TOML and JSON use the same keys as
+// YAML, and unknown keys are rejected in all of them.
+func ParseFormatWithEnvMapping(in io.Reader, format string, mapping func(string) string) (config Config, err error) {
+	return parseFormat(in, format, "", mapping)
+}
+
+// parseFormat is ParseFormatWithEnvMapping for a config read from a file in
+// the given directory.
+func parseFormat(in io.Reader, format, dir string, mapping func(string) string) (config Config, err error) {
+	if format != FormatYAML {
+		// decode into a generic value and re-encode it as YAML, so the
+		// yaml tags and the strict decoding below apply to all formats.
+		if in, err = toYAML(in, format); err != nil {
+			return
+		}
+	}
+
 	dec := yaml.NewDecoder(in)
 	dec.KnownFields(true)
 	if err = dec.Decode(&config); err != nil {
 		return
 	}
-	config.envMappingFunc = mapping
-	if config.envMappingFunc == nil {
-		config.envMappingFunc = func(s string) string { return s }
+	config.dir = dir
+	if err = config.expand(mapping); err != nil {
+		return
 	}
-
-	config.expandEnvVars()
-	WithDefaults(&config.Info)
 	return config, nil
 }
 
-// ParseFile decodes YAML data from a file path into a configuration struct.
+// ParseJSON decodes a package spec, i.e. an Info encoded by encoding/json,
+// from an io.Reader. The keys are the ones of the YAML configuration and, as
+// with it, unknown keys are rejected, the environment variables are expanded
+// and the defaults are set, but the info is decoded with encoding/json
+// directly instead of going through YAML: durations are numbers of
+// nanoseconds and modes decimal numbers. The result should be validated
+// with Validate before packaging.
+func ParseJSON(in io.Reader) (*Info, error) {
+	var config Config
+	dec := json.NewDecoder(in)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config.Info); err != nil {
+		return nil, err
+	}
+	if err := config.expand(os.Getenv); err != nil {
+		return nil, err
+	}
+	return &config.Info, nil
+}
+
+// expand expands the environment variables of the decoded config with
+// mapping, and its manifests, and sets the defaults.
+func (c *Config) expand(mapping func(string) string) error {
+	c.envMappingFunc = mapping
+	if c.envMappingFunc == nil {
+		c.envMappingFunc = func(s string) string { return s }
+	}
+	c.envLookupFunc = mapping
+
+	if err := c.includeContents(); err != nil {
+		return err
+	}
+	c.expandEnvVars()
+	if err := c.expandManifests(); err != nil {
+		return err
+	}
+	WithDefaults(&c.Info)
+	return nil
+}
+
+func toYAML(in io.Reader, format string) (io.Reader, error) {
+	var value map[string]interface{}
+	switch format {
+	case FormatTOML:
+		if _, err := toml.NewDecoder(in).Decode(&value); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		dec := json.NewDecoder(in)
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format: %s", format)
+	}
+
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// FormatFromPath returns the configuration format of the given file path,
+// based on its extension. Files with other extensions are read as YAML.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatYAML
+	}
+}
+
+// ParseFile decodes data from a file path into a configuration struct. The
+// format is detected from the file extension, see FormatFromPath.
 func ParseFile(path string) (config Config, err error) {
 	if path == "-" {
 		return ParseWithEnvMapping(os.Stdin, os.Getenv)
@@ -89,7 +329,8 @@ func ParseFile(path string) (config Config, err error) {
 	return ParseFileWithEnvMapping(path, os.Getenv)
 }
 
-// ParseFileWithEnvMapping decodes YAML data from a file path into a configuration struct.
+// ParseFileWithEnvMapping decodes data from a file path into a configuration
+// struct. The format is detected from the file extension, see FormatFromPath.
 func ParseFileWithEnvMapping(path string, mapping func(string) string) (config Config, err error) {
 	var file *os.File
 	file, err = os.Open(path) //nolint:gosec
@@ -97,7 +338,7 @@ func ParseFileWithEnvMapping(path string, mapping func(string) string) (config C
 		return
 	}
 	defer file.Close() // nolint: errcheck,gosec
-	return ParseWithEnvMapping(file, mapping)
+	return parseFormat(file, FormatFromPath(path), filepath.Dir(path), mapping)
 }
 
 // Packager represents any packager implementation.
@@ -111,109 +352,1351 @@ type PackagerWithExtension interface {
 	ConventionalExtension() string
 }
 
-// Config contains the top level configuration for packages.
-type Config struct {
-	Info           `yaml:",inline" json:",inline"`
-	Overrides      map[string]*Overridables `yaml:"overrides,omitempty" json:"overrides,omitempty" jsonschema:"title=overrides,description=override some fields when packaging with a specific packager,enum=apk,enum=deb,enum=rpm"`
-	envMappingFunc func(string) string
+// PackagerWithVerify is implemented by packagers that can read back the
+// packages they create and check their consistency, see Info.SelfVerify.
+type PackagerWithVerify interface {
+	Packager
+	// Verify checks the package read from r, which must have been created
+	// with the given info.
+	Verify(info *Info, r io.Reader) error
 }
 
-// Get returns the Info struct for the given packager format. Overrides
-// for the given format are merged into the final struct.
-func (c *Config) Get(format string) (info *Info, err error) {
-	info = &Info{}
-	// make a deep copy of info
-	if err = mergo.Merge(info, c.Info, mergo.WithOverride); err != nil {
-		return nil, fmt.Errorf("failed to merge config into info: %w", err)
+// PackagerWithMetadata is implemented by packagers that can read back the
+// Info.Metadata of the packages they create.
+type PackagerWithMetadata interface {
+	Packager
+	// ReadMetadata returns the metadata of the package read from r.
+	ReadMetadata(r io.Reader) (map[string]string, error)
+}
+
+// PackagerWithInstalledSize is implemented by packagers that can read back
+// the installed size the packages they create report, see
+// Info.SizeParityTolerance.
+type PackagerWithInstalledSize interface {
+	Packager
+	// InstalledSize returns the size in bytes the contents of the package
+	// read from r are reported to take once installed.
+	InstalledSize(r io.Reader) (int64, error)
+}
+
+// PackagerWithLints is implemented by packagers that check the fields of the
+// packages they create against the conventions of their format. The findings
+// are reported like those of the lints of the target distro, whether a
+// target distro is set or not.
+type PackagerWithLints interface {
+	Packager
+	// Lints returns the lints of the packager.
+	Lints() []Lint
+}
+
+// Lint is a check of the fields of a package, see PackagerWithLints.
+type Lint struct {
+	// Name is used to suppress the lint with Info.SuppressLints.
+	Name        string
+	Description string
+	// Check returns why the fields of the package are not valid, or an
+	// empty string if they are.
+	Check func(info *Info) string
+}
+
+// PackagerWithValidation is implemented by packagers that check the options
+// of their format against the contents of the package, see Validate and
+// PrepareForPackager.
+type PackagerWithValidation interface {
+	Packager
+	// Validate checks the info, whose contents are prepared for the
+	// packager.
+	Validate(info *Info) error
+}
+
+// PackagerWithResign is implemented by packagers that can sign packages they
+// created before, see Resign.
+type PackagerWithResign interface {
+	Packager
+	// Resign writes the package read from r to w, signed with the signature
+	// of the given info for the packager instead of its former signature, if
+	// any. The payload of the package is kept as is.
+	Resign(info *Info, r io.Reader, w io.Writer) error
+}
+
+// PackagerWithScriptlets is implemented by packagers that can return the
+// maintainer scripts of the packages they create, see Scriptlets.
+type PackagerWithScriptlets interface {
+	Packager
+	// Scriptlets returns the scripts of the package created with the given
+	// info, by their name in the format, as they are added to it.
+	Scriptlets(info *Info) (map[string]string, error)
+}
+
+// PackagerWithIdentity is implemented by packagers that can read back the
+// name, version and architecture of the packages they create, see OCILayer.
+type PackagerWithIdentity interface {
+	Packager
+	// ReadIdentity returns the identity of the package read from r.
+	ReadIdentity(r io.Reader) (Identity, error)
+}
+
+// Identity is the name, version and architecture a package is installed as,
+// as recorded in the package in the notation of its format.
+type Identity struct {
+	Name    string
+	Version string
+	Arch    string
+}
+
+// Capabilities are the features that only some packagers support, see
+// PackagerWithCapabilities.
+type Capabilities struct {
+	// Compressions are the compression algorithms of the payload, the first
+	// one being the default.
+	Compressions []string
+	// Signing reports whether the packages can be signed.
+	Signing bool
+	// WeakDependencies reports whether Recommends and Suggests are recorded.
+	WeakDependencies bool
+	// Triggers reports whether the packager supports triggers, see
+	// Deb.Triggers and APK.Triggers.
+	Triggers bool
+}
+
+// PackagerWithCapabilities is implemented by packagers that report their
+// Capabilities, see Formats.
+type PackagerWithCapabilities interface {
+	Packager
+	Capabilities() Capabilities
+}
+
+// SignerConfig is the signature Resign signs a package with. Method, Type and
+// Signer are only used by deb packages and KeyName by apk packages, see
+// DebSignature and APKSignature.
+type SignerConfig struct {
+	PackageSignature
+	Method  string
+	Type    string
+	Signer  string
+	KeyName string
+}
+
+// ErrResignNotSupported happens when Resign is called for a packager which
+// does not implement PackagerWithResign.
+var ErrResignNotSupported = errors.New("packager cannot resign packages")
+
+// Resign signs the package at pkgPath, which was created in the given format,
+// with the given signer, replacing its former signature if any. The package
+// is rewritten to pkgPath + ".tmp" first and moved over pkgPath once it is
+// signed, so that a failure leaves the original package untouched.
+func Resign(format, pkgPath string, signer SignerConfig) (err error) {
+	pkg, err := Get(format)
+	if err != nil {
+		return err
 	}
-	override, ok := c.Overrides[format]
+	resigner, ok := pkg.(PackagerWithResign)
 	if !ok {
-		// no overrides
-		return info, nil
+		return fmt.Errorf("%w: %s", ErrResignNotSupported, format)
+	}
+	if !signer.HasKey() && signer.SignFn == nil {
+		return &ErrSigningFailure{Err: errors.New("signer needs a key file or a sign function")}
+	}
+
+	info := &Info{}
+	info.Deb.Signature = DebSignature{
+		PackageSignature: signer.PackageSignature,
+		Method:           signer.Method,
+		Type:             signer.Type,
+		Signer:           signer.Signer,
+	}
+	info.RPM.Signature = RPMSignature{PackageSignature: signer.PackageSignature}
+	info.APK.Signature = APKSignature{PackageSignature: signer.PackageSignature, KeyName: signer.KeyName}
+	if err := validateSignatureKeys(info); err != nil {
+		return err
+	}
+	if err := resolveKeyEnv(info, format); err != nil {
+		return err
+	}
+
+	in, err := os.Open(pkgPath)
+	if err != nil {
+		return err
 	}
-	if err = mergo.Merge(&info.Overridables, override, mergo.WithOverride); err != nil {
-		return nil, fmt.Errorf("failed to merge overrides into info: %w", err)
+	defer in.Close() // nolint: errcheck
+	stat, err := in.Stat()
+	if err != nil {
+		return err
 	}
 
-	var contents []*files.Content
-	for _, f := range info.Contents {
-		if f.Packager == format || f.Packager == "" {
-			contents = append(contents, f)
+	tmp := pkgPath + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	// whatever fails from here on, do not leave the file behind.
+	defer func() {
+		_ = out.Close()
+		if err != nil {
+			_ = os.Remove(tmp)
 		}
+	}()
+
+	if err := resigner.Resign(info, in, out); err != nil {
+		return err
 	}
-	info.Contents = contents
-	return info, nil
+	if err := out.Close(); err != nil {
+		return err
+	}
+	_ = in.Close()
+	return moveFile(tmp, pkgPath)
 }
 
-// Validate ensures that the config is well typed.
-func (c *Config) Validate() error {
-	if err := Validate(&c.Info); err != nil {
-		return err
+// OCIMediaTypePrefix prefixes the format of a package in the media type of
+// its OCI layer, see OCILayer.
+const OCIMediaTypePrefix = "application/vnd.nfpm.package."
+
+// The annotations of the OCI layer of a package, see OCILayer.
+const (
+	// OCIAnnotationTitle is the file name of the package, which oras uses to
+	// name the file it pulls.
+	OCIAnnotationTitle = "org.opencontainers.image.title"
+	// OCIAnnotationName is the name of the package.
+	OCIAnnotationName = "com.goreleaser.nfpm.name"
+	// OCIAnnotationVersion is the version of the package, in the notation of
+	// its format.
+	OCIAnnotationVersion = "com.goreleaser.nfpm.version"
+	// OCIAnnotationArch is the architecture of the package, in the notation of
+	// its format.
+	OCIAnnotationArch = "com.goreleaser.nfpm.arch"
+)
+
+// OCIDescriptor describes the content of an OCI layer, and is encoded as
+// the descriptors of the OCI image specification are.
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ErrScriptletsNotSupported happens when Scriptlets is called for a packager
+// which does not implement PackagerWithScriptlets.
+var ErrScriptletsNotSupported = errors.New("packager cannot return the scripts of packages")
+
+// Scriptlets returns the maintainer scripts the packager of the given format
+// adds to the package built from info, without building it, so that they can
+// be reviewed: the scripts of the info with the snippets nfpm generates, e.g.
+// for the systemd services, the alternatives or the file attributes,
+// appended. They are keyed by their name in the format:
+//   - deb: preinst, postinst, prerm, postrm and config
+//   - rpm: the spec file sections pretrans, pre, post, preun, postun,
+//     posttrans and verifyscript
+//   - apk: .pre-install, .post-install, .pre-upgrade, .post-upgrade,
+//     .pre-deinstall, .post-deinstall and .trigger
+//   - archlinux: .INSTALL, holding all of the scripts
+//
+// Only the scripts the package would have are returned.
+func Scriptlets(info *Info, format string) (map[string]string, error) {
+	pkg, err := Get(format)
+	if err != nil {
+		return nil, err
 	}
-	for format := range c.Overrides {
-		if _, err := Get(format); err != nil {
+	scriptlets, ok := pkg.(PackagerWithScriptlets)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrScriptletsNotSupported, format)
+	}
+	return scriptlets.Scriptlets(info)
+}
+
+// ErrOCINotSupported happens when OCILayer is called for a packager which
+// does not implement PackagerWithIdentity.
+var ErrOCINotSupported = errors.New("packager cannot read the identity of packages")
+
+// OCILayer returns the descriptor and the blob of an OCI layer wrapping the
+// package at pkgPath, which was created in the given format, so that it can
+// be pushed to a registry, e.g. with oras. The media type of the layer is
+// OCIMediaTypePrefix followed by the format, and it is annotated with the
+// file name, name, version and architecture of the package. The package is
+// read into memory.
+func OCILayer(pkgPath, format string) (OCIDescriptor, io.Reader, error) {
+	pkg, err := Get(format)
+	if err != nil {
+		return OCIDescriptor{}, nil, err
+	}
+	reader, ok := pkg.(PackagerWithIdentity)
+	if !ok {
+		return OCIDescriptor{}, nil, fmt.Errorf("%w: %s", ErrOCINotSupported, format)
+	}
+
+	blob, err := os.ReadFile(pkgPath)
+	if err != nil {
+		return OCIDescriptor{}, nil, err
+	}
+	identity, err := reader.ReadIdentity(bytes.NewReader(blob))
+	if err != nil {
+		return OCIDescriptor{}, nil, fmt.Errorf("%s: %w", pkgPath, err)
+	}
+
+	digest := sha256.Sum256(blob)
+	return OCIDescriptor{
+		MediaType: OCIMediaTypePrefix + format,
+		Digest:    "sha256:" + hex.EncodeToString(digest[:]),
+		Size:      int64(len(blob)),
+		Annotations: map[string]string{
+			OCIAnnotationTitle:   filepath.Base(pkgPath),
+			OCIAnnotationName:    identity.Name,
+			OCIAnnotationVersion: identity.Version,
+			OCIAnnotationArch:    identity.Arch,
+		},
+	}, bytes.NewReader(blob), nil
+}
+
+// DefaultSelfExtractingStub is the stub MakeSelfExtracting prepends when none
+// is given: it extracts the package to a temporary directory and installs it
+// with the package manager of its format.
+const DefaultSelfExtractingStub = `#!/bin/sh
+set -e
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT
+tail -c +$(({{ .Offset }} + 1)) "$0" > "$tmp/{{ .Name }}"
+case "{{ .Name }}" in
+*.deb) dpkg -i "$tmp/{{ .Name }}" ;;
+*.rpm) rpm -U "$tmp/{{ .Name }}" ;;
+*.apk) apk add --allow-untrusted "$tmp/{{ .Name }}" ;;
+*.pkg.tar.zst) pacman -U --noconfirm "$tmp/{{ .Name }}" ;;
+*) echo "unknown package format: {{ .Name }}" >&2; exit 1 ;;
+esac
+exit
+`
+
+// SelfExtractingContext is the data passed to the stub of MakeSelfExtracting
+// when it is rendered.
+type SelfExtractingContext struct {
+	// Name is the base name of the package.
+	Name string
+	// Offset is the offset in bytes of the package in the self-extracting
+	// file, i.e. the size of the rendered stub.
+	Offset int64
+	// Size is the size in bytes of the package.
+	Size int64
+}
+
+// MakeSelfExtracting writes to w a POSIX shell stub followed by the package
+// at pkgPath. The stub is the template at stubScript, or
+// DefaultSelfExtractingStub if it is empty, rendered with a
+// SelfExtractingContext. It must exit before reaching the package, which it
+// can extract with e.g. `tail -c +$(({{ .Offset }} + 1)) "$0"`.
+func MakeSelfExtracting(pkgPath, stubScript string, w io.Writer) error {
+	stub := DefaultSelfExtractingStub
+	if stubScript != "" {
+		data, err := os.ReadFile(stubScript)
+		if err != nil {
 			return err
 		}
+		stub = string(data)
+	}
+	tpl, err := template.New(stubScript).Option("missingkey=error").Parse(stub)
+	if err != nil {
+		return NewValidationError("invalid_template", "", "invalid template: %w", err)
 	}
-	return nil
-}
 
-func (c *Config) expandEnvVarsStringSlice(items []string) []string {
-	for i, dep := range items {
-		val := strings.TrimSpace(os.Expand(dep, c.envMappingFunc))
-		items[i] = val
+	pkg, err := os.Open(pkgPath)
+	if err != nil {
+		return err
 	}
-	for i := 0; i < len(items); i++ {
-		if items[i] == "" {
-			items = append(items[:i], items[i+1:]...)
-			i-- // Since we just deleted items[i], we must redo that index
+	defer pkg.Close() // nolint: errcheck
+	stat, err := pkg.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the offset is the size of the stub, which depends on the number of
+	// digits of the offset: render it until both agree.
+	ctx := SelfExtractingContext{Name: filepath.Base(pkgPath), Size: stat.Size()}
+	var rendered bytes.Buffer
+	for i := 0; ; i++ {
+		if i == 10 {
+			return NewValidationError("invalid_template", "", "invalid template: the size of the stub does not settle")
 		}
+		rendered.Reset()
+		if err := tpl.Execute(&rendered, ctx); err != nil {
+			return NewValidationError("invalid_template", "", "invalid template: %w", err)
+		}
+		if !bytes.HasSuffix(rendered.Bytes(), []byte("\n")) {
+			rendered.WriteByte('\n')
+		}
+		if int64(rendered.Len()) == ctx.Offset {
+			break
+		}
+		ctx.Offset = int64(rendered.Len())
 	}
 
-	return items
+	if _, err := w.Write(rendered.Bytes()); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, pkg)
+	return err
 }
 
-func (c *Config) expandEnvVarsContents(contents files.Contents) files.Contents {
-	for i := range contents {
-		f := contents[i]
-		if !f.Expand {
-			continue
+// PackageAll creates one package for each of the given formats in outDir,
+// using the conventional file name of the respective packager. The overrides
+// of each format are applied to a separate copy of the config, so the config
+// itself is not modified. The packages are created concurrently and the paths
+// of the created packages are returned in the same order as the formats. The
+// formats share the bodies of the sources, which are read once for the call,
+// see files.ContentCache.
+func PackageAll(config *Config, formats []string, outDir string) ([]string, error) {
+	infos := make([]*Info, len(formats))
+	pkgs := make([]Packager, len(formats))
+	// the formats read the same sources, which are only read once for this
+	// call, so that they cannot be stale.
+	cache := files.NewContentCache(contentCacheLimit)
+	for i, format := range formats {
+		pkg, err := Get(format)
+		if err != nil {
+			return nil, err
 		}
-		f.Destination = strings.TrimSpace(os.Expand(f.Destination, c.envMappingFunc))
-		f.Source = strings.TrimSpace(os.Expand(f.Source, c.envMappingFunc))
+		info, err := WithOverrides(config, format)
+		if err != nil {
+			return nil, err
+		}
+		info.contentCache = cache
+		infos[i] = info
+		pkgs[i] = pkg
 	}
-	return contents
+
+	targets := make([]string, len(formats))
+	errs := make([]error, len(formats))
+	var wg sync.WaitGroup
+	for i := range formats {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			targets[i], errs[i] = packageTo(pkgs[i], infos[i], formats[i], outDir)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", formats[i], errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if tolerance := config.Info.SizeParityTolerance; tolerance > 0 {
+		checkSizeParity(formats, pkgs, targets, tolerance)
+	}
+	return targets, nil
 }
 
-func (c *Config) expandEnvVars() {
-	// Version related fields
-	c.Info.Release = os.Expand(c.Info.Release, c.envMappingFunc)
-	c.Info.Version = os.Expand(c.Info.Version, c.envMappingFunc)
-	c.Info.Prerelease = os.Expand(c.Info.Prerelease, c.envMappingFunc)
-	c.Info.Platform = os.Expand(c.Info.Platform, c.envMappingFunc)
-	c.Info.Arch = os.Expand(c.Info.Arch, c.envMappingFunc)
-	for or := range c.Overrides {
-		c.Overrides[or].Conflicts = c.expandEnvVarsStringSlice(c.Overrides[or].Conflicts)
-		c.Overrides[or].Depends = c.expandEnvVarsStringSlice(c.Overrides[or].Depends)
-		c.Overrides[or].Replaces = c.expandEnvVarsStringSlice(c.Overrides[or].Replaces)
-		c.Overrides[or].Recommends = c.expandEnvVarsStringSlice(c.Overrides[or].Recommends)
-		c.Overrides[or].Provides = c.expandEnvVarsStringSlice(c.Overrides[or].Provides)
-		c.Overrides[or].Suggests = c.expandEnvVarsStringSlice(c.Overrides[or].Suggests)
-		c.Overrides[or].Contents = c.expandEnvVarsContents(c.Overrides[or].Contents)
+// checkSizeParity warns if the installed sizes reported by the packages at
+// targets differ by more than the tolerance, a fraction of the largest one.
+// As deb packages report it in KiB, differences of up to 1KiB are ignored.
+func checkSizeParity(formats []string, pkgs []Packager, targets []string, tolerance float64) {
+	type reported struct {
+		format string
+		size   int64
+	}
+	var sizes []reported
+	for i, pkg := range pkgs {
+		sizer, ok := pkg.(PackagerWithInstalledSize)
+		if !ok {
+			continue
+		}
+		f, err := os.Open(targets[i])
+		if err != nil {
+			warning.Printf("%s: cannot read the installed size: %v\n", formats[i], err)
+			continue
+		}
+		size, err := sizer.InstalledSize(f)
+		_ = f.Close()
+		if err != nil {
+			warning.Printf("%s: cannot read the installed size: %v\n", formats[i], err)
+			continue
+		}
+		sizes = append(sizes, reported{formats[i], size})
+	}
+	if len(sizes) < 2 {
+		return
 	}
-	c.Info.Conflicts = c.expandEnvVarsStringSlice(c.Info.Conflicts)
-	c.Info.Depends = c.expandEnvVarsStringSlice(c.Info.Depends)
-	c.Info.Replaces = c.expandEnvVarsStringSlice(c.Info.Replaces)
-	c.Info.Recommends = c.expandEnvVarsStringSlice(c.Info.Recommends)
-	c.Info.Provides = c.expandEnvVarsStringSlice(c.Info.Provides)
-	c.Info.Suggests = c.expandEnvVarsStringSlice(c.Info.Suggests)
-	c.Info.Contents = c.expandEnvVarsContents(c.Info.Contents)
 
-	// Basic metadata fields
-	c.Info.Name = os.Expand(c.Info.Name, c.envMappingFunc)
-	c.Info.Homepage = os.Expand(c.Info.Homepage, c.envMappingFunc)
-	c.Info.Maintainer = os.Expand(c.Info.Maintainer, c.envMappingFunc)
-	c.Info.Vendor = os.Expand(c.Info.Vendor, c.envMappingFunc)
+	smallest := slices.MinFunc(sizes, func(a, b reported) int { return cmp.Compare(a.size, b.size) })
+	largest := slices.MaxFunc(sizes, func(a, b reported) int { return cmp.Compare(a.size, b.size) })
+	if diff := largest.size - smallest.size; diff > 1024 && float64(diff) > tolerance*float64(largest.size) {
+		warning.Printf("installed sizes differ by %.0f%%, maybe a format drops files: %s reports %d bytes, %s %d bytes\n",
+			100*float64(diff)/float64(largest.size), largest.format, largest.size, smallest.format, smallest.size)
+	}
+}
+
+func packageTo(pkg Packager, info *Info, format, outDir string) (string, error) {
+	target := filepath.Join(outDir, pkg.ConventionalFileName(info))
+	if err := writePackage(pkg, info, format, target, WriteOptions{Overwrite: true}); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// WriteOptions controls how PackageFile writes the package file.
+type WriteOptions struct {
+	// Atomic writes the package to path + ".tmp", or to a temporary file in
+	// Info.TempDir if it is set, first and moves it to path once the package
+	// was created successfully, so that a failed build never leaves a
+	// partially written package behind.
+	Atomic bool
+	// Overwrite replaces an existing file at path. The package is then
+	// written to a temporary file next to it first, so that the existing file
+	// is kept if the package cannot be created. If it is not set and the file
+	// already exists, PackageFile fails with an error wrapping fs.ErrExist.
+	Overwrite bool
+	// FileMode is the mode the package file is given once it is written,
+	// before it is moved to path for atomic writes, regardless of the umask
+	// of the process. It defaults to DefaultPackageFileMode.
+	FileMode fs.FileMode
+}
+
+// DefaultPackageFileMode is the mode of the package files written by
+// PackageFile, unless WriteOptions.FileMode is set.
+const DefaultPackageFileMode fs.FileMode = 0o644
+
+func (opts WriteOptions) fileMode() fs.FileMode {
+	if opts.FileMode == 0 {
+		return DefaultPackageFileMode
+	}
+	return opts.FileMode.Perm()
+}
+
+// PackageFile creates a package in the given format at path.
+func PackageFile(info *Info, format, path string, opts WriteOptions) error {
+	pkg, err := Get(format)
+	if err != nil {
+		return err
+	}
+	return writePackage(pkg, info, format, path, opts)
+}
+
+func writePackage(pkg Packager, info *Info, format, path string, opts WriteOptions) (err error) {
+	if !opts.Overwrite {
+		if _, err := os.Lstat(path); err == nil {
+			return &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+		}
+	}
+
+	f, moved, err := createPackageFile(info, path, opts)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	// whatever fails from here on, do not leave the file behind, which is
+	// always one this call created.
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	cp := *info
+	cp.Target = path
+	info = &cp
+	var prepared preparedInfo
+	if info.BuildInfo {
+		info.prepared = &prepared
+	}
+	if err := pkg.Package(info, f); err != nil {
+		return err
+	}
+	// the verification prepares its own copy, which must not replace the
+	// one the package was built from.
+	info.prepared = nil
+	if err := f.Chmod(opts.fileMode()); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if info.SelfVerify {
+		if err := VerifyFile(pkg, info, tmp); err != nil {
+			return err
+		}
+	}
+
+	if moved {
+		if !opts.Overwrite {
+			if _, err := os.Lstat(path); err == nil {
+				return &fs.PathError{Op: "rename", Path: path, Err: fs.ErrExist}
+			}
+		}
+		if err := moveFile(tmp, path); err != nil {
+			return err
+		}
+	}
+
+	if info.BuildInfo {
+		// the package is in place, so that the manifest is only written
+		// for a package that exists.
+		if prepared.info == nil {
+			// the packager did not prepare the info itself.
+			prepared.info = info.Copy()
+			if err := PrepareForPackager(prepared.info, format); err != nil {
+				return fmt.Errorf("buildinfo: %w", err)
+			}
+		}
+		if err := writeBuildInfo(prepared.info, format, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preparedInfo holds the info PrepareForPackager prepared while a package
+// was created, so that the build info describes the contents of the package
+// without preparing them again.
+type preparedInfo struct {
+	info *Info
+}
+
+// BuildInfoExtension is appended to the path of a package to name its build
+// info manifest.
+const BuildInfoExtension = ".buildinfo.json"
+
+// BuildInfo is the reproducibility manifest of a package, written as JSON
+// when Info.BuildInfo is set. It only describes inputs that do not depend on
+// the build environment, such as the paths of the sources, so two builds of
+// the same inputs with the same version of nfpm have identical manifests, as
+// long as they have the same MTime. It is not a dpkg .buildinfo file.
+type BuildInfo struct {
+	Format  string           `json:"format"`
+	Package BuildInfoPackage `json:"package"`
+	// MTime is the modification time recorded in the package, in RFC 3339
+	// format. It is empty if none was set, i.e. the package is not
+	// reproducible.
+	MTime string `json:"mtime,omitempty"`
+	// Compression is the compression configured for the format, empty for
+	// its default.
+	Compression string          `json:"compression,omitempty"`
+	Files       []BuildInfoFile `json:"files"`
+	Tool        BuildInfoTool   `json:"tool"`
+}
+
+// BuildInfoPackage identifies the package a BuildInfo describes.
+type BuildInfoPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	// File is the base name of the package file.
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BuildInfoFile is a content of the package. Only files have a SHA256, only
+// symlinks and hard links have a Link.
+type BuildInfoFile struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Mode   string `json:"mode"`
+	Owner  string `json:"owner"`
+	Group  string `json:"group"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// BuildInfoTool is the version of nfpm that built the package, as recorded
+// in the build info of the binary.
+type BuildInfoTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// writeBuildInfo writes the BuildInfo of the package at path to path plus
+// BuildInfoExtension. The files are listed as the given info, prepared for
+// the packager, holds them.
+func writeBuildInfo(info *Info, format, path string) error {
+	sum, size, err := sha256File(path)
+	if err != nil {
+		return fmt.Errorf("buildinfo: %w", err)
+	}
+	buildInfo := BuildInfo{
+		Format: format,
+		Package: BuildInfoPackage{
+			Name:    info.Name,
+			Version: info.Version,
+			Arch:    info.Arch,
+			File:    filepath.Base(path),
+			Size:    size,
+			SHA256:  sum,
+		},
+		Files: []BuildInfoFile{},
+		Tool:  BuildInfoTool{Name: "nfpm", Version: toolVersion()},
+	}
+	if !info.MTime.IsZero() {
+		buildInfo.MTime = info.MTime.UTC().Format(time.RFC3339)
+	}
+	switch format {
+	case "deb":
+		buildInfo.Compression = info.Deb.Compression
+	case "rpm":
+		buildInfo.Compression = info.RPM.Compression
+	case "archlinux":
+		buildInfo.Compression = info.ArchLinux.Compression
+	}
+
+	for _, content := range info.Contents {
+		file := BuildInfoFile{
+			Path: files.NormalizeAbsoluteFilePath(content.Destination),
+			Type: content.Type,
+		}
+		if content.FileInfo != nil {
+			file.Mode = fmt.Sprintf("%04o", uint32(content.FileInfo.Mode))
+			file.Owner = content.FileInfo.Owner
+			file.Group = content.FileInfo.Group
+		}
+		switch content.Type {
+		case files.TypeDir, files.TypeImplicitDir:
+			file.Path = files.NormalizeAbsoluteDirPath(content.Destination)
+		case files.TypeSymlink, files.TypeHardlink:
+			file.Link = content.Source
+		case files.TypeRPMGhost, files.TypeDebChangelog:
+			// ghost files have no body, and the changelog is generated
+			// while packaging.
+		default:
+			h := sha256.New()
+			f, err := content.Open()
+			if err != nil {
+				return fmt.Errorf("buildinfo: %s: %w", file.Path, err)
+			}
+			file.Size, err = io.Copy(h, f)
+			_ = f.Close()
+			if err != nil {
+				return fmt.Errorf("buildinfo: %s: %w", file.Path, err)
+			}
+			file.SHA256 = hex.EncodeToString(h.Sum(nil))
+		}
+		buildInfo.Files = append(buildInfo.Files, file)
+	}
+	slices.SortFunc(buildInfo.Files, func(a, b BuildInfoFile) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+
+	bts, err := json.MarshalIndent(buildInfo, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+BuildInfoExtension, append(bts, '\n'), 0o644)
+}
+
+func sha256File(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close() // nolint: errcheck
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// ChecksumsFileName is the conventional name of the file WriteChecksums
+// writes.
+const ChecksumsFileName = "SHA256SUMS"
+
+// WriteChecksums writes the SHA256 checksums of the files at the given paths
+// to w, in the order given and in the format of coreutils' sha256sum, so that
+// `sha256sum -c` can check them from the directory of the files. Only the
+// base names of the files are written, and they must thus be unique.
+func WriteChecksums(paths []string, w io.Writer) error {
+	seen := map[string]string{}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("cannot write checksums: %s and %s have the same name", other, path)
+		}
+		seen[name] = path
+
+		sum, _, err := sha256File(path)
+		if err != nil {
+			return fmt.Errorf("cannot write checksums: %w", err)
+		}
+		if _, err := io.WriteString(w, checksumLine(sum, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checksumLine formats a line of sha256sum output. Like sha256sum does, names
+// with a backslash or a line break are escaped and their line starts with a
+// backslash.
+func checksumLine(sum, name string) string {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return sum + "  " + name + "\n"
+	}
+	name = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(name)
+	return `\` + sum + "  " + name + "\n"
+}
+
+// WriteSignedChecksums writes the checksums of the files at the given paths
+// to sums like WriteChecksums does, and a detached signature of them created
+// with signFn to signature, e.g. to ship a SHA256SUMS.asc next to the
+// SHA256SUMS file. signFn has the same contract as PackageSignature.SignFn.
+func WriteSignedChecksums(paths []string, sums, signature io.Writer, signFn func(io.Reader) ([]byte, error)) error {
+	if signFn == nil {
+		return &ErrSigningFailure{Err: errors.New("a sign function is required")}
+	}
+	var buf bytes.Buffer
+	if err := WriteChecksums(paths, &buf); err != nil {
+		return err
+	}
+	sig, err := signFn(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return &ErrSigningFailure{Err: err}
+	}
+	if _, err := sums.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err = signature.Write(sig)
+	return err
+}
+
+// WriteDebChanges writes to w a Debian .changes file of format 1.8
+// describing the deb packages at the given paths, built from info, so that
+// they can be uploaded with tools such as dput or `reprepro include`. The
+// binary package names, architectures and version are read back from the
+// packages, which must all have the same version, the date is the MTime of
+// the info, or the current time, and the files are listed with their MD5,
+// SHA1 and SHA256 checksums and sizes. Its Source is the name of the info,
+// its Distribution unstable and its Changes a single entry, as the uploads
+// of binary packages are usually included into the distribution given to
+// the upload tool. The .changes file is not signed.
+func WriteDebChanges(info *Info, pkgPaths []string, w io.Writer) error {
+	if len(pkgPaths) == 0 {
+		return errors.New("cannot write .changes: no packages given")
+	}
+	pkg, err := Get("deb")
+	if err != nil {
+		return err
+	}
+	reader, ok := pkg.(PackagerWithIdentity)
+	if !ok {
+		return fmt.Errorf("%w: deb", ErrOCINotSupported)
+	}
+
+	section := info.Section
+	if category, ok := info.ResolveCategory(); ok && section == "" {
+		section = category.Section
+	}
+	if section == "" {
+		section = "misc"
+	}
+	priority := info.Priority
+	if priority == "" {
+		priority = "optional"
+	}
+	summary, _, _ := strings.Cut(strings.TrimSpace(info.Description), "\n")
+
+	var version string
+	var binaries, archs []string
+	var sha1s, sha256s, md5s strings.Builder
+	for _, path := range pkgPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot write .changes: %w", err)
+		}
+		identity, err := reader.ReadIdentity(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("cannot write .changes: %s: %w", path, err)
+		}
+		if version == "" {
+			version = identity.Version
+		} else if identity.Version != version {
+			return fmt.Errorf("cannot write .changes: %s has version %s, not %s", path, identity.Version, version)
+		}
+		if !slices.Contains(binaries, identity.Name) {
+			binaries = append(binaries, identity.Name)
+		}
+		if !slices.Contains(archs, identity.Arch) {
+			archs = append(archs, identity.Arch)
+		}
+
+		name, size := filepath.Base(path), len(data)
+		fmt.Fprintf(&sha1s, " %x %d %s\n", sha1.Sum(data), size, name)
+		fmt.Fprintf(&sha256s, " %x %d %s\n", sha256.Sum256(data), size, name)
+		fmt.Fprintf(&md5s, " %x %d %s %s %s\n", md5.Sum(data), size, section, priority, name)
+	}
+
+	var b strings.Builder
+	b.WriteString("Format: 1.8\n")
+	fmt.Fprintf(&b, "Date: %s\n", modtime.Get(info.MTime, time.Now()).Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Source: %s\n", info.Name)
+	fmt.Fprintf(&b, "Binary: %s\n", strings.Join(binaries, " "))
+	fmt.Fprintf(&b, "Architecture: %s\n", strings.Join(archs, " "))
+	fmt.Fprintf(&b, "Version: %s\n", version)
+	b.WriteString("Distribution: unstable\n")
+	b.WriteString("Urgency: medium\n")
+	fmt.Fprintf(&b, "Maintainer: %s\n", info.ResolveMaintainer())
+	b.WriteString("Description:\n")
+	for _, binary := range binaries {
+		fmt.Fprintf(&b, " %s - %s\n", binary, summary)
+	}
+	b.WriteString("Changes:\n")
+	fmt.Fprintf(&b, " %s (%s) unstable; urgency=medium\n .\n   * Release %s.\n", info.Name, version, version)
+	b.WriteString("Checksums-Sha1:\n" + sha1s.String())
+	b.WriteString("Checksums-Sha256:\n" + sha256s.String())
+	b.WriteString("Files:\n" + md5s.String())
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// toolVersion returns the version of the nfpm module the running binary was
+// built with, e.g. (devel) for local builds.
+func toolVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if bi.Main.Path == "github.com/goreleaser/nfpm/v2" {
+		return bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == "github.com/goreleaser/nfpm/v2" {
+			return dep.Version
+		}
+	}
+	return ""
+}
+
+// createPackageFile creates the file the package is written to: path itself
+// if it does not exist yet, or a temporary file that is moved to path once
+// the package is written, for atomic writes and to overwrite an existing
+// file, which is kept as is if the package cannot be created. It reports
+// whether the file is to be moved.
+func createPackageFile(info *Info, path string, opts WriteOptions) (*os.File, bool, error) {
+	if !opts.Atomic {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if err == nil || !opts.Overwrite || !errors.Is(err, fs.ErrExist) {
+			return f, false, err
+		}
+		// os.CreateTemp creates the file with 0o600, writePackage sets its
+		// mode once it is written.
+		f, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+		return f, true, err
+	}
+	if info.TempDir == "" {
+		f, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+		return f, true, err
+	}
+	f, err := os.CreateTemp(info.TempDir, filepath.Base(path)+".*.tmp")
+	return f, true, err
+}
+
+// moveFile renames src to dst, copying it over if they are on different file
+// systems, which is likely with Info.TempDir.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() // nolint: errcheck
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	defer out.Close() // nolint: errcheck
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+	if err := out.Chmod(stat.Mode().Perm()); err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+	if err := os.Rename(out.Name(), dst); err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+	return os.Remove(src)
+}
+
+// VerifyFile reads back the package at path, created by pkg with the given
+// info, and checks its consistency. Packagers which do not implement
+// PackagerWithVerify are skipped with a warning.
+func VerifyFile(pkg Packager, info *Info, path string) error {
+	verifier, ok := pkg.(PackagerWithVerify)
+	if !ok {
+		warning.Printf("skipping verification of %s: not supported by the packager\n", path)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+
+	if err := verifier.Verify(info, f); err != nil {
+		return &ErrVerificationFailure{Path: path, Err: err}
+	}
+	return nil
+}
+
+// ContentStats summarizes the contents a package would install.
+type ContentStats struct {
+	// Files is the number of files and symlinks.
+	Files int
+	// Dirs is the number of directories, including implicit parents.
+	Dirs int
+	// Size is the total size of the files, before compression.
+	Size int64
+	// TopLevel breaks the above down by top level directory, e.g. `/usr`.
+	// Contents directly within `/` are counted under `/`.
+	TopLevel map[string]ContentStats
+}
+
+func (s *ContentStats) add(content *files.Content) {
+	switch content.Type {
+	case files.TypeDir, files.TypeImplicitDir:
+		s.Dirs++
+	case files.TypeSymlink, files.TypeHardlink, files.TypeRPMGhost:
+		// ghost files are owned but not installed by the package, and hard
+		// links take no space of their own.
+		s.Files++
+	default:
+		s.Files++
+		s.Size += content.Size()
+	}
+}
+
+// Stats computes the ContentStats of the package info would be packaged into
+// in the given format, without creating it. Contents are resolved as the
+// packager would, so contents of other packagers are excluded, while files
+// generated by the packager itself, such as the deb changelog, are not
+// counted. The given info is not modified.
+func Stats(info *Info, format string) (ContentStats, error) {
+	if _, err := Get(format); err != nil {
+		return ContentStats{}, err
+	}
+
+	cp := info.Copy()
+	cp.Contents = copyContents(info.Contents, format)
+	if err := PrepareForPackager(cp, format); err != nil {
+		return ContentStats{}, err
+	}
+
+	stats := ContentStats{TopLevel: map[string]ContentStats{}}
+	for _, content := range cp.Contents {
+		stats.add(content)
+
+		top := "/"
+		dest := strings.Trim(files.NormalizeAbsoluteFilePath(content.Destination), "/")
+		if dir, _, ok := strings.Cut(dest, "/"); ok || content.Type == files.TypeDir || content.Type == files.TypeImplicitDir {
+			top += dir
+		}
+		topStats := stats.TopLevel[top]
+		topStats.add(content)
+		stats.TopLevel[top] = topStats
+	}
+	return stats, nil
+}
+
+// Check runs everything packaging info in the given format would, from the
+// validation of the fields to the resolution of the contents, without
+// creating the package, and returns all the errors found rather than only
+// the first one. The info is expected to have its overrides merged, see
+// WithOverrides, and is not modified. Errors about the options specific to
+// the packager, such as the rpm compression, are only reported by the
+// packager itself.
+func Check(info *Info, format string) []error {
+	if _, err := Get(format); err != nil {
+		return []error{err}
+	}
+
+	cp := info.Copy()
+	errs := validateForPackager(cp, format)
+	applySnapshot(cp, format)
+	applyRenames(cp, format)
+	if err := validateDependencies(cp, versionComparator(format)); err != nil {
+		errs = append(errs, err)
+	}
+	dedupeDependencies(cp)
+	if err := resolveContents(cp, format); err != nil {
+		errs = append(errs, err)
+	} else if err := applyAutoDeps(cp, format); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Config contains the top level configuration for packages.
+type Config struct {
+	Info           `yaml:",inline" json:",inline"`
+	Overrides      map[string]*Overridables `yaml:"overrides,omitempty" json:"overrides,omitempty" jsonschema:"title=overrides,description=override some fields when packaging with a specific packager,enum=apk,enum=deb,enum=rpm"`
+	envMappingFunc func(string) string
+	// dir is the directory of the config file, which the paths of
+	// ContentsInclude are relative to, or empty if it was not read from a
+	// file.
+	dir string
+	// envLookupFunc looks up the environment variables of the content
+	// conditions, os.Getenv is used if it is nil.
+	envLookupFunc func(string) string
+}
+
+// Get returns the Info struct for the given packager format. Overrides
+// for the given format are merged into the final struct, which is a deep
+// copy that shares nothing with the config but functions and file systems.
+func (c *Config) Get(format string) (info *Info, err error) {
+	info = c.Info.Copy()
+	if err := validateSnapshot(info.Snapshot); err != nil {
+		return nil, err
+	}
+	applySnapshot(info, format)
+
+	override, ok := c.Overrides[format]
+	if !ok {
+		// no overrides
+		info.Contents = copyContents(info.Contents, "")
+	} else {
+		// the overrides are copied as well, as mergo assigns their slices
+		// and maps as is.
+		if err = mergo.Merge(&info.Overridables, deepcopy.Copy(override), mergo.WithOverride); err != nil {
+			return nil, fmt.Errorf("failed to merge overrides into info: %w", err)
+		}
+		info.Contents = copyContents(info.Contents, format)
+	}
+
+	env := c.envLookupFunc
+	if env == nil {
+		env = os.Getenv
+	}
+	if err := applyConditions(info, format, env); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// WithOverrides returns the info of the config for the given format, with
+// its overrides merged and the defaults set, like PackageAll packages it. The
+// config is not modified, so it can be shared between goroutines.
+func WithOverrides(config *Config, format string) (*Info, error) {
+	info, err := config.Get(format)
+	if err != nil {
+		return nil, err
+	}
+	return WithDefaults(info), nil
+}
+
+// copyContents returns a deep copy of the given contents, so that packagers
+// can not modify the contents of the config they were derived from. If format
+// is not empty, only the contents relevant to said format are kept.
+func copyContents(contents files.Contents, format string) files.Contents {
+	var result files.Contents
+	for _, f := range contents {
+		if format != "" && !f.IsForFormat(format) {
+			continue
+		}
+		cp := *f
+		if f.FileInfo != nil {
+			fi := *f.FileInfo
+			cp.FileInfo = &fi
+		}
+		result = append(result, &cp)
+	}
+	return result
+}
+
+// Validate ensures that the config is well typed.
+func (c *Config) Validate() error {
+	if err := Validate(&c.Info); err != nil {
+		return err
+	}
+	for format := range c.Overrides {
+		if _, err := Get(format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) expandEnvVarsStringSlice(items []string) []string {
+	for i, dep := range items {
+		val := strings.TrimSpace(os.Expand(dep, c.envMappingFunc))
+		items[i] = val
+	}
+	for i := 0; i < len(items); i++ {
+		if items[i] == "" {
+			items = append(items[:i], items[i+1:]...)
+			i-- // Since we just deleted items[i], we must redo that index
+		}
+	}
+
+	return items
+}
+
+func (c *Config) expandEnvVarsContents(contents files.Contents) files.Contents {
+	for i := range contents {
+		f := contents[i]
+		if !f.Expand {
+			continue
+		}
+		f.Destination = strings.TrimSpace(os.Expand(f.Destination, c.envMappingFunc))
+		f.Source = strings.TrimSpace(os.Expand(f.Source, c.envMappingFunc))
+		f.Manifest = strings.TrimSpace(os.Expand(f.Manifest, c.envMappingFunc))
+		for j := range f.Sources {
+			f.Sources[j] = strings.TrimSpace(os.Expand(f.Sources[j], c.envMappingFunc))
+		}
+	}
+	return contents
+}
+
+// expandManifests replaces the contents listing a manifest by the contents of
+// the manifest, see files.ExpandManifests.
+func (c *Config) expandManifests() (err error) {
+	if c.Info.Contents, err = files.ExpandManifests(c.Info.Contents); err != nil {
+		return err
+	}
+	for _, override := range c.Overrides {
+		if override == nil {
+			continue
+		}
+		if override.Contents, err = files.ExpandManifests(override.Contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentsInclude is a file of Info.ContentsInclude.
+type contentsInclude struct {
+	Contents files.Contents `yaml:"contents"`
+}
+
+// includeContents appends the contents of the files of ContentsInclude to
+// the contents of the config, in the order of the list, and reports the
+// contents of different files with the same destination. Contents for
+// different packagers may share a destination, as may directories.
+func (c *Config) includeContents() error {
+	if len(c.Info.ContentsInclude) == 0 {
+		return nil
+	}
+
+	type origin struct {
+		file    string
+		content *files.Content
+	}
+	present := map[string][]origin{}
+	add := func(file string, contents files.Contents) error {
+		for _, content := range contents {
+			if content.Destination == "" {
+				continue
+			}
+			dst := files.NormalizeAbsoluteFilePath(content.Destination)
+			for _, other := range present[dst] {
+				if other.file == file ||
+					(content.Packager != "" && other.content.Packager != "" && content.Packager != other.content.Packager) ||
+					(content.Type == files.TypeDir && other.content.Type == files.TypeDir) {
+					continue
+				}
+				return NewValidationError("contents_include_collision", "contents_include", "adding %s from %s: already added by %s: %w", dst, file, other.file, files.ErrContentCollision)
+			}
+			present[dst] = append(present[dst], origin{file: file, content: content})
+		}
+		return nil
+	}
+
+	if err := add("the config", c.Info.Contents); err != nil {
+		return err
+	}
+	for _, name := range c.Info.ContentsInclude {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(c.dir, path)
+		}
+		included, err := readContentsInclude(path)
+		if err != nil {
+			return fmt.Errorf("contents_include: %s: %w", name, err)
+		}
+		if err := add(name, included.Contents); err != nil {
+			return err
+		}
+		c.Info.Contents = append(c.Info.Contents, included.Contents...)
+	}
+	c.Info.ContentsInclude = nil
+	return nil
+}
+
+func readContentsInclude(path string) (included contentsInclude, err error) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return included, err
+	}
+	defer file.Close() // nolint: errcheck,gosec
+
+	var in io.Reader = file
+	if format := FormatFromPath(path); format != FormatYAML {
+		if in, err = toYAML(in, format); err != nil {
+			return included, err
+		}
+	}
+	dec := yaml.NewDecoder(in)
+	dec.KnownFields(true)
+	if err := dec.Decode(&included); err != nil && !errors.Is(err, io.EOF) {
+		return included, err
+	}
+	return included, nil
+}
+
+func (c *Config) expandEnvVars() {
+	// Version related fields
+	c.Info.Release = os.Expand(c.Info.Release, c.envMappingFunc)
+	c.Info.Version = os.Expand(c.Info.Version, c.envMappingFunc)
+	c.Info.Prerelease = os.Expand(c.Info.Prerelease, c.envMappingFunc)
+	c.Info.Platform = os.Expand(c.Info.Platform, c.envMappingFunc)
+	c.Info.Arch = os.Expand(c.Info.Arch, c.envMappingFunc)
+	c.Info.Goarm = os.Expand(c.Info.Goarm, c.envMappingFunc)
+	for or := range c.Overrides {
+		c.Overrides[or].Conflicts = c.expandEnvVarsStringSlice(c.Overrides[or].Conflicts)
+		c.Overrides[or].Depends = c.expandEnvVarsStringSlice(c.Overrides[or].Depends)
+		c.Overrides[or].Replaces = c.expandEnvVarsStringSlice(c.Overrides[or].Replaces)
+		c.Overrides[or].Recommends = c.expandEnvVarsStringSlice(c.Overrides[or].Recommends)
+		c.Overrides[or].Provides = c.expandEnvVarsStringSlice(c.Overrides[or].Provides)
+		c.Overrides[or].Suggests = c.expandEnvVarsStringSlice(c.Overrides[or].Suggests)
+		c.Overrides[or].Contents = c.expandEnvVarsContents(c.Overrides[or].Contents)
+	}
+	c.Info.Conflicts = c.expandEnvVarsStringSlice(c.Info.Conflicts)
+	c.Info.Depends = c.expandEnvVarsStringSlice(c.Info.Depends)
+	c.Info.Replaces = c.expandEnvVarsStringSlice(c.Info.Replaces)
+	c.Info.Recommends = c.expandEnvVarsStringSlice(c.Info.Recommends)
+	c.Info.Provides = c.expandEnvVarsStringSlice(c.Info.Provides)
+	c.Info.Suggests = c.expandEnvVarsStringSlice(c.Info.Suggests)
+	c.Info.Contents = c.expandEnvVarsContents(c.Info.Contents)
+
+	// Basic metadata fields
+	c.Info.Name = os.Expand(c.Info.Name, c.envMappingFunc)
+	c.Info.Homepage = os.Expand(c.Info.Homepage, c.envMappingFunc)
+	c.Info.Maintainer = os.Expand(c.Info.Maintainer, c.envMappingFunc)
+	c.Info.MaintainerName = os.Expand(c.Info.MaintainerName, c.envMappingFunc)
+	c.Info.MaintainerEmail = os.Expand(c.Info.MaintainerEmail, c.envMappingFunc)
+	c.Info.Vendor = os.Expand(c.Info.Vendor, c.envMappingFunc)
+	for k, v := range c.Info.Metadata {
+		c.Info.Metadata[k] = os.Expand(v, c.envMappingFunc)
+	}
+	if c.Info.Snapshot != nil {
+		c.Info.Snapshot.Commit = os.Expand(c.Info.Snapshot.Commit, c.envMappingFunc)
+	}
 
 	// Package signing related fields
 	c.Info.Deb.Signature.KeyFile = os.Expand(c.Deb.Signature.KeyFile, c.envMappingFunc)
@@ -222,296 +1705,3192 @@ func (c *Config) expandEnvVars() {
 	c.Info.Deb.Signature.KeyID = pointer.ToString(os.Expand(pointer.GetString(c.Deb.Signature.KeyID), c.envMappingFunc))
 	c.Info.RPM.Signature.KeyID = pointer.ToString(os.Expand(pointer.GetString(c.RPM.Signature.KeyID), c.envMappingFunc))
 	c.Info.APK.Signature.KeyID = pointer.ToString(os.Expand(pointer.GetString(c.APK.Signature.KeyID), c.envMappingFunc))
+	c.Info.Keyring.KeyFile = os.Expand(c.Info.Keyring.KeyFile, c.envMappingFunc)
+	for k, v := range c.Info.Keyring.Keys {
+		c.Info.Keyring.Keys[k] = os.Expand(v, c.envMappingFunc)
+	}
+
+	// Package signing passphrase
+	generalPassphrase := os.Expand("$NFPM_PASSPHRASE", c.envMappingFunc)
+	c.Info.Deb.Signature.KeyPassphrase = generalPassphrase
+	c.Info.RPM.Signature.KeyPassphrase = generalPassphrase
+	c.Info.APK.Signature.KeyPassphrase = generalPassphrase
+
+	debPassphrase := os.Expand("$NFPM_DEB_PASSPHRASE", c.envMappingFunc)
+	if debPassphrase != "" {
+		c.Info.Deb.Signature.KeyPassphrase = debPassphrase
+	}
+
+	rpmPassphrase := os.Expand("$NFPM_RPM_PASSPHRASE", c.envMappingFunc)
+	if rpmPassphrase != "" {
+		c.Info.RPM.Signature.KeyPassphrase = rpmPassphrase
+	}
+
+	apkPassphrase := os.Expand("$NFPM_APK_PASSPHRASE", c.envMappingFunc)
+	if apkPassphrase != "" {
+		c.Info.APK.Signature.KeyPassphrase = apkPassphrase
+	}
+
+	// RPM specific
+	c.Info.RPM.Packager = os.Expand(c.RPM.Packager, c.envMappingFunc)
+
+	// Deb specific
+	for k, v := range c.Info.Deb.Fields {
+		c.Info.Deb.Fields[k] = os.Expand(v, c.envMappingFunc)
+	}
+	c.Info.Deb.Predepends = c.expandEnvVarsStringSlice(c.Info.Deb.Predepends)
+
+	// APK specific
+	c.Info.APK.Provides = c.expandEnvVarsStringSlice(c.Info.APK.Provides)
+}
+
+// Info contains information about a single package.
+type Info struct {
+	Overridables    `yaml:",inline" json:",inline"`
+	Name            string `yaml:"name" json:"name" jsonschema:"title=package name"`
+	Arch            string `yaml:"arch" json:"arch" jsonschema:"title=target architecture,example=amd64"`
+	Goarm           string `yaml:"goarm,omitempty" json:"goarm,omitempty" jsonschema:"title=arm version used with arch arm,enum=5,enum=6,enum=7"`
+	Platform        string `yaml:"platform,omitempty" json:"platform,omitempty" jsonschema:"title=target platform,example=linux,default=linux"`
+	Epoch           string `yaml:"epoch,omitempty" json:"epoch,omitempty" jsonschema:"title=version epoch,example=2,default=extracted from version"`
+	Version         string `yaml:"version" json:"version" jsonschema:"title=version,example=v1.0.2,example=2.0.1"`
+	VersionSchema   string `yaml:"version_schema,omitempty" json:"version_schema,omitempty" jsonschema:"title=version schema,enum=semver,enum=none,default=semver"`
+	Release         string `yaml:"release,omitempty" json:"release,omitempty" jsonschema:"title=version release,example=1"`
+	Prerelease      string `yaml:"prerelease,omitempty" json:"prerelease,omitempty" jsonschema:"title=version prerelease,default=extracted from version"`
+	VersionMetadata string `yaml:"version_metadata,omitempty" json:"version_metadata,omitempty" jsonschema:"title=version metadata,example=git"`
+	Section         string `yaml:"section,omitempty" json:"section,omitempty" jsonschema:"title=package section,example=default"`
+	Category        string `yaml:"category,omitempty" json:"category,omitempty" jsonschema:"title=generic package category,example=utils,description=sets the deb section and rpm group if they are not set"`
+	Priority        string `yaml:"priority,omitempty" json:"priority,omitempty" jsonschema:"title=package priority,example=extra"`
+	Maintainer      string `yaml:"maintainer,omitempty" json:"maintainer,omitempty" jsonschema:"title=package maintainer,example=me@example.com"`
+	// MaintainerName and MaintainerEmail are the maintainer in structured
+	// form, composed into Maintainer as `Name <email>`, see
+	// ResolveMaintainer.
+	MaintainerName  string    `yaml:"maintainer_name,omitempty" json:"maintainer_name,omitempty" jsonschema:"title=name of the package maintainer,example=Foo Team"`
+	MaintainerEmail string    `yaml:"maintainer_email,omitempty" json:"maintainer_email,omitempty" jsonschema:"title=email of the package maintainer,example=foo-team@example.com"`
+	Description     string    `yaml:"description,omitempty" json:"description,omitempty" jsonschema:"title=package description"`
+	Vendor          string    `yaml:"vendor,omitempty" json:"vendor,omitempty" jsonschema:"title=package vendor,example=MyCorp"`
+	Homepage        string    `yaml:"homepage,omitempty" json:"homepage,omitempty" jsonschema:"title=package homepage,example=https://example.com"`
+	License         string    `yaml:"license,omitempty" json:"license,omitempty" jsonschema:"title=package license,example=MIT"`
+	Changelog       string    `yaml:"changelog,omitempty" json:"changelog,omitempty" jsonschema:"title=package changelog,example=changelog.yaml,description=see https://github.com/goreleaser/chglog for more details"`
+	DisableGlobbing bool      `yaml:"disable_globbing,omitempty" json:"disable_globbing,omitempty" jsonschema:"title=whether to disable file globbing,default=false"`
+	MTime           time.Time `yaml:"mtime,omitempty" json:"mtime,omitempty" jsonschema:"title=time to set into the files generated by nFPM"`
+	// ContentsInclude are the paths of files with a contents list, merged
+	// into Contents once the config is parsed, see Config.includeContents.
+	// They are relative to the directory of the config file.
+	ContentsInclude []string `yaml:"contents_include,omitempty" json:"contents_include,omitempty" jsonschema:"title=files with contents to merge into the contents,example=component.yaml"`
+	// DirectoryModes overrides the file info of directories that are
+	// implicitly created as parents of other contents, keyed by path.
+	DirectoryModes map[string]files.ContentFileInfo `yaml:"directory_modes,omitempty" json:"directory_modes,omitempty" jsonschema:"title=file info of implicitly created parent directories"`
+	// ModePolicies restrict the modes of the contents matching their paths,
+	// see applyModePolicies.
+	ModePolicies []ModePolicy `yaml:"mode_policies,omitempty" json:"mode_policies,omitempty" jsonschema:"title=policies on the modes of the contents"`
+	// DisownStandardDirs keeps standard directories such as /usr or /etc,
+	// which are usually owned by the filesystem package, out of the package.
+	DisownStandardDirs bool `yaml:"disown_standard_dirs,omitempty" json:"disown_standard_dirs,omitempty" jsonschema:"title=do not own standard directories,default=false"`
+	// StandardDirs overrides the directories that are not owned when
+	// DisownStandardDirs is set. Defaults to files.StandardDirectories().
+	StandardDirs []string `yaml:"standard_dirs,omitempty" json:"standard_dirs,omitempty" jsonschema:"title=standard directories that are not owned"`
+	// DisallowEscapingSymlinks turns the warnings about symlinks pointing
+	// outside of the package tree into errors.
+	DisallowEscapingSymlinks bool `yaml:"disallow_escaping_symlinks,omitempty" json:"disallow_escaping_symlinks,omitempty" jsonschema:"title=fail on symlinks pointing outside of the package tree,default=false"`
+	// StaticOwnership turns the warnings about contents owned by numeric user
+	// or group ids into errors.
+	StaticOwnership bool `yaml:"static_ownership,omitempty" json:"static_ownership,omitempty" jsonschema:"title=fail on numeric owners and groups,default=false"`
+	// PasswdFile and GroupFile are files in the format of /etc/passwd and
+	// /etc/group of the target system, which resolve the names of the owners
+	// and groups of the contents to the ids recorded next to them in deb, apk
+	// and archlinux packages. rpm packages only record names. Owners and
+	// groups missing from them are errors.
+	PasswdFile string `yaml:"passwd_file,omitempty" json:"passwd_file,omitempty" jsonschema:"title=passwd file resolving the owners of the contents"`
+	GroupFile  string `yaml:"group_file,omitempty" json:"group_file,omitempty" jsonschema:"title=group file resolving the groups of the contents"`
+	// AutoDeps adds the shared objects the ELF files of the package provide
+	// and need to its relationships, see files.SharedObjects and
+	// applyAutoDeps.
+	AutoDeps bool `yaml:"auto_deps,omitempty" json:"auto_deps,omitempty" jsonschema:"title=derive the relationships from the shared objects of the ELF files,default=false"`
+	// NonRootOwnership is what happens when contents of system directories,
+	// such as /usr or /etc, are owned by a user or group other than root,
+	// see files.NonRootOwnership: one of NonRootOwnershipIgnore, the
+	// default, NonRootOwnershipWarn or NonRootOwnershipError.
+	NonRootOwnership string `yaml:"non_root_ownership,omitempty" json:"non_root_ownership,omitempty" jsonschema:"title=what happens when contents of system directories are not owned by root,enum=ignore,enum=warn,enum=error,default=ignore"`
+	// ForbidWorldWritable fails the build if a content other than a symlink
+	// is writable by others, i.e. has the 0o002 bit set, unless it matches
+	// one of WorldWritableAllowlist, see files.WorldWritable.
+	ForbidWorldWritable bool `yaml:"forbid_world_writable,omitempty" json:"forbid_world_writable,omitempty" jsonschema:"title=fail on world-writable contents,default=false"`
+	// WorldWritableAllowlist are the destinations that may be world-writable
+	// with ForbidWorldWritable, matched like the path of a ModePolicy, e.g.
+	// /var/tmp/foo for a sticky directory.
+	WorldWritableAllowlist []string `yaml:"world_writable_allowlist,omitempty" json:"world_writable_allowlist,omitempty" jsonschema:"title=destinations that may be world-writable,example=/var/tmp/foo"`
+	// CheckELFArch fails the build if an executable or shared library of the
+	// contents is an ELF file built for another architecture than Arch, see
+	// files.CheckELFArch.
+	CheckELFArch bool `yaml:"check_elf_arch,omitempty" json:"check_elf_arch,omitempty" jsonschema:"title=fail on ELF files of another architecture,default=false"`
+	// TargetDistro is the distribution the package is built for, such as
+	// debian or fedora. It enables warnings about contents that do not
+	// follow the conventions of the distribution.
+	TargetDistro string `yaml:"target_distro,omitempty" json:"target_distro,omitempty" jsonschema:"title=distribution the package is built for,enum=debian,enum=ubuntu,enum=fedora,enum=rhel,enum=centos,enum=rocky,enum=almalinux,enum=opensuse,enum=sles,enum=alpine,enum=arch,enum=archlinux"`
+	// MinToolVersion is the oldest version of the package manager of each
+	// format the package must install with, such as 1.17.27 for deb, the
+	// version of dpkg, or 4.11.3 for rpm. The packagers fall back to the
+	// compressions and digests that version supports and leave out the
+	// features it lacks, warning about each of them.
+	MinToolVersion map[string]string `yaml:"min_tool_version,omitempty" json:"min_tool_version,omitempty" jsonschema:"title=oldest dpkg and rpm versions the package must install with"`
+	// SuppressLints lists the names of the lints of the target distro, and
+	// of the Lints of the packagers, that are not reported.
+	SuppressLints []string `yaml:"suppress_lints,omitempty" json:"suppress_lints,omitempty" jsonschema:"title=target distro lints that are not reported,example=usr-merge"`
+	// StrictLints makes the findings of the lints errors instead of
+	// warnings.
+	StrictLints bool `yaml:"strict_lints,omitempty" json:"strict_lints,omitempty" jsonschema:"title=make the findings of the target distro lints errors,default=false"`
+	// ContentOrder sets the order of the contents inside of the package,
+	// either ContentOrderSorted or ContentOrderConfig.
+	ContentOrder string `yaml:"content_order,omitempty" json:"content_order,omitempty" jsonschema:"title=order of the contents inside of the package,enum=sorted,enum=config,default=sorted"`
+	// OnEmptyGlob is the OnEmptyGlob of the contents that do not set one,
+	// i.e. what happens when their glob matches no files.
+	OnEmptyGlob string `yaml:"on_empty_glob,omitempty" json:"on_empty_glob,omitempty" jsonschema:"title=what happens when the glob of a content matches no files,enum=error,enum=warn,enum=skip,default=error"`
+	// CompressionOptions tunes the xz and zstd compressors of the payloads.
+	CompressionOptions CompressionOptions `yaml:"compression_options,omitempty" json:"compression_options,omitempty" jsonschema:"title=options of the xz and zstd compressors"`
+	// SizeParityTolerance makes PackageAll warn if the installed sizes the
+	// packages it creates report differ by more than this fraction of the
+	// largest one, e.g. 0.1, which usually means that a format drops files.
+	// Only the packagers implementing PackagerWithInstalledSize are compared.
+	SizeParityTolerance float64 `yaml:"size_parity_tolerance,omitempty" json:"size_parity_tolerance,omitempty" jsonschema:"title=tolerated difference of the installed sizes of the formats,example=0.1"`
+	// ScriptShell is the absolute path of the shell the scripts nfpm
+	// generates, such as those of the systemd services and the alternatives,
+	// start with, DefaultScriptShell if empty. rpm runs all the scriptlets of
+	// the package with it, see ScriptInterpreter.
+	ScriptShell string `yaml:"script_shell,omitempty" json:"script_shell,omitempty" jsonschema:"title=shell of the generated scripts,default=/bin/sh"`
+	// MaxPathLength, if positive, is the maximum length in bytes of the
+	// destinations of the contents, for the filesystems and tools that choke
+	// on longer paths. Destinations with control characters, or that are not
+	// absolute once prepared, are always rejected.
+	MaxPathLength int `yaml:"max_path_length,omitempty" json:"max_path_length,omitempty" jsonschema:"title=maximum length of the destinations of the contents,example=255"`
+	// Keyring selects the signing key of each packager from a single keyring
+	// file, instead of configuring each signature separately.
+	Keyring Keyring `yaml:"keyring,omitempty" json:"keyring,omitempty" jsonschema:"title=keyring used to sign the packages"`
+	// SelfVerify reads back the package once it was written and fails if its
+	// contents, digests or signature are not consistent.
+	SelfVerify bool `yaml:"self_verify,omitempty" json:"self_verify,omitempty" jsonschema:"title=verify the package after creating it,default=false"`
+	// TempDir is the directory atomic writes create the package in before
+	// moving it to its target. Defaults to the directory of the target.
+	TempDir string `yaml:"temp_dir,omitempty" json:"temp_dir,omitempty" jsonschema:"title=directory for intermediate files"`
+	// BuildInfo writes a reproducibility manifest next to the package, at
+	// its path plus BuildInfoExtension, see BuildInfo.
+	BuildInfo bool `yaml:"buildinfo,omitempty" json:"buildinfo,omitempty" jsonschema:"title=write a reproducibility manifest next to the package,default=false"`
+	// Download configures how the contents with http:// or https:// sources
+	// are downloaded, see applyDownloads.
+	Download Download `yaml:"download,omitempty" json:"download,omitempty" jsonschema:"title=download of URL sources"`
+	// Categories adds to or overrides the entries of DefaultCategories used to
+	// look up Category.
+	Categories map[string]Category `yaml:"categories,omitempty" json:"categories,omitempty" jsonschema:"title=mapping of categories to the deb section and rpm group"`
+	// Metadata is build metadata, such as the commit or the CI build URL,
+	// recorded in the package: as Metadata-<key> control fields in debs, at
+	// the end of the description in rpms and as comments in the .PKGINFO of
+	// apks. It can be read back with PackagerWithMetadata.
+	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty" jsonschema:"title=build metadata recorded in the package"`
+	// Snapshot turns the package into a snapshot build, whose version sorts
+	// below the version of the info, see Snapshot.
+	Snapshot *Snapshot `yaml:"snapshot,omitempty" json:"snapshot,omitempty" jsonschema:"title=snapshot build"`
+	// InstallPrefix relocates all contents below the given absolute path,
+	// e.g. /usr/bin/foo to /opt/foo/usr/bin/foo, see applyInstallPrefix.
+	InstallPrefix string `yaml:"install_prefix,omitempty" json:"install_prefix,omitempty" jsonschema:"title=prefix of all content destinations,example=/opt/foo"`
+	// StagingRoot is a staging tree, such as the DESTDIR of `make install`,
+	// the contents without a destination whose source is within are
+	// installed at their path within, see files.FromStagingRoot.
+	StagingRoot string `yaml:"staging_root,omitempty" json:"staging_root,omitempty" jsonschema:"title=staging tree the destinations of the contents are relative to,example=./destdir"`
+	// PreserveMTimes records the modification time of the source files
+	// instead of MTime, as if each content set file_info.preserve_mtime. The
+	// packages are then only reproducible if the source files keep their
+	// modification times.
+	PreserveMTimes bool `yaml:"preserve_mtimes,omitempty" json:"preserve_mtimes,omitempty" jsonschema:"title=use the modification times of the source files,default=false"`
+	// DefAttr is the default file info of the contents that do not set their
+	// own, like the %defattr of rpm spec files, see applyDefAttr.
+	DefAttr DefAttr `yaml:"defattr,omitempty" json:"defattr,omitempty" jsonschema:"title=default file info of the contents"`
+	// DefaultDirMode is the mode of the directories that do not set their
+	// own, instead of 0755: the contents of type dir, the directories of the
+	// trees and the implicitly created parents of the other contents. The
+	// dir_mode of DefAttr, the PathDefaults and the DirectoryModes take
+	// precedence, see applyDefAttr and applyDefaultDirMode.
+	DefaultDirMode fs.FileMode `yaml:"default_dir_mode,omitempty" json:"default_dir_mode,omitempty" jsonschema:"title=default mode of the directories,example=0750"`
+	// FileInfoTemplates are named file infos the contents can reference with
+	// file_info_ref instead of repeating them, see applyFileInfoRefs.
+	FileInfoTemplates map[string]files.ContentFileInfo `yaml:"file_info_templates,omitempty" json:"file_info_templates,omitempty" jsonschema:"title=file infos the contents can reference by name"`
+	// PathDefaults are the default file info of the contents below some
+	// destinations, which take precedence over DefAttr, see
+	// applyPathDefaults.
+	PathDefaults []PathDefault `yaml:"path_defaults,omitempty" json:"path_defaults,omitempty" jsonschema:"title=default file info of the contents by destination prefix"`
+	// Renames lists the former names of the package, which are turned into
+	// the relationships each packager uses to replace them, see applyRenames.
+	Renames []Rename `yaml:"renames,omitempty" json:"renames,omitempty" jsonschema:"title=former names of the package"`
+	// CompressManPages gzips the man pages below /usr/share/man and adds .gz
+	// to their destinations, and to the targets of the symlinks to them, see
+	// compressManPages.
+	CompressManPages bool `yaml:"compress_man_pages,omitempty" json:"compress_man_pages,omitempty" jsonschema:"title=gzip the man pages,default=false"`
+	// Dedup stores files with identical contents and file info only once,
+	// and the other copies as hard links to it, in the packagers that
+	// support them, see dedupContents.
+	Dedup bool `yaml:"dedup,omitempty" json:"dedup,omitempty" jsonschema:"title=store identical files once and hard link the copies,default=false"`
+	// Reproducible pins everything a build would otherwise take from the
+	// time or the file system it runs on, so that the same config always
+	// yields the same packages, see applyReproducible.
+	Reproducible bool `yaml:"reproducible,omitempty" json:"reproducible,omitempty" jsonschema:"title=pin the dates and the order of the contents for reproducible builds,default=false"`
+	// ContentTransformers run in order on the contents once they are
+	// globbed, merged with the overrides and prepared for the packager, after
+	// the built-in transformations such as the man page compression and
+	// before the contents are validated and packaged. They can only be set
+	// programmatically.
+	ContentTransformers []ContentTransformer `yaml:"-" json:"-"`
+	Target              string               `yaml:"-" json:"-"`
+
+	// contentCache is shared by the infos PackageAll builds the packages of,
+	// so that their sources are only read once, see files.ContentCache.
+	contentCache *files.ContentCache
+	// prepared is shared by the copies of the info a packager prepares, and
+	// records the prepared one, see writePackage.
+	prepared *preparedInfo
+}
+
+// contentCacheLimit is the size of the sources PackageAll keeps in memory
+// to build the packages of all formats without reading them again.
+const contentCacheLimit = 256 << 20
+
+// Rename is a former name of the package.
+type Rename struct {
+	// From is the former name of the package.
+	From string `yaml:"from" json:"from" jsonschema:"title=former name of the package"`
+	// UpToVersion is the first version that is released under the new name,
+	// all the versions of the former package below it are replaced. If it is
+	// empty, all the versions are, or on rpm the ones below the version of
+	// the package.
+	UpToVersion string `yaml:"up_to_version,omitempty" json:"up_to_version,omitempty" jsonschema:"title=first version released under the new name,example=2.0.0"`
+}
+
+// nolint: gochecknoglobals
+var (
+	renameNameRegexp    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._-]*$`)
+	renameVersionRegexp = regexp.MustCompile(`^([0-9]+:)?[0-9][A-Za-z0-9+.~_-]*$`)
+)
+
+func validateRenames(info *Info) error {
+	for _, rename := range info.Renames {
+		if !renameNameRegexp.MatchString(rename.From) {
+			return NewValidationError("invalid_rename", "renames", "invalid rename from %q: names may only contain letters, digits, '+', '.', '-' and '_'", rename.From)
+		}
+		if rename.From == info.Name {
+			return NewValidationError("invalid_rename", "renames", "invalid rename from %q: the package can not replace itself", rename.From)
+		}
+		if rename.UpToVersion != "" && !renameVersionRegexp.MatchString(rename.UpToVersion) {
+			return NewValidationError("invalid_rename", "renames", "invalid rename from %q: invalid version %q", rename.From, rename.UpToVersion)
+		}
+	}
+	return nil
+}
+
+// applyRenames adds the relationships that replace the former names of the
+// package in the syntax of the given packager, and clears the renames so that
+// they are only applied once. With V being UpToVersion, the package:
+//   - deb: provides `old (= V)`, and replaces and conflicts with `old (<< V)`
+//   - rpm: provides `old = V` and obsoletes `old < V`
+//   - apk: provides `old=V` and replaces `old`
+//   - others: provide `old=V`, and replace and conflict with `old<V`
+//
+// Without a version, the former package is provided, replaced and conflicted
+// with regardless of its version, except on rpm, where a package that
+// provides and obsoletes the same name obsoletes itself: there V is the
+// epoch:version-release of the package, as the fedora guidelines advise.
+func applyRenames(info *Info, packager string) {
+	if len(info.Renames) == 0 {
+		return
+	}
+
+	var provides, replaces, conflicts []string
+	for _, rename := range info.Renames {
+		old, v := rename.From, rename.UpToVersion
+		if v == "" && packager == "rpm" {
+			v = rpmEVR(info)
+		}
+		if v == "" {
+			provides = append(provides, old)
+			replaces = append(replaces, old)
+			conflicts = append(conflicts, old)
+			continue
+		}
+		switch packager {
+		case "deb":
+			provides = append(provides, fmt.Sprintf("%s (= %s)", old, v))
+			replaces = append(replaces, fmt.Sprintf("%s (<< %s)", old, v))
+			conflicts = append(conflicts, fmt.Sprintf("%s (<< %s)", old, v))
+		case "rpm":
+			provides = append(provides, fmt.Sprintf("%s = %s", old, v))
+			replaces = append(replaces, fmt.Sprintf("%s < %s", old, v))
+		case "apk":
+			provides = append(provides, fmt.Sprintf("%s=%s", old, v))
+			replaces = append(replaces, old)
+		default:
+			provides = append(provides, fmt.Sprintf("%s=%s", old, v))
+			replaces = append(replaces, fmt.Sprintf("%s<%s", old, v))
+			conflicts = append(conflicts, fmt.Sprintf("%s<%s", old, v))
+		}
+	}
+	switch packager {
+	case "rpm", "apk":
+		// obsoletes, and replaces on apk, already keep both packages from
+		// being installed together.
+		conflicts = nil
+	}
+
+	// the slices may be shared with the config the info was derived from
+	info.Provides = append(slices.Clone(info.Provides), provides...)
+	info.Replaces = append(slices.Clone(info.Replaces), replaces...)
+	info.Conflicts = append(slices.Clone(info.Conflicts), conflicts...)
+	info.Renames = nil
+}
+
+// rpmEVR returns the epoch:version-release of the package as the rpm
+// packager writes it.
+func rpmEVR(info *Info) string {
+	version := info.Version
+	if info.Prerelease != "" {
+		version += "~" + info.Prerelease
+	}
+	if info.VersionMetadata != "" {
+		version += "+" + info.VersionMetadata
+	}
+	release := info.Release
+	if release == "" {
+		release = "1"
+	}
+	version += "-" + release
+	if info.Epoch != "" {
+		version = info.Epoch + ":" + version
+	}
+	return version
+}
+
+// Snapshot replaces the prerelease of the version with one made of the date
+// of the build, which is the mtime of the info or SOURCE_DATE_EPOCH, and of
+// the commit, in the form each packager sorts below the version itself:
+//
+//   - deb: 1.2.3~snapshot.20240101.abcdef
+//   - rpm: 1.2.3-0.snapshot.20240101.abcdef, overriding the release
+//   - archlinux: 1.2.3-0.20240101.abcdef, overriding the release, as pacman
+//     sorts 1.2.3~snapshot after 1.2.3
+//   - apk: 1.2.3_pre20240101-r0, as apk versions cannot hold the commit
+//
+// It is applied by Config.Get and PrepareForPackager, and the conventional
+// file names of the packagers, see WithSnapshot.
+type Snapshot struct {
+	// Commit is the short commit hash the package is built from, if any.
+	Commit string `yaml:"commit,omitempty" json:"commit,omitempty" jsonschema:"title=short commit hash,example=abcdef"`
+}
+
+func validateInstallPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(prefix, "/") || prefix == "/" || path.Clean(prefix) != strings.TrimSuffix(prefix, "/") {
+		return NewValidationError("invalid_install_prefix", "install_prefix", "invalid install prefix: %q: must be an absolute path other than /", prefix)
+	}
+	return nil
+}
+
+// systemdUnitDirs are the directories systemd loads units from, which are
+// kept in place by the install prefix so that the units are still found.
+// nolint: gochecknoglobals
+var systemdUnitDirs = []string{
+	"/etc/systemd/system",
+	"/etc/systemd/user",
+	"/lib/systemd/system",
+	"/usr/lib/systemd/system",
+	"/usr/lib/systemd/user",
+}
+
+// systemdUnitTypes are the suffixes of the units, systemctl assuming a
+// service for the names without one.
+// nolint: gochecknoglobals
+var systemdUnitTypes = []string{
+	".automount", ".device", ".mount", ".path", ".scope", ".service",
+	".slice", ".socket", ".swap", ".target", ".timer",
+}
+
+func inSystemdUnitDir(dst string) bool {
+	dst = path.Clean("/" + dst)
+	for _, dir := range systemdUnitDirs {
+		if dst == dir || strings.HasPrefix(dst, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// withInstallPrefix returns the given destination below the prefix, keeping
+// the trailing slash that marks destination directories.
+func withInstallPrefix(prefix, dst string) string {
+	prefixed := path.Join(prefix, dst)
+	if strings.HasSuffix(dst, "/") {
+		prefixed += "/"
+	}
+	return prefixed
+}
+
+// applyPreserveMTimes sets PreserveMTime on the file info of all contents if
+// PreserveMTimes is set. The contents are expected to be copies owned by info.
+func applyPreserveMTimes(info *Info) {
+	if !info.PreserveMTimes {
+		return
+	}
+	for _, content := range info.Contents {
+		if content.FileInfo == nil {
+			content.FileInfo = &files.ContentFileInfo{}
+		}
+		content.FileInfo.PreserveMTime = true
+	}
+}
+
+// applyReproducible pins what Info.Reproducible does, unless it is not set:
+//
+//   - the mtime of the info, i.e. the build date of the packages and the
+//     dates of their tar, cpio, ar and gzip headers, defaults to
+//     SOURCE_DATE_EPOCH, or to the Unix epoch if it is not set either, instead
+//     of the time of the build;
+//   - the modification times of all the contents but the raw ones, including
+//     the directories of trees and the files with file_info.mtime or
+//     preserve_mtime, are the mtime of the info, once the contents are
+//     prepared;
+//   - the contents are sorted by destination, whatever the content order.
+//
+// The owners and groups are resolved by the passwd and group files, if any,
+// and are otherwise recorded with the ids 0, never with the ids of the build
+// host, and the apk datahash is a digest of the data, so they need no pinning.
+func applyReproducible(info *Info) {
+	if !info.Reproducible {
+		return
+	}
+	if info.MTime.IsZero() {
+		info.MTime = modtime.FromEnv()
+	}
+	if info.MTime.IsZero() {
+		info.MTime = time.Unix(0, 0).UTC()
+	}
+	info.ContentOrder = ContentOrderSorted
+	info.PreserveMTimes = false
+	for _, content := range info.Contents {
+		if content.FileInfo != nil {
+			content.FileInfo.PreserveMTime = false
+		}
+	}
+}
+
+// DefAttr is the default file info of the contents.
+type DefAttr struct {
+	// FileMode is the mode of files, used instead of the mode of their
+	// source.
+	FileMode fs.FileMode `yaml:"file_mode,omitempty" json:"file_mode,omitempty" jsonschema:"title=default mode of files"`
+	// DirMode is the mode of directories, used instead of 0755 or, for the
+	// directories of trees, the mode of their source.
+	DirMode fs.FileMode `yaml:"dir_mode,omitempty" json:"dir_mode,omitempty" jsonschema:"title=default mode of directories"`
+	Owner   string      `yaml:"owner,omitempty" json:"owner,omitempty" jsonschema:"title=default owner"`
+	Group   string      `yaml:"group,omitempty" json:"group,omitempty" jsonschema:"title=default group"`
+}
+
+// applyDefAttr sets the defattr of the info as the default file info of all
+// contents, including the ones expanded from trees, globs and manifests.
+// The owner, group and mode set by a content take precedence, and so does
+// the mode of a tree over the modes of its files and directories. Implicit
+// directories are left as is, see DirectoryModes, and so are the raw
+// contents.
+func applyDefAttr(info *Info) {
+	defattr := info.DefAttr
+	if defattr.DirMode == 0 {
+		defattr.DirMode = info.DefaultDirMode
+	}
+	if defattr == (DefAttr{}) {
+		return
+	}
+	for _, content := range info.Contents {
+		if content.Raw {
+			continue
+		}
+		if content.FileInfo == nil {
+			content.FileInfo = &files.ContentFileInfo{}
+		}
+		if content.FileInfo.Owner == "" {
+			content.FileInfo.Owner = defattr.Owner
+		}
+		if content.FileInfo.Group == "" {
+			content.FileInfo.Group = defattr.Group
+		}
+		content.FileInfo.DefaultMode = defattr.FileMode
+		content.FileInfo.DefaultDirMode = defattr.DirMode
+	}
+}
+
+func validateFileInfoRefs(info *Info) error {
+	for _, content := range info.Contents {
+		if _, ok := info.FileInfoTemplates[content.FileInfoRef]; content.FileInfoRef != "" && !ok {
+			return NewValidationError("unknown_file_info_template", "contents", "%s: unknown file info template %q", content, content.FileInfoRef)
+		}
+	}
+	return nil
+}
+
+// applyFileInfoRefs replaces the file info of the contents that reference a
+// file info template with the template, over which the fields the content
+// sets are merged: its owner, group, mode and mtime replace the ones of the
+// template, so do its attrs and dir modes if it has any, its overrides are
+// added to the ones of the template and its preserve flags are or-ed with
+// them.
+func applyFileInfoRefs(info *Info) error {
+	for _, content := range info.Contents {
+		if content.FileInfoRef == "" {
+			continue
+		}
+		tpl, ok := info.FileInfoTemplates[content.FileInfoRef]
+		if !ok {
+			return NewValidationError("unknown_file_info_template", "contents", "%s: unknown file info template %q", content, content.FileInfoRef)
+		}
+		merged := tpl
+		merged.Attrs = slices.Clone(tpl.Attrs)
+		merged.DirModes = maps.Clone(tpl.DirModes)
+		merged.Overrides = maps.Clone(tpl.Overrides)
+		if fi := content.FileInfo; fi != nil {
+			if fi.Owner != "" {
+				merged.Owner = fi.Owner
+			}
+			if fi.Group != "" {
+				merged.Group = fi.Group
+			}
+			if fi.Mode != 0 {
+				merged.Mode = fi.Mode
+			}
+			if !fi.MTime.IsZero() {
+				merged.MTime = fi.MTime
+			}
+			if len(fi.Attrs) > 0 {
+				merged.Attrs = fi.Attrs
+			}
+			if len(fi.DirModes) > 0 {
+				merged.DirModes = fi.DirModes
+			}
+			for packager, override := range fi.Overrides {
+				if merged.Overrides == nil {
+					merged.Overrides = map[string]*files.ContentFileInfo{}
+				}
+				merged.Overrides[packager] = override
+			}
+			merged.PreserveMTime = merged.PreserveMTime || fi.PreserveMTime
+			merged.PreserveDirModes = merged.PreserveDirModes || fi.PreserveDirModes
+		}
+		content.FileInfo = &merged
+	}
+	return nil
+}
+
+// PathDefault is the default file info of the contents whose destination is
+// Prefix or below it. Its fields are the same as the ones of DefAttr.
+type PathDefault struct {
+	Prefix   string      `yaml:"prefix" json:"prefix" jsonschema:"title=destination prefix the defaults apply to,example=/etc"`
+	FileMode fs.FileMode `yaml:"file_mode,omitempty" json:"file_mode,omitempty" jsonschema:"title=default mode of files"`
+	DirMode  fs.FileMode `yaml:"dir_mode,omitempty" json:"dir_mode,omitempty" jsonschema:"title=default mode of directories"`
+	Owner    string      `yaml:"owner,omitempty" json:"owner,omitempty" jsonschema:"title=default owner"`
+	Group    string      `yaml:"group,omitempty" json:"group,omitempty" jsonschema:"title=default group"`
+}
+
+func (d PathDefault) matches(dst string) bool {
+	prefix := strings.TrimSuffix(d.Prefix, "/")
+	dst = strings.TrimSuffix(dst, "/")
+	return dst == prefix || strings.HasPrefix(dst, prefix+"/")
+}
+
+func validatePathDefaults(defaults []PathDefault) error {
+	seen := map[string]bool{}
+	for _, d := range defaults {
+		if !path.IsAbs(d.Prefix) {
+			return NewValidationError("invalid_path_default", "path_defaults", "invalid path default for %q: prefix must be absolute", d.Prefix)
+		}
+		if d == (PathDefault{Prefix: d.Prefix}) {
+			return NewValidationError("invalid_path_default", "path_defaults", "invalid path default for %q: file_mode, dir_mode, owner or group must be set", d.Prefix)
+		}
+		prefix := path.Clean(d.Prefix)
+		if seen[prefix] {
+			return NewValidationError("invalid_path_default", "path_defaults", "invalid path default for %q: prefix is already used by another path default", d.Prefix)
+		}
+		seen[prefix] = true
+	}
+	return nil
+}
+
+// markPathDefaults records which of their owner, group and mode the contents
+// leave unset, before the defattr and the other defaults are applied, for
+// applyPathDefaults to set them once the contents are expanded. The raw
+// contents are left out, so that none are set.
+func markPathDefaults(info *Info) {
+	if len(info.PathDefaults) == 0 {
+		return
+	}
+	for _, content := range info.Contents {
+		if content.Raw {
+			continue
+		}
+		if content.FileInfo == nil {
+			content.FileInfo = &files.ContentFileInfo{}
+		}
+		content.FileInfo.Unset = files.UnsetFileInfo{
+			Owner: content.FileInfo.Owner == "",
+			Group: content.FileInfo.Group == "",
+			Mode:  content.FileInfo.Mode == 0,
+		}
+	}
+}
+
+// applyPathDefaults sets the owner, group and mode the prepared contents left
+// unset, see markPathDefaults, to the ones of the path default with the
+// longest prefix their destination is, or is below of. They take precedence
+// over the defattr and the modes of the sources, but not over the file info
+// set by the contents, or by the trees, globs and manifests they were
+// expanded from. Implicit directories are left as is, see DirectoryModes, and
+// so are the modes of symlinks.
+func applyPathDefaults(contents files.Contents, defaults []PathDefault) {
+	if len(defaults) == 0 {
+		return
+	}
+	for _, content := range contents {
+		if content.Type == files.TypeImplicitDir || content.FileInfo == nil {
+			continue
+		}
+		var match *PathDefault
+		for i, d := range defaults {
+			if d.matches(content.Destination) && (match == nil || len(path.Clean(d.Prefix)) > len(path.Clean(match.Prefix))) {
+				match = &defaults[i]
+			}
+		}
+		if match == nil {
+			continue
+		}
+		unset := content.FileInfo.Unset
+		if unset.Owner && match.Owner != "" {
+			content.FileInfo.Owner = match.Owner
+		}
+		if unset.Group && match.Group != "" {
+			content.FileInfo.Group = match.Group
+		}
+		if !unset.Mode {
+			continue
+		}
+		mode := match.FileMode
+		switch content.Type {
+		case files.TypeSymlink:
+			continue
+		case files.TypeDir:
+			mode = match.DirMode
+		}
+		if mode != 0 {
+			content.FileInfo.Mode = content.FileInfo.Mode&^(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) | mode
+		}
+	}
+}
+
+// applyOnEmptyGlob sets the OnEmptyGlob of the info on the contents that do
+// not set one.
+func applyOnEmptyGlob(info *Info) {
+	if info.OnEmptyGlob == "" {
+		return
+	}
+	for _, content := range info.Contents {
+		if content.OnEmptyGlob == "" {
+			content.OnEmptyGlob = info.OnEmptyGlob
+		}
+	}
+}
+
+// applyOwnerIDs resolves the owners and groups of the contents to the ids
+// recorded in the tar headers with the PasswdFile and GroupFile of the info,
+// if set, see files.ResolveOwners.
+func applyOwnerIDs(info *Info) error {
+	if info.PasswdFile == "" && info.GroupFile == "" {
+		return nil
+	}
+	var users, groups map[string]int
+	var err error
+	if info.PasswdFile != "" {
+		if users, err = files.ReadIDs(info.PasswdFile); err != nil {
+			return fmt.Errorf("reading passwd file: %w", err)
+		}
+	}
+	if info.GroupFile != "" {
+		if groups, err = files.ReadIDs(info.GroupFile); err != nil {
+			return fmt.Errorf("reading group file: %w", err)
+		}
+	}
+	return files.ResolveOwners(info.Contents, users, groups)
+}
+
+// applyInstallPrefix relocates the contents, except for systemd units, the
+// implicit directory modes, the path defaults, the mode policies and the
+// paths of the alternatives below the install prefix, before the contents are
+// prepared, and clears it so that it is only applied once. The absolute
+// symlink targets are relocated by applyInstallPrefixToSymlinks once the
+// contents are prepared.
+func applyInstallPrefix(info *Info) (prefix string) {
+	prefix = info.InstallPrefix
+	if prefix == "" {
+		return ""
+	}
+
+	info.Contents = copyContents(info.Contents, "")
+	for _, content := range info.Contents {
+		if !inSystemdUnitDir(content.Destination) {
+			content.Destination = withInstallPrefix(prefix, content.Destination)
+		}
+	}
+
+	modes := make(map[string]files.ContentFileInfo, len(info.DirectoryModes))
+	for dir, fi := range info.DirectoryModes {
+		modes[withInstallPrefix(prefix, dir)] = fi
+	}
+	if len(modes) > 0 {
+		info.DirectoryModes = modes
+	}
+
+	alternatives := make([]Alternative, 0, len(info.Alternatives))
+	for _, alt := range info.Alternatives {
+		alt.Path = withInstallPrefix(prefix, alt.Path)
+		slaves := make([]AlternativeSlave, 0, len(alt.Slaves))
+		for _, slave := range alt.Slaves {
+			slave.Path = withInstallPrefix(prefix, slave.Path)
+			slaves = append(slaves, slave)
+		}
+		alt.Slaves = slaves
+		alternatives = append(alternatives, alt)
+	}
+	if len(alternatives) > 0 {
+		info.Alternatives = alternatives
+	}
+
+	if len(info.PathDefaults) > 0 {
+		defaults := make([]PathDefault, 0, len(info.PathDefaults))
+		for _, d := range info.PathDefaults {
+			d.Prefix = withInstallPrefix(prefix, d.Prefix)
+			defaults = append(defaults, d)
+		}
+		info.PathDefaults = defaults
+	}
+
+	if len(info.ModePolicies) > 0 {
+		policies := make([]ModePolicy, 0, len(info.ModePolicies))
+		for _, policy := range info.ModePolicies {
+			policy.Path = withInstallPrefix(prefix, policy.Path)
+			policies = append(policies, policy)
+		}
+		info.ModePolicies = policies
+	}
+
+	if len(info.RPM.ConfigMigrations) > 0 {
+		migrations := make([]RPMConfigMigration, 0, len(info.RPM.ConfigMigrations))
+		for _, migration := range info.RPM.ConfigMigrations {
+			migration.Path = withInstallPrefix(prefix, migration.Path)
+			migrations = append(migrations, migration)
+		}
+		info.RPM.ConfigMigrations = migrations
+	}
+
+	if len(info.WorldWritableAllowlist) > 0 {
+		allowlist := make([]string, 0, len(info.WorldWritableAllowlist))
+		for _, pattern := range info.WorldWritableAllowlist {
+			allowlist = append(allowlist, withInstallPrefix(prefix, pattern))
+		}
+		info.WorldWritableAllowlist = allowlist
+	}
+
+	info.InstallPrefix = ""
+	return prefix
+}
+
+// applyInstallPrefixToSymlinks relocates the absolute targets of the symlinks
+// that point to contents of the package.
+func applyInstallPrefixToSymlinks(contents files.Contents, prefix string) {
+	if prefix == "" {
+		return
+	}
+	for _, content := range contents {
+		if content.Type != files.TypeSymlink || !strings.HasPrefix(content.Source, "/") {
+			continue
+		}
+		if target := withInstallPrefix(prefix, content.Source); contents.ContainsDestination(target) {
+			content.Source = target
+		}
+	}
+}
+
+// nolint: gochecknoglobals
+var snapshotCommitRegexp = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+
+func validateSnapshot(snapshot *Snapshot) error {
+	if snapshot != nil && !snapshotCommitRegexp.MatchString(snapshot.Commit) {
+		return NewValidationError("invalid_snapshot", "snapshot.commit", "invalid snapshot commit: %q: may only contain letters and digits", snapshot.Commit)
+	}
+	return nil
+}
+
+// conditionVars returns the variables the content conditions are evaluated
+// with.
+func conditionVars(info *Info, packager string) map[string]string {
+	return map[string]string{
+		"Arch":    info.Arch,
+		"Format":  packager,
+		"Version": info.Version,
+	}
+}
+
+// applyConditions removes the contents whose condition is false for the given
+// packager, and clears the conditions of the remaining ones so that they are
+// only evaluated once. The contents are expected to be copies owned by info.
+func applyConditions(info *Info, packager string, env func(string) string) error {
+	vars := conditionVars(info, packager)
+	contents := info.Contents[:0]
+	for _, content := range info.Contents {
+		if content.When == "" {
+			contents = append(contents, content)
+			continue
+		}
+		ok, err := expr.Eval(content.When, vars, env)
+		if err != nil {
+			return NewValidationError("invalid_contents", "contents", "%s: invalid condition %q: %w", content, content.When, err)
+		}
+		if ok {
+			content.When = ""
+			contents = append(contents, content)
+		}
+	}
+	info.Contents = contents
+	return nil
+}
+
+// appendConventionalContents appends the contents installing the completions,
+// man pages and systemd units of the info at their conventional paths for
+// the given packager, and clears them so that they are only appended once.
+func appendConventionalContents(info *Info, packager string) error {
+	zshDir := "/usr/share/zsh/site-functions"
+	if packager == "deb" {
+		zshDir = "/usr/share/zsh/vendor-completions"
+	}
+	var dsts []string
+	for _, src := range info.Completions.Bash {
+		dsts = append(dsts, path.Join("/usr/share/bash-completion/completions", strings.TrimSuffix(filepath.Base(src), ".bash")))
+	}
+	for _, src := range info.Completions.Zsh {
+		name := strings.TrimSuffix(filepath.Base(src), ".zsh")
+		if !strings.HasPrefix(name, "_") {
+			name = "_" + name
+		}
+		dsts = append(dsts, path.Join(zshDir, name))
+	}
+	for _, src := range info.Completions.Fish {
+		dsts = append(dsts, path.Join("/usr/share/fish/vendor_completions.d", strings.TrimSuffix(filepath.Base(src), ".fish")+".fish"))
+	}
+	for _, src := range info.ManPages {
+		name := filepath.Base(src)
+		section := strings.TrimPrefix(path.Ext(strings.TrimSuffix(name, ".gz")), ".")
+		if section == "" || section[0] < '1' || section[0] > '9' {
+			return fmt.Errorf("man page %s: the extension must be its section, e.g. %s.1", src, name)
+		}
+		dsts = append(dsts, path.Join("/usr/share/man", "man"+section[:1], name))
+	}
+	for _, src := range info.SystemdUnits {
+		name := filepath.Base(src)
+		if !slices.Contains(systemdUnitTypes, path.Ext(name)) {
+			return fmt.Errorf("systemd unit %s: unknown unit type %q, must be one of %s",
+				src, path.Ext(name), strings.Join(systemdUnitTypes, ", "))
+		}
+		dsts = append(dsts, path.Join("/usr/lib/systemd/system", name))
+	}
+
+	srcs := slices.Concat(info.Completions.Bash, info.Completions.Zsh, info.Completions.Fish, info.ManPages, info.SystemdUnits)
+	for i, src := range srcs {
+		info.Contents = append(info.Contents, &files.Content{
+			Source:      src,
+			Destination: dsts[i],
+			Type:        files.TypeFile,
+			FileInfo:    &files.ContentFileInfo{Mode: 0o644},
+		})
+	}
+	info.Completions = Completions{}
+	info.ManPages = nil
+	info.SystemdUnits = nil
+	return nil
+}
+
+// WithSnapshot returns a copy of the info with the version of its snapshot
+// for the given packager, or the info itself if it has no snapshot. The
+// packagers use it to name the packages of an info that was not prepared
+// yet with the version they are built with.
+func WithSnapshot(info *Info, packager string) *Info {
+	if info.Snapshot == nil {
+		return info
+	}
+	cp := *info
+	applySnapshot(&cp, packager)
+	return &cp
+}
+
+// applySnapshot rewrites the version of the info for the given packager, and
+// clears the snapshot so that it is only applied once.
+func applySnapshot(info *Info, packager string) {
+	if info.Snapshot == nil {
+		return
+	}
+	date := modtime.Get(info.MTime, modtime.FromEnv()).UTC().Format("20060102")
+	prerelease := "snapshot." + date
+	if info.Snapshot.Commit != "" {
+		prerelease += "." + info.Snapshot.Commit
+	}
+
+	switch packager {
+	case "rpm":
+		info.Prerelease = ""
+		info.Release = "0." + prerelease
+	case "archlinux":
+		info.Prerelease = ""
+		info.Release = "0." + strings.TrimPrefix(prerelease, "snapshot.")
+	case "apk":
+		info.Prerelease = "pre" + date
+		info.Release = "0"
+	default:
+		info.Prerelease = prerelease
+	}
+	info.Snapshot = nil
+}
+
+// Category is the deb section and rpm group a generic Info.Category stands
+// for.
+type Category struct {
+	Section string `yaml:"section,omitempty" json:"section,omitempty" jsonschema:"title=deb section,example=utils"`
+	Group   string `yaml:"group,omitempty" json:"group,omitempty" jsonschema:"title=rpm group,example=Applications/System"`
+}
+
+// DefaultCategories maps the generic categories to the deb sections and the
+// (legacy, but still used by some distributions) rpm groups.
+// nolint: gochecknoglobals
+var DefaultCategories = map[string]Category{
+	"admin":    {Section: "admin", Group: "Applications/System"},
+	"database": {Section: "database", Group: "Applications/Databases"},
+	"devel":    {Section: "devel", Group: "Development/Tools"},
+	"doc":      {Section: "doc", Group: "Documentation"},
+	"editors":  {Section: "editors", Group: "Applications/Editors"},
+	"fonts":    {Section: "fonts", Group: "User Interface/X"},
+	"games":    {Section: "games", Group: "Amusements/Games"},
+	"graphics": {Section: "graphics", Group: "Applications/Multimedia"},
+	"kernel":   {Section: "kernel", Group: "System Environment/Kernel"},
+	"libs":     {Section: "libs", Group: "System Environment/Libraries"},
+	"mail":     {Section: "mail", Group: "Applications/Internet"},
+	"net":      {Section: "net", Group: "Applications/Internet"},
+	"science":  {Section: "science", Group: "Applications/Engineering"},
+	"shells":   {Section: "shells", Group: "System Environment/Shells"},
+	"sound":    {Section: "sound", Group: "Applications/Multimedia"},
+	"text":     {Section: "text", Group: "Applications/Text"},
+	"utils":    {Section: "utils", Group: "Applications/System"},
+	"video":    {Section: "video", Group: "Applications/Multimedia"},
+	"web":      {Section: "web", Group: "Applications/Internet"},
+	"x11":      {Section: "x11", Group: "User Interface/X"},
+}
+
+// ResolveCategory returns the deb section and rpm group of the category of
+// the info, looked up in its Categories first and in DefaultCategories
+// otherwise. ok is false if the info has no category or it is not known.
+func (i *Info) ResolveCategory() (category Category, ok bool) {
+	if i.Category == "" {
+		return Category{}, false
+	}
+	if category, ok := i.Categories[i.Category]; ok {
+		return category, true
+	}
+	category, ok = DefaultCategories[i.Category]
+	return category, ok
+}
+
+const (
+	// ContentOrderSorted sorts the contents of the package by destination.
+	ContentOrderSorted = "sorted"
+	// ContentOrderConfig keeps the contents of the package in the order in
+	// which they are declared in the configuration.
+	ContentOrderConfig = "config"
+)
+
+// The values of Info.NonRootOwnership.
+const (
+	// NonRootOwnershipIgnore does not check the owners of the contents, the
+	// default.
+	NonRootOwnershipIgnore = "ignore"
+	// NonRootOwnershipWarn warns about the contents of system directories
+	// not owned by root.
+	NonRootOwnershipWarn = "warn"
+	// NonRootOwnershipError fails on the contents of system directories not
+	// owned by root.
+	NonRootOwnershipError = "error"
+)
+
+func (i *Info) Validate() error {
+	return Validate(i)
+}
+
+// DefaultScriptShell is the shell of the generated scripts if the info does
+// not set ScriptShell.
+const DefaultScriptShell = "/bin/sh"
+
+// ScriptInterpreter returns the shell of the generated scripts: ScriptShell,
+// or DefaultScriptShell if it is empty.
+func (i *Info) ScriptInterpreter() string {
+	if i.ScriptShell == "" {
+		return DefaultScriptShell
+	}
+	return i.ScriptShell
+}
+
+// Copy returns a deep copy of the info, whose contents, dependencies and
+// other fields can be changed without affecting the info. Functions, such as
+// the SignFn of the signatures, and the file systems of the contents are
+// shared. The packagers work on a copy, so the info they are given can be
+// reused, also concurrently.
+func (i *Info) Copy() *Info {
+	return deepcopy.Copy(i)
+}
+
+// GetChangeLog parses the provided changelog file.
+func (i *Info) GetChangeLog() (log *chglog.PackageChangeLog, err error) {
+	// if the file does not exist chglog.Parse will just silently
+	// create an empty changelog but we should notify the user instead
+	if _, err = os.Stat(i.Changelog); errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	entries, err := chglog.Parse(i.Changelog)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chglog.PackageChangeLog{
+		Name:    i.Name,
+		Entries: entries,
+	}, nil
+}
+
+// GetSortedChangeLog parses the provided changelog file and sorts its entries
+// from the latest version to the oldest one, as compared by compare, the
+// version comparison of the packager. Entries of the same version are sorted
+// from the latest date to the oldest one. Entries without a version are given
+// version, the full version of the package as formatted by the packager.
+func (i *Info) GetSortedChangeLog(version string, compare func(a, b string) int) (*chglog.PackageChangeLog, error) {
+	changelog, err := i.GetChangeLog()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range changelog.Entries {
+		if entry.Semver == "" {
+			entry.Semver = version
+		}
+		if entry.Date.IsZero() {
+			return nil, NewValidationError("invalid_changelog", "changelog", "invalid changelog entry %q: no date", entry.Semver)
+		}
+	}
+	slices.SortStableFunc(changelog.Entries, func(a, b *chglog.ChangeLog) int {
+		if c := compare(b.Semver, a.Semver); c != 0 {
+			return c
+		}
+		return b.Date.Compare(a.Date)
+	})
+	return changelog, nil
+}
+
+func (i *Info) parseSemver() {
+	// parse the version as a semver so we can properly split the parts
+	// and support proper ordering for both rpm and deb
+	if v, err := semver.NewVersion(i.Version); err == nil {
+		i.Version = fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch())
+		if i.Prerelease == "" {
+			i.Prerelease = v.Prerelease()
+		}
+
+		if i.VersionMetadata == "" {
+			i.VersionMetadata = v.Metadata()
+		}
+	}
+}
+
+// Overridables contain the field which are overridable in a package.
+type Overridables struct {
+	Replaces   []string       `yaml:"replaces,omitempty" json:"replaces,omitempty" jsonschema:"title=replaces directive,example=nfpm"`
+	Provides   []string       `yaml:"provides,omitempty" json:"provides,omitempty" jsonschema:"title=provides directive,example=nfpm"`
+	Depends    []string       `yaml:"depends,omitempty" json:"depends,omitempty" jsonschema:"title=depends directive,example=nfpm"`
+	Recommends []string       `yaml:"recommends,omitempty" json:"recommends,omitempty" jsonschema:"title=recommends directive,example=nfpm"`
+	Suggests   []string       `yaml:"suggests,omitempty" json:"suggests,omitempty" jsonschema:"title=suggests directive,example=nfpm"`
+	Conflicts  []string       `yaml:"conflicts,omitempty" json:"conflicts,omitempty" jsonschema:"title=conflicts directive,example=nfpm"`
+	Contents   files.Contents `yaml:"contents,omitempty" json:"contents,omitempty" jsonschema:"title=files to add to the package"`
+	Umask      os.FileMode    `yaml:"umask,omitempty" json:"umask,omitempty" jsonschema:"title=umask for file contents,example=112"`
+	Scripts    Scripts        `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=scripts to execute"`
+	RPM        RPM            `yaml:"rpm,omitempty" json:"rpm,omitempty" jsonschema:"title=rpm-specific settings"`
+	Deb        Deb            `yaml:"deb,omitempty" json:"deb,omitempty" jsonschema:"title=deb-specific settings"`
+	APK        APK            `yaml:"apk,omitempty" json:"apk,omitempty" jsonschema:"title=apk-specific settings"`
+	ArchLinux  ArchLinux      `yaml:"archlinux,omitempty" json:"archlinux,omitempty" jsonschema:"title=archlinux-specific settings"`
+	// Alternatives are registered with update-alternatives(1) by the deb and
+	// rpm scriptlets once the package is installed, and removed with it.
+	Alternatives []Alternative `yaml:"alternatives,omitempty" json:"alternatives,omitempty" jsonschema:"title=alternatives to register"`
+	// Completions are the shell completion files installed at the
+	// conventional paths of each shell, see Completions.
+	Completions Completions `yaml:"completions,omitempty" json:"completions,omitempty" jsonschema:"title=shell completions to install"`
+	// ManPages are the man pages installed in the directory of their
+	// section, taken from their extension, e.g. foo.1 or foo.1.gz in
+	// /usr/share/man/man1.
+	ManPages []string `yaml:"man_pages,omitempty" json:"man_pages,omitempty" jsonschema:"title=man pages to install,example=./man/foo.1"`
+	// SystemdUnits are the systemd units installed in /usr/lib/systemd/system.
+	SystemdUnits []string `yaml:"systemd_units,omitempty" json:"systemd_units,omitempty" jsonschema:"title=systemd units to install,example=./foo.service"`
+}
+
+// Completions are the sources of the shell completion files of a package,
+// installed with mode 0644 as:
+//   - /usr/share/bash-completion/completions/<name> for bash, a .bash
+//     extension being removed;
+//   - _<name> in /usr/share/zsh/vendor-completions on deb and
+//     /usr/share/zsh/site-functions otherwise for zsh, a .zsh extension
+//     being removed;
+//   - /usr/share/fish/vendor_completions.d/<name>.fish for fish.
+type Completions struct {
+	Bash []string `yaml:"bash,omitempty" json:"bash,omitempty" jsonschema:"title=bash completions,example=./completions/foo.bash"`
+	Zsh  []string `yaml:"zsh,omitempty" json:"zsh,omitempty" jsonschema:"title=zsh completions,example=./completions/_foo"`
+	Fish []string `yaml:"fish,omitempty" json:"fish,omitempty" jsonschema:"title=fish completions,example=./completions/foo.fish"`
+}
+
+// Alternative is a generic link that update-alternatives points to one of
+// the packages providing it, the one with the highest priority by default.
+type Alternative struct {
+	Name     string             `yaml:"name" json:"name" jsonschema:"title=name of the alternative group,example=editor"`
+	Link     string             `yaml:"link" json:"link" jsonschema:"title=generic link,example=/usr/bin/editor"`
+	Path     string             `yaml:"path" json:"path" jsonschema:"title=packaged file the link points to,example=/usr/bin/foo"`
+	Priority int                `yaml:"priority,omitempty" json:"priority,omitempty" jsonschema:"title=priority,default=0"`
+	Slaves   []AlternativeSlave `yaml:"slaves,omitempty" json:"slaves,omitempty" jsonschema:"title=links that follow the alternative"`
+}
+
+// AlternativeSlave is a link updated together with its Alternative, such as
+// the man page of the selected editor.
+type AlternativeSlave struct {
+	Name string `yaml:"name" json:"name" jsonschema:"title=name of the slave,example=editor.1.gz"`
+	Link string `yaml:"link" json:"link" jsonschema:"title=generic link,example=/usr/share/man/man1/editor.1.gz"`
+	Path string `yaml:"path" json:"path" jsonschema:"title=packaged file the link points to,example=/usr/share/man/man1/foo.1.gz"`
+}
+
+// InstallCommand returns the update-alternatives call that registers the
+// alternative and its slaves.
+func (a Alternative) InstallCommand() string {
+	cmd := fmt.Sprintf("update-alternatives --install %s %s %s %d", a.Link, a.Name, a.Path, a.Priority)
+	for _, slave := range a.Slaves {
+		cmd += fmt.Sprintf(" --slave %s %s %s", slave.Link, slave.Name, slave.Path)
+	}
+	return cmd + "\n"
+}
+
+// RemoveCommand returns the update-alternatives call that removes the
+// alternative and its slaves.
+func (a Alternative) RemoveCommand() string {
+	return fmt.Sprintf("update-alternatives --remove %s %s\n", a.Name, a.Path)
+}
+
+type ArchLinux struct {
+	Pkgbase  string           `yaml:"pkgbase,omitempty" json:"pkgbase,omitempty" jsonschema:"title=explicitly specify the name used to refer to a split package, defaults to name"`
+	Arch     string           `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in archlinux nomenclature"`
+	Packager string           `yaml:"packager,omitempty" json:"packager,omitempty" jsonschema:"title=organization that packaged the software"`
+	Scripts  ArchLinuxScripts `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=archlinux-specific scripts"`
+	// Compression is the compression of the package, which is also
+	// reflected by its extension.
+	Compression string `yaml:"compression,omitempty" json:"compression,omitempty" jsonschema:"title=compression algorithm to be used,enum=zst,enum=xz,enum=gz,enum=none,default=zst"`
+}
+
+type ArchLinuxScripts struct {
+	PreUpgrade  string `yaml:"preupgrade,omitempty" json:"preupgrade,omitempty" jsonschema:"title=preupgrade script"`
+	PostUpgrade string `yaml:"postupgrade,omitempty" json:"postupgrade,omitempty" jsonschema:"title=postupgrade script"`
+}
+
+// RPM is custom configs that are only available on RPM packages.
+type RPM struct {
+	Arch string `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in rpm nomenclature"`
+	// PackageName, if set, is the name of the rpm package, and of its file,
+	// instead of the name of the info, e.g. to follow the naming conventions
+	// of the distributions.
+	PackageName string       `yaml:"package_name,omitempty" json:"package_name,omitempty" jsonschema:"title=name of the rpm package,default=name"`
+	Scripts     RPMScripts   `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=rpm-specific scripts"`
+	Group       string       `yaml:"group,omitempty" json:"group,omitempty" jsonschema:"title=package group,example=Unspecified"`
+	Summary     string       `yaml:"summary,omitempty" json:"summary,omitempty" jsonschema:"title=package summary"`
+	Compression string       `yaml:"compression,omitempty" json:"compression,omitempty" jsonschema:"title=compression algorithm to be used,enum=gzip,enum=lzma,enum=xz,default=gzip:-1"`
+	Signature   RPMSignature `yaml:"signature,omitempty" json:"signature,omitempty" jsonschema:"title=rpm signature"`
+	Packager    string       `yaml:"packager,omitempty" json:"packager,omitempty" jsonschema:"title=organization that actually packaged the software"`
+	Prefixes    []string     `yaml:"prefixes,omitempty" json:"prefixes,omitempty" jsonschema:"title=Prefixes for relocatable packages"`
+	// Distribution is the distribution, or product, the package is part of,
+	// e.g. `Fedora Project`, recorded in the Distribution tag.
+	Distribution string `yaml:"distribution,omitempty" json:"distribution,omitempty" jsonschema:"title=distribution the package is part of,example=Fedora Project"`
+	// SourceRPM is the file name of the source rpm the package is recorded
+	// to be built from, in the SourceRPM tag. It defaults to the conventional
+	// `<name>-<version>-<release>.src.rpm`, and must end in `.src.rpm` or
+	// `.nosrc.rpm`, as rpm considers rpms without one to be source rpms.
+	SourceRPM string `yaml:"source_rpm,omitempty" json:"source_rpm,omitempty" jsonschema:"title=file name of the source rpm,example=foo-1.0.0-1.src.rpm"`
+	// Obsoletes are added to the Obsoletes tag together with Replaces, and
+	// may be versioned or architecture qualified, e.g. `foo(x86-64) < 1.2`.
+	Obsoletes []string `yaml:"obsoletes,omitempty" json:"obsoletes,omitempty" jsonschema:"title=obsoletes directive,example=nfpm"`
+	// ServiceScriptlets generates the scriptlets that enable, disable and
+	// restart systemd units, appended to the install and remove scripts.
+	ServiceScriptlets RPMServiceScriptlets `yaml:"service_scriptlets,omitempty" json:"service_scriptlets,omitempty" jsonschema:"title=systemd service scriptlets"`
+	// BuildHost is recorded as the host the package was built on. It defaults
+	// to localhost rather than the actual host name, so that packages are
+	// reproducible.
+	BuildHost string `yaml:"build_host,omitempty" json:"build_host,omitempty" jsonschema:"title=build host,default=localhost"`
+	// ScriptFlags are recorded in the scriptlet flags tags of the header,
+	// which tell rpm how to handle the scriptlets, see RPMScriptFlags.
+	ScriptFlags RPMScriptFlags `yaml:"script_flags,omitempty" json:"script_flags,omitempty" jsonschema:"title=scriptlet flags"`
+	// ConfigMigrations generate the %posttrans snippets that handle the
+	// .rpmnew files rpm leaves next to the modified config files of the
+	// package on upgrades, see RPMConfigMigration.
+	ConfigMigrations []RPMConfigMigration `yaml:"config_migrations,omitempty" json:"config_migrations,omitempty" jsonschema:"title=migrations of the config files"`
+	// FailOnScriptError makes each scriptlet exit on the first command that
+	// fails, with `set -e`, so that a failure in the middle of a script is
+	// not masked by the commands that follow it.
+	FailOnScriptError bool `yaml:"fail_on_script_error,omitempty" json:"fail_on_script_error,omitempty" jsonschema:"title=exit the scriptlets on the first failing command,default=false"`
+}
+
+// The strategies of an RPMConfigMigration.
+const (
+	// ConfigMigrationLog prints a notice that the new default of the config
+	// file awaits a merge.
+	ConfigMigrationLog = "log"
+	// ConfigMigrationReplace moves the config file to .rpmsave and installs
+	// the new default in its place.
+	ConfigMigrationReplace = "replace"
+	// ConfigMigrationScript runs the migration script.
+	ConfigMigrationScript = "script"
+)
+
+// RPMConfigMigration handles the .rpmnew file rpm writes next to a
+// `config|noreplace` file the admin modified, when the package is upgraded to
+// a version with another default of it. The snippet runs in %posttrans, once
+// the whole transaction is installed, and only if the .rpmnew file exists.
+type RPMConfigMigration struct {
+	// Path is the destination of the config|noreplace file.
+	Path string `yaml:"path" json:"path" jsonschema:"title=destination of the config file,example=/etc/foo/foo.conf"`
+	// Strategy is one of ConfigMigrationLog, the default,
+	// ConfigMigrationReplace or ConfigMigrationScript.
+	Strategy string `yaml:"strategy,omitempty" json:"strategy,omitempty" jsonschema:"title=what happens to the .rpmnew file,enum=log,enum=replace,enum=script,default=log"`
+	// Script is the path of the shell snippet the script strategy runs, in a
+	// subshell with $CONFIG set to the config file and $RPMNEW to its .rpmnew
+	// file.
+	Script string `yaml:"script,omitempty" json:"script,omitempty" jsonschema:"title=migration script"`
+}
+
+// RPMScriptFlags lists the flags of each rpm scriptlet, out of `expand`,
+// which expands the macros of the scriptlet at install time, `qformat`,
+// which expands it as a query format, and `critical`, which aborts the
+// transaction if the scriptlet fails. The flags of scriptlets the package
+// does not have are ignored.
+type RPMScriptFlags struct {
+	PreInstall  []string `yaml:"preinstall,omitempty" json:"preinstall,omitempty" jsonschema:"title=preinstall scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+	PostInstall []string `yaml:"postinstall,omitempty" json:"postinstall,omitempty" jsonschema:"title=postinstall scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+	PreRemove   []string `yaml:"preremove,omitempty" json:"preremove,omitempty" jsonschema:"title=preremove scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+	PostRemove  []string `yaml:"postremove,omitempty" json:"postremove,omitempty" jsonschema:"title=postremove scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+	PreTrans    []string `yaml:"pretrans,omitempty" json:"pretrans,omitempty" jsonschema:"title=pretrans scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+	PostTrans   []string `yaml:"posttrans,omitempty" json:"posttrans,omitempty" jsonschema:"title=posttrans scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+	Verify      []string `yaml:"verify,omitempty" json:"verify,omitempty" jsonschema:"title=verify scriptlet flags,enum=expand,enum=qformat,enum=critical"`
+}
+
+// RPMServiceScriptlets configures the systemd units handled by the generated
+// rpm scriptlets.
+type RPMServiceScriptlets struct {
+	Units            []string `yaml:"units,omitempty" json:"units,omitempty" jsonschema:"title=systemd units,example=foo.service"`
+	RestartOnUpgrade bool     `yaml:"restart_on_upgrade,omitempty" json:"restart_on_upgrade,omitempty" jsonschema:"title=restart the units on upgrade,default=false"`
+}
+
+// RPMScripts represents scripts only available on RPM packages.
+type RPMScripts struct {
+	PreTrans  string `yaml:"pretrans,omitempty" json:"pretrans,omitempty" jsonschema:"title=pretrans script"`
+	PostTrans string `yaml:"posttrans,omitempty" json:"posttrans,omitempty" jsonschema:"title=posttrans script"`
+	Verify    string `yaml:"verify,omitempty" json:"verify,omitempty" jsonschema:"title=verify script"`
+}
+
+type PackageSignature struct {
+	// PGP secret key, can be ASCII-armored
+	KeyFile       string  `yaml:"key_file,omitempty" json:"key_file,omitempty" jsonschema:"title=key file,example=key.gpg"`
+	KeyID         *string `yaml:"key_id,omitempty" json:"key_id,omitempty" jsonschema:"title=key id,example=bc8acdd415bd80b3"`
+	KeyPassphrase string  `yaml:"-" json:"-"` // populated from environment variable
+	// KeyEnv is the name of an environment variable holding the secret key,
+	// e.g. ASCII-armored, instead of KeyFile, which must then be empty. It is
+	// only read by the signers.
+	KeyEnv string `yaml:"key_env,omitempty" json:"key_env,omitempty" jsonschema:"title=environment variable holding the key,example=NFPM_SIGNING_KEY"`
+	// KeyPassphraseEnv is the name of an environment variable holding the
+	// passphrase of the key, which takes precedence over KeyPassphrase.
+	KeyPassphraseEnv string `yaml:"key_passphrase_env,omitempty" json:"key_passphrase_env,omitempty" jsonschema:"title=environment variable holding the passphrase of the key,example=NFPM_SIGNING_PASSPHRASE"`
+	// SignFn, if set, will be called with the package-specific data to sign.
+	// For deb and rpm packages, data is the full package content.
+	// For apk packages, data is the SHA1 digest of control tgz.
+	//
+	// This allows for signing implementations other than using a local file
+	// (for example using a remote signer like KMS).
+	SignFn func(data io.Reader) ([]byte, error) `yaml:"-" json:"-"` // populated when used as a library
+}
+
+// HasKey reports whether the signature has a key, either in KeyFile or in the
+// environment variable of KeyEnv.
+func (s PackageSignature) HasKey() bool {
+	return s.KeyFile != "" || s.KeyEnv != ""
+}
+
+// signatures returns the signatures of the deb, rpm and apk packages, keyed by
+// packager.
+func signatures(info *Info) map[string]*PackageSignature {
+	return map[string]*PackageSignature{
+		"deb": &info.Deb.Signature.PackageSignature,
+		"rpm": &info.RPM.Signature.PackageSignature,
+		"apk": &info.APK.Signature.PackageSignature,
+	}
+}
+
+func validateSignatureKeys(info *Info) error {
+	for _, packager := range []string{"apk", "deb", "rpm"} {
+		sig := signatures(info)[packager]
+		if sig.KeyEnv != "" && sig.KeyFile != "" {
+			return NewValidationError("invalid_signature_key", packager+".signature", "invalid %s signature key: key_file and key_env are mutually exclusive", packager)
+		}
+	}
+	return nil
+}
+
+// resolveKeyEnv checks that the environment variable of the KeyEnv of the
+// signature of the packager is set, and sets its KeyPassphrase from the
+// environment variable of its KeyPassphraseEnv. The key itself is only read
+// from the environment by the signers, so that it is not copied along with
+// the info.
+func resolveKeyEnv(info *Info, packager string) error {
+	sig, ok := signatures(info)[packager]
+	if !ok {
+		return nil
+	}
+	if sig.KeyEnv != "" {
+		if os.Getenv(sig.KeyEnv) == "" {
+			return NewValidationError("invalid_signature_key", packager+".signature.key_env", "invalid %s signature key: environment variable %s is empty", packager, sig.KeyEnv)
+		}
+	}
+	if sig.KeyPassphraseEnv != "" {
+		sig.KeyPassphrase = os.Getenv(sig.KeyPassphraseEnv)
+	}
+	return nil
+}
+
+// Download configures the download of URL sources. Failed attempts are
+// retried with an exponential backoff, unless the server responds with a
+// client error other than 429 Too Many Requests.
+type Download struct {
+	// Retries is the number of attempts made after the first one fails.
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty" jsonschema:"title=attempts after the first one fails,default=0"`
+	// Timeout limits each attempt. Zero means no limit.
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty" jsonschema:"title=limit of each attempt,example=30s"`
+	// Backoff is the wait before the first retry, doubled for each of the
+	// following ones. Defaults to one second. The Retry-After header of 429
+	// and 503 responses takes precedence.
+	Backoff time.Duration `yaml:"backoff,omitempty" json:"backoff,omitempty" jsonschema:"title=wait before the first retry,default=1s"`
+}
+
+// Keyring maps packagers to the fingerprint of the PGP secret key, inside of
+// the keyring file, that should be used to sign their packages.
+type Keyring struct {
+	// PGP keyring holding the secret keys, can be ASCII-armored
+	KeyFile string            `yaml:"key_file,omitempty" json:"key_file,omitempty" jsonschema:"title=keyring file,example=keyring.gpg"`
+	Keys    map[string]string `yaml:"keys,omitempty" json:"keys,omitempty" jsonschema:"title=fingerprint of the signing key by packager"`
+}
+
+type RPMSignature struct {
+	PackageSignature `yaml:",inline" json:",inline"`
+}
+
+type APK struct {
+	Arch string `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in apk nomenclature"`
+	// PackageName, if set, is the name of the apk package, and of its file,
+	// instead of the name of the info, e.g. to follow the naming conventions
+	// of the distributions.
+	PackageName string       `yaml:"package_name,omitempty" json:"package_name,omitempty" jsonschema:"title=name of the apk package,default=name"`
+	Signature   APKSignature `yaml:"signature,omitempty" json:"signature,omitempty" jsonschema:"title=apk signature"`
+	Scripts     APKScripts   `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=apk scripts"`
+	Triggers    APKTriggers  `yaml:"triggers,omitempty" json:"triggers,omitempty" jsonschema:"title=apk triggers"`
+	// Origin is the name of the source package the package is built from,
+	// which defaults to the package name.
+	Origin string `yaml:"origin,omitempty" json:"origin,omitempty" jsonschema:"title=origin package,default=name of the package"`
+	// Commit is the hash of the commit of the packaging repository the
+	// package is built from.
+	Commit string `yaml:"commit,omitempty" json:"commit,omitempty" jsonschema:"title=commit hash,example=8a1d4e2c0b5a3f6e9d7c1b2a4f6e8d0c2b4a6f8e"`
+	// ProviderPriority makes apk prefer the package, the highest priority
+	// winning, when several packages provide the same virtual package. Left
+	// out of the .PKGINFO when zero.
+	ProviderPriority int `yaml:"provider_priority,omitempty" json:"provider_priority,omitempty" jsonschema:"title=priority among the providers of a virtual package,minimum=0"`
+	// Provides are written to the .PKGINFO as is, after the provides of the
+	// info, in the `[namespace:]name[=version]` syntax of apk, e.g. the
+	// `so:libfoo.so.1=1.2.3` and `cmd:foo=1.2.3` provides abuild generates
+	// for the shared objects and commands of the package.
+	Provides []string `yaml:"provides,omitempty" json:"provides,omitempty" jsonschema:"title=apk provides,example=so:libfoo.so.1=1.2.3"`
+	// ReplacesPriority makes apk keep the files of the package, the highest
+	// priority winning, when several packages that replace each other ship
+	// the same file. Left out of the .PKGINFO when zero.
+	ReplacesPriority int `yaml:"replaces_priority,omitempty" json:"replaces_priority,omitempty" jsonschema:"title=priority among the packages replacing each other,minimum=0"`
+	// WeakDependencies is what happens to the Recommends and Suggests of the
+	// info, which apk has no equivalent of: one of APKWeakDependenciesWarn,
+	// the default, APKWeakDependenciesIgnore or APKWeakDependenciesInstallIf.
+	WeakDependencies string `yaml:"weak_dependencies,omitempty" json:"weak_dependencies,omitempty" jsonschema:"title=what happens to recommends and suggests,enum=warn,enum=ignore,enum=install_if,default=warn"`
+}
+
+// The values of APK.WeakDependencies.
+const (
+	// APKWeakDependenciesWarn leaves the recommends and suggests out of the
+	// package, with a warning.
+	APKWeakDependenciesWarn = "warn"
+	// APKWeakDependenciesIgnore leaves them out silently.
+	APKWeakDependenciesIgnore = "ignore"
+	// APKWeakDependenciesInstallIf writes the recommends as the install_if of
+	// the package, so that apk installs it once all of them are installed,
+	// and leaves the suggests out with a warning.
+	APKWeakDependenciesInstallIf = "install_if"
+)
+
+// APKTriggers contains the trigger script of an apk package, which runs
+// whenever the contents of the monitored paths change.
+type APKTriggers struct {
+	Paths  []string `yaml:"paths,omitempty" json:"paths,omitempty" jsonschema:"title=monitored paths,example=/usr/share/icons/*"`
+	Script string   `yaml:"script,omitempty" json:"script,omitempty" jsonschema:"title=trigger script"`
+}
+
+type APKSignature struct {
+	PackageSignature `yaml:",inline" json:",inline"`
+	// defaults to <maintainer email>.rsa.pub
+	KeyName string `yaml:"key_name,omitempty" json:"key_name,omitempty" jsonschema:"title=key name,example=origin,default=maintainer_email.rsa.pub"`
+}
+
+type APKScripts struct {
+	PreUpgrade  string `yaml:"preupgrade,omitempty" json:"preupgrade,omitempty" jsonschema:"title=pre upgrade script"`
+	PostUpgrade string `yaml:"postupgrade,omitempty" json:"postupgrade,omitempty" jsonschema:"title=post upgrade script"`
+}
+
+// Deb is custom configs that are only available on deb packages.
+type Deb struct {
+	Arch string `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in deb nomenclature"`
+	// PackageName, if set, is the name of the deb package, and of its file,
+	// instead of the name of the info, e.g. to follow the naming conventions
+	// of the distributions.
+	PackageName string            `yaml:"package_name,omitempty" json:"package_name,omitempty" jsonschema:"title=name of the deb package,default=name"`
+	Scripts     DebScripts        `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=scripts"`
+	Triggers    DebTriggers       `yaml:"triggers,omitempty" json:"triggers,omitempty" jsonschema:"title=triggers"`
+	Breaks      []string          `yaml:"breaks,omitempty" json:"breaks,omitempty" jsonschema:"title=breaks"`
+	Signature   DebSignature      `yaml:"signature,omitempty" json:"signature,omitempty" jsonschema:"title=signature"`
+	Compression string            `yaml:"compression,omitempty" json:"compression,omitempty" jsonschema:"title=compression algorithm to be used,enum=gzip,enum=xz,enum=none,default=gzip"`
+	Fields      map[string]string `yaml:"fields,omitempty" json:"fields,omitempty" jsonschema:"title=fields"`
+	Predepends  []string          `yaml:"predepends,omitempty" json:"predepends,omitempty" jsonschema:"title=predepends directive,example=nfpm"`
+	// ExtraChecksums are the algorithms, besides md5, to also record the
+	// digests of the files with, in sha256sums and sha512sums.
+	ExtraChecksums []string `yaml:"extra_checksums,omitempty" json:"extra_checksums,omitempty" jsonschema:"title=extra checksums,enum=sha256,enum=sha512"`
+	// Tags are the debtags of the package, e.g. `role::program`, written to
+	// the Tag field.
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty" jsonschema:"title=debtags,example=role::program"`
+	// DisableChangelogFile leaves the changelog.Debian.gz file, which is
+	// otherwise installed when a changelog is set, out of the package.
+	DisableChangelogFile bool `yaml:"disable_changelog_file,omitempty" json:"disable_changelog_file,omitempty" jsonschema:"title=do not install the changelog file"`
+	// DisableCopyrightFile leaves the machine-readable copyright file, which
+	// is otherwise generated when a license is set and the contents have no
+	// copyright file, out of the package.
+	DisableCopyrightFile bool `yaml:"disable_copyright_file,omitempty" json:"disable_copyright_file,omitempty" jsonschema:"title=do not generate the copyright file"`
+	// LicenseFile is the path of the text of the license, added to the
+	// generated copyright file.
+	LicenseFile string `yaml:"license_file,omitempty" json:"license_file,omitempty" jsonschema:"title=text of the license for the copyright file,example=LICENSE"`
+	// PackageType is either deb or udeb, for the micro packages of the
+	// Debian installer, which have the .udeb extension and neither
+	// md5sums, conffiles nor changelog.
+	PackageType string `yaml:"package_type,omitempty" json:"package_type,omitempty" jsonschema:"title=package type,enum=deb,enum=udeb,default=deb"`
+	// ScriptPreamble makes the shell maintainer scripts exit on errors with
+	// `set -e` and run debconf with `DEBIAN_FRONTEND=noninteractive`, unless
+	// they already do.
+	ScriptPreamble bool `yaml:"script_preamble,omitempty" json:"script_preamble,omitempty" jsonschema:"title=add set -e and DEBIAN_FRONTEND=noninteractive to the scripts,default=false"`
+	// Purge generates the purge branch of the postrm script, which removes
+	// what the package leaves behind once it is removed, see DebPurge.
+	Purge DebPurge `yaml:"purge,omitempty" json:"purge,omitempty" jsonschema:"title=purge"`
+}
+
+// DebPurge configures the branch of the postrm script that runs when the
+// package is purged, i.e. `postrm purge`, but not when it is only removed.
+type DebPurge struct {
+	// Conffiles removes the conffiles of the package, along with the
+	// .dpkg-dist, .dpkg-new and .dpkg-old copies dpkg leaves next to them.
+	Conffiles bool `yaml:"conffiles,omitempty" json:"conffiles,omitempty" jsonschema:"title=remove the conffiles,default=false"`
+	// KeepModified keeps the conffiles the admin modified, i.e. whose md5sum
+	// is not the one of the packaged file, and their .dpkg-old copies.
+	KeepModified bool `yaml:"keep_modified,omitempty" json:"keep_modified,omitempty" jsonschema:"title=keep the conffiles the admin modified,default=false"`
+	// Dirs are the state directories the package creates at runtime, e.g.
+	// /var/lib/foo, which are removed with everything within them.
+	Dirs []string `yaml:"dirs,omitempty" json:"dirs,omitempty" jsonschema:"title=state directories to remove,example=/var/lib/foo"`
+}
+
+type DebSignature struct {
+	PackageSignature `yaml:",inline" json:",inline"`
+	// debsign, or dpkg-sig (defaults to debsign)
+	Method string `yaml:"method,omitempty" json:"method,omitempty" jsonschema:"title=method role,enum=debsign,enum=dpkg-sig,default=debsign"`
+	// origin, maint or archive (defaults to origin)
+	Type   string `yaml:"type,omitempty" json:"type,omitempty" jsonschema:"title=signer role,enum=origin,enum=maint,enum=archive,default=origin"`
+	Signer string `yaml:"signer,omitempty" json:"signer,omitempty" jsonschema:"title=signer"`
+}
+
+// DebTriggers contains triggers only available for deb packages.
+// https://wiki.debian.org/DpkgTriggers
+// https://man7.org/linux/man-pages/man5/deb-triggers.5.html
+type DebTriggers struct {
+	Interest        []string `yaml:"interest,omitempty" json:"interest,omitempty" jsonschema:"title=interest"`
+	InterestAwait   []string `yaml:"interest_await,omitempty" json:"interest_await,omitempty" jsonschema:"title=interest await"`
+	InterestNoAwait []string `yaml:"interest_noawait,omitempty" json:"interest_noawait,omitempty" jsonschema:"title=interest noawait"`
+	Activate        []string `yaml:"activate,omitempty" json:"activate,omitempty" jsonschema:"title=activate"`
+	ActivateAwait   []string `yaml:"activate_await,omitempty" json:"activate_await,omitempty" jsonschema:"title=activate await"`
+	ActivateNoAwait []string `yaml:"activate_noawait,omitempty" json:"activate_noawait,omitempty" jsonschema:"title=activate noawait"`
+}
+
+// DebScripts is scripts only available on deb packages.
+type DebScripts struct {
+	Rules     string `yaml:"rules,omitempty" json:"rules,omitempty" jsonschema:"title=rules"`
+	Templates string `yaml:"templates,omitempty" json:"templates,omitempty" jsonschema:"title=templates"`
+	Config    string `yaml:"config,omitempty" json:"config,omitempty" jsonschema:"title=config"`
+}
+
+// Scripts contains information about maintainer scripts for packages.
+type Scripts struct {
+	PreInstall  string `yaml:"preinstall,omitempty" json:"preinstall,omitempty" jsonschema:"title=pre install"`
+	PostInstall string `yaml:"postinstall,omitempty" json:"postinstall,omitempty" jsonschema:"title=post install"`
+	PreRemove   string `yaml:"preremove,omitempty" json:"preremove,omitempty" jsonschema:"title=pre remove"`
+	PostRemove  string `yaml:"postremove,omitempty" json:"postremove,omitempty" jsonschema:"title=post remove"`
+}
+
+// ValidationError is returned when an Info is invalid. Code is a stable
+// identifier of the kind of failure, such as missing_field, which tooling can
+// rely on instead of the message, and Field the configuration key at fault,
+// such as version or contents[2], if there is one.
+type ValidationError struct {
+	Code  string
+	Field string
+	Msg   string
+	// Err is the error the validation failed with, if any, e.g.
+	// files.ErrContentCollision.
+	Err error
+}
+
+func (e ValidationError) Error() string { return e.Msg }
+
+func (e ValidationError) Unwrap() error { return e.Err }
+
+// NewValidationError returns a ValidationError with the given code and field,
+// whose message is formatted as fmt.Errorf does, wrapping the error of its %w
+// verb, if any.
+func NewValidationError(code, field, format string, args ...any) ValidationError {
+	err := fmt.Errorf(format, args...)
+	return ValidationError{Code: code, Field: field, Msg: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// MissingFileError returns the error of a file the configuration references
+// with field, e.g. scripts.postinstall, that does not exist or cannot be
+// read.
+func MissingFileError(field, path string, err error) ValidationError {
+	msg := fmt.Sprintf("%s: file not readable: %s: %s", field, path, err)
+	if errors.Is(err, fs.ErrNotExist) {
+		msg = fmt.Sprintf("%s: file not found: %s", field, path)
+	}
+	return ValidationError{Code: "missing_file", Field: field, Msg: msg, Err: err}
+}
+
+// ErrFieldEmpty happens when some required field is empty.
+//
+// Deprecated: use ValidationError, whose Code is missing_field.
+type ErrFieldEmpty = ValidationError
+
+func missingField(field string) ValidationError {
+	return NewValidationError("missing_field", field, "package %s must be provided", field)
+}
+
+// invalidContents returns the error of contents that cannot be prepared for
+// a packager, e.g. because of a content collision or a missing source file.
+func invalidContents(err error) ValidationError {
+	return NewValidationError("invalid_contents", "contents", "%w", err)
+}
+
+// CompressionOptions tunes the xz and zstd compressors of the payloads of
+// deb and archlinux packages. rpm packages are compressed by rpmpack, which
+// does not expose them, and apk packages are always compressed with gzip.
+type CompressionOptions struct {
+	// Threads is the number of blocks zstd compresses concurrently. It
+	// defaults to 1, the only value whose output is guaranteed to be the same
+	// from one build to the next. xz always compresses on a single thread.
+	Threads int `yaml:"threads,omitempty" json:"threads,omitempty" jsonschema:"title=number of blocks zstd compresses concurrently,default=1"`
+	// BlockSize is the size in bytes of the blocks xz splits the payload
+	// into, so that it can be decompressed in parallel. It defaults to a
+	// single block.
+	BlockSize int64 `yaml:"block_size,omitempty" json:"block_size,omitempty" jsonschema:"title=size of the xz blocks in bytes"`
+}
+
+// ZstdConcurrency returns the concurrency of the zstd encoder, see Threads.
+func (o CompressionOptions) ZstdConcurrency() int {
+	return max(o.Threads, 1)
+}
+
+// validateFiles checks that the scripts and the changelog exist and are
+// readable, so that typos are reported before building any package. The key
+// files are not checked, as they are often only provided when signing.
+func validateFiles(info *Info) error {
+	checked := []struct {
+		field, path string
+	}{
+		{"scripts.preinstall", info.Scripts.PreInstall},
+		{"scripts.postinstall", info.Scripts.PostInstall},
+		{"scripts.preremove", info.Scripts.PreRemove},
+		{"scripts.postremove", info.Scripts.PostRemove},
+		{"changelog", info.Changelog},
+		{"deb.scripts.rules", info.Deb.Scripts.Rules},
+		{"deb.scripts.templates", info.Deb.Scripts.Templates},
+		{"deb.scripts.config", info.Deb.Scripts.Config},
+		{"rpm.scripts.pretrans", info.RPM.Scripts.PreTrans},
+		{"rpm.scripts.posttrans", info.RPM.Scripts.PostTrans},
+		{"rpm.scripts.verify", info.RPM.Scripts.Verify},
+		{"apk.scripts.preupgrade", info.APK.Scripts.PreUpgrade},
+		{"apk.scripts.postupgrade", info.APK.Scripts.PostUpgrade},
+		{"apk.triggers.script", info.APK.Triggers.Script},
+		{"archlinux.scripts.preupgrade", info.ArchLinux.Scripts.PreUpgrade},
+		{"archlinux.scripts.postupgrade", info.ArchLinux.Scripts.PostUpgrade},
+	}
+	for _, migration := range info.RPM.ConfigMigrations {
+		checked = append(checked, struct{ field, path string }{"rpm.config_migrations.script", migration.Script})
+	}
+	for _, file := range checked {
+		if file.path == "" {
+			continue
+		}
+		f, err := os.Open(file.path)
+		if err != nil {
+			return MissingFileError(file.field, file.path, err)
+		}
+		stat, err := f.Stat()
+		_ = f.Close()
+		if err == nil && stat.IsDir() {
+			err = errors.New("is a directory")
+		}
+		if err != nil {
+			return MissingFileError(file.field, file.path, err)
+		}
+	}
+	return nil
+}
+
+// PrepareForPackager validates the configuration for the given packager and
+// prepares the contents for said packager.
+func PrepareForPackager(info *Info, packager string) error {
+	if errs := validateForPackager(info, packager); len(errs) > 0 {
+		return errs[0]
+	}
+	if err := resolveKeyEnv(info, packager); err != nil {
+		return err
+	}
+	applySnapshot(info, packager)
+	applyRenames(info, packager)
+	applyMaintainer(info)
+	if err := validateDependencies(info, versionComparator(packager)); err != nil {
+		return err
+	}
+	dedupeDependencies(info)
+	if err := resolveContents(info, packager); err != nil {
+		return err
+	}
+	if err := applyAutoDeps(info, packager); err != nil {
+		return err
+	}
+	if info.prepared != nil {
+		info.prepared.info = info
+	}
+	return nil
+}
+
+// applyAutoDeps adds the shared objects the ELF files of the prepared
+// contents provide and need to the relationships of the package, in the
+// syntax of the given packager, if AutoDeps is set:
+//   - rpm: provides and requires `libfoo.so.1()(64bit)`, or `libfoo.so.1`
+//     for 32-bit files, like find-provides and find-requires
+//   - apk: provides `so:libfoo.so.1=V`, V being the version in the name of
+//     the file, and depends on `so:libbar.so.2`, like abuild
+//   - archlinux: provides `libfoo.so=1-64`, like makepkg, which leaves the
+//     dependencies on libraries to be listed explicitly
+//   - deb: nothing, the provided shared objects are listed in the shlibs
+//     control file instead, and the needed ones can only be mapped to their
+//     packages with the shlibs of the target system, as dpkg-shlibdeps does
+func applyAutoDeps(info *Info, packager string) error {
+	if !info.AutoDeps {
+		return nil
+	}
+	provided, needed, err := files.SharedObjects(info.Contents)
+	if err != nil {
+		return err
+	}
+
+	var provides, depends []string
+	switch packager {
+	case "rpm":
+		name := func(so files.SharedObject) string {
+			if so.Is64Bit {
+				return so.Name + "()(64bit)"
+			}
+			return so.Name
+		}
+		for _, so := range provided {
+			provides = append(provides, name(so))
+		}
+		for _, so := range needed {
+			depends = append(depends, name(so))
+		}
+	case "apk":
+		for _, so := range provided {
+			provides = append(provides, fmt.Sprintf("so:%s=%s", so.Name, so.Version))
+		}
+		for _, so := range needed {
+			depends = append(depends, "so:"+so.Name)
+		}
+	case "archlinux":
+		for _, so := range provided {
+			name, version, ok := strings.Cut(so.Name, ".so.")
+			if !ok {
+				continue
+			}
+			bits := "32"
+			if so.Is64Bit {
+				bits = "64"
+			}
+			provides = append(provides, fmt.Sprintf("%s.so=%s-%s", name, version, bits))
+		}
+	}
+
+	// the slices may be shared with the config the info was derived from
+	info.Provides = slices.Clone(info.Provides)
+	for _, p := range provides {
+		if !slices.Contains(info.Provides, p) {
+			info.Provides = append(info.Provides, p)
+		}
+	}
+	info.Depends = slices.Clone(info.Depends)
+	for _, d := range depends {
+		if !slices.Contains(info.Depends, d) {
+			info.Depends = append(info.Depends, d)
+		}
+	}
+	return nil
+}
+
+// validateForPackager returns the errors of the fields of the info, in the
+// order PrepareForPackager checks them.
+func validateForPackager(info *Info, packager string) []error {
+	var errs []error
+	if info.Name == "" {
+		errs = append(errs, missingField("name"))
+	}
+	if info.Arch == "" &&
+		((packager == "deb" && info.Deb.Arch == "") ||
+			(packager == "rpm" && info.RPM.Arch == "") ||
+			(packager == "apk" && info.APK.Arch == "")) {
+		errs = append(errs, missingField("arch"))
+	}
+	if info.Version == "" {
+		errs = append(errs, missingField("version"))
+	}
+	for _, err := range []error{
+		validateGoarm(info),
+		validateArch(info),
+		validateEmptyContents(info.Contents),
+		validateContentOrder(info.ContentOrder),
+		validateOnEmptyGlob(info.OnEmptyGlob),
+		validateNonRootOwnership(info.NonRootOwnership),
+		validateKeyring(info.Keyring),
+		validateCategory(info),
+		validateMetadata(info.Metadata),
+		validateMaintainer(info),
+		validateSnapshot(info.Snapshot),
+		validateInstallPrefix(info.InstallPrefix),
+		validateTargetDistro(info),
+		validateMinToolVersion(info.MinToolVersion),
+		validateRenames(info),
+		validateModePolicies(info.ModePolicies),
+		validateSignatureKeys(info),
+		validateWorldWritableAllowlist(info.WorldWritableAllowlist),
+		validatePathDefaults(info.PathDefaults),
+		validateFileInfoRefs(info),
+		validateCompressionOptions(info.CompressionOptions),
+		validateScriptShell(info.ScriptShell),
+		validateMaxPathLength(info.MaxPathLength),
+	} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// resolveContents resolves the contents of the info for the packager, from
+// the keyring to the alternatives, and warns about the contents that do not
+// follow the conventions.
+func resolveContents(info *Info, packager string) (err error) {
+	applyKeyring(info, packager)
+	info.Contents = copyContents(info.Contents, "")
+	if err := applyConditions(info, packager, os.Getenv); err != nil {
+		return err
+	}
+	if err := applyFileInfoRefs(info); err != nil {
+		return err
+	}
+	if err := appendConventionalContents(info, packager); err != nil {
+		return invalidContents(err)
+	}
+	if err := files.NormalizeConfigTypes(info.Contents); err != nil {
+		return invalidContents(err)
+	}
+	if err := applyDownloads(info); err != nil {
+		return err
+	}
+	if info.Contents, err = files.FromStagingRoot(info.Contents, info.StagingRoot, info.DisableGlobbing); err != nil {
+		return invalidContents(err)
+	}
+	prefix := applyInstallPrefix(info)
+	applyReproducible(info)
+	applyPreserveMTimes(info)
+	markPathDefaults(info)
+	applyDefAttr(info)
+	applyOnEmptyGlob(info)
+
+	prepare := files.PrepareForPackager
+	if info.ContentOrder == ContentOrderConfig {
+		prepare = files.PrepareForPackagerInConfigOrder
+	}
+	info.Contents, err = prepare(
+		info.Contents,
+		info.Umask,
+		packager,
+		info.DisableGlobbing,
+		info.MTime,
+	)
+	if err != nil {
+		return invalidContents(err)
+	}
+	if info.contentCache != nil {
+		for _, content := range info.Contents {
+			content.Cache = info.contentCache
+		}
+	}
+	for _, transform := range contentTransformers(info, prefix) {
+		if info.Contents, err = transform(info.Contents); err != nil {
+			return err
+		}
+	}
+	if info.Dedup && supportsHardlinks(packager) {
+		if err := dedupContents(info.Contents); err != nil {
+			return err
+		}
+	}
+
+	if info.Reproducible {
+		for _, content := range info.Contents {
+			if content.FileInfo != nil && !content.Raw {
+				content.FileInfo.MTime = info.MTime
+			}
+		}
+	}
+
+	if err := validateContentPaths(info.Contents, info.MaxPathLength); err != nil {
+		return err
+	}
+	if err := validateAlternatives(info.Alternatives, info.Contents); err != nil {
+		return err
+	}
+	if p, ok := packagers[packager].(PackagerWithValidation); ok {
+		if err := p.Validate(info); err != nil {
+			return err
+		}
+	}
+	if err := applyOwnerIDs(info); err != nil {
+		return err
+	}
+
+	if errs := files.EscapingSymlinks(info.Contents); len(errs) > 0 {
+		if info.DisallowEscapingSymlinks {
+			return errors.Join(errs...)
+		}
+		for _, err := range errs {
+			warn(err)
+		}
+	}
+
+	if errs := files.NumericOwnership(info.Contents); len(errs) > 0 {
+		if info.StaticOwnership {
+			return errors.Join(errs...)
+		}
+		for _, err := range errs {
+			warn(err)
+		}
+	}
+
+	if info.NonRootOwnership == NonRootOwnershipWarn || info.NonRootOwnership == NonRootOwnershipError {
+		if errs := files.NonRootOwnership(info.Contents); len(errs) > 0 {
+			if info.NonRootOwnership == NonRootOwnershipError {
+				return errors.Join(errs...)
+			}
+			for _, err := range errs {
+				warn(err)
+			}
+		}
+	}
+
+	if info.ForbidWorldWritable {
+		if err := checkWorldWritable(info.Contents, info.WorldWritableAllowlist); err != nil {
+			return err
+		}
+	}
+
+	if info.CheckELFArch {
+		errs, err := files.CheckELFArch(info.Contents, info.Arch)
+		if err != nil {
+			return invalidContents(err)
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+	}
+
+	lints := lintTargetDistro(info, packager)
+	if info.StrictLints && len(lints) > 0 {
+		return errors.Join(lints...)
+	}
+	for _, err := range lints {
+		warn(err)
+	}
+
+	return nil
+}
+
+// SetLogger makes nfpm, its packagers and the deprecation notices report
+// their warnings to the logger, at the warn level, instead of printing them
+// to stderr. The findings of the lints carry the `lint`, `distro` and
+// `path` attributes, and all the warnings about errors their `code`, see
+// ValidationError. A nil logger restores the printing to stderr.
+func SetLogger(logger *slog.Logger) {
+	warning.SetLogger(logger)
+}
+
+// warn reports err as a warning, with the attributes SetLogger documents.
+func warn(err error) {
+	var args []any
+	var verr ValidationError
+	if errors.As(err, &verr) {
+		args = append(args, "code", verr.Code)
+	}
+	var lint ErrDistroLint
+	if errors.As(err, &lint) {
+		args = append(args, "code", "distro_lint", "lint", lint.Lint, "distro", lint.Distro)
+		if lint.Path != "" {
+			args = append(args, "path", lint.Path)
+		}
+	}
+	warning.Warn(err.Error(), args...)
+}
+
+// ContentTransformer transforms the contents of a package once they are
+// prepared for the packager, see Info.ContentTransformers. It may modify the
+// given contents in place, as they are owned by the info being packaged.
+type ContentTransformer func(files.Contents) (files.Contents, error)
+
+// contentTransformers returns the transformers that run on the prepared
+// contents, in order: the relocation of the absolute symlink targets below
+// the install prefix, the default mode and the modes of the implicit
+// directories, the path defaults, the disowning of the standard directories,
+// the rendering of the templates, the substitution of the environment
+// variables, the normalization of the line endings, the compression of the
+// man pages and the mode policies, followed by info.ContentTransformers.
+func contentTransformers(info *Info, prefix string) []ContentTransformer {
+	builtin := []ContentTransformer{
+		func(contents files.Contents) (files.Contents, error) {
+			applyInstallPrefixToSymlinks(contents, prefix)
+			return contents, nil
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			applyDefaultDirMode(contents, info.DefaultDirMode)
+			applyDirectoryModes(contents, info.DirectoryModes)
+			return contents, nil
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			applyPathDefaults(contents, info.PathDefaults)
+			return contents, nil
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			if !info.DisownStandardDirs {
+				return contents, nil
+			}
+			return files.DisownDirectories(contents, info.StandardDirs), nil
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			return contents, renderTemplates(info, contents)
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			return contents, files.ExpandEnv(contents, os.Getenv)
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			return contents, files.NormalizeEOL(contents)
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			if !info.CompressManPages {
+				return contents, nil
+			}
+			return contents, compressManPages(contents)
+		},
+		func(contents files.Contents) (files.Contents, error) {
+			return contents, applyModePolicies(contents, info.ModePolicies)
+		},
+	}
+	return append(builtin, info.ContentTransformers...)
+}
+
+func validGoarm(goarm string) bool {
+	return goarm == "5" || goarm == "6" || goarm == "7"
+}
+
+// validateGoarm checks the goarm hint, which requires arch to be arm, or the
+// arm variant it resolves to once the defaults are applied.
+func validateGoarm(info *Info) error {
+	if info.Goarm == "" {
+		return nil
+	}
+	if !validGoarm(info.Goarm) {
+		return NewValidationError("invalid_goarm", "goarm", "invalid goarm: %s: must be one of 5, 6 or 7", info.Goarm)
+	}
+	if info.Arch != "arm" && info.Arch != "arm"+info.Goarm {
+		return NewValidationError("invalid_goarm", "goarm", "invalid goarm: %s: can only be used with arch arm, got %s", info.Goarm, info.Arch)
+	}
+	return nil
+}
+
+var archRegexp = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+
+// validateArch checks the arch and the arches of the formats, which may be
+// empty.
+func validateArch(info *Info) error {
+	for _, field := range []struct{ name, arch string }{
+		{"arch", info.Arch},
+		{"deb.arch", info.Deb.Arch},
+		{"rpm.arch", info.RPM.Arch},
+		{"apk.arch", info.APK.Arch},
+		{"archlinux.arch", info.ArchLinux.Arch},
+	} {
+		if field.arch != "" && !archRegexp.MatchString(field.arch) {
+			return NewValidationError("invalid_arch", field.name, "invalid arch: %q", field.arch)
+		}
+	}
+	return nil
+}
+
+// validateEmptyContents checks that every entry of the contents says what to
+// package or where.
+func validateEmptyContents(contents files.Contents) error {
+	for i, content := range contents {
+		if content == nil ||
+			(content.Source == "" && len(content.Sources) == 0 && content.Manifest == "" &&
+				content.Data == nil && content.Destination == "") {
+			return NewValidationError("empty_contents", fmt.Sprintf("contents[%d]", i), "contents[%d] is empty: it must have a src or a dst", i)
+		}
+	}
+	return nil
+}
+
+func validateContentOrder(order string) error {
+	switch order {
+	case "", ContentOrderSorted, ContentOrderConfig:
+		return nil
+	default:
+		return NewValidationError("invalid_content_order", "content_order", "invalid content order: %q", order)
+	}
+}
+
+func validateOnEmptyGlob(policy string) error {
+	switch policy {
+	case "", files.OnEmptyGlobError, files.OnEmptyGlobWarn, files.OnEmptyGlobSkip:
+		return nil
+	default:
+		return NewValidationError("invalid_on_empty_glob", "on_empty_glob", "invalid on_empty_glob: %q", policy)
+	}
+}
+
+func validateNonRootOwnership(policy string) error {
+	switch policy {
+	case "", NonRootOwnershipIgnore, NonRootOwnershipWarn, NonRootOwnershipError:
+		return nil
+	default:
+		return NewValidationError("invalid_non_root_ownership", "non_root_ownership", "invalid non_root_ownership: %q", policy)
+	}
+}
+
+func validateCompressionOptions(options CompressionOptions) error {
+	if options.Threads < 0 {
+		return NewValidationError("invalid_compression_options", "compression_options.threads", "invalid compression options: threads must not be negative, got %d", options.Threads)
+	}
+	if options.BlockSize < 0 {
+		return NewValidationError("invalid_compression_options", "compression_options.block_size", "invalid compression options: block_size must not be negative, got %d", options.BlockSize)
+	}
+	return nil
+}
+
+func validateScriptShell(shell string) error {
+	if shell == "" {
+		return nil
+	}
+	if !path.IsAbs(shell) || strings.ContainsFunc(shell, unicode.IsSpace) {
+		return NewValidationError("invalid_script_shell", "script_shell", "invalid script shell %q: must be an absolute path without whitespace", shell)
+	}
+	return nil
+}
+
+func validateMaxPathLength(length int) error {
+	if length < 0 {
+		return NewValidationError("invalid_max_path_length", "max_path_length", "invalid max path length %d: must not be negative", length)
+	}
+	return nil
+}
+
+// validateContentPaths checks the destinations of the prepared contents,
+// which the content transformers may have changed, see files.ContentPaths
+// and Info.MaxPathLength.
+func validateContentPaths(contents files.Contents, maxLength int) error {
+	var errs []error
+	for _, err := range files.ContentPaths(contents, maxLength) {
+		errs = append(errs, NewValidationError("invalid_content_path", "contents", "%w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// ErrDistroLint is the finding of a lint of the target distro, or of a Lint
+// of the packager, which is printed as a warning.
+type ErrDistroLint struct {
+	Lint   string
+	Distro string
+	// Path is the destination of the content, empty if the finding is about
+	// the package itself.
+	Path   string
+	Reason string
+}
+
+func (e ErrDistroLint) Error() string {
+	if e.Distro == "" && e.Path == "" {
+		return fmt.Sprintf("%s (lint %s)", e.Reason, e.Lint)
+	}
+	if e.Distro == "" {
+		return fmt.Sprintf("%s: %s (lint %s)", e.Path, e.Reason, e.Lint)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("target distro %s: %s (lint %s)", e.Distro, e.Reason, e.Lint)
+	}
+	return fmt.Sprintf("target distro %s: %s: %s (lint %s)", e.Distro, e.Path, e.Reason, e.Lint)
+}
+
+func validateTargetDistro(info *Info) error {
+	if info.TargetDistro != "" && !lint.IsSupported(info.TargetDistro) {
+		return NewValidationError("invalid_target_distro", "target_distro", "invalid target distro: %q", info.TargetDistro)
+	}
+	names := lintNames()
+	for _, name := range info.SuppressLints {
+		if !slices.Contains(names, name) {
+			return NewValidationError("invalid_target_distro", "suppress_lints", "invalid suppressed lint: %q", name)
+		}
+	}
+	return nil
+}
+
+// lintNames returns the names of the lints of the target distro and of the
+// Lints of the registered packagers.
+func lintNames() []string {
+	var names []string
+	for _, l := range lint.Lints {
+		names = append(names, l.Name)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for _, p := range packagers {
+		if p, ok := p.(PackagerWithLints); ok {
+			for _, l := range p.Lints() {
+				names = append(names, l.Name)
+			}
+		}
+	}
+	return names
+}
 
-	// Package signing passphrase
-	generalPassphrase := os.Expand("$NFPM_PASSPHRASE", c.envMappingFunc)
-	c.Info.Deb.Signature.KeyPassphrase = generalPassphrase
-	c.Info.RPM.Signature.KeyPassphrase = generalPassphrase
-	c.Info.APK.Signature.KeyPassphrase = generalPassphrase
+var minToolVersionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
 
-	debPassphrase := os.Expand("$NFPM_DEB_PASSPHRASE", c.envMappingFunc)
-	if debPassphrase != "" {
-		c.Info.Deb.Signature.KeyPassphrase = debPassphrase
+func validateMinToolVersion(versions map[string]string) error {
+	formats := make([]string, 0, len(versions))
+	for format := range versions {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	for _, format := range formats {
+		version := versions[format]
+		if (format != "deb" && format != "rpm") || !minToolVersionRegexp.MatchString(version) {
+			return NewValidationError("invalid_min_tool_version", "min_tool_version", "invalid min tool version %q for %s: must be a numeric version, such as 1.19.0, of deb or rpm", version, format)
+		}
+	}
+	return nil
+}
+
+// lintTargetDistro runs the lints of the target distro, see lint.Run, and
+// the Lints of the packager of the given format that are not suppressed
+// against the package built from the prepared contents.
+func lintTargetDistro(info *Info, format string) []error {
+	var errs []error
+	for _, finding := range lint.Run(info.TargetDistro, format, info.Contents, info.SuppressLints) {
+		errs = append(errs, ErrDistroLint{
+			Lint:   finding.Lint,
+			Distro: info.TargetDistro,
+			Path:   finding.Path,
+			Reason: finding.Reason,
+		})
+	}
+	p, _ := Get(format)
+	if p, ok := p.(PackagerWithLints); ok {
+		for _, l := range p.Lints() {
+			if slices.Contains(info.SuppressLints, l.Name) {
+				continue
+			}
+			if reason := l.Check(info); reason != "" {
+				errs = append(errs, ErrDistroLint{Lint: l.Name, Distro: info.TargetDistro, Reason: reason})
+			}
+		}
+	}
+	return errs
+}
+
+// ResolveMaintainer returns Maintainer, or the maintainer composed of
+// MaintainerName and MaintainerEmail as `Name <email>`.
+func (info *Info) ResolveMaintainer() string {
+	if info.Maintainer != "" || (info.MaintainerName == "" && info.MaintainerEmail == "") {
+		return info.Maintainer
+	}
+	return fmt.Sprintf("%s <%s>", info.MaintainerName, info.MaintainerEmail)
+}
+
+func validateMaintainer(info *Info) error {
+	if info.Maintainer != "" && (info.MaintainerName != "" || info.MaintainerEmail != "") {
+		return NewValidationError("invalid_maintainer", "maintainer", "invalid maintainer %q: maintainer_name and maintainer_email can not be combined with maintainer", info.Maintainer)
+	}
+	if (info.MaintainerName == "") != (info.MaintainerEmail == "") {
+		return NewValidationError("invalid_maintainer", "maintainer_name", "invalid maintainer %q: maintainer_name and maintainer_email must be set together", info.ResolveMaintainer())
+	}
+	maintainer := info.ResolveMaintainer()
+	if !strings.Contains(maintainer, "<") {
+		return nil
+	}
+	if _, err := mail.ParseAddress(maintainer); err != nil {
+		if list, _ := mail.ParseAddressList(maintainer); len(list) > 1 {
+			return NewValidationError("invalid_maintainer", "maintainer", "invalid maintainer %q: must be a single mailbox, not %d", maintainer, len(list))
+		}
+		return NewValidationError("invalid_maintainer", "maintainer", "invalid maintainer %q: %w", maintainer, err)
+	}
+	return nil
+}
+
+// applyMaintainer sets Maintainer to the resolved maintainer, warning if it
+// has no email address in angle brackets, as deb and rpm expect.
+func applyMaintainer(info *Info) {
+	info.Maintainer = info.ResolveMaintainer()
+	info.MaintainerName, info.MaintainerEmail = "", ""
+	if info.Maintainer != "" && !strings.Contains(info.Maintainer, "<") {
+		warn(NewValidationError("invalid_maintainer", "maintainer", "invalid maintainer %q: no email address in angle brackets, expected Name <email>", info.Maintainer))
+	}
+}
+
+// versionComparator returns the version comparison of the packager, that of
+// dpkg for the packagers other than rpm and archlinux and when the packager is
+// not known yet.
+func versionComparator(packager string) func(a, b string) int {
+	switch packager {
+	case "rpm":
+		return vercmp.RPM
+	case "archlinux":
+		return vercmp.Arch
+	default:
+		return vercmp.Deb
+	}
+}
+
+// validateDependencies checks the dependencies, conflicts, breaks and
+// provides of the package, see dependency.Validate. Versions are compared by
+// compare, see versionComparator.
+func validateDependencies(info *Info, compare func(a, b string) int) error {
+	err := dependency.Validate(dependency.Package{
+		Name:       info.Name,
+		Version:    info.Version,
+		Epoch:      info.Epoch,
+		Prerelease: info.Prerelease,
+		Release:    info.Release,
+		Depends:    info.Depends,
+		Conflicts:  info.Conflicts,
+		Breaks:     info.Deb.Breaks,
+		Provides:   info.Provides,
+	}, compare)
+	var derr dependency.Error
+	if errors.As(err, &derr) {
+		return NewValidationError("invalid_dependency", "depends", "invalid dependency on %q: %s", derr.Name, derr.Reason)
+	}
+	return err
+}
+
+// dedupeDependencies removes the dependencies that are listed more than once,
+// keeping the first occurrence.
+func dedupeDependencies(info *Info) {
+	info.Depends = dedupeStrings(info.Depends)
+	info.Conflicts = dedupeStrings(info.Conflicts)
+	info.Deb.Breaks = dedupeStrings(info.Deb.Breaks)
+}
+
+func dedupeStrings(items []string) []string {
+	if len(items) < 2 {
+		return items
+	}
+	seen := make(map[string]struct{}, len(items))
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		key := strings.TrimSpace(item)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, item)
+	}
+	return result
+}
+
+// nolint: gochecknoglobals
+var alternativeNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_-]*$`)
+
+// validateAlternatives checks the alternatives against the prepared contents,
+// as the path of an alternative and of its slaves must be packaged files.
+func validateAlternatives(alternatives []Alternative, contents files.Contents) error {
+	for _, alt := range alternatives {
+		if err := validateAlternative(alt.Name, alt.Link, alt.Path, contents); err != nil {
+			return err
+		}
+		for _, slave := range alt.Slaves {
+			if err := validateAlternative(slave.Name, slave.Link, slave.Path, contents); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateAlternative(name, link, path string, contents files.Contents) error {
+	if !alternativeNameRegexp.MatchString(name) {
+		return NewValidationError("invalid_alternative", "alternatives", "invalid alternative %q: names may only contain letters, digits, '.', '+', '-' and '_'", name)
+	}
+	for _, p := range []string{link, path} {
+		if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, " \t\n'\"\\") {
+			return NewValidationError("invalid_alternative", "alternatives", "invalid alternative %q: %q must be an absolute path without whitespace or quotes", name, p)
+		}
+	}
+	for _, content := range contents {
+		if content.Destination != path {
+			continue
+		}
+		switch content.Type {
+		case files.TypeDir, files.TypeImplicitDir, files.TypeRPMGhost:
+		default:
+			return nil
+		}
+	}
+	return NewValidationError("invalid_alternative", "alternatives", "invalid alternative %q: %s is not a file of the package", name, path)
+}
+
+// nolint: gochecknoglobals
+var metadataKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func validateMetadata(metadata map[string]string) error {
+	for key, value := range metadata {
+		if !metadataKeyRegexp.MatchString(key) {
+			return NewValidationError("invalid_metadata", "metadata", "invalid metadata %q: keys may only contain letters, digits, '-' and '_'", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return NewValidationError("invalid_metadata", "metadata", "invalid metadata %q: values must be a single line", key)
+		}
+	}
+	return nil
+}
+
+func validateCategory(info *Info) error {
+	if _, ok := info.ResolveCategory(); info.Category != "" && !ok {
+		return NewValidationError("invalid_category", "category", "invalid category: %q", info.Category)
+	}
+	return nil
+}
+
+func validateKeyring(keyring Keyring) error {
+	for packager, fingerprint := range keyring.Keys {
+		switch packager {
+		case "deb", "rpm":
+		default:
+			// apk packages are signed with RSA keys, which can't be looked up
+			// in a PGP keyring.
+			return NewValidationError("invalid_keyring", "keyring", "invalid keyring for %s: only deb and rpm packages can be signed from a keyring", packager)
+		}
+		if keyring.KeyFile == "" {
+			return NewValidationError("invalid_keyring", "keyring", "invalid keyring for %s: key_file must be set", packager)
+		}
+		if !validFingerprint(fingerprint) {
+			return NewValidationError("invalid_keyring", "keyring", "invalid keyring for %s: %q is not a valid fingerprint", packager, fingerprint)
+		}
+	}
+	return nil
+}
+
+// validFingerprint checks for a v4 fingerprint, possibly space separated as
+// printed by gpg.
+func validFingerprint(fingerprint string) bool {
+	fingerprint = strings.ReplaceAll(fingerprint, " ", "")
+	if len(fingerprint) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(fingerprint)
+	return err == nil
+}
+
+// applyKeyring sets the keyring and the fingerprint of the packager's key on
+// its signature, unless the signature is already configured.
+func applyKeyring(info *Info, packager string) {
+	fingerprint, ok := info.Keyring.Keys[packager]
+	if !ok {
+		return
+	}
+	var signature *PackageSignature
+	switch packager {
+	case "deb":
+		signature = &info.Deb.Signature.PackageSignature
+	case "rpm":
+		signature = &info.RPM.Signature.PackageSignature
+	default:
+		return
+	}
+	if signature.KeyFile != "" || signature.SignFn != nil {
+		return
+	}
+	signature.KeyFile = info.Keyring.KeyFile
+	signature.KeyID = &fingerprint
+}
+
+// Enforcement modes of a ModePolicy.
+const (
+	// ModePolicyError fails the packaging if a content violates the policy.
+	ModePolicyError = "error"
+	// ModePolicyFix changes the modes of the contents to follow the policy.
+	ModePolicyFix = "fix"
+)
+
+// ModePolicy restricts the modes of the files, i.e. the contents other than
+// directories and symlinks, whose destination match Path, e.g. to forbid
+// world-readable files below /etc/foo with `path: /etc/foo/**` and
+// `forbid_bits: 0o007`.
+type ModePolicy struct {
+	// Path is matched against the destinations with path.Match, and a
+	// trailing /** matches all the contents below the directory.
+	Path string `yaml:"path" json:"path" jsonschema:"title=destinations the policy applies to,example=/etc/foo/**"`
+	// RequiredMode, if set, is the permission bits the contents must have.
+	RequiredMode fs.FileMode `yaml:"required_mode,omitempty" json:"required_mode,omitempty" jsonschema:"title=required permission bits,example=0o640"`
+	// ForbidBits are the permission bits the contents must not have.
+	ForbidBits fs.FileMode `yaml:"forbid_bits,omitempty" json:"forbid_bits,omitempty" jsonschema:"title=forbidden permission bits,example=0o007"`
+	// Enforce is either ModePolicyError, the default, or ModePolicyFix.
+	Enforce string `yaml:"enforce,omitempty" json:"enforce,omitempty" jsonschema:"title=what to do with violations,enum=error,enum=fix,default=error"`
+}
+
+func (p ModePolicy) matches(dst string) bool {
+	return files.MatchesPath(p.Path, dst)
+}
+
+func validateModePolicies(policies []ModePolicy) error {
+	for _, policy := range policies {
+		if !path.IsAbs(policy.Path) {
+			return NewValidationError("invalid_mode_policy", "mode_policies", "invalid mode policy for %q: path must be absolute", policy.Path)
+		}
+		if _, err := path.Match(strings.TrimSuffix(policy.Path, "/**"), ""); err != nil {
+			return NewValidationError("invalid_mode_policy", "mode_policies", "invalid mode policy for %q: %w", policy.Path, err)
+		}
+		if policy.RequiredMode == 0 && policy.ForbidBits == 0 {
+			return NewValidationError("invalid_mode_policy", "mode_policies", "invalid mode policy for %q: required_mode or forbid_bits must be set", policy.Path)
+		}
+		if policy.RequiredMode&^fs.ModePerm != 0 || policy.ForbidBits&^fs.ModePerm != 0 {
+			return NewValidationError("invalid_mode_policy", "mode_policies", "invalid mode policy for %q: required_mode and forbid_bits may only contain permission bits", policy.Path)
+		}
+		if policy.RequiredMode&policy.ForbidBits != 0 {
+			return NewValidationError("invalid_mode_policy", "mode_policies", "invalid mode policy for %q: required_mode contains forbidden bits", policy.Path)
+		}
+		switch policy.Enforce {
+		case "", ModePolicyError, ModePolicyFix:
+		default:
+			return NewValidationError("invalid_mode_policy", "mode_policies", "invalid mode policy for %q: enforce must be %s or %s, got %q", policy.Path, ModePolicyError, ModePolicyFix, policy.Enforce)
+		}
+	}
+	return nil
+}
+
+func validateWorldWritableAllowlist(allowlist []string) error {
+	for _, pattern := range allowlist {
+		if !path.IsAbs(pattern) {
+			return NewValidationError("invalid_world_writable_allowlist", "world_writable_allowlist", "invalid world-writable allowlist path %q: path must be absolute", pattern)
+		}
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+			return NewValidationError("invalid_world_writable_allowlist", "world_writable_allowlist", "invalid world-writable allowlist path %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkWorldWritable returns a world_writable error for each of the prepared
+// contents files.WorldWritable reports, all of them joined.
+func checkWorldWritable(contents files.Contents, allowlist []string) error {
+	var errs []error
+	for _, err := range files.WorldWritable(contents, allowlist) {
+		errs = append(errs, NewValidationError("world_writable", "forbid_world_writable", "%w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// applyModePolicies checks the modes of the prepared contents against the
+// policies, in order. The violations of the policies enforced with
+// ModePolicyFix are fixed, except for the raw contents, the others are all
+// returned together.
+func applyModePolicies(contents files.Contents, policies []ModePolicy) error {
+	var errs []error
+	for _, content := range contents {
+		switch content.Type {
+		case files.TypeSymlink, files.TypeDir, files.TypeImplicitDir:
+			continue
+		}
+		for _, policy := range policies {
+			if !policy.matches(content.Destination) {
+				continue
+			}
+			mode := content.FileInfo.Mode
+			var reason string
+			switch {
+			case policy.RequiredMode != 0 && mode.Perm() != policy.RequiredMode:
+				reason = fmt.Sprintf("must be %04o", uint32(policy.RequiredMode))
+			case mode&policy.ForbidBits != 0:
+				reason = fmt.Sprintf("must not have the bits %04o", uint32(policy.ForbidBits))
+			default:
+				continue
+			}
+			if policy.Enforce != ModePolicyFix {
+				errs = append(errs, NewValidationError("mode_policy_violation", "mode_policies", "%s: mode %04o violates the mode policy for %q: %s", content.Destination, uint32(mode.Perm()), policy.Path, reason))
+				continue
+			}
+			if content.Raw {
+				continue
+			}
+			if policy.RequiredMode != 0 {
+				mode = mode&^fs.ModePerm | policy.RequiredMode
+			}
+			content.FileInfo.Mode = mode &^ policy.ForbidBits
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyDefaultDirMode sets the mode of the implicit directories, which are
+// otherwise created with mode 0755, before the directory modes are applied.
+func applyDefaultDirMode(contents files.Contents, mode fs.FileMode) {
+	if mode == 0 {
+		return
+	}
+	for _, content := range contents {
+		if content.Type == files.TypeImplicitDir {
+			content.FileInfo.Mode = mode
+		}
+	}
+}
+
+// applyDirectoryModes sets the given file info on implicit directories. Those
+// directories are then handled as explicit ones, so that packagers which do
+// not create implicit directories (such as rpm) still carry their attributes.
+func applyDirectoryModes(contents files.Contents, modes map[string]files.ContentFileInfo) {
+	if len(modes) == 0 {
+		return
+	}
+
+	normalized := make(map[string]files.ContentFileInfo, len(modes))
+	for path, fi := range modes {
+		normalized[files.NormalizeAbsoluteDirPath(path)] = fi
+	}
+
+	for _, content := range contents {
+		if content.Type != files.TypeImplicitDir {
+			continue
+		}
+		fi, ok := normalized[content.Destination]
+		if !ok {
+			continue
+		}
+		if fi.Owner != "" {
+			content.FileInfo.Owner = fi.Owner
+		}
+		if fi.Group != "" {
+			content.FileInfo.Group = fi.Group
+		}
+		if fi.Mode != 0 {
+			content.FileInfo.Mode = fi.Mode
+		}
+		if !fi.MTime.IsZero() {
+			content.FileInfo.MTime = fi.MTime
+		}
+		content.Type = files.TypeDir
+	}
+}
+
+// TemplateContext is the data passed to contents of type template when they
+// are rendered.
+type TemplateContext struct {
+	Name       string
+	Version    string
+	Release    string
+	Prerelease string
+	Arch       string
+	Platform   string
+	Env        map[string]string
+}
+
+func parseTemplate(content *files.Content) (*template.Template, error) {
+	data, err := content.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := template.New(content.Source).Option("missingkey=zero").Parse(string(data))
+	if err != nil {
+		// the error already contains the template name and line number
+		return nil, NewValidationError("invalid_template", "contents", "invalid template: %w", err)
+	}
+	return tpl, nil
+}
+
+// renderTemplates renders all contents of type template and replaces them
+// with regular files holding the rendered output.
+func renderTemplates(info *Info, contents files.Contents) error {
+	var ctx *TemplateContext
+	for _, content := range contents {
+		if content.Type != files.TypeTemplate {
+			continue
+		}
+		if ctx == nil {
+			ctx = &TemplateContext{
+				Name:       info.Name,
+				Version:    info.Version,
+				Release:    info.Release,
+				Prerelease: info.Prerelease,
+				Arch:       info.Arch,
+				Platform:   info.Platform,
+				Env:        map[string]string{},
+			}
+			for _, kv := range os.Environ() {
+				k, v, _ := strings.Cut(kv, "=")
+				ctx.Env[k] = v
+			}
+		}
+
+		tpl, err := parseTemplate(content)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, ctx); err != nil {
+			return fmt.Errorf("rendering template: %w", err)
+		}
+		content.Data = buf.Bytes()
+		content.FileInfo.Size = int64(buf.Len())
+		content.Type = files.TypeFile
+	}
+	return nil
+}
+
+// nolint: gochecknoglobals
+var manPageRegexp = regexp.MustCompile(`^/usr/share/man/(?:[^/]+/)?man[^/]*/[^/]+$`)
+
+// isUncompressedManPage reports whether dst is a man page that is not
+// compressed yet.
+func isUncompressedManPage(dst string) bool {
+	if !manPageRegexp.MatchString(dst) {
+		return false
+	}
+	switch path.Ext(dst) {
+	case ".gz", ".bz2", ".xz", ".lzma", ".zst", ".Z":
+		return false
+	default:
+		return true
+	}
+}
+
+// compressManPages gzips the man pages, as required by the Debian and Fedora
+// policies, unless they are raw contents. The gzip header records no name and
+// no modification time, so that the packages stay reproducible. The symlinks
+// to man pages are renamed and retargeted to the compressed pages. As the
+// compressed pages end in .gz, it is only applied once.
+func compressManPages(contents files.Contents) error {
+	for _, content := range contents {
+		if content.Raw || !isUncompressedManPage(content.Destination) {
+			continue
+		}
+		switch content.Type {
+		case files.TypeFile, files.TypeRPMDoc:
+		case files.TypeSymlink:
+			target := content.Source
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(content.Destination), target)
+			}
+			if isUncompressedManPage(target) {
+				content.Source += ".gz"
+			}
+		default:
+			continue
+		}
+
+		dst := content.Destination + ".gz"
+		if contents.ContainsDestination(dst) {
+			return fmt.Errorf("compressing man page %s: %s is also part of the contents", content.Destination, dst)
+		}
+		if content.Type != files.TypeSymlink {
+			data, err := content.ReadAll()
+			if err != nil {
+				return fmt.Errorf("compressing man page %s: %w", content.Destination, err)
+			}
+			var buf bytes.Buffer
+			gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+			if err != nil {
+				return err
+			}
+			if _, err := gz.Write(data); err != nil {
+				return err
+			}
+			if err := gz.Close(); err != nil {
+				return err
+			}
+			content.Data = buf.Bytes()
+			content.FileInfo.Size = int64(buf.Len())
+		}
+		content.Destination = dst
+	}
+	return nil
+}
+
+// applyDownloads downloads the http:// and https:// sources of the files into
+// their Data, as configured by info.Download. The contents are downloaded
+// again for each package, as they are prepared for each packager separately.
+func applyDownloads(info *Info) error {
+	opts := download.Options{
+		Retries: info.Download.Retries,
+		Timeout: info.Download.Timeout,
+		Backoff: info.Download.Backoff,
+	}
+	for _, content := range info.Contents {
+		switch content.Type {
+		case files.TypeFile, "", files.TypeConfig, files.TypeConfigNoReplace, files.TypeTemplate,
+			files.TypeRPMDoc, files.TypeRPMLicence, files.TypeRPMLicense, files.TypeRPMReadme:
+		default:
+			continue
+		}
+		if content.FS != nil || content.Data != nil || !download.IsURL(content.Source) {
+			continue
+		}
+		data, err := download.Get(content.Source, opts)
+		if err != nil {
+			return NewValidationError("download_failed", "contents", "download failed: %w", err)
+		}
+		content.Data = data
+	}
+	return nil
+}
+
+// supportsHardlinks reports whether the packager can write files.TypeHardlink
+// contents. rpmpack assigns each file its own inode, so rpm packages keep
+// every copy of deduplicated files.
+func supportsHardlinks(packager string) bool {
+	switch packager {
+	case "deb", "apk", "archlinux":
+		return true
+	}
+	return false
+}
+
+// dedupContents turns the files whose contents, mode, owner, group,
+// modification time and attributes are identical to the ones of a file before
+// them into hard links to that file, so that their contents are only stored
+// once. Empty files are kept as they are, as are raw files and config files,
+// which must not change together. It runs once the contents are final, as
+// transformers may still change the files or their order.
+func dedupContents(contents files.Contents) error {
+	canonical := map[string]string{}
+	for _, content := range contents {
+		switch content.Type {
+		case files.TypeFile, "":
+		default:
+			continue
+		}
+		if content.Raw || content.Size() == 0 {
+			continue
+		}
+
+		f, err := content.Open()
+		if err != nil {
+			return fmt.Errorf("dedup %s: %w", content.Destination, err)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("dedup %s: %w", content.Destination, err)
+		}
+
+		info := content.FileInfo
+		key := fmt.Sprintf("%x %o %s %s %d %s",
+			hash.Sum(nil), uint32(info.Mode), info.Owner, info.Group,
+			info.MTime.UnixNano(), strings.Join(info.Attrs, ","))
+		target, ok := canonical[key]
+		if !ok {
+			canonical[key] = content.Destination
+			continue
+		}
+		content.Type = files.TypeHardlink
+		content.Source = target
+		content.Data = nil
+		content.FS = nil
+	}
+	return nil
+}
+
+// Validate the given Info and returns an error if it is invalid. Validate will
+// no change the info's contents.
+func Validate(info *Info) (err error) {
+	if info.Name == "" {
+		return missingField("name")
+	}
+	if info.Arch == "" && (info.Deb.Arch == "" || info.RPM.Arch == "" || info.APK.Arch == "") {
+		return missingField("arch")
+	}
+	if info.Version == "" {
+		return missingField("version")
+	}
+	if err := validateArch(info); err != nil {
+		return err
+	}
+	if err := validateGoarm(info); err != nil {
+		return err
+	}
+	if err := validateEmptyContents(info.Contents); err != nil {
+		return err
+	}
+	if err := validateContentOrder(info.ContentOrder); err != nil {
+		return err
+	}
+	if err := validateOnEmptyGlob(info.OnEmptyGlob); err != nil {
+		return err
+	}
+	if err := validateNonRootOwnership(info.NonRootOwnership); err != nil {
+		return err
+	}
+	if err := validateKeyring(info.Keyring); err != nil {
+		return err
+	}
+	if err := validateCategory(info); err != nil {
+		return err
+	}
+	if err := validateMetadata(info.Metadata); err != nil {
+		return err
+	}
+	if err := validateMaintainer(info); err != nil {
+		return err
+	}
+	if err := validateSnapshot(info.Snapshot); err != nil {
+		return err
+	}
+	if err := validateInstallPrefix(info.InstallPrefix); err != nil {
+		return err
+	}
+	if err := validateTargetDistro(info); err != nil {
+		return err
 	}
-
-	rpmPassphrase := os.Expand("$NFPM_RPM_PASSPHRASE", c.envMappingFunc)
-	if rpmPassphrase != "" {
-		c.Info.RPM.Signature.KeyPassphrase = rpmPassphrase
+	if err := validateMinToolVersion(info.MinToolVersion); err != nil {
+		return err
 	}
-
-	apkPassphrase := os.Expand("$NFPM_APK_PASSPHRASE", c.envMappingFunc)
-	if apkPassphrase != "" {
-		c.Info.APK.Signature.KeyPassphrase = apkPassphrase
+	if err := validateRenames(info); err != nil {
+		return err
 	}
-
-	// RPM specific
-	c.Info.RPM.Packager = os.Expand(c.RPM.Packager, c.envMappingFunc)
-
-	// Deb specific
-	for k, v := range c.Info.Deb.Fields {
-		c.Info.Deb.Fields[k] = os.Expand(v, c.envMappingFunc)
+	if err := validateModePolicies(info.ModePolicies); err != nil {
+		return err
+	}
+	if err := validateWorldWritableAllowlist(info.WorldWritableAllowlist); err != nil {
+		return err
+	}
+	if err := validateSignatureKeys(info); err != nil {
+		return err
+	}
+	if err := validatePathDefaults(info.PathDefaults); err != nil {
+		return err
+	}
+	if err := validateFileInfoRefs(info); err != nil {
+		return err
+	}
+	if err := validateScriptShell(info.ScriptShell); err != nil {
+		return err
+	}
+	if err := validateMaxPathLength(info.MaxPathLength); err != nil {
+		return err
+	}
+	if err := validateDependencies(info, versionComparator("")); err != nil {
+		return err
+	}
+	if err := validateFiles(info); err != nil {
+		return err
 	}
-	c.Info.Deb.Predepends = c.expandEnvVarsStringSlice(c.Info.Deb.Predepends)
-}
-
-// Info contains information about a single package.
-type Info struct {
-	Overridables    `yaml:",inline" json:",inline"`
-	Name            string    `yaml:"name" json:"name" jsonschema:"title=package name"`
-	Arch            string    `yaml:"arch" json:"arch" jsonschema:"title=target architecture,example=amd64"`
-	Platform        string    `yaml:"platform,omitempty" json:"platform,omitempty" jsonschema:"title=target platform,example=linux,default=linux"`
-	Epoch           string    `yaml:"epoch,omitempty" json:"epoch,omitempty" jsonschema:"title=version epoch,example=2,default=extracted from version"`
-	Version         string    `yaml:"version" json:"version" jsonschema:"title=version,example=v1.0.2,example=2.0.1"`
-	VersionSchema   string    `yaml:"version_schema,omitempty" json:"version_schema,omitempty" jsonschema:"title=version schema,enum=semver,enum=none,default=semver"`
-	Release         string    `yaml:"release,omitempty" json:"release,omitempty" jsonschema:"title=version release,example=1"`
-	Prerelease      string    `yaml:"prerelease,omitempty" json:"prerelease,omitempty" jsonschema:"title=version prerelease,default=extracted from version"`
-	VersionMetadata string    `yaml:"version_metadata,omitempty" json:"version_metadata,omitempty" jsonschema:"title=version metadata,example=git"`
-	Section         string    `yaml:"section,omitempty" json:"section,omitempty" jsonschema:"title=package section,example=default"`
-	Priority        string    `yaml:"priority,omitempty" json:"priority,omitempty" jsonschema:"title=package priority,example=extra"`
-	Maintainer      string    `yaml:"maintainer,omitempty" json:"maintainer,omitempty" jsonschema:"title=package maintainer,example=me@example.com"`
-	Description     string    `yaml:"description,omitempty" json:"description,omitempty" jsonschema:"title=package description"`
-	Vendor          string    `yaml:"vendor,omitempty" json:"vendor,omitempty" jsonschema:"title=package vendor,example=MyCorp"`
-	Homepage        string    `yaml:"homepage,omitempty" json:"homepage,omitempty" jsonschema:"title=package homepage,example=https://example.com"`
-	License         string    `yaml:"license,omitempty" json:"license,omitempty" jsonschema:"title=package license,example=MIT"`
-	Changelog       string    `yaml:"changelog,omitempty" json:"changelog,omitempty" jsonschema:"title=package changelog,example=changelog.yaml,description=see https://github.com/goreleaser/chglog for more details"`
-	DisableGlobbing bool      `yaml:"disable_globbing,omitempty" json:"disable_globbing,omitempty" jsonschema:"title=whether to disable file globbing,default=false"`
-	MTime           time.Time `yaml:"mtime,omitempty" json:"mtime,omitempty" jsonschema:"title=time to set into the files generated by nFPM"`
-	Target          string    `yaml:"-" json:"-"`
-}
-
-func (i *Info) Validate() error {
-	return Validate(i)
-}
 
-// GetChangeLog parses the provided changelog file.
-func (i *Info) GetChangeLog() (log *chglog.PackageChangeLog, err error) {
-	// if the file does not exist chglog.Parse will just silently
-	// create an empty changelog but we should notify the user instead
-	if _, err = os.Stat(i.Changelog); errors.Is(err, fs.ErrNotExist) {
-		return nil, err
+	for _, content := range info.Contents {
+		if content.Type != files.TypeTemplate {
+			continue
+		}
+		if _, err := parseTemplate(content); err != nil {
+			if content.SkipIfMissing && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
 	}
 
-	entries, err := chglog.Parse(i.Changelog)
-	if err != nil {
-		return nil, err
+	for packager, p := range packagers {
+		cp := *info
+		cp.Contents = copyContents(info.Contents, "")
+		if err := applyConditions(&cp, packager, os.Getenv); err != nil {
+			return err
+		}
+		applyOnEmptyGlob(&cp)
+		contents, err := files.PrepareForPackager(
+			cp.Contents,
+			info.Umask,
+			packager,
+			info.DisableGlobbing,
+			info.MTime,
+		)
+		if err != nil {
+			return invalidContents(err)
+		}
+		if err := validateAlternatives(info.Alternatives, contents); err != nil {
+			return err
+		}
+		if p, ok := p.(PackagerWithValidation); ok {
+			cp.Contents = contents
+			if err := p.Validate(&cp); err != nil {
+				return err
+			}
+		}
 	}
 
-	return &chglog.PackageChangeLog{
-		Name:    i.Name,
-		Entries: entries,
-	}, nil
+	return nil
 }
 
-func (i *Info) parseSemver() {
-	// parse the version as a semver so we can properly split the parts
-	// and support proper ordering for both rpm and deb
-	if v, err := semver.NewVersion(i.Version); err == nil {
-		i.Version = fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch())
-		if i.Prerelease == "" {
-			i.Prerelease = v.Prerelease()
+// WithBaseDir resolves the relative paths of the files the info reads
+// against dir instead of the working directory, and returns the info: the
+// sources and manifests of the contents, the scripts, the changelog, the
+// signing keys and keyring, the passwd and group files, the temp dir and the
+// staging root.
+// Contents read from an FS or holding their Data, URL sources and the
+// targets of symlinks and hard links are left as is. It allows programs
+// building an info in code to package it the same way whatever their working
+// directory is.
+func WithBaseDir(info *Info, dir string) *Info {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) && !download.IsURL(*path) {
+			*path = filepath.Join(dir, *path)
 		}
+	}
 
-		if i.VersionMetadata == "" {
-			i.VersionMetadata = v.Metadata()
+	for _, path := range []*string{
+		&info.Changelog,
+		&info.PasswdFile,
+		&info.GroupFile,
+		&info.TempDir,
+		&info.StagingRoot,
+		&info.Keyring.KeyFile,
+		&info.Scripts.PreInstall,
+		&info.Scripts.PostInstall,
+		&info.Scripts.PreRemove,
+		&info.Scripts.PostRemove,
+		&info.Deb.Scripts.Rules,
+		&info.Deb.Scripts.Templates,
+		&info.Deb.Scripts.Config,
+		&info.Deb.Signature.KeyFile,
+		&info.RPM.Scripts.PreTrans,
+		&info.RPM.Scripts.PostTrans,
+		&info.RPM.Scripts.Verify,
+		&info.RPM.Signature.KeyFile,
+		&info.APK.Scripts.PreUpgrade,
+		&info.APK.Scripts.PostUpgrade,
+		&info.APK.Triggers.Script,
+		&info.APK.Signature.KeyFile,
+		&info.ArchLinux.Scripts.PreUpgrade,
+		&info.ArchLinux.Scripts.PostUpgrade,
+	} {
+		resolve(path)
+	}
+	for i := range info.RPM.ConfigMigrations {
+		resolve(&info.RPM.ConfigMigrations[i].Script)
+	}
+	for _, srcs := range [][]string{
+		info.Completions.Bash,
+		info.Completions.Zsh,
+		info.Completions.Fish,
+		info.ManPages,
+		info.SystemdUnits,
+	} {
+		for i := range srcs {
+			resolve(&srcs[i])
 		}
 	}
-}
 
-// Overridables contain the field which are overridable in a package.
-type Overridables struct {
-	Replaces   []string       `yaml:"replaces,omitempty" json:"replaces,omitempty" jsonschema:"title=replaces directive,example=nfpm"`
-	Provides   []string       `yaml:"provides,omitempty" json:"provides,omitempty" jsonschema:"title=provides directive,example=nfpm"`
-	Depends    []string       `yaml:"depends,omitempty" json:"depends,omitempty" jsonschema:"title=depends directive,example=nfpm"`
-	Recommends []string       `yaml:"recommends,omitempty" json:"recommends,omitempty" jsonschema:"title=recommends directive,example=nfpm"`
-	Suggests   []string       `yaml:"suggests,omitempty" json:"suggests,omitempty" jsonschema:"title=suggests directive,example=nfpm"`
-	Conflicts  []string       `yaml:"conflicts,omitempty" json:"conflicts,omitempty" jsonschema:"title=conflicts directive,example=nfpm"`
-	Contents   files.Contents `yaml:"contents,omitempty" json:"contents,omitempty" jsonschema:"title=files to add to the package"`
-	Umask      os.FileMode    `yaml:"umask,omitempty" json:"umask,omitempty" jsonschema:"title=umask for file contents,example=112"`
-	Scripts    Scripts        `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=scripts to execute"`
-	RPM        RPM            `yaml:"rpm,omitempty" json:"rpm,omitempty" jsonschema:"title=rpm-specific settings"`
-	Deb        Deb            `yaml:"deb,omitempty" json:"deb,omitempty" jsonschema:"title=deb-specific settings"`
-	APK        APK            `yaml:"apk,omitempty" json:"apk,omitempty" jsonschema:"title=apk-specific settings"`
-	ArchLinux  ArchLinux      `yaml:"archlinux,omitempty" json:"archlinux,omitempty" jsonschema:"title=archlinux-specific settings"`
-}
-
-type ArchLinux struct {
-	Pkgbase  string           `yaml:"pkgbase,omitempty" json:"pkgbase,omitempty" jsonschema:"title=explicitly specify the name used to refer to a split package, defaults to name"`
-	Arch     string           `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in archlinux nomenclature"`
-	Packager string           `yaml:"packager,omitempty" json:"packager,omitempty" jsonschema:"title=organization that packaged the software"`
-	Scripts  ArchLinuxScripts `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=archlinux-specific scripts"`
-}
-
-type ArchLinuxScripts struct {
-	PreUpgrade  string `yaml:"preupgrade,omitempty" json:"preupgrade,omitempty" jsonschema:"title=preupgrade script"`
-	PostUpgrade string `yaml:"postupgrade,omitempty" json:"postupgrade,omitempty" jsonschema:"title=postupgrade script"`
+	for _, content := range info.Contents {
+		if content.FS != nil || content.Data != nil {
+			continue
+		}
+		resolve(&content.Manifest)
+		switch content.Type {
+		case files.TypeSymlink, files.TypeHardlink, files.TypeDir, files.TypeImplicitDir,
+			files.TypeMergeDir, files.TypeRPMGhost:
+			continue
+		}
+		resolve(&content.Source)
+		for i := range content.Sources {
+			resolve(&content.Sources[i])
+		}
+	}
+	return info
 }
 
-// RPM is custom configs that are only available on RPM packages.
-type RPM struct {
-	Arch        string       `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in rpm nomenclature"`
-	Scripts     RPMScripts   `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=rpm-specific scripts"`
-	Group       string       `yaml:"group,omitempty" json:"group,omitempty" jsonschema:"title=package group,example=Unspecified"`
-	Summary     string       `yaml:"summary,omitempty" json:"summary,omitempty" jsonschema:"title=package summary"`
-	Compression string       `yaml:"compression,omitempty" json:"compression,omitempty" jsonschema:"title=compression algorithm to be used,enum=gzip,enum=lzma,enum=xz,default=gzip:-1"`
-	Signature   RPMSignature `yaml:"signature,omitempty" json:"signature,omitempty" jsonschema:"title=rpm signature"`
-	Packager    string       `yaml:"packager,omitempty" json:"packager,omitempty" jsonschema:"title=organization that actually packaged the software"`
-	Prefixes    []string     `yaml:"prefixes,omitempty" json:"prefixes,omitempty" jsonschema:"title=Prefixes for relocatable packages"`
+// Builder builds an Info in code, one content or dependency at a time, see
+// NewBuilder. Its methods return the builder, so that calls can be chained,
+// and the mistakes they detect are returned by Build.
+type Builder struct {
+	info Info
+	errs []error
 }
 
-// RPMScripts represents scripts only available on RPM packages.
-type RPMScripts struct {
-	PreTrans  string `yaml:"pretrans,omitempty" json:"pretrans,omitempty" jsonschema:"title=pretrans script"`
-	PostTrans string `yaml:"posttrans,omitempty" json:"posttrans,omitempty" jsonschema:"title=posttrans script"`
-	Verify    string `yaml:"verify,omitempty" json:"verify,omitempty" jsonschema:"title=verify script"`
+// NewBuilder returns a builder of the info of the given package.
+func NewBuilder(name, version string) *Builder {
+	return &Builder{info: Info{Name: name, Version: version}}
 }
 
-type PackageSignature struct {
-	// PGP secret key, can be ASCII-armored
-	KeyFile       string  `yaml:"key_file,omitempty" json:"key_file,omitempty" jsonschema:"title=key file,example=key.gpg"`
-	KeyID         *string `yaml:"key_id,omitempty" json:"key_id,omitempty" jsonschema:"title=key id,example=bc8acdd415bd80b3"`
-	KeyPassphrase string  `yaml:"-" json:"-"` // populated from environment variable
-	// SignFn, if set, will be called with the package-specific data to sign.
-	// For deb and rpm packages, data is the full package content.
-	// For apk packages, data is the SHA1 digest of control tgz.
-	//
-	// This allows for signing implementations other than using a local file
-	// (for example using a remote signer like KMS).
-	SignFn func(data io.Reader) ([]byte, error) `yaml:"-" json:"-"` // populated when used as a library
+// With calls fn with the info being built, to set the fields the builder has
+// no method for.
+func (b *Builder) With(fn func(info *Info)) *Builder {
+	fn(&b.info)
+	return b
 }
 
-type RPMSignature struct {
-	PackageSignature `yaml:",inline" json:",inline"`
+// Arch sets the architecture of the package.
+func (b *Builder) Arch(arch string) *Builder {
+	b.info.Arch = arch
+	return b
 }
 
-type APK struct {
-	Arch      string       `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in apk nomenclature"`
-	Signature APKSignature `yaml:"signature,omitempty" json:"signature,omitempty" jsonschema:"title=apk signature"`
-	Scripts   APKScripts   `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=apk scripts"`
+// Maintainer sets the maintainer of the package.
+func (b *Builder) Maintainer(maintainer string) *Builder {
+	b.info.Maintainer = maintainer
+	return b
 }
 
-type APKSignature struct {
-	PackageSignature `yaml:",inline" json:",inline"`
-	// defaults to <maintainer email>.rsa.pub
-	KeyName string `yaml:"key_name,omitempty" json:"key_name,omitempty" jsonschema:"title=key name,example=origin,default=maintainer_email.rsa.pub"`
+// Description sets the description of the package.
+func (b *Builder) Description(description string) *Builder {
+	b.info.Description = description
+	return b
 }
 
-type APKScripts struct {
-	PreUpgrade  string `yaml:"preupgrade,omitempty" json:"preupgrade,omitempty" jsonschema:"title=pre upgrade script"`
-	PostUpgrade string `yaml:"postupgrade,omitempty" json:"postupgrade,omitempty" jsonschema:"title=post upgrade script"`
+// AddFile adds the file, or the files matching the glob, at src to the
+// package at dst.
+func (b *Builder) AddFile(src, dst string) *Builder {
+	return b.AddContent(&files.Content{Source: src, Destination: dst})
 }
 
-// Deb is custom configs that are only available on deb packages.
-type Deb struct {
-	Arch        string            `yaml:"arch,omitempty" json:"arch,omitempty" jsonschema:"title=architecture in deb nomenclature"`
-	Scripts     DebScripts        `yaml:"scripts,omitempty" json:"scripts,omitempty" jsonschema:"title=scripts"`
-	Triggers    DebTriggers       `yaml:"triggers,omitempty" json:"triggers,omitempty" jsonschema:"title=triggers"`
-	Breaks      []string          `yaml:"breaks,omitempty" json:"breaks,omitempty" jsonschema:"title=breaks"`
-	Signature   DebSignature      `yaml:"signature,omitempty" json:"signature,omitempty" jsonschema:"title=signature"`
-	Compression string            `yaml:"compression,omitempty" json:"compression,omitempty" jsonschema:"title=compression algorithm to be used,enum=gzip,enum=xz,enum=none,default=gzip"`
-	Fields      map[string]string `yaml:"fields,omitempty" json:"fields,omitempty" jsonschema:"title=fields"`
-	Predepends  []string          `yaml:"predepends,omitempty" json:"predepends,omitempty" jsonschema:"title=predepends directive,example=nfpm"`
+// AddConfig adds the config file at src to the package at dst.
+func (b *Builder) AddConfig(src, dst string) *Builder {
+	return b.AddContent(&files.Content{Source: src, Destination: dst, Type: files.TypeConfig})
 }
 
-type DebSignature struct {
-	PackageSignature `yaml:",inline" json:",inline"`
-	// debsign, or dpkg-sig (defaults to debsign)
-	Method string `yaml:"method,omitempty" json:"method,omitempty" jsonschema:"title=method role,enum=debsign,enum=dpkg-sig,default=debsign"`
-	// origin, maint or archive (defaults to origin)
-	Type   string `yaml:"type,omitempty" json:"type,omitempty" jsonschema:"title=signer role,enum=origin,enum=maint,enum=archive,default=origin"`
-	Signer string `yaml:"signer,omitempty" json:"signer,omitempty" jsonschema:"title=signer"`
+// AddSymlink adds a symlink to target to the package at dst.
+func (b *Builder) AddSymlink(target, dst string) *Builder {
+	return b.AddContent(&files.Content{Source: target, Destination: dst, Type: files.TypeSymlink})
 }
 
-// DebTriggers contains triggers only available for deb packages.
-// https://wiki.debian.org/DpkgTriggers
-// https://man7.org/linux/man-pages/man5/deb-triggers.5.html
-type DebTriggers struct {
-	Interest        []string `yaml:"interest,omitempty" json:"interest,omitempty" jsonschema:"title=interest"`
-	InterestAwait   []string `yaml:"interest_await,omitempty" json:"interest_await,omitempty" jsonschema:"title=interest await"`
-	InterestNoAwait []string `yaml:"interest_noawait,omitempty" json:"interest_noawait,omitempty" jsonschema:"title=interest noawait"`
-	Activate        []string `yaml:"activate,omitempty" json:"activate,omitempty" jsonschema:"title=activate"`
-	ActivateAwait   []string `yaml:"activate_await,omitempty" json:"activate_await,omitempty" jsonschema:"title=activate await"`
-	ActivateNoAwait []string `yaml:"activate_noawait,omitempty" json:"activate_noawait,omitempty" jsonschema:"title=activate noawait"`
+// AddDir adds the directory dst to the package.
+func (b *Builder) AddDir(dst string) *Builder {
+	return b.AddContent(&files.Content{Destination: dst, Type: files.TypeDir})
 }
 
-// DebScripts is scripts only available on deb packages.
-type DebScripts struct {
-	Rules     string `yaml:"rules,omitempty" json:"rules,omitempty" jsonschema:"title=rules"`
-	Templates string `yaml:"templates,omitempty" json:"templates,omitempty" jsonschema:"title=templates"`
-	Config    string `yaml:"config,omitempty" json:"config,omitempty" jsonschema:"title=config"`
+// AddContent adds the content to the package. It must have a destination
+// and, unless it is a directory or a ghost file, or holds its Data, a source.
+func (b *Builder) AddContent(content *files.Content) *Builder {
+	switch {
+	case content.Destination == "":
+		b.errs = append(b.errs, fmt.Errorf("adding %s: %w", content, missingField("dst")))
+	case content.Source == "" && len(content.Sources) == 0 && content.Manifest == "" && content.Data == nil &&
+		content.Type != files.TypeDir && content.Type != files.TypeRPMGhost:
+		b.errs = append(b.errs, fmt.Errorf("adding %s: %w", content, missingField("src")))
+	}
+	b.info.Contents = append(b.info.Contents, content)
+	return b
 }
 
-// Scripts contains information about maintainer scripts for packages.
-type Scripts struct {
-	PreInstall  string `yaml:"preinstall,omitempty" json:"preinstall,omitempty" jsonschema:"title=pre install"`
-	PostInstall string `yaml:"postinstall,omitempty" json:"postinstall,omitempty" jsonschema:"title=post install"`
-	PreRemove   string `yaml:"preremove,omitempty" json:"preremove,omitempty" jsonschema:"title=pre remove"`
-	PostRemove  string `yaml:"postremove,omitempty" json:"postremove,omitempty" jsonschema:"title=post remove"`
+// DependsOn adds dependencies to the package, such as `foo >= 1`. The
+// dependencies on the same package must be satisfiable together.
+func (b *Builder) DependsOn(deps ...string) *Builder {
+	b.info.Depends = append(b.info.Depends, deps...)
+	if err := validateDependencies(&b.info, versionComparator("")); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
 }
 
-// ErrFieldEmpty happens when some required field is empty.
-type ErrFieldEmpty struct {
-	field string
+// Conflicts adds the packages the package conflicts with.
+func (b *Builder) Conflicts(deps ...string) *Builder {
+	b.info.Conflicts = append(b.info.Conflicts, deps...)
+	if err := validateDependencies(&b.info, versionComparator("")); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
 }
 
-func (e ErrFieldEmpty) Error() string {
-	return fmt.Sprintf("package %s must be provided", e.field)
+// Provides adds the packages the package provides.
+func (b *Builder) Provides(deps ...string) *Builder {
+	b.info.Provides = append(b.info.Provides, deps...)
+	return b
 }
 
-// PrepareForPackager validates the configuration for the given packager and
-// prepares the contents for said packager.
-func PrepareForPackager(info *Info, packager string) (err error) {
-	if info.Name == "" {
-		return ErrFieldEmpty{"name"}
-	}
-
-	if info.Arch == "" &&
-		((packager == "deb" && info.Deb.Arch == "") ||
-			(packager == "rpm" && info.RPM.Arch == "") ||
-			(packager == "apk" && info.APK.Arch == "")) {
-		return ErrFieldEmpty{"arch"}
-	}
-	if info.Version == "" {
-		return ErrFieldEmpty{"version"}
-	}
-
-	info.Contents, err = files.PrepareForPackager(
-		info.Contents,
-		info.Umask,
-		packager,
-		info.DisableGlobbing,
-		info.MTime,
-	)
-
-	return err
+// Replaces adds the packages the package replaces.
+func (b *Builder) Replaces(deps ...string) *Builder {
+	b.info.Replaces = append(b.info.Replaces, deps...)
+	return b
 }
 
-// Validate the given Info and returns an error if it is invalid. Validate will
-// no change the info's contents.
-func Validate(info *Info) (err error) {
-	if info.Name == "" {
-		return ErrFieldEmpty{"name"}
+// Build returns the info built, with its defaults set, as Parse returns it
+// for the same configuration. It fails with all the mistakes the methods of
+// the builder detected, or if the info does not pass Validate.
+func (b *Builder) Build() (*Info, error) {
+	if len(b.errs) > 0 {
+		return nil, errors.Join(b.errs...)
 	}
-	if info.Arch == "" && (info.Deb.Arch == "" || info.RPM.Arch == "" || info.APK.Arch == "") {
-		return ErrFieldEmpty{"arch"}
-	}
-	if info.Version == "" {
-		return ErrFieldEmpty{"version"}
-	}
-
-	for packager := range packagers {
-		_, err := files.PrepareForPackager(
-			info.Contents,
-			info.Umask,
-			packager,
-			info.DisableGlobbing,
-			info.MTime,
-		)
-		if err != nil {
-			return err
+	info := WithDefaults(b.info.Copy())
+	// Parse always sets the key ids, empty if unset, which is the same as
+	// not setting them.
+	for _, keyID := range []**string{&info.Deb.Signature.KeyID, &info.RPM.Signature.KeyID, &info.APK.Signature.KeyID} {
+		if *keyID == nil {
+			*keyID = pointer.ToString("")
 		}
 	}
-
-	return nil
+	if err := Validate(info.Copy()); err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
 // WithDefaults set some sane defaults into the given Info.
@@ -531,6 +4910,9 @@ func WithDefaults(info *Info) *Info {
 			"hardfloat", "",
 		).Replace(info.Arch)
 	}
+	if info.Arch == "arm" && validGoarm(info.Goarm) {
+		info.Arch = "arm" + info.Goarm
+	}
 	if info.Version == "" {
 		info.Version = "v0.0.0-rc0"
 	}
@@ -568,3 +4950,18 @@ func (s *ErrSigningFailure) Error() string {
 func (s *ErrSigningFailure) Unwarp() error {
 	return s.Err
 }
+
+// ErrVerificationFailure happens when a package read back with Info.SelfVerify
+// is not consistent.
+type ErrVerificationFailure struct {
+	Path string
+	Err  error
+}
+
+func (e *ErrVerificationFailure) Error() string {
+	return fmt.Sprintf("verifying %s: %v", e.Path, e.Err)
+}
+
+func (e *ErrVerificationFailure) Unwrap() error {
+	return e.Err
+}
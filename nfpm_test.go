@@ -1,20 +1,51 @@
 package nfpm_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"net/mail"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/apk"
+	"github.com/goreleaser/nfpm/v2/arch"
+	"github.com/goreleaser/nfpm/v2/deb"
 	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/expr"
+	"github.com/goreleaser/nfpm/v2/internal/glob"
+	"github.com/goreleaser/nfpm/v2/internal/maps"
+	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+	"github.com/goreleaser/nfpm/v2/rpm"
 	"github.com/stretchr/testify/require"
 )
 
+var update = flag.Bool("update", false, "update .golden files")
+
 var mtime = time.Date(2023, 11, 5, 23, 15, 17, 0, time.UTC)
 
 func TestRegister(t *testing.T) {
@@ -39,6 +70,65 @@ func TestGet(t *testing.T) {
 	require.Equal(t, pkgr, got)
 }
 
+func TestFormats(t *testing.T) {
+	nfpm.RegisterPackager("apk", apk.Default)
+	nfpm.RegisterPackager("archlinux", arch.Default)
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+	nfpm.RegisterPackager("TestFormats", &fakePackager{})
+
+	formats := map[string]nfpm.FormatInfo{}
+	var names []string
+	for _, format := range nfpm.Formats() {
+		formats[format.Name] = format
+		names = append(names, format.Name)
+	}
+	require.True(t, slices.IsSorted(names), names)
+
+	require.Equal(t, nfpm.FormatInfo{
+		Name:      "deb",
+		Extension: ".deb",
+		Verify:    true,
+		Resign:    true,
+		Capabilities: nfpm.Capabilities{
+			Compressions:     []string{"gzip", "xz", "zstd", "none"},
+			Signing:          true,
+			WeakDependencies: true,
+			Triggers:         true,
+		},
+	}, formats["deb"])
+	require.Equal(t, nfpm.FormatInfo{
+		Name:      "rpm",
+		Extension: ".rpm",
+		Verify:    true,
+		Resign:    true,
+		Capabilities: nfpm.Capabilities{
+			Compressions:     []string{"gzip", "lzma", "xz", "zstd"},
+			Signing:          true,
+			WeakDependencies: true,
+		},
+	}, formats["rpm"])
+	require.Equal(t, nfpm.FormatInfo{
+		Name:      "apk",
+		Extension: ".apk",
+		Verify:    true,
+		Resign:    true,
+		Capabilities: nfpm.Capabilities{
+			Compressions: []string{"gzip"},
+			Signing:      true,
+			Triggers:     true,
+		},
+	}, formats["apk"])
+	require.Equal(t, nfpm.FormatInfo{
+		Name:         "archlinux",
+		Extension:    ".pkg.tar.zst",
+		Capabilities: nfpm.Capabilities{Compressions: []string{"zst", "xz", "gz", "none"}},
+	}, formats["archlinux"])
+
+	// packagers without capabilities are listed as well
+	require.Equal(t, nfpm.FormatInfo{Name: "TestFormats"}, formats["TestFormats"])
+}
+
 func TestDefaultsVersion(t *testing.T) {
 	info := nfpm.WithDefaults(&nfpm.Info{
 		Version:       "v1.0.0",
@@ -195,6 +285,103 @@ func TestPrepareForPackager(t *testing.T) {
 		require.Equal(t, "root", aDir.FileInfo.Group)
 	})
 
+	t.Run("escaping symlinks", func(t *testing.T) {
+		makeinfo := func() *nfpm.Info {
+			return &nfpm.Info{
+				Name:    "as",
+				Arch:    "asd",
+				Version: "1.2.3",
+				Overridables: nfpm.Overridables{
+					Contents: []*files.Content{
+						{
+							Source:      "/home/builder/foo.conf",
+							Destination: "/etc/foo.conf",
+							Type:        files.TypeSymlink,
+						},
+					},
+				},
+			}
+		}
+		require.NoError(t, nfpm.PrepareForPackager(makeinfo(), ""))
+
+		info := makeinfo()
+		info.DisallowEscapingSymlinks = true
+		err := nfpm.PrepareForPackager(info, "")
+		require.ErrorIs(t, err, files.ErrEscapingSymlink)
+	})
+
+	t.Run("static ownership", func(t *testing.T) {
+		makeinfo := func() *nfpm.Info {
+			return &nfpm.Info{
+				Name:    "as",
+				Arch:    "asd",
+				Version: "1.2.3",
+				Overridables: nfpm.Overridables{
+					Contents: []*files.Content{
+						{
+							Source:      "./testdata/contents.yaml",
+							Destination: "/etc/asd.yaml",
+							FileInfo: &files.ContentFileInfo{
+								Owner: "1000",
+								Group: "1000",
+							},
+						},
+					},
+				},
+			}
+		}
+		require.NoError(t, nfpm.PrepareForPackager(makeinfo(), ""))
+
+		info := makeinfo()
+		info.StaticOwnership = true
+		err := nfpm.PrepareForPackager(info, "")
+		require.ErrorIs(t, err, files.ErrNumericOwnership)
+	})
+
+	t.Run("non root ownership", func(t *testing.T) {
+		makeinfo := func(policy string) *nfpm.Info {
+			return &nfpm.Info{
+				Name:             "as",
+				Arch:             "asd",
+				Version:          "1.2.3",
+				NonRootOwnership: policy,
+				// testdata/fake is a script without a shebang
+				SuppressLints: []string{"script-shebang"},
+				Overridables: nfpm.Overridables{
+					Contents: []*files.Content{
+						{
+							Source:      "./testdata/fake",
+							Destination: "/usr/bin/fake",
+							FileInfo:    &files.ContentFileInfo{Owner: "app"},
+						},
+						{
+							Destination: "/var/lib/app",
+							Type:        files.TypeDir,
+							FileInfo:    &files.ContentFileInfo{Owner: "app", Group: "app"},
+						},
+					},
+				},
+			}
+		}
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		require.NoError(t, nfpm.PrepareForPackager(makeinfo(""), ""))
+		require.Empty(t, w.String())
+
+		require.NoError(t, nfpm.PrepareForPackager(makeinfo(nfpm.NonRootOwnershipWarn), ""))
+		require.Equal(t, "/usr/bin/fake: owner app: owned by non-root in a system directory\n", w.String())
+
+		err := nfpm.PrepareForPackager(makeinfo(nfpm.NonRootOwnershipError), "")
+		require.ErrorIs(t, err, files.ErrNonRootOwnership)
+
+		err = nfpm.PrepareForPackager(makeinfo("fail"), "")
+		require.EqualError(t, err, `invalid non_root_ownership: "fail"`)
+		requireCode(t, err, "invalid_non_root_ownership")
+	})
+
 	t.Run("config", func(t *testing.T) {
 		require.NoError(t, nfpm.PrepareForPackager(&nfpm.Info{
 			Name:    "as",
@@ -236,6 +423,34 @@ func TestValidate(t *testing.T) {
 		require.Len(t, info.Overridables.Contents, 2)
 	})
 
+	t.Run("invalid template", func(t *testing.T) {
+		err := nfpm.Validate(&nfpm.Info{
+			Name:    "as",
+			Arch:    "asd",
+			Version: "1.2.3",
+			Overridables: nfpm.Overridables{
+				Contents: []*files.Content{
+					{
+						Source:      "./testdata/templates/invalid.conf.tmpl",
+						Destination: "/etc/asd.conf",
+						Type:        files.TypeTemplate,
+					},
+				},
+			},
+		})
+		require.EqualError(t, err, "invalid template: template: ./testdata/templates/invalid.conf.tmpl:3: unclosed action started at ./testdata/templates/invalid.conf.tmpl:2")
+	})
+
+	t.Run("invalid content order", func(t *testing.T) {
+		err := nfpm.Validate(&nfpm.Info{
+			Name:         "as",
+			Arch:         "asd",
+			Version:      "1.2.3",
+			ContentOrder: "random",
+		})
+		require.EqualError(t, err, `invalid content order: "random"`)
+	})
+
 	t.Run("config", func(t *testing.T) {
 		require.NoError(t, nfpm.Validate(&nfpm.Info{
 			Name:    "as",
@@ -273,6 +488,294 @@ func TestValidateError(t *testing.T) {
 	}
 }
 
+func TestValidationErrors(t *testing.T) {
+	valid := func() *nfpm.Info {
+		return &nfpm.Info{
+			Name:    "as",
+			Arch:    "asd",
+			Version: "1.2.3",
+		}
+	}
+
+	t.Run("missing field", func(t *testing.T) {
+		info := valid()
+		info.Version = ""
+		err := nfpm.Validate(info)
+		require.Equal(t, "version", requireCode(t, err, "missing_field").Field)
+	})
+
+	t.Run("invalid content order", func(t *testing.T) {
+		info := valid()
+		info.ContentOrder = "random"
+		err := nfpm.Validate(info)
+		require.EqualError(t, err, `invalid content order: "random"`)
+		require.Equal(t, "content_order", requireCode(t, err, "invalid_content_order").Field)
+	})
+
+	t.Run("invalid arch", func(t *testing.T) {
+		info := valid()
+		info.Arch = "amd 64"
+		err := nfpm.Validate(info)
+		require.EqualError(t, err, `invalid arch: "amd 64"`)
+		require.Equal(t, "arch", requireCode(t, err, "invalid_arch").Field)
+
+		info = valid()
+		info.Deb.Arch = "arm/v7"
+		err = nfpm.PrepareForPackager(info, "deb")
+		require.EqualError(t, err, `invalid arch: "arm/v7"`)
+		require.Equal(t, "deb.arch", requireCode(t, err, "invalid_arch").Field)
+	})
+
+	t.Run("empty contents", func(t *testing.T) {
+		info := valid()
+		info.Contents = []*files.Content{
+			{Destination: "/etc/foo", Type: files.TypeDir},
+			{Type: files.TypeConfig},
+		}
+		err := nfpm.Validate(info)
+		require.Equal(t, "contents[1]", requireCode(t, err, "empty_contents").Field)
+
+		err = nfpm.PrepareForPackager(info, "deb")
+		require.Equal(t, "contents[1]", requireCode(t, err, "empty_contents").Field)
+	})
+
+	t.Run("invalid script shell", func(t *testing.T) {
+		for _, shell := range []string{"sh", "/bin/sh -e"} {
+			info := valid()
+			info.ScriptShell = shell
+			err := nfpm.Validate(info)
+			require.ErrorContains(t, err, strconv.Quote(shell))
+			requireCode(t, err, "invalid_script_shell")
+		}
+	})
+
+	t.Run("invalid on empty glob", func(t *testing.T) {
+		info := valid()
+		info.OnEmptyGlob = "ignore"
+		err := nfpm.Validate(info)
+		require.EqualError(t, err, `invalid on_empty_glob: "ignore"`)
+		requireCode(t, err, "invalid_on_empty_glob")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		info := valid()
+		info.Contents = []*files.Content{
+			{
+				Source:      "./testdata/templates/invalid.conf.tmpl",
+				Destination: "/etc/asd.conf",
+				Type:        files.TypeTemplate,
+			},
+		}
+		err := nfpm.Validate(info)
+		require.ErrorContains(t, err, "invalid template: ")
+		require.Equal(t, "contents", requireCode(t, err, "invalid_template").Field)
+	})
+
+	t.Run("invalid contents", func(t *testing.T) {
+		info := valid()
+		info.Contents = []*files.Content{
+			{Source: "./testdata/contents.yaml", Destination: "/etc/asd.yaml"},
+			{Source: "./testdata/overrides.yaml", Destination: "/etc/asd.yaml"},
+		}
+		err := nfpm.Validate(info)
+		require.ErrorIs(t, err, files.ErrContentCollision)
+		requireCode(t, err, "invalid_contents")
+
+		err = nfpm.PrepareForPackager(info, "deb")
+		require.ErrorIs(t, err, files.ErrContentCollision)
+		require.Equal(t, "contents", requireCode(t, err, "invalid_contents").Field)
+	})
+}
+
+func requireCode(tb testing.TB, err error, code string) nfpm.ValidationError {
+	tb.Helper()
+	var verr nfpm.ValidationError
+	require.ErrorAs(tb, err, &verr)
+	require.Equal(tb, code, verr.Code)
+	return verr
+}
+
+func TestValidateFiles(t *testing.T) {
+	newInfo := func() *nfpm.Info {
+		return &nfpm.Info{
+			Name:      "foo",
+			Arch:      "amd64",
+			Version:   "1.2.3",
+			Changelog: "./testdata/changelog.yaml",
+			Overridables: nfpm.Overridables{
+				Scripts: nfpm.Scripts{
+					PreInstall:  "./testdata/scripts/preinstall.sh",
+					PostInstall: "./testdata/scripts/postinstall.sh",
+				},
+				RPM: nfpm.RPM{
+					Scripts: nfpm.RPMScripts{Verify: "./testdata/scripts/verify.sh"},
+				},
+				APK: nfpm.APK{
+					Triggers: nfpm.APKTriggers{Script: "./testdata/scripts/trigger.sh"},
+				},
+			},
+		}
+	}
+
+	t.Run("present", func(t *testing.T) {
+		require.NoError(t, nfpm.Validate(newInfo()))
+	})
+
+	for field, set := range map[string]func(info *nfpm.Info, path string){
+		"scripts.postinstall": func(info *nfpm.Info, path string) { info.Scripts.PostInstall = path },
+		"changelog":           func(info *nfpm.Info, path string) { info.Changelog = path },
+		"deb.scripts.rules":   func(info *nfpm.Info, path string) { info.Deb.Scripts.Rules = path },
+		"rpm.scripts.verify":  func(info *nfpm.Info, path string) { info.RPM.Scripts.Verify = path },
+		"apk.triggers.script": func(info *nfpm.Info, path string) { info.APK.Triggers.Script = path },
+		"archlinux.scripts.preupgrade": func(info *nfpm.Info, path string) {
+			info.ArchLinux.Scripts.PreUpgrade = path
+		},
+	} {
+		t.Run(field, func(t *testing.T) {
+			info := newInfo()
+			set(info, "./testdata/scripts/postinstal.sh")
+			err := nfpm.Validate(info)
+			require.EqualError(t, err, field+": file not found: ./testdata/scripts/postinstal.sh")
+			require.ErrorIs(t, err, fs.ErrNotExist)
+			requireCode(t, err, "missing_file")
+		})
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		info := newInfo()
+		info.Scripts.PreRemove = "./testdata/scripts"
+		err := nfpm.Validate(info)
+		require.EqualError(t, err, "scripts.preremove: file not readable: ./testdata/scripts: is a directory")
+		requireCode(t, err, "missing_file")
+	})
+}
+
+func TestGoarm(t *testing.T) {
+	info := nfpm.WithDefaults(&nfpm.Info{Arch: "arm", Goarm: "7"})
+	require.Equal(t, "arm7", info.Arch)
+
+	info = nfpm.WithDefaults(&nfpm.Info{Arch: "arm64", Goarm: "7"})
+	require.Equal(t, "arm64", info.Arch)
+
+	for _, tc := range []struct {
+		arch, goarm string
+		err         string
+	}{
+		{arch: "arm", goarm: "7"},
+		{arch: "arm6", goarm: "6"},
+		{arch: "arm", goarm: "8", err: "invalid goarm: 8: must be one of 5, 6 or 7"},
+		{arch: "amd64", goarm: "7", err: "invalid goarm: 7: can only be used with arch arm, got amd64"},
+		{arch: "arm5", goarm: "7", err: "invalid goarm: 7: can only be used with arch arm, got arm5"},
+	} {
+		err := nfpm.Validate(&nfpm.Info{
+			Name:    "as",
+			Arch:    tc.arch,
+			Goarm:   tc.goarm,
+			Version: "1.2.3",
+		})
+		if tc.err == "" {
+			require.NoError(t, err)
+			continue
+		}
+		require.EqualError(t, err, tc.err)
+		require.Equal(t, "goarm", requireCode(t, err, "invalid_goarm").Field)
+	}
+}
+
+func TestCategory(t *testing.T) {
+	info := &nfpm.Info{
+		Name:     "as",
+		Arch:     "asd",
+		Version:  "1.2.3",
+		Category: "utils",
+	}
+	require.NoError(t, nfpm.Validate(info))
+	category, ok := info.ResolveCategory()
+	require.True(t, ok)
+	require.Equal(t, nfpm.Category{Section: "utils", Group: "Applications/System"}, category)
+
+	info.Category = "tools"
+	err := nfpm.Validate(info)
+	require.EqualError(t, err, `invalid category: "tools"`)
+	requireCode(t, err, "invalid_category")
+
+	info.Categories = map[string]nfpm.Category{"tools": {Section: "devel"}}
+	require.NoError(t, nfpm.Validate(info))
+	category, ok = info.ResolveCategory()
+	require.True(t, ok)
+	require.Equal(t, nfpm.Category{Section: "devel"}, category)
+
+	info.Category = ""
+	_, ok = info.ResolveCategory()
+	require.False(t, ok)
+}
+
+func TestKeyring(t *testing.T) {
+	const fingerprint = "866F6C83BAB3E49381ADE4C1BC8ACDD415BD80B3"
+
+	for _, tc := range []struct {
+		name    string
+		keyring nfpm.Keyring
+		err     string
+	}{
+		{
+			name:    "valid",
+			keyring: nfpm.Keyring{KeyFile: "keyring.asc", Keys: map[string]string{"deb": fingerprint, "rpm": "866F 6C83 BAB3 E493 81AD  E4C1 BC8A CDD4 15BD 80B3"}},
+		},
+		{
+			name:    "apk",
+			keyring: nfpm.Keyring{KeyFile: "keyring.asc", Keys: map[string]string{"apk": fingerprint}},
+			err:     "invalid keyring for apk: only deb and rpm packages can be signed from a keyring",
+		},
+		{
+			name:    "no key file",
+			keyring: nfpm.Keyring{Keys: map[string]string{"deb": fingerprint}},
+			err:     "invalid keyring for deb: key_file must be set",
+		},
+		{
+			name:    "key id",
+			keyring: nfpm.Keyring{KeyFile: "keyring.asc", Keys: map[string]string{"rpm": "bc8acdd415bd80b3"}},
+			err:     `invalid keyring for rpm: "bc8acdd415bd80b3" is not a valid fingerprint`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := nfpm.Validate(&nfpm.Info{
+				Name:    "as",
+				Arch:    "asd",
+				Version: "1.2.3",
+				Keyring: tc.keyring,
+			})
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.err)
+			requireCode(t, err, "invalid_keyring")
+		})
+	}
+
+	t.Run("applied to the packager signature", func(t *testing.T) {
+		info := &nfpm.Info{
+			Name:    "as",
+			Arch:    "asd",
+			Version: "1.2.3",
+			Keyring: nfpm.Keyring{
+				KeyFile: "keyring.asc",
+				Keys:    map[string]string{"deb": fingerprint, "rpm": fingerprint},
+			},
+		}
+		info.RPM.Signature.KeyFile = "rpm.asc"
+
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		require.Equal(t, "keyring.asc", info.Deb.Signature.KeyFile)
+		require.Equal(t, fingerprint, *info.Deb.Signature.KeyID)
+
+		require.NoError(t, nfpm.PrepareForPackager(info, "rpm"))
+		require.Equal(t, "rpm.asc", info.RPM.Signature.KeyFile)
+		require.Nil(t, info.RPM.Signature.KeyID)
+	})
+}
+
 func parseAndValidate(filename string) (nfpm.Config, error) {
 	config, err := nfpm.ParseFile(filename)
 	if err != nil {
@@ -292,6 +795,45 @@ func parseAndValidate(filename string) (nfpm.Config, error) {
 	return config, nil
 }
 
+func TestGetSortedChangeLog(t *testing.T) {
+	changelog := func(t *testing.T, content string) *nfpm.Info {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "changelog.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return &nfpm.Info{Name: "foo", Changelog: path}
+	}
+
+	t.Run("sorted", func(t *testing.T) {
+		info := &nfpm.Info{Name: "foo", Changelog: "./testdata/changelog_unsorted.yaml"}
+		log, err := info.GetSortedChangeLog("1.2.3-1", strings.Compare)
+		require.NoError(t, err)
+		require.Len(t, log.Entries, 8)
+		require.Equal(t, "2.0.0^git20240101-1", log.Entries[0].Semver)
+		require.Equal(t, "1.0.0-1", log.Entries[7].Semver)
+	})
+
+	t.Run("no date", func(t *testing.T) {
+		info := changelog(t, "- semver: 1.0.0\n  packager: foo\n")
+		_, err := info.GetSortedChangeLog("1.2.3-1", strings.Compare)
+		require.EqualError(t, err, `invalid changelog entry "1.0.0": no date`)
+		require.Equal(t, "changelog", requireCode(t, err, "invalid_changelog").Field)
+	})
+
+	t.Run("no version", func(t *testing.T) {
+		info := changelog(t, "- date: 2009-11-10T23:00:00Z\n- semver: 1.0.0\n  date: 2009-11-11T23:00:00Z\n")
+		log, err := info.GetSortedChangeLog("1.2.3-1", strings.Compare)
+		require.NoError(t, err)
+		require.Equal(t, "1.2.3-1", log.Entries[0].Semver)
+		require.Equal(t, "1.0.0", log.Entries[1].Semver)
+	})
+
+	t.Run("invalid date", func(t *testing.T) {
+		info := changelog(t, "- semver: 1.0.0\n  date: yesterday\n")
+		_, err := info.GetSortedChangeLog("1.2.3-1", strings.Compare)
+		require.ErrorContains(t, err, "error parsing")
+	})
+}
+
 func TestParseFile(t *testing.T) {
 	nfpm.ClearPackagers()
 	_, err := parseAndValidate("./testdata/overrides.yaml")
@@ -316,6 +858,203 @@ func TestParseFile(t *testing.T) {
 	require.Equal(t, "", config.APK.Signature.KeyFile)
 }
 
+func TestParseFileFormats(t *testing.T) {
+	expected, err := nfpm.ParseFile("./testdata/overrides.yaml")
+	require.NoError(t, err)
+
+	for _, path := range []string{"./testdata/overrides.toml", "./testdata/overrides.json"} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			config, err := nfpm.ParseFile(path)
+			require.NoError(t, err)
+			require.Equal(t, expected.Info, config.Info)
+		})
+	}
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("TEST_RELEASE_ENV_VAR", "1234")
+		config, err := nfpm.ParseFormatWithEnvMapping(strings.NewReader(`name = "foo"
+release = "${TEST_RELEASE_ENV_VAR}"
+`), nfpm.FormatTOML, os.Getenv)
+		require.NoError(t, err)
+		require.Equal(t, "1234", config.Release)
+	})
+
+	for format, data := range map[string]string{
+		nfpm.FormatYAML: "name: foo\nunknown: bar\n",
+		nfpm.FormatTOML: "name = \"foo\"\nunknown = \"bar\"\n",
+		nfpm.FormatJSON: `{"name": "foo", "unknown": "bar"}`,
+	} {
+		t.Run("unknown key "+format, func(t *testing.T) {
+			_, err := nfpm.ParseFormatWithEnvMapping(strings.NewReader(data), format, os.Getenv)
+			require.ErrorContains(t, err, "field unknown not found")
+		})
+	}
+
+	t.Run("extension", func(t *testing.T) {
+		require.Equal(t, nfpm.FormatTOML, nfpm.FormatFromPath("nfpm.TOML"))
+		require.Equal(t, nfpm.FormatJSON, nfpm.FormatFromPath("nfpm.json"))
+		require.Equal(t, nfpm.FormatYAML, nfpm.FormatFromPath("nfpm.yml"))
+		require.Equal(t, nfpm.FormatYAML, nfpm.FormatFromPath("nfpm.conf"))
+	})
+}
+
+func TestContentsInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+		return path
+	}
+	write("components/a.yaml", `contents:
+- src: a
+  dst: /usr/bin/a
+- dst: /etc/foo
+  type: dir
+`)
+	write("components/b.json", `{"contents": [{"src": "b", "dst": "/usr/bin/b", "packager": "deb"}, {"dst": "/etc/foo", "type": "dir"}]}`)
+	write("components/c.yaml", `contents:
+- src: other-b
+  dst: /usr/bin/b
+  packager: rpm
+`)
+
+	config, err := nfpm.ParseFile(write("nfpm.yaml", `name: foo
+contents:
+- src: foo
+  dst: /usr/bin/foo
+contents_include:
+- components/a.yaml
+- components/b.json
+- components/c.yaml
+`))
+	require.NoError(t, err)
+	var destinations []string
+	for _, content := range config.Contents {
+		destinations = append(destinations, content.Source+" "+content.Destination)
+	}
+	require.Equal(t, []string{
+		"foo /usr/bin/foo",
+		"a /usr/bin/a",
+		" /etc/foo",
+		"b /usr/bin/b",
+		" /etc/foo",
+		"other-b /usr/bin/b",
+	}, destinations)
+	require.Empty(t, config.ContentsInclude)
+
+	write("components/d.yaml", `contents:
+- src: other-a
+  dst: /usr/bin//a
+`)
+	_, err = nfpm.ParseFile(write("collision.yaml", `name: foo
+contents_include:
+- components/a.yaml
+- components/d.yaml
+`))
+	require.ErrorIs(t, err, files.ErrContentCollision)
+	requireCode(t, err, "contents_include_collision")
+	require.EqualError(t, err, "adding /usr/bin/a from components/d.yaml: already added by components/a.yaml: content collision")
+
+	_, err = nfpm.ParseFile(write("collision-config.yaml", `name: foo
+contents:
+- src: foo
+  dst: /usr/bin/a
+contents_include:
+- components/a.yaml
+`))
+	require.EqualError(t, err, "adding /usr/bin/a from components/a.yaml: already added by the config: content collision")
+
+	_, err = nfpm.ParseFile(write("missing.yaml", `name: foo
+contents_include:
+- components/missing.yaml
+`))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestParseJSON(t *testing.T) {
+	config, err := nfpm.ParseWithEnvMapping(strings.NewReader(`
+name: foo
+arch: arm64
+version: v1.2.3-rc1
+maintainer: Foo <foo@example.com>
+mtime: 2024-01-02T03:04:05Z
+depends: [bar, baz (>= 1.0)]
+provides: [qux]
+download:
+  retries: 3
+  timeout: 30s
+contents:
+  - src: ./testdata/whatever.conf
+    dst: /etc/foo/whatever.conf
+    type: config|noreplace
+    file_info:
+      mode: 0640
+      owner: foo
+  - src: ./testdata/something
+    dst: /usr/share/foo
+    type: tree
+    type_by_extension:
+      .conf: config
+scripts:
+  postinstall: ./testdata/scripts/postinstall.sh
+deb:
+  fields:
+    Bugs: https://example.com/issues
+rpm:
+  compression: zstd:3
+`), os.Getenv)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(config.Info)
+	require.NoError(t, err)
+	info, err := nfpm.ParseJSON(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, &config.Info, info)
+	require.NoError(t, nfpm.Validate(info))
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := nfpm.ParseJSON(strings.NewReader(`{"name": "foo", "unknown": "bar"}`))
+		require.ErrorContains(t, err, `unknown field "unknown"`)
+	})
+
+	t.Run("env and defaults", func(t *testing.T) {
+		t.Setenv("TEST_JSON_VERSION", "2.0.0")
+		info, err := nfpm.ParseJSON(strings.NewReader(`{"name": "foo", "version": "${TEST_JSON_VERSION}"}`))
+		require.NoError(t, err)
+		require.Equal(t, "2.0.0", info.Version)
+		require.Equal(t, "amd64", info.Arch)
+		require.Equal(t, "linux", info.Platform)
+	})
+
+	// the json and yaml keys of all the fields of the config must match, so
+	// that package specs use the keys of the configuration.
+	t.Run("keys", func(t *testing.T) {
+		seen := map[reflect.Type]bool{}
+		var walk func(typ reflect.Type)
+		walk = func(typ reflect.Type) {
+			for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+				typ = typ.Elem()
+			}
+			if typ.Kind() != reflect.Struct || seen[typ] || typ.PkgPath() == "time" {
+				return
+			}
+			seen[typ] = true
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if !field.IsExported() {
+					continue
+				}
+				yamlKey, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+				jsonKey, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				require.Equal(t, yamlKey, jsonKey, "%s.%s", typ, field.Name)
+				walk(field.Type)
+			}
+		}
+		walk(reflect.TypeOf(nfpm.Config{}))
+	})
+}
+
 func TestParseEnhancedFile(t *testing.T) {
 	config, err := parseAndValidate("./testdata/contents.yaml")
 	require.NoError(t, err)
@@ -595,3 +1334,3382 @@ func (*fakePackager) ConventionalFileName(_ *nfpm.Info) string {
 func (*fakePackager) Package(_ *nfpm.Info, _ io.Writer) error {
 	return nil
 }
+
+func TestPackageAll(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+	nfpm.RegisterPackager("apk", apk.Default)
+
+	config, err := nfpm.ParseFile("./testdata/overrides.yaml")
+	require.NoError(t, err)
+	config.Maintainer = "Foo <foo@bar>"
+	before, err := nfpm.ParseFile("./testdata/overrides.yaml")
+	require.NoError(t, err)
+	before.Maintainer = config.Maintainer
+
+	dir := t.TempDir()
+	targets, err := nfpm.PackageAll(&config, []string{"deb", "rpm", "apk"}, dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "foo_1.2.3_amd64.deb"),
+		filepath.Join(dir, "foo-1.2.3-1.x86_64.rpm"),
+		filepath.Join(dir, "foo_1.2.3_x86_64.apk"),
+	}, targets)
+	for _, target := range targets {
+		require.FileExists(t, target)
+	}
+
+	require.Equal(t, before.Info, config.Info)
+	require.Equal(t, before.Overrides, config.Overrides)
+}
+
+// countingFS counts how many times each file is opened.
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.mu.Unlock()
+	return c.FS.Open(name)
+}
+
+func (c *countingFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(c.FS, name)
+}
+
+func TestPackageAllReadsOnce(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+	nfpm.RegisterPackager("apk", apk.Default)
+
+	fsys := &countingFS{FS: os.DirFS("./testdata"), opens: map[string]int{}}
+	config := nfpm.Config{Info: nfpm.Info{
+		Name:       "foo",
+		Arch:       "amd64",
+		Version:    "1.0.0",
+		Maintainer: "Foo <foo@example.com>",
+		Overridables: nfpm.Overridables{Contents: files.Contents{
+			{Source: "whatever.conf", Destination: "/etc/foo/whatever.conf", FS: fsys},
+			{Source: "fake", Destination: "/usr/bin/fake", FS: fsys},
+		}},
+	}}
+	_, err := nfpm.PackageAll(&config, []string{"deb", "rpm", "apk"}, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"whatever.conf": 1, "fake": 1}, fsys.opens)
+
+	// the cache does not outlive the call
+	_, err = nfpm.PackageAll(&config, []string{"deb", "rpm", "apk"}, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"whatever.conf": 2, "fake": 2}, fsys.opens)
+}
+
+func TestPackageAllSizeParity(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+
+	big := filepath.Join(t.TempDir(), "big")
+	require.NoError(t, os.WriteFile(big, bytes.Repeat([]byte("a"), 64*1024), 0o644))
+
+	packageAll := func(t *testing.T, packager string) string {
+		t.Helper()
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		config := nfpm.Config{Info: nfpm.Info{
+			Name:                "foo",
+			Arch:                "amd64",
+			Version:             "1.0.0",
+			Maintainer:          "Foo <foo@example.com>",
+			SizeParityTolerance: 0.1,
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf"},
+				{Source: big, Destination: "/usr/share/foo/big", Packager: packager},
+			}},
+		}}
+		_, err := nfpm.PackageAll(&config, []string{"deb", "rpm"}, t.TempDir())
+		require.NoError(t, err)
+		return w.String()
+	}
+
+	t.Run("same contents", func(t *testing.T) {
+		require.Empty(t, packageAll(t, ""))
+	})
+
+	t.Run("dropped file", func(t *testing.T) {
+		out := packageAll(t, "rpm")
+		require.Contains(t, out, "installed sizes differ by")
+		require.Contains(t, out, "rpm reports")
+	})
+}
+
+func TestOnEmptyGlob(t *testing.T) {
+	info := func(policy string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:        "foo",
+			Arch:        "amd64",
+			Version:     "1.0.0",
+			OnEmptyGlob: policy,
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/*.nope", Destination: "/usr/share/foo/"},
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf"},
+			}},
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		require.ErrorAs(t, nfpm.PrepareForPackager(info(""), "deb"), &glob.ErrGlobNoMatch{})
+		require.ErrorAs(t, nfpm.PrepareForPackager(info(files.OnEmptyGlobError), "deb"), &glob.ErrGlobNoMatch{})
+	})
+
+	for _, policy := range []string{files.OnEmptyGlobWarn, files.OnEmptyGlobSkip} {
+		t.Run(policy, func(t *testing.T) {
+			var w bytes.Buffer
+			prevNoticer := warning.Noticer
+			t.Cleanup(func() { warning.Noticer = prevNoticer })
+			warning.Noticer = &w
+
+			info := info(policy)
+			require.NoError(t, nfpm.Validate(info))
+			require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+			require.True(t, info.Contents.ContainsDestination("/etc/foo/whatever.conf"))
+			if policy == files.OnEmptyGlobWarn {
+				require.Contains(t, w.String(), "no matching files, skipping")
+			} else {
+				require.Empty(t, w.String())
+			}
+		})
+	}
+
+	t.Run("content overrides the info", func(t *testing.T) {
+		info := info(files.OnEmptyGlobSkip)
+		info.Contents[0].OnEmptyGlob = files.OnEmptyGlobError
+		require.ErrorAs(t, nfpm.PrepareForPackager(info, "deb"), &glob.ErrGlobNoMatch{})
+	})
+}
+
+func TestPackageAllUnknownFormat(t *testing.T) {
+	config, err := nfpm.ParseFile("./testdata/overrides.yaml")
+	require.NoError(t, err)
+	_, err = nfpm.PackageAll(&config, []string{"TestPackageAllUnknownFormat"}, t.TempDir())
+	require.ErrorAs(t, err, &nfpm.ErrNoPackager{})
+}
+
+func TestStats(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:    "foo",
+		Arch:    "amd64",
+		Version: "1.2.3",
+		Overridables: nfpm.Overridables{
+			Contents: files.Contents{
+				{Source: "./testdata/something", Destination: "/usr/share/foo", Type: files.TypeTree},
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf", Type: files.TypeConfig},
+				{Destination: "/var/log/foo.log", Type: files.TypeRPMGhost},
+				{Source: "/usr/share/foo/a", Destination: "/usr/bin/foo", Type: files.TypeSymlink, Packager: "deb"},
+			},
+		},
+	})
+	conf, err := os.Stat("./testdata/whatever.conf")
+	require.NoError(t, err)
+
+	t.Run("deb", func(t *testing.T) {
+		stats, err := nfpm.Stats(info, "deb")
+		require.NoError(t, err)
+		require.Equal(t, nfpm.ContentStats{
+			Files: 5,
+			Dirs:  7,
+			Size:  3 + conf.Size(),
+			TopLevel: map[string]nfpm.ContentStats{
+				"/etc": {Files: 1, Dirs: 2, Size: conf.Size()},
+				"/usr": {Files: 4, Dirs: 5, Size: 3},
+			},
+		}, stats)
+	})
+
+	t.Run("rpm", func(t *testing.T) {
+		stats, err := nfpm.Stats(info, "rpm")
+		require.NoError(t, err)
+		require.Equal(t, nfpm.ContentStats{
+			Files: 5,
+			Dirs:  8,
+			Size:  3 + conf.Size(),
+			TopLevel: map[string]nfpm.ContentStats{
+				"/etc": {Files: 1, Dirs: 2, Size: conf.Size()},
+				"/usr": {Files: 3, Dirs: 4, Size: 3},
+				"/var": {Files: 1, Dirs: 2},
+			},
+		}, stats)
+	})
+
+	t.Run("info is not modified", func(t *testing.T) {
+		require.Len(t, info.Contents, 4)
+		require.Nil(t, info.Contents[0].FileInfo)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := nfpm.Stats(info, "TestStatsUnknownFormat")
+		require.ErrorAs(t, err, &nfpm.ErrNoPackager{})
+	})
+}
+
+func TestCheck(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+
+	newInfo := func() *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:    "foo",
+			Arch:    "amd64",
+			Version: "1.2.3",
+			Overridables: nfpm.Overridables{
+				Depends: []string{"bar >= 2.0"},
+				Contents: files.Contents{
+					{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf", Type: files.TypeConfig},
+				},
+			},
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require.Empty(t, nfpm.Check(newInfo(), "deb"))
+	})
+
+	t.Run("all errors", func(t *testing.T) {
+		info := newInfo()
+		info.Depends = append(info.Depends, "bar < 1.0")
+		info.Contents = append(info.Contents, &files.Content{
+			Source:      "./testdata/does-not-exist-*",
+			Destination: "/usr/share/foo/",
+		})
+
+		errs := nfpm.Check(info, "deb")
+		require.Len(t, errs, 2)
+		requireCode(t, errs[0], "invalid_dependency")
+		requireCode(t, errs[1], "invalid_contents")
+		require.ErrorContains(t, errs[1], "does-not-exist-*")
+
+		// the info is not modified
+		require.Len(t, info.Contents, 2)
+		require.Nil(t, info.Contents[0].FileInfo)
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		info := newInfo()
+		info.Name = ""
+		info.Version = ""
+		errs := nfpm.Check(info, "deb")
+		require.Len(t, errs, 2)
+		require.EqualError(t, errs[0], "package name must be provided")
+		require.Equal(t, "name", requireCode(t, errs[0], "missing_field").Field)
+		require.EqualError(t, errs[1], "package version must be provided")
+		require.Equal(t, "version", requireCode(t, errs[1], "missing_field").Field)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		errs := nfpm.Check(newInfo(), "TestCheckUnknownFormat")
+		require.Len(t, errs, 1)
+		require.ErrorAs(t, errs[0], &nfpm.ErrNoPackager{})
+	})
+}
+
+type writingPackager struct {
+	err error
+}
+
+func (*writingPackager) ConventionalFileName(_ *nfpm.Info) string {
+	return ""
+}
+
+func (p *writingPackager) Package(_ *nfpm.Info, w io.Writer) error {
+	if _, err := io.WriteString(w, "package"); err != nil {
+		return err
+	}
+	return p.err
+}
+
+type extensionPackager struct {
+	fakePackager
+	ext string
+}
+
+func (p *extensionPackager) ConventionalExtension() string {
+	return p.ext
+}
+
+func TestReproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	newSource := func(mtime time.Time) string {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "share", "doc"), 0o755))
+		for name, data := range map[string]string{
+			"bin/foo":           "#!/bin/sh\necho foo\n",
+			"share/doc/README":  "foo\n",
+			"share/foo.conf":    "a = b\n",
+			"share/doc/LICENSE": "MIT\n",
+		} {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+		}
+		require.NoError(t, filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(path, mtime, mtime)
+		}))
+		return dir
+	}
+	newInfo := func(dir string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:         "foo",
+			Arch:         "amd64",
+			Version:      "1.2.3",
+			Release:      "1",
+			Maintainer:   "Foo <foo@example.com>",
+			Reproducible: true,
+			ContentOrder: nfpm.ContentOrderConfig,
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: filepath.Join(dir, "share"), Destination: "/usr/share/foo", Type: files.TypeTree},
+					{Source: filepath.Join(dir, "bin", "foo"), Destination: "/usr/bin/foo", FileInfo: &files.ContentFileInfo{Mode: 0o755, PreserveMTime: true}},
+					{Source: filepath.Join(dir, "share", "foo.conf"), Destination: "/etc/foo.conf", Type: files.TypeConfig},
+				},
+			},
+		})
+	}
+
+	older := newSource(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	newer := newSource(time.Now())
+	for format, pkg := range map[string]nfpm.Packager{
+		"deb":       deb.Default,
+		"rpm":       rpm.Default,
+		"apk":       apk.Default,
+		"archlinux": arch.Default,
+	} {
+		t.Run(format, func(t *testing.T) {
+			var first, second bytes.Buffer
+			require.NoError(t, pkg.Package(newInfo(older), &first))
+			time.Sleep(time.Second)
+			require.NoError(t, pkg.Package(newInfo(newer), &second))
+			require.Equal(t, first.Bytes(), second.Bytes())
+		})
+	}
+
+	t.Run("mtime", func(t *testing.T) {
+		info := newInfo(older)
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		require.Equal(t, time.Unix(0, 0).UTC(), info.MTime)
+		require.Equal(t, nfpm.ContentOrderSorted, info.ContentOrder)
+		for _, content := range info.Contents {
+			require.True(t, content.FileInfo.MTime.Equal(info.MTime), content.Destination)
+		}
+
+		t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+		info = newInfo(older)
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		require.Equal(t, time.Unix(1700000000, 0).UTC(), info.MTime)
+	})
+}
+
+func TestFormatFromFilename(t *testing.T) {
+	nfpm.RegisterPackager("apk", apk.Default)
+	nfpm.RegisterPackager("archlinux", arch.Default)
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+
+	for path, format := range map[string]string{
+		"foo_1.0.0_amd64.deb":               "deb",
+		"foo_1.0.0_amd64.udeb":              "deb",
+		"foo-1.0.0-1.x86_64.rpm":            "rpm",
+		"foo_1.0.0_x86_64.apk":              "apk",
+		"foo_1.0.0_aarch64.ipk":             "ipk",
+		"foo-1.0.0-1-x86_64.pkg.tar.zst":    "archlinux",
+		"foo-1.0.0-1-x86_64.pkg.tar.xz":     "archlinux",
+		"foo-1.0.0-1-x86_64.pkg.tar.gz":     "archlinux",
+		"foo-1.0.0-1-x86_64.pkg.tar":        "archlinux",
+		"dist/linux/FOO_1.0.0_amd64.DEB":    "deb",
+		"/tmp/foo.deb/foo-1.0.0.x86_64.rpm": "rpm",
+	} {
+		t.Run(path, func(t *testing.T) {
+			got, err := nfpm.FormatFromFilename(path)
+			require.NoError(t, err)
+			require.Equal(t, format, got)
+		})
+	}
+
+	for _, path := range []string{"foo.tar.zst", "foo.zip", "foo", ".deb", "foo.deb.sig"} {
+		t.Run(path, func(t *testing.T) {
+			_, err := nfpm.FormatFromFilename(path)
+			require.ErrorAs(t, err, &nfpm.ErrUnknownExtension{})
+			require.ErrorContains(t, err, "unknown package extension: "+path+": must be one of .apk, .deb,")
+		})
+	}
+
+	t.Run("registered", func(t *testing.T) {
+		nfpm.RegisterPackager("TestFormatFromFilename", &extensionPackager{ext: ".pkg.tar.test"})
+		got, err := nfpm.FormatFromFilename("foo.pkg.tar.test")
+		require.NoError(t, err)
+		require.Equal(t, "TestFormatFromFilename", got)
+	})
+
+	t.Run("package", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo_1.0.0_amd64.deb")
+		require.NoError(t, os.WriteFile(path, []byte("previous"), 0o644))
+		info := &nfpm.Info{
+			Name:        "foo",
+			Arch:        "amd64",
+			Version:     "1.0.0",
+			Maintainer:  "Foo Bar <foo@bar.baz>",
+			Description: "foo",
+		}
+		require.NoError(t, nfpm.PackageByPath(info, path))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(bts, []byte("!<arch>\n")))
+
+		require.ErrorAs(t, nfpm.PackageByPath(info, filepath.Join(t.TempDir(), "foo.zip")), &nfpm.ErrUnknownExtension{})
+		require.ErrorAs(t, nfpm.PackageByPath(info, filepath.Join(t.TempDir(), "foo.ipk")), &nfpm.ErrNoPackager{})
+	})
+}
+
+func TestPackageFile(t *testing.T) {
+	nfpm.RegisterPackager("TestPackageFile", &writingPackager{})
+	nfpm.RegisterPackager("TestPackageFileFailing", &writingPackager{err: fmt.Errorf("fake error")})
+
+	t.Run("atomic", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		info := &nfpm.Info{}
+		require.NoError(t, nfpm.PackageFile(info, "TestPackageFile", path, nfpm.WriteOptions{Atomic: true}))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "package", string(bts))
+		require.Empty(t, info.Target, "the info is not modified")
+		require.NoFileExists(t, path+".tmp")
+	})
+
+	t.Run("atomic failure", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		require.NoError(t, os.WriteFile(path, []byte("previous"), 0o644))
+		err := nfpm.PackageFile(&nfpm.Info{}, "TestPackageFileFailing", path, nfpm.WriteOptions{
+			Atomic:    true,
+			Overwrite: true,
+		})
+		require.EqualError(t, err, "fake error")
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "previous", string(bts))
+		require.NoFileExists(t, path+".tmp")
+	})
+
+	t.Run("temp dir", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		info := &nfpm.Info{TempDir: t.TempDir()}
+		require.NoError(t, nfpm.PackageFile(info, "TestPackageFile", path, nfpm.WriteOptions{Atomic: true}))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "package", string(bts))
+		require.NoFileExists(t, path+".tmp")
+
+		entries, err := os.ReadDir(info.TempDir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("temp dir failure", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		info := &nfpm.Info{TempDir: t.TempDir()}
+		err := nfpm.PackageFile(info, "TestPackageFileFailing", path, nfpm.WriteOptions{Atomic: true})
+		require.EqualError(t, err, "fake error")
+		require.NoFileExists(t, path)
+		require.NoFileExists(t, path+".tmp")
+
+		entries, err := os.ReadDir(info.TempDir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("existing file", func(t *testing.T) {
+		for _, atomic := range []bool{true, false} {
+			path := filepath.Join(t.TempDir(), "foo.pkg")
+			require.NoError(t, os.WriteFile(path, []byte("previous"), 0o644))
+			err := nfpm.PackageFile(&nfpm.Info{}, "TestPackageFile", path, nfpm.WriteOptions{Atomic: atomic})
+			require.ErrorIs(t, err, fs.ErrExist)
+			bts, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, "previous", string(bts))
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		require.NoError(t, os.WriteFile(path, []byte("previous package"), 0o644))
+		require.NoError(t, nfpm.PackageFile(&nfpm.Info{}, "TestPackageFile", path, nfpm.WriteOptions{Overwrite: true}))
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "package", string(bts))
+	})
+
+	t.Run("overwrite failure", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "foo.pkg")
+		require.NoError(t, os.WriteFile(path, []byte("previous package"), 0o644))
+		err := nfpm.PackageFile(&nfpm.Info{}, "TestPackageFileFailing", path, nfpm.WriteOptions{Overwrite: true})
+		require.EqualError(t, err, "fake error")
+		bts, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "previous package", string(bts))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "the temporary file is removed")
+	})
+
+	t.Run("file mode", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file modes are not supported on windows")
+		}
+		for name, opts := range map[string]nfpm.WriteOptions{
+			"direct":    {},
+			"overwrite": {Overwrite: true},
+			"atomic":    {Atomic: true, Overwrite: true},
+		} {
+			t.Run(name, func(t *testing.T) {
+				for _, info := range []*nfpm.Info{{}, {TempDir: t.TempDir()}} {
+					path := filepath.Join(t.TempDir(), "foo.pkg")
+					if opts.Overwrite {
+						require.NoError(t, os.WriteFile(path, []byte("previous"), 0o600))
+					}
+					require.NoError(t, nfpm.PackageFile(info, "TestPackageFile", path, opts))
+					stat, err := os.Stat(path)
+					require.NoError(t, err)
+					require.Equal(t, nfpm.DefaultPackageFileMode, stat.Mode().Perm())
+
+					opts := opts
+					opts.FileMode = 0o640
+					opts.Overwrite = true
+					require.NoError(t, nfpm.PackageFile(info, "TestPackageFile", path, opts))
+					stat, err = os.Stat(path)
+					require.NoError(t, err)
+					require.Equal(t, fs.FileMode(0o640), stat.Mode().Perm())
+				}
+			})
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		err := nfpm.PackageFile(&nfpm.Info{}, "TestPackageFileFailing", path, nfpm.WriteOptions{})
+		require.EqualError(t, err, "fake error")
+		require.NoFileExists(t, path)
+	})
+}
+
+type verifyingPackager struct {
+	writingPackager
+	verifyErr error
+	verified  string
+}
+
+func (p *verifyingPackager) Verify(_ *nfpm.Info, r io.Reader) error {
+	bts, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	p.verified = string(bts)
+	return p.verifyErr
+}
+
+func TestSelfVerify(t *testing.T) {
+	verifying := &verifyingPackager{}
+	nfpm.RegisterPackager("TestSelfVerify", verifying)
+	nfpm.RegisterPackager("TestSelfVerifyUnsupported", &writingPackager{})
+
+	t.Run("disabled", func(t *testing.T) {
+		verifying.verified = ""
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		require.NoError(t, nfpm.PackageFile(&nfpm.Info{}, "TestSelfVerify", path, nfpm.WriteOptions{}))
+		require.Empty(t, verifying.verified)
+		require.FileExists(t, path)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		verifying.verified = ""
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		require.NoError(t, nfpm.PackageFile(&nfpm.Info{SelfVerify: true}, "TestSelfVerify", path, nfpm.WriteOptions{Atomic: true}))
+		require.Equal(t, "package", verifying.verified)
+		require.FileExists(t, path)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		verifying.verifyErr = fmt.Errorf("fake error")
+		t.Cleanup(func() { verifying.verifyErr = nil })
+		for _, atomic := range []bool{true, false} {
+			path := filepath.Join(t.TempDir(), "foo.pkg")
+			err := nfpm.PackageFile(&nfpm.Info{SelfVerify: true}, "TestSelfVerify", path, nfpm.WriteOptions{Atomic: atomic})
+			var target *nfpm.ErrVerificationFailure
+			require.ErrorAs(t, err, &target)
+			require.EqualError(t, target.Err, "fake error")
+			require.NoFileExists(t, path)
+			require.NoFileExists(t, path+".tmp")
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		path := filepath.Join(t.TempDir(), "foo.pkg")
+		require.NoError(t, nfpm.PackageFile(&nfpm.Info{SelfVerify: true}, "TestSelfVerifyUnsupported", path, nfpm.WriteOptions{}))
+		require.Equal(t, "skipping verification of "+path+": not supported by the packager\n", w.String())
+	})
+
+	t.Run("real packagers", func(t *testing.T) {
+		for format, pkg := range map[string]nfpm.Packager{"deb": deb.Default, "rpm": rpm.Default, "apk": apk.Default} {
+			nfpm.RegisterPackager(format, pkg)
+			info := nfpm.WithDefaults(&nfpm.Info{
+				Name:       "foo",
+				Arch:       "amd64",
+				Version:    "1.2.3",
+				Maintainer: "Foo <foo@bar>",
+				SelfVerify: true,
+				Overridables: nfpm.Overridables{
+					Contents: files.Contents{
+						{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf", Type: files.TypeConfig},
+						{Source: "/etc/foo/whatever.conf", Destination: "/etc/foo/link.conf", Type: files.TypeSymlink},
+						{Destination: "/var/lib/foo", Type: files.TypeDir},
+					},
+				},
+			})
+			path := filepath.Join(t.TempDir(), "foo."+format)
+			require.NoError(t, nfpm.PackageFile(info, format, path, nfpm.WriteOptions{}), format)
+		}
+	})
+}
+
+func TestResign(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("TestResignUnsupported", &writingPackager{})
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:    "foo",
+		Arch:    "amd64",
+		Version: "1.2.3",
+		Overridables: nfpm.Overridables{
+			Contents: files.Contents{
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf"},
+			},
+		},
+	})
+	path := filepath.Join(t.TempDir(), "foo.deb")
+	require.NoError(t, nfpm.PackageFile(info, "deb", path, nfpm.WriteOptions{}))
+	require.NoError(t, os.Chmod(path, 0o640))
+
+	signer := nfpm.SignerConfig{
+		PackageSignature: nfpm.PackageSignature{
+			KeyFile:       "./internal/sign/testdata/privkey.asc",
+			KeyPassphrase: "hunter2",
+		},
+	}
+	require.NoError(t, nfpm.Resign("deb", path, signer))
+	require.NoFileExists(t, path+".tmp")
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), stat.Mode().Perm())
+
+	info.Deb.Signature.PackageSignature = signer.PackageSignature
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, f.Close()) })
+	require.NoError(t, deb.Default.Verify(info, f))
+
+	t.Run("failure", func(t *testing.T) {
+		before, err := os.ReadFile(path)
+		require.NoError(t, err)
+		signer := signer
+		signer.KeyPassphrase = "wrong"
+		var target *nfpm.ErrSigningFailure
+		require.ErrorAs(t, nfpm.Resign("deb", path, signer), &target)
+		after, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, before, after)
+		require.NoFileExists(t, path+".tmp")
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		var target *nfpm.ErrSigningFailure
+		require.ErrorAs(t, nfpm.Resign("deb", path, nfpm.SignerConfig{}), &target)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		require.ErrorIs(t, nfpm.Resign("TestResignUnsupported", path, signer), nfpm.ErrResignNotSupported)
+	})
+}
+
+func TestSignatureKeyEnv(t *testing.T) {
+	keys := map[string]string{
+		"deb": "./internal/sign/testdata/privkey.asc",
+		"rpm": "./internal/sign/testdata/privkey.asc",
+		"apk": "./internal/sign/testdata/rsa.priv",
+	}
+	for format, verifier := range map[string]nfpm.PackagerWithVerify{
+		"deb": deb.Default,
+		"rpm": rpm.Default,
+		"apk": apk.Default,
+	} {
+		t.Run(format, func(t *testing.T) {
+			key, err := os.ReadFile(keys[format])
+			require.NoError(t, err)
+			t.Setenv("TEST_SIGNING_KEY", string(key))
+			t.Setenv("TEST_SIGNING_PASSPHRASE", "hunter2")
+
+			newInfo := func(sig nfpm.PackageSignature) *nfpm.Info {
+				info := nfpm.WithDefaults(&nfpm.Info{
+					Name:       "foo",
+					Arch:       "amd64",
+					Version:    "1.2.3",
+					Maintainer: "Foo <foo@example.com>",
+					Overridables: nfpm.Overridables{Contents: files.Contents{
+						{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf"},
+					}},
+				})
+				info.Deb.Signature.PackageSignature = sig
+				info.RPM.Signature.PackageSignature = sig
+				info.APK.Signature.PackageSignature = sig
+				return info
+			}
+
+			var pkg bytes.Buffer
+			require.NoError(t, verifier.Package(newInfo(nfpm.PackageSignature{
+				KeyEnv:           "TEST_SIGNING_KEY",
+				KeyPassphraseEnv: "TEST_SIGNING_PASSPHRASE",
+			}), &pkg))
+			require.NoError(t, verifier.Verify(newInfo(nfpm.PackageSignature{
+				KeyFile:       keys[format],
+				KeyPassphrase: "hunter2",
+			}), &pkg))
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		t.Setenv("TEST_SIGNING_KEY", "")
+		info := nfpm.WithDefaults(&nfpm.Info{Name: "foo", Arch: "amd64", Version: "1.2.3", Maintainer: "Foo <foo@example.com>"})
+		info.RPM.Signature.KeyEnv = "TEST_SIGNING_KEY"
+		err := nfpm.PrepareForPackager(info, "rpm")
+		require.EqualError(t, err, "invalid rpm signature key: environment variable TEST_SIGNING_KEY is empty")
+		require.Equal(t, "rpm.signature.key_env", requireCode(t, err, "invalid_signature_key").Field)
+	})
+
+	t.Run("with key file", func(t *testing.T) {
+		info := nfpm.WithDefaults(&nfpm.Info{Name: "foo", Arch: "amd64", Version: "1.2.3", Maintainer: "Foo <foo@example.com>"})
+		info.Deb.Signature.KeyEnv = "TEST_SIGNING_KEY"
+		info.Deb.Signature.KeyFile = "key.asc"
+		err := nfpm.Validate(info)
+		require.EqualError(t, err, "invalid deb signature key: key_file and key_env are mutually exclusive")
+		requireCode(t, err, "invalid_signature_key")
+	})
+
+	t.Run("config", func(t *testing.T) {
+		config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+arch: amd64
+version: 1.2.3
+deb:
+  signature:
+    key_env: TEST_SIGNING_KEY
+    key_passphrase_env: TEST_SIGNING_PASSPHRASE
+`))
+		require.NoError(t, err)
+		require.Equal(t, "TEST_SIGNING_KEY", config.Deb.Signature.KeyEnv)
+		require.Equal(t, "TEST_SIGNING_PASSPHRASE", config.Deb.Signature.KeyPassphraseEnv)
+	})
+}
+
+func TestOCILayer(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+	nfpm.RegisterPackager("apk", apk.Default)
+	nfpm.RegisterPackager("TestOCILayerUnsupported", &writingPackager{})
+
+	for format, expected := range map[string]nfpm.Identity{
+		"deb": {Name: "foo", Version: "1:1.2.3-1", Arch: "amd64"},
+		"rpm": {Name: "foo", Version: "1:1.2.3-1", Arch: "x86_64"},
+		"apk": {Name: "foo", Version: "1.2.3-r1", Arch: "x86_64"},
+	} {
+		t.Run(format, func(t *testing.T) {
+			info := nfpm.WithDefaults(&nfpm.Info{
+				Name:    "foo",
+				Arch:    "amd64",
+				Version: "1.2.3",
+				Release: "1",
+				Epoch:   "1",
+			})
+			path := filepath.Join(t.TempDir(), "foo."+format)
+			require.NoError(t, nfpm.PackageFile(info, format, path, nfpm.WriteOptions{}))
+
+			descriptor, blob, err := nfpm.OCILayer(path, format)
+			require.NoError(t, err)
+			require.Equal(t, "application/vnd.nfpm.package."+format, descriptor.MediaType)
+			require.Equal(t, map[string]string{
+				"org.opencontainers.image.title": "foo." + format,
+				"com.goreleaser.nfpm.name":       expected.Name,
+				"com.goreleaser.nfpm.version":    expected.Version,
+				"com.goreleaser.nfpm.arch":       expected.Arch,
+			}, descriptor.Annotations)
+
+			data, err := io.ReadAll(blob)
+			require.NoError(t, err)
+			pkg, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, pkg, data)
+			digest := sha256.Sum256(pkg)
+			require.Equal(t, "sha256:"+hex.EncodeToString(digest[:]), descriptor.Digest)
+			require.Equal(t, int64(len(pkg)), descriptor.Size)
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(nfpm.OCIDescriptor{MediaType: "application/vnd.nfpm.package.deb", Digest: "sha256:ab", Size: 1})
+		require.NoError(t, err)
+		require.JSONEq(t, `{"mediaType":"application/vnd.nfpm.package.deb","digest":"sha256:ab","size":1}`, string(data))
+	})
+
+	t.Run("not a package", func(t *testing.T) {
+		_, _, err := nfpm.OCILayer("./testdata/whatever.conf", "deb")
+		require.Error(t, err)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, _, err := nfpm.OCILayer("./testdata/whatever.conf", "TestOCILayerUnsupported")
+		require.ErrorIs(t, err, nfpm.ErrOCINotSupported)
+	})
+}
+
+func TestMakeSelfExtracting(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:    "foo",
+		Arch:    "amd64",
+		Version: "1.2.3",
+		Overridables: nfpm.Overridables{
+			Contents: files.Contents{
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf"},
+			},
+		},
+	})
+	dir := t.TempDir()
+	pkgPath := filepath.Join(dir, "foo.deb")
+	require.NoError(t, nfpm.PackageFile(info, "deb", pkgPath, nfpm.WriteOptions{}))
+	pkg, err := os.ReadFile(pkgPath)
+	require.NoError(t, err)
+
+	t.Run("custom stub", func(t *testing.T) {
+		stub := filepath.Join(dir, "stub.sh")
+		require.NoError(t, os.WriteFile(stub, []byte(`#!/bin/sh
+echo "extracting {{ .Name }} ({{ .Size }} bytes)"
+tail -c +$(({{ .Offset }} + 1)) "$0" > "$OUT"
+exit 0`), 0o644))
+
+		installer := filepath.Join(dir, "foo.run")
+		f, err := os.Create(installer)
+		require.NoError(t, err)
+		require.NoError(t, nfpm.MakeSelfExtracting(pkgPath, stub, f))
+		require.NoError(t, f.Close())
+
+		out := filepath.Join(dir, "extracted.deb")
+		cmd := exec.Command(sh, installer)
+		cmd.Env = append(os.Environ(), "OUT="+out)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		require.Equal(t, fmt.Sprintf("extracting foo.deb (%d bytes)\n", len(pkg)), string(output))
+		extracted, err := os.ReadFile(out)
+		require.NoError(t, err)
+		require.Equal(t, pkg, extracted)
+	})
+
+	t.Run("default stub", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, nfpm.MakeSelfExtracting(pkgPath, "", &buf))
+		require.True(t, bytes.HasSuffix(buf.Bytes(), pkg))
+		stub := buf.Bytes()[:buf.Len()-len(pkg)]
+		require.Contains(t, string(stub), fmt.Sprintf("tail -c +$((%d + 1))", len(stub)))
+		require.Contains(t, string(stub), `dpkg -i "$tmp/foo.deb"`)
+
+		path := filepath.Join(t.TempDir(), "stub.sh")
+		require.NoError(t, os.WriteFile(path, stub, 0o644))
+		output, err := exec.Command(sh, "-n", path).CombinedOutput()
+		require.NoError(t, err, string(output))
+	})
+
+	t.Run("invalid stub", func(t *testing.T) {
+		stub := filepath.Join(dir, "invalid.sh")
+		require.NoError(t, os.WriteFile(stub, []byte("{{ .Nope }}"), 0o644))
+		requireCode(t, nfpm.MakeSelfExtracting(pkgPath, stub, io.Discard), "invalid_template")
+	})
+}
+
+func TestWriteDebChanges(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+
+	dir := t.TempDir()
+	info := func(arch string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:        "foo",
+			Arch:        arch,
+			Version:     "1.2.3",
+			Release:     "1",
+			Section:     "utils",
+			Maintainer:  "Foo <foo@example.com>",
+			Description: "Foo does things\nin detail",
+			MTime:       time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC),
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/fake", Destination: "/usr/bin/fake"},
+			}},
+		})
+	}
+	var paths []string
+	for _, arch := range []string{"amd64", "arm64"} {
+		path := filepath.Join(dir, "foo_1.2.3-1_"+arch+".deb")
+		require.NoError(t, nfpm.PackageFile(info(arch), "deb", path, nfpm.WriteOptions{}))
+		paths = append(paths, path)
+	}
+
+	var files [2]struct{ name, md5, sha1, sha256, size string }
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		files[i].name = filepath.Base(path)
+		files[i].md5 = fmt.Sprintf("%x", md5.Sum(data))
+		files[i].sha1 = fmt.Sprintf("%x", sha1.Sum(data))
+		files[i].sha256 = fmt.Sprintf("%x", sha256.Sum256(data))
+		files[i].size = strconv.Itoa(len(data))
+	}
+
+	var w bytes.Buffer
+	require.NoError(t, nfpm.WriteDebChanges(info("amd64"), paths, &w))
+	require.Equal(t, `Format: 1.8
+Date: Wed, 14 Oct 2026 12:00:00 +0000
+Source: foo
+Binary: foo
+Architecture: amd64 arm64
+Version: 1.2.3-1
+Distribution: unstable
+Urgency: medium
+Maintainer: Foo <foo@example.com>
+Description:
+ foo - Foo does things
+Changes:
+ foo (1.2.3-1) unstable; urgency=medium
+ .
+   * Release 1.2.3-1.
+Checksums-Sha1:
+ `+files[0].sha1+" "+files[0].size+" "+files[0].name+`
+ `+files[1].sha1+" "+files[1].size+" "+files[1].name+`
+Checksums-Sha256:
+ `+files[0].sha256+" "+files[0].size+" "+files[0].name+`
+ `+files[1].sha256+" "+files[1].size+" "+files[1].name+`
+Files:
+ `+files[0].md5+" "+files[0].size+" utils optional "+files[0].name+`
+ `+files[1].md5+" "+files[1].size+" utils optional "+files[1].name+`
+`, w.String())
+
+	t.Run("version mismatch", func(t *testing.T) {
+		other := info("amd64")
+		other.Version = "1.2.4"
+		path := filepath.Join(dir, "foo_1.2.4-1_amd64.deb")
+		require.NoError(t, nfpm.PackageFile(other, "deb", path, nfpm.WriteOptions{}))
+		err := nfpm.WriteDebChanges(other, []string{paths[0], path}, io.Discard)
+		require.ErrorContains(t, err, "has version 1.2.4-1, not 1.2.3-1")
+	})
+
+	t.Run("not a deb", func(t *testing.T) {
+		require.Error(t, nfpm.WriteDebChanges(info("amd64"), []string{"./testdata/fake"}, io.Discard))
+		require.Error(t, nfpm.WriteDebChanges(info("amd64"), nil, io.Discard))
+	})
+}
+
+func TestWriteChecksums(t *testing.T) {
+	t.Run("sha256sum format", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, nfpm.WriteChecksums([]string{"./testdata/fake", "./testdata/whatever.conf"}, &buf))
+		// sha256sum fake whatever.conf
+		require.Equal(t, "056302317aae93b3c0cfcf9b2d8300c6f77fca580d1848d229799cc4edd47901  fake\n"+
+			"fb4d8c7a525630ab89af2b8f6b3b51f65877f20a569a87fc33bdbe1c3922f929  whatever.conf\n", buf.String())
+	})
+
+	t.Run("escaped name", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), `a\b`)
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0o644))
+		var buf bytes.Buffer
+		require.NoError(t, nfpm.WriteChecksums([]string{path}, &buf))
+		require.Equal(t, `\2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881  a\\b`+"\n", buf.String())
+	})
+
+	t.Run("same name", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "fake")
+		require.NoError(t, os.WriteFile(other, []byte("x"), 0o644))
+		err := nfpm.WriteChecksums([]string{"./testdata/fake", other}, io.Discard)
+		require.ErrorContains(t, err, "have the same name")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := nfpm.WriteChecksums([]string{"./testdata/does-not-exist"}, io.Discard)
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		var sums, signature bytes.Buffer
+		require.NoError(t, nfpm.WriteSignedChecksums([]string{"./testdata/fake"}, &sums, &signature, func(r io.Reader) ([]byte, error) {
+			return sign.PGPArmoredDetachSign(r, sign.Key{File: "./internal/sign/testdata/privkey.asc"}, "hunter2")
+		}))
+		require.Contains(t, sums.String(), "  fake\n")
+		require.NoError(t, sign.PGPVerify(&sums, signature.Bytes(), sign.Key{File: "./internal/sign/testdata/pubkey.asc"}))
+	})
+
+	t.Run("signing failure", func(t *testing.T) {
+		var sums bytes.Buffer
+		err := nfpm.WriteSignedChecksums([]string{"./testdata/fake"}, &sums, io.Discard, func(io.Reader) ([]byte, error) {
+			return nil, errors.New("no key")
+		})
+		require.ErrorAs(t, err, new(*nfpm.ErrSigningFailure))
+		require.Empty(t, sums.String())
+	})
+}
+
+func TestBuildInfo(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+
+	newInfo := func() *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.2.3",
+			Maintainer: "Foo <foo@bar>",
+			MTime:      mtime,
+			BuildInfo:  true,
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf", Type: files.TypeConfig, FileInfo: &files.ContentFileInfo{Mode: 0o644}},
+					{Source: "/etc/foo/whatever.conf", Destination: "/etc/foo/link.conf", Type: files.TypeSymlink},
+				},
+			},
+		})
+	}
+	build := func(t *testing.T, opts nfpm.WriteOptions) (string, []byte) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "foo.deb")
+		require.NoError(t, nfpm.PackageFile(newInfo(), "deb", path, opts))
+		manifest, err := os.ReadFile(path + nfpm.BuildInfoExtension)
+		require.NoError(t, err)
+		return path, manifest
+	}
+
+	path, manifest := build(t, nfpm.WriteOptions{})
+	_, again := build(t, nfpm.WriteOptions{Atomic: true})
+	require.Equal(t, string(manifest), string(again))
+
+	var buildInfo nfpm.BuildInfo
+	require.NoError(t, json.Unmarshal(manifest, &buildInfo))
+	pkg, err := os.ReadFile(path)
+	require.NoError(t, err)
+	pkgSum := sha256.Sum256(pkg)
+	require.Equal(t, nfpm.BuildInfoPackage{
+		Name:    "foo",
+		Version: "1.2.3",
+		Arch:    "amd64",
+		File:    "foo.deb",
+		Size:    int64(len(pkg)),
+		SHA256:  hex.EncodeToString(pkgSum[:]),
+	}, buildInfo.Package)
+	require.Equal(t, "deb", buildInfo.Format)
+	require.Equal(t, mtime.UTC().Format(time.RFC3339), buildInfo.MTime)
+	require.Equal(t, "nfpm", buildInfo.Tool.Name)
+
+	conf, err := os.ReadFile("./testdata/whatever.conf")
+	require.NoError(t, err)
+	confSum := sha256.Sum256(conf)
+	require.Contains(t, buildInfo.Files, nfpm.BuildInfoFile{
+		Path:   "/etc/foo/whatever.conf",
+		Type:   files.TypeConfig,
+		Mode:   "0644",
+		Owner:  "root",
+		Group:  "root",
+		Size:   int64(len(conf)),
+		SHA256: hex.EncodeToString(confSum[:]),
+	})
+	require.Contains(t, buildInfo.Files, nfpm.BuildInfoFile{
+		Path:  "/etc/foo/link.conf",
+		Type:  files.TypeSymlink,
+		Mode:  "0000",
+		Owner: "root",
+		Group: "root",
+		Link:  "/etc/foo/whatever.conf",
+	})
+	require.True(t, slices.IsSortedFunc(buildInfo.Files, func(a, b nfpm.BuildInfoFile) int {
+		return strings.Compare(a.Path, b.Path)
+	}))
+
+	t.Run("disabled", func(t *testing.T) {
+		info := newInfo()
+		info.BuildInfo = false
+		path := filepath.Join(t.TempDir(), "foo.deb")
+		require.NoError(t, nfpm.PackageFile(info, "deb", path, nfpm.WriteOptions{}))
+		require.NoFileExists(t, path+nfpm.BuildInfoExtension)
+	})
+
+	t.Run("packager arch", func(t *testing.T) {
+		nfpm.RegisterPackager("rpm", rpm.Default)
+		path := filepath.Join(t.TempDir(), "foo.rpm")
+		require.NoError(t, nfpm.PackageFile(newInfo(), "rpm", path, nfpm.WriteOptions{}))
+		manifest, err := os.ReadFile(path + nfpm.BuildInfoExtension)
+		require.NoError(t, err)
+		var buildInfo nfpm.BuildInfo
+		require.NoError(t, json.Unmarshal(manifest, &buildInfo))
+		require.Equal(t, "x86_64", buildInfo.Package.Arch)
+	})
+
+	t.Run("warns once", func(t *testing.T) {
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		info := newInfo()
+		info.Priority = "extra"
+		path := filepath.Join(t.TempDir(), "foo.deb")
+		require.NoError(t, nfpm.PackageFile(info, "deb", path, nfpm.WriteOptions{}))
+		require.Equal(t, 1, strings.Count(w.String(), `deb priority "extra" is deprecated`))
+	})
+
+	t.Run("failed move", func(t *testing.T) {
+		// a non empty directory cannot be replaced by the package.
+		path := filepath.Join(t.TempDir(), "foo.deb")
+		require.NoError(t, os.MkdirAll(filepath.Join(path, "foo"), 0o755))
+		err := nfpm.PackageFile(newInfo(), "deb", path, nfpm.WriteOptions{Atomic: true, Overwrite: true})
+		require.Error(t, err)
+		require.NoFileExists(t, path+nfpm.BuildInfoExtension)
+		require.NoFileExists(t, path+".tmp")
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	metadata := map[string]string{
+		"commit": "0123456789abcdef",
+		"ci_url": "https://ci.example.com/builds/42?job=a = b",
+		"Origin": "ci",
+	}
+	for format, pkg := range map[string]nfpm.PackagerWithMetadata{"deb": deb.Default, "rpm": rpm.Default, "apk": apk.Default} {
+		t.Run(format, func(t *testing.T) {
+			for name, expected := range map[string]map[string]string{
+				"round trip":  metadata,
+				"no metadata": {},
+			} {
+				t.Run(name, func(t *testing.T) {
+					info := nfpm.WithDefaults(&nfpm.Info{
+						Name:        "foo",
+						Arch:        "amd64",
+						Version:     "1.2.3",
+						Description: "Foo does things\n\nAnd more.",
+						Maintainer:  "Foo <foo@bar>",
+						Metadata:    expected,
+					})
+					var buf bytes.Buffer
+					require.NoError(t, pkg.Package(info, &buf))
+
+					got, err := pkg.ReadMetadata(&buf)
+					require.NoError(t, err)
+					require.Equal(t, expected, got)
+				})
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, metadata := range map[string]map[string]string{
+			"key with spaces":     {"build url": "x"},
+			"key with colon":      {"ci:url": "x"},
+			"multi line value":    {"commit": "a\nb"},
+			"key starting with -": {"-commit": "x"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				err := nfpm.Validate(&nfpm.Info{
+					Name:     "foo",
+					Arch:     "amd64",
+					Version:  "1.2.3",
+					Metadata: metadata,
+				})
+				requireCode(t, err, "invalid_metadata")
+			})
+		}
+	})
+}
+
+func TestMaintainer(t *testing.T) {
+	newInfo := func(maintainer, name, email string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:            "foo",
+			Arch:            "amd64",
+			Version:         "1.2.3",
+			MTime:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Maintainer:      maintainer,
+			MaintainerName:  name,
+			MaintainerEmail: email,
+		})
+	}
+	prepare := func(t *testing.T, info *nfpm.Info) (string, string) {
+		t.Helper()
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		return info.Maintainer, w.String()
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		maintainer, log := prepare(t, newInfo("Foo Team <foo-team@example.com>", "", ""))
+		require.Equal(t, "Foo Team <foo-team@example.com>", maintainer)
+		require.NotContains(t, log, "maintainer")
+	})
+
+	t.Run("missing email", func(t *testing.T) {
+		maintainer, log := prepare(t, newInfo("Foo Team", "", ""))
+		require.Equal(t, "Foo Team", maintainer)
+		require.Contains(t, log, `invalid maintainer "Foo Team": no email address in angle brackets, expected Name <email>`)
+	})
+
+	t.Run("structured", func(t *testing.T) {
+		info := newInfo("", "Foo Team", "foo-team@example.com")
+		require.Equal(t, "Foo Team <foo-team@example.com>", info.ResolveMaintainer())
+		maintainer, log := prepare(t, info.Copy())
+		require.Equal(t, "Foo Team <foo-team@example.com>", maintainer)
+		require.NotContains(t, log, "maintainer")
+
+		for format, pkg := range map[string]nfpm.Packager{"deb": deb.Default, "rpm": rpm.Default, "apk": apk.Default} {
+			t.Run(format, func(t *testing.T) {
+				var structured, plain bytes.Buffer
+				require.NoError(t, pkg.Package(info, &structured))
+				require.NoError(t, pkg.Package(newInfo("Foo Team <foo-team@example.com>", "", ""), &plain))
+				require.Equal(t, plain.Bytes(), structured.Bytes())
+			})
+		}
+	})
+
+	for name, info := range map[string]*nfpm.Info{
+		"several mailboxes": newInfo("Foo <foo@example.com>, Bar <bar@example.com>", "", ""),
+		"no address":        newInfo("Foo Team <foo-team>", "", ""),
+		"both forms":        newInfo("Foo <foo@example.com>", "Foo", "foo@example.com"),
+		"name only":         newInfo("", "Foo Team", ""),
+		"invalid email":     newInfo("", "Foo Team", "foo-team"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			requireCode(t, nfpm.Validate(info), "invalid_maintainer")
+		})
+	}
+}
+
+func TestInstallPrefix(t *testing.T) {
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:          "foo",
+		Version:       "1.2.3",
+		InstallPrefix: "/opt/myapp",
+		MTime:         mtime,
+		Overridables: nfpm.Overridables{
+			Contents: files.Contents{
+				{
+					Source:      "./testdata/fake",
+					Destination: "/usr/bin/foo",
+					FileInfo:    &files.ContentFileInfo{Owner: "foo", Group: "bar", Mode: 0o4755},
+				},
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo/", Type: files.TypeConfig},
+				{Source: "/usr/bin/foo", Destination: "/usr/bin/bar", Type: files.TypeSymlink},
+				{Source: "/bin/sh", Destination: "/usr/bin/sh", Type: files.TypeSymlink},
+				{Source: "./testdata/whatever.conf", Destination: "/usr/lib/systemd/system/foo.service"},
+			},
+			Alternatives: []nfpm.Alternative{{Name: "foo", Link: "/usr/bin/foo", Path: "/usr/bin/foo"}},
+		},
+	})
+	require.NoError(t, nfpm.PrepareForPackager(info, ""))
+
+	byDst := map[string]*files.Content{}
+	for _, content := range info.Contents {
+		byDst[content.Destination] = content
+	}
+
+	bin := byDst["/opt/myapp/usr/bin/foo"]
+	require.NotNil(t, bin)
+	require.Equal(t, "testdata/fake", bin.Source)
+	require.Equal(t, files.TypeFile, bin.Type)
+	require.Equal(t, &files.ContentFileInfo{Owner: "foo", Group: "bar", Mode: 0o4755, MTime: mtime, Size: bin.FileInfo.Size}, bin.FileInfo)
+
+	require.Equal(t, files.TypeConfig, byDst["/opt/myapp/etc/foo/whatever.conf"].Type)
+	require.Equal(t, "/opt/myapp/usr/bin/foo", byDst["/opt/myapp/usr/bin/bar"].Source)
+	require.Equal(t, "/bin/sh", byDst["/opt/myapp/usr/bin/sh"].Source)
+	require.Contains(t, byDst, "/usr/lib/systemd/system/foo.service")
+	require.Equal(t, files.TypeImplicitDir, byDst["/opt/myapp/"].Type)
+	require.NotContains(t, byDst, "/usr/bin/foo")
+	require.Equal(t, "/opt/myapp/usr/bin/foo", info.Alternatives[0].Path)
+	require.Equal(t, "/usr/bin/foo", info.Alternatives[0].Link)
+
+	// it is applied only once
+	require.NoError(t, nfpm.PrepareForPackager(info, ""))
+	require.True(t, info.Contents.ContainsDestination("/opt/myapp/usr/bin/foo"))
+
+	for _, prefix := range []string{"opt/myapp", "/", "/opt/../myapp"} {
+		t.Run("invalid "+prefix, func(t *testing.T) {
+			err := nfpm.PrepareForPackager(nfpm.WithDefaults(&nfpm.Info{Name: "foo", Version: "1.2.3", InstallPrefix: prefix}), "")
+			requireCode(t, err, "invalid_install_prefix")
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	config := nfpm.Config{
+		Info: nfpm.Info{
+			Name:     "foo",
+			Version:  "1.2.3",
+			Release:  "2",
+			MTime:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			Snapshot: &nfpm.Snapshot{Commit: "abcdef"},
+		},
+		Overrides: map[string]*nfpm.Overridables{
+			"deb": {Depends: []string{"bar"}},
+		},
+	}
+
+	for format, expected := range map[string][2]string{
+		"deb":       {"snapshot.20240101.abcdef", "2"},
+		"archlinux": {"", "0.20240101.abcdef"},
+		"rpm":       {"", "0.snapshot.20240101.abcdef"},
+		"apk":       {"pre20240101", "0"},
+	} {
+		t.Run(format, func(t *testing.T) {
+			info, err := config.Get(format)
+			require.NoError(t, err)
+			require.Equal(t, "1.2.3", info.Version)
+			require.Equal(t, expected[0], info.Prerelease)
+			require.Equal(t, expected[1], info.Release)
+			require.Nil(t, info.Snapshot)
+
+			// it is applied only once
+			require.NoError(t, nfpm.PrepareForPackager(nfpm.WithDefaults(info), ""))
+			require.Equal(t, expected[0], info.Prerelease)
+		})
+	}
+	require.NotNil(t, config.Snapshot)
+
+	t.Run("info built in code", func(t *testing.T) {
+		for format, pkg := range map[string]nfpm.Packager{
+			"deb":       deb.Default,
+			"rpm":       rpm.Default,
+			"apk":       apk.Default,
+			"archlinux": arch.Default,
+		} {
+			t.Run(format, func(t *testing.T) {
+				info := nfpm.WithDefaults(&nfpm.Info{
+					Name:     "foo",
+					Arch:     "amd64",
+					Version:  "1.2.3",
+					MTime:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+					Snapshot: &nfpm.Snapshot{Commit: "abcdef"},
+				})
+				name := pkg.ConventionalFileName(info)
+				require.Contains(t, name, "20240101")
+				require.NotNil(t, info.Snapshot, "the info is not modified")
+
+				prepared := info.Copy()
+				require.NoError(t, nfpm.PrepareForPackager(prepared, format))
+				require.Nil(t, prepared.Snapshot)
+				require.Equal(t, name, pkg.ConventionalFileName(prepared))
+			})
+		}
+	})
+
+	t.Run("source date epoch", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+		info, err := (&nfpm.Config{Info: nfpm.Info{Name: "foo", Version: "1.2.3", Snapshot: &nfpm.Snapshot{}}}).Get("deb")
+		require.NoError(t, err)
+		require.Equal(t, "snapshot.20231114", info.Prerelease)
+	})
+
+	t.Run("invalid commit", func(t *testing.T) {
+		_, err := (&nfpm.Config{Info: nfpm.Info{Name: "foo", Version: "1.2.3", Snapshot: &nfpm.Snapshot{Commit: "abc-def"}}}).Get("deb")
+		requireCode(t, err, "invalid_snapshot")
+	})
+}
+
+func TestContentConditions(t *testing.T) {
+	config, err := nfpm.ParseWithEnvMapping(strings.NewReader(`
+name: foo
+version: 1.2.3
+arch: ${ARCH}
+contents:
+- src: ./testdata/fake
+  dst: /usr/bin/fake
+- src: ./testdata/fake
+  dst: /usr/lib/foo/arm64-rpm
+  when: 'Arch == "arm64" && Format == "rpm"'
+- src: ./testdata/fake
+  dst: /usr/lib/foo/not-deb
+  when: Format != "deb"
+- src: ./testdata/fake
+  dst: /usr/lib/foo/amd64-or-apk
+  when: (Arch == "amd64" || Format == "apk") && Version == "1.2.3"
+- src: ./testdata/fake
+  dst: /usr/lib/foo/debug
+  when: Env.DEBUG == "1"
+`), func(s string) string {
+		return map[string]string{"ARCH": "arm64", "DEBUG": "1"}[s]
+	})
+	require.NoError(t, err)
+	require.NoError(t, config.Validate())
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		for format, expected := range map[string]map[string][]string{
+			"amd64": {
+				"deb": {"/usr/bin/fake", "/usr/lib/foo/amd64-or-apk", "/usr/lib/foo/debug"},
+				"rpm": {"/usr/bin/fake", "/usr/lib/foo/not-deb", "/usr/lib/foo/amd64-or-apk", "/usr/lib/foo/debug"},
+				"apk": {"/usr/bin/fake", "/usr/lib/foo/not-deb", "/usr/lib/foo/amd64-or-apk", "/usr/lib/foo/debug"},
+			},
+			"arm64": {
+				"deb": {"/usr/bin/fake", "/usr/lib/foo/debug"},
+				"rpm": {"/usr/bin/fake", "/usr/lib/foo/arm64-rpm", "/usr/lib/foo/not-deb", "/usr/lib/foo/debug"},
+				"apk": {"/usr/bin/fake", "/usr/lib/foo/not-deb", "/usr/lib/foo/amd64-or-apk", "/usr/lib/foo/debug"},
+			},
+		}[arch] {
+			t.Run(arch+" "+format, func(t *testing.T) {
+				cfg := config
+				cfg.Arch = arch
+				info, err := cfg.Get(format)
+				require.NoError(t, err)
+
+				var dsts []string
+				for _, content := range info.Contents {
+					require.Empty(t, content.When)
+					dsts = append(dsts, content.Destination)
+				}
+				require.Equal(t, expected, dsts)
+			})
+		}
+	}
+	require.Len(t, config.Contents, 5)
+
+	t.Run("prepare for packager", func(t *testing.T) {
+		info := nfpm.WithDefaults(&nfpm.Info{
+			Name:    "foo",
+			Version: "1.2.3",
+			Arch:    "aarch64",
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: "./testdata/fake", Destination: "/usr/bin/fake", When: `Arch == "aarch64"`},
+					{Source: "./testdata/fake", Destination: "/usr/bin/other", When: `Arch == "arm64"`},
+				},
+			},
+		})
+		require.NoError(t, nfpm.PrepareForPackager(info, "rpm"))
+		require.True(t, info.Contents.ContainsDestination("/usr/bin/fake"))
+		require.False(t, info.Contents.ContainsDestination("/usr/bin/other"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		info := nfpm.WithDefaults(&nfpm.Info{
+			Name:    "foo",
+			Version: "1.2.3",
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: "./testdata/fake", Destination: "/usr/bin/fake", When: `Os == "linux"`},
+				},
+			},
+		})
+		err := nfpm.Validate(info)
+		require.ErrorIs(t, err, expr.ErrUnknownVariable)
+		require.ErrorContains(t, err, `invalid condition "Os == \"linux\""`)
+
+		requireCode(t, nfpm.PrepareForPackager(info, "deb"), "invalid_contents")
+	})
+}
+
+func TestPreserveMTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+	sourceMTime := time.Date(2020, 2, 2, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, sourceMTime, sourceMTime))
+
+	for preserve, expected := range map[bool]time.Time{
+		true:  sourceMTime,
+		false: mtime,
+	} {
+		t.Run(strconv.FormatBool(preserve), func(t *testing.T) {
+			contents := files.Contents{{Source: path, Destination: "/usr/share/foo/data"}}
+			info := nfpm.WithDefaults(&nfpm.Info{
+				Name:           "foo",
+				Version:        "1.2.3",
+				MTime:          mtime,
+				PreserveMTimes: preserve,
+				Overridables:   nfpm.Overridables{Contents: contents},
+			})
+			require.NoError(t, nfpm.PrepareForPackager(info, ""))
+
+			require.True(t, info.Contents.ContainsDestination("/usr/share/foo/data"))
+			for _, content := range info.Contents {
+				if content.Destination == "/usr/share/foo/data" {
+					require.Equal(t, expected, content.ModTime().UTC())
+				}
+			}
+			require.Nil(t, contents[0].FileInfo)
+		})
+	}
+}
+
+func TestCompressManPages(t *testing.T) {
+	newInfo := func(compress bool) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:             "foo",
+			Version:          "1.2.3",
+			MTime:            mtime,
+			CompressManPages: compress,
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/man/man1/foo.1"},
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/man/de/man5/foo.conf.5"},
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/man/man1/bar.1.gz"},
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/doc/foo/foo.1"},
+					{Source: "foo.1", Destination: "/usr/share/man/man1/foo-alias.1", Type: files.TypeSymlink},
+					{Source: "/usr/share/man/man1/bar.1.gz", Destination: "/usr/share/man/man1/bar-alias.1", Type: files.TypeSymlink},
+					{Source: "/usr/share/doc/foo/foo.1", Destination: "/usr/share/man/man1/doc-alias.1", Type: files.TypeSymlink},
+				},
+			},
+		})
+	}
+	contentsByDestination := func(info *nfpm.Info) map[string]*files.Content {
+		res := map[string]*files.Content{}
+		for _, content := range info.Contents {
+			res[content.Destination] = content
+		}
+		return res
+	}
+	original, err := os.ReadFile("./testdata/whatever.conf")
+	require.NoError(t, err)
+
+	t.Run("enabled", func(t *testing.T) {
+		info := newInfo(true)
+		require.NoError(t, nfpm.PrepareForPackager(info, ""))
+		contents := contentsByDestination(info)
+
+		for _, dst := range []string{"/usr/share/man/man1/foo.1.gz", "/usr/share/man/de/man5/foo.conf.5.gz"} {
+			require.Contains(t, contents, dst)
+			data, err := contents[dst].ReadAll()
+			require.NoError(t, err)
+			require.Equal(t, int64(len(data)), contents[dst].Size())
+			gz, err := gzip.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.True(t, gz.ModTime.IsZero())
+			require.Empty(t, gz.Name)
+			uncompressed, err := io.ReadAll(gz)
+			require.NoError(t, err)
+			require.Equal(t, original, uncompressed)
+			require.Equal(t, mtime, contents[dst].ModTime().UTC())
+		}
+		require.NotContains(t, contents, "/usr/share/man/man1/foo.1")
+		require.NotContains(t, contents, "/usr/share/man/man1/bar.1.gz.gz")
+		require.Nil(t, contents["/usr/share/man/man1/bar.1.gz"].Data)
+		require.Nil(t, contents["/usr/share/doc/foo/foo.1"].Data)
+
+		require.Equal(t, "foo.1.gz", contents["/usr/share/man/man1/foo-alias.1.gz"].Source)
+		require.Equal(t, "/usr/share/man/man1/bar.1.gz", contents["/usr/share/man/man1/bar-alias.1.gz"].Source)
+		require.Equal(t, "/usr/share/doc/foo/foo.1", contents["/usr/share/man/man1/doc-alias.1.gz"].Source)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		info := newInfo(false)
+		require.NoError(t, nfpm.PrepareForPackager(info, ""))
+		contents := contentsByDestination(info)
+		require.Nil(t, contents["/usr/share/man/man1/foo.1"].Data)
+		require.Equal(t, "foo.1", contents["/usr/share/man/man1/foo-alias.1"].Source)
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		info := newInfo(true)
+		info.Contents = append(info.Contents, &files.Content{
+			Source:      "./testdata/whatever.conf",
+			Destination: "/usr/share/man/man1/foo.1.gz",
+		})
+		require.EqualError(t, nfpm.PrepareForPackager(info, ""), "compressing man page /usr/share/man/man1/foo.1: /usr/share/man/man1/foo.1.gz is also part of the contents")
+	})
+}
+
+func TestDedup(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(empty, nil, 0o644))
+	newInfo := func() *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:    "foo",
+			Arch:    "amd64",
+			Version: "1.2.3",
+			MTime:   mtime,
+			Dedup:   true,
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/foo/a"},
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/foo/b"},
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/foo/c"},
+					{Source: "./testdata/whatever.conf", Destination: "/usr/share/foo/d", FileInfo: &files.ContentFileInfo{Mode: 0o600}},
+					{Source: "./testdata/whatever.conf", Destination: "/etc/foo.conf", Type: files.TypeConfig},
+					{Source: empty, Destination: "/usr/share/foo/empty1"},
+					{Source: empty, Destination: "/usr/share/foo/empty2"},
+				},
+			},
+		})
+	}
+	types := func(info *nfpm.Info) map[string]string {
+		res := map[string]string{}
+		for _, content := range info.Contents {
+			if content.Type == files.TypeHardlink {
+				res[content.Destination] = content.Source
+			}
+		}
+		return res
+	}
+
+	for _, packager := range []string{"deb", "apk", "archlinux"} {
+		t.Run(packager, func(t *testing.T) {
+			info := newInfo()
+			require.NoError(t, nfpm.PrepareForPackager(info, packager))
+			require.Equal(t, map[string]string{
+				"/usr/share/foo/b": "/usr/share/foo/a",
+				"/usr/share/foo/c": "/usr/share/foo/a",
+			}, types(info))
+		})
+	}
+
+	t.Run("rpm", func(t *testing.T) {
+		info := newInfo()
+		require.NoError(t, nfpm.PrepareForPackager(info, "rpm"))
+		require.Empty(t, types(info))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		info := newInfo()
+		info.Dedup = false
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		require.Empty(t, types(info))
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		conf, err := os.Stat("./testdata/whatever.conf")
+		require.NoError(t, err)
+		stats, err := nfpm.Stats(newInfo(), "deb")
+		require.NoError(t, err)
+		require.Equal(t, 7, stats.Files)
+		require.Equal(t, 3*conf.Size(), stats.Size)
+	})
+}
+
+func TestDownload(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/flaky":
+			if requests%3 != 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, "downloaded")
+	}))
+	t.Cleanup(srv.Close)
+
+	newInfo := func(src string, retries int) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:     "foo",
+			Arch:     "amd64",
+			Version:  "1.2.3",
+			MTime:    mtime,
+			Download: nfpm.Download{Retries: retries, Backoff: time.Millisecond},
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Source: src, Destination: "/usr/share/foo/downloaded"},
+				},
+			},
+		})
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		requests = 0
+		info := newInfo(srv.URL+"/flaky", 2)
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		require.Equal(t, 3, requests)
+		for _, content := range info.Contents {
+			if content.Destination != "/usr/share/foo/downloaded" {
+				continue
+			}
+			require.Equal(t, []byte("downloaded"), content.Data)
+			require.Equal(t, int64(len("downloaded")), content.Size())
+			require.Equal(t, fs.FileMode(0o644), content.Mode())
+		}
+	})
+
+	t.Run("giving up", func(t *testing.T) {
+		requests = 0
+		err := nfpm.PrepareForPackager(newInfo(srv.URL+"/flaky", 1), "deb")
+		requireCode(t, err, "download_failed")
+		require.EqualError(t, err, "download failed: "+srv.URL+"/flaky: giving up after 2 attempt(s): unexpected status: 503 Service Unavailable")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		requests = 0
+		err := nfpm.PrepareForPackager(newInfo(srv.URL+"/missing", 5), "deb")
+		require.ErrorContains(t, err, "giving up after 1 attempt(s): unexpected status: 404 Not Found")
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("config", func(t *testing.T) {
+		info, err := nfpm.Parse(strings.NewReader("name: foo\ndownload:\n  retries: 3\n  timeout: 30s\n  backoff: 500ms\n"))
+		require.NoError(t, err)
+		require.Equal(t, nfpm.Download{Retries: 3, Timeout: 30 * time.Second, Backoff: 500 * time.Millisecond}, info.Download)
+	})
+}
+
+func TestExpandEnvContents(t *testing.T) {
+	t.Setenv("NFPM_TEST_VERSION", "1.2.3")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "VERSION"), []byte("${NFPM_TEST_VERSION}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foo"), []byte("\x7fELF\x00\x01"), 0o755))
+
+	newInfo := func(contents ...*files.Content) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:         "foo",
+			Version:      "1.2.3",
+			Overridables: nfpm.Overridables{Contents: contents},
+		})
+	}
+
+	info := newInfo(&files.Content{Source: filepath.Join(dir, "VERSION"), Destination: "/usr/share/foo/VERSION", ExpandEnv: true})
+	require.NoError(t, nfpm.PrepareForPackager(info, ""))
+	var data []string
+	for _, content := range info.Contents {
+		if content.Type == files.TypeFile {
+			data = append(data, string(content.Data))
+		}
+	}
+	require.Equal(t, []string{"1.2.3\n"}, data)
+
+	info = newInfo(&files.Content{Source: filepath.Join(dir, "foo"), Destination: "/usr/bin/foo", ExpandEnv: true})
+	require.ErrorIs(t, nfpm.PrepareForPackager(info, ""), files.ErrInvalidExpandEnv)
+}
+
+func TestContentTransformers(t *testing.T) {
+	relocate := func(contents files.Contents) (files.Contents, error) {
+		for _, content := range contents {
+			if rest, ok := strings.CutPrefix(content.Destination, "/usr/local/"); ok {
+				content.Destination = "/usr/" + rest
+			}
+		}
+		return contents, nil
+	}
+	var seen []string
+	strip := func(contents files.Contents) (files.Contents, error) {
+		var res files.Contents
+		for _, content := range contents {
+			seen = append(seen, content.Destination)
+			if !strings.HasSuffix(content.Destination, ".debug") {
+				res = append(res, content)
+			}
+		}
+		return res, nil
+	}
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:             "foo",
+		Version:          "1.2.3",
+		CompressManPages: true,
+		Overridables: nfpm.Overridables{
+			Contents: files.Contents{
+				{Source: "./testdata/fake", Destination: "/usr/local/bin/fake"},
+				{Source: "./testdata/fake", Destination: "/usr/local/lib/debug/fake.debug"},
+				{Source: "./testdata/whatever.conf", Destination: "/usr/share/man/man1/fake.1"},
+			},
+		},
+		ContentTransformers: []nfpm.ContentTransformer{relocate, strip},
+	})
+	require.NoError(t, nfpm.PrepareForPackager(info, ""))
+
+	require.True(t, info.Contents.ContainsDestination("/usr/bin/fake"))
+	require.False(t, info.Contents.ContainsDestination("/usr/local/bin/fake"))
+	require.False(t, info.Contents.ContainsDestination("/usr/lib/debug/fake.debug"))
+	// strip runs after relocate, and both after the built-in transformers
+	require.Contains(t, seen, "/usr/lib/debug/fake.debug")
+	require.NotContains(t, seen, "/usr/local/lib/debug/fake.debug")
+	require.Contains(t, seen, "/usr/share/man/man1/fake.1.gz")
+
+	t.Run("error", func(t *testing.T) {
+		errTransform := errors.New("transform failed")
+		info := nfpm.WithDefaults(&nfpm.Info{
+			Name:    "foo",
+			Version: "1.2.3",
+			ContentTransformers: []nfpm.ContentTransformer{
+				func(files.Contents) (files.Contents, error) { return nil, errTransform },
+			},
+		})
+		require.ErrorIs(t, nfpm.PrepareForPackager(info, ""), errTransform)
+	})
+}
+
+func TestModePolicies(t *testing.T) {
+	newInfo := func(enforce string) *nfpm.Info {
+		config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+version: 1.2.3
+contents:
+- src: ./testdata/whatever.conf
+  dst: /etc/foo/foo.conf
+  type: config
+  file_info:
+    mode: 0o644
+- src: ./testdata/whatever.conf
+  dst: /etc/foo/secret.conf
+  type: config
+  file_info:
+    mode: 0o600
+- src: ./testdata/whatever.conf
+  dst: /etc/bar.conf
+  file_info:
+    mode: 0o644
+- src: /etc/foo/foo.conf
+  dst: /etc/foo/link.conf
+  type: symlink
+mode_policies:
+- path: /etc/foo/**
+  forbid_bits: 0o007
+  enforce: ` + enforce + `
+- path: /etc/foo/secret.conf
+  required_mode: 0o400
+  enforce: ` + enforce + `
+`))
+		require.NoError(t, err)
+		info, err := config.Get("")
+		require.NoError(t, err)
+		return nfpm.WithDefaults(info)
+	}
+	modes := func(info *nfpm.Info) map[string]fs.FileMode {
+		res := map[string]fs.FileMode{}
+		for _, content := range info.Contents {
+			res[content.Destination] = content.FileInfo.Mode
+		}
+		return res
+	}
+
+	t.Run("fix", func(t *testing.T) {
+		info := newInfo("fix")
+		require.NoError(t, nfpm.PrepareForPackager(info, ""))
+		mode := modes(info)
+		require.Equal(t, fs.FileMode(0o640), mode["/etc/foo/foo.conf"])
+		require.Equal(t, fs.FileMode(0o400), mode["/etc/foo/secret.conf"])
+		require.Equal(t, fs.FileMode(0o644), mode["/etc/bar.conf"])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		info := newInfo("error")
+		err := nfpm.PrepareForPackager(info, "")
+		require.EqualError(t, err, `/etc/foo/foo.conf: mode 0644 violates the mode policy for "/etc/foo/**": must not have the bits 0007`+"\n"+
+			`/etc/foo/secret.conf: mode 0600 violates the mode policy for "/etc/foo/secret.conf": must be 0400`)
+		requireCode(t, err, "mode_policy_violation")
+	})
+
+	t.Run("install prefix", func(t *testing.T) {
+		info := newInfo("fix")
+		info.InstallPrefix = "/opt/foo"
+		require.NoError(t, nfpm.PrepareForPackager(info, ""))
+		require.Equal(t, fs.FileMode(0o640), modes(info)["/opt/foo/etc/foo/foo.conf"])
+	})
+
+	for name, policy := range map[string]nfpm.ModePolicy{
+		"relative":       {Path: "etc/foo/**", ForbidBits: 0o007},
+		"pattern":        {Path: "/etc/[foo", ForbidBits: 0o007},
+		"no restriction": {Path: "/etc/foo/**"},
+		"type bits":      {Path: "/etc/foo/**", RequiredMode: fs.ModeDir | 0o755},
+		"contradiction":  {Path: "/etc/foo/**", RequiredMode: 0o644, ForbidBits: 0o004},
+		"enforce":        {Path: "/etc/foo/**", ForbidBits: 0o007, Enforce: "warn"},
+	} {
+		t.Run("invalid "+name, func(t *testing.T) {
+			info := newInfo("fix")
+			info.ModePolicies = []nfpm.ModePolicy{policy}
+			err := nfpm.Validate(info)
+			require.Error(t, err)
+			requireCode(t, err, "invalid_mode_policy")
+			requireCode(t, nfpm.PrepareForPackager(info, ""), "invalid_mode_policy")
+		})
+	}
+}
+
+func TestCheckELFArch(t *testing.T) {
+	info := func(arch string, check bool) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:         "foo",
+			Arch:         arch,
+			Version:      "1.2.3",
+			CheckELFArch: check,
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/shlibs/foo", Destination: "/usr/bin/foo"},
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo.conf"},
+			}},
+		})
+	}
+
+	require.NoError(t, nfpm.PrepareForPackager(info("amd64", true), "deb"))
+	require.NoError(t, nfpm.PrepareForPackager(info("all", true), "deb"))
+	require.NoError(t, nfpm.PrepareForPackager(info("arm64", false), "deb"))
+	err := nfpm.PrepareForPackager(info("arm64", true), "deb")
+	require.ErrorIs(t, err, files.ErrELFArchMismatch)
+	require.ErrorContains(t, err, "/usr/bin/foo")
+}
+
+func TestForbidWorldWritable(t *testing.T) {
+	newInfo := func(allowlist ...string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:                   "foo",
+			Arch:                   "amd64",
+			Version:                "1.0.0",
+			Maintainer:             "Foo <foo@example.com>",
+			ForbidWorldWritable:    true,
+			WorldWritableAllowlist: allowlist,
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Destination: "/usr/share/foo/foo.txt", Data: []byte("foo"), FileInfo: &files.ContentFileInfo{Mode: 0o666}},
+				{Destination: "/usr/share/foo/bar.txt", Data: []byte("bar"), FileInfo: &files.ContentFileInfo{Mode: 0o644}},
+				{Destination: "/var/tmp/foo", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Mode: fs.ModeSticky | 0o777}},
+				{Source: "/usr/share/foo/foo.txt", Destination: "/usr/bin/foo", Type: files.TypeSymlink},
+			}},
+		})
+	}
+
+	t.Run("world-writable", func(t *testing.T) {
+		err := nfpm.PrepareForPackager(newInfo(), "deb")
+		require.ErrorContains(t, err, "/usr/share/foo/foo.txt: mode 0666 is world-writable")
+		require.ErrorContains(t, err, "/var/tmp/foo: mode 0777 is world-writable")
+		require.NotContains(t, err.Error(), "/usr/bin/foo")
+		require.NotContains(t, err.Error(), "bar.txt")
+		requireCode(t, err, "world_writable")
+	})
+
+	t.Run("allowlisted", func(t *testing.T) {
+		err := nfpm.PrepareForPackager(newInfo("/var/tmp/foo"), "deb")
+		require.EqualError(t, err, "/usr/share/foo/foo.txt: mode 0666 is world-writable")
+		require.NoError(t, nfpm.PrepareForPackager(newInfo("/var/tmp/foo", "/usr/share/foo/**"), "rpm"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		info := newInfo()
+		info.ForbidWorldWritable = false
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+	})
+
+	t.Run("invalid allowlist", func(t *testing.T) {
+		err := nfpm.Validate(newInfo("var/tmp"))
+		require.EqualError(t, err, `invalid world-writable allowlist path "var/tmp": path must be absolute`)
+		requireCode(t, err, "invalid_world_writable_allowlist")
+	})
+}
+func TestDependencies(t *testing.T) {
+	newInfo := func(depends, conflicts, breaks []string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:    "foo",
+			Version: "1.2.3",
+			Overridables: nfpm.Overridables{
+				Depends:   depends,
+				Conflicts: conflicts,
+				Deb:       nfpm.Deb{Breaks: breaks},
+			},
+		})
+	}
+
+	t.Run("duplicates", func(t *testing.T) {
+		depends := []string{"bar", "baz >= 1.0", "bar", " baz >= 1.0"}
+		info := newInfo(depends, []string{"qux", "qux"}, []string{"quux (<< 2)", "quux (<< 2)"})
+		require.NoError(t, nfpm.Validate(info))
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		require.Equal(t, []string{"bar", "baz >= 1.0"}, info.Depends)
+		require.Equal(t, []string{"qux"}, info.Conflicts)
+		require.Equal(t, []string{"quux (<< 2)"}, info.Deb.Breaks)
+		require.Len(t, depends, 4)
+	})
+
+	for name, deps := range map[string][3][]string{
+		"different packages":   {{"bar >= 1.0", "baz < 1.0"}, {"qux"}, nil},
+		"version range":        {{"bar >= 1.0", "bar < 2.0"}, nil, nil},
+		"deb version range":    {{"bar (>= 1.0)", "bar (<< 2.0)"}, nil, nil},
+		"exact version":        {{"bar = 1.2", "bar >= 1.0", "bar <= 1.2"}, nil, nil},
+		"conflict older":       {{"bar >= 1.0"}, {"bar < 1.0"}, {"bar (<< 1.0)"}},
+		"conflict other arch":  {{"bar(x86-64) >= 1.0"}, {"bar(aarch64)"}, nil},
+		"tilde":                {{"bar >= 1.0~rc1", "bar < 1.0"}, nil, nil},
+		"epoch":                {{"bar >= 1:1.18", "bar > 2.0"}, nil, nil},
+		"alternatives":         {{"bar | baz", "bar"}, {"baz"}, nil},
+		"unversioned conflict": {nil, {"bar"}, {"bar"}},
+	} {
+		t.Run("benign "+name, func(t *testing.T) {
+			info := newInfo(deps[0], deps[1], deps[2])
+			require.NoError(t, nfpm.Validate(info))
+			require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		})
+	}
+
+	for name, deps := range map[string][3][]string{
+		"disjoint":         {{"bar >= 1.0", "bar < 1.0"}, nil, nil},
+		"numeric":          {{"bar >= 1.10", "bar < 1.9"}, nil, nil},
+		"deb":              {{"bar (>> 2.0)", "bar (<< 1.0)"}, nil, nil},
+		"exact versions":   {{"bar = 1.0", "bar = 1.1"}, nil, nil},
+		"strict bounds":    {{"bar > 1.0", "bar <= 1.0"}, nil, nil},
+		"apk":              {{"bar>=2.0", "bar<1.5"}, nil, nil},
+		"epoch":            {{"bar < 1:1.0", "bar >= 1:2.0"}, nil, nil},
+		"conflict":         {{"bar >= 1.0"}, {"bar"}, nil},
+		"conflict covered": {{"bar >= 1.0", "bar < 2.0"}, {"bar < 3.0"}, nil},
+		"breaks":           {{"bar = 1.0"}, nil, {"bar (<= 1.0)"}},
+	} {
+		t.Run("contradictory "+name, func(t *testing.T) {
+			info := newInfo(deps[0], deps[1], deps[2])
+			err := nfpm.Validate(info)
+			require.ErrorContains(t, err, `invalid dependency on "bar"`)
+			requireCode(t, err, "invalid_dependency")
+			requireCode(t, nfpm.PrepareForPackager(info, "deb"), "invalid_dependency")
+		})
+	}
+
+	t.Run("packager versions", func(t *testing.T) {
+		// rpm ignores the `+`, dpkg sorts it after the letters
+		depends := []string{"bar >= 1.0+a", "bar <= 1.0a"}
+		require.NoError(t, nfpm.PrepareForPackager(newInfo(depends, nil, nil), "rpm"))
+		requireCode(t, nfpm.PrepareForPackager(newInfo(depends, nil, nil), "deb"), "invalid_dependency")
+		require.Empty(t, nfpm.Check(newInfo(depends, nil, nil), "rpm"))
+		require.Len(t, nfpm.Check(newInfo(depends, nil, nil), "deb"), 1)
+	})
+
+	for name, deps := range map[string][3][]string{
+		"conflict older": {nil, {"foo < 1.0"}, {"foo (<< 1.2.3)"}},
+		"conflict newer": {nil, {"foo > 1.2.3"}, nil},
+	} {
+		t.Run("benign self "+name, func(t *testing.T) {
+			info := newInfo(deps[0], deps[1], deps[2])
+			require.NoError(t, nfpm.Validate(info))
+			require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		})
+	}
+
+	for name, deps := range map[string][3][]string{
+		"dependency":           {{"foo"}, nil, nil},
+		"versioned dependency": {{"bar", "foo (>= 1.0)"}, nil, nil},
+		"conflict":             {nil, {"foo"}, nil},
+		"versioned conflict":   {nil, {"foo <= 1.2.3"}, nil},
+		"breaks":               {nil, nil, {"foo (>> 1.0)"}},
+	} {
+		t.Run("self "+name, func(t *testing.T) {
+			info := newInfo(deps[0], deps[1], deps[2])
+			require.ErrorContains(t, nfpm.Validate(info), `invalid dependency on "foo"`)
+			requireCode(t, nfpm.PrepareForPackager(info, "deb"), "invalid_dependency")
+		})
+	}
+
+	t.Run("self provides", func(t *testing.T) {
+		for _, provides := range []string{"foo", "foo = 1.2.3", "foo (= 1.2.3-1)", "bar = 2.0"} {
+			info := newInfo(nil, nil, nil)
+			info.Release = "1"
+			info.Provides = []string{provides}
+			require.NoError(t, nfpm.Validate(info), provides)
+		}
+
+		info := newInfo(nil, nil, nil)
+		info.Provides = []string{"foo (= 2.0)"}
+		err := nfpm.Validate(info)
+		requireCode(t, err, "invalid_dependency")
+		require.EqualError(t, err, `invalid dependency on "foo": the package provides its own name with "foo (= 2.0)", which does not match its version 1.2.3`)
+	})
+
+	t.Run("message", func(t *testing.T) {
+		err := nfpm.Validate(newInfo([]string{"foo >= 1.0"}, nil, nil))
+		require.EqualError(t, err, `invalid dependency on "foo": the package depends on itself with "foo >= 1.0"`)
+		err = nfpm.Validate(newInfo(nil, []string{"foo"}, nil))
+		require.EqualError(t, err, `invalid dependency on "foo": conflicts entry "foo" matches the package itself`)
+		err = nfpm.Validate(newInfo([]string{"bar >= 1.0", "bar < 1.0"}, nil, nil))
+		require.EqualError(t, err, `invalid dependency on "bar": "bar >= 1.0" and "bar < 1.0" can not both be satisfied`)
+		err = nfpm.Validate(newInfo([]string{"bar >= 1.0"}, []string{"bar"}, nil))
+		require.EqualError(t, err, `invalid dependency on "bar": "bar >= 1.0" contradicts conflicts entry "bar"`)
+	})
+}
+
+func TestParseManifest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "files.txt"), []byte(`
+./testdata/fake /usr/bin/fake 0755
+./testdata/whatever.conf /etc/foo/whatever.conf - - - config
+`), 0o644))
+
+	config, err := nfpm.ParseWithEnvMapping(strings.NewReader(`
+name: foo
+version: 1.2.3
+contents:
+- manifest: ${MANIFEST_DIR}/files.txt
+  expand: true
+  file_info:
+    owner: foo
+overrides:
+  rpm:
+    contents:
+    - manifest: `+filepath.Join(dir, "files.txt")+`
+      packager: rpm
+`), func(s string) string {
+		return map[string]string{"MANIFEST_DIR": dir}[s]
+	})
+	require.NoError(t, err)
+	require.Equal(t, files.Contents{
+		{Source: "./testdata/fake", Destination: "/usr/bin/fake", FileInfo: &files.ContentFileInfo{Owner: "foo", Mode: 0o755}},
+		{Source: "./testdata/whatever.conf", Destination: "/etc/foo/whatever.conf", Type: files.TypeConfig, FileInfo: &files.ContentFileInfo{Owner: "foo"}},
+	}, config.Contents)
+	require.Len(t, config.Overrides["rpm"].Contents, 2)
+	require.Equal(t, "rpm", config.Overrides["rpm"].Contents[0].Packager)
+	require.NoError(t, config.Validate())
+
+	_, err = nfpm.Parse(strings.NewReader("name: foo\ncontents:\n- manifest: ./testdata/missing.txt\n"))
+	require.ErrorIs(t, err, files.ErrInvalidManifest)
+}
+
+func TestRenames(t *testing.T) {
+	type relationships struct {
+		provides, replaces, conflicts []string
+	}
+	for packager, expected := range map[string]relationships{
+		"deb": {
+			provides:  []string{"bar", "older", "old (= 2.0.0)"},
+			replaces:  []string{"older", "old (<< 2.0.0)"},
+			conflicts: []string{"older", "old (<< 2.0.0)"},
+		},
+		"rpm": {
+			provides: []string{"bar", "older = 1:2.0.0~rc1-3", "old = 2.0.0"},
+			replaces: []string{"older < 1:2.0.0~rc1-3", "old < 2.0.0"},
+		},
+		"apk": {
+			provides: []string{"bar", "older", "old=2.0.0"},
+			replaces: []string{"older", "old"},
+		},
+		"archlinux": {
+			provides:  []string{"bar", "older", "old=2.0.0"},
+			replaces:  []string{"older", "old<2.0.0"},
+			conflicts: []string{"older", "old<2.0.0"},
+		},
+	} {
+		t.Run(packager, func(t *testing.T) {
+			provides := []string{"bar"}
+			info := nfpm.WithDefaults(&nfpm.Info{
+				Name:       "new",
+				Version:    "2.0.0",
+				Prerelease: "rc1",
+				Release:    "3",
+				Epoch:      "1",
+				Renames:    []nfpm.Rename{{From: "older"}, {From: "old", UpToVersion: "2.0.0"}},
+				Overridables: nfpm.Overridables{
+					Provides: provides,
+				},
+			})
+			require.NoError(t, nfpm.Validate(info))
+			require.NoError(t, nfpm.PrepareForPackager(info, packager))
+
+			if packager == "deb" || packager == "archlinux" {
+				require.Equal(t, expected.conflicts, info.Conflicts)
+			} else {
+				require.Empty(t, info.Conflicts)
+			}
+			require.Equal(t, expected.provides, info.Provides)
+			require.Equal(t, expected.replaces, info.Replaces)
+			require.Nil(t, info.Renames)
+			require.Equal(t, []string{"bar"}, provides)
+
+			// it is applied only once
+			require.NoError(t, nfpm.PrepareForPackager(info, packager))
+			require.Equal(t, expected.provides, info.Provides)
+		})
+	}
+
+	for name, rename := range map[string]nfpm.Rename{
+		"empty name":      {},
+		"invalid name":    {From: "old name"},
+		"itself":          {From: "new"},
+		"invalid version": {From: "old", UpToVersion: ">= 2.0"},
+		"no digit":        {From: "old", UpToVersion: "latest"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := nfpm.WithDefaults(&nfpm.Info{Name: "new", Version: "2.0.0", Renames: []nfpm.Rename{rename}})
+			requireCode(t, nfpm.Validate(info), "invalid_rename")
+			requireCode(t, nfpm.PrepareForPackager(info, "deb"), "invalid_rename")
+		})
+	}
+}
+
+func TestIncludeExcludeFormats(t *testing.T) {
+	config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+version: 1.2.3
+contents:
+- src: ./testdata/fake
+  dst: /usr/bin/fake
+- src: ./testdata/whatever.conf
+  dst: /usr/share/selinux/packages/foo.pp
+  include_formats: [rpm]
+- src: ./testdata/whatever.conf
+  dst: /etc/default/foo
+  exclude_formats: [rpm]
+overrides:
+  rpm:
+    depends: [bar]
+`))
+	require.NoError(t, err)
+
+	for format, expected := range map[string][]string{
+		"deb": {"/usr/bin/fake", "/etc/default/foo"},
+		"rpm": {"/usr/bin/fake", "/usr/share/selinux/packages/foo.pp"},
+	} {
+		t.Run(format, func(t *testing.T) {
+			info, err := config.Get(format)
+			require.NoError(t, err)
+			require.NoError(t, nfpm.PrepareForPackager(nfpm.WithDefaults(info), format))
+
+			var dsts []string
+			for _, content := range info.Contents {
+				if content.Type != files.TypeImplicitDir {
+					dsts = append(dsts, content.Destination)
+				}
+			}
+			require.ElementsMatch(t, expected, dsts)
+		})
+	}
+}
+
+func TestInvalidAlternatives(t *testing.T) {
+	for name, alt := range map[string]nfpm.Alternative{
+		"not packaged": {Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin/bar"},
+		"directory":    {Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin"},
+		"relative":     {Name: "editor", Link: "usr/bin/editor", Path: "/usr/bin/fake"},
+		"name":         {Name: "my editor", Link: "/usr/bin/editor", Path: "/usr/bin/fake"},
+		"slave": {
+			Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin/fake",
+			Slaves: []nfpm.AlternativeSlave{{Name: "editor.1.gz", Link: "/usr/share/man/man1/editor.1.gz", Path: "/usr/share/man/man1/fake.1.gz"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := nfpm.WithDefaults(&nfpm.Info{
+				Name:    "foo",
+				Version: "1.2.3",
+				Overridables: nfpm.Overridables{
+					Contents: files.Contents{
+						{Source: "./testdata/fake", Destination: "/usr/bin/fake"},
+						{Destination: "/usr/bin", Type: files.TypeDir},
+					},
+					Alternatives: []nfpm.Alternative{alt},
+				},
+			})
+			err := nfpm.PrepareForPackager(info, "")
+			requireCode(t, err, "invalid_alternative")
+		})
+	}
+}
+
+func TestConventionalContents(t *testing.T) {
+	dir := t.TempDir()
+	src := func(name string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o755))
+		return path
+	}
+	info := &nfpm.Info{
+		Name:    "foo",
+		Version: "1.2.3",
+		Overridables: nfpm.Overridables{
+			Completions: nfpm.Completions{
+				Bash: []string{src("foo.bash"), src("bar")},
+				Zsh:  []string{src("foo.zsh"), src("_bar")},
+				Fish: []string{src("foo.fish"), src("bar")},
+			},
+			ManPages:     []string{src("foo.1"), src("foo.conf.5.gz"), src("Foo::Bar.3pm")},
+			SystemdUnits: []string{src("foo.service"), src("foo.timer")},
+		},
+	}
+
+	for format, zshDir := range map[string]string{
+		"deb": "/usr/share/zsh/vendor-completions",
+		"rpm": "/usr/share/zsh/site-functions",
+	} {
+		t.Run(format, func(t *testing.T) {
+			info := nfpm.WithDefaults(info.Copy())
+			require.NoError(t, nfpm.PrepareForPackager(info, format))
+			require.Empty(t, info.ManPages, "the man pages are only appended once")
+
+			modes := map[string]fs.FileMode{}
+			for _, content := range info.Contents {
+				if content.Type != files.TypeImplicitDir {
+					modes[content.Destination] = content.Mode()
+				}
+			}
+			require.Equal(t, map[string]fs.FileMode{
+				"/usr/share/bash-completion/completions/foo": 0o644,
+				"/usr/share/bash-completion/completions/bar": 0o644,
+				zshDir + "/_foo": 0o644,
+				zshDir + "/_bar": 0o644,
+				"/usr/share/fish/vendor_completions.d/foo.fish": 0o644,
+				"/usr/share/fish/vendor_completions.d/bar.fish": 0o644,
+				"/usr/share/man/man1/foo.1":                     0o644,
+				"/usr/share/man/man5/foo.conf.5.gz":             0o644,
+				"/usr/share/man/man3/Foo::Bar.3pm":              0o644,
+				"/usr/lib/systemd/system/foo.service":           0o644,
+				"/usr/lib/systemd/system/foo.timer":             0o644,
+			}, modes)
+		})
+	}
+
+	for name, overridables := range map[string]nfpm.Overridables{
+		"man page without section": {ManPages: []string{src("foo.txt")}},
+		"unknown unit type":        {SystemdUnits: []string{src("foo.conf")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := nfpm.WithDefaults(&nfpm.Info{Name: "foo", Version: "1.2.3", Overridables: overridables})
+			requireCode(t, nfpm.PrepareForPackager(info, "deb"), "invalid_contents")
+		})
+	}
+}
+
+func TestWithBaseDir(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+
+	// the info is built in code from paths relative to dir, no config is
+	// parsed.
+	newInfo := func(dir string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.2.3",
+			Maintainer: "Foo <foo@bar>",
+			MTime:      mtime,
+			Changelog:  filepath.Join(dir, "changelog.yaml"),
+			Overridables: nfpm.Overridables{
+				Scripts: nfpm.Scripts{PostInstall: filepath.Join(dir, "scripts", "postinstall.sh")},
+				Contents: files.Contents{
+					{Source: filepath.Join(dir, "whatever.conf"), Destination: "/etc/foo/whatever.conf", Type: files.TypeConfig},
+					{Source: filepath.Join(dir, "globtest", "*.txt"), Destination: "/usr/share/foo/"},
+					{Source: filepath.Join(dir, "something"), Destination: "/usr/share/foo/something", Type: files.TypeTree},
+					{Source: "../share/foo/a.txt", Destination: "/usr/bin/foo", Type: files.TypeSymlink},
+				},
+			},
+		})
+	}
+
+	for _, format := range []string{"deb", "rpm"} {
+		t.Run(format, func(t *testing.T) {
+			pkg, err := nfpm.Get(format)
+			require.NoError(t, err)
+
+			require.NoError(t, os.Chdir(wd))
+			var expected bytes.Buffer
+			require.NoError(t, pkg.Package(newInfo("testdata"), &expected))
+
+			require.NoError(t, os.Chdir(t.TempDir()))
+			info := nfpm.WithBaseDir(newInfo(""), filepath.Join(wd, "testdata"))
+			require.NoError(t, nfpm.Validate(info))
+			var actual bytes.Buffer
+			require.NoError(t, pkg.Package(info, &actual))
+			require.Equal(t, expected.Bytes(), actual.Bytes())
+		})
+	}
+
+	t.Run("paths left as is", func(t *testing.T) {
+		info := nfpm.WithBaseDir(&nfpm.Info{Overridables: nfpm.Overridables{
+			Scripts: nfpm.Scripts{PreInstall: "/abs/preinstall.sh"},
+			Contents: files.Contents{
+				{Source: "../lib/foo", Destination: "/usr/bin/foo", Type: files.TypeSymlink},
+				{Source: "https://example.com/foo.tar.gz", Destination: "/opt/foo.tar.gz"},
+				{Source: "foo.conf", Destination: "/etc/foo.conf", FS: fstest.MapFS{}},
+				{Destination: "/etc/bar.conf", Data: []byte("bar")},
+			},
+		}}, "/base")
+		require.Equal(t, "/abs/preinstall.sh", info.Scripts.PreInstall)
+		require.Equal(t, "../lib/foo", info.Contents[0].Source)
+		require.Equal(t, "https://example.com/foo.tar.gz", info.Contents[1].Source)
+		require.Equal(t, "foo.conf", info.Contents[2].Source)
+		require.Empty(t, info.Contents[3].Source)
+	})
+}
+
+func TestReproducibleScriptlets(t *testing.T) {
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+	nfpm.RegisterPackager("apk", apk.Default)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+
+	scripts := []string{"preinstall.sh", "postinstall.sh", "preremove.sh", "postremove.sh"}
+	build := func(t *testing.T, format string, scriptsMTime time.Time) []byte {
+		t.Helper()
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "scripts"), 0o755))
+		for _, script := range scripts {
+			bts, err := os.ReadFile(filepath.Join(wd, "testdata", "scripts", script))
+			require.NoError(t, err)
+			path := filepath.Join(dir, "scripts", script)
+			require.NoError(t, os.WriteFile(path, bts, 0o755))
+			require.NoError(t, os.Chtimes(path, scriptsMTime, scriptsMTime))
+		}
+		require.NoError(t, os.Chdir(dir))
+
+		info := nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.2.3",
+			Maintainer: "Foo <foo@bar>",
+			MTime:      mtime,
+			Overridables: nfpm.Overridables{
+				Scripts: nfpm.Scripts{
+					PreInstall:  "scripts/preinstall.sh",
+					PostInstall: "scripts/postinstall.sh",
+					PreRemove:   "scripts/preremove.sh",
+					PostRemove:  "scripts/postremove.sh",
+				},
+				RPM: nfpm.RPM{
+					ServiceScriptlets: nfpm.RPMServiceScriptlets{
+						Units: []string{"foo.service"},
+					},
+				},
+				Contents: files.Contents{
+					{Destination: "/usr/lib/systemd/system/foo.service", Data: []byte("[Service]\n")},
+				},
+			},
+		})
+
+		pkg, err := nfpm.Get(format)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, pkg.Package(info, &buf))
+		return buf.Bytes()
+	}
+
+	for _, format := range []string{"deb", "rpm", "apk"} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			first := build(t, format, time.Unix(1000, 0))
+			second := build(t, format, time.Unix(2000, 0))
+			require.Equal(t, first, second)
+		})
+	}
+}
+
+func TestPackageConcurrently(t *testing.T) {
+	config := &nfpm.Config{
+		Info: nfpm.Info{
+			Name:        "foo",
+			Arch:        "amd64",
+			Version:     "1.0.0",
+			Maintainer:  "Foo <foo@example.com>",
+			Description: "Foo does things",
+			Changelog:   "./testdata/changelog.yaml",
+			Overridables: nfpm.Overridables{
+				Depends:  []string{"bash"},
+				Replaces: []string{"bar"},
+				Contents: files.Contents{
+					{Source: "./testdata/fake", Destination: "/usr/bin/fake"},
+					{Source: "./testdata/whatever.conf", Destination: "/etc/foo/", Type: files.TypeConfig},
+					{Source: "./testdata/something", Destination: "/usr/share/foo", Type: files.TypeTree},
+					{Source: "./testdata/globtest/**/*", Destination: "/usr/share/glob"},
+				},
+			},
+			Renames: []nfpm.Rename{{From: "oldfoo"}},
+		},
+		Overrides: map[string]*nfpm.Overridables{
+			"rpm": {Depends: []string{"bash", "rpm-only"}},
+		},
+	}
+	base := nfpm.WithDefaults(config.Info.Copy())
+	wantConfig := nfpm.Config{Info: *config.Info.Copy(), Overrides: map[string]*nfpm.Overridables{"rpm": {Depends: []string{"bash", "rpm-only"}}}}
+	wantBase := base.Copy()
+
+	packagers := map[string]nfpm.PackagerWithVerify{
+		"deb": deb.Default,
+		"rpm": rpm.Default,
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*2*len(packagers))
+	for i := 0; i < 4; i++ {
+		for format, pkg := range packagers {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				var buf bytes.Buffer
+				if err := pkg.Package(base, &buf); err != nil {
+					errs <- fmt.Errorf("%s: %w", format, err)
+					return
+				}
+				if err := pkg.Verify(base, bytes.NewReader(buf.Bytes())); err != nil {
+					errs <- fmt.Errorf("%s: verify: %w", format, err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				info, err := nfpm.WithOverrides(config, format)
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", format, err)
+					return
+				}
+				if err := pkg.Package(info, io.Discard); err != nil {
+					errs <- fmt.Errorf("%s: overrides: %w", format, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, wantBase, base)
+	require.Equal(t, wantConfig.Info, config.Info)
+	require.Equal(t, wantConfig.Overrides, config.Overrides)
+}
+
+func TestWithOverrides(t *testing.T) {
+	config := &nfpm.Config{
+		Info: nfpm.Info{
+			Name:    "foo",
+			Version: "1.0.0",
+			Overridables: nfpm.Overridables{
+				Depends: []string{"bash"},
+				Deb:     nfpm.Deb{Fields: map[string]string{"Bugs": "https://example.com"}},
+			},
+		},
+		Overrides: map[string]*nfpm.Overridables{
+			"rpm": {Depends: []string{"zsh"}},
+		},
+	}
+
+	info, err := nfpm.WithOverrides(config, "rpm")
+	require.NoError(t, err)
+	require.Equal(t, []string{"zsh"}, info.Depends)
+	require.Equal(t, "linux", info.Platform, "defaults are set")
+
+	info.Depends[0] = "changed"
+	require.Equal(t, []string{"zsh"}, config.Overrides["rpm"].Depends)
+
+	info, err = nfpm.WithOverrides(config, "deb")
+	require.NoError(t, err)
+	info.Depends[0] = "changed"
+	info.Deb.Fields["Bugs"] = "changed"
+	require.Equal(t, []string{"bash"}, config.Depends)
+	require.Equal(t, "https://example.com", config.Deb.Fields["Bugs"])
+}
+
+func TestTargetDistro(t *testing.T) {
+	lint := func(t *testing.T, distro, format string, suppress []string, contents ...*files.Content) string {
+		t.Helper()
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		info := nfpm.WithDefaults(&nfpm.Info{
+			Name:          "foo",
+			Arch:          "amd64",
+			Version:       "1.0.0",
+			Maintainer:    "Foo <foo@example.com>",
+			TargetDistro:  distro,
+			SuppressLints: suppress,
+			Overridables:  nfpm.Overridables{Contents: contents},
+		})
+		require.NoError(t, nfpm.PrepareForPackager(info, format))
+		return w.String()
+	}
+	file := func(dst string) *files.Content {
+		return &files.Content{Source: "./testdata/whatever.conf", Destination: dst}
+	}
+
+	for _, tc := range []struct {
+		distro, format, dst string
+		expected            string
+	}{
+		{"fedora", "rpm", "/lib/libfoo.so", "target distro fedora: /lib/libfoo.so: fedora has merged /lib into /usr/lib (lint usr-merge)\n"},
+		{"rocky", "rpm", "/sbin/foo", "target distro rocky: /sbin/foo: fedora has merged /sbin into /usr/sbin (lint usr-merge)\n"},
+		{"archlinux", "archlinux", "/bin/foo", "target distro archlinux: /bin/foo: arch has merged /bin into /usr/bin (lint usr-merge)\n"},
+		{"ubuntu", "deb", "/usr/lib64/libfoo.so", "target distro ubuntu: /usr/lib64/libfoo.so: debian installs libraries to /usr/lib, not lib64 (lint lib64)\n"},
+		{"debian", "deb", "/etc/sysconfig/foo", "target distro debian: /etc/sysconfig/foo: debian keeps the service defaults in /etc/default (lint sysconfig)\n"},
+		{"fedora", "rpm", "/etc/default/foo", "target distro fedora: /etc/default/foo: fedora keeps the service defaults in /etc/sysconfig (lint sysconfig)\n"},
+		{"alpine", "apk", "/usr/lib/systemd/system/foo.service", "target distro alpine: /usr/lib/systemd/system/foo.service: alpine uses OpenRC, with its services in /etc/init.d, instead of systemd (lint systemd)\n"},
+		{"fedora", "deb", "/usr/bin/foo", "target distro fedora: fedora packages are rpm, not deb (lint format)\n"},
+		// paths following the conventions
+		{"fedora", "rpm", "/usr/lib64/libfoo.so", ""},
+		{"debian", "deb", "/lib/libfoo.so", ""},
+		{"debian", "deb", "/etc/default/foo", ""},
+		{"alpine", "apk", "/etc/init.d/foo", ""},
+		{"", "deb", "/etc/sysconfig/foo", ""},
+	} {
+		t.Run(tc.distro+"/"+tc.format+tc.dst, func(t *testing.T) {
+			require.Equal(t, tc.expected, lint(t, tc.distro, tc.format, nil, file(tc.dst)))
+		})
+	}
+
+	t.Run("executables", func(t *testing.T) {
+		executable := func(dst, body string) *files.Content {
+			return &files.Content{Destination: dst, Data: []byte(body), FileInfo: &files.ContentFileInfo{Mode: 0o755}}
+		}
+		elf := "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+
+		require.Equal(t,
+			"target distro debian: /usr/bin/foo: executable text file without a shebang, it cannot be executed (lint script-shebang)\n",
+			lint(t, "debian", "deb", nil, executable("/usr/bin/foo", "echo foo\n")),
+		)
+		require.Equal(t,
+			"target distro debian: /opt/foo/sbin/foo: executable text file without a shebang, it cannot be executed (lint script-shebang)\n",
+			lint(t, "debian", "deb", nil, executable("/opt/foo/sbin/foo", "echo foo\n")),
+		)
+		require.Equal(t,
+			"target distro debian: /usr/share/doc/foo/README: executable file with mode 0755 in a directory of non-executable files (lint executable-location)\n",
+			lint(t, "debian", "deb", nil, executable("/usr/share/doc/foo/README", "foo\n")),
+		)
+		require.Equal(t,
+			"target distro debian: /etc/foo.conf: executable file with mode 0755 in a directory of non-executable files (lint executable-location)\n",
+			lint(t, "debian", "deb", nil, executable("/etc/foo.conf", "key = value\n")),
+		)
+		require.Empty(t, lint(t, "debian", "deb", nil,
+			executable("/usr/bin/script", "#!/bin/sh\necho foo\n"),
+			executable("/usr/bin/binary", elf),
+			executable("/usr/lib/foo/helper", "echo foo\n"),
+			executable("/etc/init.d/foo", "#!/sbin/openrc-run\n"),
+			executable("/etc/cron.daily/foo", "#!/bin/sh\n"),
+			file("/usr/bin/config"),
+		))
+		require.Empty(t, lint(t, "debian", "deb", []string{"script-shebang", "executable-location"},
+			executable("/usr/bin/foo", "echo foo\n"),
+			executable("/usr/share/doc/foo/README", "foo\n"),
+		))
+
+		// these lints do not depend on the target distro
+		require.Equal(t,
+			"/usr/bin/foo: executable text file without a shebang, it cannot be executed (lint script-shebang)\n"+
+				"/usr/share/doc/foo/README: executable file with mode 0755 in a directory of non-executable files (lint executable-location)\n",
+			lint(t, "", "rpm", nil,
+				executable("/usr/bin/foo", "echo foo\n"),
+				executable("/usr/share/doc/foo/README", "foo\n"),
+			),
+		)
+		require.Empty(t, lint(t, "", "rpm", []string{"script-shebang", "executable-location"},
+			executable("/usr/bin/foo", "echo foo\n"),
+			executable("/usr/share/doc/foo/README", "foo\n"),
+		))
+	})
+
+	t.Run("conffiles", func(t *testing.T) {
+		config := func(dst string) *files.Content {
+			return &files.Content{Source: "./testdata/whatever.conf", Destination: dst, Type: files.TypeConfig}
+		}
+		require.Equal(t,
+			"target distro debian: /usr/share/foo/whatever.conf: debian expects the conffiles to be below /etc (lint conffile-location)\n",
+			lint(t, "debian", "deb", nil, config("/usr/share/foo/whatever.conf")),
+		)
+		require.Empty(t, lint(t, "debian", "deb", nil, config("/etc/foo/whatever.conf"), file("/usr/share/foo/whatever.conf")))
+		require.Empty(t, lint(t, "fedora", "rpm", nil, config("/usr/share/foo/whatever.conf")))
+		require.Empty(t, lint(t, "", "rpm", nil, config("/usr/share/foo/whatever.conf")))
+
+		// the lint follows the format, not the target distro
+		require.Equal(t,
+			"/usr/share/foo/whatever.conf: debian expects the conffiles to be below /etc (lint conffile-location)\n",
+			lint(t, "", "deb", nil, config("/usr/share/foo/whatever.conf")),
+		)
+		require.Empty(t, lint(t, "debian", "deb", []string{"conffile-location"}, config("/usr/share/foo/whatever.conf")))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		info := nfpm.WithDefaults(&nfpm.Info{
+			Name:         "foo",
+			Arch:         "amd64",
+			Version:      "1.0.0",
+			Maintainer:   "Foo <foo@example.com>",
+			TargetDistro: "debian",
+			StrictLints:  true,
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/whatever.conf", Destination: "/usr/share/foo/whatever.conf", Type: files.TypeConfigNoReplace},
+			}},
+		})
+		var target nfpm.ErrDistroLint
+		require.ErrorAs(t, nfpm.PrepareForPackager(info, "deb"), &target)
+		require.Equal(t, "conffile-location", target.Lint)
+		require.Equal(t, "/usr/share/foo/whatever.conf", target.Path)
+
+		info.SuppressLints = []string{"conffile-location"}
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+	})
+
+	t.Run("suppressed", func(t *testing.T) {
+		require.Empty(t, lint(t, "fedora", "deb", []string{"usr-merge", "format"}, file("/lib/libfoo.so")))
+		require.Equal(t,
+			"target distro fedora: /lib/libfoo.so: fedora has merged /lib into /usr/lib (lint usr-merge)\n",
+			lint(t, "fedora", "deb", []string{"format"}, file("/lib/libfoo.so")),
+		)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		info := &nfpm.Info{Name: "foo", Arch: "amd64", Version: "1.0.0", TargetDistro: "gentoo"}
+		err := nfpm.Validate(info)
+		require.EqualError(t, err, `invalid target distro: "gentoo"`)
+		require.Equal(t, "target_distro", requireCode(t, err, "invalid_target_distro").Field)
+		info = &nfpm.Info{Name: "foo", Arch: "amd64", Version: "1.0.0", TargetDistro: "fedora", SuppressLints: []string{"nope"}}
+		require.EqualError(t, nfpm.Validate(info), `invalid suppressed lint: "nope"`)
+	})
+}
+
+func TestSetLogger(t *testing.T) {
+	var w bytes.Buffer
+	nfpm.SetLogger(slog.New(slog.NewJSONHandler(&w, nil)))
+	t.Cleanup(func() { nfpm.SetLogger(nil) })
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:         "foo",
+		Arch:         "amd64",
+		Version:      "1.0.0",
+		Maintainer:   "Foo <foo@example.com>",
+		TargetDistro: "fedora",
+		Overridables: nfpm.Overridables{Contents: files.Contents{
+			{Source: "./testdata/whatever.conf", Destination: "/lib/libfoo.so"},
+		}},
+	})
+	require.NoError(t, nfpm.PrepareForPackager(info, "rpm"))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(w.Bytes(), &record))
+	require.Equal(t, "WARN", record["level"])
+	require.Equal(t, "target distro fedora: /lib/libfoo.so: fedora has merged /lib into /usr/lib (lint usr-merge)", record["msg"])
+	require.Equal(t, "distro_lint", record["code"])
+	require.Equal(t, "usr-merge", record["lint"])
+	require.Equal(t, "fedora", record["distro"])
+	require.Equal(t, "/lib/libfoo.so", record["path"])
+}
+
+func TestContentPaths(t *testing.T) {
+	info := func(dst string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:          "foo",
+			Arch:          "amd64",
+			Version:       "1.0.0",
+			Maintainer:    "Foo <foo@example.com>",
+			MaxPathLength: 32,
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/whatever.conf", Destination: dst},
+			}},
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, nfpm.PrepareForPackager(info("/usr/share/foo/whatever.conf"), "deb"))
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		err := nfpm.PrepareForPackager(info("/usr/share/foo/bar/baz/whatever.conf"), "deb")
+		pathErr := requireCode(t, err, "invalid_content_path")
+		require.EqualError(t, pathErr, `invalid content path "/usr/share/foo/bar/baz/whatever.conf": is 36 bytes long, longer than the max path length of 32`)
+
+		// as do the implicit directories
+		err = nfpm.PrepareForPackager(info("/usr/share/foo/bar/baz/qux/quux/a"), "deb")
+		require.ErrorContains(t, err, `invalid content path "/usr/share/foo/bar/baz/qux/quux/a": is 33 bytes long`)
+		require.NotContains(t, err.Error(), `"/usr/share/foo/bar/baz/qux/quux"`)
+	})
+
+	t.Run("control characters", func(t *testing.T) {
+		for _, dst := range []string{"/etc/foo\nbar.conf", "/etc/foo\x00.conf", "/etc/foo\tbar.conf"} {
+			err := nfpm.PrepareForPackager(info(dst), "rpm")
+			require.ErrorContains(t, err, fmt.Sprintf("invalid content path %q: contains control characters", dst), dst)
+			requireCode(t, err, "invalid_content_path")
+		}
+	})
+
+	t.Run("relative", func(t *testing.T) {
+		info := info("/etc/foo.conf")
+		info.ContentTransformers = []nfpm.ContentTransformer{func(contents files.Contents) (files.Contents, error) {
+			for _, content := range contents {
+				if content.Destination == "/etc/foo.conf" {
+					content.Destination = "etc/foo.conf"
+				}
+			}
+			return contents, nil
+		}}
+		err := nfpm.PrepareForPackager(info, "apk")
+		require.ErrorContains(t, err, `invalid content path "etc/foo.conf": is not absolute`)
+		requireCode(t, err, "invalid_content_path")
+	})
+
+	t.Run("negative max", func(t *testing.T) {
+		info := info("/etc/foo.conf")
+		info.MaxPathLength = -1
+		err := nfpm.PrepareForPackager(info, "deb")
+		require.EqualError(t, err, "invalid max path length -1: must not be negative")
+		requireCode(t, err, "invalid_max_path_length")
+	})
+}
+
+func TestPathDefaults(t *testing.T) {
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:       "foo",
+		Arch:       "amd64",
+		Version:    "1.0.0",
+		Maintainer: "Foo <foo@example.com>",
+		DefAttr:    nfpm.DefAttr{FileMode: 0o444},
+		PathDefaults: []nfpm.PathDefault{
+			{Prefix: "/etc", FileMode: 0o640, Group: "adm"},
+			{Prefix: "/etc/foo/", FileMode: 0o600, Owner: "foo"},
+			{Prefix: "/usr/bin", FileMode: 0o755},
+			{Prefix: "/usr/share/foo", DirMode: 0o700, Owner: "foo"},
+		},
+		Overridables: nfpm.Overridables{Contents: files.Contents{
+			{Destination: "/etc/bar.conf", Data: []byte("bar")},
+			{Destination: "/etc/foo/foo.conf", Data: []byte("foo")},
+			{Destination: "/etc/foo/explicit.conf", Data: []byte("explicit"), FileInfo: &files.ContentFileInfo{Mode: 0o644, Owner: "root"}},
+			{Destination: "/etc/foobar.conf", Data: []byte("foobar")},
+			{Destination: "/usr/share/foo", Type: files.TypeDir},
+			{Destination: "/usr/share/bar", Type: files.TypeDir},
+			{
+				Source:      ".",
+				Destination: "/usr",
+				Type:        files.TypeTree,
+				FS: fstest.MapFS{
+					"bin/foo":               {Data: []byte("foo"), Mode: 0o644},
+					"lib/foo/libfoo.so":     {Data: []byte("libfoo"), Mode: 0o755},
+					"share/foo/doc/foo.txt": {Data: []byte("doc"), Mode: 0o644},
+				},
+			},
+		}},
+	})
+	require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+
+	type fileInfo struct {
+		Owner, Group string
+		Mode         fs.FileMode
+	}
+	got := map[string]fileInfo{}
+	for _, content := range info.Contents {
+		got[content.Destination] = fileInfo{content.FileInfo.Owner, content.FileInfo.Group, content.FileInfo.Mode.Perm()}
+	}
+	for dst, expected := range map[string]fileInfo{
+		// the longest prefix wins, without the fields of the shorter ones
+		"/etc/bar.conf":     {"root", "adm", 0o640},
+		"/etc/foo/foo.conf": {"foo", "root", 0o600},
+		// the file info of the contents takes precedence
+		"/etc/foo/explicit.conf": {"root", "root", 0o644},
+		// prefixes only match whole path components
+		"/etc/foobar.conf": {"root", "adm", 0o640},
+		// the contents of trees get the defaults of their own destination,
+		// over the defattr and the modes of their sources
+		"/usr/bin/foo":               {"root", "root", 0o755},
+		"/usr/lib/foo/libfoo.so":     {"root", "root", 0o444},
+		"/usr/share/foo/":            {"foo", "root", 0o700},
+		"/usr/share/foo/doc/":        {"foo", "root", 0o700},
+		"/usr/share/foo/doc/foo.txt": {"foo", "root", 0o444},
+		"/usr/share/bar/":            {"root", "root", 0o755},
+		// implicit directories are left as is
+		"/etc/foo/": {"root", "root", 0o755},
+	} {
+		require.Equal(t, expected, got[dst], dst)
+	}
+
+	info.PathDefaults = []nfpm.PathDefault{{Prefix: "/etc", Owner: "foo"}, {Prefix: "/etc/", Group: "foo"}}
+	require.EqualError(t, nfpm.Validate(info), `invalid path default for "/etc/": prefix is already used by another path default`)
+	info.PathDefaults = []nfpm.PathDefault{{Prefix: "etc", Owner: "foo"}}
+	require.EqualError(t, nfpm.Validate(info), `invalid path default for "etc": prefix must be absolute`)
+	info.PathDefaults = []nfpm.PathDefault{{Prefix: "/etc"}}
+	err := nfpm.Validate(info)
+	require.EqualError(t, err, `invalid path default for "/etc": file_mode, dir_mode, owner or group must be set`)
+	requireCode(t, err, "invalid_path_default")
+}
+
+func TestDefaultDirMode(t *testing.T) {
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:           "foo",
+		Arch:           "amd64",
+		Version:        "1.0.0",
+		Maintainer:     "Foo <foo@example.com>",
+		DefaultDirMode: 0o700,
+		DirectoryModes: map[string]files.ContentFileInfo{"/var": {Mode: 0o755}},
+		Overridables: nfpm.Overridables{Contents: files.Contents{
+			{Destination: "/var/lib/foo", Type: files.TypeDir},
+			{Destination: "/var/lib/foo/keys", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Mode: 0o750}},
+			{Destination: "/var/lib/foo/keys/default", Data: []byte("secret")},
+		}},
+	})
+	modes := func(info *nfpm.Info) map[string]fs.FileMode {
+		require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+		got := map[string]fs.FileMode{}
+		for _, content := range info.Contents {
+			got[content.Destination] = content.FileInfo.Mode.Perm()
+		}
+		return got
+	}
+
+	require.Equal(t, map[string]fs.FileMode{
+		// the directory modes take precedence over the default
+		"/var/": 0o755,
+		// implicit directories get the default as well
+		"/var/lib/":                 0o700,
+		"/var/lib/foo/":             0o700,
+		"/var/lib/foo/keys/":        0o750,
+		"/var/lib/foo/keys/default": 0o644,
+	}, modes(info.Copy()))
+
+	// the dir mode of the defattr takes precedence over the default, but
+	// only applies to the explicit directories
+	info.DefAttr.DirMode = 0o711
+	require.Equal(t, map[string]fs.FileMode{
+		"/var/":                     0o755,
+		"/var/lib/":                 0o700,
+		"/var/lib/foo/":             0o711,
+		"/var/lib/foo/keys/":        0o750,
+		"/var/lib/foo/keys/default": 0o644,
+	}, modes(info.Copy()))
+}
+
+func TestFileInfoRefs(t *testing.T) {
+	config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+arch: amd64
+version: 1.0.0
+maintainer: Foo <foo@example.com>
+file_info_templates:
+  exe:
+    mode: 0755
+    owner: foo
+    group: foo
+contents:
+  - src: ./testdata/fake
+    dst: /usr/bin/foo
+    file_info_ref: exe
+  - src: ./testdata/fake
+    dst: /usr/bin/bar
+    file_info_ref: exe
+    file_info:
+      mode: 0700
+      group: bar
+  - src: ./testdata/fake
+    dst: /usr/share/foo/fake
+`))
+	require.NoError(t, err)
+	info, err := nfpm.WithOverrides(&config, "deb")
+	require.NoError(t, err)
+	require.NoError(t, nfpm.PrepareForPackager(info, "deb"))
+
+	type fileInfo struct {
+		Owner, Group string
+		Mode         fs.FileMode
+	}
+	got := map[string]fileInfo{}
+	for _, content := range info.Contents {
+		got[content.Destination] = fileInfo{content.FileInfo.Owner, content.FileInfo.Group, content.FileInfo.Mode.Perm()}
+	}
+	require.Equal(t, fileInfo{"foo", "foo", 0o755}, got["/usr/bin/foo"])
+	// the file info of the content takes precedence over the template
+	require.Equal(t, fileInfo{"foo", "bar", 0o700}, got["/usr/bin/bar"])
+	require.Equal(t, "root", got["/usr/share/foo/fake"].Owner)
+	// the template itself is left as is
+	require.Equal(t, files.ContentFileInfo{Mode: 0o755, Owner: "foo", Group: "foo"}, config.FileInfoTemplates["exe"])
+
+	config.Contents[2].FileInfoRef = "lib"
+	err = config.Validate()
+	require.ErrorContains(t, err, `unknown file info template "lib"`)
+	requireCode(t, err, "unknown_file_info_template")
+	info, err = nfpm.WithOverrides(&config, "deb")
+	require.NoError(t, err)
+	requireCode(t, nfpm.PrepareForPackager(info, "deb"), "unknown_file_info_template")
+}
+
+func TestFileInfoOverrides(t *testing.T) {
+	config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+arch: amd64
+version: 1.0.0
+maintainer: Foo <foo@example.com>
+path_defaults:
+  - prefix: /usr/bin
+    file_mode: 0755
+contents:
+  - src: ./testdata/fake
+    dst: /usr/bin/foo
+    file_info:
+      overrides:
+        rpm:
+          mode: 0700
+          owner: foo
+`))
+	require.NoError(t, err)
+
+	for format, expected := range map[string]struct {
+		owner string
+		mode  fs.FileMode
+	}{
+		"rpm": {"foo", 0o700},
+		"deb": {"root", 0o755},
+	} {
+		t.Run(format, func(t *testing.T) {
+			info, err := config.Get(format)
+			require.NoError(t, err)
+			info = nfpm.WithDefaults(info)
+			require.NoError(t, nfpm.PrepareForPackager(info, format))
+			for _, content := range info.Contents {
+				if content.Destination == "/usr/bin/foo" {
+					require.Equal(t, expected.owner, content.FileInfo.Owner)
+					require.Equal(t, expected.mode, content.FileInfo.Mode.Perm())
+				}
+			}
+		})
+	}
+}
+func TestBuilder(t *testing.T) {
+	info, err := nfpm.NewBuilder("foo", "1.0.0").
+		Arch("amd64").
+		Maintainer("Foo <foo@example.com>").
+		Description("Foo does things").
+		AddFile("./testdata/fake", "/usr/bin/fake").
+		AddConfig("./testdata/whatever.conf", "/etc/fake/fake.conf").
+		AddSymlink("/usr/bin/fake", "/usr/bin/fake2").
+		AddDir("/var/lib/fake").
+		DependsOn("bash", "libfoo >= 1").
+		Conflicts("oldfoo").
+		With(func(info *nfpm.Info) { info.Deb.Compression = "xz" }).
+		Build()
+	require.NoError(t, err)
+
+	config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+version: 1.0.0
+arch: amd64
+maintainer: Foo <foo@example.com>
+description: Foo does things
+contents:
+  - src: ./testdata/fake
+    dst: /usr/bin/fake
+  - src: ./testdata/whatever.conf
+    dst: /etc/fake/fake.conf
+    type: config
+  - src: /usr/bin/fake
+    dst: /usr/bin/fake2
+    type: symlink
+  - dst: /var/lib/fake
+    type: dir
+depends:
+  - bash
+  - libfoo >= 1
+conflicts:
+  - oldfoo
+deb:
+  compression: xz
+`))
+	require.NoError(t, err)
+	require.Equal(t, &config.Info, info)
+
+	var buf bytes.Buffer
+	require.NoError(t, deb.Default.Package(info, &buf))
+}
+
+func TestBuilderErrors(t *testing.T) {
+	_, err := nfpm.NewBuilder("foo", "1.0.0").
+		AddFile("", "/usr/bin/foo").
+		AddConfig("./testdata/whatever.conf", "").
+		DependsOn("bar >= 2", "bar < 1").
+		Build()
+	require.ErrorContains(t, err, "package src must be provided")
+	require.ErrorContains(t, err, "package dst must be provided")
+	require.ErrorContains(t, err, `invalid dependency on "bar"`)
+
+	// the info is validated as a whole once built
+	_, err = nfpm.NewBuilder("", "1.0.0").AddDir("/var/lib/foo").Build()
+	require.EqualError(t, err, "package name must be provided")
+	require.Equal(t, "name", requireCode(t, err, "missing_field").Field)
+}
+
+func TestStagingRoot(t *testing.T) {
+	destdir := t.TempDir()
+	for name, body := range map[string]string{
+		"usr/bin/foo":                   "#!/bin/sh\n",
+		"usr/share/doc/foo/README":      "foo\n",
+		"usr/share/locale/fr/foo.mo":    "fr\n",
+		"etc/foo.conf":                  "foo=bar\n",
+		"etc/foo.d/.hidden":             "hidden\n",
+		"usr/lib/systemd/foo.service":   "[Unit]\n",
+		"opt/unstaged/should-not-be-in": "x\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(destdir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(destdir, name), []byte(body), 0o644))
+	}
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:        "foo",
+		Arch:        "amd64",
+		Version:     "1.0.0",
+		Maintainer:  "Foo <foo@example.com>",
+		StagingRoot: destdir,
+		Overridables: nfpm.Overridables{Contents: files.Contents{
+			{Source: filepath.Join(destdir, "{usr,etc}", "**")},
+			// the files listed separately are left out of the glob
+			{Source: filepath.Join(destdir, "etc/foo.conf"), Type: files.TypeConfigNoReplace},
+			// and the contents with a destination are left as is
+			{Source: "./testdata/whatever.conf", Destination: "/etc/whatever.conf"},
+		}},
+	})
+	require.NoError(t, nfpm.Validate(info))
+	prepared := info.Copy()
+	require.NoError(t, nfpm.PrepareForPackager(prepared, "deb"))
+
+	got := map[string]string{}
+	for _, content := range prepared.Contents {
+		if content.Type != files.TypeImplicitDir {
+			got[content.Destination] = content.Type
+		}
+	}
+	require.Equal(t, map[string]string{
+		"/usr/bin/foo":                 files.TypeFile,
+		"/usr/share/doc/foo/README":    files.TypeFile,
+		"/usr/share/locale/fr/foo.mo":  files.TypeFile,
+		"/usr/lib/systemd/foo.service": files.TypeFile,
+		"/etc/foo.conf":                files.TypeConfigNoReplace,
+		"/etc/foo.d/.hidden":           files.TypeFile,
+		"/etc/whatever.conf":           files.TypeFile,
+	}, got)
+
+	var buf bytes.Buffer
+	require.NoError(t, deb.Default.Package(info, &buf))
+	require.NoError(t, deb.Default.Verify(info, bytes.NewReader(buf.Bytes())))
+
+	info.StagingRoot = filepath.Join(destdir, "usr/bin/foo")
+	require.ErrorIs(t, nfpm.PrepareForPackager(info, "deb"), files.ErrInvalidStagingRoot)
+}
+
+func TestGhostFiles(t *testing.T) {
+	info := func() *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.0.0",
+			Maintainer: "Foo <foo@example.com>",
+			Overridables: nfpm.Overridables{Contents: files.Contents{
+				{Source: "./testdata/whatever.conf", Destination: "/etc/foo.conf"},
+				{Destination: "/var/lib/foo/state", Type: files.TypeRPMGhost, Touch: true},
+				{Destination: "/var/log/foo.log", Type: files.TypeRPMGhost},
+			}},
+		})
+	}
+
+	// rpm lists the ghost files without shipping them, and the other
+	// packagers leave them out entirely, which Verify checks.
+	for format, pkg := range map[string]nfpm.PackagerWithVerify{"deb": deb.Default, "rpm": rpm.Default, "apk": apk.Default} {
+		t.Run(format, func(t *testing.T) {
+			info := info()
+			var buf bytes.Buffer
+			require.NoError(t, pkg.Package(info, &buf))
+			require.NoError(t, pkg.Verify(info, bytes.NewReader(buf.Bytes())))
+		})
+	}
+
+	t.Run("archlinux", func(t *testing.T) {
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		require.NoError(t, arch.Default.Package(info(), io.Discard))
+		require.Equal(t, "/var/lib/foo/state: touch is not supported by archlinux packages, ignoring it\n", w.String())
+	})
+}
+
+func TestPackageName(t *testing.T) {
+	config, err := nfpm.Parse(strings.NewReader(`
+name: foo
+arch: amd64
+version: 1.0.0
+maintainer: Foo <foo@example.com>
+deb:
+  package_name: libfoo0
+rpm:
+  package_name: foo-libs
+`))
+	require.NoError(t, err)
+	info, err := config.Get("")
+	require.NoError(t, err)
+
+	for format, expected := range map[string]string{
+		"deb": "libfoo0_1.0.0_amd64.deb",
+		"rpm": "foo-libs-1.0.0-1.x86_64.rpm",
+		"apk": "foo_1.0.0_x86_64.apk",
+	} {
+		t.Run(format, func(t *testing.T) {
+			pkg, err := nfpm.Get(format)
+			require.NoError(t, err)
+			require.Equal(t, expected, pkg.ConventionalFileName(info))
+
+			var buf bytes.Buffer
+			require.NoError(t, pkg.Package(nfpm.WithDefaults(info.Copy()), &buf))
+			if pkg, ok := pkg.(nfpm.PackagerWithVerify); ok {
+				require.NoError(t, pkg.Verify(nfpm.WithDefaults(info.Copy()), bytes.NewReader(buf.Bytes())))
+			}
+		})
+	}
+	require.Equal(t, "foo", info.Name)
+}
+
+func TestServiceUnits(t *testing.T) {
+	info := func(units ...string) *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.0.0",
+			Maintainer: "Foo <foo@example.com>",
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Destination: "/usr/lib/systemd/system/foo.service", Data: []byte("[Service]\n")},
+					{Destination: "/usr/lib/systemd/system/foo.socket", Data: []byte("[Socket]\n")},
+					{Destination: "/usr/lib/systemd/system/bar@.service", Data: []byte("[Service]\n")},
+					{Destination: "/usr/share/foo/baz.service", Data: []byte("[Service]\n")},
+				},
+				RPM: nfpm.RPM{ServiceScriptlets: nfpm.RPMServiceScriptlets{Units: units}},
+			},
+		})
+	}
+
+	t.Run("shipped", func(t *testing.T) {
+		info := info("foo.service", "foo.socket", "foo", "bar@1.service")
+		require.NoError(t, nfpm.Validate(info))
+		require.NoError(t, rpm.Default.Package(info, io.Discard))
+	})
+
+	for _, unit := range []string{"missing.service", "foo.timer", "bar.service", "baz.service"} {
+		t.Run(unit, func(t *testing.T) {
+			info := info("foo.service", unit)
+			err := nfpm.Validate(info)
+			require.ErrorContains(t, err, fmt.Sprintf("service unit %q is not a file of the package", unit))
+			requireCode(t, err, "missing_service_unit")
+			requireCode(t, rpm.Default.Package(info, io.Discard), "missing_service_unit")
+
+			// the units are only enabled by the rpm scriptlets
+			require.NoError(t, deb.Default.Package(info, io.Discard))
+		})
+	}
+}
+
+func TestAutoDeps(t *testing.T) {
+	info := func() *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.0.0",
+			Maintainer: "Foo <foo@example.com>",
+			AutoDeps:   true,
+			Overridables: nfpm.Overridables{
+				Depends: []string{"bash"},
+				Contents: files.Contents{
+					{Source: "./testdata/shlibs/foo", Destination: "/usr/bin/foo"},
+					{Source: "./testdata/shlibs/libfoo.so.1.2.3", Destination: "/usr/lib/libfoo.so.1.2.3"},
+				},
+			},
+		})
+	}
+
+	for format, expected := range map[string]struct{ provides, depends []string }{
+		"rpm":       {[]string{"libfoo.so.1()(64bit)"}, []string{"bash", "libbar.so.2()(64bit)"}},
+		"apk":       {[]string{"so:libfoo.so.1=1.2.3"}, []string{"bash", "so:libbar.so.2"}},
+		"archlinux": {[]string{"libfoo.so=1-64"}, []string{"bash"}},
+		"deb":       {nil, []string{"bash"}},
+	} {
+		t.Run(format, func(t *testing.T) {
+			info := info()
+			require.NoError(t, nfpm.PrepareForPackager(info, format))
+			require.Equal(t, expected.provides, info.Provides)
+			require.Equal(t, expected.depends, info.Depends)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		info := info()
+		info.AutoDeps = false
+		require.NoError(t, nfpm.PrepareForPackager(info, "rpm"))
+		require.Empty(t, info.Provides)
+		require.Equal(t, []string{"bash"}, info.Depends)
+	})
+
+	t.Run("packages", func(t *testing.T) {
+		for format, pkg := range map[string]nfpm.Packager{"deb": deb.Default, "rpm": rpm.Default, "apk": apk.Default, "archlinux": arch.Default} {
+			require.NoError(t, pkg.Package(info(), io.Discard), format)
+		}
+	})
+}
+
+func TestScriptlets(t *testing.T) {
+	nfpm.RegisterPackager("apk", apk.Default)
+	nfpm.RegisterPackager("archlinux", arch.Default)
+	nfpm.RegisterPackager("deb", deb.Default)
+	nfpm.RegisterPackager("rpm", rpm.Default)
+	nfpm.RegisterPackager("TestScriptlets", &fakePackager{})
+
+	info := func() *nfpm.Info {
+		return nfpm.WithDefaults(&nfpm.Info{
+			Name:       "foo",
+			Arch:       "amd64",
+			Version:    "1.0.0",
+			Maintainer: "Foo <foo@example.com>",
+			Overridables: nfpm.Overridables{
+				Contents: files.Contents{
+					{Destination: "/usr/bin/foo", Data: []byte("#!/bin/sh\n")},
+					{Destination: "/usr/lib/systemd/system/foo.service", Data: []byte("[Service]\n")},
+				},
+				Alternatives: []nfpm.Alternative{
+					{Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin/foo", Priority: 50},
+				},
+				Scripts: nfpm.Scripts{
+					PostInstall: "./testdata/scripts/postinstall.sh",
+					PreRemove:   "./testdata/scripts/preremove.sh",
+				},
+				RPM: nfpm.RPM{ServiceScriptlets: nfpm.RPMServiceScriptlets{Units: []string{"foo.service"}}},
+			},
+		})
+	}
+
+	for _, format := range []string{"apk", "archlinux", "deb", "rpm"} {
+		t.Run(format, func(t *testing.T) {
+			scriptlets, err := nfpm.Scriptlets(info(), format)
+			require.NoError(t, err)
+
+			var b strings.Builder
+			for _, name := range maps.Keys(scriptlets) {
+				fmt.Fprintf(&b, "==> %s <==\n%s\n", name, scriptlets[name])
+			}
+			golden := filepath.Join("testdata", "scriptlets", format+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(b.String()), 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), b.String())
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := nfpm.Scriptlets(info(), "TestScriptlets")
+		require.ErrorIs(t, err, nfpm.ErrScriptletsNotSupported)
+	})
+}
@@ -0,0 +1,99 @@
+package rpm
+
+import (
+	"crypto/md5" // nolint:gosec
+	"fmt"
+	"strings"
+
+	"github.com/google/rpmpack"
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
+)
+
+// The rpm versions that introduced the features nfpm uses, see
+// nfpm.Info.MinToolVersion.
+const (
+	minVersionSHA256Digests    = "4.6.0"
+	minVersionWeakDependencies = "4.12.0"
+)
+
+// compressionVersions are the rpm versions that introduced the payload
+// compressions, and compressionFallbacks the compressions used instead by
+// older versions.
+// nolint: gochecknoglobals
+var (
+	compressionVersions = map[string]string{
+		"lzma": "4.6.0",
+		"xz":   "4.7.0",
+		"zstd": "4.14.0",
+	}
+	compressionFallbacks = map[string]string{
+		"lzma": "gzip",
+		"xz":   "gzip",
+		"zstd": "xz",
+	}
+)
+
+// supports reports whether the oldest rpm version the package must install
+// with, if any, is at least the given one.
+func supports(info *nfpm.Info, version string) bool {
+	minVersion, ok := info.MinToolVersion[packagerName]
+	return !ok || vercmp.RPM(minVersion, version) >= 0
+}
+
+// applyMinToolVersion falls back to the payload compression the oldest rpm
+// version the package must install with supports, and leaves out the weak
+// dependencies if it does not, warning about each of them. The file digests
+// are handled by addFileDigests.
+func applyMinToolVersion(info *nfpm.Info) {
+	minVersion, ok := info.MinToolVersion[packagerName]
+	if !ok {
+		return
+	}
+
+	compression := info.RPM.Compression
+	for {
+		algo, _, _ := strings.Cut(compression, ":")
+		version, ok := compressionVersions[algo]
+		if !ok || supports(info, version) {
+			break
+		}
+		compression = compressionFallbacks[algo]
+	}
+	if compression != info.RPM.Compression {
+		warning.Printf("rpm %s does not support %s payloads, using %s instead", minVersion, info.RPM.Compression, compression)
+		info.RPM.Compression = compression
+	}
+
+	if !supports(info, minVersionWeakDependencies) && (len(info.Recommends) > 0 || len(info.Suggests) > 0) {
+		warning.Printf("rpm %s does not support weak dependencies, leaving out recommends %v and suggests %v", minVersion, info.Recommends, info.Suggests)
+		info.Recommends = nil
+		info.Suggests = nil
+	}
+}
+
+// addFileDigests replaces the sha256 digests of the files rpmpack records
+// with md5 ones, in the order rpmpack writes the files in, if the oldest rpm
+// version the package must install with does not support sha256 digests.
+func addFileDigests(info *nfpm.Info, rpm *rpmpack.RPM, added map[string]rpmpack.RPMFile) {
+	if supports(info, minVersionSHA256Digests) {
+		return
+	}
+	warning.Printf("rpm %s does not support sha256 file digests, using md5 instead", info.MinToolVersion[packagerName])
+
+	names := fileOrder(added)
+	digests := make([]string, 0, len(names))
+	algos := make([]int32, 0, len(names))
+	for _, name := range names {
+		file := added[name]
+		digest := ""
+		if file.Mode&0o40000 == 0 && file.Mode&0o120000 != 0o120000 {
+			digest = fmt.Sprintf("%x", md5.Sum(file.Body)) // nolint:gosec
+		}
+		digests = append(digests, digest)
+		algos = append(algos, hashAlgoMD5)
+	}
+	rpm.AddCustomTag(tagFileDigests, rpmpack.EntryStringSlice(digests))
+	rpm.AddCustomTag(tagFileDigestAlgo, rpmpack.EntryInt32(algos))
+}
@@ -0,0 +1,82 @@
+package rpm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/caarlos0/go-rpmutils"
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/internal/sign"
+)
+
+// Resign writes the rpm package read from r to w with its signature header
+// rewritten to hold new signatures of the header and of the header and
+// payload, made like rpmpack does with the signature of the given info. The
+// header and the payload are copied as is.
+func (*RPM) Resign(info *nfpm.Info, r io.Reader, w io.Writer) (err error) {
+	// rpmutils panics on some malformed headers instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading rpm: %v", r)
+		}
+	}()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	header, err := rpmutils.ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	signer := sign.PGPSignerWithKeyID(
+		sign.SignatureKey(info.RPM.Signature.PackageSignature),
+		info.RPM.Signature.KeyPassphrase,
+		info.RPM.Signature.KeyID,
+	)
+	if signFn := info.RPM.Signature.SignFn; signFn != nil {
+		signer = func(data []byte) ([]byte, error) {
+			return signFn(bytes.NewReader(data))
+		}
+	}
+	headerRange := header.GetRange()
+	sigRSA, err := signer(data[headerRange.Start:headerRange.End])
+	if err != nil {
+		return &nfpm.ErrSigningFailure{Err: err}
+	}
+	sigPGP, err := signer(data[headerRange.Start:])
+	if err != nil {
+		return &nfpm.ErrSigningFailure{Err: err}
+	}
+
+	// rpmutils can only rewrite the signature header of files.
+	dir, err := os.MkdirTemp("", "nfpm-resign")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "package.rpm")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+	if _, err := rpmutils.RewriteWithSignatures(f, path, sigPGP, sigRSA); err != nil {
+		return &nfpm.ErrSigningFailure{Err: fmt.Errorf("rewriting signature header: %w", err)}
+	}
+
+	resigned, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer resigned.Close() // nolint: errcheck
+	_, err = io.Copy(w, resigned)
+	return err
+}
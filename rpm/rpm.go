@@ -4,9 +4,13 @@ package rpm
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -15,8 +19,12 @@ import (
 	"github.com/goreleaser/chglog"
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/maps"
 	"github.com/goreleaser/nfpm/v2/internal/modtime"
 	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/sparse"
+	"github.com/goreleaser/nfpm/v2/internal/vercmp"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 )
 
 const (
@@ -26,6 +34,44 @@ const (
 	tagChangelogName = 1081
 	// https://github.com/rpm-software-management/rpm/blob/master/lib/rpmtag.h#L154
 	tagChangelogText = 1082
+	// RPMTAG_FILEUIDS and RPMTAG_FILEGIDS, see addFileIDs.
+	tagFileUIDs = 1031
+	tagFileGIDs = 1032
+	// RPMTAG_FILELANGS, which rpmpack leaves empty, see addFileLangs.
+	tagFileLangs = 1097
+	// RPMTAG_FILEDIGESTS, which rpmpack sets to sha256 digests, see
+	// addFileDigests.
+	tagFileDigests = 1035
+	// RPMTAG_DISTRIBUTION, which rpmpack does not set.
+	tagDistribution = 1010
+	// RPMTAG_SOURCERPM, which rpmpack sets to the conventional name.
+	tagSourceRPM = 1044
+	// RPMTAG_PAYLOADFLAGS, which rpm sets to the compression level.
+	tagPayloadFlags = 1126
+	// RPMTAG_PREINFLAGS to RPMTAG_VERIFYSCRIPTFLAGS, see addScriptFlags.
+	tagPreInFlags        = 5020
+	tagPostInFlags       = 5021
+	tagPreUnFlags        = 5022
+	tagPostUnFlags       = 5023
+	tagPreTransFlags     = 5024
+	tagPostTransFlags    = 5025
+	tagVerifyScriptFlags = 5026
+	// RPMTAG_PREINPROG to RPMTAG_POSTTRANSPROG, see addScriptProg.
+	tagPreInProg        = 1085
+	tagPostInProg       = 1086
+	tagPreUnProg        = 1087
+	tagPostUnProg       = 1088
+	tagVerifyScriptProg = 1091
+	tagPreTransProg     = 1153
+	tagPostTransProg    = 1154
+
+	// zstd levels, negative ones being the fast levels of zstd(1).
+	minZstdLevel = -7
+	maxZstdLevel = 22
+
+	// defaultBuildHost is recorded instead of the host name, which would
+	// make the packages differ between machines.
+	defaultBuildHost = "localhost"
 
 	// Symbolic link
 	tagLink = 0o120000
@@ -70,7 +116,15 @@ var archToRPM = map[string]string{
 	// TODO: other arches
 }
 
+// setDefaults returns a copy of info with the name of the rpm package, the
+// arch translated to the one of rpm and the release and group defaults set.
+// The given info is not modified.
 func setDefaults(info *nfpm.Info) *nfpm.Info {
+	cp := *info
+	info = &cp
+	if info.RPM.PackageName != "" {
+		info.Name = info.RPM.PackageName
+	}
 	if info.RPM.Arch != "" {
 		info.Arch = info.RPM.Arch
 	} else if arch, ok := archToRPM[info.Arch]; ok {
@@ -79,14 +133,29 @@ func setDefaults(info *nfpm.Info) *nfpm.Info {
 
 	info.Release = defaultTo(info.Release, "1")
 
+	if category, ok := info.ResolveCategory(); ok {
+		info.RPM.Group = defaultTo(info.RPM.Group, category.Group)
+	}
+
 	return info
 }
 
+// prepareInfo returns a copy of info prepared for the packager, so that the
+// given info is left as is and can be reused.
+func prepareInfo(info *nfpm.Info) (*nfpm.Info, error) {
+	info = setDefaults(info.Copy())
+	if err := nfpm.PrepareForPackager(info, packagerName); err != nil {
+		return nil, err
+	}
+	applyMinToolVersion(info)
+	return info, nil
+}
+
 // ConventionalFileName returns a file name according
 // to the conventions for RPM packages. See:
 // http://ftp.rpm.org/max-rpm/ch-rpm-file-format.html
 func (*RPM) ConventionalFileName(info *nfpm.Info) string {
-	info = setDefaults(info)
+	info = setDefaults(nfpm.WithSnapshot(info, packagerName))
 
 	// name-version-release.architecture.rpm
 	return fmt.Sprintf(
@@ -103,15 +172,22 @@ func (*RPM) ConventionalExtension() string {
 	return ".rpm"
 }
 
+// Capabilities returns the features of RPM packages, see nfpm.Formats.
+func (*RPM) Capabilities() nfpm.Capabilities {
+	return nfpm.Capabilities{
+		Compressions:     []string{"gzip", "lzma", "xz", "zstd"},
+		Signing:          true,
+		WeakDependencies: true,
+	}
+}
+
 // Package writes a new RPM package to the given writer using the given info.
 func (*RPM) Package(info *nfpm.Info, w io.Writer) (err error) {
 	var (
 		meta *rpmpack.RPMMetaData
 		rpm  *rpmpack.RPM
 	)
-	info = setDefaults(info)
-
-	err = nfpm.PrepareForPackager(info, packagerName)
+	info, err = prepareInfo(info)
 	if err != nil {
 		return err
 	}
@@ -122,10 +198,19 @@ func (*RPM) Package(info *nfpm.Info, w io.Writer) (err error) {
 	if rpm, err = rpmpack.NewRPM(*meta); err != nil {
 		return err
 	}
+	if flags := payloadFlags(info.RPM.Compression); flags != "" {
+		rpm.AddCustomTag(tagPayloadFlags, rpmpack.EntryString(flags))
+	}
+	if info.RPM.Distribution != "" {
+		rpm.AddCustomTag(tagDistribution, rpmpack.EntryString(info.RPM.Distribution))
+	}
+	if info.RPM.SourceRPM != "" {
+		rpm.AddCustomTag(tagSourceRPM, rpmpack.EntryString(info.RPM.SourceRPM))
+	}
 
-	if info.RPM.Signature.KeyFile != "" {
+	if info.RPM.Signature.HasKey() {
 		rpm.SetPGPSigner(sign.PGPSignerWithKeyID(
-			info.RPM.Signature.KeyFile,
+			sign.SignatureKey(info.RPM.Signature.PackageSignature),
 			info.RPM.Signature.KeyPassphrase,
 			info.RPM.Signature.KeyID,
 		))
@@ -154,7 +239,7 @@ func (*RPM) Package(info *nfpm.Info, w io.Writer) (err error) {
 }
 
 func addChangeLog(info *nfpm.Info, rpm *rpmpack.RPM) error {
-	changelog, err := info.GetChangeLog()
+	changelog, err := info.GetSortedChangeLog(evr(info), vercmp.RPM)
 	if err != nil {
 		return fmt.Errorf("reading changelog: %w", err)
 	}
@@ -208,6 +293,18 @@ func buildRPMMeta(info *nfpm.Info) (*rpmpack.RPMMetaData, error) {
 	if info.RPM.Compression == "" {
 		info.RPM.Compression = "gzip:-1"
 	}
+	if err := validateCompression(info.RPM.Compression); err != nil {
+		return nil, err
+	}
+	if err := validateBuildHost(info.RPM.BuildHost); err != nil {
+		return nil, err
+	}
+	if err := validateScriptFlags(info.RPM.ScriptFlags); err != nil {
+		return nil, err
+	}
+	if err := validateSourceRPM(info.RPM.SourceRPM); err != nil {
+		return nil, err
+	}
 
 	if info.Epoch == "" {
 		epoch = uint64(rpmpack.NoEpoch)
@@ -225,7 +322,9 @@ func buildRPMMeta(info *nfpm.Info) (*rpmpack.RPMMetaData, error) {
 	if recommends, err = toRelation(info.Recommends); err != nil {
 		return nil, err
 	}
-	if replaces, err = toRelation(info.Replaces); err != nil {
+	// obsoletes are how rpm replaces other packages, so both end up in the
+	// same tag.
+	if replaces, err = toRelation(append(slices.Clone(info.Replaces), info.RPM.Obsoletes...)); err != nil {
 		return nil, err
 	}
 	if suggests, err = toRelation(info.Suggests); err != nil {
@@ -235,15 +334,10 @@ func buildRPMMeta(info *nfpm.Info) (*rpmpack.RPMMetaData, error) {
 		return nil, err
 	}
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		return nil, err
-	}
-
 	return &rpmpack.RPMMetaData{
 		Name:        info.Name,
 		Summary:     defaultTo(info.RPM.Summary, strings.Split(info.Description, "\n")[0]),
-		Description: info.Description,
+		Description: describeWithMetadata(info.Description, info.Metadata),
 		Version:     formatVersion(info),
 		Release:     defaultTo(info.Release, "1"),
 		Epoch:       uint32(epoch),
@@ -262,11 +356,157 @@ func buildRPMMeta(info *nfpm.Info) (*rpmpack.RPMMetaData, error) {
 		Suggests:    suggests,
 		Conflicts:   conflicts,
 		Compressor:  info.RPM.Compression,
-		BuildTime:   modtime.Get(info.MTime),
-		BuildHost:   hostname,
+		BuildTime:   modtime.Get(info.MTime, modtime.FromEnv()),
+		BuildHost:   defaultTo(info.RPM.BuildHost, defaultBuildHost),
 	}, nil
 }
 
+// ErrInvalidBuildHost happens when the build host is not a valid host name.
+var ErrInvalidBuildHost = errors.New("invalid build host")
+
+// nolint: gochecknoglobals
+var buildHostRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+func validateBuildHost(host string) error {
+	if host != "" && (len(host) > 253 || !buildHostRegexp.MatchString(host)) {
+		return fmt.Errorf("%w: %q", ErrInvalidBuildHost, host)
+	}
+	return nil
+}
+
+// ErrInvalidSourceRPM happens when the source rpm is not the file name of a
+// source rpm.
+var ErrInvalidSourceRPM = errors.New("invalid source rpm")
+
+func validateSourceRPM(name string) error {
+	if name == "" {
+		return nil
+	}
+	if strings.ContainsAny(name, "/ \t\n") ||
+		!strings.HasSuffix(name, ".src.rpm") && !strings.HasSuffix(name, ".nosrc.rpm") {
+		return fmt.Errorf("%w: %q, must be a file name ending in .src.rpm or .nosrc.rpm", ErrInvalidSourceRPM, name)
+	}
+	return nil
+}
+
+// ErrInvalidScriptFlag happens when a scriptlet flag is not one of the
+// RPMSCRIPT_FLAG_* flags of rpm.
+var ErrInvalidScriptFlag = errors.New("invalid script flag")
+
+// scriptFlags are the RPMSCRIPT_FLAG_* values of the flags.
+// nolint: gochecknoglobals
+var scriptFlags = map[string]uint32{
+	"expand":   1 << 0,
+	"qformat":  1 << 1,
+	"critical": 1 << 2,
+}
+
+// scriptFlagsValue returns the bitmask of the given scriptlet flags.
+func scriptFlagsValue(script string, flags []string) (uint32, error) {
+	var value uint32
+	for _, flag := range flags {
+		bit, ok := scriptFlags[flag]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s: %q, must be one of expand, qformat or critical", ErrInvalidScriptFlag, script, flag)
+		}
+		value |= bit
+	}
+	return value, nil
+}
+
+// addScriptProg records the interpreter of a scriptlet the package has,
+// which rpmpack always sets to the default shell.
+func addScriptProg(rpm *rpmpack.RPM, tag int, shell string) {
+	if shell != nfpm.DefaultScriptShell {
+		rpm.AddCustomTag(tag, rpmpack.EntryString(shell))
+	}
+}
+
+// addScriptFlags records the flags of a scriptlet the package has. rpmpack
+// does not write the flags tags, which rpm reads as no flags when missing.
+func addScriptFlags(rpm *rpmpack.RPM, tag int, script string, flags []string) error {
+	value, err := scriptFlagsValue(script, flags)
+	if err != nil || value == 0 {
+		return err
+	}
+	rpm.AddCustomTag(tag, rpmpack.EntryUint32([]uint32{value}))
+	return nil
+}
+
+func validateScriptFlags(flags nfpm.RPMScriptFlags) error {
+	for script, f := range map[string][]string{
+		"preinstall":  flags.PreInstall,
+		"postinstall": flags.PostInstall,
+		"preremove":   flags.PreRemove,
+		"postremove":  flags.PostRemove,
+		"pretrans":    flags.PreTrans,
+		"posttrans":   flags.PostTrans,
+		"verify":      flags.Verify,
+	} {
+		if _, err := scriptFlagsValue(script, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrInvalidCompression happens when the compression level is out of the
+// range supported by the compression algorithm, or the algorithm is not
+// supported by rpm payloads.
+var ErrInvalidCompression = errors.New("invalid compression")
+
+func validateCompression(compression string) error {
+	algorithm, level, ok := strings.Cut(compression, ":")
+	if algorithm == "none" {
+		// rpm has no payload compressor for stored payloads, unlike the
+		// data.tar of debs.
+		return fmt.Errorf("%w: %s: rpm payloads are always compressed, use gzip, lzma, xz or zstd", ErrInvalidCompression, compression)
+	}
+	if algorithm != "zstd" || !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(level)
+	if err != nil {
+		// named levels, such as "best", are checked by rpmpack.
+		return nil
+	}
+	if n < minZstdLevel || n > maxZstdLevel {
+		return fmt.Errorf("%w: %s: zstd levels range from %d to %d", ErrInvalidCompression, compression, minZstdLevel, maxZstdLevel)
+	}
+	return nil
+}
+
+// payloadFlags returns the payload flags of a zstd compression with a
+// numeric level, which rpm records as the level. rpmpack records 9 for the
+// other ones.
+func payloadFlags(compression string) string {
+	algorithm, level, ok := strings.Cut(compression, ":")
+	if algorithm != "zstd" || !ok {
+		return ""
+	}
+	if _, err := strconv.Atoi(level); err != nil {
+		return ""
+	}
+	return level
+}
+
+// metadataHeading introduces the Info.Metadata at the end of the description,
+// as rpm has no tags for arbitrary metadata.
+const metadataHeading = "Build metadata:"
+
+func describeWithMetadata(description string, metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return description
+	}
+	var b strings.Builder
+	b.WriteString(description)
+	b.WriteString("\n\n" + metadataHeading)
+	for _, key := range maps.Keys(metadata) {
+		fmt.Fprintf(&b, "\n  %s: %s", key, metadata[key])
+	}
+	return b.String()
+}
+
 func formatVersion(info *nfpm.Info) string {
 	version := info.Version
 
@@ -281,6 +521,16 @@ func formatVersion(info *nfpm.Info) string {
 	return version
 }
 
+// evr returns the epoch:version-release of the package, as rpm prints it in
+// the changelog.
+func evr(info *nfpm.Info) string {
+	version := formatVersion(info) + "-" + defaultTo(info.Release, "1")
+	if info.Epoch != "" {
+		version = info.Epoch + ":" + version
+	}
+	return version
+}
+
 func defaultTo(in, def string) string {
 	if in == "" {
 		return def
@@ -288,79 +538,95 @@ func defaultTo(in, def string) string {
 	return in
 }
 
+// toRelation parses relations such as `foo`, `foo >= 1.2`, `foo(x86-64) = 1.2`
+// or rich dependencies such as `(foo or bar)` into their name, flags and
+// version tags.
 func toRelation(items []string) (rpmpack.Relations, error) {
 	relations := make(rpmpack.Relations, 0)
 	for idx := range items {
-		if err := relations.Set(items[idx]); err != nil {
-			return nil, err
+		relation, err := rpmpack.NewRelation(strings.TrimSpace(items[idx]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid relation %q: %w", items[idx], err)
+		}
+		switch {
+		case relation.Name == "":
+			return nil, fmt.Errorf("invalid relation %q: missing name", items[idx])
+		case relation.Sense == rpmpack.SenseAny && relation.Version != "":
+			return nil, fmt.Errorf("invalid relation %q: missing version operator", items[idx])
+		case relation.Sense != rpmpack.SenseAny && relation.Version == "":
+			return nil, fmt.Errorf("invalid relation %q: missing version", items[idx])
+		case strings.HasPrefix(relation.Name, "/") && relation.Sense != rpmpack.SenseAny:
+			return nil, fmt.Errorf("invalid relation %q: file relations can not have a version", items[idx])
+		case strings.HasPrefix(relation.Name, "/") && path.Clean(relation.Name) != relation.Name,
+			isRelativePath(relation.Name):
+			return nil, fmt.Errorf("invalid relation %q: file relations must be clean absolute paths", items[idx])
+		}
+		if !slices.ContainsFunc(relations, relation.Equal) {
+			relations = append(relations, relation)
 		}
 	}
 
 	return relations, nil
 }
 
-func addScriptFiles(info *nfpm.Info, rpm *rpmpack.RPM) error {
-	if info.RPM.Scripts.PreTrans != "" {
-		data, err := os.ReadFile(info.RPM.Scripts.PreTrans)
-		if err != nil {
-			return err
-		}
-		rpm.AddPretrans(string(data))
-	}
-	if info.Scripts.PreInstall != "" {
-		data, err := os.ReadFile(info.Scripts.PreInstall)
-		if err != nil {
-			return err
-		}
-		rpm.AddPrein(string(data))
-	}
+// isRelativePath reports whether the name of a relation is a relative file
+// path, e.g. usr/bin/foo or ./foo, rather than a capability, which only has
+// slashes in parentheses, e.g. golang(example.com/foo).
+func isRelativePath(name string) bool {
+	return !strings.HasPrefix(name, "/") && strings.Contains(name, "/") && !strings.Contains(name, "(")
+}
 
-	if info.Scripts.PreRemove != "" {
-		data, err := os.ReadFile(info.Scripts.PreRemove)
-		if err != nil {
-			return err
-		}
-		rpm.AddPreun(string(data))
+func addScriptFiles(info *nfpm.Info, rpm *rpmpack.RPM) error {
+	scripts, err := scriptlets(info)
+	if err != nil {
+		return err
 	}
-
-	if info.Scripts.PostInstall != "" {
-		data, err := os.ReadFile(info.Scripts.PostInstall)
-		if err != nil {
-			return err
+	flags := info.RPM.ScriptFlags
+	for _, scriptlet := range []struct {
+		name              string
+		add               func(*rpmpack.RPM, string)
+		progTag, flagsTag int
+		flagsName         string
+		flags             []string
+	}{
+		{"pretrans", (*rpmpack.RPM).AddPretrans, tagPreTransProg, tagPreTransFlags, "pretrans", flags.PreTrans},
+		{"pre", (*rpmpack.RPM).AddPrein, tagPreInProg, tagPreInFlags, "preinstall", flags.PreInstall},
+		{"preun", (*rpmpack.RPM).AddPreun, tagPreUnProg, tagPreUnFlags, "preremove", flags.PreRemove},
+		{"post", (*rpmpack.RPM).AddPostin, tagPostInProg, tagPostInFlags, "postinstall", flags.PostInstall},
+		{"postun", (*rpmpack.RPM).AddPostun, tagPostUnProg, tagPostUnFlags, "postremove", flags.PostRemove},
+		{"posttrans", (*rpmpack.RPM).AddPosttrans, tagPostTransProg, tagPostTransFlags, "posttrans", flags.PostTrans},
+		{"verifyscript", (*rpmpack.RPM).AddVerifyScript, tagVerifyScriptProg, tagVerifyScriptFlags, "verify", flags.Verify},
+	} {
+		script, ok := scripts[scriptlet.name]
+		if !ok {
+			continue
 		}
-		rpm.AddPostin(string(data))
-	}
-
-	if info.Scripts.PostRemove != "" {
-		data, err := os.ReadFile(info.Scripts.PostRemove)
-		if err != nil {
+		scriptlet.add(rpm, script)
+		addScriptProg(rpm, scriptlet.progTag, info.ScriptInterpreter())
+		if err := addScriptFlags(rpm, scriptlet.flagsTag, scriptlet.flagsName, scriptlet.flags); err != nil {
 			return err
 		}
-		rpm.AddPostun(string(data))
 	}
+	return nil
+}
 
-	if info.RPM.Scripts.PostTrans != "" {
-		data, err := os.ReadFile(info.RPM.Scripts.PostTrans)
-		if err != nil {
-			return err
-		}
-		rpm.AddPosttrans(string(data))
+func readScript(path string) (string, error) {
+	if path == "" {
+		return "", nil
 	}
-
-	if info.RPM.Scripts.Verify != "" {
-		data, err := os.ReadFile(info.RPM.Scripts.Verify)
-		if err != nil {
-			return err
-		}
-		rpm.AddVerifyScript(string(data))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
 	}
-
-	return nil
+	return string(data), nil
 }
 
 // TODO: pass mtime down in all content types
 func createFilesInsideRPM(info *nfpm.Info, rpm *rpmpack.RPM) (err error) {
 	mtime := modtime.Get(info.MTime)
+	added := map[string]rpmpack.RPMFile{}
+	ids := map[string]fileIDs{}
+	langs := map[string]string{}
 	for _, content := range info.Contents {
 		if content.Packager != "" && content.Packager != packagerName {
 			continue
@@ -370,9 +636,9 @@ func createFilesInsideRPM(info *nfpm.Info, rpm *rpmpack.RPM) (err error) {
 
 		switch content.Type {
 		case files.TypeConfig:
-			file, err = asRPMFile(content, rpmpack.ConfigFile)
+			file, err = asRPMFile(content, configFlags(content))
 		case files.TypeConfigNoReplace:
-			file, err = asRPMFile(content, rpmpack.ConfigFile|rpmpack.NoReplaceFile)
+			file, err = asRPMFile(content, configFlags(content)|rpmpack.NoReplaceFile)
 		case files.TypeRPMGhost:
 			if content.FileInfo.Mode == 0 {
 				content.FileInfo.Mode = os.FileMode(0o644)
@@ -388,6 +654,10 @@ func createFilesInsideRPM(info *nfpm.Info, rpm *rpmpack.RPM) (err error) {
 		case files.TypeSymlink:
 			file = asRPMSymlink(content)
 		case files.TypeDir:
+			if content.IsUnowned() {
+				// created by %posttrans instead
+				continue
+			}
 			file = asRPMDirectory(content, mtime)
 		case files.TypeImplicitDir:
 			// we don't need to add imlicit directories to RPMs
@@ -403,12 +673,80 @@ func createFilesInsideRPM(info *nfpm.Info, rpm *rpmpack.RPM) (err error) {
 		// clean assures that even folders do not have a trailing slash
 		file.Name = files.ToNixPath(file.Name)
 		rpm.AddFile(*file)
-
+		if file.Name != "/" {
+			added[file.Name] = *file
+			if content.FileInfo != nil {
+				_, uid := content.FileInfo.TarOwner()
+				_, gid := content.FileInfo.TarGroup()
+				ids[file.Name] = fileIDs{uid: uid, gid: gid}
+			}
+			if content.Lang != "" {
+				langs[file.Name] = content.Lang
+			}
+		}
 	}
 
+	addFileIDs(rpm, added, ids, info.PasswdFile != "" || info.GroupFile != "")
+	addFileLangs(rpm, added, langs)
+	addFileDigests(info, rpm, added)
 	return nil
 }
 
+// addFileLangs records the %lang of the files that have one, see
+// files.Content.Lang, in the order rpmpack writes the files in.
+func addFileLangs(rpm *rpmpack.RPM, added map[string]rpmpack.RPMFile, langs map[string]string) {
+	if len(langs) == 0 {
+		return
+	}
+	names := fileOrder(added)
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, langs[name])
+	}
+	rpm.AddCustomTag(tagFileLangs, rpmpack.EntryStringSlice(entries))
+}
+
+// fileIDs are the uid and gid of a file, see addFileIDs.
+type fileIDs struct {
+	uid, gid int
+}
+
+// fileOrder returns the names of the files in the order of the file tags of
+// the header and of the payload. rpmpack sorts the files by name, which puts
+// the directories before their contents, and the tags nfpm adds to describe
+// each file must list them in the same order.
+func fileOrder(added map[string]rpmpack.RPMFile) []string {
+	return maps.Keys(added)
+}
+
+// addFileIDs records the ids of the owners and groups in the tags that list
+// the uid and gid of each file in the order rpmpack writes the files in, if
+// some of them are numeric-only, which rpm cannot look up by name, or the
+// names were resolved with the passwd and group files of the info. The name
+// tags keep the names, or the numeric strings, and the owners and groups
+// that were not resolved are listed with id 0.
+func addFileIDs(rpm *rpmpack.RPM, added map[string]rpmpack.RPMFile, ids map[string]fileIDs, resolved bool) {
+	numeric := false
+	for _, file := range added {
+		_, uidOK := files.NumericID(file.Owner)
+		_, gidOK := files.NumericID(file.Group)
+		numeric = numeric || uidOK || gidOK
+	}
+	if !numeric && !resolved {
+		return
+	}
+
+	names := fileOrder(added)
+	uids := make([]uint32, 0, len(names))
+	gids := make([]uint32, 0, len(names))
+	for _, name := range names {
+		uids = append(uids, uint32(ids[name].uid))
+		gids = append(gids, uint32(ids[name].gid))
+	}
+	rpm.AddCustomTag(tagFileUIDs, rpmpack.EntryUint32(uids))
+	rpm.AddCustomTag(tagFileGIDs, rpmpack.EntryUint32(gids))
+}
+
 func asRPMDirectory(content *files.Content, mtime time.Time) *rpmpack.RPMFile {
 	return &rpmpack.RPMFile{
 		Name:  content.Destination,
@@ -430,11 +768,42 @@ func asRPMSymlink(content *files.Content) *rpmpack.RPMFile {
 	}
 }
 
+// sparseWarningThreshold is the file size from which on a warning is emitted
+// if the file is sparse, as the cpio payload can not represent holes.
+// nolint: gochecknoglobals
+var sparseWarningThreshold int64 = 32 << 20
+
+func warnIfSparse(content *files.Content) {
+	if content.Data != nil || content.FS != nil || content.Size() < sparseWarningThreshold {
+		return
+	}
+	holes, err := sparse.HoleSize(content.Source)
+	if err != nil || holes == 0 {
+		return
+	}
+	warning.Warn(
+		fmt.Sprintf("%s is a sparse file with %d bytes of holes, it will be stored densely in the rpm payload", content.Source, holes),
+		"path", content.Destination,
+	)
+}
+
+// configFlags returns the flags of a config file, %config(missingok) if the
+// content sets MissingOK.
+func configFlags(content *files.Content) rpmpack.FileType {
+	if content.MissingOK {
+		return rpmpack.ConfigFile | rpmpack.MissingOkFile
+	}
+	return rpmpack.ConfigFile
+}
+
 func asRPMFile(content *files.Content, fileType rpmpack.FileType) (*rpmpack.RPMFile, error) {
-	data, err := os.ReadFile(content.Source)
+	data, err := content.ReadAll()
 	if err != nil && content.Type != files.TypeRPMGhost {
 		return nil, err
 	}
+	if err == nil {
+		warnIfSparse(content)
+	}
 
 	return &rpmpack.RPMFile{
 		Name:  content.Destination,
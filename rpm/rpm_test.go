@@ -2,22 +2,30 @@ package rpm
 
 import (
 	"bytes"
+	"crypto/md5" // nolint:gosec
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/caarlos0/go-rpmutils"
 	"github.com/caarlos0/go-rpmutils/cpio"
+	"github.com/google/rpmpack"
 	"github.com/goreleaser/chglog"
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/files"
 	"github.com/goreleaser/nfpm/v2/internal/sign"
+	"github.com/goreleaser/nfpm/v2/internal/warning"
 	"github.com/stretchr/testify/require"
 )
 
@@ -202,6 +210,22 @@ func TestRPMMandatoryFieldsOnly(t *testing.T) {
 	require.Equal(t, "summary\nfoo bar\nlong description", description)
 }
 
+func TestPackageName(t *testing.T) {
+	info := exampleInfo()
+	info.RPM.PackageName = "foo-devel"
+	info.Deb.PackageName = "libfoo-dev"
+	require.Equal(t, "foo-devel-1.0.0-1.x86_64.rpm", Default.ConventionalFileName(info))
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	name, err := rpm.Header.GetString(rpmutils.NAME)
+	require.NoError(t, err)
+	require.Equal(t, "foo-devel", name)
+	require.Equal(t, "foo", info.Name)
+}
+
 func TestRPMPlatform(t *testing.T) {
 	f, err := os.CreateTemp(t.TempDir(), "test*.rpm")
 	require.NoError(t, err)
@@ -235,6 +259,154 @@ func TestRPMGroup(t *testing.T) {
 	require.Equal(t, "Unspecified", group)
 }
 
+func TestRPMCategory(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		group      string
+		category   string
+		categories map[string]nfpm.Category
+		expected   string
+	}{
+		"default":      {category: "utils", expected: "Applications/System"},
+		"explicit":     {category: "utils", group: "Unspecified", expected: "Unspecified"},
+		"custom":       {category: "tools", categories: map[string]nfpm.Category{"tools": {Group: "Development/Tools"}}, expected: "Development/Tools"},
+		"override":     {category: "utils", categories: map[string]nfpm.Category{"utils": {Group: "System/Utilities"}}, expected: "System/Utilities"},
+		"section only": {category: "tools", categories: map[string]nfpm.Category{"tools": {Section: "devel"}}, expected: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.RPM.Group = testCase.group
+			info.Category = testCase.category
+			info.Categories = testCase.categories
+
+			var buf bytes.Buffer
+			require.NoError(t, Default.Package(info, &buf))
+
+			rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+
+			group, err := rpm.Header.GetString(rpmutils.GROUP)
+			if testCase.expected == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, group)
+		})
+	}
+}
+
+func TestRPMObsoletes(t *testing.T) {
+	info := exampleInfo()
+	info.Replaces = []string{"svn"}
+	info.RPM.Obsoletes = []string{
+		"foo",
+		"bar >= 1.2",
+		"baz(x86-64) = 1.2-1",
+		" qux(aarch-64) < 2 ",
+		"svn",
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	names, err := rpm.Header.GetStrings(rpmutils.OBSOLETENAME)
+	require.NoError(t, err)
+	require.Equal(t, []string{"svn", "foo", "bar", "baz(x86-64)", "qux(aarch-64)"}, names)
+
+	versions, err := rpm.Header.GetStrings(rpmutils.OBSOLETEVERSION)
+	require.NoError(t, err)
+	require.Equal(t, []string{"", "", "1.2", "1.2-1", "2"}, versions)
+
+	flags, err := rpm.Header.GetUint32s(rpmutils.OBSOLETEFLAGS)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{
+		uint32(rpmpack.SenseAny),
+		uint32(rpmpack.SenseAny),
+		uint32(rpmpack.SenseGreater | rpmpack.SenseEqual),
+		uint32(rpmpack.SenseEqual),
+		uint32(rpmpack.SenseLess),
+	}, flags)
+}
+
+func TestRPMRenames(t *testing.T) {
+	info := exampleInfo()
+	info.Replaces = nil
+	info.Renames = []nfpm.Rename{{From: "oldfoo"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	names, err := rpm.Header.GetStrings(rpmutils.OBSOLETENAME)
+	require.NoError(t, err)
+	require.Equal(t, []string{"oldfoo"}, names)
+	versions, err := rpm.Header.GetStrings(rpmutils.OBSOLETEVERSION)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0:1.0.0-1"}, versions)
+	flags, err := rpm.Header.GetUint32s(rpmutils.OBSOLETEFLAGS)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{uint32(rpmpack.SenseLess)}, flags)
+
+	names, err = rpm.Header.GetStrings(rpmutils.PROVIDENAME)
+	require.NoError(t, err)
+	idx := slices.Index(names, "oldfoo")
+	require.GreaterOrEqual(t, idx, 0, names)
+	versions, err = rpm.Header.GetStrings(rpmutils.PROVIDEVERSION)
+	require.NoError(t, err)
+	require.Equal(t, "0:1.0.0-1", versions[idx])
+	flags, err = rpm.Header.GetUint32s(rpmutils.PROVIDEFLAGS)
+	require.NoError(t, err)
+	require.Equal(t, uint32(rpmpack.SenseEqual), flags[idx])
+}
+
+func TestRPMInvalidRelations(t *testing.T) {
+	for relation, expected := range map[string]string{
+		"foo => 1.2":          `invalid relation "foo => 1.2": unknown sense value: =>`,
+		"foo 1.2":             `invalid relation "foo 1.2": missing version operator`,
+		"foo >=":              `invalid relation "foo >=": missing version`,
+		">= 1.2":              `invalid relation ">= 1.2": missing name`,
+		"/usr/bin/foo >= 1.2": `invalid relation "/usr/bin/foo >= 1.2": file relations can not have a version`,
+		"/usr/bin/../foo":     `invalid relation "/usr/bin/../foo": file relations must be clean absolute paths`,
+		"usr/bin/foo":         `invalid relation "usr/bin/foo": file relations must be clean absolute paths`,
+	} {
+		t.Run(relation, func(t *testing.T) {
+			info := exampleInfo()
+			info.RPM.Obsoletes = []string{relation}
+			require.EqualError(t, Default.Package(info, io.Discard), expected)
+		})
+	}
+}
+
+func TestRPMFileRequires(t *testing.T) {
+	info := exampleInfo()
+	info.Depends = []string{"bash >= 4", "/usr/bin/foo", "golang(example.com/foo)"}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	names, err := rpm.Header.GetStrings(rpmutils.REQUIRENAME)
+	require.NoError(t, err)
+	versions, err := rpm.Header.GetStrings(rpmutils.REQUIREVERSION)
+	require.NoError(t, err)
+	flags, err := rpm.Header.GetUint32s(rpmutils.REQUIREFLAGS)
+	require.NoError(t, err)
+	require.Len(t, versions, len(names))
+	require.Len(t, flags, len(names))
+
+	idx := slices.Index(names, "/usr/bin/foo")
+	require.GreaterOrEqual(t, idx, 0, names)
+	require.Equal(t, "", versions[idx])
+	require.Equal(t, uint32(rpmpack.SenseAny), flags[idx])
+	require.Contains(t, names, "golang(example.com/foo)")
+}
+
 func TestRPMCompression(t *testing.T) {
 	for _, compressor := range []string{"gzip", "lzma", "xz", "zstd"} {
 		for _, level := range []int{-1, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9} {
@@ -329,6 +501,68 @@ func TestRPMPackager(t *testing.T) {
 	require.Equal(t, customPackager, packager)
 }
 
+func TestRPMSourceRPM(t *testing.T) {
+	sourceRPM := func(info *nfpm.Info) string {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		value, err := rpm.Header.GetString(tagSourceRPM)
+		require.NoError(t, err)
+		return value
+	}
+
+	info := exampleInfo()
+	info.RPM.SourceRPM = "foo-tools-1.0.0-3.src.rpm"
+	require.Equal(t, "foo-tools-1.0.0-3.src.rpm", sourceRPM(info))
+
+	t.Run("default", func(t *testing.T) {
+		info := exampleInfo()
+		require.Equal(t, "foo-1.0.0-1.src.rpm", sourceRPM(info))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, name := range []string{"foo-1.0.0-1.rpm", "dist/foo-1.0.0-1.src.rpm"} {
+			info := exampleInfo()
+			info.RPM.SourceRPM = name
+			require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidSourceRPM, name)
+		}
+	})
+}
+
+func TestRPMVendorPackagerDistribution(t *testing.T) {
+	info := exampleInfo()
+	info.Vendor = "MyCorp"
+	info.Maintainer = "Jane Doe <jane@example.com>"
+	info.RPM.Distribution = "MyCorp Linux"
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	for tag, expected := range map[int]string{
+		rpmutils.VENDOR:       "MyCorp",
+		rpmutils.PACKAGER:     "Jane Doe <jane@example.com>",
+		rpmutils.DISTRIBUTION: "MyCorp Linux",
+	} {
+		value, err := rpm.Header.GetString(tag)
+		require.NoError(t, err)
+		require.Equal(t, expected, value)
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		info := exampleInfo()
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		_, err = rpm.Header.GetString(rpmutils.DISTRIBUTION)
+		require.Error(t, err)
+	})
+}
+
 func TestWithRPMTags(t *testing.T) {
 	f, err := os.CreateTemp(t.TempDir(), "test.rpm")
 	require.NoError(t, err)
@@ -548,6 +782,81 @@ echo "Verify" > /dev/null
 `, data, "Verify script does not match")
 }
 
+func TestRPMServiceScriptlets(t *testing.T) {
+	info := exampleInfo()
+	info.Scripts.PreRemove = ""
+	info.RPM.ServiceScriptlets = nfpm.RPMServiceScriptlets{
+		Units:            []string{"foo.service"},
+		RestartOnUpgrade: true,
+	}
+	info.Contents = append(info.Contents, &files.Content{
+		Destination: "/usr/lib/systemd/system/foo.service",
+		Data:        []byte("[Service]\nExecStart=/usr/bin/fake\n"),
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(&buf)
+	require.NoError(t, err)
+
+	data, err := rpm.Header.GetString(rpmutils.POSTIN)
+	require.NoError(t, err)
+	require.Equal(t, `#!/bin/bash
+
+echo "Postinstall" > /dev/null
+
+`+SystemdPost("foo.service"), data)
+
+	data, err = rpm.Header.GetString(rpmutils.PREUN)
+	require.NoError(t, err)
+	require.Equal(t, SystemdPreun("foo.service"), data)
+
+	data, err = rpm.Header.GetString(rpmutils.POSTUN)
+	require.NoError(t, err)
+	require.Equal(t, `#!/bin/bash
+
+echo "Postremove" > /dev/null
+
+`+SystemdPostunWithRestart("foo.service"), data)
+}
+
+func TestRPMFailOnScriptError(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprint(fail), func(t *testing.T) {
+			info := exampleInfo()
+			info.Scripts.PreRemove = ""
+			info.RPM.FailOnScriptError = fail
+			info.RPM.ServiceScriptlets = nfpm.RPMServiceScriptlets{Units: []string{"foo.service"}}
+			info.Contents = append(info.Contents, &files.Content{
+				Destination: "/usr/lib/systemd/system/foo.service",
+				Data:        []byte("[Service]\nExecStart=/usr/bin/fake\n"),
+			})
+
+			var buf bytes.Buffer
+			require.NoError(t, Default.Package(info, &buf))
+			rpm, err := rpmutils.ReadRpm(&buf)
+			require.NoError(t, err)
+
+			prefix := ""
+			if fail {
+				prefix = "set -e\n"
+			}
+			for tag, expected := range map[int]string{
+				rpmutils.PREIN:  "#!/bin/bash\n\necho \"Preinstall\" > /dev/null\n",
+				rpmutils.POSTIN: "#!/bin/bash\n\necho \"Postinstall\" > /dev/null\n\n" + SystemdPost("foo.service"),
+				// the generated snippets are wrapped as well, but still ignore
+				// the failures of systemctl
+				rpmutils.PREUN:  SystemdPreun("foo.service"),
+				rpmutils.POSTUN: "#!/bin/bash\n\necho \"Postremove\" > /dev/null\n\n" + SystemdPostun("foo.service"),
+			} {
+				data, err := rpm.Header.GetString(tag)
+				require.NoError(t, err)
+				require.Equal(t, prefix+expected, data, tag)
+			}
+		})
+	}
+}
+
 func TestRPMFileDoesNotExist(t *testing.T) {
 	info := exampleInfo()
 	info.Contents = []*files.Content{
@@ -577,6 +886,21 @@ func TestArches(t *testing.T) {
 		})
 	}
 
+	for goarm, expected := range map[string]string{
+		"5": "armv5tel",
+		"6": "armv6hl",
+		"7": "armv7hl",
+	} {
+		goarm, expected := goarm, expected
+		t.Run("goarm"+goarm, func(t *testing.T) {
+			info := exampleInfo()
+			info.Arch = "arm"
+			info.Goarm = goarm
+			info = setDefaults(nfpm.WithDefaults(info))
+			require.Equal(t, expected, info.Arch)
+		})
+	}
+
 	t.Run("override", func(t *testing.T) {
 		info := exampleInfo()
 		info.RPM.Arch = "foo64"
@@ -621,6 +945,48 @@ func TestConfigNoReplace(t *testing.T) {
 	require.Equal(t, expectedConfigContent, packageConfigContent)
 }
 
+func TestRPMNoarch(t *testing.T) {
+	for name, set := range map[string]func(info *nfpm.Info){
+		"all":         func(info *nfpm.Info) { info.Arch = "all" },
+		"rpm noarch":  func(info *nfpm.Info) { info.RPM.Arch = "noarch" },
+		"noarch arch": func(info *nfpm.Info) { info.Arch = "noarch" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			set(info)
+			// noarch packages may still ship files in arch specific
+			// directories, e.g. data for several architectures.
+			info.Contents = []*files.Content{
+				{Source: "../testdata/fake", Destination: "/usr/bin/fake"},
+				{Source: "../testdata/whatever.conf", Destination: "/usr/lib64/foo/x86_64.conf"},
+				{Source: "../testdata/whatever.conf", Destination: "/usr/lib/aarch64-linux-gnu/foo/aarch64.conf"},
+			}
+			require.Equal(t, "foo-1.0.0-1.noarch.rpm", Default.ConventionalFileName(info))
+
+			var buf bytes.Buffer
+			require.NoError(t, Default.Package(info, &buf))
+			rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+
+			arch, err := rpm.Header.GetString(rpmutils.ARCH)
+			require.NoError(t, err)
+			require.Equal(t, "noarch", arch)
+
+			rpmFiles, err := rpm.Header.GetFiles()
+			require.NoError(t, err)
+			var names []string
+			for _, file := range rpmFiles {
+				names = append(names, file.Name())
+			}
+			require.Subset(t, names, []string{
+				"/usr/bin/fake",
+				"/usr/lib64/foo/x86_64.conf",
+				"/usr/lib/aarch64-linux-gnu/foo/aarch64.conf",
+			})
+		})
+	}
+}
+
 func TestRPMConventionalFileName(t *testing.T) {
 	info := &nfpm.Info{
 		Name:       "testpkg",
@@ -715,6 +1081,86 @@ func TestRPMChangelog(t *testing.T) {
 	}
 }
 
+func TestRPMChangelogSorted(t *testing.T) {
+	info := exampleInfo()
+	info.Changelog = "../testdata/changelog_unsorted.yaml"
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	titles, err := rpm.Header.GetStrings(tagChangelogName)
+	require.NoError(t, err)
+	var versions []string
+	for _, title := range titles {
+		versions = append(versions, title[strings.LastIndex(title, " ")+1:])
+	}
+	// rpm sorts a `^` before anything but the end of the version
+	require.Equal(t, []string{
+		"2.0.0.1-1",
+		"2.0.0^git20240101-1",
+		"1.10.0-1",
+		"1.2.0-1",
+		"1.2.0~rc1-1",
+		"1.1.0-1",
+		"1.1.0-1",
+		"1.0.0-1",
+	}, versions)
+
+	notes, err := rpm.Header.GetStrings(tagChangelogText)
+	require.NoError(t, err)
+	require.Contains(t, notes[5], "second 1.1.0 entry")
+	require.Contains(t, notes[6], "first 1.1.0 entry")
+
+	// rpm requires the changelog in descending chronological order
+	times, err := rpm.Header.GetUint32s(tagChangelogTime)
+	require.NoError(t, err)
+	require.IsNonIncreasing(t, times)
+}
+
+func TestRPMChangelogEVR(t *testing.T) {
+	changelog := filepath.Join(t.TempDir(), "changelog.yaml")
+	require.NoError(t, os.WriteFile(changelog, []byte(`
+- packager: "Carlos A Becker <pkg@carlosbecker.com>"
+  date: "2024-01-01T10:00:00Z"
+  changes:
+    - note: "no version, the one of the package is used"
+- semver: "1:0.9.0-3"
+  packager: "Carlos A Becker <pkg@carlosbecker.com>"
+  date: "2023-06-01T10:00:00Z"
+  changes:
+    - note: "explicit version"
+`), 0o600))
+
+	info := exampleInfo()
+	info.Changelog = changelog
+	info.Epoch = "2"
+	info.Prerelease = "rc1"
+	info.Release = "4"
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	times, err := rpm.Header.GetUint32s(tagChangelogTime)
+	require.NoError(t, err)
+	titles, err := rpm.Header.GetStrings(tagChangelogName)
+	require.NoError(t, err)
+
+	// the header lines as printed by rpm -q --changelog
+	var headers []string
+	for i, title := range titles {
+		date := time.Unix(int64(times[i]), 0).UTC().Format("Mon Jan 02 2006")
+		headers = append(headers, "* "+date+" "+title)
+	}
+	require.Equal(t, []string{
+		"* Mon Jan 01 2024 Carlos A Becker <pkg@carlosbecker.com> - 2:1.0.0~rc1-4",
+		"* Thu Jun 01 2023 Carlos A Becker <pkg@carlosbecker.com> - 1:0.9.0-3",
+	}, headers)
+}
+
 func TestRPMNoChangelogTagsWithoutChangelogConfigured(t *testing.T) {
 	info := exampleInfo()
 
@@ -778,6 +1224,78 @@ func TestSymlink(t *testing.T) {
 	require.Equal(t, symlinkTarget, string(packagedSymlink))
 }
 
+func TestRPMDataContent(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Destination: "/usr/bin/generated",
+			Data:        []byte("#!/bin/sh\necho generated\n"),
+			FileInfo:    &files.ContentFileInfo{Mode: 0o755},
+		},
+		{Destination: "/etc/generated.conf", Data: []byte("key = value\n"), Type: files.TypeConfig},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(buf.Bytes())))
+
+	data, err := extractFileFromRpm(buf.Bytes(), "/usr/bin/generated")
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\necho generated\n", string(data))
+	header, err := extractFileHeaderFromRpm(buf.Bytes(), "/usr/bin/generated")
+	require.NoError(t, err)
+	require.Equal(t, 0o755, header.Mode()&0o777)
+
+	data, err = extractFileFromRpm(buf.Bytes(), "/etc/generated.conf")
+	require.NoError(t, err)
+	require.Equal(t, "key = value\n", string(data))
+	header, err = extractFileHeaderFromRpm(buf.Bytes(), "/etc/generated.conf")
+	require.NoError(t, err)
+	require.Equal(t, 0o644, header.Mode()&0o777)
+}
+
+func TestRPMRaw(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "foo.sh")
+	require.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\r\necho foo\r\n"), 0o644))
+	require.NoError(t, os.Chmod(src, 0o777))
+
+	info := exampleInfo()
+	info.Umask = 0o022
+	info.DefAttr = nfpm.DefAttr{FileMode: 0o600}
+	info.ModePolicies = []nfpm.ModePolicy{{Path: "/usr/share/raw/**", ForbidBits: 0o002, Enforce: nfpm.ModePolicyFix}}
+	info.Contents = append(info.Contents,
+		&files.Content{Source: src, Destination: "/usr/share/raw/foo.sh", Raw: true},
+		&files.Content{Source: src, Destination: "/usr/share/raw/bar.sh", NormalizeEOL: files.EOLLF},
+		&files.Content{
+			Destination: "/usr/share/raw/foo.txt",
+			Data:        []byte("foo\r\n"),
+			FileInfo:    &files.ContentFileInfo{Mode: 0o666},
+			Raw:         true,
+		},
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(buf.Bytes())))
+
+	for name, expected := range map[string]struct {
+		body string
+		mode int
+	}{
+		"/usr/share/raw/foo.sh":  {"#!/bin/sh\r\necho foo\r\n", 0o777},
+		"/usr/share/raw/foo.txt": {"foo\r\n", 0o666},
+		// the same file without raw is transformed as usual
+		"/usr/share/raw/bar.sh": {"#!/bin/sh\necho foo\n", 0o600},
+	} {
+		data, err := extractFileFromRpm(buf.Bytes(), name)
+		require.NoError(t, err)
+		require.Equal(t, expected.body, string(data), name)
+		header, err := extractFileHeaderFromRpm(buf.Bytes(), name)
+		require.NoError(t, err)
+		require.Equal(t, expected.mode, header.Mode()&0o777, name)
+	}
+}
+
 func TestRPMSignature(t *testing.T) {
 	info := exampleInfo()
 	info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
@@ -799,6 +1317,33 @@ func TestRPMSignature(t *testing.T) {
 	require.Len(t, sigs, 2)
 }
 
+func TestRPMSignatureKeyring(t *testing.T) {
+	info := exampleInfo()
+	info.Keyring = nfpm.Keyring{
+		KeyFile: "../internal/sign/testdata/multiple_privkeys.asc",
+		Keys:    map[string]string{"rpm": "A70225080FACE80EDAB48D15D0AAB2985270817B"},
+	}
+	info.RPM.Signature.KeyPassphrase = "hunter2"
+
+	keyFileContent, err := os.ReadFile("../internal/sign/testdata/multiple_privkeys.asc")
+	require.NoError(t, err)
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyFileContent))
+	require.NoError(t, err)
+	require.Len(t, keyring, 2)
+
+	var rpmBuffer bytes.Buffer
+	err = Default.Package(info, &rpmBuffer)
+	require.NoError(t, err)
+
+	_, sigs, err := rpmutils.Verify(bytes.NewReader(rpmBuffer.Bytes()), keyring[1:])
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+
+	_, _, err = rpmutils.Verify(bytes.NewReader(rpmBuffer.Bytes()), keyring[:1])
+	require.Error(t, err)
+}
+
 func TestRPMSignatureError(t *testing.T) {
 	info := exampleInfo()
 	info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
@@ -819,7 +1364,7 @@ func TestRPMSignatureCallback(t *testing.T) {
 		if err != nil {
 			return nil, err
 		}
-		return sign.PGPSignerWithKeyID("../internal/sign/testdata/privkey.asc", "hunter2", nil)(data)
+		return sign.PGPSignerWithKeyID(sign.Key{File: "../internal/sign/testdata/privkey.asc"}, "hunter2", nil)(data)
 	}
 
 	pubkeyFileContent, err := os.ReadFile("../internal/sign/testdata/pubkey.gpg")
@@ -885,6 +1430,95 @@ func TestRPMGhostFiles(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestRPMFileFlags(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/usr/share/doc/foo/README",
+			Type:        files.TypeRPMReadme,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/usr/share/doc/foo/changes.txt",
+			Type:        files.TypeRPMDoc,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/usr/share/licenses/foo/LICENSE",
+			Type:        files.TypeRPMLicense,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/usr/share/licenses/foo/NOTICE",
+			Type:        files.TypeRPMLicence,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo.conf",
+			Type:        files.TypeConfig,
+		},
+		{
+			Source:      "../testdata/fake",
+			Destination: "/usr/bin/fake",
+		},
+	}
+
+	var rpmFileBuffer bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpmFileBuffer))
+
+	headerFiles, err := extraFileInfoSliceFromRpm(rpmFileBuffer.Bytes())
+	require.NoError(t, err)
+
+	flags := map[string]int{}
+	for _, fileInfo := range headerFiles {
+		flags[fileInfo.Name()] = fileInfo.Flags()
+	}
+	require.Equal(t, map[string]int{
+		"/usr/share/doc/foo/README":       rpmutils.RPMFILE_README,
+		"/usr/share/doc/foo/changes.txt":  rpmutils.RPMFILE_DOC,
+		"/usr/share/licenses/foo/LICENSE": rpmutils.RPMFILE_LICENSE,
+		"/usr/share/licenses/foo/NOTICE":  rpmutils.RPMFILE_LICENSE,
+		"/etc/foo.conf":                   rpmutils.RPMFILE_CONFIG,
+		"/usr/bin/fake":                   rpmutils.RPMFILE_NONE,
+	}, flags)
+}
+
+func TestConfigTypes(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/config.conf", Type: "config"},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/noreplace.conf", Type: "config|noreplace"},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/missingok.conf", Type: "config|missingok"},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/both.conf", Type: "config|noreplace|missingok"},
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/reversed.conf", Type: "config|missingok|noreplace"},
+	}
+
+	var rpmFileBuffer bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpmFileBuffer))
+
+	headerFiles, err := extraFileInfoSliceFromRpm(rpmFileBuffer.Bytes())
+	require.NoError(t, err)
+	flags := map[string]int{}
+	for _, fileInfo := range headerFiles {
+		flags[fileInfo.Name()] = fileInfo.Flags()
+	}
+	require.Equal(t, map[string]int{
+		"/etc/foo/config.conf":    rpmutils.RPMFILE_CONFIG,
+		"/etc/foo/noreplace.conf": rpmutils.RPMFILE_CONFIG | rpmutils.RPMFILE_NOREPLACE,
+		"/etc/foo/missingok.conf": rpmutils.RPMFILE_CONFIG | rpmutils.RPMFILE_MISSINGOK,
+		"/etc/foo/both.conf":      rpmutils.RPMFILE_CONFIG | rpmutils.RPMFILE_NOREPLACE | rpmutils.RPMFILE_MISSINGOK,
+		"/etc/foo/reversed.conf":  rpmutils.RPMFILE_CONFIG | rpmutils.RPMFILE_NOREPLACE | rpmutils.RPMFILE_MISSINGOK,
+	}, flags)
+
+	info.Contents = []*files.Content{
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/verify.conf", Type: "config|noreplace|verify"},
+	}
+	err = Default.Package(info, io.Discard)
+	require.ErrorIs(t, err, files.ErrInvalidConfigType)
+	require.ErrorContains(t, err, `unknown token "verify"`)
+}
+
 func TestDisableGlobbing(t *testing.T) {
 	info := exampleInfo()
 	info.DisableGlobbing = true
@@ -1063,13 +1697,251 @@ func getTree(tb testing.TB, rpm []byte) []string {
 	return tree
 }
 
-func extractFileHeaderFromRpm(rpm []byte, filename string) (*cpio.Cpio_newc_header, error) {
-	rpmFile, err := rpmutils.ReadRpm(bytes.NewReader(rpm))
-	if err != nil {
-		return nil, err
+// TestRPMFileIndexes checks that the arrays of the file tags of the header all
+// describe the files in the same order, directories before their contents,
+// and that the payload has them in that order as well.
+func TestRPMFileIndexes(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{Destination: "/usr/share/foo/sub/baz", Data: []byte("baz"), FileInfo: &files.ContentFileInfo{Owner: "1000", Mode: 0o600}},
+		{Destination: "/usr/share/foo-bar", Data: []byte("foobar")},
+		{Destination: "/usr/share/foo/sub", Type: files.TypeDir, FileInfo: &files.ContentFileInfo{Mode: 0o700}},
+		{Destination: "/usr/bin/foo", Source: "/usr/share/foo/sub/baz", Type: files.TypeSymlink},
+		{Destination: "/var/log/foo.log", Type: files.TypeRPMGhost},
+		{Destination: "/usr/share/foo", Type: files.TypeDir},
+		{Destination: "/etc/foo.conf", Data: []byte("foo = bar\n"), Type: files.TypeConfig, FileInfo: &files.ContentFileInfo{Group: "1001"}},
 	}
 
-	pr, err := rpmFile.PayloadReader()
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	names, err := rpm.Header.GetStrings(rpmutils.OLDFILENAMES)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/etc/foo.conf",
+		"/usr/bin/foo",
+		"/usr/share/foo",
+		"/usr/share/foo-bar",
+		"/usr/share/foo/sub",
+		"/usr/share/foo/sub/baz",
+		"/var/log/foo.log",
+	}, names)
+
+	for _, tag := range []int{
+		rpmutils.BASENAMES, rpmutils.DIRINDEXES, rpmutils.FILESIZES,
+		rpmutils.FILEMODES, rpmutils.FILEUSERNAME, rpmutils.FILEGROUPNAME,
+		rpmutils.FILEMTIMES, rpmutils.FILEDIGESTS, rpmutils.FILELINKTOS,
+		rpmutils.FILEFLAGS, rpmutils.FILEINODES, rpmutils.FILEVERIFYFLAGS,
+		rpmutils.FILERDEVS, tagFileUIDs, tagFileGIDs, tagFileLangs,
+	} {
+		values, err := rpm.Header.Get(tag)
+		require.NoError(t, err, tag)
+		require.Equal(t, len(names), reflect.ValueOf(values).Len(), tag)
+	}
+
+	type fileEntry struct {
+		Mode          int
+		Size          int
+		Owner, Group  string
+		UID, GID      uint32
+		Digest, Link  string
+		Config, Ghost bool
+	}
+	modes, err := rpm.Header.GetInts(rpmutils.FILEMODES)
+	require.NoError(t, err)
+	sizes, err := rpm.Header.GetInts(rpmutils.FILESIZES)
+	require.NoError(t, err)
+	owners, err := rpm.Header.GetStrings(rpmutils.FILEUSERNAME)
+	require.NoError(t, err)
+	groups, err := rpm.Header.GetStrings(rpmutils.FILEGROUPNAME)
+	require.NoError(t, err)
+	uids, err := rpm.Header.GetUint32s(tagFileUIDs)
+	require.NoError(t, err)
+	gids, err := rpm.Header.GetUint32s(tagFileGIDs)
+	require.NoError(t, err)
+	digests, err := rpm.Header.GetStrings(rpmutils.FILEDIGESTS)
+	require.NoError(t, err)
+	links, err := rpm.Header.GetStrings(rpmutils.FILELINKTOS)
+	require.NoError(t, err)
+	flags, err := rpm.Header.GetInts(rpmutils.FILEFLAGS)
+	require.NoError(t, err)
+	got := map[string]fileEntry{}
+	for i, name := range names {
+		got[name] = fileEntry{
+			Mode:   modes[i],
+			Size:   sizes[i],
+			Owner:  owners[i],
+			Group:  groups[i],
+			UID:    uids[i],
+			GID:    gids[i],
+			Digest: digests[i],
+			Link:   links[i],
+			Config: flags[i]&rpmutils.RPMFILE_CONFIG != 0,
+			Ghost:  flags[i]&rpmutils.RPMFILE_GHOST != 0,
+		}
+	}
+	digest := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+	require.Equal(t, map[string]fileEntry{
+		"/etc/foo.conf":          {cpio.S_ISREG | 0o644, 10, "root", "1001", 0, 1001, digest("foo = bar\n"), "", true, false},
+		"/usr/bin/foo":           {cpio.S_ISLNK, 22, "root", "root", 0, 0, "", "/usr/share/foo/sub/baz", false, false},
+		"/usr/share/foo":         {cpio.S_ISDIR | 0o755, 4096, "root", "root", 0, 0, "", "", false, false},
+		"/usr/share/foo-bar":     {cpio.S_ISREG | 0o644, 6, "root", "root", 0, 0, digest("foobar"), "", false, false},
+		"/usr/share/foo/sub":     {cpio.S_ISDIR | 0o700, 4096, "root", "root", 0, 0, "", "", false, false},
+		"/usr/share/foo/sub/baz": {cpio.S_ISREG | 0o600, 3, "1000", "root", 1000, 0, digest("baz"), "", false, false},
+		"/var/log/foo.log":       {cpio.S_ISREG | 0o644, 0, "root", "root", 0, 0, digest(""), "", false, true},
+	}, got)
+
+	// ghost files have no payload
+	require.Equal(t, names[:len(names)-1], getTree(t, buf.Bytes()))
+}
+
+func TestRPMFileLangs(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{Destination: "/usr/share/locale/de/LC_MESSAGES/foo.mo", Data: []byte("de"), Lang: "de"},
+		{Destination: "/usr/share/locale/pt_BR/LC_MESSAGES/foo.mo", Data: []byte("pt"), Lang: "pt_BR"},
+		{Destination: "/usr/bin/foo", Data: []byte("foo")},
+		{
+			Source:      ".",
+			Destination: "/usr/share/foo/sr@latin",
+			Type:        files.TypeTree,
+			Lang:        "sr@latin",
+			FS:          fstest.MapFS{"help.txt": {Data: []byte("help")}},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	names, err := rpm.Header.GetStrings(rpmutils.OLDFILENAMES)
+	require.NoError(t, err)
+	langs, err := rpm.Header.GetStrings(tagFileLangs)
+	require.NoError(t, err)
+	got := map[string]string{}
+	for i, name := range names {
+		got[name] = langs[i]
+	}
+	require.Equal(t, map[string]string{
+		"/usr/bin/foo": "",
+		"/usr/share/locale/de/LC_MESSAGES/foo.mo":    "de",
+		"/usr/share/locale/pt_BR/LC_MESSAGES/foo.mo": "pt_BR",
+		// the directory of the tree itself is not specific to the locale
+		"/usr/share/foo/sr@latin":          "",
+		"/usr/share/foo/sr@latin/help.txt": "sr@latin",
+	}, got)
+
+	info.Contents[0].Lang = "de/LC_MESSAGES"
+	require.ErrorIs(t, Default.Package(info, io.Discard), files.ErrInvalidLang)
+}
+
+func TestRPMMinToolVersion(t *testing.T) {
+	build := func(t *testing.T, minVersion string) (*rpmutils.Rpm, string) {
+		t.Helper()
+		var w bytes.Buffer
+		prevNoticer := warning.Noticer
+		t.Cleanup(func() { warning.Noticer = prevNoticer })
+		warning.Noticer = &w
+
+		info := exampleInfo()
+		info.RPM.Compression = "zstd:19"
+		info.MinToolVersion = map[string]string{"rpm": minVersion}
+		// testdata/fake is a script without a shebang
+		info.SuppressLints = []string{"script-shebang"}
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		require.NoError(t, Default.Verify(info, bytes.NewReader(buf.Bytes())))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		return rpm, w.String()
+	}
+
+	t.Run("current", func(t *testing.T) {
+		rpm, log := build(t, "4.14.0")
+		require.Empty(t, log)
+		compressor, err := rpm.Header.GetString(rpmutils.PAYLOADCOMPRESSOR)
+		require.NoError(t, err)
+		require.Equal(t, "zstd", compressor)
+		algo, err := rpm.Header.GetInts(rpmutils.FILEDIGESTALGO)
+		require.NoError(t, err)
+		require.Equal(t, hashAlgoSHA256, algo[0])
+	})
+
+	t.Run("no zstd nor weak dependencies", func(t *testing.T) {
+		rpm, log := build(t, "4.11.3")
+		require.Contains(t, log, "rpm 4.11.3 does not support zstd:19 payloads, using xz instead")
+		require.Contains(t, log, "rpm 4.11.3 does not support weak dependencies")
+		compressor, err := rpm.Header.GetString(rpmutils.PAYLOADCOMPRESSOR)
+		require.NoError(t, err)
+		require.Equal(t, "xz", compressor)
+		require.False(t, rpm.Header.HasTag(5046))
+		require.False(t, rpm.Header.HasTag(5049))
+	})
+
+	t.Run("no xz nor sha256 digests", func(t *testing.T) {
+		rpm, log := build(t, "4.4.2")
+		require.Contains(t, log, "rpm 4.4.2 does not support zstd:19 payloads, using gzip instead")
+		require.Contains(t, log, "rpm 4.4.2 does not support sha256 file digests, using md5 instead")
+		compressor, err := rpm.Header.GetString(rpmutils.PAYLOADCOMPRESSOR)
+		require.NoError(t, err)
+		require.Equal(t, "gzip", compressor)
+
+		fileInfos, err := rpm.Header.GetFiles()
+		require.NoError(t, err)
+		digests := map[string]string{}
+		for _, fileInfo := range fileInfos {
+			digests[fileInfo.Name()] = fileInfo.Digest()
+		}
+		fake, err := os.ReadFile("../testdata/fake")
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%x", md5.Sum(fake)), digests["/usr/bin/fake"]) // nolint:gosec
+		require.Empty(t, digests["/usr/share/whatever"])
+		algo, err := rpm.Header.GetInts(rpmutils.FILEDIGESTALGO)
+		require.NoError(t, err)
+		require.Len(t, algo, len(fileInfos))
+		require.Equal(t, hashAlgoMD5, algo[0])
+	})
+}
+
+// TestPayloadPaths checks the names of the cpio entries, which rpmpack writes
+// as the absolute paths of the files, rather than prefixed with ./ as
+// rpmbuild does, rpm matching both against the file list of the header.
+func TestPayloadPaths(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{Source: "../testdata/fake", Destination: "usr/bin//fake"},
+		{Source: "../testdata/whatever.conf", Destination: "./etc/./foo//foo.conf", Type: files.TypeConfig},
+		{Source: "/usr/bin/fake", Destination: "/usr/sbin/fake/", Type: files.TypeSymlink},
+		{Destination: "var//lib/foo/", Type: files.TypeDir},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	require.Equal(t, []string{
+		"/etc/foo/foo.conf",
+		"/usr/bin/fake",
+		"/usr/sbin/fake",
+		"/var/lib/foo",
+	}, getTree(t, buf.Bytes()))
+
+	headerFiles, err := extraFileInfoSliceFromRpm(buf.Bytes())
+	require.NoError(t, err)
+	for _, file := range headerFiles {
+		require.True(t, strings.HasPrefix(file.Name(), "/"), "%s is not absolute", file.Name())
+		require.NotContains(t, file.Name(), "//")
+	}
+}
+
+func extractFileHeaderFromRpm(rpm []byte, filename string) (*cpio.Cpio_newc_header, error) {
+	rpmFile, err := rpmutils.ReadRpm(bytes.NewReader(rpm))
+	if err != nil {
+		return nil, err
+	}
+
+	pr, err := rpmFile.PayloadReader()
 	if err != nil {
 		return nil, err
 	}
@@ -1092,3 +1964,715 @@ func extractFileHeaderFromRpm(rpm []byte, filename string) (*cpio.Cpio_newc_head
 
 	return nil, os.ErrNotExist
 }
+
+func TestDirectoryModes(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/sudoers.d/foo",
+		},
+	}
+	info.DirectoryModes = map[string]files.ContentFileInfo{
+		"/etc/sudoers.d/": {Mode: 0o750},
+	}
+
+	var rpmFileBuffer bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpmFileBuffer))
+
+	require.Equal(t, []string{
+		"/etc/sudoers.d",
+		"/etc/sudoers.d/foo",
+	}, getTree(t, rpmFileBuffer.Bytes()))
+
+	h, err := extractFileHeaderFromRpm(rpmFileBuffer.Bytes(), "/etc/sudoers.d")
+	require.NoError(t, err)
+	require.Equal(t, int(tagDirectory|0o750), h.Mode())
+
+	// parents without an explicit mode are still left implicit
+	_, err = extractFileHeaderFromRpm(rpmFileBuffer.Bytes(), "/etc")
+	require.Equal(t, os.ErrNotExist, err)
+}
+
+func TestSparseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("header"))
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(4<<20))
+	require.NoError(t, f.Close())
+
+	prevThreshold := sparseWarningThreshold
+	prevNoticer := warning.Noticer
+	t.Cleanup(func() {
+		sparseWarningThreshold = prevThreshold
+		warning.Noticer = prevNoticer
+	})
+	sparseWarningThreshold = 1 << 20
+	var warnings bytes.Buffer
+	warning.Noticer = &warnings
+
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      path,
+			Destination: "/var/lib/foo/disk.img",
+		},
+	}
+
+	var rpmFileBuffer bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpmFileBuffer))
+
+	data, err := extractFileFromRpm(rpmFileBuffer.Bytes(), "/var/lib/foo/disk.img")
+	require.NoError(t, err)
+	require.Len(t, data, 4<<20)
+	require.Equal(t, []byte("header"), data[:6])
+
+	if runtime.GOOS == "linux" {
+		require.Contains(t, warnings.String(), path+" is a sparse file with")
+	}
+}
+
+func TestMergeDir(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Destination: "/etc/foo.d",
+			Type:        files.TypeMergeDir,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo.d/foo.conf",
+		},
+	}
+	info.DirectoryModes = map[string]files.ContentFileInfo{
+		"/etc/foo.d": {Mode: 0o750},
+	}
+
+	var rpmFileBuffer bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpmFileBuffer))
+
+	require.Equal(t, []string{"/etc/foo.d/foo.conf"}, getTree(t, rpmFileBuffer.Bytes()))
+}
+
+func TestVerify(t *testing.T) {
+	for name, setup := range map[string]func(info *nfpm.Info){
+		"default":   func(*nfpm.Info) {},
+		"xz":        func(info *nfpm.Info) { info.RPM.Compression = "xz" },
+		"zstd":      func(info *nfpm.Info) { info.RPM.Compression = "zstd" },
+		"signed":    func(info *nfpm.Info) { info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey.asc" },
+		"changelog": func(info *nfpm.Info) { info.Changelog = "../testdata/changelog.yaml" },
+	} {
+		setup := setup
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.RPM.Signature.KeyPassphrase = "hunter2"
+			setup(info)
+
+			var rpm bytes.Buffer
+			require.NoError(t, Default.Package(info, &rpm))
+			require.NoError(t, Default.Verify(info, bytes.NewReader(rpm.Bytes())))
+		})
+	}
+}
+
+func TestRPMPayloadDigest(t *testing.T) {
+	for _, compression := range []string{"gzip", "lzma", "xz", "zstd"} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			info := exampleInfo()
+			info.RPM.Compression = compression
+
+			var rpm bytes.Buffer
+			require.NoError(t, Default.Package(info, &rpm))
+
+			header, err := rpmutils.ReadHeader(bytes.NewReader(rpm.Bytes()))
+			require.NoError(t, err)
+			format, err := header.GetString(rpmutils.PAYLOADFORMAT)
+			require.NoError(t, err)
+			require.Equal(t, "cpio", format)
+
+			algo, err := header.GetInts(tagPayloadDigestAlgo)
+			require.NoError(t, err)
+			require.Equal(t, []int{hashAlgoSHA256}, algo)
+
+			// the digest is the one of the compressed payload, which follows
+			// the header.
+			digest, err := header.GetStrings(tagPayloadDigest)
+			require.NoError(t, err)
+			payload := rpm.Bytes()[header.GetRange().End:]
+			require.Equal(t, []string{fmt.Sprintf("%x", sha256.Sum256(payload))}, digest)
+		})
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	info := exampleInfo()
+	info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+	info.RPM.Signature.KeyPassphrase = "hunter2"
+
+	var rpm bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpm))
+
+	header, err := rpmutils.ReadHeader(bytes.NewReader(rpm.Bytes()))
+	require.NoError(t, err)
+	headerRange := header.GetRange()
+
+	t.Run("header", func(t *testing.T) {
+		corrupted := bytes.Clone(rpm.Bytes())
+		corrupted[headerRange.End-1] ^= 0xff
+		require.Error(t, Default.Verify(info, bytes.NewReader(corrupted)))
+	})
+
+	t.Run("payload", func(t *testing.T) {
+		corrupted := bytes.Clone(rpm.Bytes())
+		corrupted[headerRange.End+(len(corrupted)-headerRange.End)/2] ^= 0xff
+		require.ErrorContains(t, Default.Verify(info, bytes.NewReader(corrupted)), "payload: digest mismatch")
+	})
+
+	t.Run("missing content", func(t *testing.T) {
+		info := exampleInfo()
+		var rpm bytes.Buffer
+		require.NoError(t, Default.Package(info, &rpm))
+		info.Contents = append(info.Contents, &files.Content{Source: "../testdata/fake", Destination: "/usr/bin/missing"})
+		require.EqualError(t, Default.Verify(info, bytes.NewReader(rpm.Bytes())), "/usr/bin/missing: missing from package")
+	})
+}
+
+func TestResign(t *testing.T) {
+	info := exampleInfo()
+	var unsigned bytes.Buffer
+	require.NoError(t, Default.Package(info, &unsigned))
+
+	info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+	info.RPM.Signature.KeyPassphrase = "hunter2"
+	var resigned bytes.Buffer
+	require.NoError(t, Default.Resign(info, bytes.NewReader(unsigned.Bytes()), &resigned))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(resigned.Bytes())))
+
+	t.Run("replace", func(t *testing.T) {
+		info := exampleInfo()
+		info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey_unprotected.asc"
+		var signed bytes.Buffer
+		require.NoError(t, Default.Package(info, &signed))
+
+		info.RPM.Signature.KeyFile = "../internal/sign/testdata/privkey.asc"
+		info.RPM.Signature.KeyPassphrase = "hunter2"
+		var resigned bytes.Buffer
+		require.NoError(t, Default.Resign(info, bytes.NewReader(signed.Bytes()), &resigned))
+		require.NoError(t, Default.Verify(info, bytes.NewReader(resigned.Bytes())))
+	})
+
+	t.Run("not an rpm", func(t *testing.T) {
+		require.Error(t, Default.Resign(info, strings.NewReader("not an rpm"), io.Discard))
+	})
+}
+
+func TestDisownStandardDirs(t *testing.T) {
+	info := exampleInfo()
+	info.DisownStandardDirs = true
+	info.Contents = []*files.Content{
+		{
+			Destination: "/usr/bin",
+			Type:        files.TypeDir,
+		},
+		{
+			Destination: "/usr/share/foo",
+			Type:        files.TypeDir,
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/usr/share/foo/whatever.conf",
+		},
+	}
+
+	var rpmFileBuffer bytes.Buffer
+	require.NoError(t, Default.Package(info, &rpmFileBuffer))
+
+	require.Equal(t, []string{
+		"/usr/share/foo",
+		"/usr/share/foo/whatever.conf",
+	}, getTree(t, rpmFileBuffer.Bytes()))
+}
+
+func TestRPMAttrScriptlets(t *testing.T) {
+	info := exampleInfo()
+	info.Scripts = nfpm.Scripts{PostInstall: "../testdata/scripts/postinstall.sh"}
+	info.RPM.Scripts = nfpm.RPMScripts{}
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/fake/fake.conf",
+			Type:        files.TypeConfig,
+			FileInfo:    &files.ContentFileInfo{Attrs: []string{"immutable"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	data, err := rpm.Header.GetString(rpmutils.PREIN)
+	require.NoError(t, err)
+	require.Equal(t, "chattr -i '/etc/fake/fake.conf' >/dev/null 2>&1 || :\n", data)
+
+	data, err = rpm.Header.GetString(rpmutils.POSTIN)
+	require.NoError(t, err)
+	require.Equal(t, `#!/bin/bash
+
+echo "Postinstall" > /dev/null
+
+chattr +i '/etc/fake/fake.conf' || :
+`, data)
+
+	data, err = rpm.Header.GetString(rpmutils.PREUN)
+	require.NoError(t, err)
+	require.Equal(t, `if [ $1 -eq 0 ] ; then
+chattr -i '/etc/fake/fake.conf' >/dev/null 2>&1 || :
+fi
+`, data)
+
+	_, err = rpm.Header.GetString(rpmutils.POSTUN)
+	require.Error(t, err)
+}
+
+func TestRPMAlternatives(t *testing.T) {
+	info := exampleInfo()
+	info.Scripts = nfpm.Scripts{}
+	info.RPM.Scripts = nfpm.RPMScripts{}
+	info.Alternatives = []nfpm.Alternative{
+		{
+			Name:     "editor",
+			Link:     "/usr/bin/editor",
+			Path:     "/usr/bin/fake",
+			Priority: 50,
+			Slaves: []nfpm.AlternativeSlave{
+				{Name: "editor.conf", Link: "/etc/editor.conf", Path: "/etc/fake/fake.conf"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	data, err := rpm.Header.GetString(rpmutils.POSTIN)
+	require.NoError(t, err)
+	require.Equal(t, "update-alternatives --install /usr/bin/editor editor /usr/bin/fake 50 --slave /etc/editor.conf editor.conf /etc/fake/fake.conf\n", data)
+
+	data, err = rpm.Header.GetString(rpmutils.POSTUN)
+	require.NoError(t, err)
+	require.Equal(t, `if [ $1 -eq 0 ] ; then
+update-alternatives --remove editor /usr/bin/fake
+fi
+`, data)
+}
+
+func TestRPMConfigMigrations(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "migrate.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`sed -i "s/^old=/new=/" "$CONFIG"`), 0o644))
+
+	info := exampleInfo()
+	info.Scripts = nfpm.Scripts{}
+	info.RPM.Scripts = nfpm.RPMScripts{}
+	info.Contents = append(info.Contents,
+		&files.Content{Source: "../testdata/whatever.conf", Destination: "/etc/fake/kept.conf", Type: files.TypeConfigNoReplace},
+		&files.Content{Source: "../testdata/whatever.conf", Destination: "/etc/fake/replaced.conf", Type: files.TypeConfigNoReplace},
+		&files.Content{Source: "../testdata/whatever.conf", Destination: "/etc/fake/migrated.conf", Type: files.TypeConfigNoReplace},
+	)
+	info.RPM.ConfigMigrations = []nfpm.RPMConfigMigration{
+		{Path: "/etc/fake/kept.conf"},
+		{Path: "/etc/fake/replaced.conf", Strategy: nfpm.ConfigMigrationReplace},
+		{Path: "/etc/fake/migrated.conf", Strategy: nfpm.ConfigMigrationScript, Script: script},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	data, err := rpm.Header.GetString(1152)
+	require.NoError(t, err)
+	require.Equal(t, `if [ -e '/etc/fake/kept.conf.rpmnew' ] ; then
+    echo 'foo: the new default of /etc/fake/kept.conf was installed as /etc/fake/kept.conf.rpmnew, merge it into /etc/fake/kept.conf' >&2
+fi
+if [ -e '/etc/fake/replaced.conf.rpmnew' ] ; then
+    mv -f '/etc/fake/replaced.conf' '/etc/fake/replaced.conf.rpmsave'
+    mv -f '/etc/fake/replaced.conf.rpmnew' '/etc/fake/replaced.conf'
+    echo 'foo: /etc/fake/replaced.conf was saved as /etc/fake/replaced.conf.rpmsave and replaced by the new default' >&2
+fi
+if [ -e '/etc/fake/migrated.conf.rpmnew' ] ; then
+(
+CONFIG='/etc/fake/migrated.conf'
+RPMNEW='/etc/fake/migrated.conf.rpmnew'
+sed -i "s/^old=/new=/" "$CONFIG"
+)
+fi
+`, data)
+
+	for name, migration := range map[string]nfpm.RPMConfigMigration{
+		"unknown strategy":  {Path: "/etc/fake/kept.conf", Strategy: "merge"},
+		"missing script":    {Path: "/etc/fake/kept.conf", Strategy: nfpm.ConfigMigrationScript},
+		"unexpected script": {Path: "/etc/fake/kept.conf", Strategy: nfpm.ConfigMigrationLog, Script: script},
+		"not noreplace":     {Path: "/etc/fake/fake.conf"},
+		"not packaged":      {Path: "/etc/fake/other.conf"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			info := exampleInfo()
+			info.Contents = append(info.Contents,
+				&files.Content{Source: "../testdata/whatever.conf", Destination: "/etc/fake/kept.conf", Type: files.TypeConfigNoReplace})
+			info.RPM.ConfigMigrations = []nfpm.RPMConfigMigration{migration}
+			var target nfpm.ValidationError
+			require.ErrorAs(t, Default.Package(info, io.Discard), &target)
+			require.Equal(t, "invalid_config_migration", target.Code)
+		})
+	}
+}
+
+func TestRPMScriptShell(t *testing.T) {
+	info := exampleInfo()
+	info.Scripts = nfpm.Scripts{}
+	info.RPM.Scripts = nfpm.RPMScripts{}
+	info.ScriptShell = "/usr/bin/busybox-sh"
+	info.Alternatives = []nfpm.Alternative{
+		{Name: "editor", Link: "/usr/bin/editor", Path: "/usr/bin/fake", Priority: 50},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	for _, tag := range []int{rpmutils.POSTINPROG, rpmutils.POSTUNPROG} {
+		prog, err := rpm.Header.GetString(tag)
+		require.NoError(t, err)
+		require.Equal(t, "/usr/bin/busybox-sh", prog)
+	}
+	_, err = rpm.Header.GetString(rpmutils.PREINPROG)
+	require.Error(t, err, "the package has no %pre scriptlet")
+
+	t.Run("default", func(t *testing.T) {
+		info.ScriptShell = ""
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		prog, err := rpm.Header.GetString(rpmutils.POSTINPROG)
+		require.NoError(t, err)
+		require.Equal(t, "/bin/sh", prog)
+	})
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	info := exampleInfo()
+	info.MTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	info.Snapshot = &nfpm.Snapshot{Commit: "abcdef"}
+	require.NoError(t, nfpm.PrepareForPackager(info, packagerName))
+	require.Equal(t, "foo-1.0.0-0.snapshot.20240101.abcdef.x86_64.rpm", Default.ConventionalFileName(info))
+
+	// the version is the same, the release sorts below the first one.
+	require.Equal(t, "1.0.0", formatVersion(info))
+	require.Negative(t, rpmutils.Vercmp(info.Release, "1"))
+	require.Positive(t, rpmutils.Vercmp(info.Release, "0.snapshot.20231231.fedcba"))
+}
+
+func TestRPMNumericOwnership(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = []*files.Content{
+		{
+			Source:      "../testdata/fake",
+			Destination: "/usr/bin/fake",
+			FileInfo:    &files.ContentFileInfo{Owner: "1000", Group: "1001"},
+		},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/fake/fake.conf",
+			Type:        files.TypeConfig,
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	// files are sorted by name
+	owners, err := rpm.Header.GetStrings(rpmutils.FILEUSERNAME)
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "1000"}, owners)
+	groups, err := rpm.Header.GetStrings(rpmutils.FILEGROUPNAME)
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "1001"}, groups)
+
+	uids, err := rpm.Header.GetUint32s(tagFileUIDs)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0, 1000}, uids)
+	gids, err := rpm.Header.GetUint32s(tagFileGIDs)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0, 1001}, gids)
+
+	t.Run("names only", func(t *testing.T) {
+		info := exampleInfo()
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		_, err = rpm.Header.GetUint32s(tagFileUIDs)
+		require.Error(t, err)
+	})
+
+	t.Run("resolved names", func(t *testing.T) {
+		info := exampleInfo()
+		info.GroupFile = "../testdata/group"
+		info.Contents = []*files.Content{
+			{
+				Source:      "../testdata/fake",
+				Destination: "/usr/bin/fake",
+				FileInfo:    &files.ContentFileInfo{Group: "foo"},
+			},
+			{
+				Source:      "../testdata/whatever.conf",
+				Destination: "/etc/fake/fake.conf",
+				Type:        files.TypeConfig,
+				FileInfo:    &files.ContentFileInfo{Owner: "1000", Group: "users"},
+			},
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+
+		groups, err := rpm.Header.GetStrings(rpmutils.FILEGROUPNAME)
+		require.NoError(t, err)
+		require.Equal(t, []string{"users", "foo"}, groups)
+		gids, err := rpm.Header.GetUint32s(tagFileGIDs)
+		require.NoError(t, err)
+		require.Equal(t, []uint32{100, 997}, gids)
+
+		// the owners are not resolved without a passwd file
+		owners, err := rpm.Header.GetStrings(rpmutils.FILEUSERNAME)
+		require.NoError(t, err)
+		require.Equal(t, []string{"1000", "root"}, owners)
+		uids, err := rpm.Header.GetUint32s(tagFileUIDs)
+		require.NoError(t, err)
+		require.Equal(t, []uint32{1000, 0}, uids)
+	})
+}
+
+func TestRPMScriptFlags(t *testing.T) {
+	info := exampleInfo()
+	info.RPM.ScriptFlags = nfpm.RPMScriptFlags{
+		PreInstall:  []string{"expand"},
+		PostInstall: []string{"expand", "critical"},
+		PostTrans:   []string{"qformat"},
+		// ignored, the package has no such scriptlet
+		PreRemove: []string{},
+	}
+	info.Scripts.PreRemove = ""
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	for tag, expected := range map[int]uint32{
+		tagPreInFlags:     1,
+		tagPostInFlags:    5,
+		tagPostTransFlags: 2,
+	} {
+		flags, err := rpm.Header.GetUint32s(tag)
+		require.NoError(t, err)
+		require.Equal(t, []uint32{expected}, flags, "tag %d", tag)
+	}
+	for _, tag := range []int{tagPreUnFlags, tagPostUnFlags, tagPreTransFlags, tagVerifyScriptFlags} {
+		_, err := rpm.Header.GetUint32s(tag)
+		require.Error(t, err, "tag %d", tag)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		info := exampleInfo()
+		info.RPM.ScriptFlags.Verify = []string{"expand", "noexpand"}
+		err := Default.Package(info, io.Discard)
+		require.ErrorIs(t, err, ErrInvalidScriptFlag)
+		require.EqualError(t, err, `invalid script flag: verify: "noexpand", must be one of expand, qformat or critical`)
+	})
+}
+
+func TestRPMZstdCompression(t *testing.T) {
+	info := exampleInfo()
+	info.RPM.Compression = "zstd:19"
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	compressor, err := rpm.Header.GetString(rpmutils.PAYLOADCOMPRESSOR)
+	require.NoError(t, err)
+	require.Equal(t, "zstd", compressor)
+	flags, err := rpm.Header.GetString(tagPayloadFlags)
+	require.NoError(t, err)
+	require.Equal(t, "19", flags)
+
+	// the payload decompresses to the original contents
+	expected, err := os.ReadFile("../testdata/fake")
+	require.NoError(t, err)
+	data, err := extractFileFromRpm(buf.Bytes(), "/usr/bin/fake")
+	require.NoError(t, err)
+	require.Equal(t, expected, data)
+
+	t.Run("default", func(t *testing.T) {
+		info := exampleInfo()
+		info.RPM.Compression = ""
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		compressor, err := rpm.Header.GetString(rpmutils.PAYLOADCOMPRESSOR)
+		require.NoError(t, err)
+		require.Equal(t, "gzip", compressor)
+	})
+
+	for _, compression := range []string{"zstd:23", "zstd:-8", "none"} {
+		t.Run(compression, func(t *testing.T) {
+			info := exampleInfo()
+			info.RPM.Compression = compression
+			require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidCompression)
+		})
+	}
+}
+
+func TestRPMBuildHostAndTime(t *testing.T) {
+	build := func(t *testing.T, info *nfpm.Info) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, Default.Package(info, &buf))
+		return buf.Bytes()
+	}
+	header := func(t *testing.T, data []byte) (string, uint64) {
+		t.Helper()
+		rpm, err := rpmutils.ReadRpm(bytes.NewReader(data))
+		require.NoError(t, err)
+		host, err := rpm.Header.GetString(rpmutils.BUILDHOST)
+		require.NoError(t, err)
+		times, err := rpm.Header.GetUint64s(rpmutils.BUILDTIME)
+		require.NoError(t, err)
+		require.Len(t, times, 1)
+		return host, times[0]
+	}
+
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := exampleInfo()
+	info.MTime = mtime
+	first := build(t, info)
+	host, buildTime := header(t, first)
+	require.Equal(t, "localhost", host)
+	require.Equal(t, uint64(mtime.Unix()), buildTime)
+
+	info = exampleInfo()
+	info.MTime = mtime
+	require.Equal(t, first, build(t, info))
+
+	t.Run("explicit", func(t *testing.T) {
+		info := exampleInfo()
+		info.RPM.BuildHost = "build.example.com"
+		host, _ := header(t, build(t, info))
+		require.Equal(t, "build.example.com", host)
+	})
+
+	t.Run("source date epoch", func(t *testing.T) {
+		t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+		info := exampleInfo()
+		info.MTime = time.Time{}
+		_, buildTime := header(t, build(t, info))
+		require.Equal(t, uint64(1700000000), buildTime)
+	})
+
+	for _, host := range []string{"my host", "-host", "host."} {
+		t.Run("invalid "+host, func(t *testing.T) {
+			info := exampleInfo()
+			info.RPM.BuildHost = host
+			require.ErrorIs(t, Default.Package(info, io.Discard), ErrInvalidBuildHost)
+		})
+	}
+}
+
+func TestDefAttr(t *testing.T) {
+	info := exampleInfo()
+	info.DefAttr = nfpm.DefAttr{FileMode: 0o640, DirMode: 0o750, Owner: "foo", Group: "bar"}
+	info.Contents = []*files.Content{
+		{Source: "../testdata/whatever.conf", Destination: "/etc/foo/default.conf"},
+		{
+			Source:      "../testdata/whatever.conf",
+			Destination: "/etc/foo/explicit.conf",
+			FileInfo:    &files.ContentFileInfo{Mode: 0o600, Owner: "baz"},
+		},
+		{Destination: "/var/lib/foo", Type: files.TypeDir},
+		{Source: "../testdata/something", Destination: "/usr/share/foo", Type: files.TypeTree},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	infos, err := extraFileInfoSliceFromRpm(buf.Bytes())
+	require.NoError(t, err)
+
+	type attr struct {
+		mode         int
+		owner, group string
+	}
+	got := map[string]attr{}
+	for _, fi := range infos {
+		got[fi.Name()] = attr{fi.Mode() & 0o7777, fi.UserName(), fi.GroupName()}
+	}
+	require.Equal(t, map[string]attr{
+		"/etc/foo/default.conf":  {0o640, "foo", "bar"},
+		"/etc/foo/explicit.conf": {0o600, "baz", "bar"},
+		"/var/lib/foo":           {0o750, "foo", "bar"},
+		"/usr/share/foo":         {0o750, "foo", "bar"},
+		"/usr/share/foo/a":       {0o640, "foo", "bar"},
+		"/usr/share/foo/b":       {0o640, "foo", "bar"},
+		"/usr/share/foo/c":       {0o750, "foo", "bar"},
+		"/usr/share/foo/c/d":     {0o640, "foo", "bar"},
+	}, got)
+}
+
+func TestRPMWeakDependencies(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(exampleInfo(), &buf))
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	// the recommends and suggests are recorded as weak dependencies
+	recommends, err := rpm.Header.GetStrings(5046)
+	require.NoError(t, err)
+	require.Equal(t, []string{"git"}, recommends)
+	suggests, err := rpm.Header.GetStrings(5049)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bash"}, suggests)
+	requires, err := rpm.Header.GetStrings(rpmutils.REQUIRENAME)
+	require.NoError(t, err)
+	require.NotContains(t, requires, "git")
+}
+
+func TestMetaPackage(t *testing.T) {
+	info := exampleInfo()
+	info.Contents = nil
+
+	var buf bytes.Buffer
+	require.NoError(t, Default.Package(info, &buf))
+	require.NoError(t, Default.Verify(info, bytes.NewReader(buf.Bytes())))
+	require.Empty(t, getTree(t, buf.Bytes()))
+
+	rpm, err := rpmutils.ReadRpm(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	requires, err := rpm.Header.GetStrings(rpmutils.REQUIRENAME)
+	require.NoError(t, err)
+	require.Contains(t, requires, "bash")
+	size, err := rpm.Header.GetUint64s(rpmutils.SIZE)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0}, size)
+}
@@ -0,0 +1,210 @@
+package rpm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// The snippets below are the expansions of the systemd rpm macros, as nfpm
+// does not run rpm macros. They rely on the first argument rpm passes to the
+// scriptlets, which is the number of instances of the package that will be
+// installed once the transaction completes:
+//
+//   - %post: 1 on the initial installation, 2 or more on upgrades
+//   - %preun and %postun: 0 on removal, 1 or more on upgrades
+
+// SystemdPost returns the expansion of %systemd_post, which applies the
+// presets of the given units on the initial installation.
+func SystemdPost(units ...string) string {
+	return `if [ $1 -eq 1 ] ; then
+    # Initial installation
+    systemctl --no-reload preset ` + strings.Join(units, " ") + ` >/dev/null 2>&1 || :
+fi
+`
+}
+
+// SystemdPreun returns the expansion of %systemd_preun, which disables and
+// stops the given units when the package is removed, but not when it is
+// upgraded.
+func SystemdPreun(units ...string) string {
+	return `if [ $1 -eq 0 ] ; then
+    # Package removal, not upgrade
+    systemctl --no-reload disable --now ` + strings.Join(units, " ") + ` >/dev/null 2>&1 || :
+fi
+`
+}
+
+// SystemdPostun returns the expansion of %systemd_postun, which reloads the
+// systemd manager configuration.
+func SystemdPostun(...string) string {
+	return `systemctl daemon-reload >/dev/null 2>&1 || :
+`
+}
+
+// SystemdPostunWithRestart returns the expansion of
+// %systemd_postun_with_restart, which additionally restarts the given units
+// if they are running when the package is upgraded.
+func SystemdPostunWithRestart(units ...string) string {
+	return SystemdPostun(units...) + `if [ $1 -ge 1 ] ; then
+    # Package upgrade, not uninstall
+    systemctl try-restart ` + strings.Join(units, " ") + ` >/dev/null 2>&1 || :
+fi
+`
+}
+
+// serviceScriptlets returns the post, preun and postun snippets for the
+// configured service units, if any.
+func serviceScriptlets(cfg nfpm.RPMServiceScriptlets) (post, preun, postun string) {
+	if len(cfg.Units) == 0 {
+		return "", "", ""
+	}
+	post = SystemdPost(cfg.Units...)
+	preun = SystemdPreun(cfg.Units...)
+	if cfg.RestartOnUpgrade {
+		postun = SystemdPostunWithRestart(cfg.Units...)
+	} else {
+		postun = SystemdPostun(cfg.Units...)
+	}
+	return post, preun, postun
+}
+
+// alternativesScriptlets returns the post and postun snippets that register
+// the alternatives and remove them when the package is removed, but not when
+// it is upgraded.
+func alternativesScriptlets(alternatives []nfpm.Alternative) (post, postun string) {
+	if len(alternatives) == 0 {
+		return "", ""
+	}
+	for _, alt := range alternatives {
+		post += alt.InstallCommand()
+		postun += alt.RemoveCommand()
+	}
+	return post, "if [ $1 -eq 0 ] ; then\n" + postun + "fi\n"
+}
+
+// configMigrationScriptlets returns the posttrans snippet of the config
+// migrations, which handles each .rpmnew file left next to a config file
+// according to its strategy, see nfpm.RPMConfigMigration.
+func configMigrationScriptlets(name string, migrations []nfpm.RPMConfigMigration) (string, error) {
+	var b strings.Builder
+	for _, migration := range migrations {
+		config := files.NormalizeAbsoluteFilePath(migration.Path)
+		rpmnew := files.ShellQuote(config + ".rpmnew")
+		fmt.Fprintf(&b, "if [ -e %s ] ; then\n", rpmnew)
+		switch migration.Strategy {
+		case nfpm.ConfigMigrationReplace:
+			fmt.Fprintf(&b, "    mv -f %s %s\n", files.ShellQuote(config), files.ShellQuote(config+".rpmsave"))
+			fmt.Fprintf(&b, "    mv -f %s %s\n", rpmnew, files.ShellQuote(config))
+			fmt.Fprintf(&b, "    echo %s >&2\n", files.ShellQuote(fmt.Sprintf(
+				"%s: %s was saved as %s.rpmsave and replaced by the new default", name, config, config)))
+		case nfpm.ConfigMigrationScript:
+			script, err := os.ReadFile(migration.Script)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "(\nCONFIG=%s\nRPMNEW=%s\n%s", files.ShellQuote(config), rpmnew, script)
+			if len(script) > 0 && script[len(script)-1] != '\n' {
+				b.WriteString("\n")
+			}
+			b.WriteString(")\n")
+		default:
+			fmt.Fprintf(&b, "    echo %s >&2\n", files.ShellQuote(fmt.Sprintf(
+				"%s: the new default of %s was installed as %s.rpmnew, merge it into %s", name, config, config, config)))
+		}
+		b.WriteString("fi\n")
+	}
+	return b.String(), nil
+}
+
+// failOnError prepends `set -e` to the scriptlet if fail is set, so that it
+// exits as soon as one of its commands fails, instead of with the status of
+// its last command, and rpm sees the failure. The generated snippets that are
+// best effort, such as the systemctl and chattr calls, still ignore theirs.
+func failOnError(script string, fail bool) string {
+	if !fail {
+		return script
+	}
+	return "set -e\n" + script
+}
+
+// Scriptlets returns the scriptlets of the rpm package created with the given
+// info, by the name of their spec file section, e.g. pre or posttrans, with
+// the snippets nfpm generates appended, see nfpm.Scriptlets.
+func (*RPM) Scriptlets(info *nfpm.Info) (map[string]string, error) {
+	info, err := prepareInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	return scriptlets(info)
+}
+
+// scriptlets returns the scriptlets of the prepared info, by the name of
+// their spec file section. The pretrans and verify scripts are added as
+// they are, the others only if they are not empty once the generated
+// snippets are appended.
+func scriptlets(info *nfpm.Info) (map[string]string, error) {
+	scripts := map[string]string{}
+	for name, path := range map[string]string{
+		"pretrans":     info.RPM.Scripts.PreTrans,
+		"verifyscript": info.RPM.Scripts.Verify,
+	} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		scripts[name] = string(data)
+	}
+
+	post, preun, postun := serviceScriptlets(info.RPM.ServiceScriptlets)
+	installAlternatives, removeAlternatives := alternativesScriptlets(info.Alternatives)
+	post = files.AppendScriptlet(post, installAlternatives)
+	postun = files.AppendScriptlet(postun, removeAlternatives)
+	setAttrs, clearAttrs := files.AttrScriptlets(info.Contents)
+	if clearAttrs != "" {
+		// the new files are installed before the scriptlets of the old package
+		// run on upgrades, so the attributes are cleared in %pre already and
+		// in %preun only on removal.
+		preun = files.AppendScriptlet(preun, "if [ $1 -eq 0 ] ; then\n"+clearAttrs+"fi\n")
+	}
+	// on upgrades the old package is erased after the new one is installed,
+	// so the unowned directories are created in %posttrans, once it is gone.
+	createDirs, _ := files.RemoveOnScriptlets(info.Contents)
+	migrations, err := configMigrationScriptlets(info.Name, info.RPM.ConfigMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scriptlet := range []struct {
+		name, path string
+		snippets   []string
+	}{
+		{"pre", info.Scripts.PreInstall, []string{clearAttrs}},
+		{"preun", info.Scripts.PreRemove, []string{preun}},
+		{"post", info.Scripts.PostInstall, []string{post, setAttrs}},
+		{"postun", info.Scripts.PostRemove, []string{postun}},
+		{"posttrans", info.RPM.Scripts.PostTrans, []string{createDirs, migrations}},
+	} {
+		script, err := readScript(scriptlet.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, snippet := range scriptlet.snippets {
+			script = files.AppendScriptlet(script, snippet)
+		}
+		if script != "" {
+			scripts[scriptlet.name] = script
+		}
+	}
+
+	for name, script := range scripts {
+		scripts[name] = failOnError(script, info.RPM.FailOnScriptError)
+	}
+	return scripts, nil
+}
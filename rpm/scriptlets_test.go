@@ -0,0 +1,52 @@
+package rpm
+
+import (
+	"testing"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdScriptlets(t *testing.T) {
+	require.Equal(t, `if [ $1 -eq 1 ] ; then
+    # Initial installation
+    systemctl --no-reload preset foo.service foo.socket >/dev/null 2>&1 || :
+fi
+`, SystemdPost("foo.service", "foo.socket"))
+
+	require.Equal(t, `if [ $1 -eq 0 ] ; then
+    # Package removal, not upgrade
+    systemctl --no-reload disable --now foo.service foo.socket >/dev/null 2>&1 || :
+fi
+`, SystemdPreun("foo.service", "foo.socket"))
+
+	require.Equal(t, `systemctl daemon-reload >/dev/null 2>&1 || :
+`, SystemdPostun("foo.service", "foo.socket"))
+
+	require.Equal(t, `systemctl daemon-reload >/dev/null 2>&1 || :
+if [ $1 -ge 1 ] ; then
+    # Package upgrade, not uninstall
+    systemctl try-restart foo.service foo.socket >/dev/null 2>&1 || :
+fi
+`, SystemdPostunWithRestart("foo.service", "foo.socket"))
+}
+
+func TestServiceScriptlets(t *testing.T) {
+	post, preun, postun := serviceScriptlets(nfpm.RPMServiceScriptlets{})
+	require.Empty(t, post)
+	require.Empty(t, preun)
+	require.Empty(t, postun)
+
+	post, preun, postun = serviceScriptlets(nfpm.RPMServiceScriptlets{
+		Units: []string{"foo.service"},
+	})
+	require.Equal(t, SystemdPost("foo.service"), post)
+	require.Equal(t, SystemdPreun("foo.service"), preun)
+	require.Equal(t, SystemdPostun("foo.service"), postun)
+
+	_, _, postun = serviceScriptlets(nfpm.RPMServiceScriptlets{
+		Units:            []string{"foo.service"},
+		RestartOnUpgrade: true,
+	})
+	require.Equal(t, SystemdPostunWithRestart("foo.service"), postun)
+}
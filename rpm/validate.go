@@ -0,0 +1,95 @@
+package rpm
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// systemdUnitDirs are the directories systemd loads units from.
+// nolint: gochecknoglobals
+var systemdUnitDirs = []string{
+	"/etc/systemd/system",
+	"/etc/systemd/user",
+	"/lib/systemd/system",
+	"/usr/lib/systemd/system",
+	"/usr/lib/systemd/user",
+}
+
+// systemdUnitTypes are the suffixes of the units, systemctl assuming a
+// service for the names without one.
+// nolint: gochecknoglobals
+var systemdUnitTypes = []string{
+	".automount", ".device", ".mount", ".path", ".scope", ".service",
+	".slice", ".socket", ".swap", ".target", ".timer",
+}
+
+// Validate checks the units of the service scriptlets and the config
+// migrations against the prepared contents of the info.
+func (*RPM) Validate(info *nfpm.Info) error {
+	if err := validateServiceUnits(info.RPM.ServiceScriptlets.Units, info.Contents); err != nil {
+		return err
+	}
+	return validateConfigMigrations(info.RPM.ConfigMigrations, info.Contents)
+}
+
+// validateServiceUnits checks that the units of the service scriptlets are
+// shipped by the contents, as systemctl would fail to enable them otherwise.
+// The instances of template units, e.g. foo@bar.service, are shipped by
+// their template, foo@.service.
+func validateServiceUnits(units []string, contents files.Contents) error {
+	shipped := map[string]bool{}
+	for _, content := range contents {
+		switch content.Type {
+		case files.TypeDir, files.TypeImplicitDir, files.TypeRPMGhost:
+			continue
+		}
+		if dir, name := path.Split(path.Clean("/" + content.Destination)); slices.Contains(systemdUnitDirs, path.Clean(dir)) {
+			shipped[name] = true
+		}
+	}
+	for _, unit := range units {
+		name := unit
+		if !slices.Contains(systemdUnitTypes, path.Ext(name)) {
+			name += ".service"
+		}
+		if prefix, instance, ok := strings.Cut(name, "@"); ok {
+			name = prefix + "@" + instance[strings.LastIndexByte(instance, '.'):]
+		}
+		if !shipped[name] {
+			return nfpm.NewValidationError("missing_service_unit", "rpm.service_scriptlets.units", "service unit %q is not a file of the package in %s", unit, strings.Join(systemdUnitDirs, ", "))
+		}
+	}
+	return nil
+}
+
+// validateConfigMigrations checks that the config migrations have a known
+// strategy, a script if they need one, and migrate the config|noreplace files
+// of the contents, as rpm only writes .rpmnew files for them.
+func validateConfigMigrations(migrations []nfpm.RPMConfigMigration, contents files.Contents) error {
+	for _, migration := range migrations {
+		switch migration.Strategy {
+		case "", nfpm.ConfigMigrationLog, nfpm.ConfigMigrationReplace:
+			if migration.Script != "" {
+				return nfpm.NewValidationError("invalid_config_migration", "rpm.config_migrations", "invalid config migration of %s: script is only used by the script strategy", migration.Path)
+			}
+		case nfpm.ConfigMigrationScript:
+			if migration.Script == "" {
+				return nfpm.NewValidationError("invalid_config_migration", "rpm.config_migrations", "invalid config migration of %s: the script strategy needs a script", migration.Path)
+			}
+		default:
+			return nfpm.NewValidationError("invalid_config_migration", "rpm.config_migrations", "invalid config migration of %s: unknown strategy %q, must be one of %s, %s or %s",
+				migration.Path, migration.Strategy, nfpm.ConfigMigrationLog, nfpm.ConfigMigrationReplace, nfpm.ConfigMigrationScript)
+		}
+		dst := files.NormalizeAbsoluteFilePath(migration.Path)
+		if !slices.ContainsFunc(contents, func(content *files.Content) bool {
+			return content.Type == files.TypeConfigNoReplace && content.Destination == dst
+		}) {
+			return nfpm.NewValidationError("invalid_config_migration", "rpm.config_migrations", "invalid config migration of %s: not a config|noreplace file of the package", migration.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto/md5" // nolint:gosec
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/caarlos0/go-rpmutils"
+	"github.com/caarlos0/go-rpmutils/cpio"
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+	"github.com/goreleaser/nfpm/v2/internal/sign"
+)
+
+const (
+	// https://github.com/rpm-software-management/rpm/blob/master/lib/rpmtag.h#L72
+	tagSigSHA256 = 273
+	// https://github.com/rpm-software-management/rpm/blob/master/lib/rpmtag.h#L371
+	tagPayloadDigest     = 5092
+	tagPayloadDigestAlgo = 5093
+	// RPMTAG_FILEDIGESTALGO, md5 for the packages built for old rpm versions,
+	// see addFileDigests.
+	tagFileDigestAlgo = 5011
+	// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmpgp.h
+	hashAlgoMD5    = 1
+	hashAlgoSHA256 = 8
+)
+
+// Verify reads back a rpm package created with the given info and checks that
+// the digests of its header, payload and files match, that its payload
+// extracts cleanly, that it holds all of the contents and that its signature,
+// if any, is valid. The contents are prepared for the packager like Package
+// does.
+func (*RPM) Verify(info *nfpm.Info, rpm io.Reader) (err error) {
+	// rpmutils panics on some malformed headers instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading rpm: %v", r)
+		}
+	}()
+
+	info, err = prepareInfo(info)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(rpm)
+	if err != nil {
+		return err
+	}
+
+	header, err := rpmutils.ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	headerRange := header.GetRange()
+	if err := verifyDigest(header, tagSigSHA256, data[headerRange.Start:headerRange.End]); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if algo, err := header.GetInts(tagPayloadDigestAlgo); err != nil || len(algo) != 1 || algo[0] != hashAlgoSHA256 {
+		return fmt.Errorf("payload: digest algorithm is not sha256: %v", algo)
+	}
+	if err := verifyDigest(header, tagPayloadDigest, data[headerRange.End:]); err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+
+	if info.RPM.Signature.HasKey() && info.RPM.Signature.SignFn == nil {
+		if err := verifySignature(sign.SignatureKey(info.RPM.Signature.PackageSignature), data); err != nil {
+			return err
+		}
+	}
+
+	fileInfos, err := header.GetFiles()
+	if err != nil {
+		return fmt.Errorf("reading files: %w", err)
+	}
+	if err := verifyPayload(data, fileDigest(header)); err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+	return verifyContents(info.Contents, fileInfos)
+}
+
+// InstalledSize returns the size recorded in the header of the rpm package
+// read from r, in bytes.
+func (*RPM) InstalledSize(rpm io.Reader) (size int64, err error) {
+	// rpmutils panics on some malformed headers instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading rpm: %v", r)
+		}
+	}()
+
+	header, err := rpmutils.ReadHeader(rpm)
+	if err != nil {
+		return 0, fmt.Errorf("reading header: %w", err)
+	}
+	value, err := header.GetUint64Fallback(rpmutils.SIZE, rpmutils.LONGSIZE)
+	if err != nil {
+		return 0, fmt.Errorf("reading size: %w", err)
+	}
+	return int64(value), nil
+}
+
+// ReadMetadata returns the Info.Metadata recorded at the end of the
+// description of the rpm package read from r.
+func (*RPM) ReadMetadata(rpm io.Reader) (metadata map[string]string, err error) {
+	// rpmutils panics on some malformed headers instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading rpm: %v", r)
+		}
+	}()
+
+	header, err := rpmutils.ReadHeader(rpm)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	description, err := header.GetString(rpmutils.DESCRIPTION)
+	if err != nil {
+		return nil, fmt.Errorf("reading description: %w", err)
+	}
+
+	metadata = map[string]string{}
+	idx := strings.LastIndex(description, "\n\n"+metadataHeading+"\n")
+	if idx == -1 {
+		return metadata, nil
+	}
+	lines := strings.Split(description[idx+len("\n\n"+metadataHeading+"\n"):], "\n")
+	for _, line := range lines {
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "  "), ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid metadata line: %q", line)
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
+// ReadIdentity returns the name, the version, as [epoch:]version-release,
+// and the architecture recorded in the header of the rpm package read from r.
+func (*RPM) ReadIdentity(rpm io.Reader) (identity nfpm.Identity, err error) {
+	// rpmutils panics on some malformed headers instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading rpm: %v", r)
+		}
+	}()
+
+	header, err := rpmutils.ReadHeader(rpm)
+	if err != nil {
+		return nfpm.Identity{}, fmt.Errorf("reading header: %w", err)
+	}
+	nevra, err := header.GetNEVRA()
+	if err != nil {
+		return nfpm.Identity{}, fmt.Errorf("reading nevra: %w", err)
+	}
+	version := nevra.Version + "-" + nevra.Release
+	if nevra.Epoch != "0" {
+		version = nevra.Epoch + ":" + version
+	}
+	return nfpm.Identity{Name: nevra.Name, Version: version, Arch: nevra.Arch}, nil
+}
+
+func verifyDigest(header *rpmutils.RpmHeader, tag int, data []byte) error {
+	expected, err := header.GetStrings(tag)
+	if err != nil {
+		return fmt.Errorf("reading digest: %w", err)
+	}
+	if len(expected) != 1 {
+		return fmt.Errorf("expected one digest, got %d", len(expected))
+	}
+	if digest := fmt.Sprintf("%x", sha256.Sum256(data)); digest != expected[0] {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", expected[0], digest)
+	}
+	return nil
+}
+
+func verifySignature(key sign.Key, data []byte) error {
+	keyring, err := sign.PGPReadKeyring(key)
+	if err != nil {
+		return err
+	}
+	_, sigs, err := rpmutils.Verify(bytes.NewReader(data), keyring)
+	if err != nil {
+		return fmt.Errorf("verifying signature: %w", err)
+	}
+	if len(sigs) == 0 {
+		return errors.New("package is not signed")
+	}
+	return nil
+}
+
+// fileDigest returns the hash of the file digests of the header, which is
+// md5 for the packages built for rpm versions without sha256 digests.
+func fileDigest(header *rpmutils.RpmHeader) func() hash.Hash {
+	if algo, err := header.GetInts(tagFileDigestAlgo); err == nil && len(algo) > 0 && algo[0] == hashAlgoMD5 {
+		return md5.New
+	}
+	return sha256.New
+}
+
+func verifyPayload(data []byte, newDigest func() hash.Hash) error {
+	pkg, err := rpmutils.ReadRpm(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	payload, err := pkg.PayloadReaderExtended()
+	if err != nil {
+		return err
+	}
+	for {
+		fileInfo, err := payload.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fileInfo.Mode()&^0o7777 != cpio.S_ISREG || payload.IsLink() {
+			continue
+		}
+		digest := newDigest()
+		if _, err := io.Copy(digest, payload); err != nil {
+			return fmt.Errorf("%s: %w", fileInfo.Name(), err)
+		}
+		if sum := fmt.Sprintf("%x", digest.Sum(nil)); sum != fileInfo.Digest() {
+			return fmt.Errorf("%s: digest mismatch: expected %s, got %s", fileInfo.Name(), fileInfo.Digest(), sum)
+		}
+	}
+}
+
+func verifyContents(contents files.Contents, fileInfos []rpmutils.FileInfo) error {
+	packaged := make(map[string]rpmutils.FileInfo, len(fileInfos))
+	for _, fileInfo := range fileInfos {
+		packaged[fileInfo.Name()] = fileInfo
+	}
+
+	for _, content := range contents {
+		if content.Packager != "" && content.Packager != packagerName {
+			continue
+		}
+		if content.Type == files.TypeImplicitDir || content.IsUnowned() {
+			continue
+		}
+
+		name := files.ToNixPath(content.Destination)
+		fileInfo, ok := packaged[name]
+		if !ok {
+			return fmt.Errorf("%s: missing from package", name)
+		}
+		switch content.Type {
+		case files.TypeDir:
+			if fileInfo.Mode()&^0o7777 != tagDirectory {
+				return fmt.Errorf("%s: expected a directory", name)
+			}
+		case files.TypeSymlink:
+			if fileInfo.Mode()&^0o7777 != tagLink || fileInfo.Linkname() != content.Source {
+				return fmt.Errorf("%s: expected symlink to %s, got %s", name, content.Source, fileInfo.Linkname())
+			}
+		}
+	}
+	return nil
+}